@@ -0,0 +1,683 @@
+/*
+ * Package grayscale converts PDF content to grayscale in a vectorized fashion, including images,
+ * patterns, shadings and all content streams of forms.
+ *
+ * Used by advanced/pdf_grayscale_transform.go and testing/pdf_grayscale_convert_bench.go.
+ */
+
+package grayscale
+
+import (
+	"errors"
+
+	"github.com/unidoc/unipdf/v3/common"
+	"github.com/unidoc/unipdf/v3/contentstream"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+	"github.com/unidoc/unipdf/v3/ps"
+)
+
+// Options controls the grayscale conversion.
+type Options struct {
+	// SkipGrayFilters leaves images alone that are encoded with filters which are only used for
+	// grayscale data (CCITTFaxDecode, JBIG2Decode).
+	SkipGrayFilters bool
+}
+
+// ConvertPage replaces color objects on `page` with grayscale ones. It also converts the referenced
+// XObject Images and Forms to grayscale. `opts` may be nil for the default options.
+func ConvertPage(page *model.PdfPage, opts *Options) error {
+	// For each page, we go through the resources and look for the images.
+	contents, err := page.GetAllContentStreams()
+	if err != nil {
+		return err
+	}
+
+	grayContent, err := TransformContentStream(contents, page.Resources, opts)
+	if err != nil {
+		return err
+	}
+
+	return page.SetContentStreams([]string{string(grayContent)}, core.NewFlateEncoder())
+}
+
+// isGrayFilter returns true if `filterName` is only used for grayscale images.
+func isGrayFilter(filterName string) bool {
+	switch filterName {
+	// TODO: Add JPEG2000 encoding/decoding. Until then we assume JPEG2000 images are color.
+	case "CCITTDecode", "CCITTFaxDecode", "JBIG2Decode":
+		return true
+	}
+	return false
+}
+
+// isPatternCS returns true if `cs` represents a Pattern colorspace.
+func isPatternCS(cs model.PdfColorspace) bool {
+	_, isPattern := cs.(*model.PdfColorspaceSpecialPattern)
+	return isPattern
+}
+
+// TransformContentStream returns `contents` converted to grayscale. Colorspaces, patterns, shadings
+// and XObjects referenced by the content stream are converted in place in `resources`.
+// `opts` may be nil for the default options.
+func TransformContentStream(contents string, resources *model.PdfPageResources, opts *Options) ([]byte, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	cstreamParser := contentstream.NewContentStreamParser(contents)
+	operations, err := cstreamParser.Parse()
+	if err != nil {
+		return nil, err
+	}
+	processedOperations := &contentstream.ContentStreamOperations{}
+
+	transformedPatterns := map[core.PdfObjectName]bool{} // List of already transformed patterns. Avoid multiple conversions.
+	transformedShadings := map[core.PdfObjectName]bool{} // List of already transformed shadings. Avoid multiple conversions.
+
+	// The content stream processor keeps track of the graphics state and we can make our own handlers to process certain commands,
+	// using the AddHandler method.  In this case, we hook up to color related operands, and for image and form handling.
+	processor := contentstream.NewContentStreamProcessor(*operations)
+	// Add handlers for colorspace related functionality.
+	processor.AddHandler(contentstream.HandlerConditionEnumAllOperands, "",
+		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
+			operand := op.Operand
+			switch operand {
+			case "CS": // Set colorspace operands (stroking).
+				if isPatternCS(gs.ColorspaceStroking) {
+					// If referring to a pattern colorspace with an external definition, need to update the definition.
+					// If has an underlying colorspace, then go and change it to DeviceGray.
+					// Needs to be specified externally in the colorspace resources.
+
+					csname := op.Params[0].(*core.PdfObjectName)
+					if *csname != "Pattern" {
+						// Update if referring to an external colorspace in resources.
+						cs, ok := resources.GetColorspaceByName(*csname)
+						if !ok {
+							common.Log.Debug("Undefined colorspace for pattern (%s)", csname)
+							return errors.New("Colorspace not defined")
+						}
+
+						patternCS, ok := cs.(*model.PdfColorspaceSpecialPattern)
+						if !ok {
+							return errors.New("Type error")
+						}
+
+						if patternCS.UnderlyingCS != nil {
+							// Swap out for a gray colorspace.
+							patternCS.UnderlyingCS = model.NewPdfColorspaceDeviceGray()
+						}
+
+						err = resources.SetColorspaceByName(*csname, patternCS)
+						if err != nil {
+							return err
+						}
+					}
+					*processedOperations = append(*processedOperations, op)
+					return nil
+				}
+
+				op := contentstream.ContentStreamOperation{}
+				op.Operand = operand
+				op.Params = []core.PdfObject{core.MakeName("DeviceGray")}
+				*processedOperations = append(*processedOperations, &op)
+				return nil
+			case "cs": // Set colorspace operands (non-stroking).
+				if isPatternCS(gs.ColorspaceNonStroking) {
+					// If referring to a pattern colorspace with an external definition, need to update the definition.
+					// If has an underlying colorspace, then go and change it to DeviceGray.
+					// Needs to be specified externally in the colorspace resources.
+
+					csname := op.Params[0].(*core.PdfObjectName)
+					if *csname != "Pattern" {
+						// Update if referring to an external colorspace in resources.
+						cs, ok := resources.GetColorspaceByName(*csname)
+						if !ok {
+							common.Log.Debug("Undefined colorspace for pattern (%s)", csname)
+							return errors.New("Colorspace not defined")
+						}
+
+						patternCS, ok := cs.(*model.PdfColorspaceSpecialPattern)
+						if !ok {
+							return errors.New("Type error")
+						}
+
+						if patternCS.UnderlyingCS != nil {
+							// Swap out for a gray colorspace.
+							patternCS.UnderlyingCS = model.NewPdfColorspaceDeviceGray()
+						}
+
+						resources.SetColorspaceByName(*csname, patternCS)
+					}
+					*processedOperations = append(*processedOperations, op)
+					return nil
+				}
+
+				op := contentstream.ContentStreamOperation{}
+				op.Operand = operand
+				op.Params = []core.PdfObject{core.MakeName("DeviceGray")}
+				*processedOperations = append(*processedOperations, &op)
+				return nil
+
+			case "SC", "SCN": // Set stroking color.  Includes pattern colors.
+				if isPatternCS(gs.ColorspaceStroking) {
+					op := contentstream.ContentStreamOperation{}
+					op.Operand = operand
+					op.Params = []core.PdfObject{}
+
+					patternColor, ok := gs.ColorStroking.(*model.PdfColorPattern)
+					if !ok {
+						return errors.New("Invalid stroking color type")
+					}
+
+					if patternColor.Color != nil {
+						color, err := gs.ColorspaceStroking.ColorToRGB(patternColor.Color)
+						if err != nil {
+							common.Log.Debug("Error: %v", err)
+							return err
+						}
+						rgbColor := color.(*model.PdfColorDeviceRGB)
+						grayColor := rgbColor.ToGray()
+
+						op.Params = append(op.Params, core.MakeFloat(grayColor.Val()))
+					}
+
+					if _, has := transformedPatterns[patternColor.PatternName]; has {
+						// Already processed, need not change anything, except underlying color if used.
+						op.Params = append(op.Params, core.MakeName(string(patternColor.PatternName)))
+						*processedOperations = append(*processedOperations, &op)
+						return nil
+					}
+					transformedPatterns[patternColor.PatternName] = true
+
+					// Look up the pattern name and convert it.
+					pattern, found := resources.GetPatternByName(patternColor.PatternName)
+					if !found {
+						return errors.New("Undefined pattern name")
+					}
+
+					grayPattern, err := ConvertPattern(pattern, opts)
+					if err != nil {
+						common.Log.Debug("Unable to convert pattern to grayscale: %v", err)
+						return err
+					}
+					resources.SetPatternByName(patternColor.PatternName, grayPattern.ToPdfObject())
+
+					op.Params = append(op.Params, core.MakeName(string(patternColor.PatternName)))
+					*processedOperations = append(*processedOperations, &op)
+				} else {
+					color, err := gs.ColorspaceStroking.ColorToRGB(gs.ColorStroking)
+					if err != nil {
+						common.Log.Debug("Error with ColorToRGB: %v", err)
+						return err
+					}
+					rgbColor := color.(*model.PdfColorDeviceRGB)
+					grayColor := rgbColor.ToGray()
+
+					op := contentstream.ContentStreamOperation{}
+					op.Operand = operand
+					op.Params = []core.PdfObject{core.MakeFloat(grayColor.Val())}
+					*processedOperations = append(*processedOperations, &op)
+				}
+
+				return nil
+			case "sc", "scn": // Set nonstroking color.
+				if isPatternCS(gs.ColorspaceNonStroking) {
+					op := contentstream.ContentStreamOperation{}
+					op.Operand = operand
+					op.Params = []core.PdfObject{}
+
+					patternColor, ok := gs.ColorNonStroking.(*model.PdfColorPattern)
+					if !ok {
+						return errors.New("Invalid stroking color type")
+					}
+
+					if patternColor.Color != nil {
+						color, err := gs.ColorspaceNonStroking.ColorToRGB(patternColor.Color)
+						if err != nil {
+							common.Log.Debug("Error : %v", err)
+							return err
+						}
+						rgbColor := color.(*model.PdfColorDeviceRGB)
+						grayColor := rgbColor.ToGray()
+
+						op.Params = append(op.Params, core.MakeFloat(grayColor.Val()))
+					}
+
+					if _, has := transformedPatterns[patternColor.PatternName]; has {
+						// Already processed, need not change anything, except underlying color if used.
+						op.Params = append(op.Params, core.MakeName(string(patternColor.PatternName)))
+						*processedOperations = append(*processedOperations, &op)
+						return nil
+					}
+					transformedPatterns[patternColor.PatternName] = true
+
+					// Look up the pattern name and convert it.
+					pattern, found := resources.GetPatternByName(patternColor.PatternName)
+					if !found {
+						return errors.New("Undefined pattern name")
+					}
+
+					grayPattern, err := ConvertPattern(pattern, opts)
+					if err != nil {
+						common.Log.Debug("Unable to convert pattern to grayscale: %v", err)
+						return err
+					}
+					resources.SetPatternByName(patternColor.PatternName, grayPattern.ToPdfObject())
+
+					op.Params = append(op.Params, core.MakeName(string(patternColor.PatternName)))
+					*processedOperations = append(*processedOperations, &op)
+				} else {
+					color, err := gs.ColorspaceNonStroking.ColorToRGB(gs.ColorNonStroking)
+					if err != nil {
+						common.Log.Debug("Error: %v", err)
+						return err
+					}
+					rgbColor := color.(*model.PdfColorDeviceRGB)
+					grayColor := rgbColor.ToGray()
+
+					op := contentstream.ContentStreamOperation{}
+					op.Operand = operand
+					op.Params = []core.PdfObject{core.MakeFloat(grayColor.Val())}
+
+					*processedOperations = append(*processedOperations, &op)
+				}
+				return nil
+			case "RG", "K": // Set RGB or CMYK stroking color.
+				color, err := gs.ColorspaceStroking.ColorToRGB(gs.ColorStroking)
+				if err != nil {
+					common.Log.Debug("Error: %v", err)
+					return err
+				}
+				rgbColor := color.(*model.PdfColorDeviceRGB)
+				grayColor := rgbColor.ToGray()
+
+				op := contentstream.ContentStreamOperation{}
+				op.Operand = "G"
+				op.Params = []core.PdfObject{core.MakeFloat(grayColor.Val())}
+
+				*processedOperations = append(*processedOperations, &op)
+				return nil
+			case "rg", "k": // Set RGB or CMYK as nonstroking color.
+				color, err := gs.ColorspaceNonStroking.ColorToRGB(gs.ColorNonStroking)
+				if err != nil {
+					common.Log.Debug("Error: %v", err)
+					return err
+				}
+				rgbColor := color.(*model.PdfColorDeviceRGB)
+				grayColor := rgbColor.ToGray()
+
+				op := contentstream.ContentStreamOperation{}
+				op.Operand = "g"
+				op.Params = []core.PdfObject{core.MakeFloat(grayColor.Val())}
+
+				*processedOperations = append(*processedOperations, &op)
+				return nil
+			case "BI": // Inline images are appended by the BI handler below.
+				return nil
+			case "sh": // Paints the shape and color defined by shading dict.
+				if len(op.Params) != 1 {
+					return errors.New("Params to sh operator should be 1")
+				}
+				shname, ok := op.Params[0].(*core.PdfObjectName)
+				if !ok {
+					return errors.New("sh parameter should be a name")
+				}
+				if _, has := transformedShadings[*shname]; has {
+					// Already processed, no need to do anything.
+					*processedOperations = append(*processedOperations, op)
+					return nil
+				}
+				transformedShadings[*shname] = true
+
+				shading, found := resources.GetShadingByName(*shname)
+				if !found {
+					return errors.New("Shading not defined in resources")
+				}
+
+				grayShading, err := ConvertShading(shading)
+				if err != nil {
+					return err
+				}
+
+				resources.SetShadingByName(*shname, grayShading.GetContext().ToPdfObject())
+			}
+			*processedOperations = append(*processedOperations, op)
+
+			return nil
+		})
+	// Add handler for image related handling.  Note that inline images are completely stored with a ContentStreamInlineImage
+	// object as the parameter for BI.
+	processor.AddHandler(contentstream.HandlerConditionEnumOperand, "BI",
+		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
+			if len(op.Params) != 1 {
+				common.Log.Debug("BI Error invalid number of params")
+				return errors.New("invalid number of parameters")
+			}
+			// Inline image.
+			iimg, ok := op.Params[0].(*contentstream.ContentStreamInlineImage)
+			if !ok {
+				common.Log.Debug("Error: Invalid handling for inline image")
+				return errors.New("Invalid inline image parameter")
+			}
+
+			cs, err := iimg.GetColorSpace(resources)
+			if err != nil {
+				common.Log.Debug("Error getting color space for inline image: %v", err)
+				return err
+			}
+			if cs.GetNumComponents() == 1 {
+				// Already grayscale.
+				*processedOperations = append(*processedOperations, op)
+				return nil
+			}
+
+			encoder, err := iimg.GetEncoder()
+			if err != nil {
+				common.Log.Debug("Error getting encoder for inline image: %v", err)
+				return err
+			}
+			if opts.SkipGrayFilters && isGrayFilter(encoder.GetFilterName()) {
+				*processedOperations = append(*processedOperations, op)
+				return nil
+			}
+
+			img, err := iimg.ToImage(resources)
+			if err != nil {
+				common.Log.Debug("Error converting inline image to image: %v", err)
+				return err
+			}
+			rgbImg, err := cs.ImageToRGB(*img)
+			if err != nil {
+				common.Log.Debug("Error converting image to rgb: %v", err)
+				return err
+			}
+			rgbColorSpace := model.NewPdfColorspaceDeviceRGB()
+			grayImage, err := rgbColorSpace.ImageToGray(rgbImg)
+			if err != nil {
+				common.Log.Debug("Error converting img to gray: %v", err)
+				return err
+			}
+
+			// Update the XObject image.
+			// Use same encoder as input data.  Make sure for DCT filter it is updated to 1 color component.
+			if dctEncoder, is := encoder.(*core.DCTEncoder); is {
+				dctEncoder.ColorComponents = 1
+			}
+
+			grayInlineImg, err := contentstream.NewInlineImageFromImage(grayImage, encoder)
+			if err != nil {
+				if err == core.ErrUnsupportedEncodingParameters {
+					// Unsupported encoding parameters, revert to a basic flate encoder without predictor.
+					encoder = core.NewFlateEncoder()
+				}
+				// Try again, fail on error.
+				grayInlineImg, err = contentstream.NewInlineImageFromImage(grayImage, encoder)
+				if err != nil {
+					common.Log.Debug("Error making a new inline image object: %v", err)
+					return err
+				}
+			}
+
+			// Replace inline image data with the gray image.
+			pOp := contentstream.ContentStreamOperation{}
+			pOp.Operand = "BI"
+			pOp.Params = []core.PdfObject{grayInlineImg}
+			*processedOperations = append(*processedOperations, &pOp)
+
+			return nil
+		})
+
+	// Handler for XObject Image and Forms.
+	processedXObjects := map[string]bool{} // Keep track of processed XObjects to avoid repetition.
+
+	processor.AddHandler(contentstream.HandlerConditionEnumOperand, "Do",
+		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
+			if len(op.Params) < 1 {
+				common.Log.Debug("ERROR: Invalid number of params for Do object.")
+				return errors.New("Range check")
+			}
+
+			// XObject.
+			name := op.Params[0].(*core.PdfObjectName)
+
+			// Only process each one once.
+			_, has := processedXObjects[string(*name)]
+			if has {
+				return nil
+			}
+			processedXObjects[string(*name)] = true
+
+			_, xtype := resources.GetXObjectByName(*name)
+			if xtype == model.XObjectTypeImage {
+				ximg, err := resources.GetXObjectImageByName(*name)
+				if err != nil {
+					common.Log.Debug("Error w/GetXObjectImageByName : %v", err)
+					return err
+				}
+				if opts.SkipGrayFilters && ximg.Filter != nil && isGrayFilter(ximg.Filter.GetFilterName()) {
+					return nil
+				}
+
+				img, err := ximg.ToImage()
+				if err != nil {
+					common.Log.Debug("Error w/ToImage: %v", err)
+					return err
+				}
+
+				rgbImg, err := ximg.ColorSpace.ImageToRGB(*img)
+				if err != nil {
+					common.Log.Debug("Error ImageToRGB: %v", err)
+					return err
+				}
+
+				rgbColorSpace := model.NewPdfColorspaceDeviceRGB()
+				grayImage, err := rgbColorSpace.ImageToGray(rgbImg)
+				if err != nil {
+					common.Log.Debug("Error ImageToGray: %v", err)
+					return err
+				}
+
+				// Update the XObject image.
+				// Use same encoder as input data.  Make sure for DCT filter it is updated to 1 color component.
+				encoder := ximg.Filter
+				if dctEncoder, is := encoder.(*core.DCTEncoder); is {
+					dctEncoder.ColorComponents = 1
+				}
+
+				ximgGray, err := model.NewXObjectImageFromImage(&grayImage, nil, encoder)
+				if err != nil {
+					if err == core.ErrUnsupportedEncodingParameters {
+						// Unsupported encoding parameters, revert to a basic flate encoder without predictor.
+						encoder = core.NewFlateEncoder()
+					}
+
+					// Try again, fail if error.
+					ximgGray, err = model.NewXObjectImageFromImage(&grayImage, nil, encoder)
+					if err != nil {
+						common.Log.Debug("Error creating image: %v", err)
+						return err
+					}
+				}
+
+				// Update the entry.
+				err = resources.SetXObjectImageByName(*name, ximgGray)
+				if err != nil {
+					common.Log.Debug("Failed setting x object: %v (%s)", err, string(*name))
+					return err
+				}
+			} else if xtype == model.XObjectTypeForm {
+				// Go through the XObject Form content stream.
+				xform, err := resources.GetXObjectFormByName(*name)
+				if err != nil {
+					common.Log.Debug("Error: %v", err)
+					return err
+				}
+
+				formContent, err := xform.GetContentStream()
+				if err != nil {
+					common.Log.Debug("Error: %v", err)
+					return err
+				}
+
+				// Process the content stream in the Form object too:
+				// XXX/TODO/Consider: Use either form resources (priority) and fall back to page resources alternatively if not found.
+				// Have not come into cases where needed yet.
+				formResources := xform.Resources
+				if formResources == nil {
+					formResources = resources
+				}
+
+				// Process the content stream in the Form object too:
+				grayContent, err := TransformContentStream(string(formContent), formResources, opts)
+				if err != nil {
+					common.Log.Debug("Error: %v", err)
+					return err
+				}
+
+				xform.SetContentStream(grayContent, nil)
+
+				// Update the resource entry.
+				resources.SetXObjectFormByName(*name, xform)
+			}
+
+			return nil
+		})
+
+	err = processor.Process(resources)
+	if err != nil {
+		common.Log.Debug("Error processing: %v", err)
+		return nil, err
+	}
+
+	return processedOperations.Bytes(), nil
+}
+
+// ConvertPattern converts `pattern` to grayscale (tiling or shading pattern).
+func ConvertPattern(pattern *model.PdfPattern, opts *Options) (*model.PdfPattern, error) {
+	// Case 1: Colored tiling patterns.  Need to process the content stream and replace.
+	if pattern.IsTiling() {
+		tilingPattern := pattern.GetAsTilingPattern()
+
+		if tilingPattern.IsColored() {
+			// A colored tiling pattern can use color operators in its stream, need to process the stream.
+
+			content, err := tilingPattern.GetContentStream()
+			if err != nil {
+				return nil, err
+			}
+
+			grayContents, err := TransformContentStream(string(content), tilingPattern.Resources, opts)
+			if err != nil {
+				return nil, err
+			}
+
+			tilingPattern.SetContentStream(grayContents, nil)
+
+			// Update in-memory pdf objects.
+			_ = tilingPattern.ToPdfObject()
+		}
+	} else if pattern.IsShading() {
+		// Case 2: Shading patterns.  Need to create a new colorspace that can map from N=3,4 colorspaces to grayscale.
+		shadingPattern := pattern.GetAsShadingPattern()
+
+		grayShading, err := ConvertShading(shadingPattern.Shading)
+		if err != nil {
+			return nil, err
+		}
+		shadingPattern.Shading = grayShading
+
+		// Update in-memory pdf objects.
+		_ = shadingPattern.ToPdfObject()
+	}
+
+	return pattern, nil
+}
+
+// ConvertShading converts `shading` to grayscale.
+// This one is slightly involved as a shading defines a color as function of position, i.e. color(x,y) = F(x,y).
+// Since the function can be challenging to change, we define new DeviceN colorspace with a color conversion
+// function.
+func ConvertShading(shading *model.PdfShading) (*model.PdfShading, error) {
+	cs := shading.ColorSpace
+
+	if cs.GetNumComponents() == 1 {
+		// Already grayscale, should be fine. No action taken.
+		return shading, nil
+	} else if cs.GetNumComponents() == 3 {
+		// Create a new DeviceN colorspace that converts R,G,B -> Grayscale
+		// Use: gray := 0.3*R + 0.59G + 0.11B
+		// PS program: { 0.11 mul exch 0.59 mul add exch 0.3 mul add }.
+		transformFunc := &model.PdfFunctionType4{}
+		transformFunc.Domain = []float64{0, 1, 0, 1, 0, 1}
+		transformFunc.Range = []float64{0, 1}
+		rgbToGrayPsProgram := ps.NewPSProgram()
+		rgbToGrayPsProgram.Append(ps.MakeReal(0.11))
+		rgbToGrayPsProgram.Append(ps.MakeOperand("mul"))
+		rgbToGrayPsProgram.Append(ps.MakeOperand("exch"))
+		rgbToGrayPsProgram.Append(ps.MakeReal(0.59))
+		rgbToGrayPsProgram.Append(ps.MakeOperand("mul"))
+		rgbToGrayPsProgram.Append(ps.MakeOperand("add"))
+		rgbToGrayPsProgram.Append(ps.MakeOperand("exch"))
+		rgbToGrayPsProgram.Append(ps.MakeReal(0.3))
+		rgbToGrayPsProgram.Append(ps.MakeOperand("mul"))
+		rgbToGrayPsProgram.Append(ps.MakeOperand("add"))
+		transformFunc.Program = rgbToGrayPsProgram
+
+		// Define the DeviceN colorspace that performs the R,G,B -> Gray conversion for us.
+		transformcs := model.NewPdfColorspaceDeviceN()
+		transformcs.AlternateSpace = model.NewPdfColorspaceDeviceGray()
+		transformcs.ColorantNames = core.MakeArray(core.MakeName("R"), core.MakeName("G"), core.MakeName("B"))
+		transformcs.TintTransform = transformFunc
+
+		// Replace the old colorspace with the new.
+		shading.ColorSpace = transformcs
+
+		return shading, nil
+	} else if cs.GetNumComponents() == 4 {
+		// Create a new DeviceN colorspace that converts C,M,Y,K -> Grayscale.
+		// Use: gray = 1.0 - min(1.0, 0.3*C + 0.59*M + 0.11*Y + K)  ; where BG(k) = k simply.
+		// PS program: {exch 0.11 mul add exch 0.59 mul add exch 0.3 mul add dup 1.0 ge { pop 1.0 } if}
+		transformFunc := &model.PdfFunctionType4{}
+		transformFunc.Domain = []float64{0, 1, 0, 1, 0, 1, 0, 1}
+		transformFunc.Range = []float64{0, 1}
+
+		cmykToGrayPsProgram := ps.NewPSProgram()
+		cmykToGrayPsProgram.Append(ps.MakeOperand("exch"))
+		cmykToGrayPsProgram.Append(ps.MakeReal(0.11))
+		cmykToGrayPsProgram.Append(ps.MakeOperand("mul"))
+		cmykToGrayPsProgram.Append(ps.MakeOperand("add"))
+		cmykToGrayPsProgram.Append(ps.MakeOperand("exch"))
+		cmykToGrayPsProgram.Append(ps.MakeReal(0.59))
+		cmykToGrayPsProgram.Append(ps.MakeOperand("mul"))
+		cmykToGrayPsProgram.Append(ps.MakeOperand("add"))
+		cmykToGrayPsProgram.Append(ps.MakeOperand("exch"))
+		cmykToGrayPsProgram.Append(ps.MakeReal(0.30))
+		cmykToGrayPsProgram.Append(ps.MakeOperand("mul"))
+		cmykToGrayPsProgram.Append(ps.MakeOperand("add"))
+		cmykToGrayPsProgram.Append(ps.MakeOperand("dup"))
+		cmykToGrayPsProgram.Append(ps.MakeReal(1.0))
+		cmykToGrayPsProgram.Append(ps.MakeOperand("ge"))
+		// Add sub procedure.
+		subProc := ps.NewPSProgram()
+		subProc.Append(ps.MakeOperand("pop"))
+		subProc.Append(ps.MakeReal(1.0))
+		cmykToGrayPsProgram.Append(subProc)
+		cmykToGrayPsProgram.Append(ps.MakeOperand("if"))
+		transformFunc.Program = cmykToGrayPsProgram
+
+		// Define the DeviceN colorspace that performs the R,G,B -> Gray conversion for us.
+		transformcs := model.NewPdfColorspaceDeviceN()
+		transformcs.AlternateSpace = model.NewPdfColorspaceDeviceGray()
+		transformcs.ColorantNames = core.MakeArray(core.MakeName("C"), core.MakeName("M"), core.MakeName("Y"), core.MakeName("K"))
+		transformcs.TintTransform = transformFunc
+
+		// Replace the old colorspace with the new.
+		shading.ColorSpace = transformcs
+
+		return shading, nil
+	} else {
+		common.Log.Debug("Cannot convert to shading pattern grayscale, color space N = %d", cs.GetNumComponents())
+		return nil, errors.New("Unsupported pattern colorspace for grayscale conversion")
+	}
+}
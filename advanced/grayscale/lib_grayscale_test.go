@@ -0,0 +1,62 @@
+package grayscale
+
+import (
+	"testing"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+func TestTransformContentStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+		wantErr  bool
+	}{
+		{"rgb fill", "1 0 0 rg 0 0 10 10 re f", "0.3 g\n0 0 10 10 re\nf\n", false},
+		{"rgb stroke", "0 0 1 RG 1 w 0 0 m 10 10 l S", "0.11 G\n1 w\n0 0 m\n10 10 l\nS\n", false},
+		{"cmyk fill", "0 1 1 0 k", "0.3 g\n", false},
+		{"rgb colorspace", "/DeviceRGB cs 0 1 0 sc", "/DeviceGray cs\n0.59 sc\n", false},
+		{"gray unchanged", "0.3 g 0.7 G", "0.3 g\n0.7 G\n", false},
+		{"text unchanged", "BT /F1 12 Tf (x) Tj ET", "BT\n/F1 12 Tf\n(x) Tj\nET\n", false},
+		{"undefined colorspace", "/CS0 cs 0.5 sc", "", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := TransformContentStream(tc.contents, model.NewPdfPageResources(), nil)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConvertPage(t *testing.T) {
+	page := model.NewPdfPage()
+	page.MediaBox = &model.PdfRectangle{Urx: 100, Ury: 100}
+	page.Resources = model.NewPdfPageResources()
+	if err := page.SetContentStreams([]string{"0 1 0 rg 0 0 10 10 re f"}, core.NewRawEncoder()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ConvertPage(page, &Options{SkipGrayFilters: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := page.GetAllContentStreams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0.59 g\n0 0 10 10 re\nf\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,572 @@
+/*
+ * Package downsample reduces the resolution of the images in PDF files to a target effective
+ * resolution.
+ *
+ * The effective resolution of an image depends on the size it is drawn at: the current
+ * transformation matrix (CTM) at the Do operator that paints it, including the matrices of the form
+ * XObjects it is drawn through. An image can be drawn several times, on several pages and at
+ * different sizes, so all pages are analyzed first and each image is resampled for its largest
+ * placement, i.e. its lowest effective resolution. Resampling uses a separable bicubic
+ * (Catmull-Rom) or Lanczos (a=3) filter. Soft masks (SMask) and explicit masks are resampled with
+ * the same scale factors as their image.
+ *
+ * The images are updated in place, so all references to an image see the resampled version. Inline
+ * images and images used only in annotation appearances are not changed.
+ *
+ * Used by pdftool downsample.
+ */
+
+package downsample
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/contentstream"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/text/glyphs"
+)
+
+// Filter is a resampling filter.
+type Filter string
+
+// Resampling filters.
+const (
+	FilterBicubic Filter = "bicubic"
+	FilterLanczos Filter = "lanczos"
+	// FilterNearest is used for images whose sample values must not be interpolated, i.e. images
+	// with Indexed color spaces or color key masks.
+	FilterNearest Filter = "nearest"
+)
+
+// Options controls the downsampling.
+type Options struct {
+	// DPI is the target effective resolution.
+	DPI float64
+	// Threshold avoids resampling images that are only slightly above the target. Images are
+	// resampled if their effective resolution exceeds DPI*Threshold. Defaults to 1.1.
+	Threshold float64
+	// Filter is the resampling filter. Defaults to FilterLanczos.
+	Filter Filter
+	// Quality is the quality (1-100) used for re-encoding JPEG images. Defaults to 85.
+	Quality int
+}
+
+// Placement is an occurrence of an image in a page content stream.
+type Placement struct {
+	Page int     `json:"page"`
+	DPIX float64 `json:"dpi_x"` // Effective resolution along the image width.
+	DPIY float64 `json:"dpi_y"` // Effective resolution along the image height.
+}
+
+// Image describes an image XObject and its downsampling.
+type Image struct {
+	Name       string      `json:"name"` // Resource name of the image where it was first found.
+	Pages      []int       `json:"pages"`
+	Placements []Placement `json:"placements"`
+	Width      int         `json:"width"`
+	Height     int         `json:"height"`
+	Filter     string      `json:"filter"`
+	// DPIX and DPIY are the lowest effective resolution of all placements.
+	DPIX      float64 `json:"dpi_x"`
+	DPIY      float64 `json:"dpi_y"`
+	Resampled bool    `json:"resampled"`
+	NewWidth  int     `json:"new_width,omitempty"`
+	NewHeight int     `json:"new_height,omitempty"`
+	Masks     int     `json:"masks,omitempty"` // Number of masks resampled with the image.
+	Before    int     `json:"before"`          // Encoded size of the image and its masks before.
+	After     int     `json:"after"`           // Encoded size of the image and its masks after.
+	Note      string  `json:"note,omitempty"`  // Why the image was not resampled.
+	stream    *core.PdfObjectStream
+}
+
+// maxFormDepth limits the nesting of form XObjects that are analyzed.
+const maxFormDepth = 10
+
+// Downsampler collects the placements of images and resamples them.
+type Downsampler struct {
+	opts   Options
+	images map[*core.PdfObjectStream]*Image
+	order  []*Image
+}
+
+// New returns a Downsampler with options `opts`.
+func New(opts Options) *Downsampler {
+	if opts.Threshold < 1 {
+		opts.Threshold = 1.1
+	}
+	if opts.Filter == "" {
+		opts.Filter = FilterLanczos
+	}
+	if opts.Quality <= 0 || opts.Quality > 100 {
+		opts.Quality = 85
+	}
+	return &Downsampler{opts: opts, images: map[*core.PdfObjectStream]*Image{}}
+}
+
+// Images returns the images found so far in the order they were found.
+func (d *Downsampler) Images() []*Image {
+	return d.order
+}
+
+// AddPage records the placements of the images drawn on `page`.
+func (d *Downsampler) AddPage(page *model.PdfPage, pageNum int) error {
+	contents, err := page.GetAllContentStreams()
+	if err != nil {
+		return err
+	}
+	return d.addContent(contents, page.Resources, glyphs.IdentityMatrix(), pageNum, 0)
+}
+
+// addContent records the placements of the images drawn by `contents`. `m` maps the space of
+// `contents` to page space.
+func (d *Downsampler) addContent(contents string, resources *model.PdfPageResources, m glyphs.Matrix,
+	pageNum, depth int) error {
+	if depth >= maxFormDepth || resources == nil {
+		return nil
+	}
+	ops, err := contentstream.NewContentStreamParser(contents).Parse()
+	if err != nil {
+		return err
+	}
+
+	processor := contentstream.NewContentStreamProcessor(*ops)
+	processor.AddHandler(contentstream.HandlerConditionEnumOperand, "Do",
+		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
+			if len(op.Params) != 1 {
+				return nil
+			}
+			name, ok := core.GetName(op.Params[0])
+			if !ok {
+				return nil
+			}
+			ctm := glyphs.CTM(gs).Mult(m)
+			stream, xtype := resources.GetXObjectByName(*name)
+			switch xtype {
+			case model.XObjectTypeImage:
+				d.addPlacement(stream, string(*name), ctm, pageNum)
+			case model.XObjectTypeForm:
+				form, err := resources.GetXObjectFormByName(*name)
+				if err != nil {
+					return err
+				}
+				formContents, err := form.GetContentStream()
+				if err != nil {
+					return err
+				}
+				formRes := form.Resources
+				if formRes == nil {
+					formRes = resources
+				}
+				return d.addContent(string(formContents), formRes, formMatrix(form).Mult(ctm), pageNum, depth+1)
+			}
+			return nil
+		})
+	return processor.Process(resources)
+}
+
+// addPlacement records that image `stream` is drawn with `ctm` on page `pageNum`.
+func (d *Downsampler) addPlacement(stream *core.PdfObjectStream, name string, ctm glyphs.Matrix, pageNum int) {
+	img, ok := d.images[stream]
+	if !ok {
+		img = &Image{Name: name, stream: stream}
+		if w, ok := core.GetIntVal(stream.Get("Width")); ok {
+			img.Width = w
+		}
+		if h, ok := core.GetIntVal(stream.Get("Height")); ok {
+			img.Height = h
+		}
+		img.Filter = filterName(stream)
+		d.images[stream] = img
+		d.order = append(d.order, img)
+	}
+
+	// The image is drawn into the unit square, so the lengths of the transformed unit vectors are
+	// its placed size in points.
+	width := math.Hypot(ctm[0], ctm[1])
+	height := math.Hypot(ctm[2], ctm[3])
+	if width < 1e-6 || height < 1e-6 {
+		return
+	}
+	p := Placement{
+		Page: pageNum,
+		DPIX: float64(img.Width) / width * 72,
+		DPIY: float64(img.Height) / height * 72,
+	}
+	if len(img.Placements) == 0 {
+		img.DPIX, img.DPIY = p.DPIX, p.DPIY
+	} else {
+		img.DPIX = math.Min(img.DPIX, p.DPIX)
+		img.DPIY = math.Min(img.DPIY, p.DPIY)
+	}
+	img.Placements = append(img.Placements, p)
+	if len(img.Pages) == 0 || img.Pages[len(img.Pages)-1] != pageNum {
+		img.Pages = append(img.Pages, pageNum)
+	}
+}
+
+// Apply resamples the images whose effective resolution exceeds the target. It must be called after
+// all pages were added. Images that cannot be resampled are left unchanged and their Note tells why.
+func (d *Downsampler) Apply() error {
+	masks := map[*core.PdfObjectStream]bool{}
+	for _, img := range d.order {
+		img.Before = len(img.stream.Stream)
+		img.After = img.Before
+		if len(img.Placements) == 0 {
+			img.Note = "not visible"
+			continue
+		}
+		limit := d.opts.DPI * d.opts.Threshold
+		if img.DPIX <= limit && img.DPIY <= limit {
+			continue
+		}
+
+		scaleX := math.Min(1, d.opts.DPI/img.DPIX)
+		scaleY := math.Min(1, d.opts.DPI/img.DPIY)
+		newW, newH := scaled(img.Width, scaleX), scaled(img.Height, scaleY)
+
+		// Resample the masks first: if the image fails the masks are left alone.
+		filter := d.opts.Filter
+		if isIndexed(img.stream) || isColorKeyMasked(img.stream) {
+			filter = FilterNearest
+		}
+		encoded, err := d.resampled(img.stream, newW, newH, filter)
+		if err != nil {
+			img.Note = err.Error()
+			continue
+		}
+
+		var maskSizes [2]int
+		var resampledMasks []*maskUpdate
+		failed := false
+		for _, key := range []core.PdfObjectName{"SMask", "Mask"} {
+			mask, ok := core.GetStream(img.stream.Get(key))
+			if !ok || masks[mask] {
+				continue
+			}
+			mw, _ := core.GetIntVal(mask.Get("Width"))
+			mh, _ := core.GetIntVal(mask.Get("Height"))
+			maskW, maskH := scaled(mw, scaleX), scaled(mh, scaleY)
+			if mw == img.Width && mh == img.Height {
+				maskW, maskH = newW, newH
+			}
+			maskEncoded, err := d.resampled(mask, maskW, maskH, d.opts.Filter)
+			if err != nil {
+				img.Note = fmt.Sprintf("%s: %v", key, err)
+				failed = true
+				break
+			}
+			resampledMasks = append(resampledMasks, &maskUpdate{mask, maskEncoded})
+			maskSizes[0] += len(mask.Stream)
+			maskSizes[1] += len(maskEncoded.Stream)
+		}
+		if failed {
+			continue
+		}
+
+		update(img.stream, encoded)
+		for _, m := range resampledMasks {
+			update(m.stream, m.encoded)
+			masks[m.stream] = true
+		}
+		img.Resampled = true
+		img.NewWidth, img.NewHeight = newW, newH
+		img.Masks = len(resampledMasks)
+		img.Before += maskSizes[0]
+		img.After = len(encoded.Stream) + maskSizes[1]
+	}
+	return nil
+}
+
+// maskUpdate is a resampled mask that has not been stored yet.
+type maskUpdate struct {
+	stream  *core.PdfObjectStream
+	encoded *core.PdfObjectStream
+}
+
+// resampled returns the image in `stream` resampled to `width` x `height` and encoded like the
+// original where possible.
+func (d *Downsampler) resampled(stream *core.PdfObjectStream, width, height int,
+	filter Filter) (*core.PdfObjectStream, error) {
+	ximg, err := model.NewXObjectImageFromStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	img, err := ximg.ToImage()
+	if err != nil {
+		return nil, err
+	}
+	if img.Width <= 0 || img.Height <= 0 || img.ColorComponents <= 0 {
+		return nil, fmt.Errorf("invalid image")
+	}
+
+	bpc := int(img.BitsPerComponent)
+	maxVal := float64(uint32(1)<<uint(bpc) - 1)
+	samples := img.GetSamples()
+	if len(samples) < int(img.Width*img.Height)*img.ColorComponents {
+		return nil, fmt.Errorf("image data too short")
+	}
+	values := make([]float64, len(samples))
+	for i, s := range samples {
+		values[i] = float64(s)
+	}
+	values = resample(values, int(img.Width), int(img.Height), img.ColorComponents, width, height, filter)
+	for i, v := range values {
+		samples[i] = uint32(math.Round(math.Max(0, math.Min(maxVal, v))))
+	}
+	samples = samples[:len(values)]
+
+	resized := &model.Image{
+		Width:            int64(width),
+		Height:           int64(height),
+		BitsPerComponent: img.BitsPerComponent,
+		ColorComponents:  img.ColorComponents,
+	}
+	resized.SetSamples(samples)
+
+	cs := ximg.ColorSpace
+	if cs == nil {
+		// Stencil masks and soft masks.
+		cs = model.NewPdfColorspaceDeviceGray()
+	}
+	newImg, err := model.NewXObjectImageFromImage(resized, cs, d.encoder(stream, resized))
+	if err != nil {
+		// Fall back to Flate, e.g. for CMYK JPEG images.
+		newImg, err = model.NewXObjectImageFromImage(resized, cs, flateEncoder(resized))
+		if err != nil {
+			return nil, err
+		}
+	}
+	encoded, ok := newImg.ToPdfObject().(*core.PdfObjectStream)
+	if !ok {
+		return nil, fmt.Errorf("unexpected image object")
+	}
+	return encoded, nil
+}
+
+// encoder returns the encoder for `img`, resampled from image `stream`: the original filter for JPEG
+// and JBIG2 images, Flate otherwise.
+func (d *Downsampler) encoder(stream *core.PdfObjectStream, img *model.Image) core.StreamEncoder {
+	switch filterName(stream) {
+	case core.StreamEncodingFilterNameDCT:
+		if img.BitsPerComponent == 8 {
+			enc := core.NewDCTEncoder()
+			enc.Width = int(img.Width)
+			enc.Height = int(img.Height)
+			enc.ColorComponents = img.ColorComponents
+			enc.BitsPerComponent = 8
+			enc.Quality = d.opts.Quality
+			return enc
+		}
+	case core.StreamEncodingFilterNameJBIG2:
+		if img.BitsPerComponent == 1 && img.ColorComponents == 1 {
+			return core.NewJBIG2Encoder()
+		}
+	}
+	return flateEncoder(img)
+}
+
+// flateEncoder returns a Flate encoder for `img`.
+func flateEncoder(img *model.Image) core.StreamEncoder {
+	enc := core.NewFlateEncoder()
+	if img.ColorComponents == 1 && img.BitsPerComponent == 8 {
+		enc.SetPredictor(int(img.Width))
+	}
+	return enc
+}
+
+// update replaces the data and encoding of image `stream` with those of `encoded`. All other entries,
+// e.g. color space, decode array, masks and metadata, are kept.
+func update(stream, encoded *core.PdfObjectStream) {
+	for _, key := range []core.PdfObjectName{"Width", "Height", "BitsPerComponent", "Filter", "DecodeParms", "Length"} {
+		if val := encoded.Get(key); val != nil {
+			stream.Set(key, val)
+		} else {
+			stream.Remove(key)
+		}
+	}
+	stream.Stream = encoded.Stream
+}
+
+// scaled returns `n` pixels scaled by `scale`, at least 1.
+func scaled(n int, scale float64) int {
+	s := int(math.Round(float64(n) * scale))
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+// resample resamples `src`, `w` x `h` pixels with `comps` components each, to `nw` x `nh` pixels
+// with `filter`. The horizontal and vertical passes are applied separately.
+func resample(src []float64, w, h, comps, nw, nh int, filter Filter) []float64 {
+	tmp := make([]float64, nw*h*comps)
+	weightsX := weights(w, nw, filter)
+	for y := 0; y < h; y++ {
+		for x, ws := range weightsX {
+			for c := 0; c < comps; c++ {
+				var sum float64
+				for _, wt := range ws {
+					sum += wt.w * src[(y*w+wt.i)*comps+c]
+				}
+				tmp[(y*nw+x)*comps+c] = sum
+			}
+		}
+	}
+
+	dst := make([]float64, nw*nh*comps)
+	weightsY := weights(h, nh, filter)
+	for y, ws := range weightsY {
+		for x := 0; x < nw; x++ {
+			for c := 0; c < comps; c++ {
+				var sum float64
+				for _, wt := range ws {
+					sum += wt.w * tmp[(wt.i*nw+x)*comps+c]
+				}
+				dst[(y*nw+x)*comps+c] = sum
+			}
+		}
+	}
+	return dst
+}
+
+// weight is the contribution of source pixel `i` to a destination pixel.
+type weight struct {
+	i int
+	w float64
+}
+
+// weights returns the contributions of the `n` source pixels to each of the `nn` destination
+// pixels along one axis.
+func weights(n, nn int, filter Filter) [][]weight {
+	kernel, support := kernelOf(filter)
+	scale := float64(n) / float64(nn)
+	// When downsampling the kernel is stretched to cover all source pixels.
+	stretch := math.Max(scale, 1)
+	radius := support * stretch
+
+	all := make([][]weight, nn)
+	for j := range all {
+		center := (float64(j)+0.5)*scale - 0.5
+		if filter == FilterNearest {
+			i := int(math.Min(float64(n-1), math.Max(0, math.Round(center))))
+			all[j] = []weight{{i, 1}}
+			continue
+		}
+		lo := int(math.Ceil(center - radius))
+		hi := int(math.Floor(center + radius))
+		var ws []weight
+		var total float64
+		for i := lo; i <= hi; i++ {
+			w := kernel((float64(i) - center) / stretch)
+			if w == 0 {
+				continue
+			}
+			// Clamp at the edges.
+			k := i
+			if k < 0 {
+				k = 0
+			} else if k >= n {
+				k = n - 1
+			}
+			ws = append(ws, weight{k, w})
+			total += w
+		}
+		if total != 0 {
+			for k := range ws {
+				ws[k].w /= total
+			}
+		}
+		all[j] = ws
+	}
+	return all
+}
+
+// kernelOf returns the kernel function of `filter` and its support.
+func kernelOf(filter Filter) (func(float64) float64, float64) {
+	switch filter {
+	case FilterBicubic:
+		return catmullRom, 2
+	case FilterNearest:
+		return nil, 0.5
+	}
+	return lanczos3, 3
+}
+
+// catmullRom is the bicubic kernel with a = -0.5.
+func catmullRom(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return 1.5*x*x*x - 2.5*x*x + 1
+	case x < 2:
+		return -0.5*x*x*x + 2.5*x*x - 4*x + 2
+	}
+	return 0
+}
+
+// lanczos3 is the Lanczos kernel with a = 3.
+func lanczos3(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x == 0:
+		return 1
+	case x < 3:
+		px := math.Pi * x
+		return 3 * math.Sin(px) * math.Sin(px/3) / (px * px)
+	}
+	return 0
+}
+
+// ParseFilter returns the filter named `s`.
+func ParseFilter(s string) (Filter, error) {
+	switch f := Filter(strings.ToLower(s)); f {
+	case FilterBicubic, FilterLanczos:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown filter %q: expected %s or %s", s, FilterBicubic, FilterLanczos)
+}
+
+// formMatrix returns the /Matrix of `form`.
+func formMatrix(form *model.XObjectForm) glyphs.Matrix {
+	if arr, ok := core.GetArray(form.Matrix); ok {
+		if vals, err := arr.ToFloat64Array(); err == nil && len(vals) == 6 {
+			return glyphs.Matrix{vals[0], vals[1], vals[2], vals[3], vals[4], vals[5]}
+		}
+	}
+	return glyphs.IdentityMatrix()
+}
+
+// isIndexed returns true if image `stream` has an Indexed color space.
+func isIndexed(stream *core.PdfObjectStream) bool {
+	cs := core.ResolveReference(stream.Get("ColorSpace"))
+	if arr, ok := core.GetArray(cs); ok && arr.Len() > 0 {
+		name, ok := core.GetName(arr.Get(0))
+		return ok && (*name == "Indexed" || *name == "I")
+	}
+	return false
+}
+
+// isColorKeyMasked returns true if image `stream` has a color key mask.
+func isColorKeyMasked(stream *core.PdfObjectStream) bool {
+	_, ok := core.GetArray(stream.Get("Mask"))
+	return ok
+}
+
+// filterName returns the name of the (last) filter of image `stream`.
+func filterName(stream *core.PdfObjectStream) string {
+	switch f := core.ResolveReference(stream.Get("Filter")).(type) {
+	case *core.PdfObjectName:
+		return string(*f)
+	case *core.PdfObjectArray:
+		if f.Len() > 0 {
+			if name, ok := core.GetName(f.Get(f.Len() - 1)); ok {
+				return string(*name)
+			}
+		}
+	}
+	return "Raw"
+}
@@ -1,17 +1,35 @@
 /*
  * PDF optimization (compression) example.
  *
- * Run as: go run pdf_optimize.go <input.pdf> <output.pdf>
+ * The optimization options are taken from a named profile (screen, ebook, print, archive or a custom
+ * profile from a YAML/JSON file loaded with -profiles), and each option can be overridden with a
+ * flag. Without -profile, the options used are those of earlier versions of this example
+ * (ImageQuality 80, ImageUpperPPI 100). The profiles are implemented in the reusable profiles
+ * package (profiles/lib_profiles.go).
+ *
+ * With -breakdown, the bytes saved per category (duplicates, stream compression, images, fonts,
+ * object streams) are reported. This writes the document once per category.
+ *
+ * Run as: go run pdf_optimize.go [options] <input.pdf> <output.pdf>
+ * Examples:
+ *   go run pdf_optimize.go -profile ebook input.pdf output.pdf
+ *   go run pdf_optimize.go -profiles profiles.yaml -profile scans -image-quality 60 -breakdown input.pdf output.pdf
+ *   go run pdf_optimize.go -list-profiles
  */
 
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/unidoc/unidoc-examples/compress/profiles"
 	"github.com/unidoc/unipdf/v3/common/license"
 	"github.com/unidoc/unipdf/v3/model"
 	"github.com/unidoc/unipdf/v3/model/optimize"
@@ -26,14 +44,78 @@ func init() {
 	}
 }
 
+// defaultSettings are the options used without -profile.
+var defaultSettings = profiles.Settings{
+	CombineDuplicateDirectObjects:   boolPtr(true),
+	CombineIdenticalIndirectObjects: boolPtr(true),
+	CombineDuplicateStreams:         boolPtr(true),
+	CompressStreams:                 boolPtr(true),
+	UseObjectStreams:                boolPtr(true),
+	ImageQuality:                    intPtr(80),
+	ImageUpperPPI:                   floatPtr(100),
+}
+
 func main() {
-	args := os.Args
-	if len(args) < 3 {
-		fmt.Printf("Usage: %s INPUT_PDF_PATH OUTPUT_PDF_PATH\n", os.Args[0])
+	var (
+		profileName  string
+		profilesPath string
+		listProfiles bool
+		breakdown    bool
+		reportPath   string
+		overrides    profiles.Settings
+	)
+	flag.StringVar(&profileName, "profile", "", "Optimization profile: screen, ebook, print, archive or a custom profile")
+	flag.StringVar(&profilesPath, "profiles", "", "YAML or JSON file with custom profiles")
+	flag.BoolVar(&listProfiles, "list-profiles", false, "List the available profiles and exit")
+	flag.BoolVar(&breakdown, "breakdown", false, "Report the bytes saved per optimization category")
+	flag.StringVar(&reportPath, "report", "", "Write the breakdown as JSON to this file (implies -breakdown)")
+
+	// Each option can override the profile. Options not given on the command line keep the profile value.
+	flag.Var(boolFlag{&overrides.CombineDuplicateStreams}, "combine-duplicate-streams", "Combine duplicate streams")
+	flag.Var(boolFlag{&overrides.CombineDuplicateDirectObjects}, "combine-duplicate-direct-objects", "Combine duplicate direct objects")
+	flag.Var(boolFlag{&overrides.CombineIdenticalIndirectObjects}, "combine-identical-indirect-objects", "Combine identical indirect objects")
+	flag.Var(boolFlag{&overrides.CompressStreams}, "compress-streams", "Compress uncompressed streams")
+	flag.Var(boolFlag{&overrides.CleanContentstream}, "clean-contentstream", "Remove redundant operations from content streams")
+	flag.Var(boolFlag{&overrides.UseObjectStreams}, "use-object-streams", "Store objects in object streams")
+	flag.Var(boolFlag{&overrides.CleanFonts}, "clean-fonts", "Remove unused glyphs from fonts")
+	flag.Var(boolFlag{&overrides.SubsetFonts}, "subset-fonts", "Subset fonts to the glyphs used")
+	flag.Var(intFlag{&overrides.ImageQuality}, "image-quality", "JPEG quality of recompressed images (1-100, 0 to keep images)")
+	flag.Var(floatFlag{&overrides.ImageUpperPPI}, "image-upper-ppi", "Downsample images above this resolution (0 to keep)")
+	flag.Parse()
+	args := flag.Args()
+
+	available := profiles.Builtin()
+	if profilesPath != "" {
+		var err error
+		available, err = profiles.Load(profilesPath)
+		if err != nil {
+			log.Fatalf("Fail: %v\n", err)
+		}
+	}
+	if listProfiles {
+		for _, name := range available.Names() {
+			fmt.Printf("%-10s %s\n", name, available[name].Description)
+		}
 		return
 	}
-	inputPath := args[1]
-	outputPath := args[2]
+
+	if len(args) < 2 {
+		fmt.Printf("Usage: %s [options] INPUT_PDF_PATH OUTPUT_PDF_PATH\n", os.Args[0])
+		flag.PrintDefaults()
+		return
+	}
+	inputPath := args[0]
+	outputPath := args[1]
+
+	settings := defaultSettings
+	if profileName != "" {
+		var err error
+		settings, err = available.Settings(profileName)
+		if err != nil {
+			log.Fatalf("Fail: %v\n", err)
+		}
+	}
+	opts := settings.Override(overrides).Options()
 
 	// Initialize starting time.
 	start := time.Now()
@@ -63,15 +145,7 @@ func main() {
 	}
 
 	// Set optimizer.
-	pdfWriter.SetOptimizer(optimize.New(optimize.Options{
-		CombineDuplicateDirectObjects:   true,
-		CombineIdenticalIndirectObjects: true,
-		CombineDuplicateStreams:         true,
-		CompressStreams:                 true,
-		UseObjectStreams:                true,
-		ImageQuality:                    80,
-		ImageUpperPPI:                   100,
-	}))
+	pdfWriter.SetOptimizer(optimize.New(opts))
 
 	// Create output file.
 	err = pdfWriter.WriteToFile(outputPath)
@@ -97,4 +171,114 @@ func main() {
 	fmt.Printf("Optimized size: %d bytes\n", outputSize)
 	fmt.Printf("Compression ratio: %.2f%%\n", ratio)
 	fmt.Printf("Processing time: %.2f ms\n", duration)
+
+	if breakdown || reportPath != "" {
+		savings, err := profiles.Breakdown(inputPath, opts)
+		if err != nil {
+			log.Fatalf("Fail: %v\n", err)
+		}
+		printSavings(savings, inputSize)
+
+		if reportPath != "" {
+			data, err := json.MarshalIndent(savings, "", "    ")
+			if err != nil {
+				log.Fatalf("Fail: %v\n", err)
+			}
+			if err := ioutil.WriteFile(reportPath, data, 0644); err != nil {
+				log.Fatalf("Fail: %v\n", err)
+			}
+		}
+	}
+}
+
+// printSavings prints the bytes saved per category as a table.
+func printSavings(savings []profiles.Saving, inputSize int64) {
+	fmt.Printf("\nSavings by category:\n")
+	fmt.Printf("%-30s %12s %8s %12s  %s\n", "Category", "Saved", "%", "Size", "Options")
+	for _, s := range savings {
+		percent := 0.0
+		if inputSize > 0 {
+			percent = float64(s.Saved) / float64(inputSize) * 100
+		}
+		fmt.Printf("%-30s %12d %7.2f%% %12d  %s\n", s.Category, s.Saved, percent, s.Size, s.Options)
+	}
+}
+
+// boolFlag is a boolean flag that only sets the option if given on the command line.
+type boolFlag struct {
+	p **bool
+}
+
+func (f boolFlag) String() string {
+	if f.p == nil || *f.p == nil {
+		return ""
+	}
+	return strconv.FormatBool(**f.p)
+}
+
+func (f boolFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*f.p = &v
+	return nil
+}
+
+func (f boolFlag) IsBoolFlag() bool {
+	return true
+}
+
+// intFlag is an integer flag that only sets the option if given on the command line.
+type intFlag struct {
+	p **int
+}
+
+func (f intFlag) String() string {
+	if f.p == nil || *f.p == nil {
+		return ""
+	}
+	return strconv.Itoa(**f.p)
+}
+
+func (f intFlag) Set(s string) error {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*f.p = &v
+	return nil
+}
+
+// floatFlag is a float flag that only sets the option if given on the command line.
+type floatFlag struct {
+	p **float64
+}
+
+func (f floatFlag) String() string {
+	if f.p == nil || *f.p == nil {
+		return ""
+	}
+	return strconv.FormatFloat(**f.p, 'g', -1, 64)
+}
+
+func (f floatFlag) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*f.p = &v
+	return nil
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
 }
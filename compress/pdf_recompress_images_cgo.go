@@ -0,0 +1,106 @@
+/*
+ * Recompress the images of a PDF file with JPEG 2000 (JPX) for photos and grayscale images.
+ *
+ * Each image is classified (bilevel, grayscale, line art, photo) and re-encoded according to a
+ * policy by the recompress package (recompress/lib_recompress.go). This example uses the ImageMagick
+ * based JPEG 2000 encoder in render/jpeg2k, which is also registered as the JPX decoder so that
+ * images already stored as JPX can be analyzed. Bilevel images are stored as JBIG2 and line art
+ * with Flate. Requires cgo and the ImageMagick development libraries.
+ *
+ * pdftool recompress offers the same without JPX support and without cgo.
+ *
+ * Run as: go run pdf_recompress_images_cgo.go input.pdf output.pdf [quality]
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/unidoc/unidoc-examples/compress/recompress"
+	"github.com/unidoc/unidoc-examples/render/jpeg2k"
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Printf("Usage: go run pdf_recompress_images_cgo.go input.pdf output.pdf [quality]\n")
+		os.Exit(1)
+	}
+	inputPath := os.Args[1]
+	outputPath := os.Args[2]
+	quality := 60
+	if len(os.Args) > 3 {
+		q, err := strconv.Atoi(os.Args[3])
+		if err != nil {
+			log.Fatalf("Invalid quality: %v\n", err)
+		}
+		quality = q
+	}
+
+	// Decode JPX images with the custom decoder.
+	core.RegisterCustomStreamEncoder(core.StreamEncodingFilterNameJPX, jpeg2k.NewCustomJPXEncoder())
+
+	policy := recompress.DefaultPolicy()
+	policy[recompress.ClassPhoto] = recompress.FormatJPX
+	policy[recompress.ClassGrayscale] = recompress.FormatJPX
+
+	results, err := recompressImages(inputPath, outputPath, recompress.Options{
+		Policy:  policy,
+		Quality: quality,
+		JPX:     jpeg2k.EncodeImage,
+	})
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	for _, res := range results {
+		fmt.Printf("%s (pages %v): %s, %s %d bytes -> %s %d bytes",
+			res.Name, res.Pages, res.Class, res.FilterBefore, res.Before, res.FilterAfter, res.After)
+		if res.Note != "" {
+			fmt.Printf(" (%s)", res.Note)
+		}
+		fmt.Println()
+	}
+	before, after := recompress.Totals(results)
+	fmt.Printf("Image data: %d -> %d bytes\n", before, after)
+	fmt.Printf("Complete, see output file: %s\n", outputPath)
+}
+
+// recompressImages recompresses the images of `inputPath` with `opts` and writes the result to
+// `outputPath`.
+func recompressImages(inputPath, outputPath string, opts recompress.Options) ([]*recompress.Result, error) {
+	pdfReader, f, err := model.NewPdfReaderFromFile(inputPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	recompressor := recompress.New(opts)
+	pdfWriter, err := pdfReader.ToWriter(&model.ReaderToWriterOpts{
+		PageProcessCallback: func(pageNum int, page *model.PdfPage) error {
+			return recompressor.ProcessPage(page, pageNum)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := pdfWriter.WriteToFile(outputPath); err != nil {
+		return nil, err
+	}
+	return recompressor.Results(), nil
+}
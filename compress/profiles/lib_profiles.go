@@ -0,0 +1,341 @@
+/*
+ * Package profiles provides named sets of optimization options (profiles) for the UniPDF optimizer,
+ * custom profiles loaded from YAML or JSON files and a breakdown of the bytes saved per
+ * optimization category.
+ *
+ * Built-in profiles:
+ *  - screen:  Smallest files for on-screen viewing. Images downsampled to 72 PPI at JPEG quality 50.
+ *  - ebook:   Medium quality. Images downsampled to 150 PPI at JPEG quality 70.
+ *  - print:   High quality for printing. Images downsampled to 300 PPI at JPEG quality 90.
+ *  - archive: Lossless. Images are left alone, only the file structure is optimized.
+ *
+ * A profile file maps profile names to settings. A profile can be based on another profile and only
+ * override some of its settings, e.g.
+ *
+ *   scans:
+ *     base: ebook
+ *     image_upper_ppi: 200
+ *     subset_fonts: false
+ *
+ * Used by compress/pdf_optimize.go.
+ */
+
+package profiles
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/unidoc/unipdf/v3/model"
+	"github.com/unidoc/unipdf/v3/model/optimize"
+)
+
+// Settings are the optimization options of a profile. Unset (nil) options are taken from the Base
+// profile, or disabled if there is no base.
+type Settings struct {
+	Base        string `json:"base,omitempty" yaml:"base,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	CombineDuplicateStreams         *bool    `json:"combine_duplicate_streams,omitempty" yaml:"combine_duplicate_streams,omitempty"`
+	CombineDuplicateDirectObjects   *bool    `json:"combine_duplicate_direct_objects,omitempty" yaml:"combine_duplicate_direct_objects,omitempty"`
+	CombineIdenticalIndirectObjects *bool    `json:"combine_identical_indirect_objects,omitempty" yaml:"combine_identical_indirect_objects,omitempty"`
+	CompressStreams                 *bool    `json:"compress_streams,omitempty" yaml:"compress_streams,omitempty"`
+	CleanContentstream              *bool    `json:"clean_contentstream,omitempty" yaml:"clean_contentstream,omitempty"`
+	UseObjectStreams                *bool    `json:"use_object_streams,omitempty" yaml:"use_object_streams,omitempty"`
+	ImageQuality                    *int     `json:"image_quality,omitempty" yaml:"image_quality,omitempty"`
+	ImageUpperPPI                   *float64 `json:"image_upper_ppi,omitempty" yaml:"image_upper_ppi,omitempty"`
+	CleanFonts                      *bool    `json:"clean_fonts,omitempty" yaml:"clean_fonts,omitempty"`
+	SubsetFonts                     *bool    `json:"subset_fonts,omitempty" yaml:"subset_fonts,omitempty"`
+}
+
+// Profiles maps profile names to their settings.
+type Profiles map[string]Settings
+
+// Builtin returns the built-in profiles.
+func Builtin() Profiles {
+	structure := Settings{
+		CombineDuplicateStreams:         boolPtr(true),
+		CombineDuplicateDirectObjects:   boolPtr(true),
+		CombineIdenticalIndirectObjects: boolPtr(true),
+		CompressStreams:                 boolPtr(true),
+		UseObjectStreams:                boolPtr(true),
+	}
+	withImages := func(description string, quality int, ppi float64) Settings {
+		s := structure
+		s.Description = description
+		s.CleanContentstream = boolPtr(true)
+		s.CleanFonts = boolPtr(true)
+		s.SubsetFonts = boolPtr(true)
+		s.ImageQuality = &quality
+		s.ImageUpperPPI = &ppi
+		return s
+	}
+
+	archive := structure
+	archive.Description = "Lossless, only the file structure is optimized"
+	return Profiles{
+		"screen":  withImages("Smallest files for on-screen viewing (72 PPI, JPEG quality 50)", 50, 72),
+		"ebook":   withImages("Medium quality (150 PPI, JPEG quality 70)", 70, 150),
+		"print":   withImages("High quality for printing (300 PPI, JPEG quality 90)", 90, 300),
+		"archive": archive,
+	}
+}
+
+// Load returns the built-in profiles together with the profiles defined in the YAML or JSON file
+// at `path`. Profiles in the file replace built-in profiles of the same name.
+func Load(path string) (Profiles, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is a subset of YAML, so both are read by the YAML decoder.
+	var custom Profiles
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&custom); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	profiles := Builtin()
+	for name, s := range custom {
+		profiles[name] = s
+	}
+	return profiles, nil
+}
+
+// Names returns the sorted profile names.
+func (p Profiles) Names() []string {
+	var names []string
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Settings returns the settings of profile `name` with its base profiles resolved.
+func (p Profiles) Settings(name string) (Settings, error) {
+	return p.resolve(name, map[string]bool{})
+}
+
+// Options returns the optimization options of profile `name`, resolving its base profiles.
+func (p Profiles) Options(name string) (optimize.Options, error) {
+	s, err := p.Settings(name)
+	if err != nil {
+		return optimize.Options{}, err
+	}
+	return s.Options(), nil
+}
+
+// resolve returns the settings of profile `name` merged with those of its base profiles.
+func (p Profiles) resolve(name string, visiting map[string]bool) (Settings, error) {
+	s, ok := p[name]
+	if !ok {
+		return Settings{}, fmt.Errorf("unknown profile %q", name)
+	}
+	if s.Base == "" {
+		return s, nil
+	}
+	if visiting[name] {
+		return Settings{}, fmt.Errorf("profile %q: circular base", name)
+	}
+	visiting[name] = true
+
+	base, err := p.resolve(s.Base, visiting)
+	if err != nil {
+		return Settings{}, fmt.Errorf("profile %q: %w", name, err)
+	}
+	return base.Override(s), nil
+}
+
+// Override returns `s` with the options set in `o` replacing those of `s`.
+func (s Settings) Override(o Settings) Settings {
+	if o.Description != "" {
+		s.Description = o.Description
+	}
+	s.Base = ""
+	overrideBool(&s.CombineDuplicateStreams, o.CombineDuplicateStreams)
+	overrideBool(&s.CombineDuplicateDirectObjects, o.CombineDuplicateDirectObjects)
+	overrideBool(&s.CombineIdenticalIndirectObjects, o.CombineIdenticalIndirectObjects)
+	overrideBool(&s.CompressStreams, o.CompressStreams)
+	overrideBool(&s.CleanContentstream, o.CleanContentstream)
+	overrideBool(&s.UseObjectStreams, o.UseObjectStreams)
+	overrideBool(&s.CleanFonts, o.CleanFonts)
+	overrideBool(&s.SubsetFonts, o.SubsetFonts)
+	if o.ImageQuality != nil {
+		s.ImageQuality = o.ImageQuality
+	}
+	if o.ImageUpperPPI != nil {
+		s.ImageUpperPPI = o.ImageUpperPPI
+	}
+	return s
+}
+
+// Options returns the optimization options of `s`. Unset options are disabled.
+func (s Settings) Options() optimize.Options {
+	opts := optimize.Options{
+		CombineDuplicateStreams:         isSet(s.CombineDuplicateStreams),
+		CombineDuplicateDirectObjects:   isSet(s.CombineDuplicateDirectObjects),
+		CombineIdenticalIndirectObjects: isSet(s.CombineIdenticalIndirectObjects),
+		CompressStreams:                 isSet(s.CompressStreams),
+		CleanContentstream:              isSet(s.CleanContentstream),
+		UseObjectStreams:                isSet(s.UseObjectStreams),
+		CleanFonts:                      isSet(s.CleanFonts),
+		SubsetFonts:                     isSet(s.SubsetFonts),
+	}
+	if s.ImageQuality != nil {
+		opts.ImageQuality = *s.ImageQuality
+	}
+	if s.ImageUpperPPI != nil {
+		opts.ImageUpperPPI = *s.ImageUpperPPI
+	}
+	return opts
+}
+
+// Saving is the number of bytes saved by a category of optimizations.
+type Saving struct {
+	Category string `json:"category"`
+	Options  string `json:"options"` // Options enabled in this step.
+	Size     int64  `json:"size"`    // File size after this step.
+	Saved    int64  `json:"saved"`   // Bytes saved compared to the previous step.
+}
+
+// step is a category of optimization options applied by Breakdown.
+type step struct {
+	category string
+	enable   func(from, to *optimize.Options) string
+}
+
+// steps are applied cumulatively in this order.
+var steps = []step{
+	{"duplicate objects and streams", func(from, to *optimize.Options) string {
+		to.CombineDuplicateStreams = from.CombineDuplicateStreams
+		to.CombineDuplicateDirectObjects = from.CombineDuplicateDirectObjects
+		to.CombineIdenticalIndirectObjects = from.CombineIdenticalIndirectObjects
+		return enabled(map[string]bool{
+			"CombineDuplicateStreams":         from.CombineDuplicateStreams,
+			"CombineDuplicateDirectObjects":   from.CombineDuplicateDirectObjects,
+			"CombineIdenticalIndirectObjects": from.CombineIdenticalIndirectObjects,
+		})
+	}},
+	{"stream compression", func(from, to *optimize.Options) string {
+		to.CompressStreams = from.CompressStreams
+		to.CleanContentstream = from.CleanContentstream
+		return enabled(map[string]bool{
+			"CompressStreams":    from.CompressStreams,
+			"CleanContentstream": from.CleanContentstream,
+		})
+	}},
+	{"images", func(from, to *optimize.Options) string {
+		to.ImageQuality = from.ImageQuality
+		to.ImageUpperPPI = from.ImageUpperPPI
+		return enabled(map[string]bool{
+			fmt.Sprintf("ImageQuality=%d", from.ImageQuality):   from.ImageQuality > 0,
+			fmt.Sprintf("ImageUpperPPI=%g", from.ImageUpperPPI): from.ImageUpperPPI > 0,
+		})
+	}},
+	{"fonts", func(from, to *optimize.Options) string {
+		to.CleanFonts = from.CleanFonts
+		to.SubsetFonts = from.SubsetFonts
+		return enabled(map[string]bool{
+			"CleanFonts":  from.CleanFonts,
+			"SubsetFonts": from.SubsetFonts,
+		})
+	}},
+	{"object streams", func(from, to *optimize.Options) string {
+		to.UseObjectStreams = from.UseObjectStreams
+		return enabled(map[string]bool{"UseObjectStreams": from.UseObjectStreams})
+	}},
+}
+
+// Breakdown optimizes the PDF at `inputPath` with the options of `opts` enabled step by step (one
+// step per category) and returns the bytes saved by each step. The first entry is the rewrite of
+// the file without optimization, compared to the original file size. As the document is written
+// once per step, this is considerably slower than optimizing it once. Savings depend on the order
+// of the steps, e.g. duplicate images that are combined are only recompressed once.
+func Breakdown(inputPath string, opts optimize.Options) ([]Saving, error) {
+	fi, err := os.Stat(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var current optimize.Options
+	size, err := optimizedSize(inputPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	savings := []Saving{{Category: "rewrite", Size: size, Saved: fi.Size() - size}}
+
+	for _, st := range steps {
+		names := st.enable(&opts, &current)
+		if names == "" {
+			continue
+		}
+		stepOpts := current
+		newSize, err := optimizedSize(inputPath, &stepOpts)
+		if err != nil {
+			return nil, err
+		}
+		savings = append(savings, Saving{Category: st.category, Options: names, Size: newSize, Saved: size - newSize})
+		size = newSize
+	}
+	return savings, nil
+}
+
+// optimizedSize returns the size of the PDF at `inputPath` written with optimization options `opts`.
+// `opts` nil means no optimizer.
+func optimizedSize(inputPath string, opts *optimize.Options) (int64, error) {
+	// The optimizer changes objects shared with the reader, so each run uses a fresh reader.
+	pdfReader, f, err := model.NewPdfReaderFromFile(inputPath, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	pdfWriter, err := pdfReader.ToWriter(nil)
+	if err != nil {
+		return 0, err
+	}
+	if opts != nil {
+		pdfWriter.SetOptimizer(optimize.New(*opts))
+	}
+
+	var buf bytes.Buffer
+	if err := pdfWriter.Write(&buf); err != nil {
+		return 0, err
+	}
+	return int64(buf.Len()), nil
+}
+
+// enabled returns the sorted names of the enabled options in `options`, separated by commas.
+func enabled(options map[string]bool) string {
+	var names []string
+	for name, on := range options {
+		if on {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func isSet(b *bool) bool {
+	return b != nil && *b
+}
+
+func overrideBool(dst **bool, src *bool) {
+	if src != nil {
+		*dst = src
+	}
+}
@@ -0,0 +1,717 @@
+/*
+ * Package recompress re-encodes the image XObjects of PDF pages with the filter best suited to their
+ * content. Each image is classified from its properties (the same as reported by
+ * analysis/pdf_summarize_images.go: size, color components, bits per component, color space and
+ * filter) and statistics of its pixels as
+ *  - bilevel:   black and white only, e.g. scanned text. Best stored as JBIG2.
+ *  - grayscale: continuous tone gray. Best stored as gray JPEG or JPX.
+ *  - lineart:   few distinct colors or large flat areas, e.g. charts and diagrams. Best stored
+ *               lossless with Flate, using an indexed color space where possible.
+ *  - photo:     continuous tone color. Best stored as JPEG or JPX.
+ * A Policy maps each class to the format used.
+ *
+ * Soft masks (SMask), explicit masks and the other image attributes are kept. Images with color key
+ * masks are only re-encoded losslessly in their original color space. An image is only replaced if
+ * the new encoding is smaller than the original one.
+ *
+ * JPX (JPEG 2000) encoding requires an external encoder, see Options.JPX and
+ * render/jpeg2k/lib_jpeg2k_encoder.go. Without it, JPX falls back to JPEG.
+ *
+ * Used by pdftool recompress and compress/pdf_recompress_images_cgo.go.
+ */
+
+package recompress
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Class is the kind of content of an image.
+type Class string
+
+// Image classes.
+const (
+	ClassBilevel   Class = "bilevel"
+	ClassGrayscale Class = "grayscale"
+	ClassLineArt   Class = "lineart"
+	ClassPhoto     Class = "photo"
+)
+
+// Classes are all image classes.
+var Classes = []Class{ClassBilevel, ClassGrayscale, ClassLineArt, ClassPhoto}
+
+// Format is the encoding an image is recompressed with.
+type Format string
+
+// Image formats.
+const (
+	FormatKeep  Format = "keep" // Leave the image unchanged.
+	FormatJPEG  Format = "jpeg"
+	FormatJBIG2 Format = "jbig2" // Only for bilevel images.
+	FormatFlate Format = "flate"
+	FormatJPX   Format = "jpx"
+)
+
+// Policy maps image classes to the format images of that class are recompressed with. Classes not in
+// the policy are kept.
+type Policy map[Class]Format
+
+// DefaultPolicy returns the default policy: JBIG2 for bilevel images, JPEG for grayscale images and
+// photos, and Flate for line art.
+func DefaultPolicy() Policy {
+	return Policy{
+		ClassBilevel:   FormatJBIG2,
+		ClassGrayscale: FormatJPEG,
+		ClassLineArt:   FormatFlate,
+		ClassPhoto:     FormatJPEG,
+	}
+}
+
+// ParsePolicy returns the default policy with the overrides in `s`, a comma separated list of
+// class=format pairs, e.g. "photo=jpx,lineart=keep".
+func ParsePolicy(s string) (Policy, error) {
+	policy := DefaultPolicy()
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid policy entry %q: expected class=format", pair)
+		}
+		class := Class(strings.TrimSpace(parts[0]))
+		format := Format(strings.TrimSpace(parts[1]))
+		if !validClass(class) {
+			return nil, fmt.Errorf("unknown image class %q", class)
+		}
+		switch format {
+		case FormatKeep, FormatJPEG, FormatFlate, FormatJPX:
+		case FormatJBIG2:
+			if class != ClassBilevel {
+				return nil, fmt.Errorf("%s is only supported for %s images", format, ClassBilevel)
+			}
+		default:
+			return nil, fmt.Errorf("unknown image format %q", format)
+		}
+		policy[class] = format
+	}
+	return policy, nil
+}
+
+func validClass(class Class) bool {
+	for _, c := range Classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// JPXFunc encodes `img` as JPEG 2000 with `quality` (1-100) and returns the encoded data. The color
+// components of `img` match its color space (DeviceGray, DeviceRGB or DeviceCMYK and ICC based
+// equivalents).
+type JPXFunc func(img *model.Image, quality int) ([]byte, error)
+
+// Options controls the recompression.
+type Options struct {
+	// Policy maps image classes to formats. Defaults to DefaultPolicy().
+	Policy Policy
+	// Quality is the quality (1-100) of lossy JPEG and JPX encoding. Defaults to 75.
+	Quality int
+	// JPX encodes images as JPEG 2000. If nil, JPEG is used instead.
+	JPX JPXFunc
+	// MinPixels is the size in pixels below which images are kept. Defaults to 1024.
+	MinPixels int
+}
+
+// Stats are the properties and pixel statistics of an image.
+type Stats struct {
+	Width            int    `json:"width"`
+	Height           int    `json:"height"`
+	Components       int    `json:"components"`
+	BitsPerComponent int    `json:"bpc"`
+	ColorSpace       string `json:"colorspace"`
+	Filter           string `json:"filter"`
+	ImageMask        bool   `json:"image_mask,omitempty"`
+	// Colors is the number of distinct colors of the sampled pixels, up to maxColors+1.
+	Colors int `json:"colors"`
+	// Gray is true if the pixels are neutral gray.
+	Gray bool `json:"gray"`
+	// BlackWhite is the fraction of pixels that are close to black or white.
+	BlackWhite float64 `json:"black_white"`
+	// Flat is the fraction of pixels with the same color as their right neighbour.
+	Flat float64 `json:"flat"`
+}
+
+// Result describes the recompression of an image XObject.
+type Result struct {
+	Name         string `json:"name"`  // Resource name of the image where it was first found.
+	Pages        []int  `json:"pages"` // Pages using the image.
+	Stats        Stats  `json:"stats"`
+	Class        Class  `json:"class,omitempty"`
+	Format       Format `json:"format"` // Format applied. FormatKeep if the image is unchanged.
+	FilterBefore string `json:"filter_before"`
+	FilterAfter  string `json:"filter_after"`
+	Before       int    `json:"before"` // Size of the encoded image data in bytes before.
+	After        int    `json:"after"`  // Size of the encoded image data in bytes after.
+	Note         string `json:"note,omitempty"`
+}
+
+const (
+	// maxColors is the number of distinct colors counted before stopping.
+	maxColors = 4096
+	// maxSamples is the approximate number of pixels sampled for the statistics.
+	maxSamples = 250000
+	// grayTolerance is the maximum difference between the color components of a neutral gray pixel.
+	grayTolerance = 10
+)
+
+// Recompressor recompresses the images of pages. Images shared between pages are processed once.
+type Recompressor struct {
+	opts    Options
+	done    map[*core.PdfObjectStream]*entry
+	results []*Result
+}
+
+// entry is a processed image.
+type entry struct {
+	result   *Result
+	replaced *model.XObjectImage // nil if the image was kept.
+}
+
+// New returns a Recompressor with options `opts`.
+func New(opts Options) *Recompressor {
+	if opts.Policy == nil {
+		opts.Policy = DefaultPolicy()
+	}
+	if opts.Quality <= 0 || opts.Quality > 100 {
+		opts.Quality = 75
+	}
+	if opts.MinPixels <= 0 {
+		opts.MinPixels = 1024
+	}
+	return &Recompressor{opts: opts, done: map[*core.PdfObjectStream]*entry{}}
+}
+
+// Results returns the results for all images processed so far, in the order they were found.
+func (r *Recompressor) Results() []*Result {
+	return r.results
+}
+
+// Totals returns the total encoded size of the images in `results` before and after recompression.
+func Totals(results []*Result) (before, after int) {
+	for _, res := range results {
+		before += res.Before
+		after += res.After
+	}
+	return before, after
+}
+
+// ProcessPage recompresses the images in the resources of `page` and of the forms it uses.
+func (r *Recompressor) ProcessPage(page *model.PdfPage, pageNum int) error {
+	if page.Resources == nil {
+		return nil
+	}
+	return r.processResources(page.Resources, pageNum, map[*core.PdfObjectStream]bool{})
+}
+
+// processResources recompresses the image XObjects in `resources` and recurses into form XObjects.
+// `forms` holds the forms visited on this page.
+func (r *Recompressor) processResources(resources *model.PdfPageResources, pageNum int,
+	forms map[*core.PdfObjectStream]bool) error {
+	xobjects, ok := core.GetDict(resources.XObject)
+	if !ok {
+		return nil
+	}
+	for _, name := range xobjects.Keys() {
+		stream, xtype := resources.GetXObjectByName(name)
+		if stream == nil {
+			continue
+		}
+		switch xtype {
+		case model.XObjectTypeImage:
+			if e, ok := r.done[stream]; ok {
+				addPage(e.result, pageNum)
+				if e.replaced != nil {
+					if err := resources.SetXObjectImageByName(name, e.replaced); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			ximg, err := resources.GetXObjectImageByName(name)
+			if err != nil {
+				return fmt.Errorf("image %s: %w", name, err)
+			}
+			e := r.processImage(ximg)
+			e.result.Name = string(name)
+			addPage(e.result, pageNum)
+			r.done[stream] = e
+			r.results = append(r.results, e.result)
+			if e.replaced != nil {
+				if err := resources.SetXObjectImageByName(name, e.replaced); err != nil {
+					return err
+				}
+			}
+
+		case model.XObjectTypeForm:
+			if forms[stream] {
+				continue
+			}
+			forms[stream] = true
+			xform, err := resources.GetXObjectFormByName(name)
+			if err != nil {
+				return fmt.Errorf("form %s: %w", name, err)
+			}
+			if xform.Resources == nil {
+				continue
+			}
+			if err := r.processResources(xform.Resources, pageNum, forms); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addPage adds `pageNum` to the pages of `res`.
+func addPage(res *Result, pageNum int) {
+	for _, p := range res.Pages {
+		if p == pageNum {
+			return
+		}
+	}
+	res.Pages = append(res.Pages, pageNum)
+}
+
+// processImage classifies `ximg` and re-encodes it according to the policy.
+func (r *Recompressor) processImage(ximg *model.XObjectImage) *entry {
+	res := &Result{
+		Format:       FormatKeep,
+		FilterBefore: filterName(ximg),
+		Before:       len(ximg.Stream),
+	}
+	res.FilterAfter = res.FilterBefore
+	res.After = res.Before
+	e := &entry{result: res}
+	keep := func(format string, args ...interface{}) *entry {
+		res.Format = FormatKeep
+		res.Note = fmt.Sprintf(format, args...)
+		return e
+	}
+
+	stats, goImg, err := Analyze(ximg)
+	res.Stats = stats
+	if err != nil {
+		return keep("not decoded: %v", err)
+	}
+	res.Class = Classify(stats)
+	if stats.ImageMask {
+		return keep("stencil mask")
+	}
+	if stats.Width*stats.Height < r.opts.MinPixels {
+		return keep("small image")
+	}
+
+	format, ok := r.opts.Policy[res.Class]
+	if !ok || format == FormatKeep {
+		return keep("policy")
+	}
+	var notes []string
+	if format == FormatJPX && r.opts.JPX == nil {
+		format = FormatJPEG
+		notes = append(notes, "no JPX encoder, used JPEG")
+	}
+
+	src, err := r.source(ximg, goImg, stats, res.Class, format)
+	if err != nil {
+		return keep("%v", err)
+	}
+	if src == nil {
+		// Color key masks refer to the sample values in the original color space.
+		return keep("color key mask in %s", stats.ColorSpace)
+	}
+	if src.lossless && format != FormatFlate {
+		format = FormatFlate
+		notes = append(notes, "color key mask, used Flate")
+	}
+
+	replaced, err := r.encode(format, src)
+	if err != nil {
+		return keep("%s encoding failed: %v", format, err)
+	}
+	if len(replaced.Stream) >= res.Before {
+		return keep("%s not smaller (%d bytes)", format, len(replaced.Stream))
+	}
+	copyAttributes(replaced, ximg)
+
+	e.replaced = replaced
+	res.Format = format
+	res.FilterAfter = filterName(replaced)
+	res.After = len(replaced.Stream)
+	res.Note = strings.Join(notes, "; ")
+	return e
+}
+
+// source is the image data and color space an image is encoded from.
+type source struct {
+	img      *model.Image
+	cs       model.PdfColorspace
+	lossless bool // Only lossless encoding preserves the image.
+}
+
+// source returns the data to encode `ximg` of class `class` with `format` from. It returns nil if the
+// image cannot be re-encoded.
+func (r *Recompressor) source(ximg *model.XObjectImage, goImg image.Image, stats Stats,
+	class Class, format Format) (*source, error) {
+	native := isNative(ximg)
+	if isColorKeyMasked(ximg) {
+		if !native {
+			return nil, nil
+		}
+		img, err := ximg.ToImage()
+		if err != nil {
+			return nil, err
+		}
+		return &source{img: img, cs: ximg.ColorSpace, lossless: true}, nil
+	}
+
+	switch {
+	case class == ClassBilevel || stats.Gray:
+		if native && stats.Components == 1 && format != FormatJBIG2 {
+			break
+		}
+		return &source{img: grayImage(goImg), cs: model.NewPdfColorspaceDeviceGray()}, nil
+	case class == ClassLineArt && format == FormatFlate && stats.Colors <= 256:
+		img, cs, err := indexedImage(goImg)
+		if err != nil {
+			return nil, err
+		}
+		return &source{img: img, cs: cs}, nil
+	}
+
+	if native {
+		img, err := ximg.ToImage()
+		if err != nil {
+			return nil, err
+		}
+		return &source{img: img, cs: ximg.ColorSpace}, nil
+	}
+	return &source{img: rgbImage(goImg), cs: model.NewPdfColorspaceDeviceRGB()}, nil
+}
+
+// encode encodes `src` with `format`.
+func (r *Recompressor) encode(format Format, src *source) (*model.XObjectImage, error) {
+	img := src.img
+	switch format {
+	case FormatJPEG:
+		enc := core.NewDCTEncoder()
+		enc.Width = int(img.Width)
+		enc.Height = int(img.Height)
+		enc.ColorComponents = img.ColorComponents
+		enc.BitsPerComponent = int(img.BitsPerComponent)
+		enc.Quality = r.opts.Quality
+		return model.NewXObjectImageFromImage(img, src.cs, enc)
+
+	case FormatFlate:
+		enc := core.NewFlateEncoder()
+		if img.ColorComponents == 1 && img.BitsPerComponent == 8 {
+			enc.SetPredictor(int(img.Width))
+		}
+		return model.NewXObjectImageFromImage(img, src.cs, enc)
+
+	case FormatJBIG2:
+		bilevel := *img
+		bilevel.Data = append([]byte(nil), img.Data...)
+		if err := bilevel.ConvertToBinary(); err != nil {
+			return nil, err
+		}
+		return model.NewXObjectImageFromImage(&bilevel, model.NewPdfColorspaceDeviceGray(), core.NewJBIG2Encoder())
+
+	case FormatJPX:
+		data, err := r.opts.JPX(img, r.opts.Quality)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewXObjectImageFromImage(img, src.cs, &jpxData{JPXEncoder: core.NewJPXEncoder(), data: data})
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// jpxData is a StreamEncoder that returns JPX data encoded by Options.JPX. The JPX encoder of UniPDF
+// only decodes.
+type jpxData struct {
+	*core.JPXEncoder
+	data []byte
+}
+
+func (enc *jpxData) GetFilterName() string {
+	return core.StreamEncodingFilterNameJPX
+}
+
+func (enc *jpxData) MakeStreamDict() *core.PdfObjectDictionary {
+	dict := core.MakeDict()
+	dict.Set("Filter", core.MakeName(enc.GetFilterName()))
+	return dict
+}
+
+func (enc *jpxData) EncodeBytes(data []byte) ([]byte, error) {
+	return enc.data, nil
+}
+
+// copyAttributes copies the attributes that do not depend on the encoding from `orig` to `ximg`.
+// Masks and soft masks are kept as they are: the image dimensions do not change.
+func copyAttributes(ximg, orig *model.XObjectImage) {
+	ximg.Intent = orig.Intent
+	ximg.Mask = orig.Mask
+	ximg.SMask = orig.SMask
+	ximg.Matte = orig.Matte
+	ximg.Interpolate = orig.Interpolate
+	ximg.Alternatives = orig.Alternatives
+	ximg.Name = orig.Name
+	ximg.StructParent = orig.StructParent
+	ximg.ID = orig.ID
+	ximg.OPI = orig.OPI
+	ximg.Metadata = orig.Metadata
+	ximg.OC = orig.OC
+}
+
+// Analyze returns the properties and pixel statistics of `ximg` and the decoded image.
+func Analyze(ximg *model.XObjectImage) (Stats, image.Image, error) {
+	stats := Stats{Filter: filterName(ximg)}
+	if ximg.Width != nil {
+		stats.Width = int(*ximg.Width)
+	}
+	if ximg.Height != nil {
+		stats.Height = int(*ximg.Height)
+	}
+	if ximg.BitsPerComponent != nil {
+		stats.BitsPerComponent = int(*ximg.BitsPerComponent)
+	}
+	if ximg.ColorSpace != nil {
+		stats.ColorSpace = ximg.ColorSpace.String()
+		stats.Components = ximg.ColorSpace.GetNumComponents()
+	}
+	if isMask, ok := core.GetBoolVal(ximg.ImageMask); ok && isMask {
+		stats.ImageMask = true
+		stats.Components = 1
+		stats.BitsPerComponent = 1
+		stats.Colors = 2
+		stats.Gray = true
+		stats.BlackWhite = 1
+		return stats, nil, nil
+	}
+	if ximg.ColorSpace == nil {
+		return stats, nil, fmt.Errorf("no color space")
+	}
+
+	img, err := ximg.ToImage()
+	if err != nil {
+		return stats, nil, err
+	}
+	rgbImg, err := ximg.ColorSpace.ImageToRGB(*img)
+	if err != nil {
+		return stats, nil, err
+	}
+	goImg, err := rgbImg.ToGoImage()
+	if err != nil {
+		return stats, nil, err
+	}
+	pixelStats(&stats, goImg)
+	return stats, goImg, nil
+}
+
+// pixelStats fills in the pixel statistics of `stats` from a sample of the pixels of `img`.
+func pixelStats(stats *Stats, img image.Image) {
+	b := img.Bounds()
+	step := 1
+	if n := b.Dx() * b.Dy(); n > maxSamples {
+		step = int(math.Ceil(math.Sqrt(float64(n) / maxSamples)))
+	}
+
+	colors := map[uint32]bool{}
+	var total, gray, blackWhite, flat int
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			r, g, bl := rgb8(img.At(x, y))
+			total++
+			if len(colors) <= maxColors {
+				colors[uint32(r)<<16|uint32(g)<<8|uint32(bl)] = true
+			}
+			if absDiff(r, g) <= grayTolerance && absDiff(g, bl) <= grayTolerance && absDiff(r, bl) <= grayTolerance {
+				gray++
+			}
+			if lum := luminance(r, g, bl); lum <= 64 || lum >= 192 {
+				blackWhite++
+			}
+			if x+1 < b.Max.X {
+				r2, g2, b2 := rgb8(img.At(x+1, y))
+				if r == r2 && g == g2 && bl == b2 {
+					flat++
+				}
+			}
+		}
+	}
+	if total == 0 {
+		return
+	}
+	stats.Colors = len(colors)
+	// A few colored pixels, e.g. from JPEG artifacts, do not make an image a color image.
+	stats.Gray = float64(gray) >= 0.995*float64(total)
+	stats.BlackWhite = float64(blackWhite) / float64(total)
+	stats.Flat = float64(flat) / float64(total)
+}
+
+// Classify returns the class of an image with statistics `stats`.
+func Classify(stats Stats) Class {
+	switch {
+	case stats.ImageMask || (stats.Components == 1 && stats.BitsPerComponent == 1):
+		return ClassBilevel
+	case stats.Gray && stats.Colors <= 2:
+		return ClassBilevel
+	case stats.Gray && stats.BlackWhite >= 0.97 && stats.Flat >= 0.5:
+		// Scans of text: mostly paper white and ink black with some antialiasing at the edges.
+		return ClassBilevel
+	case stats.Flat >= 0.75:
+		return ClassLineArt
+	case stats.Gray:
+		// 8 bit gray images never have more than 256 colors.
+		if stats.Colors <= 16 {
+			return ClassLineArt
+		}
+		return ClassGrayscale
+	case stats.Colors <= 256:
+		return ClassLineArt
+	}
+	return ClassPhoto
+}
+
+// isNative returns true if the samples of `ximg` can be re-encoded in its own color space.
+func isNative(ximg *model.XObjectImage) bool {
+	if ximg.BitsPerComponent == nil || *ximg.BitsPerComponent != 8 || ximg.Decode != nil {
+		return false
+	}
+	switch ximg.ColorSpace.(type) {
+	case *model.PdfColorspaceDeviceGray, *model.PdfColorspaceDeviceRGB, *model.PdfColorspaceDeviceCMYK,
+		*model.PdfColorspaceICCBased:
+		return true
+	}
+	return false
+}
+
+// isColorKeyMasked returns true if `ximg` has a color key mask.
+func isColorKeyMasked(ximg *model.XObjectImage) bool {
+	_, ok := core.GetArray(ximg.Mask)
+	return ok
+}
+
+// grayImage returns `img` as an 8 bit gray image.
+func grayImage(img image.Image) *model.Image {
+	b := img.Bounds()
+	data := make([]byte, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl := rgb8(img.At(x, y))
+			data = append(data, luminance(r, g, bl))
+		}
+	}
+	return newImage(b, 1, data)
+}
+
+// rgbImage returns `img` as an 8 bit RGB image.
+func rgbImage(img image.Image) *model.Image {
+	b := img.Bounds()
+	data := make([]byte, 0, 3*b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl := rgb8(img.At(x, y))
+			data = append(data, r, g, bl)
+		}
+	}
+	return newImage(b, 3, data)
+}
+
+// indexedImage returns `img`, which must have at most 256 colors, as an 8 bit image in an Indexed
+// color space over DeviceRGB.
+func indexedImage(img image.Image) (*model.Image, model.PdfColorspace, error) {
+	b := img.Bounds()
+	index := map[uint32]byte{}
+	var palette []uint32
+	data := make([]byte, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl := rgb8(img.At(x, y))
+			c := uint32(r)<<16 | uint32(g)<<8 | uint32(bl)
+			i, ok := index[c]
+			if !ok {
+				if len(palette) == 256 {
+					// The statistics are based on a sample of the pixels.
+					return nil, nil, fmt.Errorf("more than 256 colors")
+				}
+				i = byte(len(palette))
+				index[c] = i
+				palette = append(palette, c)
+			}
+			data = append(data, i)
+		}
+	}
+	lookup := make([]byte, 0, 3*len(palette))
+	for _, c := range palette {
+		lookup = append(lookup, byte(c>>16), byte(c>>8), byte(c))
+	}
+	cs, err := model.NewPdfColorspaceFromPdfObject(core.MakeArray(
+		core.MakeName("Indexed"),
+		core.MakeName("DeviceRGB"),
+		core.MakeInteger(int64(len(palette)-1)),
+		core.MakeString(string(lookup)),
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+	return newImage(b, 1, data), cs, nil
+}
+
+// newImage returns an 8 bit image with bounds `b`, `components` color components and samples `data`.
+func newImage(b image.Rectangle, components int, data []byte) *model.Image {
+	return &model.Image{
+		Width:            int64(b.Dx()),
+		Height:           int64(b.Dy()),
+		BitsPerComponent: 8,
+		ColorComponents:  components,
+		Data:             data,
+	}
+}
+
+// rgb8 returns the 8 bit RGB components of `c`, ignoring alpha.
+func rgb8(c color.Color) (r, g, b byte) {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return nc.R, nc.G, nc.B
+}
+
+// luminance returns the luminance of an RGB color.
+func luminance(r, g, b byte) byte {
+	return byte((299*int(r) + 587*int(g) + 114*int(b) + 500) / 1000)
+}
+
+func absDiff(a, b byte) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// filterName returns the name of the filter of `ximg`, "Raw" if the image is not encoded.
+func filterName(ximg *model.XObjectImage) string {
+	if ximg.Filter == nil {
+		return "Raw"
+	}
+	return ximg.Filter.GetFilterName()
+}
@@ -0,0 +1,859 @@
+/*
+ * Package design creates AcroForm fields from declarative form specs, so forms can be designed in
+ * a text file and added to an existing PDF or to blank pages. A spec, in YAML or JSON, lists the
+ * fields with their page, rectangle, type and options, e.g.
+ *
+ *   page_size: [612, 792]     # blank documents only, default Letter
+ *   font: Helvetica           # defaults of all fields: standard 14 font name,
+ *   font_size: 10             # size (0 is auto size), colors and border
+ *   border_color: "#808080"
+ *   border_width: 1
+ *   fields:
+ *     - {name: name, type: text, page: 1, rect: [72, 700, 300, 718], tooltip: Full name, required: true}
+ *     - {name: notes, type: text, page: 1, rect: [72, 600, 300, 690], multiline: true, max_len: 500}
+ *     - {name: agree, type: checkbox, page: 1, rect: [72, 570, 84, 582], export: Yes, checked: true}
+ *     - name: size
+ *       type: radio
+ *       page: 1
+ *       value: M
+ *       buttons:
+ *         - {export: S, rect: [72, 540, 84, 552]}
+ *         - {export: M, rect: [100, 540, 112, 552]}
+ *     - {name: color, type: combo, page: 1, rect: [72, 500, 200, 516], options: [Red, Green], editable: true}
+ *     - {name: days, type: list, page: 1, rect: [72, 420, 200, 490], options: [Mon, Tue], multi_select: true}
+ *     - {name: reset, type: button, page: 1, rect: [72, 380, 140, 400], caption: Reset, action: reset}
+ *     - {name: sig, type: signature, page: 1, rect: [300, 72, 540, 132]}
+ *
+ * The field types are text, checkbox, radio, combo, list, button (push button) and signature.
+ * Names with dots, e.g. "address.city", create the parent fields. Widgets are placed on each page
+ * in the order of their tab keys (fields without one first, in spec order), which viewers follow
+ * as the tab order. Appearance streams are created for all fields.
+ *
+ *   spec, err := design.LoadSpec("form.yaml")
+ *   pdfWriter, err := design.AddToReader(pdfReader, spec) // Fields on an existing PDF.
+ *   pdfWriter, err := design.NewDocument(spec)            // Fields on blank pages.
+ *   spec, err := design.Export(pdfReader)                 // The spec of the fields of any PDF.
+ *
+ * Used by pdftool form-design and forms/pdf_form_design.go.
+ */
+
+package design
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Field types.
+const (
+	TypeText      = "text"
+	TypeCheckbox  = "checkbox"
+	TypeRadio     = "radio"
+	TypeCombo     = "combo"
+	TypeList      = "list"
+	TypeButton    = "button"
+	TypeSignature = "signature"
+)
+
+// Push button actions.
+const (
+	ActionReset  = "reset"
+	ActionSubmit = "submit"
+	ActionURL    = "url"
+)
+
+// DefaultPageSize is the size of blank pages if the spec sets none: US Letter.
+var DefaultPageSize = []float64{612, 792}
+
+// Spec is a form spec.
+type Spec struct {
+	// PageSize is the [width, height] of the pages of blank documents.
+	PageSize []float64 `json:"page_size,omitempty" yaml:"page_size,flow,omitempty"`
+	// Pages is the number of pages of blank documents, at least the highest page of the fields.
+	Pages int `json:"pages,omitempty" yaml:"pages,omitempty"`
+	// Style is the default style of the fields.
+	Style  `yaml:",inline"`
+	Fields []*Field `json:"fields" yaml:"fields"`
+}
+
+// Style is the look of a field. Colors are given as #rrggbb or #rgb.
+type Style struct {
+	// Font is a standard 14 font name, Helvetica by default.
+	Font string `json:"font,omitempty" yaml:"font,omitempty"`
+	// FontSize is the font size, 0 to fit the text to the field.
+	FontSize    float64 `json:"font_size,omitempty" yaml:"font_size,omitempty"`
+	TextColor   string  `json:"text_color,omitempty" yaml:"text_color,omitempty"`
+	FillColor   string  `json:"fill_color,omitempty" yaml:"fill_color,omitempty"`
+	BorderColor string  `json:"border_color,omitempty" yaml:"border_color,omitempty"`
+	BorderWidth float64 `json:"border_width,omitempty" yaml:"border_width,omitempty"`
+}
+
+// Field is a field of a form spec.
+type Field struct {
+	// Name is the full field name, e.g. "address.city".
+	Name string `json:"name" yaml:"name"`
+	// Type is text, checkbox, radio, combo, list, button or signature.
+	Type string `json:"type" yaml:"type"`
+	// Page is the number of the page of the field, starting at 1.
+	Page int `json:"page" yaml:"page"`
+	// Rect is the [llx, lly, urx, ury] rectangle of the field. Radio groups set it per button.
+	Rect []float64 `json:"rect,omitempty" yaml:"rect,flow,omitempty"`
+	// Tooltip is the text shown by viewers over the field, also used by screen readers.
+	Tooltip string `json:"tooltip,omitempty" yaml:"tooltip,omitempty"`
+	// Tab is the position of the field in the tab order of its page, starting at 1.
+	Tab      int  `json:"tab,omitempty" yaml:"tab,omitempty"`
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+	ReadOnly bool `json:"read_only,omitempty" yaml:"read_only,omitempty"`
+
+	// Value is the default value of text, combo, list and radio fields, the export of the selected
+	// button of radio groups.
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	// Values are the selected options of multi-select list boxes.
+	Values []string `json:"values,omitempty" yaml:"values,omitempty,flow"`
+
+	// Text fields.
+	Multiline bool `json:"multiline,omitempty" yaml:"multiline,omitempty"`
+	Password  bool `json:"password,omitempty" yaml:"password,omitempty"`
+	// Comb spreads the characters evenly over MaxLen cells.
+	Comb   bool `json:"comb,omitempty" yaml:"comb,omitempty"`
+	MaxLen int  `json:"max_len,omitempty" yaml:"max_len,omitempty"`
+	// Align is the text alignment: left, center or right.
+	Align string `json:"align,omitempty" yaml:"align,omitempty"`
+
+	// Options are the options shown by combo boxes and list boxes.
+	Options []string `json:"options,omitempty" yaml:"options,omitempty,flow"`
+	// Exports are the values exported for the options, the options themselves by default.
+	Exports []string `json:"exports,omitempty" yaml:"exports,omitempty,flow"`
+	// Editable lets combo boxes take text that is not an option.
+	Editable    bool `json:"editable,omitempty" yaml:"editable,omitempty"`
+	MultiSelect bool `json:"multi_select,omitempty" yaml:"multi_select,omitempty"`
+
+	// Export is the on-state value of check boxes, Yes by default.
+	Export  string `json:"export,omitempty" yaml:"export,omitempty"`
+	Checked bool   `json:"checked,omitempty" yaml:"checked,omitempty"`
+	// Buttons are the buttons of radio groups.
+	Buttons []*Button `json:"buttons,omitempty" yaml:"buttons,omitempty"`
+
+	// Caption is the text of push buttons.
+	Caption string `json:"caption,omitempty" yaml:"caption,omitempty"`
+	// Action is what push buttons do: reset the form, submit it to URL or open URL.
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+	URL    string `json:"url,omitempty" yaml:"url,omitempty"`
+
+	// Style overrides the style of the spec.
+	Style `yaml:",inline"`
+}
+
+// Button is a button of a radio group.
+type Button struct {
+	Export string    `json:"export" yaml:"export"`
+	Rect   []float64 `json:"rect" yaml:"rect,flow"`
+}
+
+// LoadSpec reads the YAML or JSON form spec file at `path` and checks it.
+func LoadSpec(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := ParseSpec(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// ParseSpec parses the YAML or JSON form spec `data` and checks it.
+func ParseSpec(data []byte) (*Spec, error) {
+	// JSON is a subset of YAML, so both are read by the YAML decoder.
+	var spec Spec
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil {
+		return nil, err
+	}
+	if err := spec.Check(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Save writes `s` to `path`, as JSON if its name ends with .json and as YAML otherwise.
+func (s *Spec) Save(path string) error {
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err = json.MarshalIndent(s, "", "  ")
+		data = append(data, '\n')
+	} else {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err = enc.Encode(s); err == nil {
+			err = enc.Close()
+		}
+		data = buf.Bytes()
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Check returns an error if `s` is not valid.
+func (s *Spec) Check() error {
+	if s.PageSize != nil && (len(s.PageSize) != 2 || s.PageSize[0] <= 0 || s.PageSize[1] <= 0) {
+		return fmt.Errorf("page_size must be [width, height]")
+	}
+	if err := s.Style.check(); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for i, f := range s.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("field %d: no name", i+1)
+		}
+		if names[f.Name] {
+			return fmt.Errorf("field %q: defined twice", f.Name)
+		}
+		names[f.Name] = true
+		if err := f.check(); err != nil {
+			return fmt.Errorf("field %q: %w", f.Name, err)
+		}
+	}
+	// A field can't be both a terminal field and the parent of another.
+	for name := range names {
+		parts := strings.Split(name, ".")
+		for i := 1; i < len(parts); i++ {
+			if parent := strings.Join(parts[:i], "."); names[parent] {
+				return fmt.Errorf("field %q: %q is a field, not a parent", name, parent)
+			}
+		}
+	}
+	return nil
+}
+
+// check returns an error if `f` is not valid.
+func (f *Field) check() error {
+	for _, part := range strings.Split(f.Name, ".") {
+		if part == "" {
+			return fmt.Errorf("empty part in name")
+		}
+	}
+	if f.Page < 1 {
+		return fmt.Errorf("page must be 1 or more")
+	}
+	if f.Type == TypeRadio {
+		if len(f.Buttons) == 0 {
+			return fmt.Errorf("radio group without buttons")
+		}
+		exports := map[string]bool{}
+		for _, b := range f.Buttons {
+			if b.Export == "" || b.Export == "Off" {
+				return fmt.Errorf("invalid button export %q", b.Export)
+			}
+			exports[b.Export] = true
+			if err := checkRect(b.Rect); err != nil {
+				return err
+			}
+		}
+		if f.Value != "" && !exports[f.Value] {
+			return fmt.Errorf("value %q is not the export of a button", f.Value)
+		}
+	} else if err := checkRect(f.Rect); err != nil {
+		return err
+	}
+
+	switch f.Type {
+	case TypeText, TypeRadio, TypeSignature:
+	case TypeCheckbox:
+		if f.Export == "Off" {
+			return fmt.Errorf("export can't be Off")
+		}
+	case TypeCombo, TypeList:
+		if len(f.Options) == 0 && !f.Editable {
+			return fmt.Errorf("no options")
+		}
+		if f.Exports != nil && len(f.Exports) != len(f.Options) {
+			return fmt.Errorf("%d exports for %d options", len(f.Exports), len(f.Options))
+		}
+		if len(f.Values) > 1 && !f.MultiSelect {
+			return fmt.Errorf("several values but not multi_select")
+		}
+	case TypeButton:
+		switch f.Action {
+		case "", ActionReset:
+		case ActionSubmit, ActionURL:
+			if f.URL == "" {
+				return fmt.Errorf("action %s needs a url", f.Action)
+			}
+		default:
+			return fmt.Errorf("invalid action %q: must be reset, submit or url", f.Action)
+		}
+	default:
+		return fmt.Errorf("invalid type %q: must be text, checkbox, radio, combo, list, button or signature",
+			f.Type)
+	}
+	if _, ok := alignments[f.Align]; !ok {
+		return fmt.Errorf("invalid align %q: must be left, center or right", f.Align)
+	}
+	if f.MaxLen < 0 {
+		return fmt.Errorf("max_len must not be negative")
+	}
+	if f.Comb && f.MaxLen == 0 {
+		return fmt.Errorf("comb fields need max_len")
+	}
+	return f.Style.check()
+}
+
+// checkRect returns an error if `rect` is not a rectangle.
+func checkRect(rect []float64) error {
+	if len(rect) != 4 || rect[2] < rect[0] || rect[3] < rect[1] {
+		return fmt.Errorf("rect must be [llx, lly, urx, ury]")
+	}
+	return nil
+}
+
+// check returns an error if `s` is not valid.
+func (s Style) check() error {
+	if s.Font != "" {
+		if _, ok := fontResources[s.Font]; !ok {
+			return fmt.Errorf("invalid font %q: must be a standard 14 font name", s.Font)
+		}
+	}
+	for _, c := range []string{s.TextColor, s.FillColor, s.BorderColor} {
+		if _, err := parseColor(c); err != nil {
+			return err
+		}
+	}
+	if s.FontSize < 0 || s.BorderWidth < 0 {
+		return fmt.Errorf("font_size and border_width must not be negative")
+	}
+	return nil
+}
+
+// over returns `s` with the settings of `o` that are set.
+func (s Style) over(o Style) Style {
+	if o.Font != "" {
+		s.Font = o.Font
+	}
+	if o.FontSize != 0 {
+		s.FontSize = o.FontSize
+	}
+	if o.TextColor != "" {
+		s.TextColor = o.TextColor
+	}
+	if o.FillColor != "" {
+		s.FillColor = o.FillColor
+	}
+	if o.BorderColor != "" {
+		s.BorderColor = o.BorderColor
+	}
+	if o.BorderWidth != 0 {
+		s.BorderWidth = o.BorderWidth
+	}
+	return s
+}
+
+// alignments are the quadding values (Q) of the text alignments.
+var alignments = map[string]int64{"": 0, "left": 0, "center": 1, "right": 2}
+
+// fontResources are the resource names of the standard 14 fonts in the default resources of forms,
+// the names used by Acrobat.
+var fontResources = map[string]string{
+	"Helvetica":             "Helv",
+	"Helvetica-Bold":        "HeBo",
+	"Helvetica-Oblique":     "HeOb",
+	"Helvetica-BoldOblique": "HeBO",
+	"Times-Roman":           "TiRo",
+	"Times-Bold":            "TiBo",
+	"Times-Italic":          "TiIt",
+	"Times-BoldItalic":      "TiBI",
+	"Courier":               "Cour",
+	"Courier-Bold":          "CoBo",
+	"Courier-Oblique":       "CoOb",
+	"Courier-BoldOblique":   "CoBO",
+	"Symbol":                "Symb",
+	"ZapfDingbats":          "ZaDb",
+}
+
+// parseColor parses a color given as #rrggbb or #rgb into RGB components. An empty string returns
+// nil.
+func parseColor(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return nil, fmt.Errorf("invalid color %q: must be #rrggbb or #rgb", s)
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q: must be #rrggbb or #rgb", s)
+	}
+	return []float64{float64(rgb>>16&0xff) / 255, float64(rgb>>8&0xff) / 255, float64(rgb&0xff) / 255}, nil
+}
+
+// formatColor returns the color with the components `c` as #rrggbb: gray, RGB or CMYK. It returns
+// "" for other component counts.
+func formatColor(c []float64) string {
+	switch len(c) {
+	case 1:
+		c = []float64{c[0], c[0], c[0]}
+	case 3:
+	case 4:
+		k := 1 - c[3]
+		c = []float64{(1 - c[0]) * k, (1 - c[1]) * k, (1 - c[2]) * k}
+	default:
+		return ""
+	}
+	byteOf := func(v float64) int {
+		if v < 0 {
+			v = 0
+		} else if v > 1 {
+			v = 1
+		}
+		return int(v*255 + 0.5)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", byteOf(c[0]), byteOf(c[1]), byteOf(c[2]))
+}
+
+// NewDocument returns a writer of blank pages with the fields of `spec`.
+func NewDocument(spec *Spec) (*model.PdfWriter, error) {
+	if err := spec.Check(); err != nil {
+		return nil, err
+	}
+	size := spec.PageSize
+	if size == nil {
+		size = DefaultPageSize
+	}
+	numPages := spec.Pages
+	for _, f := range spec.Fields {
+		if f.Page > numPages {
+			numPages = f.Page
+		}
+	}
+	if numPages == 0 {
+		numPages = 1
+	}
+
+	pages := make([]*model.PdfPage, numPages)
+	for i := range pages {
+		pages[i] = model.NewPdfPage()
+		pages[i].MediaBox = &model.PdfRectangle{Urx: size[0], Ury: size[1]}
+	}
+	form := model.NewPdfAcroForm()
+	if err := Add(form, pages, spec); err != nil {
+		return nil, err
+	}
+
+	pdfWriter := model.NewPdfWriter()
+	for _, page := range pages {
+		if err := pdfWriter.AddPage(page); err != nil {
+			return nil, err
+		}
+	}
+	if err := pdfWriter.SetForms(form); err != nil {
+		return nil, err
+	}
+	return &pdfWriter, nil
+}
+
+// AddToReader adds the fields of `spec` to the document loaded by `pdfReader`, keeping its fields,
+// and returns a writer of the result.
+func AddToReader(pdfReader *model.PdfReader, spec *Spec) (*model.PdfWriter, error) {
+	form := pdfReader.AcroForm
+	if form == nil {
+		form = model.NewPdfAcroForm()
+	}
+	if err := Add(form, pdfReader.PageList, spec); err != nil {
+		return nil, err
+	}
+	// ToWriter writes the form of the reader.
+	pdfReader.AcroForm = form
+	return pdfReader.ToWriter(nil)
+}
+
+// Add adds the fields of `spec` to `form` and their widgets to `pages`. Fields that `form` already
+// has can't be added again.
+func Add(form *model.PdfAcroForm, pages []*model.PdfPage, spec *Spec) error {
+	if err := spec.Check(); err != nil {
+		return err
+	}
+	if form.Fields == nil {
+		form.Fields = &[]*model.PdfField{}
+	}
+	if form.DR == nil {
+		form.DR = model.NewPdfPageResources()
+	}
+	if form.DA == nil {
+		form.DA = core.MakeString("/Helv 0 Tf 0 g")
+	}
+	d := &designer{form: form, pages: pages, fonts: map[string]*model.PdfFont{},
+		tabs: map[*model.PdfAnnotation]int{}}
+	if _, err := d.font("Helvetica"); err != nil {
+		return err
+	}
+
+	existing := map[string]*model.PdfField{}
+	for _, f := range form.AllFields() {
+		name, err := f.FullName()
+		if err != nil {
+			return err
+		}
+		existing[name] = f
+	}
+	for _, f := range spec.Fields {
+		if f.Page > len(pages) {
+			return fmt.Errorf("field %q: page %d of %d", f.Name, f.Page, len(pages))
+		}
+		if _, ok := existing[f.Name]; ok {
+			return fmt.Errorf("field %q: the form has it already", f.Name)
+		}
+		if err := d.add(f, spec.Style.over(f.Style), existing); err != nil {
+			return fmt.Errorf("field %q: %w", f.Name, err)
+		}
+	}
+	d.orderWidgets()
+
+	// Signature fields need SigFlags SignaturesExist.
+	for _, f := range spec.Fields {
+		if f.Type == TypeSignature && form.SigFlags == nil {
+			form.SigFlags = core.MakeInteger(1)
+		}
+	}
+	return nil
+}
+
+// designer adds fields to a form.
+type designer struct {
+	form  *model.PdfAcroForm
+	pages []*model.PdfPage
+	// fonts are the fonts of the default resources by resource name.
+	fonts map[string]*model.PdfFont
+	// tabs are the tab keys of the widgets added.
+	tabs map[*model.PdfAnnotation]int
+}
+
+// font returns the resource name of the standard 14 font `name` in the default resources of the
+// form and the font, adding it to the resources if needed.
+func (d *designer) font(name string) (string, error) {
+	res := fontResources[name]
+	if _, ok := d.fonts[res]; ok {
+		return res, nil
+	}
+	font, err := model.NewStandard14Font(model.StdFontName(name))
+	if err != nil {
+		return "", err
+	}
+	if !d.form.DR.HasFontByName(core.PdfObjectName(res)) {
+		if err := d.form.DR.SetFontByName(core.PdfObjectName(res), font.ToPdfObject()); err != nil {
+			return "", err
+		}
+	}
+	d.fonts[res] = font
+	return res, nil
+}
+
+// parent returns the parent field of the field named `name`, creating the parents that
+// `existing` doesn't have, or nil for top-level fields.
+func (d *designer) parent(name string, existing map[string]*model.PdfField) (*model.PdfField, error) {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return nil, nil
+	}
+	parentName := name[:i]
+	if p, ok := existing[parentName]; ok {
+		if p.IsTerminal() {
+			return nil, fmt.Errorf("%q is a field, not a parent", parentName)
+		}
+		return p, nil
+	}
+	grandparent, err := d.parent(parentName, existing)
+	if err != nil {
+		return nil, err
+	}
+	p := model.NewPdfField()
+	p.T = core.MakeString(parentName[strings.LastIndex(parentName, ".")+1:])
+	d.attach(p, grandparent)
+	existing[parentName] = p
+	return p, nil
+}
+
+// attach adds the field `f` to `parent`, or to the top-level fields if `parent` is nil.
+func (d *designer) attach(f, parent *model.PdfField) {
+	if parent == nil {
+		*d.form.Fields = append(*d.form.Fields, f)
+		return
+	}
+	f.Parent = parent
+	parent.Kids = append(parent.Kids, f)
+}
+
+// add adds the field `f` with the style `style`.
+func (d *designer) add(f *Field, style Style, existing map[string]*model.PdfField) error {
+	parent, err := d.parent(f.Name, existing)
+	if err != nil {
+		return err
+	}
+	page := d.pages[f.Page-1]
+
+	var field *model.PdfField
+	switch f.Type {
+	case TypeSignature:
+		field, err = d.addSignature(f, style, page)
+	default:
+		field, err = d.addField(f, style, page)
+	}
+	if err != nil {
+		return err
+	}
+	field.T = core.MakeString(f.Name[strings.LastIndex(f.Name, ".")+1:])
+	if f.Tooltip != "" {
+		field.TU = makeString(f.Tooltip)
+	}
+	flags := field.Flags()
+	if f.Required {
+		flags = flags.Set(model.FieldFlagRequired)
+	}
+	if f.ReadOnly {
+		flags = flags.Set(model.FieldFlagReadOnly)
+	}
+	if flags != 0 {
+		field.Ff = core.MakeInteger(int64(flags))
+	}
+	d.attach(field, parent)
+	existing[f.Name] = field
+	return nil
+}
+
+// addField returns the field `f` of a type other than signature with its widgets on `page`.
+func (d *designer) addField(f *Field, style Style, page *model.PdfPage) (*model.PdfField, error) {
+	field := model.NewPdfField()
+	var flags model.FieldFlag
+	switch f.Type {
+	case TypeText:
+		ctx := &model.PdfFieldText{PdfField: field}
+		field.SetContext(ctx)
+		if f.Multiline {
+			flags = flags.Set(model.FieldFlagMultiline)
+		}
+		if f.Password {
+			flags = flags.Set(model.FieldFlagPassword)
+		}
+		if f.Comb {
+			flags = flags.Set(model.FieldFlagComb).Set(model.FieldFlagDoNotScroll)
+		}
+		if f.MaxLen > 0 {
+			ctx.MaxLen = core.MakeInteger(int64(f.MaxLen))
+		}
+		if q := alignments[f.Align]; q != 0 {
+			ctx.Q = core.MakeInteger(q)
+		}
+		if f.Value != "" {
+			field.V = makeString(f.Value)
+			field.DV = makeString(f.Value)
+		}
+	case TypeCombo, TypeList:
+		ctx := &model.PdfFieldChoice{PdfField: field}
+		field.SetContext(ctx)
+		if f.Type == TypeCombo {
+			flags = flags.Set(model.FieldFlagCombo)
+		}
+		if f.Editable {
+			flags = flags.Set(model.FieldFlagEdit)
+		}
+		if f.MultiSelect {
+			flags = flags.Set(model.FieldFlagMultiSelect)
+		}
+		ctx.Opt = core.MakeArray()
+		for i, option := range f.Options {
+			if f.Exports != nil {
+				ctx.Opt.Append(core.MakeArray(makeString(f.Exports[i]), makeString(option)))
+			} else {
+				ctx.Opt.Append(makeString(option))
+			}
+		}
+		if v := choiceValue(f); v != nil {
+			field.V = v
+			field.DV = v
+		}
+	case TypeCheckbox, TypeRadio, TypeButton:
+		ctx := &model.PdfFieldButton{PdfField: field}
+		field.SetContext(ctx)
+		switch f.Type {
+		case TypeCheckbox:
+			ctx.SetType(model.ButtonTypeCheckbox)
+			v := core.MakeName("Off")
+			if f.Checked {
+				v = core.MakeName(checkboxExport(f))
+			}
+			field.V, field.DV = v, v
+		case TypeRadio:
+			ctx.SetType(model.ButtonTypeRadio)
+			flags = flags.Set(model.FieldFlagNoToggleToOff)
+			v := core.MakeName("Off")
+			if f.Value != "" {
+				v = core.MakeName(f.Value)
+			}
+			field.V, field.DV = v, v
+		default:
+			ctx.SetType(model.ButtonTypePush)
+		}
+		flags |= field.Flags()
+	}
+	if flags != 0 {
+		field.Ff = core.MakeInteger(int64(flags))
+	}
+
+	if f.Type == TypeRadio {
+		for _, b := range f.Buttons {
+			w := d.widget(field, b.Rect, page, f.Tab)
+			state := "Off"
+			if b.Export == f.Value {
+				state = b.Export
+			}
+			if err := d.appearance(field, w, f, style, b.Export, state); err != nil {
+				return nil, err
+			}
+		}
+		return field, nil
+	}
+
+	w := d.widget(field, f.Rect, page, f.Tab)
+	if f.Type == TypeButton {
+		w.H = core.MakeName("P")
+		switch f.Action {
+		case ActionReset:
+			action := model.NewPdfActionResetForm()
+			w.A = action.ToPdfObject()
+		case ActionSubmit:
+			action := model.NewPdfActionSubmitForm()
+			action.F = model.NewPdfFilespec()
+			action.F.F = makeString(f.URL)
+			action.F.FS = core.MakeName("URL")
+			w.A = action.ToPdfObject()
+		case ActionURL:
+			action := model.NewPdfActionURI()
+			action.URI = makeString(f.URL)
+			w.A = action.ToPdfObject()
+		}
+	}
+	state := ""
+	if f.Type == TypeCheckbox {
+		state = "Off"
+		if f.Checked {
+			state = checkboxExport(f)
+		}
+	}
+	if err := d.appearance(field, w, f, style, checkboxExport(f), state); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// widget returns a new widget of `field` with the rectangle `rect` on `page`, added to the page and
+// the field, and sorted by `tab` on the page.
+func (d *designer) widget(field *model.PdfField, rect []float64, page *model.PdfPage, tab int) *model.PdfAnnotationWidget {
+	w := model.NewPdfAnnotationWidget()
+	w.Rect = core.MakeArrayFromFloats(rect)
+	w.P = page.ToPdfObject()
+	w.F = core.MakeInteger(4) // Print.
+	w.Parent = field.GetContext().ToPdfObject()
+	field.Annotations = append(field.Annotations, w)
+	page.AddAnnotation(w.PdfAnnotation)
+	d.tabs[w.PdfAnnotation] = tab
+	return w
+}
+
+// addSignature returns the signature field `f` with its widget on `page`. The field and the widget
+// are merged, as when unipdf signs.
+func (d *designer) addSignature(f *Field, style Style, page *model.PdfPage) (*model.PdfField, error) {
+	sig := model.NewPdfFieldSignature(nil)
+	sig.Rect = core.MakeArrayFromFloats(f.Rect)
+	sig.P = page.ToPdfObject()
+	sig.F = core.MakeInteger(4) // Print.
+	page.AddAnnotation(sig.PdfAnnotationWidget.PdfAnnotation)
+	d.tabs[sig.PdfAnnotationWidget.PdfAnnotation] = f.Tab
+	if err := d.appearance(sig.PdfField, sig.PdfAnnotationWidget, f, style, "", ""); err != nil {
+		return nil, err
+	}
+	return sig.PdfField, nil
+}
+
+// orderWidgets sorts the widgets added on each page by their tab keys: widgets without one first
+// in the order they were added, then by key. Other annotations keep their positions before them.
+func (d *designer) orderWidgets() {
+	for _, page := range d.pages {
+		annots, err := page.GetAnnotations()
+		if err != nil || len(annots) == 0 {
+			continue
+		}
+		var kept, added []*model.PdfAnnotation
+		for _, a := range annots {
+			if _, ok := d.tabs[a]; ok {
+				added = append(added, a)
+			} else {
+				kept = append(kept, a)
+			}
+		}
+		// Stable insertion sort, the lists are short.
+		for i := 1; i < len(added); i++ {
+			for j := i; j > 0 && d.tabs[added[j]] < d.tabs[added[j-1]]; j-- {
+				added[j], added[j-1] = added[j-1], added[j]
+			}
+		}
+		page.SetAnnotations(append(kept, added...))
+	}
+}
+
+// checkboxExport returns the on-state value of the check box `f`.
+func checkboxExport(f *Field) string {
+	if f.Export == "" {
+		return "Yes"
+	}
+	return f.Export
+}
+
+// choiceValue returns the value of the combo box or list box `f`: a string, an array of strings
+// for several values or nil.
+func choiceValue(f *Field) core.PdfObject {
+	values := f.Values
+	if len(values) == 0 && f.Value != "" {
+		values = []string{f.Value}
+	}
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return makeString(values[0])
+	}
+	arr := core.MakeArray()
+	for _, v := range values {
+		arr.Append(makeString(v))
+	}
+	return arr
+}
+
+// makeString returns `s` as a PDF string, UTF-16 encoded if it isn't ASCII.
+func makeString(s string) *core.PdfObjectString {
+	for _, r := range s {
+		if r > 0x7e {
+			return core.MakeEncodedString(s, true)
+		}
+	}
+	return core.MakeString(s)
+}
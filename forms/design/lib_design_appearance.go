@@ -0,0 +1,301 @@
+/*
+ * Appearance streams of the designed fields. Text fields and combo boxes get the appearances of
+ * unipdf's annotator, the other types are drawn here as the annotator can't draw them with their
+ * export values and captions.
+ */
+
+package design
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/contentstream"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Glyphs of ZapfDingbats drawn in the on state of check boxes and radio buttons: a check mark
+// and a filled circle.
+const (
+	checkGlyph = "\u2714"
+	radioGlyph = "\u25cf"
+)
+
+// selectionColor is the background of the selected options of list boxes, the one used by Acrobat.
+var selectionColor = []float64{0.6, 0.757, 0.855}
+
+// appearance sets the appearance characteristics, default appearance and appearance streams of
+// the widget `w` of `field`. `onState` is the on state of check boxes and radio buttons, `state`
+// their current state.
+func (d *designer) appearance(field *model.PdfField, w *model.PdfAnnotationWidget, f *Field, style Style,
+	onState, state string) error {
+	font := style.Font
+	if font == "" {
+		font = "Helvetica"
+	}
+	glyph := ""
+	switch f.Type {
+	case TypeCheckbox:
+		font, glyph = "ZapfDingbats", checkGlyph
+	case TypeRadio:
+		font, glyph = "ZapfDingbats", radioGlyph
+	}
+	res, err := d.font(font)
+	if err != nil {
+		return err
+	}
+	textColor, _ := parseColor(style.TextColor)
+	fillColor, _ := parseColor(style.FillColor)
+	borderColor, _ := parseColor(style.BorderColor)
+	if borderColor != nil && style.BorderWidth == 0 {
+		style.BorderWidth = 1
+	}
+
+	// Appearance characteristics.
+	mk := core.MakeDict()
+	if fillColor != nil {
+		mk.Set("BG", core.MakeArrayFromFloats(fillColor))
+	}
+	if borderColor != nil {
+		mk.Set("BC", core.MakeArrayFromFloats(borderColor))
+	}
+	switch {
+	case glyph != "":
+		mk.Set("CA", core.MakeStringFromBytes(d.fonts[res].Encoder().Encode(glyph)))
+	case f.Type == TypeButton && f.Caption != "":
+		mk.Set("CA", makeString(f.Caption))
+	}
+	if len(mk.Keys()) > 0 {
+		w.MK = mk
+	}
+	if style.BorderWidth > 0 {
+		bs := core.MakeDict()
+		bs.Set("W", core.MakeFloat(style.BorderWidth))
+		bs.Set("S", core.MakeName("S"))
+		w.BS = bs
+	}
+
+	// Default appearance.
+	if f.Type != TypeSignature {
+		da := core.MakeString(fmt.Sprintf("/%s %s Tf %s", res, formatNumber(style.FontSize), colorOperator(textColor)))
+		if ctx, ok := field.GetContext().(*model.PdfFieldText); ok {
+			ctx.DA = da
+		} else if dict, ok := core.GetDict(field.GetContainingPdfObject()); ok {
+			dict.Set("DA", da)
+		}
+	}
+
+	rect := f.Rect
+	if f.Type == TypeRadio {
+		arr, _ := core.GetArray(w.Rect)
+		rect, _ = arr.ToFloat64Array()
+	}
+	box := appearanceBox{width: rect[2] - rect[0], height: rect[3] - rect[1], fill: fillColor,
+		border: borderColor, borderWidth: style.BorderWidth}
+	fontRes, pdfFont := core.PdfObjectName(res), d.fonts[res]
+
+	var ap *core.PdfObjectDictionary
+	switch f.Type {
+	case TypeText, TypeCombo:
+		ap, err = annotator.FieldAppearance{}.GenerateAppearanceDict(d.form, field, w)
+		if err != nil {
+			return err
+		}
+		// The annotator draws nothing for empty fields.
+		if ap == nil || ap.Get("N") == nil {
+			ap = appearanceDict(box.form(nil, "", nil))
+		}
+	case TypeCheckbox, TypeRadio:
+		states := core.MakeDict()
+		states.Set("Off", box.form(nil, "", nil).ToPdfObject())
+		states.Set(core.PdfObjectName(onState), box.glyphForm(fontRes, pdfFont, glyph, textColor).ToPdfObject())
+		ap = core.MakeDict()
+		ap.Set("N", states)
+		w.AS = core.MakeName(state)
+	case TypeList:
+		ap = appearanceDict(box.listForm(fontRes, pdfFont, style.FontSize, textColor, f))
+	case TypeButton:
+		ap = appearanceDict(box.captionForm(fontRes, pdfFont, style.FontSize, textColor, f.Caption))
+	case TypeSignature:
+		ap = appearanceDict(box.form(nil, "", nil))
+	}
+	w.AP = ap
+	return nil
+}
+
+// appearanceDict returns an appearance dictionary with the normal appearance `form`.
+func appearanceDict(form *model.XObjectForm) *core.PdfObjectDictionary {
+	ap := core.MakeDict()
+	ap.Set("N", form.ToPdfObject())
+	return ap
+}
+
+// appearanceBox is the background and border of a widget appearance.
+type appearanceBox struct {
+	width, height float64
+	fill, border  []float64
+	borderWidth   float64
+}
+
+// form returns an appearance with the background and border of `b` and the content drawn by
+// `draw`. `font` and `fontRes` are the font used by `draw` and its resource name, if any.
+func (b appearanceBox) form(font *model.PdfFont, fontRes core.PdfObjectName,
+	draw func(cc *contentstream.ContentCreator)) *model.XObjectForm {
+	cc := contentstream.NewContentCreator()
+	if b.fill != nil {
+		cc.Add_q()
+		setColor(cc, b.fill, false)
+		cc.Add_re(0, 0, b.width, b.height).Add_f()
+		cc.Add_Q()
+	}
+	if b.border != nil && b.borderWidth > 0 {
+		bw := b.borderWidth
+		cc.Add_q()
+		setColor(cc, b.border, true)
+		cc.Add_w(bw).Add_re(bw/2, bw/2, b.width-bw, b.height-bw).Add_S()
+		cc.Add_Q()
+	}
+	if draw != nil {
+		draw(cc)
+	}
+
+	xform := model.NewXObjectForm()
+	xform.BBox = core.MakeArrayFromFloats([]float64{0, 0, b.width, b.height})
+	xform.Resources = model.NewPdfPageResources()
+	if font != nil {
+		xform.Resources.SetFontByName(fontRes, font.ToPdfObject())
+	}
+	xform.SetContentStream(cc.Bytes(), core.NewFlateEncoder())
+	return xform
+}
+
+// glyphForm returns the on-state appearance of check boxes and radio buttons: the ZapfDingbats
+// `glyph` centered in the box.
+func (b appearanceBox) glyphForm(fontRes core.PdfObjectName, font *model.PdfFont, glyph string,
+	color []float64) *model.XObjectForm {
+	size := 0.8 * math.Min(b.width, b.height)
+	return b.form(font, fontRes, func(cc *contentstream.ContentCreator) {
+		width := textWidth(font, glyph, size)
+		cc.Add_q()
+		setColor(cc, color, false)
+		cc.Add_BT().Add_Tf(fontRes, size)
+		cc.Add_Td((b.width-width)/2, (b.height-0.7*size)/2)
+		cc.Add_Tj(*core.MakeStringFromBytes(font.Encoder().Encode(glyph)))
+		cc.Add_ET().Add_Q()
+	})
+}
+
+// captionForm returns the appearance of push buttons: `caption` centered in the box.
+func (b appearanceBox) captionForm(fontRes core.PdfObjectName, font *model.PdfFont, size float64,
+	color []float64, caption string) *model.XObjectForm {
+	if caption == "" {
+		return b.form(nil, "", nil)
+	}
+	if size == 0 {
+		size = fitSize(font, []string{caption}, b.width-4, b.height)
+	}
+	return b.form(font, fontRes, func(cc *contentstream.ContentCreator) {
+		width := textWidth(font, caption, size)
+		cc.Add_q()
+		setColor(cc, color, false)
+		cc.Add_BT().Add_Tf(fontRes, size)
+		cc.Add_Td((b.width-width)/2, (b.height-0.7*size)/2)
+		cc.Add_Tj(*core.MakeStringFromBytes(font.Encoder().Encode(caption)))
+		cc.Add_ET().Add_Q()
+	})
+}
+
+// listForm returns the appearance of the list box `f`: its options from the top, the selected ones
+// highlighted.
+func (b appearanceBox) listForm(fontRes core.PdfObjectName, font *model.PdfFont, size float64,
+	color []float64, f *Field) *model.XObjectForm {
+	if size == 0 {
+		size = 12
+	}
+	selected := map[string]bool{}
+	for _, v := range append([]string{f.Value}, f.Values...) {
+		selected[v] = v != ""
+	}
+	lineHeight := 1.15 * size
+	return b.form(font, fontRes, func(cc *contentstream.ContentCreator) {
+		cc.Add_BMC("Tx").Add_q()
+		cc.Add_re(1, 1, b.width-2, b.height-2).Add_W().Add_n()
+		for i, option := range f.Options {
+			export := option
+			if f.Exports != nil {
+				export = f.Exports[i]
+			}
+			top := b.height - 1 - float64(i)*lineHeight
+			if top <= 0 {
+				break
+			}
+			if selected[export] {
+				cc.Add_q()
+				setColor(cc, selectionColor, false)
+				cc.Add_re(1, top-lineHeight, b.width-2, lineHeight).Add_f()
+				cc.Add_Q()
+			}
+			cc.Add_q()
+			setColor(cc, color, false)
+			cc.Add_BT().Add_Tf(fontRes, size)
+			cc.Add_Td(2, top-lineHeight+0.25*size)
+			cc.Add_Tj(*core.MakeStringFromBytes(font.Encoder().Encode(option)))
+			cc.Add_ET().Add_Q()
+		}
+		cc.Add_Q().Add_EMC()
+	})
+}
+
+// textWidth returns the width of `text` in `font` at `size`.
+func textWidth(font *model.PdfFont, text string, size float64) float64 {
+	var width float64
+	for _, r := range text {
+		if metrics, ok := font.GetRuneMetrics(r); ok {
+			width += metrics.Wx
+		}
+	}
+	return width * size / 1000
+}
+
+// fitSize returns the largest font size, up to 12, at which `lines` of `font` fit in a box of
+// `width` by `height`.
+func fitSize(font *model.PdfFont, lines []string, width, height float64) float64 {
+	size := math.Min(12, 0.7*height/float64(len(lines)))
+	for _, line := range lines {
+		if w := textWidth(font, line, size); w > width && w > 0 {
+			size *= width / w
+		}
+	}
+	return size
+}
+
+// setColor sets the fill or stroke color `c` of `cc`, black if nil.
+func setColor(cc *contentstream.ContentCreator, c []float64, stroke bool) {
+	switch {
+	case len(c) == 3 && stroke:
+		cc.Add_RG(c[0], c[1], c[2])
+	case len(c) == 3:
+		cc.Add_rg(c[0], c[1], c[2])
+	case stroke:
+		cc.Add_G(0)
+	default:
+		cc.Add_g(0)
+	}
+}
+
+// colorOperator returns the operator setting the text color `c` in a default appearance, black if
+// nil.
+func colorOperator(c []float64) string {
+	if c == nil {
+		return "0 g"
+	}
+	return fmt.Sprintf("%s %s %s rg", formatNumber(c[0]), formatNumber(c[1]), formatNumber(c[2]))
+}
+
+// formatNumber returns `v` rounded to 3 decimals without trailing zeros.
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
@@ -0,0 +1,374 @@
+/*
+ * Export of the form spec of the fields of a PDF.
+ */
+
+package design
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/unidoc/unipdf/v3/contentstream"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Export returns the form spec of the fields of the document loaded by `pdfReader`, with the page
+// size of its first page and its page count. Fields with several widgets other than radio groups
+// are exported with their first widget, radio groups on the page of their first button. Tab keys
+// are the positions of the widgets among the widgets of their pages. Fonts other than the standard
+// 14 fonts are exported as the default font.
+func Export(pdfReader *model.PdfReader) (*Spec, error) {
+	spec := &Spec{Pages: len(pdfReader.PageList), Fields: []*Field{}}
+	if len(pdfReader.PageList) > 0 {
+		if box, err := pdfReader.PageList[0].GetMediaBox(); err == nil {
+			spec.PageSize = []float64{round(box.Width()), round(box.Height())}
+		}
+	}
+
+	var fields []*model.PdfField
+	isWidget := map[core.PdfObject]bool{}
+	if form := pdfReader.AcroForm; form != nil {
+		for _, field := range form.AllFields() {
+			if !field.IsTerminal() {
+				continue
+			}
+			fields = append(fields, field)
+			for _, w := range widgets(field) {
+				isWidget[w.GetContainingPdfObject()] = true
+			}
+		}
+	}
+
+	// The page and tab key of the widgets by their objects.
+	type position struct{ page, tab int }
+	positions := map[core.PdfObject]position{}
+	for i, page := range pdfReader.PageList {
+		annots, err := page.GetAnnotations()
+		if err != nil {
+			return nil, err
+		}
+		tab := 0
+		for _, a := range annots {
+			_, ok := a.GetContext().(*model.PdfAnnotationWidget)
+			if obj := a.GetContainingPdfObject(); ok || isWidget[obj] {
+				tab++
+				positions[obj] = position{page: i + 1, tab: tab}
+			}
+		}
+	}
+
+	for _, field := range fields {
+		widgets := widgets(field)
+		if len(widgets) == 0 {
+			continue
+		}
+		name, err := field.FullName()
+		if err != nil {
+			return nil, err
+		}
+		f := &Field{Name: name, Tooltip: decoded(field.TU)}
+		flags := field.Flags()
+		f.Required = flags.Has(model.FieldFlagRequired)
+		f.ReadOnly = flags.Has(model.FieldFlagReadOnly)
+
+		w := widgets[0]
+		pos := positions[w.GetContainingPdfObject()]
+		f.Page, f.Tab = pos.page, pos.tab
+		f.Rect = rectOf(w.Rect)
+
+		switch ctx := field.GetContext().(type) {
+		case *model.PdfFieldText:
+			f.Type = TypeText
+			f.Multiline = flags.Has(model.FieldFlagMultiline)
+			f.Password = flags.Has(model.FieldFlagPassword)
+			f.Comb = flags.Has(model.FieldFlagComb)
+			if n, ok := core.GetIntVal(ctx.MaxLen); ok {
+				f.MaxLen = n
+			}
+			q, _ := core.GetIntVal(ctx.Q)
+			for align, v := range alignments {
+				if align != "" && align != "left" && int64(q) == v {
+					f.Align = align
+				}
+			}
+			f.Value = stringValue(field.V)
+		case *model.PdfFieldChoice:
+			f.Type = TypeList
+			if flags.Has(model.FieldFlagCombo) {
+				f.Type = TypeCombo
+			}
+			f.Editable = flags.Has(model.FieldFlagEdit)
+			f.MultiSelect = flags.Has(model.FieldFlagMultiSelect)
+			f.Options, f.Exports = options(ctx.Opt)
+			if arr, ok := core.GetArray(field.V); ok {
+				for _, v := range arr.Elements() {
+					f.Values = append(f.Values, stringValue(v))
+				}
+			} else {
+				f.Value = stringValue(field.V)
+			}
+		case *model.PdfFieldButton:
+			switch {
+			case ctx.IsPush():
+				f.Type = TypeButton
+				if mk, ok := core.GetDict(w.MK); ok {
+					f.Caption = decoded(mk.Get("CA"))
+				}
+				f.Action, f.URL = action(w.A)
+			case ctx.IsCheckbox():
+				f.Type = TypeCheckbox
+				f.Export = onState(w)
+				if f.Export == "Yes" {
+					f.Export = ""
+				}
+				f.Checked = nameValue(field.V) == onState(w)
+			default:
+				f.Type = TypeRadio
+				f.Rect, f.Tab = nil, 0
+				for _, bw := range widgets {
+					pos := positions[bw.GetContainingPdfObject()]
+					if f.Page == 0 || pos.page != 0 && pos.page < f.Page {
+						f.Page = pos.page
+					}
+					if f.Tab == 0 || pos.tab != 0 && pos.tab < f.Tab {
+						f.Tab = pos.tab
+					}
+					f.Buttons = append(f.Buttons, &Button{Export: onState(bw), Rect: rectOf(bw.Rect)})
+				}
+				v := nameValue(field.V)
+				for _, b := range f.Buttons {
+					if b.Export == v {
+						f.Value = v
+					}
+				}
+			}
+		case *model.PdfFieldSignature:
+			f.Type = TypeSignature
+		default:
+			continue
+		}
+		if f.Page == 0 {
+			// Not on a page.
+			continue
+		}
+		f.Style = exportStyle(pdfReader.AcroForm, field, w, f.Type)
+		spec.Fields = append(spec.Fields, f)
+	}
+	return spec, nil
+}
+
+// widgets returns the widgets of the terminal field `field`.
+func widgets(field *model.PdfField) []*model.PdfAnnotationWidget {
+	if sig, ok := field.GetContext().(*model.PdfFieldSignature); ok && len(field.Annotations) == 0 &&
+		sig.PdfAnnotationWidget != nil {
+		// Signature fields created in memory are their widget.
+		return []*model.PdfAnnotationWidget{sig.PdfAnnotationWidget}
+	}
+	return field.Annotations
+}
+
+// exportStyle returns the style of the widget `w` of `field` of the type `typ`.
+func exportStyle(form *model.PdfAcroForm, field *model.PdfField, w *model.PdfAnnotationWidget, typ string) Style {
+	var s Style
+	if mk, ok := core.GetDict(w.MK); ok {
+		s.FillColor = colorOf(mk.Get("BG"))
+		s.BorderColor = colorOf(mk.Get("BC"))
+	}
+	if bs, ok := core.GetDict(w.BS); ok {
+		if width, err := core.GetNumberAsFloat(bs.Get("W")); err == nil && s.BorderColor != "" {
+			s.BorderWidth = width
+		}
+	} else if s.BorderColor != "" {
+		s.BorderWidth = 1
+	}
+	if typ == TypeSignature {
+		return s
+	}
+
+	ops, err := contentstream.NewContentStreamParser(defaultAppearance(form, field)).Parse()
+	if err != nil {
+		return s
+	}
+	for _, op := range *ops {
+		values, err := core.GetNumbersAsFloat(op.Params)
+		switch {
+		case op.Operand == "Tf" && len(op.Params) == 2:
+			if size, err := core.GetNumberAsFloat(op.Params[1]); err == nil {
+				s.FontSize = size
+			}
+			if name, ok := core.GetName(op.Params[0]); ok && typ != TypeCheckbox && typ != TypeRadio {
+				if font := fontName(form, *name); font != "Helvetica" && font != "" {
+					s.Font = font
+				}
+			}
+		case err != nil:
+		case op.Operand == "g" && len(values) == 1, op.Operand == "rg" && len(values) == 3,
+			op.Operand == "k" && len(values) == 4:
+			if c := formatColor(values); c != "#000000" {
+				s.TextColor = c
+			}
+		}
+	}
+	return s
+}
+
+// defaultAppearance returns the default appearance of `field`, inherited from its parents or the
+// form.
+func defaultAppearance(form *model.PdfAcroForm, field *model.PdfField) string {
+	if ctx, ok := field.GetContext().(*model.PdfFieldText); ok && ctx.DA != nil {
+		return ctx.DA.String()
+	}
+	for f := field; f != nil; f = f.Parent {
+		if dict, ok := core.GetDict(f.GetContainingPdfObject()); ok {
+			if da, ok := core.GetString(dict.Get("DA")); ok {
+				return da.String()
+			}
+		}
+	}
+	if form.DA != nil {
+		return form.DA.String()
+	}
+	return ""
+}
+
+// fontName returns the name of the font with the resource name `res` in the default resources of
+// `form` if it is a standard 14 font, else "".
+func fontName(form *model.PdfAcroForm, res core.PdfObjectName) string {
+	if form.DR != nil {
+		if obj, ok := form.DR.GetFontByName(res); ok {
+			if dict, ok := core.GetDict(obj); ok {
+				if base, ok := core.GetName(dict.Get("BaseFont")); ok {
+					if _, ok := fontResources[base.String()]; ok {
+						return base.String()
+					}
+				}
+			}
+		}
+	}
+	for name, r := range fontResources {
+		if r == string(res) {
+			return name
+		}
+	}
+	return ""
+}
+
+// onState returns the name of the on state of the check box or radio button widget `w`.
+func onState(w *model.PdfAnnotationWidget) string {
+	if ap, ok := core.GetDict(w.AP); ok {
+		if n, ok := core.GetDict(ap.Get("N")); ok {
+			for _, key := range n.Keys() {
+				if key != "Off" {
+					return string(key)
+				}
+			}
+		}
+	}
+	return "Yes"
+}
+
+// action returns the spec action of the push button action `obj` and its URL, or "" if it has
+// none or another one.
+func action(obj core.PdfObject) (string, string) {
+	dict, ok := core.GetDict(obj)
+	if !ok {
+		return "", ""
+	}
+	switch nameValue(dict.Get("S")) {
+	case "ResetForm":
+		return ActionReset, ""
+	case "SubmitForm":
+		f := dict.Get("F")
+		if fs, ok := core.GetDict(f); ok {
+			f = fs.Get("F")
+		}
+		return ActionSubmit, decoded(f)
+	case "URI":
+		return ActionURL, decoded(dict.Get("URI"))
+	}
+	return "", ""
+}
+
+// options returns the options of the choice field options `opt` and their exports, nil if all
+// are the options themselves.
+func options(opt *core.PdfObjectArray) ([]string, []string) {
+	if opt == nil {
+		return nil, nil
+	}
+	var opts, exports []string
+	differ := false
+	for _, o := range opt.Elements() {
+		export, option := decoded(o), decoded(o)
+		if pair, ok := core.GetArray(o); ok && pair.Len() == 2 {
+			export, option = decoded(pair.Get(0)), decoded(pair.Get(1))
+		}
+		differ = differ || export != option
+		opts = append(opts, option)
+		exports = append(exports, export)
+	}
+	if !differ {
+		exports = nil
+	}
+	return opts, exports
+}
+
+// rectOf returns the rectangle `obj` with rounded coordinates.
+func rectOf(obj core.PdfObject) []float64 {
+	arr, ok := core.GetArray(obj)
+	if !ok {
+		return nil
+	}
+	values, err := arr.ToFloat64Array()
+	if err != nil || len(values) != 4 {
+		return nil
+	}
+	// Rectangles can be given by any two opposite corners.
+	return []float64{
+		round(math.Min(values[0], values[2])), round(math.Min(values[1], values[3])),
+		round(math.Max(values[0], values[2])), round(math.Max(values[1], values[3])),
+	}
+}
+
+// colorOf returns the color with the components `obj` as #rrggbb, or "" if it isn't one.
+func colorOf(obj core.PdfObject) string {
+	arr, ok := core.GetArray(obj)
+	if !ok {
+		return ""
+	}
+	values, err := arr.ToFloat64Array()
+	if err != nil {
+		return ""
+	}
+	return formatColor(values)
+}
+
+// decoded returns the text of the string `obj`, or "" if it isn't one.
+func decoded(obj core.PdfObject) string {
+	if s, ok := core.GetString(obj); ok {
+		return s.Decoded()
+	}
+	return ""
+}
+
+// stringValue returns the value `obj` of a field as text.
+func stringValue(obj core.PdfObject) string {
+	if name, ok := core.GetName(obj); ok {
+		return name.String()
+	}
+	return decoded(obj)
+}
+
+// nameValue returns the name `obj`, or "" if it isn't one.
+func nameValue(obj core.PdfObject) string {
+	if name, ok := core.GetName(obj); ok {
+		return name.String()
+	}
+	return ""
+}
+
+// round returns `v` rounded to 2 decimals.
+func round(v float64) float64 {
+	r, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'f', 2, 64), 64)
+	return r
+}
@@ -0,0 +1,741 @@
+/*
+ * Package fill fills PDF forms with typed values and reports the values it rejects instead of
+ * writing bad data into the fields.
+ *
+ * The values are given by full field name, e.g. decoded from JSON:
+ *
+ *   {"Name": "John Doe", "Amount": 1234.5, "Date": "2024-03-01", "Agree": true,
+ *    "Color": "Blue", "Toppings": ["Cheese", "Olives"]}
+ *
+ * The list format of fjson ([{"name": ..., "value": ...}]) is read too. Each value is checked
+ * against the field it is for:
+ *  - text fields: MaxLen, comb and multiline flags, and the format of the field's format or
+ *    keystroke action: numbers (AFNumber_Format), percentages (AFPercent_Format, bare numbers
+ *    are fractions, "25%" a percentage), dates (AFDate_FormatEx, in ISO 8601 or the field's
+ *    format) and zip codes, phone and social security numbers (AFSpecial_Format), with the range
+ *    of AFRange_Validate;
+ *  - check boxes and radio buttons: a state name or export value (Opt), true/false or Off;
+ *  - list and combo boxes: an export or display value of Opt, several for multi-select list
+ *    boxes, any text for editable combo boxes.
+ *
+ * Accepted values are stored in V (and AS or I) the way a viewer stores them: numbers without
+ * formatting, dates formatted. The fields with an AFSimple_Calculate calculation (SUM, PRD, AVG,
+ * MIN, MAX) are then recalculated in the calculation order of the form, and the appearances of
+ * the changed fields generated with the formatted values.
+ *
+ *   report, err := fill.Fill(pdfReader.AcroForm, values, fill.Options{Appearance: appearance})
+ *   for _, r := range report.Rejected { ... r.Field, r.Value, r.Reason ... }
+ *
+ * Used by pdftool fill-form and forms/pdf_form_fill_typed.go.
+ */
+
+package fill
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Values are field values by full field name: string, float64, bool, []interface{} of strings
+// for multi-select list boxes or nil to clear a field.
+type Values map[string]interface{}
+
+// LoadValues reads the values of the JSON file `path`, either an object of values by field name
+// or a list of {"name": ..., "value": ...} objects as written by fjson.
+func LoadValues(path string) (Values, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseValues(data)
+}
+
+// ParseValues parses the JSON values `data` in one of the formats of LoadValues.
+func ParseValues(data []byte) (Values, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var list []struct {
+			Name  string      `json:"name"`
+			Value interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(trimmed, &list); err != nil {
+			return nil, err
+		}
+		values := Values{}
+		for _, e := range list {
+			values[e.Name] = e.Value
+		}
+		return values, nil
+	}
+	var values Values
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Options configures Fill.
+type Options struct {
+	// Appearance generates the appearances of the changed fields, e.g.
+	// annotator.FieldAppearance{OnlyIfMissing: true, RegenerateTextFields: true}. Nil skips them.
+	Appearance model.FieldAppearanceGenerator
+	// NoCalculate skips the calculations.
+	NoCalculate bool
+	// ReadOnly allows filling read-only fields.
+	ReadOnly bool
+	// IgnoreUnknown skips the values of names that are not fields instead of rejecting them.
+	IgnoreUnknown bool
+}
+
+// Field types of the report.
+const (
+	TypeText     = "text"
+	TypeNumber   = "number"
+	TypePercent  = "percent"
+	TypeDate     = "date"
+	TypeSpecial  = "special"
+	TypeCheckbox = "checkbox"
+	TypeRadio    = "radio"
+	TypeChoice   = "choice"
+)
+
+// Result is a field value written by Fill.
+type Result struct {
+	Field string `json:"field"`
+	Type  string `json:"type"`
+	// Value is the value stored in the field.
+	Value string `json:"value"`
+	// Display is the formatted value shown by the appearance, if it differs from Value.
+	Display string `json:"display,omitempty"`
+}
+
+// Rejection is a value that Fill did not write.
+type Rejection struct {
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// Report is the result of Fill.
+type Report struct {
+	Filled     []*Result    `json:"filled"`
+	Calculated []*Result    `json:"calculated,omitempty"`
+	Rejected   []*Rejection `json:"rejected"`
+	// Missing are the required fields that have no value.
+	Missing  []string `json:"missing,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// OK returns true if no value was rejected and no required field is missing.
+func (r *Report) OK() bool {
+	return len(r.Rejected) == 0 && len(r.Missing) == 0
+}
+
+// field is a terminal field of the form.
+type field struct {
+	name    string
+	f       *model.PdfField
+	actions *actions
+	format  *format
+	// display is the formatted value of a text field, empty if it is the value.
+	display string
+	changed bool
+}
+
+// Fill fills the fields of `form` with `values` and recalculates the calculated fields. Values
+// that don't suit their fields are reported and leave the fields unchanged.
+func Fill(form *model.PdfAcroForm, values Values, opts Options) (*Report, error) {
+	if form == nil {
+		return nil, fmt.Errorf("the document has no form")
+	}
+	report := &Report{Filled: []*Result{}, Rejected: []*Rejection{}}
+	fields, byName := terminalFields(form)
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := values[name]
+		fd, ok := byName[name]
+		if !ok {
+			if !opts.IgnoreUnknown {
+				report.reject(name, value, "no such field")
+			}
+			continue
+		}
+		if fieldFlags(fd.f).Has(model.FieldFlagReadOnly) && !opts.ReadOnly {
+			report.reject(fd.name, value, "read-only field")
+			continue
+		}
+		result, err := fd.set(value)
+		if err != nil {
+			report.reject(fd.name, value, err.Error())
+			continue
+		}
+		fd.changed = true
+		report.Filled = append(report.Filled, result)
+	}
+
+	if !opts.NoCalculate {
+		if err := calculateFields(form, fields, report); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, fd := range fields {
+		if fieldFlags(fd.f).Has(model.FieldFlagRequired) && isEmpty(fd.f.V) {
+			report.Missing = append(report.Missing, fd.name)
+		}
+		if len(fd.actions.unsupported) > 0 && fd.changed {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: scripts of actions %s not evaluated",
+				fd.name, strings.Join(fd.actions.unsupported, ", ")))
+		}
+	}
+
+	if opts.Appearance != nil {
+		for _, fd := range fields {
+			if !fd.changed {
+				continue
+			}
+			if err := fd.generateAppearance(form, opts.Appearance); err != nil {
+				return nil, fmt.Errorf("%s: %w", fd.name, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// reject adds the rejection of `value` for field `name` to `r`.
+func (r *Report) reject(name string, value interface{}, reason string) {
+	r.Rejected = append(r.Rejected, &Rejection{Field: name, Value: valueString(value), Reason: reason})
+}
+
+// valueString returns `value` as given in the values.
+func valueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// terminalFields returns the terminal fields of `form` in form order, and the fields by full
+// name and by unique partial name.
+func terminalFields(form *model.PdfAcroForm) ([]*field, map[string]*field) {
+	var fields []*field
+	byName := map[string]*field{}
+	partial := map[string][]*field{}
+	for _, f := range form.AllFields() {
+		if !f.IsTerminal() {
+			continue
+		}
+		name, err := f.FullName()
+		if err != nil {
+			continue
+		}
+		a := fieldActions(f)
+		fd := &field{name: name, f: f, actions: a, format: fieldFormat(a)}
+		fields = append(fields, fd)
+		byName[name] = fd
+		partial[f.PartialName()] = append(partial[f.PartialName()], fd)
+	}
+	for name, fds := range partial {
+		if _, ok := byName[name]; !ok && len(fds) == 1 {
+			byName[name] = fds[0]
+		}
+	}
+	return fields, byName
+}
+
+// fieldFlags returns the field flags of `f`, inherited from its ancestors.
+func fieldFlags(f *model.PdfField) model.FieldFlag {
+	for ; f != nil; f = f.Parent {
+		if f.Ff != nil {
+			return model.FieldFlag(*f.Ff)
+		}
+	}
+	return model.FieldFlagClear
+}
+
+// inherited returns the entry `key` of the field dictionary of `f` or of its ancestors.
+func inherited(f *model.PdfField, key core.PdfObjectName) core.PdfObject {
+	for ; f != nil; f = f.Parent {
+		if d, ok := core.GetDict(f.GetContainingPdfObject()); ok {
+			if obj := d.Get(key); obj != nil {
+				return core.TraceToDirectObject(obj)
+			}
+		}
+	}
+	return nil
+}
+
+// isEmpty returns true if field value `v` is empty.
+func isEmpty(v core.PdfObject) bool {
+	switch t := core.TraceToDirectObject(v).(type) {
+	case nil, *core.PdfObjectNull:
+		return true
+	case *core.PdfObjectString:
+		return t.Decoded() == ""
+	case *core.PdfObjectName:
+		return *t == "" || *t == "Off"
+	case *core.PdfObjectArray:
+		return t.Len() == 0
+	}
+	return false
+}
+
+// set sets the value of `fd` to `value`.
+func (fd *field) set(value interface{}) (*Result, error) {
+	switch ctx := fd.f.GetContext().(type) {
+	case *model.PdfFieldText:
+		return fd.setText(ctx, value)
+	case *model.PdfFieldButton:
+		if ctx.IsPush() {
+			return nil, fmt.Errorf("push buttons have no value")
+		}
+		return fd.setButton(ctx, value)
+	case *model.PdfFieldChoice:
+		return fd.setChoice(ctx, value)
+	case *model.PdfFieldSignature:
+		return nil, fmt.Errorf("signature fields can't be filled")
+	}
+	return nil, fmt.Errorf("unsupported field type")
+}
+
+// setText sets the value of text field `ctx` to `value`, according to its format.
+func (fd *field) setText(ctx *model.PdfFieldText, value interface{}) (*Result, error) {
+	result := &Result{Field: fd.name, Type: TypeText}
+	var raw string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		raw = v
+	case float64:
+		raw = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return nil, fmt.Errorf("a %s field takes a string, not %T", fd.format.kind, value)
+	}
+
+	display := ""
+	if raw != "" {
+		c := fd.format.call
+		switch fd.format.kind {
+		case kindNumber, kindPercent:
+			var n float64
+			if v, ok := value.(float64); ok {
+				n = v
+			} else {
+				var err error
+				if n, err = parseNumber(raw, int(c.num(1, 0))); err != nil {
+					return nil, err
+				}
+				if fd.format.kind == kindPercent && strings.HasSuffix(strings.TrimSpace(raw), "%") {
+					n /= 100
+				}
+			}
+			if err := checkRange(n, fd.actions.validate); err != nil {
+				return nil, err
+			}
+			raw = rawNumber(n)
+			if fd.format.kind == kindNumber {
+				result.Type, display = TypeNumber, formatNumber(n, c)
+			} else {
+				result.Type, display = TypePercent, formatPercent(n, c)
+			}
+		case kindDate:
+			layout := dateFormat(c)
+			t, err := parseDate(raw, layout)
+			if err != nil {
+				return nil, err
+			}
+			result.Type, raw = TypeDate, t.Format(goLayout(layout))
+		case kindSpecial:
+			formatted, err := formatSpecial(raw, c)
+			if err != nil {
+				return nil, err
+			}
+			result.Type, display = TypeSpecial, formatted
+			raw = strings.Map(func(r rune) rune {
+				if r >= '0' && r <= '9' {
+					return r
+				}
+				return -1
+			}, raw)
+		}
+	}
+
+	flags := fieldFlags(fd.f)
+	if strings.ContainsAny(raw, "\r\n") && !flags.Has(model.FieldFlagMultiline) {
+		return nil, fmt.Errorf("line breaks in a single line field")
+	}
+	maxLen, ok := core.GetIntVal(inherited(fd.f, "MaxLen"))
+	if ctx.MaxLen != nil {
+		maxLen, ok = int(*ctx.MaxLen), true
+	}
+	if ok {
+		if n := len([]rune(raw)); n > maxLen {
+			if flags.Has(model.FieldFlagComb) {
+				return nil, fmt.Errorf("%d characters for %d comb cells", n, maxLen)
+			}
+			return nil, fmt.Errorf("%d characters exceed the maximum length %d", n, maxLen)
+		}
+	}
+
+	ctx.V = makeString(raw)
+	if display == raw {
+		display = ""
+	}
+	fd.display = display
+	result.Value, result.Display = raw, display
+	return result, nil
+}
+
+// rawNumber returns `v` as stored in a number field, rounded to hide binary floating point
+// artifacts.
+func rawNumber(v float64) string {
+	v = math.Round(v*1e9) / 1e9
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// buttonStates returns the on state of each widget of `fd`, empty if it has none.
+func (fd *field) buttonStates() []string {
+	states := make([]string, len(fd.f.Annotations))
+	for i, w := range fd.f.Annotations {
+		ap, ok := core.GetDict(w.AP)
+		if !ok {
+			continue
+		}
+		n, ok := core.GetDict(ap.Get("N"))
+		if !ok {
+			continue
+		}
+		for _, key := range n.Keys() {
+			if key != "Off" {
+				states[i] = string(key)
+				break
+			}
+		}
+	}
+	return states
+}
+
+// setButton sets check box or radio button field `ctx` to `value`: a state name, an export value
+// of Opt, a boolean or Off.
+func (fd *field) setButton(ctx *model.PdfFieldButton, value interface{}) (*Result, error) {
+	result := &Result{Field: fd.name, Type: TypeCheckbox}
+	if ctx.IsRadio() {
+		result.Type = TypeRadio
+	}
+	states := fd.buttonStates()
+	var distinct []string
+	for _, s := range states {
+		if s != "" && !contains(distinct, s) {
+			distinct = append(distinct, s)
+		}
+	}
+	var exports []string
+	if ctx.Opt != nil {
+		for _, obj := range ctx.Opt.Elements() {
+			if s, ok := core.GetString(obj); ok {
+				exports = append(exports, s.Decoded())
+			}
+		}
+	}
+
+	state := ""
+	switch v := value.(type) {
+	case nil:
+		state = "Off"
+	case bool:
+		switch {
+		case !v:
+			state = "Off"
+		case len(distinct) == 1:
+			state = distinct[0]
+		default:
+			return nil, fmt.Errorf("true is ambiguous for the states %s", strings.Join(distinct, ", "))
+		}
+	case string:
+		switch {
+		case v == "" || v == "Off":
+			state = "Off"
+		case contains(distinct, v):
+			state = v
+		case indexOf(exports, v) >= 0 && indexOf(exports, v) < len(states) && states[indexOf(exports, v)] != "":
+			state = states[indexOf(exports, v)]
+		case len(distinct) == 1 && isTrue(v) && result.Type == TypeCheckbox:
+			state = distinct[0]
+		case isFalse(v) && result.Type == TypeCheckbox:
+			state = "Off"
+		default:
+			return nil, fmt.Errorf("not one of the values %s", strings.Join(append(distinct, exports...), ", "))
+		}
+	default:
+		return nil, fmt.Errorf("a %s takes a string or boolean, not %T", result.Type, value)
+	}
+
+	ctx.V = core.MakeName(state)
+	for i, w := range fd.f.Annotations {
+		if states[i] == state {
+			w.AS = core.MakeName(state)
+		} else {
+			w.AS = core.MakeName("Off")
+		}
+	}
+	result.Value = state
+	return result, nil
+}
+
+// isTrue returns true if `s` is a common spelling of a checked check box.
+func isTrue(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "yes", "on", "1", "x", "checked":
+		return true
+	}
+	return false
+}
+
+// isFalse returns true if `s` is a common spelling of an unchecked check box.
+func isFalse(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "false", "no", "off", "0", "unchecked":
+		return true
+	}
+	return false
+}
+
+// choiceOptions returns the export and display values of the options of choice field `ctx`.
+func choiceOptions(ctx *model.PdfFieldChoice) (exports, displays []string) {
+	if ctx.Opt == nil {
+		return nil, nil
+	}
+	for _, obj := range ctx.Opt.Elements() {
+		switch t := core.TraceToDirectObject(obj).(type) {
+		case *core.PdfObjectString:
+			exports = append(exports, t.Decoded())
+			displays = append(displays, t.Decoded())
+		case *core.PdfObjectArray:
+			if t.Len() == 2 {
+				e, _ := core.GetString(t.Get(0))
+				d, _ := core.GetString(t.Get(1))
+				if e != nil && d != nil {
+					exports = append(exports, e.Decoded())
+					displays = append(displays, d.Decoded())
+				}
+			}
+		}
+	}
+	return exports, displays
+}
+
+// setChoice sets list or combo box field `ctx` to `value`: an export or display value, a list of
+// them for multi-select list boxes, or any text for editable combo boxes.
+func (fd *field) setChoice(ctx *model.PdfFieldChoice, value interface{}) (*Result, error) {
+	result := &Result{Field: fd.name, Type: TypeChoice}
+	flags := fieldFlags(fd.f)
+	exports, displays := choiceOptions(ctx)
+
+	var selected []string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		if v != "" {
+			selected = []string{v}
+		}
+	case float64:
+		selected = []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		if len(v) > 1 && !flags.Has(model.FieldFlagMultiSelect) {
+			return nil, fmt.Errorf("%d values for a single selection", len(v))
+		}
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("a list of %T, not of strings", e)
+			}
+			selected = append(selected, s)
+		}
+	default:
+		return nil, fmt.Errorf("a choice takes a string or a list of strings, not %T", value)
+	}
+
+	var values []string
+	var indices []int
+	for _, s := range selected {
+		i := indexOf(exports, s)
+		if i < 0 {
+			i = indexOf(displays, s)
+		}
+		switch {
+		case i >= 0:
+			values = append(values, exports[i])
+			indices = append(indices, i)
+		case flags.Has(model.FieldFlagCombo) && flags.Has(model.FieldFlagEdit):
+			values = append(values, s)
+		default:
+			return nil, fmt.Errorf("%q is not one of the options %s", s, strings.Join(exports, ", "))
+		}
+	}
+	sort.Ints(indices)
+	if len(indices) == len(values) {
+		// Selected options in the order of the options.
+		for i, index := range indices {
+			values[i] = exports[index]
+		}
+	}
+
+	switch len(values) {
+	case 0:
+		ctx.V = makeString("")
+	case 1:
+		ctx.V = makeString(values[0])
+	default:
+		arr := core.MakeArray()
+		for _, v := range values {
+			arr.Append(makeString(v))
+		}
+		ctx.V = arr
+	}
+	ctx.I = nil
+	if flags.Has(model.FieldFlagMultiSelect) && len(indices) > 0 {
+		ctx.I = core.MakeArrayFromIntegers(indices)
+	}
+	result.Value = strings.Join(values, ", ")
+	return result, nil
+}
+
+// calculateFields recalculates the fields of `fields` with an AFSimple_Calculate calculation,
+// first in the calculation order CO of `form`, then in form order.
+func calculateFields(form *model.PdfAcroForm, fields []*field, report *Report) error {
+	var order []*field
+	seen := map[*field]bool{}
+	if form.CO != nil {
+		byObject := map[core.PdfObject]*field{}
+		for _, fd := range fields {
+			byObject[fd.f.GetContainingPdfObject()] = fd
+		}
+		for _, obj := range form.CO.Elements() {
+			if ref, ok := obj.(*core.PdfObjectReference); ok {
+				obj = ref.Resolve()
+			}
+			if fd, ok := byObject[obj]; ok && !seen[fd] {
+				order = append(order, fd)
+				seen[fd] = true
+			}
+		}
+	}
+	for _, fd := range fields {
+		if !seen[fd] && fd.actions.calculate != nil {
+			order = append(order, fd)
+		}
+	}
+
+	for _, fd := range order {
+		fn, operands, ok := calculation(fd.actions.calculate)
+		if !ok {
+			if fd.actions.calculate != nil {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s: calculation %s not supported",
+					fd.name, fd.actions.calculate.name))
+			}
+			continue
+		}
+		var nums []float64
+		for _, name := range operands {
+			for _, op := range fields {
+				if op.name != name && !strings.HasPrefix(op.name, name+".") {
+					continue
+				}
+				n, err := op.number()
+				if err != nil {
+					report.Warnings = append(report.Warnings, fmt.Sprintf("%s: operand %s: %v", fd.name, op.name, err))
+					continue
+				}
+				nums = append(nums, n)
+			}
+		}
+		v, err := calculate(fn, nums)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: %v", fd.name, err))
+			continue
+		}
+		if fd.changed {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: filled value replaced by its calculation", fd.name))
+		}
+		result, err := fd.set(v)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: calculated value: %v", fd.name, err))
+			continue
+		}
+		fd.changed = true
+		report.Calculated = append(report.Calculated, result)
+	}
+	return nil
+}
+
+// number returns the numeric value of `fd` for calculations, 0 if it is empty.
+func (fd *field) number() (float64, error) {
+	s, ok := core.GetString(fd.f.V)
+	if !ok || strings.TrimSpace(s.Decoded()) == "" {
+		return 0, nil
+	}
+	// Number fields hold their values unformatted.
+	return parseNumber(s.Decoded(), 0)
+}
+
+// makeString returns the PDF text string of `s`, in PDFDocEncoding if it is ASCII and else in
+// UTF-16BE.
+func makeString(s string) *core.PdfObjectString {
+	for _, r := range s {
+		if r >= 0x80 {
+			return core.MakeEncodedString(s, true)
+		}
+	}
+	return core.MakeEncodedString(s, false)
+}
+
+// generateAppearance generates the appearances of the widgets of `fd` with `appGen`, showing the
+// formatted value.
+func (fd *field) generateAppearance(form *model.PdfAcroForm, appGen model.FieldAppearanceGenerator) error {
+	v := fd.f.V
+	if fd.display != "" {
+		fd.f.V = makeString(fd.display)
+		defer func() { fd.f.V = v }()
+	}
+	for _, w := range fd.f.Annotations {
+		ap, err := appGen.GenerateAppearanceDict(form, fd.f, w)
+		if err != nil {
+			return err
+		}
+		w.AP = ap
+		w.ToPdfObject()
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	return indexOf(list, s) >= 0
+}
+
+func indexOf(list []string, s string) int {
+	for i, e := range list {
+		if e == s {
+			return i
+		}
+	}
+	return -1
+}
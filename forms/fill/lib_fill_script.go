@@ -0,0 +1,618 @@
+/*
+ * The Acrobat form scripts of the field actions: parsing of the calls of the AForm.js functions
+ * (AFNumber_Format, AFPercent_Format, AFDate_FormatEx, AFSpecial_Format, AFRange_Validate and
+ * AFSimple_Calculate) and the formatting they do.
+ */
+
+package fill
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// call is a call of an AForm.js function in a field action script.
+type call struct {
+	name string
+	// args are the arguments: string, float64, bool or []interface{} for new Array(...).
+	args []interface{}
+}
+
+// str returns argument `i` of `c` as a string, `def` if it is missing.
+func (c *call) str(i int, def string) string {
+	if i < len(c.args) {
+		switch v := c.args[i].(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return def
+}
+
+// num returns argument `i` of `c` as a number, `def` if it is missing.
+func (c *call) num(i int, def float64) float64 {
+	if i < len(c.args) {
+		switch v := c.args[i].(type) {
+		case float64:
+			return v
+		case bool:
+			if v {
+				return 1
+			}
+			return 0
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f
+			}
+		}
+	}
+	return def
+}
+
+// boolean returns argument `i` of `c` as a boolean, `def` if it is missing.
+func (c *call) boolean(i int, def bool) bool {
+	if i < len(c.args) {
+		switch v := c.args[i].(type) {
+		case bool:
+			return v
+		case float64:
+			return v != 0
+		}
+	}
+	return def
+}
+
+// actions are the scripts of the additional actions of a field that matter for filling.
+type actions struct {
+	format    *call // F: AFNumber_Format, AFPercent_Format, AFDate_FormatEx, AFSpecial_Format.
+	keystroke *call // K: the *_Keystroke counterpart, used if there is no format.
+	validate  *call // V: AFRange_Validate.
+	calculate *call // C: AFSimple_Calculate.
+	// unsupported are the names of the scripts that are not calls of AForm.js functions.
+	unsupported []string
+}
+
+// fieldActions returns the actions of `field`, from the field and its widgets.
+func fieldActions(field *model.PdfField) *actions {
+	a := &actions{}
+	dicts := []core.PdfObject{field.AA}
+	for _, w := range field.Annotations {
+		dicts = append(dicts, w.AA)
+	}
+	for _, obj := range dicts {
+		aa, ok := core.GetDict(obj)
+		if !ok {
+			continue
+		}
+		for _, key := range []core.PdfObjectName{"F", "K", "V", "C"} {
+			script, ok := actionScript(aa.Get(key))
+			if !ok || strings.TrimSpace(script) == "" {
+				continue
+			}
+			c := parseCall(script)
+			if c == nil {
+				a.unsupported = append(a.unsupported, string(key))
+				continue
+			}
+			switch key {
+			case "F":
+				a.format = c
+			case "K":
+				a.keystroke = c
+			case "V":
+				a.validate = c
+			case "C":
+				a.calculate = c
+			}
+		}
+	}
+	return a
+}
+
+// actionScript returns the JavaScript of action `obj`.
+func actionScript(obj core.PdfObject) (string, bool) {
+	action, ok := core.GetDict(obj)
+	if !ok {
+		return "", false
+	}
+	if s, ok := core.GetName(action.Get("S")); !ok || *s != "JavaScript" {
+		return "", false
+	}
+	switch js := core.TraceToDirectObject(action.Get("JS")).(type) {
+	case *core.PdfObjectString:
+		return js.Decoded(), true
+	case *core.PdfObjectStream:
+		data, err := core.DecodeStream(js)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	}
+	return "", false
+}
+
+// parseCall parses `script`, which must be a single call of an AForm.js function such as
+// AFNumber_Format(2, 0, 0, 0, "$", true);. It returns nil for any other script.
+func parseCall(script string) *call {
+	p := &scriptParser{s: strings.TrimSpace(script)}
+	name := p.ident()
+	if !strings.HasPrefix(name, "AF") || !p.consume('(') {
+		return nil
+	}
+	args, ok := p.list(')')
+	if !ok {
+		return nil
+	}
+	p.consume(';')
+	if p.skipSpace(); p.i != len(p.s) {
+		return nil
+	}
+	return &call{name: name, args: args}
+}
+
+// scriptParser parses the arguments of AForm.js function calls: string and number literals,
+// booleans and new Array(...).
+type scriptParser struct {
+	s string
+	i int
+}
+
+func (p *scriptParser) skipSpace() {
+	for p.i < len(p.s) && unicode.IsSpace(rune(p.s[p.i])) {
+		p.i++
+	}
+}
+
+func (p *scriptParser) consume(ch byte) bool {
+	p.skipSpace()
+	if p.i < len(p.s) && p.s[p.i] == ch {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *scriptParser) ident() string {
+	p.skipSpace()
+	start := p.i
+	for p.i < len(p.s) && (p.s[p.i] == '_' || p.s[p.i] == '.' || unicode.IsLetter(rune(p.s[p.i])) ||
+		unicode.IsDigit(rune(p.s[p.i]))) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// list parses comma separated values up to `end`.
+func (p *scriptParser) list(end byte) ([]interface{}, bool) {
+	var values []interface{}
+	if p.consume(end) {
+		return values, true
+	}
+	for {
+		v, ok := p.value()
+		if !ok {
+			return nil, false
+		}
+		values = append(values, v)
+		if p.consume(end) {
+			return values, true
+		}
+		if !p.consume(',') {
+			return nil, false
+		}
+	}
+}
+
+func (p *scriptParser) value() (interface{}, bool) {
+	p.skipSpace()
+	if p.i >= len(p.s) {
+		return nil, false
+	}
+	switch ch := p.s[p.i]; {
+	case ch == '"' || ch == '\'':
+		return p.str(ch)
+	case ch == '[':
+		p.i++
+		return p.list(']')
+	case ch == '-' || ch == '+' || ch == '.' || unicode.IsDigit(rune(ch)):
+		start := p.i
+		p.i++
+		for p.i < len(p.s) && (p.s[p.i] == '.' || unicode.IsDigit(rune(p.s[p.i]))) {
+			p.i++
+		}
+		f, err := strconv.ParseFloat(p.s[start:p.i], 64)
+		return f, err == nil
+	}
+	switch id := p.ident(); id {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	case "new":
+		if p.ident() != "Array" || !p.consume('(') {
+			return nil, false
+		}
+		return p.list(')')
+	}
+	return nil, false
+}
+
+// str parses a string literal quoted by `quote`.
+func (p *scriptParser) str(quote byte) (interface{}, bool) {
+	p.i++
+	var b strings.Builder
+	for p.i < len(p.s) {
+		ch := p.s[p.i]
+		p.i++
+		switch ch {
+		case quote:
+			return b.String(), true
+		case '\\':
+			if p.i < len(p.s) {
+				esc := p.s[p.i]
+				p.i++
+				switch esc {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case 'u':
+					if p.i+4 <= len(p.s) {
+						if r, err := strconv.ParseUint(p.s[p.i:p.i+4], 16, 32); err == nil {
+							b.WriteRune(rune(r))
+							p.i += 4
+							continue
+						}
+					}
+					b.WriteByte(esc)
+				default:
+					b.WriteByte(esc)
+				}
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return nil, false
+}
+
+// Kinds of values of the formats.
+const (
+	kindText    = "text"
+	kindNumber  = "number"
+	kindPercent = "percent"
+	kindDate    = "date"
+	kindSpecial = "special"
+)
+
+// format is the value format of a text field.
+type format struct {
+	kind string
+	call *call
+}
+
+// fieldFormat returns the format of a field with actions `a`.
+func fieldFormat(a *actions) *format {
+	for _, c := range []*call{a.format, a.keystroke} {
+		if c == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(c.name, "AFNumber_"):
+			return &format{kind: kindNumber, call: c}
+		case strings.HasPrefix(c.name, "AFPercent_"):
+			return &format{kind: kindPercent, call: c}
+		case strings.HasPrefix(c.name, "AFDate_"):
+			return &format{kind: kindDate, call: c}
+		case strings.HasPrefix(c.name, "AFSpecial_"):
+			return &format{kind: kindSpecial, call: c}
+		}
+	}
+	return &format{kind: kindText}
+}
+
+// formatNumber formats `v` like AFNumber_Format(nDec, sepStyle, negStyle, currStyle,
+// strCurrency, bCurrencyPrepend). Red negative styles keep the minus sign as colors are not
+// applied.
+func formatNumber(v float64, c *call) string {
+	nDec := int(c.num(0, 2))
+	sepStyle := int(c.num(1, 0))
+	negStyle := int(c.num(2, 0))
+	currency := c.str(4, "")
+	prepend := c.boolean(5, true)
+
+	s := groupDigits(math.Abs(v), nDec, sepStyle)
+	zero := s == groupDigits(0, nDec, sepStyle)
+	if currency != "" {
+		if prepend {
+			s = currency + s
+		} else {
+			s += currency
+		}
+	}
+	if v < 0 && !zero {
+		if negStyle == 2 || negStyle == 3 {
+			return "(" + s + ")"
+		}
+		return "-" + s
+	}
+	return s
+}
+
+// formatPercent formats `v` like AFPercent_Format(nDec, sepStyle).
+func formatPercent(v float64, c *call) string {
+	nDec := int(c.num(0, 2))
+	s := groupDigits(math.Abs(v*100), nDec, int(c.num(1, 0))) + "%"
+	if v < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// groupDigits formats `v` >= 0 with `nDec` decimals and the separators of AForm.js sepStyle
+// `sepStyle`: 0 1,234.56, 1 1234.56, 2 1.234,56, 3 1234,56, 4 1'234.56.
+func groupDigits(v float64, nDec, sepStyle int) string {
+	if nDec < 0 {
+		nDec = 0
+	}
+	// Round half away from zero like toFixed, not to even.
+	scale := math.Pow(10, float64(nDec))
+	s := strconv.FormatFloat(math.Round(v*scale)/scale, 'f', nDec, 64)
+	intPart, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, frac = s[:i], s[i+1:]
+	}
+	group, decimal := ",", "."
+	switch sepStyle {
+	case 1:
+		group = ""
+	case 2:
+		group, decimal = ".", ","
+	case 3:
+		group, decimal = "", ","
+	case 4:
+		group = "'"
+	}
+	if group != "" {
+		var b strings.Builder
+		for i, ch := range intPart {
+			if i > 0 && (len(intPart)-i)%3 == 0 {
+				b.WriteString(group)
+			}
+			b.WriteRune(ch)
+		}
+		intPart = b.String()
+	}
+	if frac == "" {
+		return intPart
+	}
+	return intPart + decimal + frac
+}
+
+// parseNumber parses the number `s`, as typed or as formatted with sepStyle `sepStyle`: digit
+// group separators, currency symbols, percent signs and parentheses for negative numbers are
+// accepted.
+func parseNumber(s string, sepStyle int) (float64, error) {
+	t := strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(t, "(") && strings.HasSuffix(t, ")") {
+		negative, t = true, t[1:len(t)-1]
+	}
+	var b strings.Builder
+	for _, ch := range t {
+		switch {
+		case unicode.IsDigit(ch):
+			b.WriteRune(ch)
+		case ch == '-' || ch == '+':
+			b.WriteRune(ch)
+		case ch == '.' || ch == ',':
+			decimal := ch == '.'
+			if sepStyle == 2 || sepStyle == 3 {
+				decimal = ch == ','
+			}
+			if decimal {
+				b.WriteByte('.')
+			} else if sepStyle == 1 || sepStyle == 3 {
+				return 0, fmt.Errorf("%q is not a number", s)
+			}
+		case ch == '\'' || ch == ' ' || ch == '%' || unicode.Is(unicode.Sc, ch):
+			// Group separators and currency and percent signs.
+		default:
+			return 0, fmt.Errorf("%q is not a number", s)
+		}
+	}
+	v, err := strconv.ParseFloat(b.String(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if negative {
+		v = -v
+	}
+	return v, nil
+}
+
+// dateFormats are the formats of AFDate_Format(index).
+var dateFormats = []string{
+	"m/d", "m/d/yy", "mm/dd/yy", "mm/yy", "d-mmm", "d-mmm-yy", "dd-mmm-yy", "yy-mm-dd",
+	"mmm-yy", "mmmm-yy", "mmm d, yyyy", "mmmm d, yyyy", "m/d/yy h:MM tt", "m/d/yy HH:MM",
+}
+
+// dateFormat returns the AForm.js date format of `c`.
+func dateFormat(c *call) string {
+	if strings.HasSuffix(c.name, "Ex") {
+		return c.str(0, "mm/dd/yyyy")
+	}
+	if i := int(c.num(0, 2)); i >= 0 && i < len(dateFormats) {
+		return dateFormats[i]
+	}
+	return "mm/dd/yyyy"
+}
+
+// dateTokens maps the tokens of AForm.js date formats to Go layout elements, longest first.
+var dateTokens = []struct{ token, layout string }{
+	{"yyyy", "2006"}, {"yy", "06"},
+	{"mmmm", "January"}, {"mmm", "Jan"}, {"mm", "01"}, {"m", "1"},
+	{"dddd", "Monday"}, {"ddd", "Mon"}, {"dd", "02"}, {"d", "2"},
+	{"HH", "15"}, {"H", "15"}, {"hh", "03"}, {"h", "3"},
+	{"MM", "04"}, {"M", "4"}, {"ss", "05"}, {"s", "5"}, {"tt", "PM"},
+}
+
+// goLayout returns the Go time layout of AForm.js date format `f`.
+func goLayout(f string) string {
+	var b strings.Builder
+	for i := 0; i < len(f); {
+		matched := false
+		for _, t := range dateTokens {
+			if strings.HasPrefix(f[i:], t.token) {
+				b.WriteString(t.layout)
+				i += len(t.token)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteByte(f[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// inputLayouts are the layouts of the dates accepted besides the format of the field.
+var inputLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseDate parses the date `s`, in ISO 8601 form or in AForm.js format `f`.
+func parseDate(s, f string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range append(inputLayouts, goLayout(f)) {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date in ISO 8601 or %q format", s, f)
+}
+
+// formatSpecial formats the digits of `s` like AFSpecial_Format(psf): 0 zip code, 1 zip+4,
+// 2 phone number, 3 social security number.
+func formatSpecial(s string, c *call) (string, error) {
+	var digits strings.Builder
+	for _, ch := range s {
+		switch {
+		case unicode.IsDigit(ch):
+			digits.WriteRune(ch)
+		case strings.ContainsRune(" -().+", ch):
+		default:
+			return "", fmt.Errorf("%q contains %q", s, ch)
+		}
+	}
+	d := digits.String()
+	switch psf := int(c.num(0, 0)); psf {
+	case 0:
+		if len(d) == 5 {
+			return d, nil
+		}
+		return "", fmt.Errorf("%q is not a 5 digit zip code", s)
+	case 1:
+		if len(d) == 9 {
+			return d[:5] + "-" + d[5:], nil
+		}
+		return "", fmt.Errorf("%q is not a 9 digit zip+4 code", s)
+	case 2:
+		switch len(d) {
+		case 7:
+			return d[:3] + "-" + d[3:], nil
+		case 10:
+			return "(" + d[:3] + ") " + d[3:6] + "-" + d[6:], nil
+		}
+		return "", fmt.Errorf("%q is not a 7 or 10 digit phone number", s)
+	case 3:
+		if len(d) == 9 {
+			return d[:3] + "-" + d[3:5] + "-" + d[5:], nil
+		}
+		return "", fmt.Errorf("%q is not a 9 digit social security number", s)
+	default:
+		return s, nil
+	}
+}
+
+// checkRange checks `v` against AFRange_Validate(bGreaterThan, nGreaterThan, bLessThan,
+// nLessThan).
+func checkRange(v float64, c *call) error {
+	if c == nil || c.name != "AFRange_Validate" {
+		return nil
+	}
+	min, max := c.num(1, 0), c.num(3, 0)
+	switch {
+	case c.boolean(0, false) && c.boolean(2, false) && (v < min || v > max):
+		return fmt.Errorf("%v is not between %v and %v", v, min, max)
+	case c.boolean(0, false) && v < min:
+		return fmt.Errorf("%v is less than %v", v, min)
+	case c.boolean(2, false) && v > max:
+		return fmt.Errorf("%v is greater than %v", v, max)
+	}
+	return nil
+}
+
+// calculation returns the function and the operand field names of AFSimple_Calculate call `c`.
+func calculation(c *call) (string, []string, bool) {
+	if c == nil || c.name != "AFSimple_Calculate" || len(c.args) < 2 {
+		return "", nil, false
+	}
+	var names []string
+	switch v := c.args[1].(type) {
+	case string:
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if name, ok := e.(string); ok {
+				names = append(names, strings.TrimSpace(name))
+			}
+		}
+	}
+	return strings.ToUpper(c.str(0, "")), names, true
+}
+
+// calculate applies the AFSimple_Calculate function `fn` (SUM, PRD, AVG, MIN or MAX) to `values`.
+func calculate(fn string, values []float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, nil
+	}
+	result := values[0]
+	switch fn {
+	case "SUM", "AVG":
+		for _, v := range values[1:] {
+			result += v
+		}
+		if fn == "AVG" {
+			result /= float64(len(values))
+		}
+	case "PRD":
+		for _, v := range values[1:] {
+			result *= v
+		}
+	case "MIN":
+		for _, v := range values[1:] {
+			result = math.Min(result, v)
+		}
+	case "MAX":
+		for _, v := range values[1:] {
+			result = math.Max(result, v)
+		}
+	default:
+		return 0, fmt.Errorf("unsupported calculation %q", fn)
+	}
+	return result, nil
+}
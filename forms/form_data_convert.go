@@ -0,0 +1,50 @@
+/*
+ * Convert form data between XFDF, FDF and JSON. The formats are chosen by the file extensions
+ * .xfdf, .fdf and .json. FDF and JSON hold the field values only, the annotations of XFDF input
+ * are dropped when converting to them.
+ *
+ * Run as: go run form_data_convert.go input.fdf output.xfdf
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/unidoc/unipdf/v3/common/license"
+
+	"github.com/unidoc/unidoc-examples/forms/xfdf"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Printf("Convert form data between XFDF, FDF and JSON\n")
+		fmt.Printf("Usage: go run form_data_convert.go input.(xfdf|fdf|json) output.(xfdf|fdf|json)\n")
+		os.Exit(1)
+	}
+	inputPath, outputPath := os.Args[1], os.Args[2]
+
+	doc, err := xfdf.Load(inputPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = doc.Save(outputPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d field(s) written to %s\n", len(doc.Fields), outputPath)
+}
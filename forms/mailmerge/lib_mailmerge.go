@@ -0,0 +1,445 @@
+/*
+ * Package mailmerge fills one PDF form template with many records, e.g. one per customer of a CSV
+ * export. The records are filled concurrently with forms/fill, optionally flattened, and written
+ * either to one file per record, named from a pattern of record values, or concatenated into one
+ * PDF with an outline entry per record.
+ *
+ * The template file is read into memory once, but it is parsed again for every record on purpose:
+ * filling and flattening change the parsed objects in place and unipdf has no deep copy of a
+ * document, so a parsed template cannot be shared between records. Parsing from memory costs no
+ * I/O and is small next to filling, flattening and writing a record.
+ *
+ *   records, err := mailmerge.LoadRecords("customers.csv")
+ *   tmpl, err := mailmerge.LoadTemplate("invoice.pdf", "")
+ *   results, err := mailmerge.Files(tmpl, records, "out", "{Region}/{Name}-{#}.pdf", opts)
+ *
+ * Patterns replace {name} by the value of the record for name and {#} by the record number,
+ * starting at 1. Record values that are not fields of the form can be used in patterns only.
+ *
+ * Used by pdftool mail-merge and forms/pdf_form_mail_merge.go.
+ */
+
+package mailmerge
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/forms/fill"
+	"github.com/unidoc/unidoc-examples/pages/merge"
+)
+
+// LoadRecords reads the records of the file `path`: CSV with the field names in the header row
+// if its name ends with .csv, otherwise a JSON array of records as parsed by ParseRecords.
+func LoadRecords(path string) ([]fill.Values, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ReadCSV(bytes.NewReader(data))
+	}
+	return ParseRecords(data)
+}
+
+// ReadCSV reads CSV records from `r`. The first row holds the field names; empty cells leave
+// their fields unchanged.
+func ReadCSV(r io.Reader) ([]fill.Values, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	var records []fill.Values
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		values := fill.Values{}
+		for i, cell := range row {
+			if cell != "" && header[i] != "" {
+				values[header[i]] = cell
+			}
+		}
+		records = append(records, values)
+	}
+}
+
+// ParseRecords parses a JSON array of records, each in one of the formats of fill.ParseValues.
+func ParseRecords(data []byte) ([]fill.Values, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	records := make([]fill.Values, len(raw))
+	for i, r := range raw {
+		values, err := fill.ParseValues(r)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		records[i] = values
+	}
+	return records, nil
+}
+
+// Template is a PDF form loaded into memory.
+type Template struct {
+	data     []byte
+	password string
+}
+
+// LoadTemplate reads the PDF form at `path`, decrypted with `password` if it is encrypted.
+func LoadTemplate(path, password string) (*Template, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{data: data, password: password}
+	pdfReader, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	if pdfReader.AcroForm == nil {
+		return nil, fmt.Errorf("%s has no form", path)
+	}
+	return t, nil
+}
+
+// open parses a new document from the template. Every record needs a document of its own as
+// filling and flattening change the document objects; see the package doc.
+func (t *Template) open() (*model.PdfReader, error) {
+	pdfReader, err := model.NewPdfReader(bytes.NewReader(t.data))
+	if err != nil {
+		return nil, err
+	}
+	isEncrypted, err := pdfReader.IsEncrypted()
+	if err != nil {
+		return nil, err
+	}
+	if isEncrypted {
+		auth, err := pdfReader.Decrypt([]byte(t.password))
+		if err != nil {
+			return nil, err
+		}
+		if !auth {
+			return nil, errors.New("wrong password")
+		}
+	}
+	return pdfReader, nil
+}
+
+// Options configures Files and Concatenate.
+type Options struct {
+	// Appearance generates the field appearances. Nil uses
+	// annotator.FieldAppearance{OnlyIfMissing: true, RegenerateTextFields: true}.
+	Appearance model.FieldAppearanceGenerator
+	// Flatten flattens the filled fields into the page content.
+	Flatten bool
+	// NoCalculate skips the calculated fields.
+	NoCalculate bool
+	// Strict fails the records with rejected values or missing required fields.
+	Strict bool
+	// Workers is the number of records filled concurrently. Default: the number of CPUs.
+	Workers int
+	// Progress, if not nil, is called after each record.
+	Progress func(done, total int, res *Result)
+}
+
+// Result is the outcome of one record.
+type Result struct {
+	// Record is the record number, starting at 1.
+	Record int `json:"record"`
+	// Output is the output path for Files, the outline title for Concatenate.
+	Output string       `json:"output,omitempty"`
+	Report *fill.Report `json:"report,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// OK returns true if the record was written.
+func (r *Result) OK() bool {
+	return r.Error == ""
+}
+
+// Files fills the template `t` with each of `records` and writes the results to `dir`, at the
+// paths given by `pattern` (default "{#}.pdf"). The results are in the order of `records`; the
+// error is only non-nil if nothing could be started.
+func Files(t *Template, records []fill.Values, dir, pattern string, opts Options) ([]*Result, error) {
+	if pattern == "" {
+		pattern = "{#}.pdf"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	results := newResults(records)
+	used := map[string]int{}
+	for i, values := range records {
+		name, err := expand(pattern, i+1, values, cleanName)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		outputPath := filepath.Join(dir, name)
+		if prev, ok := used[outputPath]; ok {
+			results[i].Error = fmt.Sprintf("output %s is the output of record %d too", outputPath, prev)
+			continue
+		}
+		used[outputPath] = i + 1
+		results[i].Output = outputPath
+	}
+
+	run(t, records, results, opts, func(i int, pdfReader *model.PdfReader) error {
+		if err := os.MkdirAll(filepath.Dir(results[i].Output), 0755); err != nil {
+			return err
+		}
+		pdfWriter, err := pdfReader.ToWriter(nil)
+		if err != nil {
+			return err
+		}
+		return pdfWriter.WriteToFile(results[i].Output)
+	})
+	return results, nil
+}
+
+// Concatenate fills the template `t` with each of `records` and writes the results, in the order
+// of `records`, to the PDF `outputPath` with an outline entry per record titled by `pattern`
+// (default "{#}"). The fields of the second and later records are renamed as by pages/merge
+// unless they are flattened. All filled documents are kept in memory until they are written.
+// The results are returned with the error if the output could not be written.
+func Concatenate(t *Template, records []fill.Values, outputPath, pattern string, opts Options) ([]*Result, error) {
+	if pattern == "" {
+		pattern = "{#}"
+	}
+	results := newResults(records)
+	for i, values := range records {
+		title, err := expand(pattern, i+1, values, strings.TrimSpace)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Output = title
+	}
+
+	readers := make([]*model.PdfReader, len(records))
+	run(t, records, results, opts, func(i int, pdfReader *model.PdfReader) error {
+		readers[i] = pdfReader
+		return nil
+	})
+
+	var (
+		filled  []*model.PdfReader
+		outline = model.NewOutline()
+		pageNum int
+	)
+	for i, pdfReader := range readers {
+		if pdfReader == nil || !results[i].OK() {
+			continue
+		}
+		page, err := pdfReader.GetPage(1)
+		if err != nil {
+			return results, err
+		}
+		numPages, err := pdfReader.GetNumPages()
+		if err != nil {
+			return results, err
+		}
+		outline.Add(model.NewOutlineItem(results[i].Output, model.OutlineDest{
+			PageObj: page.GetPageAsIndirectObject(),
+			Page:    int64(pageNum),
+			Mode:    "Fit",
+		}))
+		pageNum += numPages
+		filled = append(filled, pdfReader)
+	}
+	if len(filled) == 0 {
+		return results, errors.New("no record was filled")
+	}
+
+	pdfWriter, err := merge.Documents(filled...)
+	if err != nil {
+		return results, err
+	}
+	pdfWriter.AddOutlineTree(outline.ToOutlineTree())
+	return results, pdfWriter.WriteToFile(outputPath)
+}
+
+// newResults returns the empty results of `records`.
+func newResults(records []fill.Values) []*Result {
+	results := make([]*Result, len(records))
+	for i := range results {
+		results[i] = &Result{Record: i + 1}
+	}
+	return results
+}
+
+// run fills the template `t` with the `records` whose results have no error yet, concurrently,
+// and passes the filled documents to `write`.
+func run(t *Template, records []fill.Values, results []*Result, opts Options,
+	write func(i int, pdfReader *model.PdfReader) error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var (
+		mu   sync.Mutex
+		done int
+	)
+	finish := func(i int) {
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		if opts.Progress != nil {
+			opts.Progress(done, len(records), results[i])
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := fillRecord(t, records[i], results[i], opts, func(pdfReader *model.PdfReader) error {
+					return write(i, pdfReader)
+				}); err != nil {
+					results[i].Error = err.Error()
+				}
+				finish(i)
+			}
+		}()
+	}
+	for i := range records {
+		if !results[i].OK() {
+			finish(i)
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// fillRecord fills a new document of the template `t` with `values` and passes it to `write`.
+func fillRecord(t *Template, values fill.Values, res *Result, opts Options,
+	write func(pdfReader *model.PdfReader) error) error {
+	pdfReader, err := t.open()
+	if err != nil {
+		return err
+	}
+
+	appearance := opts.Appearance
+	if appearance == nil {
+		appearance = annotator.FieldAppearance{OnlyIfMissing: true, RegenerateTextFields: true}
+	}
+	res.Report, err = fill.Fill(pdfReader.AcroForm, values, fill.Options{
+		Appearance:    appearance,
+		NoCalculate:   opts.NoCalculate,
+		IgnoreUnknown: true,
+	})
+	if err != nil {
+		return err
+	}
+	if opts.Strict && !res.Report.OK() {
+		return fmt.Errorf("%d value(s) rejected, %d required field(s) missing", len(res.Report.Rejected),
+			len(res.Report.Missing))
+	}
+
+	if opts.Flatten {
+		if err := pdfReader.FlattenFields(true, appearance); err != nil {
+			return err
+		}
+	}
+	return write(pdfReader)
+}
+
+// Expand returns `pattern` with {name} replaced by the value of `values` for name and {#} by
+// `number`.
+func Expand(pattern string, number int, values fill.Values) (string, error) {
+	return expand(pattern, number, values, func(s string) string { return s })
+}
+
+// expand is Expand with the replacements passed through `clean`.
+func expand(pattern string, number int, values fill.Values, clean func(string) string) (string, error) {
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			sb.WriteString(pattern)
+			return sb.String(), nil
+		}
+		end := strings.IndexByte(pattern[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed { in pattern %q", pattern)
+		}
+		sb.WriteString(pattern[:start])
+		name := pattern[start+1 : start+end]
+		pattern = pattern[start+end+1:]
+
+		if name == "#" {
+			sb.WriteString(strconv.Itoa(number))
+			continue
+		}
+		value, ok := values[name]
+		if !ok || value == nil {
+			return "", fmt.Errorf("no value for {%s}", name)
+		}
+		sb.WriteString(clean(valueString(value)))
+	}
+}
+
+// valueString returns `value` of a record as text.
+func valueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = valueString(e)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// cleanName replaces the characters of `s` that are not allowed in file names.
+func cleanName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.TrimSpace(s)
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
@@ -0,0 +1,118 @@
+/*
+ * Design a form from a JSON or YAML spec: the fields (text, check boxes, radio groups, combo and
+ * list boxes, push buttons, signature fields) are added to an existing PDF or, without an input
+ * file, to blank pages. With -export, the spec of the fields of a PDF is written instead.
+ *
+ * Run as: go run pdf_form_design.go form_spec.yaml output.pdf [input.pdf]
+ *     or: go run pdf_form_design.go -export input.pdf spec.yaml
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/forms/design"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	export := flag.Bool("export", false, "Export the spec of the fields of a PDF.")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 2 {
+		fmt.Printf("Design a form from a JSON or YAML spec, or export the spec of a form\n")
+		fmt.Printf("Usage: go run pdf_form_design.go spec.yaml output.pdf [input.pdf]\n")
+		fmt.Printf("       go run pdf_form_design.go -export input.pdf spec.yaml\n")
+		os.Exit(1)
+	}
+
+	var err error
+	if *export {
+		err = exportSpec(args[0], args[1])
+	} else {
+		inputPath := ""
+		if len(args) > 2 {
+			inputPath = args[2]
+		}
+		err = designForm(args[0], inputPath, args[1])
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Success, output written to %s\n", args[1])
+}
+
+// designForm adds the fields of the spec `specPath` to the PDF `inputPath`, or to blank pages if
+// `inputPath` is empty, and writes the result to `outputPath`.
+func designForm(specPath, inputPath, outputPath string) error {
+	spec, err := design.LoadSpec(specPath)
+	if err != nil {
+		return err
+	}
+
+	var pdfWriter *model.PdfWriter
+	if inputPath == "" {
+		pdfWriter, err = design.NewDocument(spec)
+		if err != nil {
+			return err
+		}
+	} else {
+		f, err := os.Open(inputPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		pdfReader, err := model.NewPdfReader(f)
+		if err != nil {
+			return err
+		}
+		pdfWriter, err = design.AddToReader(pdfReader, spec)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, field := range spec.Fields {
+		fmt.Printf("%s field %s on page %d\n", field.Type, field.Name, field.Page)
+	}
+	return pdfWriter.WriteToFile(outputPath)
+}
+
+// exportSpec writes the form spec of the fields of the PDF `inputPath` to `specPath`, as JSON if
+// its name ends with .json and as YAML otherwise.
+func exportSpec(inputPath, specPath string) error {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pdfReader, err := model.NewPdfReader(f)
+	if err != nil {
+		return err
+	}
+
+	spec, err := design.Export(pdfReader)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d field(s) on %d page(s)\n", len(spec.Fields), spec.Pages)
+	return spec.Save(specPath)
+}
@@ -0,0 +1,74 @@
+/*
+ * Export the form field values and annotations (comments, highlights, drawings) of a PDF as XFDF.
+ *
+ * Run as: go run pdf_form_export_xfdf.go input.pdf output.xfdf
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/forms/xfdf"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Printf("Export the form data and annotations of a PDF as XFDF\n")
+		fmt.Printf("Usage: go run pdf_form_export_xfdf.go input.pdf output.xfdf\n")
+		os.Exit(1)
+	}
+	inputPath, outputPath := os.Args[1], os.Args[2]
+
+	err := exportXFDF(inputPath, outputPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Success, output written to %s\n", outputPath)
+}
+
+// exportXFDF writes the field values and annotations of the PDF `inputPath` to the XFDF file
+// `outputPath`.
+func exportXFDF(inputPath, outputPath string) error {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pdfReader, err := model.NewPdfReader(f)
+	if err != nil {
+		return err
+	}
+
+	doc, err := xfdf.Export(pdfReader)
+	if err != nil {
+		return err
+	}
+	doc.Href = filepath.Base(inputPath)
+
+	for _, field := range doc.Fields {
+		fmt.Printf("field %s: %q\n", field.Name, field.Values)
+	}
+	for _, annot := range doc.Annotations {
+		fmt.Printf("%s annotation on page %d: %q\n", annot.Type, annot.Page+1, annot.Contents)
+	}
+
+	return doc.Save(outputPath)
+}
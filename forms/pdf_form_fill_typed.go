@@ -0,0 +1,105 @@
+/*
+ * Fill a PDF form with typed values (numbers, dates, check boxes, radio buttons, list boxes) from
+ * JSON, checking each value against its field: maximum length, comb, number and date formats,
+ * ranges and options. Calculated fields (AFSimple_Calculate) are recalculated and the values that
+ * don't suit their fields are reported instead of being written.
+ *
+ * Run as: go run pdf_form_fill_typed.go input.pdf values.json output.pdf
+ *
+ * values.json is an object of values by field name, e.g.
+ *   {"Amount": 1234.5, "Date": "2024-03-01", "Agree": true, "Toppings": ["Cheese", "Ham"]}
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/forms/fill"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	if len(os.Args) < 4 {
+		fmt.Printf("Fill a PDF form with typed values and report rejected values\n")
+		fmt.Printf("Usage: go run pdf_form_fill_typed.go input.pdf values.json output.pdf\n")
+		os.Exit(1)
+	}
+	inputPath, valuesPath, outputPath := os.Args[1], os.Args[2], os.Args[3]
+
+	report, err := fillTyped(inputPath, valuesPath, outputPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, r := range report.Filled {
+		fmt.Printf("filled     %s (%s) = %q", r.Field, r.Type, r.Value)
+		if r.Display != "" {
+			fmt.Printf(" shown as %q", r.Display)
+		}
+		fmt.Println()
+	}
+	for _, r := range report.Calculated {
+		fmt.Printf("calculated %s = %q shown as %q\n", r.Field, r.Value, r.Display)
+	}
+	for _, r := range report.Rejected {
+		fmt.Printf("rejected   %s = %q: %s\n", r.Field, r.Value, r.Reason)
+	}
+	for _, name := range report.Missing {
+		fmt.Printf("missing    %s (required)\n", name)
+	}
+	for _, w := range report.Warnings {
+		fmt.Printf("warning    %s\n", w)
+	}
+
+	fmt.Printf("Success, output written to %s\n", outputPath)
+}
+
+// fillTyped fills the form of `inputPath` with the values of the JSON file `valuesPath` and
+// writes the result to `outputPath`.
+func fillTyped(inputPath, valuesPath, outputPath string) (*fill.Report, error) {
+	values, err := fill.LoadValues(valuesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pdfReader, err := model.NewPdfReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fill the values, recalculate and generate the appearances of the changed fields.
+	opts := fill.Options{
+		Appearance: annotator.FieldAppearance{OnlyIfMissing: true, RegenerateTextFields: true},
+	}
+	report, err := fill.Fill(pdfReader.AcroForm, values, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pdfWriter, err := pdfReader.ToWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	return report, pdfWriter.WriteToFile(outputPath)
+}
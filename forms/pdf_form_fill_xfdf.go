@@ -0,0 +1,96 @@
+/*
+ * Fill a PDF form with the field values of an XFDF file and add its annotations to the pages,
+ * optionally flattening the result.
+ *
+ * Run as: go run pdf_form_fill_xfdf.go [-flatten] input.pdf data.xfdf output.pdf
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/forms/xfdf"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	flatten := flag.Bool("flatten", false, "Flatten the form fields after filling.")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 3 {
+		fmt.Printf("Fill a PDF form with XFDF data and annotations\n")
+		fmt.Printf("Usage: go run pdf_form_fill_xfdf.go [-flatten] input.pdf data.xfdf output.pdf\n")
+		os.Exit(1)
+	}
+
+	err := fillXFDF(args[0], args[1], args[2], *flatten)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Success, output written to %s\n", args[2])
+}
+
+// fillXFDF fills the form of `inputPath` with the XFDF data of `xfdfPath`, adds the annotations of
+// the data and writes the result to `outputPath`.
+func fillXFDF(inputPath, xfdfPath, outputPath string, flatten bool) error {
+	doc, err := xfdf.Load(xfdfPath)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pdfReader, err := model.NewPdfReader(f)
+	if err != nil {
+		return err
+	}
+
+	// The XFDF document provides the field values like FDF and JSON data do.
+	fieldAppearance := annotator.FieldAppearance{OnlyIfMissing: true, RegenerateTextFields: true}
+	if pdfReader.AcroForm != nil {
+		err = pdfReader.AcroForm.FillWithAppearance(doc, fieldAppearance)
+		if err != nil {
+			return err
+		}
+	}
+
+	added, err := xfdf.AddAnnotations(pdfReader, doc.Annotations)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d field value(s), %d annotation(s) added\n", len(doc.Fields), added)
+
+	if flatten {
+		err = pdfReader.FlattenFields(true, fieldAppearance)
+		if err != nil {
+			return err
+		}
+	}
+
+	pdfWriter, err := pdfReader.ToWriter(nil)
+	if err != nil {
+		return err
+	}
+	return pdfWriter.WriteToFile(outputPath)
+}
@@ -0,0 +1,96 @@
+/*
+ * Mail merge: fill a PDF form template once per record of a CSV or JSON dataset. The template is
+ * read once and the records are filled concurrently, optionally flattened, and written either to
+ * one PDF per record, named from a pattern of record values, or into one concatenated PDF with an
+ * outline entry per record.
+ *
+ * Run as: go run pdf_form_mail_merge.go [-flatten] [-name "{Name}-{#}.pdf"] template.pdf records.csv output_dir
+ *         go run pdf_form_mail_merge.go [-flatten] -concat [-title "{Name}"] template.pdf records.json output.pdf
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/unidoc/unipdf/v3/common/license"
+
+	"github.com/unidoc/unidoc-examples/forms/mailmerge"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+const usagef = "Usage: %s [-flatten] [-concat] [-name PATTERN] [-title PATTERN] TEMPLATE_PDF RECORDS_CSV_OR_JSON OUTPUT\n"
+
+func main() {
+	var (
+		flatten, concat bool
+		name, title     string
+	)
+	flag.BoolVar(&flatten, "flatten", false, "Flatten the filled fields.")
+	flag.BoolVar(&concat, "concat", false, "Concatenate the records into the OUTPUT PDF instead of the OUTPUT directory.")
+	flag.StringVar(&name, "name", "{#}.pdf", "Output file name pattern, {field} is replaced by the field value and {#} by the record number.")
+	flag.StringVar(&title, "title", "{#}", "Outline title pattern of -concat.")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 3 {
+		fmt.Printf(usagef, os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	templatePath, recordsPath, outputPath := args[0], args[1], args[2]
+
+	// Read the template once. Each record is filled in a copy parsed from memory.
+	tmpl, err := mailmerge.LoadTemplate(templatePath, "")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	records, err := mailmerge.LoadRecords(recordsPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts := mailmerge.Options{
+		Flatten: flatten,
+		Progress: func(done, total int, res *mailmerge.Result) {
+			if !res.OK() {
+				fmt.Printf("%d of %d: record %d failed: %s\n", done, total, res.Record, res.Error)
+				return
+			}
+			for _, r := range res.Report.Rejected {
+				fmt.Printf("%d of %d: record %d: rejected %s = %q: %s\n", done, total, res.Record, r.Field,
+					r.Value, r.Reason)
+			}
+		},
+	}
+
+	var results []*mailmerge.Result
+	if concat {
+		results, err = mailmerge.Concatenate(tmpl, records, outputPath, title, opts)
+	} else {
+		results, err = mailmerge.Files(tmpl, records, outputPath, name, opts)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	filled := 0
+	for _, res := range results {
+		if res.OK() {
+			filled++
+		}
+	}
+	fmt.Printf("%d of %d records filled, output written to %s\n", filled, len(results), outputPath)
+}
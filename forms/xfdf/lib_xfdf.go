@@ -0,0 +1,327 @@
+/*
+ * Package xfdf reads and writes XFDF (XML Forms Data Format, ISO 19444-1) form data: the values
+ * of the form fields and the annotations of a PDF. It converts between XFDF, FDF and the JSON
+ * form data of fjson, so data exported by web tooling as XFDF can fill forms like FDF does.
+ *
+ *   doc, err := xfdf.Load("data.xfdf")
+ *   err = pdfReader.AcroForm.FillWithAppearance(doc, appearance) // doc is a FieldValueProvider.
+ *   added, err := xfdf.AddAnnotations(pdfReader, doc.Annotations)
+ *
+ *   doc, err := xfdf.Export(pdfReader) // Field values and annotations of a PDF.
+ *   err = doc.Save("data.fdf")        // Format by extension: .xfdf, .fdf or .json.
+ *
+ * FDF and JSON hold the field values only.
+ *
+ * Used by pdftool form-data and fill-form, forms/pdf_form_export_xfdf.go,
+ * forms/pdf_form_fill_xfdf.go and forms/form_data_convert.go.
+ */
+
+package xfdf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/forms/fill"
+)
+
+// Namespace is the XML namespace of XFDF.
+const Namespace = "http://ns.adobe.com/xfdf/"
+
+// Document is XFDF form data.
+type Document struct {
+	// Href is the PDF file the data is for, if given.
+	Href string
+	// Fields are the field values in document order.
+	Fields []*Field
+	// Annotations are the annotations in document order.
+	Annotations []*Annotation
+}
+
+// Field is the value of a field. Fields have several values if they are multi-select list boxes
+// and none if they are empty.
+type Field struct {
+	// Name is the full field name, e.g. "address.city".
+	Name   string
+	Values []string
+}
+
+// xfdfXML is the XML element of a Document.
+type xfdfXML struct {
+	XMLName xml.Name    `xml:"xfdf"`
+	Xmlns   string      `xml:"xmlns,attr,omitempty"`
+	Space   string      `xml:"xml:space,attr,omitempty"`
+	F       *fXML       `xml:"f"`
+	Fields  []*fieldXML `xml:"fields>field"`
+	Annots  *annotsXML  `xml:"annots"`
+}
+
+type fXML struct {
+	Href string `xml:"href,attr"`
+}
+
+// fieldXML is a field element, a terminal field with values or a parent field with kids.
+type fieldXML struct {
+	Name   string      `xml:"name,attr"`
+	Values []string    `xml:"value"`
+	Kids   []*fieldXML `xml:"field"`
+}
+
+type annotsXML struct {
+	Annotations []*Annotation `xml:",any"`
+}
+
+// Load reads the form data file `path`: XFDF, or FDF or JSON if its name ends with .fdf or
+// .json.
+func Load(path string) (*Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch formatOf(path) {
+	case "fdf":
+		return ReadFDF(f)
+	case "json":
+		return ReadJSON(f)
+	}
+	return Read(f)
+}
+
+// Save writes `d` to `path` as XFDF, or as FDF or JSON if its name ends with .fdf or .json.
+func (d *Document) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	switch formatOf(path) {
+	case "fdf":
+		err = d.WriteFDF(f)
+	case "json":
+		err = d.WriteJSON(f)
+	default:
+		err = d.Write(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// formatOf returns the form data format of the file `path` by its extension: "fdf", "json" or
+// "xfdf".
+func formatOf(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".fdf"):
+		return "fdf"
+	case strings.HasSuffix(lower, ".json"):
+		return "json"
+	}
+	return "xfdf"
+}
+
+// Read reads an XFDF document from `r`.
+func Read(r io.Reader) (*Document, error) {
+	var x xfdfXML
+	if err := xml.NewDecoder(r).Decode(&x); err != nil {
+		return nil, fmt.Errorf("xfdf: %w", err)
+	}
+	d := &Document{}
+	if x.F != nil {
+		d.Href = x.F.Href
+	}
+	var walk func(prefix string, fields []*fieldXML)
+	walk = func(prefix string, fields []*fieldXML) {
+		for _, fx := range fields {
+			name := fx.Name
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			if len(fx.Kids) > 0 {
+				walk(name, fx.Kids)
+				continue
+			}
+			d.Fields = append(d.Fields, &Field{Name: name, Values: fx.Values})
+		}
+	}
+	walk("", x.Fields)
+	if x.Annots != nil {
+		d.Annotations = x.Annots.Annotations
+	}
+	return d, nil
+}
+
+// Write writes `d` to `w` as XFDF.
+func (d *Document) Write(w io.Writer) error {
+	x := xfdfXML{Xmlns: Namespace, Space: "preserve", Fields: fieldTree(d.Fields)}
+	if d.Href != "" {
+		x.F = &fXML{Href: d.Href}
+	}
+	if len(d.Annotations) > 0 {
+		x.Annots = &annotsXML{Annotations: d.Annotations}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(x); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// fieldTree returns the fields as a tree of partial names, e.g. "a.b" and "a.c" as the kids b
+// and c of a, keeping the order of `fields`.
+func fieldTree(fields []*Field) []*fieldXML {
+	var roots []*fieldXML
+	parents := map[string]*fieldXML{}
+	for _, f := range fields {
+		parts := strings.Split(f.Name, ".")
+		kids := &roots
+		for i, part := range parts[:len(parts)-1] {
+			name := strings.Join(parts[:i+1], ".")
+			parent, ok := parents[name]
+			if !ok {
+				parent = &fieldXML{Name: part}
+				parents[name] = parent
+				*kids = append(*kids, parent)
+			}
+			kids = &parent.Kids
+		}
+		*kids = append(*kids, &fieldXML{Name: parts[len(parts)-1], Values: f.Values})
+	}
+	return roots
+}
+
+// Field returns the field of `d` named `name`, or nil if there is none.
+func (d *Document) Field(name string) *Field {
+	for _, f := range d.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// FieldValues returns the values of the fields that have values, by full field name: a string for
+// a single value, an array of strings for several. It implements model.FieldValueProvider, so `d`
+// can fill forms with PdfAcroForm.Fill and FillWithAppearance. The strings are not encoded as
+// PdfAcroForm.Fill encodes the values of text fields itself.
+func (d *Document) FieldValues() (map[string]core.PdfObject, error) {
+	values := map[string]core.PdfObject{}
+	for _, f := range d.Fields {
+		switch len(f.Values) {
+		case 0:
+		case 1:
+			values[f.Name] = core.MakeString(f.Values[0])
+		default:
+			arr := core.MakeArray()
+			for _, v := range f.Values {
+				arr.Append(core.MakeString(v))
+			}
+			values[f.Name] = arr
+		}
+	}
+	return values, nil
+}
+
+// Values returns the values of the fields that have values for typed filling with forms/fill.
+func (d *Document) Values() fill.Values {
+	values := fill.Values{}
+	for _, f := range d.Fields {
+		switch len(f.Values) {
+		case 0:
+		case 1:
+			values[f.Name] = f.Values[0]
+		default:
+			list := make([]interface{}, len(f.Values))
+			for i, v := range f.Values {
+				list[i] = v
+			}
+			values[f.Name] = list
+		}
+	}
+	return values
+}
+
+// Export returns the field values and annotations of the document loaded by `pdfReader`.
+// Signature fields and push buttons are left out, as are widget, link and popup annotations.
+func Export(pdfReader *model.PdfReader) (*Document, error) {
+	d := &Document{}
+	if form := pdfReader.AcroForm; form != nil {
+		for _, f := range form.AllFields() {
+			if !f.IsTerminal() {
+				continue
+			}
+			switch ctx := f.GetContext().(type) {
+			case *model.PdfFieldSignature:
+				continue
+			case *model.PdfFieldButton:
+				if ctx.IsPush() {
+					continue
+				}
+			}
+			name, err := f.FullName()
+			if err != nil {
+				return nil, err
+			}
+			d.Fields = append(d.Fields, &Field{Name: name, Values: objectValues(f.V)})
+		}
+	}
+
+	for i, page := range pdfReader.PageList {
+		annots, err := page.GetAnnotations()
+		if err != nil {
+			return nil, err
+		}
+		for _, annot := range annots {
+			if a := exportAnnotation(annot, i); a != nil {
+				d.Annotations = append(d.Annotations, a)
+			}
+		}
+	}
+	return d, nil
+}
+
+// objectValues returns the values of the field value `obj`.
+func objectValues(obj core.PdfObject) []string {
+	switch v := core.TraceToDirectObject(obj).(type) {
+	case *core.PdfObjectString:
+		return []string{v.Decoded()}
+	case *core.PdfObjectName:
+		return []string{v.String()}
+	case *core.PdfObjectArray:
+		var values []string
+		for _, e := range v.Elements() {
+			values = append(values, objectValues(e)...)
+		}
+		return values
+	}
+	return nil
+}
+
+// sortFields sorts `fields` by name.
+func sortFields(fields []*Field) {
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+}
+
+// makeString returns `s` as a PDF string, UTF-16 encoded if it isn't ASCII.
+func makeString(s string) *core.PdfObjectString {
+	for _, r := range s {
+		if r > 0x7e {
+			return core.MakeEncodedString(s, true)
+		}
+	}
+	return core.MakeString(s)
+}
@@ -0,0 +1,444 @@
+/*
+ * XFDF annotations: conversion between the annotation elements of XFDF and the markup
+ * annotations of PDF pages.
+ */
+
+package xfdf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Annotation is an XFDF annotation element. Coordinates are lists of numbers separated by commas;
+// the vertices of polygons and the points of ink gestures are pairs separated by semicolons.
+type Annotation struct {
+	// Type is the element name: text, freetext, highlight, underline, squiggly, strikeout, square,
+	// circle, line, polygon, polyline, ink, stamp or caret.
+	Type string `xml:"-"`
+	// Page is the page index, starting at 0.
+	Page int    `xml:"page,attr"`
+	Rect string `xml:"rect,attr"`
+	// Name is the unique name of the annotation (NM).
+	Name string `xml:"name,attr,omitempty"`
+	// Title is the author (T).
+	Title   string `xml:"title,attr,omitempty"`
+	Subject string `xml:"subject,attr,omitempty"`
+	// Date is the modification date (M) and CreationDate the creation date, as PDF dates.
+	Date         string `xml:"date,attr,omitempty"`
+	CreationDate string `xml:"creationdate,attr,omitempty"`
+	// Flags are the names of the annotation flags separated by commas, e.g. "print,nozoom".
+	Flags string `xml:"flags,attr,omitempty"`
+	// Color and InteriorColor are #RRGGBB colors.
+	Color         string `xml:"color,attr,omitempty"`
+	InteriorColor string `xml:"interior-color,attr,omitempty"`
+	Opacity       string `xml:"opacity,attr,omitempty"`
+	// Width is the border width.
+	Width string `xml:"width,attr,omitempty"`
+	// Icon is the icon of text annotations and stamps, e.g. Comment or Approved.
+	Icon string `xml:"icon,attr,omitempty"`
+	// Coords are the quadrilaterals of text markup annotations (QuadPoints).
+	Coords string `xml:"coords,attr,omitempty"`
+	// Start and End are the points of lines.
+	Start             string `xml:"start,attr,omitempty"`
+	End               string `xml:"end,attr,omitempty"`
+	Contents          string `xml:"contents,omitempty"`
+	DefaultAppearance string `xml:"defaultappearance,omitempty"`
+	Vertices          string `xml:"vertices,omitempty"`
+	// Gestures are the paths of ink annotations.
+	Gestures []string `xml:"-"`
+}
+
+// annotationXML is the XML element of an Annotation, with the ink list omitted when empty.
+type annotationXML struct {
+	*plainAnnotation
+	InkList *inkListXML `xml:"inklist"`
+}
+
+type plainAnnotation Annotation
+
+type inkListXML struct {
+	Gestures []string `xml:"gesture"`
+}
+
+// MarshalXML writes `a` as an element named by its type.
+func (a *Annotation) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: a.Type}
+	x := annotationXML{plainAnnotation: (*plainAnnotation)(a)}
+	if len(a.Gestures) > 0 {
+		x.InkList = &inkListXML{Gestures: a.Gestures}
+	}
+	return e.EncodeElement(x, start)
+}
+
+// UnmarshalXML reads `a` from an annotation element.
+func (a *Annotation) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	x := annotationXML{plainAnnotation: (*plainAnnotation)(a)}
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+	a.Type = start.Name.Local
+	if x.InkList != nil {
+		a.Gestures = x.InkList.Gestures
+	}
+	return nil
+}
+
+// annotationFlags are the names of the annotation flags by bit, starting at bit 1.
+var annotationFlags = []string{"invisible", "hidden", "print", "nozoom", "norotate", "noview",
+	"readonly", "locked", "togglenoview", "lockedcontents"}
+
+// AddAnnotations adds `annots` to the pages of the document loaded by `pdfReader` and returns the
+// number of annotations added. Annotations of other types than those of Annotation.Type are
+// skipped. Viewers generate the appearances of the added annotations.
+func AddAnnotations(pdfReader *model.PdfReader, annots []*Annotation) (int, error) {
+	added := 0
+	for _, a := range annots {
+		if a.Page < 0 || a.Page >= len(pdfReader.PageList) {
+			return added, fmt.Errorf("%s annotation: no page %d", a.Type, a.Page)
+		}
+		annot, err := a.toPdf()
+		if err != nil {
+			return added, fmt.Errorf("%s annotation on page %d: %w", a.Type, a.Page, err)
+		}
+		if annot == nil {
+			continue
+		}
+		pdfReader.PageList[a.Page].AddAnnotation(annot)
+		added++
+	}
+	return added, nil
+}
+
+// toPdf returns the PDF annotation of `a`, nil if its type isn't supported.
+func (a *Annotation) toPdf() (*model.PdfAnnotation, error) {
+	var (
+		annot  *model.PdfAnnotation
+		markup *model.PdfAnnotationMarkup
+		bs, ic *core.PdfObject
+		err    error
+	)
+	switch a.Type {
+	case "text":
+		ctx := model.NewPdfAnnotationText()
+		annot, markup = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup
+		if a.Icon != "" {
+			ctx.Name = core.MakeName(a.Icon)
+		}
+	case "freetext":
+		ctx := model.NewPdfAnnotationFreeText()
+		annot, markup, bs = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup, &ctx.BS
+		if a.DefaultAppearance != "" {
+			ctx.DA = core.MakeString(a.DefaultAppearance)
+		}
+	case "highlight":
+		ctx := model.NewPdfAnnotationHighlight()
+		annot, markup = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup
+		ctx.QuadPoints, err = numberArray(a.Coords)
+	case "underline":
+		ctx := model.NewPdfAnnotationUnderline()
+		annot, markup = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup
+		ctx.QuadPoints, err = numberArray(a.Coords)
+	case "squiggly":
+		ctx := model.NewPdfAnnotationSquiggly()
+		annot, markup = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup
+		ctx.QuadPoints, err = numberArray(a.Coords)
+	case "strikeout":
+		ctx := model.NewPdfAnnotationStrikeOut()
+		annot, markup = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup
+		ctx.QuadPoints, err = numberArray(a.Coords)
+	case "square":
+		ctx := model.NewPdfAnnotationSquare()
+		annot, markup, bs, ic = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup, &ctx.BS, &ctx.IC
+	case "circle":
+		ctx := model.NewPdfAnnotationCircle()
+		annot, markup, bs, ic = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup, &ctx.BS, &ctx.IC
+	case "line":
+		ctx := model.NewPdfAnnotationLine()
+		annot, markup, bs, ic = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup, &ctx.BS, &ctx.IC
+		ctx.L, err = numberArray(a.Start + "," + a.End)
+	case "polygon":
+		ctx := model.NewPdfAnnotationPolygon()
+		annot, markup, bs, ic = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup, &ctx.BS, &ctx.IC
+		ctx.Vertices, err = numberArray(a.Vertices)
+	case "polyline":
+		ctx := model.NewPdfAnnotationPolyLine()
+		annot, markup, bs, ic = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup, &ctx.BS, &ctx.IC
+		ctx.Vertices, err = numberArray(a.Vertices)
+	case "ink":
+		ctx := model.NewPdfAnnotationInk()
+		annot, markup, bs = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup, &ctx.BS
+		inkList := core.MakeArray()
+		for _, g := range a.Gestures {
+			var points *core.PdfObjectArray
+			if points, err = numberArray(g); err != nil {
+				break
+			}
+			inkList.Append(points)
+		}
+		ctx.InkList = inkList
+	case "stamp":
+		ctx := model.NewPdfAnnotationStamp()
+		annot, markup = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup
+		if a.Icon != "" {
+			ctx.Name = core.MakeName(a.Icon)
+		}
+	case "caret":
+		ctx := model.NewPdfAnnotationCaret()
+		annot, markup = ctx.PdfAnnotation, ctx.PdfAnnotationMarkup
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if annot.Rect, err = numberArray(a.Rect); err != nil {
+		return nil, fmt.Errorf("rect: %w", err)
+	}
+	if a.Contents != "" {
+		annot.Contents = makeString(a.Contents)
+	}
+	if a.Name != "" {
+		annot.NM = makeString(a.Name)
+	}
+	if a.Date != "" {
+		annot.M = core.MakeString(a.Date)
+	}
+	if a.Flags != "" {
+		flags := 0
+		for _, name := range strings.Split(a.Flags, ",") {
+			for bit, flag := range annotationFlags {
+				if strings.EqualFold(strings.TrimSpace(name), flag) {
+					flags |= 1 << uint(bit)
+				}
+			}
+		}
+		annot.F = core.MakeInteger(int64(flags))
+	}
+	if a.Color != "" {
+		if annot.C, err = colorArray(a.Color); err != nil {
+			return nil, err
+		}
+	}
+	if a.InteriorColor != "" && ic != nil {
+		if *ic, err = colorArray(a.InteriorColor); err != nil {
+			return nil, err
+		}
+	}
+	if a.Width != "" && bs != nil {
+		w, err := strconv.ParseFloat(a.Width, 64)
+		if err != nil {
+			return nil, fmt.Errorf("width: %w", err)
+		}
+		bsDict := core.MakeDict()
+		bsDict.Set("W", core.MakeFloat(w))
+		*bs = bsDict
+	}
+
+	if a.Title != "" {
+		markup.T = makeString(a.Title)
+	}
+	if a.Subject != "" {
+		markup.Subj = makeString(a.Subject)
+	}
+	if a.CreationDate != "" {
+		markup.CreationDate = core.MakeString(a.CreationDate)
+	}
+	if a.Opacity != "" {
+		ca, err := strconv.ParseFloat(a.Opacity, 64)
+		if err != nil {
+			return nil, fmt.Errorf("opacity: %w", err)
+		}
+		markup.CA = core.MakeFloat(ca)
+	}
+	return annot, nil
+}
+
+// exportAnnotation returns the XFDF annotation of `annot` on page index `page`, or nil if the
+// annotation type isn't supported.
+func exportAnnotation(annot *model.PdfAnnotation, page int) *Annotation {
+	a := &Annotation{Page: page}
+	var (
+		markup *model.PdfAnnotationMarkup
+		bs, ic core.PdfObject
+	)
+	switch ctx := annot.GetContext().(type) {
+	case *model.PdfAnnotationText:
+		a.Type, markup, a.Icon = "text", ctx.PdfAnnotationMarkup, nameString(ctx.Name)
+	case *model.PdfAnnotationFreeText:
+		a.Type, markup, bs = "freetext", ctx.PdfAnnotationMarkup, ctx.BS
+		a.DefaultAppearance = textString(ctx.DA)
+	case *model.PdfAnnotationHighlight:
+		a.Type, markup, a.Coords = "highlight", ctx.PdfAnnotationMarkup, numberList(ctx.QuadPoints, ",")
+	case *model.PdfAnnotationUnderline:
+		a.Type, markup, a.Coords = "underline", ctx.PdfAnnotationMarkup, numberList(ctx.QuadPoints, ",")
+	case *model.PdfAnnotationSquiggly:
+		a.Type, markup, a.Coords = "squiggly", ctx.PdfAnnotationMarkup, numberList(ctx.QuadPoints, ",")
+	case *model.PdfAnnotationStrikeOut:
+		a.Type, markup, a.Coords = "strikeout", ctx.PdfAnnotationMarkup, numberList(ctx.QuadPoints, ",")
+	case *model.PdfAnnotationSquare:
+		a.Type, markup, bs, ic = "square", ctx.PdfAnnotationMarkup, ctx.BS, ctx.IC
+	case *model.PdfAnnotationCircle:
+		a.Type, markup, bs, ic = "circle", ctx.PdfAnnotationMarkup, ctx.BS, ctx.IC
+	case *model.PdfAnnotationLine:
+		a.Type, markup, bs, ic = "line", ctx.PdfAnnotationMarkup, ctx.BS, ctx.IC
+		if l := numberList(ctx.L, ","); strings.Count(l, ",") == 3 {
+			parts := strings.Split(l, ",")
+			a.Start, a.End = parts[0]+","+parts[1], parts[2]+","+parts[3]
+		}
+	case *model.PdfAnnotationPolygon:
+		a.Type, markup, bs, ic = "polygon", ctx.PdfAnnotationMarkup, ctx.BS, ctx.IC
+		a.Vertices = numberList(ctx.Vertices, ";")
+	case *model.PdfAnnotationPolyLine:
+		a.Type, markup, bs, ic = "polyline", ctx.PdfAnnotationMarkup, ctx.BS, ctx.IC
+		a.Vertices = numberList(ctx.Vertices, ";")
+	case *model.PdfAnnotationInk:
+		a.Type, markup, bs = "ink", ctx.PdfAnnotationMarkup, ctx.BS
+		if inkList, ok := core.GetArray(ctx.InkList); ok {
+			for _, g := range inkList.Elements() {
+				a.Gestures = append(a.Gestures, numberList(g, ";"))
+			}
+		}
+	case *model.PdfAnnotationStamp:
+		a.Type, markup, a.Icon = "stamp", ctx.PdfAnnotationMarkup, nameString(ctx.Name)
+	case *model.PdfAnnotationCaret:
+		a.Type, markup = "caret", ctx.PdfAnnotationMarkup
+	default:
+		return nil
+	}
+
+	a.Rect = numberList(annot.Rect, ",")
+	a.Contents = textString(annot.Contents)
+	a.Name = textString(annot.NM)
+	a.Date = textString(annot.M)
+	if f, ok := core.GetIntVal(annot.F); ok {
+		var names []string
+		for bit, flag := range annotationFlags {
+			if f&(1<<uint(bit)) != 0 {
+				names = append(names, flag)
+			}
+		}
+		a.Flags = strings.Join(names, ",")
+	}
+	a.Color = colorString(annot.C)
+	a.InteriorColor = colorString(ic)
+	if bsDict, ok := core.GetDict(bs); ok {
+		if w, err := core.GetNumberAsFloat(bsDict.Get("W")); err == nil {
+			a.Width = formatNumber(w)
+		}
+	}
+	if markup != nil {
+		a.Title = textString(markup.T)
+		a.Subject = textString(markup.Subj)
+		a.CreationDate = textString(markup.CreationDate)
+		if ca, err := core.GetNumberAsFloat(markup.CA); err == nil {
+			a.Opacity = formatNumber(ca)
+		}
+	}
+	return a
+}
+
+// numberArray returns the numbers of the list `s`, separated by commas, semicolons or spaces, as
+// an array.
+func numberArray(s string) (*core.PdfObjectArray, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == ' ' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no coordinates")
+	}
+	values := make([]float64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return core.MakeArrayFromFloats(values), nil
+}
+
+// numberList returns the numbers of the array `obj` separated by commas, with pairs separated by
+// `pairSep`.
+func numberList(obj core.PdfObject, pairSep string) string {
+	arr, ok := core.GetArray(obj)
+	if !ok {
+		return ""
+	}
+	values, err := arr.ToFloat64Array()
+	if err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for i, v := range values {
+		if i > 0 {
+			if i%2 == 0 {
+				sb.WriteString(pairSep)
+			} else {
+				sb.WriteString(",")
+			}
+		}
+		sb.WriteString(formatNumber(v))
+	}
+	return sb.String()
+}
+
+// colorArray returns the #RRGGBB color `s` as an RGB color array.
+func colorArray(s string) (*core.PdfObjectArray, error) {
+	rgb, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(s, "#")) != 6 {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	return core.MakeArrayFromFloats([]float64{
+		float64(rgb>>16&0xff) / 255, float64(rgb>>8&0xff) / 255, float64(rgb&0xff) / 255,
+	}), nil
+}
+
+// colorString returns the gray, RGB or CMYK color array `obj` as #RRGGBB.
+func colorString(obj core.PdfObject) string {
+	arr, ok := core.GetArray(obj)
+	if !ok {
+		return ""
+	}
+	c, err := arr.ToFloat64Array()
+	if err != nil {
+		return ""
+	}
+	var r, g, b float64
+	switch len(c) {
+	case 1:
+		r, g, b = c[0], c[0], c[0]
+	case 3:
+		r, g, b = c[0], c[1], c[2]
+	case 4:
+		r, g, b = (1-c[0])*(1-c[3]), (1-c[1])*(1-c[3]), (1-c[2])*(1-c[3])
+	default:
+		return ""
+	}
+	return fmt.Sprintf("#%02X%02X%02X", uint8(r*255+0.5), uint8(g*255+0.5), uint8(b*255+0.5))
+}
+
+// textString returns the text of the string object `obj`.
+func textString(obj core.PdfObject) string {
+	if s, ok := core.GetString(obj); ok {
+		return s.Decoded()
+	}
+	return ""
+}
+
+// nameString returns the name `obj` as a string.
+func nameString(obj core.PdfObject) string {
+	if name, ok := core.GetName(obj); ok {
+		return name.String()
+	}
+	return ""
+}
+
+// formatNumber formats `v` without trailing zeros.
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
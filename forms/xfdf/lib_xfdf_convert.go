@@ -0,0 +1,157 @@
+/*
+ * FDF and JSON form data: reading them into Documents and writing the field values of Documents
+ * in these formats.
+ */
+
+package xfdf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/fdf"
+
+	"github.com/unidoc/unidoc-examples/forms/fill"
+)
+
+// ReadFDF reads the field values of an FDF file from `rs`.
+func ReadFDF(rs io.ReadSeeker) (*Document, error) {
+	data, err := fdf.Load(rs)
+	if err != nil {
+		return nil, fmt.Errorf("fdf: %w", err)
+	}
+	values, err := data.FieldValues()
+	if err != nil {
+		return nil, fmt.Errorf("fdf: %w", err)
+	}
+	d := &Document{}
+	for name, v := range values {
+		d.Fields = append(d.Fields, &Field{Name: name, Values: objectValues(v)})
+	}
+	sortFields(d.Fields)
+	return d, nil
+}
+
+// WriteFDF writes the field values of `d` to `w` as an FDF file.
+func (d *Document) WriteFDF(w io.Writer) error {
+	fields := core.MakeArray()
+	for _, fx := range fieldTree(d.Fields) {
+		fields.Append(fdfField(fx))
+	}
+	fdfDict := core.MakeDict()
+	if d.Href != "" {
+		fdfDict.Set("F", makeString(d.Href))
+	}
+	fdfDict.Set("Fields", fields)
+	catalog := core.MakeDict()
+	catalog.Set("FDF", fdfDict)
+
+	var buf bytes.Buffer
+	buf.WriteString("%FDF-1.2\n%\xe2\xe3\xcf\xd3\n")
+	buf.WriteString("1 0 obj\n" + catalog.WriteString() + "\nendobj\n")
+	buf.WriteString("trailer\n<</Root 1 0 R>>\n%%EOF\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// fdfField returns the FDF field dictionary of `fx`.
+func fdfField(fx *fieldXML) *core.PdfObjectDictionary {
+	dict := core.MakeDict()
+	dict.Set("T", makeString(fx.Name))
+	if len(fx.Kids) > 0 {
+		kids := core.MakeArray()
+		for _, kid := range fx.Kids {
+			kids.Append(fdfField(kid))
+		}
+		dict.Set("Kids", kids)
+		return dict
+	}
+	switch len(fx.Values) {
+	case 0:
+	case 1:
+		dict.Set("V", makeString(fx.Values[0]))
+	default:
+		arr := core.MakeArray()
+		for _, v := range fx.Values {
+			arr.Append(makeString(v))
+		}
+		dict.Set("V", arr)
+	}
+	return dict
+}
+
+// ReadJSON reads JSON form data from `r`: a list of {"name": ..., "value": ...} objects as written
+// by fjson, or an object of values by field name as read by forms/fill. Numbers are converted to
+// text and true and false to the check box states Yes and Off.
+func ReadJSON(r io.Reader) (*Document, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	values, err := fill.ParseValues(data)
+	if err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+	d := &Document{}
+	for name, v := range values {
+		d.Fields = append(d.Fields, &Field{Name: name, Values: jsonValues(v)})
+	}
+	sortFields(d.Fields)
+	return d, nil
+}
+
+// jsonValues returns the values of the JSON value `v`.
+func jsonValues(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case float64:
+		return []string{formatNumber(v)}
+	case bool:
+		if v {
+			return []string{"Yes"}
+		}
+		return []string{"Off"}
+	case []interface{}:
+		var values []string
+		for _, e := range v {
+			values = append(values, jsonValues(e)...)
+		}
+		return values
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// WriteJSON writes the field values of `d` to `w` as a list of {"name": ..., "value": ...}
+// objects, the format of fjson. Fields with several values get a list of values.
+func (d *Document) WriteJSON(w io.Writer) error {
+	type jsonField struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}
+	list := make([]jsonField, 0, len(d.Fields))
+	for _, f := range d.Fields {
+		jf := jsonField{Name: f.Name}
+		switch len(f.Values) {
+		case 0:
+			jf.Value = ""
+		case 1:
+			jf.Value = f.Values[0]
+		default:
+			jf.Value = f.Values
+		}
+		list = append(list, jf)
+	}
+	data, err := json.MarshalIndent(list, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
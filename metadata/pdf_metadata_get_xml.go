@@ -2,8 +2,9 @@
  * Outputs information XML metadata of root catalog for PDF files.
  *
  * Note: Each component within a PDF can have associated metadata stream. This example showcases
- * how to retrieve the metadata for the root catalog (typically document information). Similar methodology
- * can be applied to XML metadata for inner components.
+ * how to retrieve the metadata for the root catalog (typically document information) with the
+ * metadata/xmp package. Similar methodology can be applied to XML metadata for inner components,
+ * by parsing their decoded streams with xmp.Parse.
  *
  * Run as: go run pdf_metadata_get_xml.go input1.pdf [input2.pdf] ...
  */
@@ -11,16 +12,13 @@
 package main
 
 import (
-	"bytes"
-	"encoding/xml"
-	"errors"
 	"fmt"
 	"os"
-	"sort"
 
 	"github.com/unidoc/unipdf/v3/common/license"
-	"github.com/unidoc/unipdf/v3/core"
 	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/metadata/xmp"
 )
 
 func init() {
@@ -63,118 +61,24 @@ func printXMLMetadataForPdf(inputPath string) error {
 		return err
 	}
 
-	catalogDict, err := getRootCatalog(pdfReader)
-	if err != nil {
-		return err
-	}
-
-	// Get metadata.
-	metadataObj, err := resolve(pdfReader, catalogDict.Get("Metadata"))
+	// Get the metadata stream of the root catalog and parse it.
+	packet, err := xmp.Read(pdfReader)
 	if err != nil {
 		return err
 	}
-	metadataStream, has := metadataObj.(*core.PdfObjectStream)
-	if !has {
-		fmt.Printf("Metadata for root catalog not present")
+	if packet == nil {
+		fmt.Printf("Metadata for root catalog not present\n")
 		return nil
 	}
-	xmlMetadata, err := core.DecodeStream(metadataStream)
-	if err != nil {
-		return err
-	}
-	//fmt.Printf("Raw - XML Metadata: %s\n", xmlMetadata)
-
-	xmlDecoder := xml.NewDecoder(bytes.NewReader(xmlMetadata))
-	var xmp xmpMetadata
-	err = xmlDecoder.Decode(&xmp)
-	if err != nil {
-		return err
-	}
-
-	// Print xmp metadata.
-	xmp.print()
-
-	return nil
-}
-
-// getRootCatalog returns the root catalog for the PDF.
-// Note: a lot of the syntax here will be simplified in v3.
-func getRootCatalog(r *model.PdfReader) (*core.PdfObjectDictionary, error) {
-	// Trailer dictionary points to catalog.
-	trailerDict, err := r.GetTrailer()
-	if err != nil {
-		return nil, err
-	}
-	if trailerDict == nil {
-		return nil, errors.New("missing trailer dict")
-	}
-
-	// Get root catalog
-	catalogObj, err := resolve(r, trailerDict.Get("Root"))
-	if err != nil {
-		return nil, err
-	}
-	catalogDict, has := core.TraceToDirectObject(catalogObj).(*core.PdfObjectDictionary)
-	if !has {
-		return nil, errors.New("catalog dict missing")
-	}
 
-	return catalogDict, nil
-}
+	// Print the properties. Arrays and structures are printed with their items and fields
+	// indented below them.
+	fmt.Printf("XMP properties:\n")
+	packet.Print(os.Stdout)
 
-// resolve resolves references and returns only resolved objects within context of a specific reader `r`.
-// Note: This function will not be needed in v3 which simplifies working with PdfObjects.
-func resolve(r *model.PdfReader, obj core.PdfObject) (core.PdfObject, error) {
-	switch t := obj.(type) {
-	case *core.PdfObjectReference:
-		ref := t
-		var err error
-		obj, err = r.GetIndirectObjectByNumber(int(ref.ObjectNumber))
-		if err != nil {
-			return nil, err
-		}
-	}
-	return obj, nil
-}
-
-// xmpMetadata is a simple representation of XMP metadata. It can be used for unmarshalling of basic
-// XMP field data under XMP -> Description.
-// This serves for example use and can be extended for custom applications.
-type xmpMetadata struct {
-	Descriptions []struct {
-		Tags []struct {
-			XMLName xml.Name
-			//Value xml.CharData `xml:",chardata"`
-			Value xml.CharData `xml:",innerxml"`
-		} `xml:",any"`
-	} `xml:"RDF>Description"`
-}
-
-// keyValMap returns a key -> value map of Description data for XMP metadata.
-// Mostly
-func (xmp xmpMetadata) keyValMap() map[string]string {
-	keyVal := map[string]string{}
-
-	for _, desc := range xmp.Descriptions {
-		for _, tag := range desc.Tags {
-			keyVal[tag.XMLName.Local] = string(tag.Value)
-		}
-
-	}
-	return keyVal
-}
-
-func (xmp xmpMetadata) print() {
-	keyVal := xmp.keyValMap()
-
-	keys := []string{}
-	for key, _ := range keyVal {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
-
-	fmt.Printf("XMP RDF Description data:\n")
-	for _, key := range keys {
-		fmt.Printf("%s - %s\n", key, keyVal[key])
+	// Individual values are looked up by namespace and name.
+	if title, ok := packet.Get(xmp.NsDC, "title"); ok {
+		fmt.Printf("Title: %s\n", title)
 	}
+	return nil
 }
@@ -1,6 +1,7 @@
 /*
  * Generate multiple copy of template pdf file which contains different
- * Document Information Dictionary value.
+ * Document Information Dictionary value. If the template has XMP metadata, it is kept in sync with
+ * the custom information dictionary.
  *
  * Run as: go run pdf_metadata_set_docinfo.go template.pdf
  */
@@ -10,10 +11,13 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/unidoc/unipdf/v3/common/license"
 	"github.com/unidoc/unipdf/v3/core"
 	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/metadata/xmp"
 )
 
 func init() {
@@ -74,6 +78,26 @@ func main() {
 	pdfInfo.Subject = core.MakeString("PDF Example with custom information dictionary")
 	pdfInfo.AddCustomInfo("custom_info", "This is an optional custom info")
 
+	// Keep the XMP metadata in sync: the entries of the information dictionary replace their XMP
+	// equivalents and the XMP properties it lacks are copied back to it.
+	packet, err := xmp.Read(pdfReader)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if packet != nil {
+		packet.FromInfo(pdfInfo, true)
+		packet.SetModified(time.Now())
+		if err := packet.ToInfo(pdfInfo); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := xmp.SetDocumentMetadata(customPdfWriter, packet); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	customPdfWriter.SetDocInfo(pdfInfo)
 
 	err = customPdfWriter.WriteToFile("gen_pdf_custom_info.pdf")
@@ -0,0 +1,1033 @@
+/*
+ * Package pdfa converts PDF files to PDF/A-1b, PDF/A-2b or PDF/A-3b and validates PDF/A files.
+ *
+ * The conversion copies the document with a model.PdfWriter and changes the objects to write in
+ * an optimizer pass, which also reaches the catalog (the writer has no setters for its Metadata and
+ * OutputIntents entries):
+ *  - Fonts that are not embedded are replaced by embedded TrueType substitutes: fonts of the same
+ *    name from the font directories of the options or else the Go font of the same style.
+ *  - An output intent with an ICC profile (sRGB by default) is added.
+ *  - An XMP metadata stream with the PDF/A identification and the properties of the document
+ *    information dictionary is added. Both have the same values and dates.
+ *  - JavaScript, additional actions (AA) and actions PDF/A forbids are removed, as are annotation
+ *    types it forbids. Annotations are made printable and visible.
+ *  - The output is not encrypted and has a file identifier.
+ *  - LZW streams are re-encoded with Flate, external streams, transfer functions, PostScript
+ *    XObjects, OPI and alternate images are removed.
+ *  - PDF/A-1b: transparency is removed (soft masks of images are composited against white, soft
+ *    masks of graphics states are dropped, constant alpha is set to 1, blend modes to Normal and
+ *    transparency groups are removed), optional content and embedded files are removed.
+ *  - PDF/A-2b: embedded files are removed, as they would have to be PDF/A files too.
+ *  - PDF/A-3b: embedded files are kept as associated files of the document.
+ * What can't be fixed (e.g. symbolic or composite fonts that are not embedded, JPEG 2000 images in
+ * PDF/A-1b) is reported. Colors are not converted, so a document that uses CMYK colors needs a CMYK
+ * output intent profile.
+ *
+ * Validate checks the rules of the B conformance levels that can be checked on the object
+ * structure of a file and reports each violation with the number of the object it was found in.
+ * It does not check the font programs or the validity of content streams beyond their colors and
+ * inline images, so it does not replace a full validator such as veraPDF.
+ *
+ * Used by pdftool pdfa.
+ */
+
+package pdfa
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Level is a PDF/A part and conformance level.
+type Level string
+
+// PDF/A levels.
+const (
+	Level1B Level = "1b"
+	Level2B Level = "2b"
+	Level3B Level = "3b"
+)
+
+// ParseLevel parses a PDF/A level such as "1b" or "PDF/A-2b".
+func ParseLevel(s string) (Level, error) {
+	level := Level(strings.TrimPrefix(strings.ToLower(s), "pdf/a-"))
+	switch level {
+	case Level1B, Level2B, Level3B:
+		return level, nil
+	}
+	return "", fmt.Errorf("unknown PDF/A level %q: must be 1b, 2b or 3b", s)
+}
+
+// Part returns the part of the PDF/A standard, i.e. 1 for PDF/A-1.
+func (l Level) Part() int {
+	if l == "" {
+		return 0
+	}
+	return int(l[0] - '0')
+}
+
+// Conformance returns the conformance level as written in XMP metadata, e.g. "B".
+func (l Level) Conformance() string {
+	if l == "" {
+		return ""
+	}
+	return strings.ToUpper(string(l[1:]))
+}
+
+func (l Level) String() string {
+	return "PDF/A-" + string(l)
+}
+
+// Options controls the conversion.
+type Options struct {
+	// Level is the PDF/A level to convert to. Defaults to Level1B.
+	Level Level
+	// ICCProfile is the profile of the output intent. Defaults to SRGBProfile(). PDF/A-1 requires
+	// a version 2 profile.
+	ICCProfile []byte
+	// OutputCondition identifies the output condition of ICCProfile. Defaults to SRGBCondition for
+	// the built-in profile and to "Custom" otherwise.
+	OutputCondition string
+	// FontDirs are searched for TrueType fonts to embed in place of fonts that are not embedded.
+	FontDirs []string
+}
+
+// Report describes the changes made by Convert.
+type Report struct {
+	Level    Level    `json:"level"`
+	Changes  []string `json:"changes"`
+	Problems []string `json:"problems,omitempty"` // What could not be made conforming.
+}
+
+// Convert writes the document of `pdfReader` to `w` as a PDF/A file of the level in `opts`.
+func Convert(pdfReader *model.PdfReader, w io.Writer, opts Options) (*Report, error) {
+	if opts.Level == "" {
+		opts.Level = Level1B
+	}
+	if _, err := ParseLevel(string(opts.Level)); err != nil {
+		return nil, err
+	}
+	if opts.ICCProfile == nil {
+		opts.ICCProfile = SRGBProfile()
+		if opts.OutputCondition == "" {
+			opts.OutputCondition = SRGBCondition
+		}
+	}
+	if opts.OutputCondition == "" {
+		opts.OutputCondition = "Custom"
+	}
+	components, version, err := ProfileInfo(opts.ICCProfile)
+	if err != nil {
+		return nil, fmt.Errorf("output intent profile: %w", err)
+	}
+	if opts.Level == Level1B && version > 2 {
+		return nil, fmt.Errorf("output intent profile: PDF/A-1 requires a version 2 ICC profile, got version %d",
+			version)
+	}
+
+	info, err := readDocInfo(pdfReader)
+	if err != nil {
+		return nil, err
+	}
+	pdfWriter, err := pdfReader.ToWriter(&model.ReaderToWriterOpts{SkipOCProperties: opts.Level == Level1B})
+	if err != nil {
+		return nil, err
+	}
+	if opts.Level == Level1B {
+		pdfWriter.SetVersion(1, 4)
+	} else {
+		pdfWriter.SetVersion(1, 7)
+	}
+	custom, err := info.pdfInfo()
+	if err != nil {
+		return nil, err
+	}
+	pdfWriter.SetDocInfo(custom)
+
+	c := &converter{
+		opts:       opts,
+		components: components,
+		info:       custom,
+		fonts:      newFontSubstitutes(opts.FontDirs),
+		counts:     map[string]int{},
+		problems:   map[string]bool{},
+		done:       map[*core.PdfObjectDictionary]bool{},
+		detached:   map[core.PdfObject]bool{},
+	}
+	pdfWriter.SetOptimizer(c)
+
+	var buf bytes.Buffer
+	if err := pdfWriter.Write(&buf); err != nil {
+		return nil, err
+	}
+	data, err := addFileID(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	return c.report(), nil
+}
+
+// readDocInfo returns the document information of `pdfReader` with the modification date set to
+// now.
+func readDocInfo(pdfReader *model.PdfReader) (docInfo, error) {
+	now := time.Now().Truncate(time.Second)
+	info := docInfo{Producer: "UniPDF", Created: now, Modified: now}
+	pdfInfo, err := pdfReader.GetPdfInfo()
+	if err != nil {
+		return info, nil // No document information dictionary.
+	}
+	for _, field := range []struct {
+		str *core.PdfObjectString
+		val *string
+	}{
+		{pdfInfo.Title, &info.Title},
+		{pdfInfo.Author, &info.Author},
+		{pdfInfo.Subject, &info.Subject},
+		{pdfInfo.Keywords, &info.Keywords},
+		{pdfInfo.Creator, &info.Creator},
+		{pdfInfo.Producer, &info.Producer},
+	} {
+		if field.str != nil && field.str.Decoded() != "" {
+			*field.val = field.str.Decoded()
+		}
+	}
+	if pdfInfo.Trapped != nil && (*pdfInfo.Trapped == "True" || *pdfInfo.Trapped == "False") {
+		info.Trapped = string(*pdfInfo.Trapped)
+	}
+	if pdfInfo.CreationDate != nil {
+		info.Created = pdfInfo.CreationDate.ToGoTime()
+	}
+	return info, nil
+}
+
+// pdfInfo returns the document information dictionary for `info`.
+func (info docInfo) pdfInfo() (*model.PdfInfo, error) {
+	text := func(s string) *core.PdfObjectString {
+		if s == "" {
+			return nil
+		}
+		for _, r := range s {
+			if r > 0x7e {
+				return core.MakeEncodedString(s, true)
+			}
+		}
+		return core.MakeString(s)
+	}
+	created, err := model.NewPdfDateFromTime(info.Created)
+	if err != nil {
+		return nil, err
+	}
+	modified, err := model.NewPdfDateFromTime(info.Modified)
+	if err != nil {
+		return nil, err
+	}
+	pdfInfo := &model.PdfInfo{
+		Title:        text(info.Title),
+		Author:       text(info.Author),
+		Subject:      text(info.Subject),
+		Keywords:     text(info.Keywords),
+		Creator:      text(info.Creator),
+		Producer:     text(info.Producer),
+		CreationDate: &created,
+		ModifiedDate: &modified,
+	}
+	if info.Trapped != "" {
+		pdfInfo.Trapped = core.MakeName(info.Trapped)
+	}
+	return pdfInfo, nil
+}
+
+// addFileID adds a file identifier to the trailer of the PDF file `data`, which PDF/A requires and
+// model.PdfWriter only writes for encrypted files.
+func addFileID(data []byte) ([]byte, error) {
+	i := bytes.LastIndex(data, []byte("trailer"))
+	if i < 0 {
+		return nil, errors.New("trailer not found")
+	}
+	j := bytes.Index(data[i:], []byte("<<"))
+	if j < 0 {
+		return nil, errors.New("trailer dictionary not found")
+	}
+	j += i + 2
+	if bytes.Contains(data[j:], []byte("/ID")) {
+		return data, nil
+	}
+	sum := md5.Sum(append(data[:i:i], time.Now().String()...))
+	id := fmt.Sprintf("/ID [<%x> <%x>] ", sum, sum)
+	return append(data[:j:j], append([]byte(id), data[j:]...)...), nil
+}
+
+// forbiddenActions are the action types PDF/A forbids, by part.
+var forbiddenActions = map[int]map[string]bool{
+	1: {"Launch": true, "Sound": true, "Movie": true, "ResetForm": true, "ImportData": true,
+		"JavaScript": true, "SetOCGState": true, "Rendition": true, "Trans": true, "GoTo3DView": true},
+	2: {"Launch": true, "Sound": true, "Movie": true, "ResetForm": true, "ImportData": true,
+		"JavaScript": true, "Hide": true, "SetOCGState": true, "Rendition": true, "Trans": true,
+		"GoTo3DView": true},
+}
+
+// namedActions are the Named actions PDF/A permits.
+var namedActions = map[string]bool{"NextPage": true, "PrevPage": true, "FirstPage": true, "LastPage": true}
+
+// forbiddenAction returns the type of action `action` if PDF/A `level` forbids it.
+func forbiddenAction(level Level, action *core.PdfObjectDictionary) (string, bool) {
+	s, ok := core.GetNameVal(action.Get("S"))
+	if !ok {
+		return "", false
+	}
+	part := level.Part()
+	if part > 2 {
+		part = 2
+	}
+	if forbiddenActions[part][s] {
+		return s, true
+	}
+	if n, _ := core.GetNameVal(action.Get("N")); s == "Named" && !namedActions[n] {
+		return "Named " + n, true
+	}
+	return "", false
+}
+
+// annotationTypes are the annotation subtypes defined by PDF 1.4, the only ones PDF/A-1 permits
+// besides FileAttachment, Sound and Movie, which it forbids.
+var annotationTypes = map[string]bool{
+	"Text": true, "Link": true, "FreeText": true, "Line": true, "Square": true, "Circle": true,
+	"Highlight": true, "Underline": true, "Squiggly": true, "StrikeOut": true, "Stamp": true,
+	"Ink": true, "Popup": true, "Widget": true, "PrinterMark": true, "TrapNet": true,
+}
+
+// forbiddenAnnotation returns true if PDF/A `level` forbids annotations of type `subtype`.
+func forbiddenAnnotation(level Level, subtype string) bool {
+	if level.Part() == 1 {
+		return !annotationTypes[subtype]
+	}
+	switch subtype {
+	case "Sound", "Movie", "Screen", "3D", "RichMedia":
+		return true
+	}
+	return false
+}
+
+// isAnnotation returns true if `d` is an annotation dictionary.
+func isAnnotation(d *core.PdfObjectDictionary) bool {
+	if d.Get("Rect") == nil {
+		return false
+	}
+	if typ, ok := core.GetNameVal(d.Get("Type")); ok {
+		return typ == "Annot"
+	}
+	subtype, _ := core.GetNameVal(d.Get("Subtype"))
+	return subtype != "" && (annotationTypes[subtype] || forbiddenAnnotation(Level2B, subtype) ||
+		subtype == "FileAttachment" || subtype == "Polygon" || subtype == "PolyLine" ||
+		subtype == "Caret" || subtype == "Redact" || subtype == "Watermark")
+}
+
+// Annotation flags.
+const (
+	flagInvisible    = 1
+	flagHidden       = 2
+	flagPrint        = 4
+	flagNoView       = 32
+	flagToggleNoView = 256
+)
+
+// filterNames returns the filter names of stream dictionary `d`.
+func filterNames(d *core.PdfObjectDictionary) []string {
+	var names []string
+	switch t := core.TraceToDirectObject(d.Get("Filter")).(type) {
+	case *core.PdfObjectName:
+		names = append(names, string(*t))
+	case *core.PdfObjectArray:
+		for _, obj := range t.Elements() {
+			if name, ok := core.GetNameVal(obj); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// hasFilter returns true if stream dictionary `d` has filter `name`.
+func hasFilter(d *core.PdfObjectDictionary, name string) bool {
+	for _, f := range filterNames(d) {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// walkObject calls `fn` for each dictionary of the numbered object `obj`, including the
+// dictionaries nested in it, with the stream for stream dictionaries. Other numbered objects that
+// `obj` refers to are not visited.
+func walkObject(obj core.PdfObject, fn func(d *core.PdfObjectDictionary, stream *core.PdfObjectStream)) {
+	switch t := obj.(type) {
+	case *core.PdfIndirectObject:
+		walkDirect(t.PdfObject, fn)
+	case *core.PdfObjectStream:
+		fn(t.PdfObjectDictionary, t)
+		walkKeys(t.PdfObjectDictionary, fn)
+	}
+}
+
+// walkDirect calls `fn` for `obj` and the dictionaries nested in it, if it is a direct object.
+func walkDirect(obj core.PdfObject, fn func(d *core.PdfObjectDictionary, stream *core.PdfObjectStream)) {
+	switch t := obj.(type) {
+	case *core.PdfObjectDictionary:
+		fn(t, nil)
+		walkKeys(t, fn)
+	case *core.PdfObjectArray:
+		for _, elem := range t.Elements() {
+			walkDirect(elem, fn)
+		}
+	}
+}
+
+// walkKeys walks the values of dictionary `d`.
+func walkKeys(d *core.PdfObjectDictionary, fn func(d *core.PdfObjectDictionary, stream *core.PdfObjectStream)) {
+	for _, key := range append([]core.PdfObjectName(nil), d.Keys()...) {
+		walkDirect(d.Get(key), fn)
+	}
+}
+
+// nameTreeValues returns the values of name tree `tree`.
+func nameTreeValues(tree core.PdfObject) []core.PdfObject {
+	var values []core.PdfObject
+	var walk func(node core.PdfObject, depth int)
+	walk = func(node core.PdfObject, depth int) {
+		d, ok := core.GetDict(node)
+		if !ok || depth > 32 {
+			return
+		}
+		if names, ok := core.GetArray(d.Get("Names")); ok {
+			for i := 1; i < names.Len(); i += 2 {
+				values = append(values, names.Get(i))
+			}
+		}
+		if kids, ok := core.GetArray(d.Get("Kids")); ok {
+			for _, kid := range kids.Elements() {
+				walk(kid, depth+1)
+			}
+		}
+	}
+	walk(tree, 0)
+	return values
+}
+
+// converter changes the objects written by a PdfWriter into PDF/A objects. It implements the
+// model.Optimizer interface.
+type converter struct {
+	opts       Options
+	components int // Of the output intent profile.
+	info       *model.PdfInfo
+	fonts      *fontSubstitutes
+	counts     map[string]int
+	changes    []string
+	problems   map[string]bool
+	problemLog []string
+	done       map[*core.PdfObjectDictionary]bool
+	// detached are the objects no longer referenced by the objects that were changed. They are
+	// not written unless other objects refer to them.
+	detached map[core.PdfObject]bool
+}
+
+// change records a change.
+func (c *converter) change(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if c.counts[msg] == 0 {
+		c.changes = append(c.changes, msg)
+	}
+	c.counts[msg]++
+}
+
+// problem records something that could not be fixed.
+func (c *converter) problem(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if !c.problems[msg] {
+		c.problems[msg] = true
+		c.problemLog = append(c.problemLog, msg)
+	}
+}
+
+// detach marks `obj` as no longer referenced from where it was removed.
+func (c *converter) detach(obj core.PdfObject) {
+	switch obj.(type) {
+	case *core.PdfIndirectObject, *core.PdfObjectStream:
+		c.detached[obj] = true
+	}
+}
+
+// report returns the report of the conversion.
+func (c *converter) report() *Report {
+	report := &Report{Level: c.opts.Level, Changes: []string{}, Problems: c.problemLog}
+	for _, msg := range c.changes {
+		if n := c.counts[msg]; n > 1 {
+			msg = fmt.Sprintf("%s (%d times)", msg, n)
+		}
+		report.Changes = append(report.Changes, msg)
+	}
+	return report
+}
+
+// Optimize implements the model.Optimizer interface. It changes `objects`, the objects that are
+// about to be written, and adds the objects of the output intent, the metadata and the embedded
+// fonts.
+func (c *converter) Optimize(objects []core.PdfObject) ([]core.PdfObject, error) {
+	var catalog *core.PdfObjectDictionary
+	for _, obj := range objects {
+		if ind, ok := obj.(*core.PdfIndirectObject); ok {
+			if d, ok := ind.PdfObject.(*core.PdfObjectDictionary); ok {
+				if typ, _ := core.GetNameVal(d.Get("Type")); typ == "Catalog" {
+					catalog = d
+					break
+				}
+			}
+		}
+	}
+	if catalog == nil {
+		return nil, errors.New("pdfa: catalog not found")
+	}
+	if err := c.fixCatalog(catalog); err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		walkObject(obj, c.fixDict)
+	}
+	return c.closure(objects), nil
+}
+
+// closure returns `objects` without the detached objects that are no longer referenced, and with
+// the objects that were added.
+func (c *converter) closure(objects []core.PdfObject) []core.PdfObject {
+	// Everything only reachable through detached objects is detached too.
+	detached := map[core.PdfObject]bool{}
+	var mark func(obj core.PdfObject)
+	mark = func(obj core.PdfObject) {
+		if detached[obj] {
+			return
+		}
+		detached[obj] = true
+		forEachReference(obj, mark)
+	}
+	for obj := range c.detached {
+		mark(obj)
+	}
+
+	kept := map[core.PdfObject]bool{}
+	var result []core.PdfObject
+	var keep func(obj core.PdfObject)
+	keep = func(obj core.PdfObject) {
+		if kept[obj] {
+			return
+		}
+		kept[obj] = true
+		result = append(result, obj)
+		forEachReference(obj, keep)
+	}
+	for _, obj := range objects {
+		if !detached[obj] {
+			keep(obj)
+		}
+	}
+	return result
+}
+
+// forEachReference calls `fn` for each numbered object `obj` refers to.
+func forEachReference(obj core.PdfObject, fn func(obj core.PdfObject)) {
+	var visit func(obj core.PdfObject, top bool)
+	visit = func(obj core.PdfObject, top bool) {
+		switch t := obj.(type) {
+		case *core.PdfIndirectObject:
+			if !top {
+				fn(t)
+				return
+			}
+			visit(t.PdfObject, false)
+		case *core.PdfObjectStream:
+			if !top {
+				fn(t)
+				return
+			}
+			visit(t.PdfObjectDictionary, false)
+		case *core.PdfObjectDictionary:
+			for _, key := range t.Keys() {
+				visit(t.Get(key), false)
+			}
+		case *core.PdfObjectArray:
+			for _, elem := range t.Elements() {
+				visit(elem, false)
+			}
+		}
+	}
+	visit(obj, true)
+}
+
+// fixCatalog adds the metadata and the output intent to `catalog` and removes the document level
+// features PDF/A forbids.
+func (c *converter) fixCatalog(catalog *core.PdfObjectDictionary) error {
+	level := c.opts.Level
+	if names, ok := core.GetDict(catalog.Get("Names")); ok {
+		if js := names.Get("JavaScript"); js != nil {
+			names.Remove("JavaScript")
+			c.detach(js)
+			c.change("removed document JavaScript")
+		}
+		if files := names.Get("EmbeddedFiles"); files != nil {
+			if level == Level3B {
+				c.associateFiles(catalog, files)
+			} else {
+				names.Remove("EmbeddedFiles")
+				c.detach(files)
+				c.change("removed embedded files")
+			}
+		}
+	}
+	if form, ok := core.GetDict(catalog.Get("AcroForm")); ok {
+		if form.Get("NeedAppearances") != nil {
+			form.Remove("NeedAppearances")
+			c.change("removed NeedAppearances from the form")
+		}
+		if xfa := form.Get("XFA"); xfa != nil {
+			form.Remove("XFA")
+			c.detach(xfa)
+			c.change("removed XFA form")
+		}
+	}
+	if ocProperties := catalog.Get("OCProperties"); ocProperties != nil && level == Level1B {
+		catalog.Remove("OCProperties")
+		c.detach(ocProperties)
+		c.change("removed optional content")
+	}
+
+	packet, err := xmpPacket(level, c.info)
+	if err != nil {
+		return err
+	}
+	metadata, err := core.MakeStream(packet, nil)
+	if err != nil {
+		return err
+	}
+	metadata.Set("Type", core.MakeName("Metadata"))
+	metadata.Set("Subtype", core.MakeName("XML"))
+	catalog.Set("Metadata", metadata)
+	c.change("added %s XMP metadata", level)
+
+	profile, err := core.MakeStream(c.opts.ICCProfile, core.NewFlateEncoder())
+	if err != nil {
+		return err
+	}
+	profile.Set("N", core.MakeInteger(int64(c.components)))
+	intent := core.MakeIndirectObject(core.MakeDictMap(map[string]core.PdfObject{
+		"Type":                      core.MakeName("OutputIntent"),
+		"S":                         core.MakeName("GTS_PDFA1"),
+		"OutputConditionIdentifier": core.MakeString(c.opts.OutputCondition),
+		"Info":                      core.MakeString(c.opts.OutputCondition),
+		"DestOutputProfile":         profile,
+	}))
+	if old := catalog.Get("OutputIntents"); old != nil {
+		c.detach(old)
+	}
+	catalog.Set("OutputIntents", core.MakeArray(intent))
+	c.change("added output intent %q", c.opts.OutputCondition)
+	return nil
+}
+
+// associateFiles makes the embedded files of name tree `files` associated files of the document,
+// as PDF/A-3 requires.
+func (c *converter) associateFiles(catalog *core.PdfObjectDictionary, files core.PdfObject) {
+	af := core.MakeArray()
+	for _, spec := range nameTreeValues(files) {
+		d, ok := core.GetDict(spec)
+		if !ok {
+			continue
+		}
+		if d.Get("AFRelationship") == nil {
+			d.Set("AFRelationship", core.MakeName("Unspecified"))
+		}
+		if d.Get("UF") == nil && d.Get("F") != nil {
+			d.Set("UF", d.Get("F"))
+		}
+		if ef, ok := core.GetDict(d.Get("EF")); ok {
+			if stream, ok := core.GetStream(ef.Get("F")); ok && stream.Get("Subtype") == nil {
+				stream.Set("Subtype", core.MakeName("application/octet-stream"))
+			}
+		}
+		af.Append(spec)
+		c.change("made embedded file an associated file")
+	}
+	if af.Len() > 0 {
+		catalog.Set("AF", af)
+	}
+}
+
+// fixDict makes dictionary `d` (of `stream` for stream dictionaries) conforming.
+func (c *converter) fixDict(d *core.PdfObjectDictionary, stream *core.PdfObjectStream) {
+	if c.done[d] {
+		return
+	}
+	c.done[d] = true
+	typ, _ := core.GetNameVal(d.Get("Type"))
+
+	c.removeActions(d)
+	if gsMap, ok := core.GetDict(d.Get("ExtGState")); ok {
+		for _, name := range gsMap.Keys() {
+			if gs, ok := core.GetDict(gsMap.Get(name)); ok {
+				c.fixExtGState(gs)
+			}
+		}
+	}
+	if c.opts.Level == Level1B {
+		if group, ok := core.GetDict(d.Get("Group")); ok {
+			if s, _ := core.GetNameVal(group.Get("S")); s == "Transparency" {
+				d.Remove("Group")
+				c.change("removed transparency group")
+			}
+		}
+	}
+	switch {
+	case typ == "Font":
+		c.fixFont(d)
+	case typ == "Page":
+		c.fixAnnotations(d)
+	case isAnnotation(d):
+		c.fixAnnotation(d)
+	}
+	if stream != nil {
+		c.fixStream(stream)
+	}
+}
+
+// removeActions removes the actions of `d` that PDF/A forbids and its additional actions.
+func (c *converter) removeActions(d *core.PdfObjectDictionary) {
+	for _, key := range []core.PdfObjectName{"A", "PA", "OpenAction", "Next"} {
+		obj := d.Get(key)
+		if next, ok := core.GetArray(obj); ok && key == "Next" {
+			kept := core.MakeArray()
+			for _, elem := range next.Elements() {
+				if action, ok := core.GetDict(elem); ok {
+					if s, forbidden := forbiddenAction(c.opts.Level, action); forbidden {
+						c.detach(elem)
+						c.change("removed %s action", s)
+						continue
+					}
+				}
+				kept.Append(elem)
+			}
+			d.Set(key, kept)
+			continue
+		}
+		if action, ok := core.GetDict(obj); ok {
+			if s, forbidden := forbiddenAction(c.opts.Level, action); forbidden {
+				d.Remove(key)
+				c.detach(obj)
+				c.change("removed %s action", s)
+			}
+		}
+	}
+	if aa := d.Get("AA"); aa != nil {
+		d.Remove("AA")
+		c.detach(aa)
+		c.change("removed additional actions (AA)")
+	}
+}
+
+// fixExtGState removes transfer functions and, for PDF/A-1, transparency from graphics state `gs`.
+func (c *converter) fixExtGState(gs *core.PdfObjectDictionary) {
+	if c.done[gs] {
+		return
+	}
+	c.done[gs] = true
+	if tr := gs.Get("TR"); tr != nil {
+		gs.Remove("TR")
+		c.detach(tr)
+		c.change("removed transfer function")
+	}
+	if tr2 := gs.Get("TR2"); tr2 != nil {
+		if name, _ := core.GetNameVal(tr2); name != "Default" {
+			gs.Set("TR2", core.MakeName("Default"))
+			c.detach(tr2)
+			c.change("removed transfer function")
+		}
+	}
+	if c.opts.Level != Level1B {
+		return
+	}
+	if smask := gs.Get("SMask"); smask != nil {
+		if name, _ := core.GetNameVal(smask); name != "None" {
+			gs.Set("SMask", core.MakeName("None"))
+			c.detach(smask)
+			c.change("removed soft mask of graphics state")
+		}
+	}
+	for _, key := range []core.PdfObjectName{"CA", "ca"} {
+		if alpha, err := core.GetNumberAsFloat(gs.Get(key)); err == nil && alpha != 1 {
+			gs.Set(key, core.MakeFloat(1))
+			c.change("set constant alpha to 1")
+		}
+	}
+	if bm := gs.Get("BM"); bm != nil {
+		if name, _ := core.GetNameVal(bm); name != "Normal" && name != "Compatible" {
+			gs.Set("BM", core.MakeName("Normal"))
+			c.change("set blend mode to Normal")
+		}
+	}
+}
+
+// fixAnnotations removes the annotations PDF/A forbids from page `page`.
+func (c *converter) fixAnnotations(page *core.PdfObjectDictionary) {
+	annots, ok := core.GetArray(page.Get("Annots"))
+	if !ok {
+		return
+	}
+	kept := core.MakeArray()
+	for _, obj := range annots.Elements() {
+		if annot, ok := core.GetDict(obj); ok {
+			subtype, _ := core.GetNameVal(annot.Get("Subtype"))
+			if forbiddenAnnotation(c.opts.Level, subtype) {
+				c.detach(obj)
+				c.change("removed %s annotation", subtype)
+				continue
+			}
+		}
+		kept.Append(obj)
+	}
+	page.Set("Annots", kept)
+}
+
+// fixAnnotation makes annotation `annot` printable and visible, and opaque for PDF/A-1.
+func (c *converter) fixAnnotation(annot *core.PdfObjectDictionary) {
+	if subtype, _ := core.GetNameVal(annot.Get("Subtype")); subtype == "Popup" {
+		return
+	}
+	flags, _ := core.GetIntVal(annot.Get("F"))
+	fixed := (flags | flagPrint) &^ (flagInvisible | flagHidden | flagNoView | flagToggleNoView)
+	if fixed != flags || annot.Get("F") == nil {
+		annot.Set("F", core.MakeInteger(int64(fixed)))
+		c.change("made annotation printable and visible")
+	}
+	if c.opts.Level == Level1B {
+		if alpha, err := core.GetNumberAsFloat(annot.Get("CA")); err == nil && alpha != 1 {
+			annot.Set("CA", core.MakeFloat(1))
+			c.change("set constant alpha to 1")
+		}
+	}
+}
+
+// fixFont embeds a substitute for font `font` if it is not embedded.
+func (c *converter) fixFont(font *core.PdfObjectDictionary) {
+	if isEmbedded(font) {
+		return
+	}
+	baseFont, _ := core.GetNameVal(font.Get("BaseFont"))
+	subtype, _ := core.GetNameVal(font.Get("Subtype"))
+	switch subtype {
+	case "Type1", "MMType1", "TrueType":
+	case "Type0":
+		c.problem("composite font %s is not embedded", baseFont)
+		return
+	default:
+		return // Descendant fonts are handled with their Type0 font.
+	}
+	name, err := c.fonts.embedSubstitute(font)
+	if err != nil {
+		c.problem("%v", err)
+		return
+	}
+	c.change("embedded %s in place of %s", name, baseFont)
+}
+
+// fixStream makes `stream` conforming.
+func (c *converter) fixStream(stream *core.PdfObjectStream) {
+	d := stream.PdfObjectDictionary
+	typ, _ := core.GetNameVal(d.Get("Type"))
+	subtype, _ := core.GetNameVal(d.Get("Subtype"))
+
+	for _, key := range []core.PdfObjectName{"F", "FFilter", "FDecodeParms"} {
+		if typ != "EmbeddedFile" && d.Get(key) != nil {
+			d.Remove(key)
+			c.change("removed external stream reference")
+		}
+	}
+	if hasFilter(d, "LZWDecode") {
+		c.reencode(stream, "re-encoded LZW stream with Flate")
+	}
+	if typ == "Metadata" && c.opts.Level == Level1B && len(filterNames(d)) > 0 {
+		c.reencode(stream, "")
+	}
+
+	switch subtype {
+	case "Image":
+		c.fixImage(stream)
+	case "Form":
+		for _, key := range []core.PdfObjectName{"OPI", "PS", "Subtype2"} {
+			if d.Get(key) != nil {
+				d.Remove(key)
+				c.change("removed %s from form XObject", key)
+			}
+		}
+	case "PS":
+		// PostScript XObjects are only used when printing to PostScript; an empty form XObject
+		// paints the same on screen.
+		d.Set("Subtype", core.MakeName("Form"))
+		d.Set("BBox", core.MakeArrayFromFloats([]float64{0, 0, 0, 0}))
+		for _, key := range []core.PdfObjectName{"Filter", "DecodeParms", "Level1"} {
+			d.Remove(key)
+		}
+		stream.Stream = nil
+		d.Set("Length", core.MakeInteger(0))
+		c.change("replaced PostScript XObject with an empty form XObject")
+	}
+}
+
+// fixImage makes image XObject `stream` conforming.
+func (c *converter) fixImage(stream *core.PdfObjectStream) {
+	d := stream.PdfObjectDictionary
+	if interpolate, _ := core.GetBoolVal(d.Get("Interpolate")); interpolate {
+		d.Remove("Interpolate")
+		c.change("disabled image interpolation")
+	}
+	for _, key := range []core.PdfObjectName{"Alternates", "OPI"} {
+		if obj := d.Get(key); obj != nil {
+			d.Remove(key)
+			c.detach(obj)
+			c.change("removed %s of image", key)
+		}
+	}
+	if c.opts.Level != Level1B {
+		return
+	}
+	if hasFilter(d, "JPXDecode") {
+		c.problem("JPEG 2000 images are not permitted in PDF/A-1")
+	}
+	if d.Get("SMaskInData") != nil {
+		d.Remove("SMaskInData")
+		c.change("removed soft mask in JPEG 2000 image data")
+	}
+	if smask := d.Get("SMask"); smask != nil {
+		if err := flattenSoftMask(stream); err != nil {
+			d.Remove("SMask")
+			c.change("removed soft mask of image without compositing (%v)", err)
+		} else {
+			c.change("composited image with its soft mask")
+		}
+		c.detach(smask)
+	}
+}
+
+// reencode stores `stream` with Flate, or unfiltered if `change` is empty.
+func (c *converter) reencode(stream *core.PdfObjectStream, change string) {
+	for _, name := range filterNames(stream.PdfObjectDictionary) {
+		switch name {
+		case "DCTDecode", "JPXDecode", "JBIG2Decode", "CCITTFaxDecode":
+			c.problem("can't re-encode stream with filter %s", name)
+			return
+		}
+	}
+	data, err := core.DecodeStream(stream)
+	if err != nil {
+		c.problem("can't decode stream: %v", err)
+		return
+	}
+	stream.Remove("DecodeParms")
+	if change == "" {
+		stream.Remove("Filter")
+	} else {
+		if data, err = core.NewFlateEncoder().EncodeBytes(data); err != nil {
+			c.problem("can't encode stream: %v", err)
+			return
+		}
+		stream.Set("Filter", core.MakeName(core.StreamEncodingFilterNameFlate))
+		c.change(change)
+	}
+	stream.Stream = data
+	stream.Set("Length", core.MakeInteger(int64(len(data))))
+}
+
+// flattenSoftMask composites image XObject `stream` with its soft mask against a white backdrop
+// and removes the soft mask. The image is stored with Flate.
+func flattenSoftMask(stream *core.PdfObjectStream) error {
+	d := stream.PdfObjectDictionary
+	maskStream, ok := core.GetStream(d.Get("SMask"))
+	if !ok {
+		d.Remove("SMask")
+		return nil
+	}
+	ximg, err := model.NewXObjectImageFromStream(stream)
+	if err != nil {
+		return err
+	}
+	xmask, err := model.NewXObjectImageFromStream(maskStream)
+	if err != nil {
+		return err
+	}
+
+	// White in the sample values of the color space.
+	white := 1.0
+	switch cs := ximg.ColorSpace.(type) {
+	case *model.PdfColorspaceDeviceGray, *model.PdfColorspaceDeviceRGB, *model.PdfColorspaceCalGray,
+		*model.PdfColorspaceCalRGB:
+	case *model.PdfColorspaceDeviceCMYK:
+		white = 0
+	case *model.PdfColorspaceICCBased:
+		if cs.N == 4 {
+			white = 0
+		}
+	default:
+		return fmt.Errorf("unsupported color space %s", ximg.ColorSpace)
+	}
+
+	img, err := ximg.ToImage()
+	if err != nil {
+		return err
+	}
+	mask, err := xmask.ToImage()
+	if err != nil {
+		return err
+	}
+	if img.Width == 0 || img.Height == 0 || mask.Width == 0 || mask.Height == 0 {
+		return errors.New("empty image")
+	}
+	samples := img.GetSamples()
+	alpha := mask.GetSamples()
+	n := img.ColorComponents
+	maxVal := float64(uint32(1)<<uint(img.BitsPerComponent) - 1)
+	maxAlpha := float64(uint32(1)<<uint(mask.BitsPerComponent) - 1)
+	if len(samples) < int(img.Width*img.Height)*n || len(alpha) < int(mask.Width*mask.Height) {
+		return errors.New("truncated image data")
+	}
+	for y := 0; y < int(img.Height); y++ {
+		my := y * int(mask.Height) / int(img.Height)
+		for x := 0; x < int(img.Width); x++ {
+			mx := x * int(mask.Width) / int(img.Width)
+			a := float64(alpha[my*int(mask.Width)+mx]) / maxAlpha
+			for k := 0; k < n; k++ {
+				i := (y*int(img.Width)+x)*n + k
+				v := float64(samples[i])*a + white*maxVal*(1-a)
+				samples[i] = uint32(v + 0.5)
+			}
+		}
+	}
+	img.SetSamples(samples)
+
+	data, err := core.NewFlateEncoder().EncodeBytes(img.Data)
+	if err != nil {
+		return err
+	}
+	stream.Stream = data
+	d.Set("Filter", core.MakeName(core.StreamEncodingFilterNameFlate))
+	d.Remove("DecodeParms")
+	d.Remove("SMask")
+	d.Set("Length", core.MakeInteger(int64(len(data))))
+	return nil
+}
@@ -0,0 +1,328 @@
+/*
+ * Embedding of substitute fonts for fonts that are not embedded.
+ */
+
+package pdfa
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// substitute is a TrueType font that replaces fonts that are not embedded.
+type substitute struct {
+	name       string
+	descriptor *core.PdfIndirectObject // Shared by all fonts replaced by this substitute.
+	font       *model.PdfFont
+}
+
+// fontSubstitutes finds and loads substitute fonts.
+type fontSubstitutes struct {
+	dirs   []string
+	files  map[string]string // Normalized font name -> TrueType file in dirs.
+	loaded map[string]*substitute
+}
+
+// newFontSubstitutes returns a fontSubstitutes that looks up fonts in `dirs` before falling back
+// to the Go fonts.
+func newFontSubstitutes(dirs []string) *fontSubstitutes {
+	return &fontSubstitutes{dirs: dirs, loaded: map[string]*substitute{}}
+}
+
+// lookup returns the substitute for the font named `baseFont`: the font of that name in the font
+// directories or else the Go font of the same style.
+func (s *fontSubstitutes) lookup(baseFont string) (*substitute, error) {
+	if err := s.index(); err != nil {
+		return nil, err
+	}
+	key := normalizeFontName(baseFont)
+	if path, ok := s.files[key]; ok {
+		return s.load(path, func() ([]byte, error) { return ioutil.ReadFile(path) })
+	}
+
+	bold := strings.Contains(key, "bold") || strings.Contains(key, "black") || strings.Contains(key, "heavy")
+	italic := strings.Contains(key, "italic") || strings.Contains(key, "oblique")
+	mono := strings.Contains(key, "courier") || strings.Contains(key, "mono")
+	ttfs := [2][2][2][]byte{
+		{{goregular.TTF, goitalic.TTF}, {gobold.TTF, gobolditalic.TTF}},
+		{{gomono.TTF, gomonoitalic.TTF}, {gomonobold.TTF, gomonobolditalic.TTF}},
+	}
+	ttf := ttfs[index(mono)][index(bold)][index(italic)]
+	name := fmt.Sprintf("go/mono=%t/bold=%t/italic=%t", mono, bold, italic)
+	return s.load(name, func() ([]byte, error) { return ttf, nil })
+}
+
+// load returns the substitute identified by `key`, reading it with `read` the first time.
+func (s *fontSubstitutes) load(key string, read func() ([]byte, error)) (*substitute, error) {
+	if sub, ok := s.loaded[key]; ok {
+		return sub, nil
+	}
+	data, err := read()
+	if err != nil {
+		return nil, err
+	}
+	font, err := model.NewPdfFontFromTTF(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	fontDict, ok := core.GetDict(font.ToPdfObject())
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid font", key)
+	}
+	descriptor, ok := fontDict.Get("FontDescriptor").(*core.PdfIndirectObject)
+	if !ok {
+		return nil, fmt.Errorf("%s: missing font descriptor", key)
+	}
+	sub := &substitute{name: font.BaseFont(), descriptor: descriptor, font: font}
+	s.loaded[key] = sub
+	return sub, nil
+}
+
+// index maps the names of the TrueType fonts in the font directories to their files. Fonts are
+// known by their PostScript name and by their file name.
+func (s *fontSubstitutes) index() error {
+	if s.files != nil {
+		return nil
+	}
+	s.files = map[string]string{}
+	for _, dir := range s.dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || strings.ToLower(filepath.Ext(path)) != ".ttf" {
+				return nil
+			}
+			base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			if _, ok := s.files[normalizeFontName(base)]; !ok {
+				s.files[normalizeFontName(base)] = path
+			}
+			font, err := model.NewPdfFontFromTTFFile(path)
+			if err != nil {
+				return nil // Not a usable TrueType font.
+			}
+			s.files[normalizeFontName(font.BaseFont())] = path
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeFontName returns `name` without subset prefix, lowercase and without separators and
+// the "MT"/"PSMT" suffixes of Monotype names, so that e.g. "ABCDEF+Arial,Bold", "Arial-BoldMT"
+// and "arialbold" match.
+func normalizeFontName(name string) string {
+	if i := strings.IndexByte(name, '+'); i == 6 {
+		name = name[i+1:]
+	}
+	name = strings.ToLower(name)
+	name = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == ',' || r == '_' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSuffix(name, "psmt")
+	name = strings.TrimSuffix(name, "mt")
+	return name
+}
+
+// index returns 1 for true and 0 for false.
+func index(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// isEmbedded returns true if the font dictionary `fontDict` has an embedded font program. Type3
+// fonts have their glyphs in content streams and are always embedded. For composite fonts the
+// descendant font is checked.
+func isEmbedded(fontDict *core.PdfObjectDictionary) bool {
+	subtype, _ := core.GetNameVal(fontDict.Get("Subtype"))
+	switch subtype {
+	case "Type3":
+		return true
+	case "Type0":
+		descendants, ok := core.GetArray(fontDict.Get("DescendantFonts"))
+		if !ok || descendants.Len() == 0 {
+			return false
+		}
+		descendant, ok := core.GetDict(descendants.Get(0))
+		if !ok {
+			return false
+		}
+		fontDict = descendant
+	}
+	descriptor, ok := core.GetDict(fontDict.Get("FontDescriptor"))
+	if !ok {
+		return false
+	}
+	for _, key := range []core.PdfObjectName{"FontFile", "FontFile2", "FontFile3"} {
+		if _, ok := core.GetStream(descriptor.Get(key)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// standardDifferences are the glyph names of the codes where StandardEncoding, the built-in
+// encoding of the standard Latin fonts, differs from WinAnsiEncoding.
+var standardDifferences = map[int]string{
+	0x27: "quoteright", 0x60: "quoteleft",
+	0xa1: "exclamdown", 0xa2: "cent", 0xa3: "sterling", 0xa4: "fraction", 0xa5: "yen",
+	0xa6: "florin", 0xa7: "section", 0xa8: "currency", 0xa9: "quotesingle", 0xaa: "quotedblleft",
+	0xab: "guillemotleft", 0xac: "guilsinglleft", 0xad: "guilsinglright", 0xae: "fi", 0xaf: "fl",
+	0xb1: "endash", 0xb2: "dagger", 0xb3: "daggerdbl", 0xb4: "periodcentered", 0xb6: "paragraph",
+	0xb7: "bullet", 0xb8: "quotesinglbase", 0xb9: "quotedblbase", 0xba: "quotedblright",
+	0xbb: "guillemotright", 0xbc: "ellipsis", 0xbd: "perthousand", 0xbf: "questiondown",
+	0xc1: "grave", 0xc2: "acute", 0xc3: "circumflex", 0xc4: "tilde", 0xc5: "macron", 0xc6: "breve",
+	0xc7: "dotaccent", 0xc8: "dieresis", 0xca: "ring", 0xcb: "cedilla", 0xcd: "hungarumlaut",
+	0xce: "ogonek", 0xcf: "caron", 0xd0: "emdash", 0xe1: "AE", 0xe3: "ordfeminine", 0xe8: "Lslash",
+	0xe9: "Oslash", 0xea: "OE", 0xeb: "ordmasculine", 0xf1: "ae", 0xf5: "dotlessi", 0xf8: "lslash",
+	0xf9: "oslash", 0xfa: "oe", 0xfb: "germandbls",
+}
+
+// substituteEncoding returns the encoding of a non-symbolic TrueType font that keeps the character
+// codes of the simple font encoding `encoding`. PDF/A only allows WinAnsiEncoding and
+// MacRomanEncoding as base encodings of non-symbolic TrueType fonts, so other base encodings,
+// including the StandardEncoding of fonts without an encoding, are expressed as differences to
+// WinAnsiEncoding.
+func substituteEncoding(encoding core.PdfObject) core.PdfObject {
+	base := "StandardEncoding"
+	differences := map[int]string{}
+	switch t := core.TraceToDirectObject(encoding).(type) {
+	case *core.PdfObjectName:
+		base = string(*t)
+	case *core.PdfObjectDictionary:
+		if name, ok := core.GetNameVal(t.Get("BaseEncoding")); ok {
+			base = name
+		}
+		if diffs, ok := core.GetArray(t.Get("Differences")); ok {
+			code := 0
+			for _, obj := range diffs.Elements() {
+				if c, ok := core.GetIntVal(obj); ok {
+					code = c
+				} else if name, ok := core.GetNameVal(obj); ok {
+					differences[code] = name
+					code++
+				}
+			}
+		}
+	}
+	if base == "WinAnsiEncoding" || base == "MacRomanEncoding" {
+		if len(differences) == 0 {
+			return core.MakeName(base)
+		}
+	} else {
+		for code, name := range standardDifferences {
+			if _, ok := differences[code]; !ok {
+				differences[code] = name
+			}
+		}
+		base = "WinAnsiEncoding"
+	}
+
+	codes := make([]int, 0, len(differences))
+	for code := range differences {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	diffs := core.MakeArray()
+	for i, code := range codes {
+		if i == 0 || codes[i-1] != code-1 {
+			diffs.Append(core.MakeInteger(int64(code)))
+		}
+		diffs.Append(core.MakeName(differences[code]))
+	}
+	return core.MakeDictMap(map[string]core.PdfObject{
+		"Type":         core.MakeName("Encoding"),
+		"BaseEncoding": core.MakeName(base),
+		"Differences":  diffs,
+	})
+}
+
+// embedSubstitute replaces the simple font `fontDict`, which has no embedded font program, by an
+// embedded TrueType substitute that keeps its character codes. The widths are those of the
+// substitute, as PDF/A requires them to match the embedded font program, so text set in the
+// substitute can be narrower or wider than the original. Symbolic fonts are not replaced. Returns
+// the name of the substitute.
+func (s *fontSubstitutes) embedSubstitute(fontDict *core.PdfObjectDictionary) (string, error) {
+	baseFont, _ := core.GetNameVal(fontDict.Get("BaseFont"))
+	font, err := model.NewPdfFontFromPdfObject(fontDict)
+	if err != nil {
+		return "", fmt.Errorf("font %s: %w", baseFont, err)
+	}
+	symbolic := false
+	if descriptor, ok := core.GetDict(fontDict.Get("FontDescriptor")); ok {
+		flags, _ := core.GetIntVal(descriptor.Get("Flags"))
+		symbolic = flags&4 != 0
+	}
+	if key := normalizeFontName(baseFont); key == "symbol" || key == "zapfdingbats" {
+		symbolic = true
+	}
+	if symbolic {
+		// The glyphs of symbolic fonts are selected by their built-in encoding, which is lost.
+		return "", fmt.Errorf("font %s: no substitute for symbolic fonts", baseFont)
+	}
+	sub, err := s.lookup(baseFont)
+	if err != nil {
+		return "", err
+	}
+
+	firstChar, lastChar := 0, 255
+	if v, ok := core.GetIntVal(fontDict.Get("FirstChar")); ok && v >= 0 && v <= 255 {
+		firstChar = v
+	}
+	if v, ok := core.GetIntVal(fontDict.Get("LastChar")); ok && v >= firstChar && v <= 255 {
+		lastChar = v
+	}
+	missing, _ := core.GetNumberAsFloat(sub.descriptor.PdfObject.(*core.PdfObjectDictionary).Get("MissingWidth"))
+	widths := core.MakeArray()
+	for code := firstChar; code <= lastChar; code++ {
+		width := missing
+		if str, _, _ := font.CharcodeBytesToUnicode([]byte{byte(code)}); str != "" {
+			if metrics, ok := sub.font.GetRuneMetrics([]rune(str)[0]); ok {
+				width = metrics.Wx
+			}
+		}
+		widths.Append(core.MakeInteger(int64(width + 0.5)))
+	}
+
+	encoding := fontDict.Get("Encoding")
+	toUnicode := fontDict.Get("ToUnicode")
+	for _, key := range append([]core.PdfObjectName(nil), fontDict.Keys()...) {
+		fontDict.Remove(key)
+	}
+	fontDict.Set("Type", core.MakeName("Font"))
+	fontDict.Set("Subtype", core.MakeName("TrueType"))
+	fontDict.Set("BaseFont", core.MakeName(sub.name))
+	fontDict.Set("FirstChar", core.MakeInteger(int64(firstChar)))
+	fontDict.Set("LastChar", core.MakeInteger(int64(lastChar)))
+	fontDict.Set("Widths", widths)
+	fontDict.Set("Encoding", substituteEncoding(encoding))
+	fontDict.Set("FontDescriptor", sub.descriptor)
+	if toUnicode != nil {
+		fontDict.Set("ToUnicode", toUnicode)
+	}
+	return sub.name, nil
+}
@@ -0,0 +1,136 @@
+/*
+ * ICC profiles for the output intents of PDF/A files.
+ */
+
+package pdfa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// SRGBCondition is the output condition identifier of the built-in sRGB profile.
+const SRGBCondition = "sRGB IEC61966-2.1"
+
+// SRGBProfile returns a version 2 ICC display profile for sRGB: the sRGB primaries adapted to D50
+// and the sRGB tone curve sampled at 1024 points. Version 2 profiles are accepted by all PDF/A
+// parts.
+func SRGBProfile() []byte {
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	trc := curve(1024, func(x float64) float64 {
+		if x <= 0.04045 {
+			return x / 12.92
+		}
+		return math.Pow((x+0.055)/1.055, 2.4)
+	})
+	tags := []tag{
+		{"desc", textDescription(SRGBCondition)},
+		{"cprt", text("No copyright, use freely")},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4360747, 0.2225045, 0.0139322)},
+		{"gXYZ", xyz(0.3850649, 0.7168786, 0.0971045)},
+		{"bXYZ", xyz(0.1430804, 0.0606169, 0.7141733)},
+		{"rTRC", trc},
+		{"gTRC", trc},
+		{"bTRC", trc},
+	}
+
+	// The tag data follows the header (128 bytes) and the tag table. Identical data is shared.
+	offset := 128 + 4 + 12*len(tags)
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	offsets := map[string]int{}
+	for _, t := range tags {
+		off, ok := offsets[string(t.data)]
+		if !ok {
+			off = offset + data.Len()
+			offsets[string(t.data)] = off
+			data.Write(t.data)
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+		}
+		table.WriteString(t.sig)
+		binary.Write(&table, binary.BigEndian, uint32(off))
+		binary.Write(&table, binary.BigEndian, uint32(len(t.data)))
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(128+table.Len()+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // Version 2.1.
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	for i, v := range []uint16{2000, 1, 1, 0, 0, 0} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	copy(header[68:], xyz(0.9642, 1.0, 0.8249)[8:]) // PCS illuminant D50.
+
+	var profile bytes.Buffer
+	profile.Write(header)
+	profile.Write(table.Bytes())
+	profile.Write(data.Bytes())
+	return profile.Bytes()
+}
+
+// ProfileInfo returns the number of color components of ICC profile `data` and its major version.
+func ProfileInfo(data []byte) (components, version int, err error) {
+	if len(data) < 128 || string(data[36:40]) != "acsp" {
+		return 0, 0, fmt.Errorf("not an ICC profile")
+	}
+	switch string(data[16:20]) {
+	case "GRAY":
+		components = 1
+	case "RGB ":
+		components = 3
+	case "CMYK":
+		components = 4
+	default:
+		return 0, 0, fmt.Errorf("unsupported ICC profile color space %q", data[16:20])
+	}
+	return components, int(data[8]), nil
+}
+
+// xyz returns an XYZType tag.
+func xyz(x, y, z float64) []byte {
+	var b bytes.Buffer
+	b.WriteString("XYZ \x00\x00\x00\x00")
+	for _, v := range []float64{x, y, z} {
+		binary.Write(&b, binary.BigEndian, int32(math.Round(v*65536)))
+	}
+	return b.Bytes()
+}
+
+// curve returns a curveType tag with `n` samples of `f` over [0, 1].
+func curve(n int, f func(float64) float64) []byte {
+	var b bytes.Buffer
+	b.WriteString("curv\x00\x00\x00\x00")
+	binary.Write(&b, binary.BigEndian, uint32(n))
+	for i := 0; i < n; i++ {
+		v := f(float64(i) / float64(n-1))
+		binary.Write(&b, binary.BigEndian, uint16(math.Round(v*65535)))
+	}
+	return b.Bytes()
+}
+
+// textDescription returns a version 2 textDescriptionType tag with ASCII text `s`.
+func textDescription(s string) []byte {
+	var b bytes.Buffer
+	b.WriteString("desc\x00\x00\x00\x00")
+	binary.Write(&b, binary.BigEndian, uint32(len(s)+1))
+	b.WriteString(s)
+	b.WriteByte(0)
+	b.Write(make([]byte, 4+4+2+1+67)) // No Unicode and ScriptCode descriptions.
+	return b.Bytes()
+}
+
+// text returns a textType tag.
+func text(s string) []byte {
+	return []byte("text\x00\x00\x00\x00" + s + "\x00")
+}
@@ -0,0 +1,590 @@
+/*
+ * Validation of PDF/A files.
+ */
+
+package pdfa
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/contentstream"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/metadata/xmp"
+)
+
+// Violation is a violation of a PDF/A rule.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Object  int64  `json:"object,omitempty"` // Number of the object it was found in, 0 for the document.
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Object == 0 {
+		return fmt.Sprintf("%-22s %s", v.Rule, v.Message)
+	}
+	return fmt.Sprintf("%-22s %d 0 R: %s", v.Rule, v.Object, v.Message)
+}
+
+// Claimed returns the PDF/A level the XMP metadata of `pdfReader` identifies, or "" if it has none.
+func Claimed(pdfReader *model.PdfReader) (Level, error) {
+	catalog, _, err := catalogOf(pdfReader)
+	if err != nil {
+		return "", err
+	}
+	packet, err := documentXMP(catalog)
+	if err != nil || packet == nil {
+		return "", err
+	}
+	return claimedLevel(packet), nil
+}
+
+// catalogOf returns the catalog of `pdfReader` and its object number.
+func catalogOf(pdfReader *model.PdfReader) (*core.PdfObjectDictionary, int64, error) {
+	trailer, err := pdfReader.GetTrailer()
+	if err != nil {
+		return nil, 0, err
+	}
+	catalog, ok := core.GetDict(trailer.Get("Root"))
+	if !ok {
+		return nil, 0, fmt.Errorf("missing catalog")
+	}
+	return catalog, objectNumber(trailer.Get("Root"), 0), nil
+}
+
+// documentXMP returns the document XMP metadata of `catalog`, or nil if it has none.
+func documentXMP(catalog *core.PdfObjectDictionary) (*xmp.Packet, error) {
+	stream, ok := core.GetStream(catalog.Get("Metadata"))
+	if !ok {
+		return nil, nil
+	}
+	data, err := core.DecodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	return xmp.Parse(data)
+}
+
+// claimedLevel returns the PDF/A level identified by `packet`.
+func claimedLevel(packet *xmp.Packet) Level {
+	part, _ := packet.Get(xmp.NsPDFAID, "part")
+	conformance, _ := packet.Get(xmp.NsPDFAID, "conformance")
+	level, err := ParseLevel(part.String() + strings.ToLower(conformance.String()))
+	if err != nil {
+		return ""
+	}
+	return level
+}
+
+// objectNumber returns the object number of `obj` if it is a reference, else `num`.
+func objectNumber(obj core.PdfObject, num int64) int64 {
+	switch t := obj.(type) {
+	case *core.PdfObjectReference:
+		return t.ObjectNumber
+	case *core.PdfIndirectObject:
+		return t.ObjectNumber
+	case *core.PdfObjectStream:
+		return t.ObjectNumber
+	}
+	return num
+}
+
+// validator collects the violations of a file.
+type validator struct {
+	level      Level
+	violations []Violation
+	// colors maps the device color spaces used to the first object they are used in.
+	colors map[string]int64
+}
+
+// add records a violation of `rule` in object `num`.
+func (v *validator) add(rule string, num int64, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{Rule: rule, Object: num, Message: fmt.Sprintf(format, args...)})
+}
+
+// useColor records the use of device color space `name` in object `num`.
+func (v *validator) useColor(name string, num int64) {
+	switch name {
+	case "DeviceRGB", "RGB":
+		name = "DeviceRGB"
+	case "DeviceCMYK", "CMYK":
+		name = "DeviceCMYK"
+	case "DeviceGray", "G":
+		name = "DeviceGray"
+	default:
+		return
+	}
+	if _, ok := v.colors[name]; !ok {
+		v.colors[name] = num
+	}
+}
+
+// Validate checks `pdfReader` against the rules of PDF/A `level`, or the level its metadata claims
+// if `level` is empty, and returns the violations found. Files that claim no level are validated
+// as PDF/A-1b.
+func Validate(pdfReader *model.PdfReader, level Level) ([]Violation, error) {
+	trailer, err := pdfReader.GetTrailer()
+	if err != nil {
+		return nil, err
+	}
+	catalog, catalogNum, err := catalogOf(pdfReader)
+	if err != nil {
+		return nil, err
+	}
+	v := &validator{level: level, colors: map[string]int64{}}
+
+	packet, err := documentXMP(catalog)
+	if err != nil {
+		v.add("metadata", catalogNum, "invalid XMP metadata: %v", err)
+	}
+	claimed := claimedLevel(packet)
+	if v.level == "" {
+		v.level = claimed
+		if v.level == "" {
+			v.level = Level1B
+		}
+	}
+	switch {
+	case packet == nil && err == nil:
+		v.add("metadata", catalogNum, "no XMP metadata")
+	case claimed == "":
+		v.add("pdfa-identification", catalogNum, "XMP metadata does not identify a PDF/A level")
+	case claimed != v.level:
+		v.add("pdfa-identification", catalogNum, "XMP metadata identifies %s, not %s", claimed, v.level)
+	}
+
+	if trailer.Get("Encrypt") != nil {
+		v.add("encryption", 0, "file is encrypted")
+	}
+	if ids, ok := core.GetArray(trailer.Get("ID")); !ok || ids.Len() != 2 {
+		v.add("file-identifier", 0, "trailer has no file identifier (ID)")
+	}
+	if packet != nil {
+		v.checkInfo(trailer, packet)
+	}
+	components := v.checkOutputIntents(catalog, catalogNum)
+
+	for _, num := range pdfReader.GetObjectNums() {
+		obj, err := pdfReader.GetIndirectObjectByNumber(num)
+		if err != nil {
+			v.add("syntax", int64(num), "can't read object: %v", err)
+			continue
+		}
+		walkObject(obj, func(d *core.PdfObjectDictionary, stream *core.PdfObjectStream) {
+			v.checkDict(int64(num), d, stream)
+		})
+	}
+
+	for _, name := range []string{"DeviceRGB", "DeviceCMYK", "DeviceGray"} {
+		num, ok := v.colors[name]
+		if !ok {
+			continue
+		}
+		switch {
+		case components == 0:
+			v.add("output-intent", num, "%s used without a PDF/A output intent", name)
+		case name == "DeviceRGB" && components != 3:
+			v.add("output-intent", num, "DeviceRGB used with a %d component output intent", components)
+		case name == "DeviceCMYK" && components != 4:
+			v.add("output-intent", num, "DeviceCMYK used with a %d component output intent", components)
+		}
+	}
+	return v.violations, nil
+}
+
+// checkInfo checks that the entries of the document information dictionary of `trailer` match
+// their XMP equivalents in `packet`.
+func (v *validator) checkInfo(trailer *core.PdfObjectDictionary, packet *xmp.Packet) {
+	info, ok := core.GetDict(trailer.Get("Info"))
+	if !ok {
+		return
+	}
+	num := objectNumber(trailer.Get("Info"), 0)
+	for _, ip := range xmp.InfoProperties {
+		var value string
+		switch obj := core.TraceToDirectObject(info.Get(core.PdfObjectName(ip.Key))).(type) {
+		case *core.PdfObjectString:
+			value = obj.Decoded()
+		case *core.PdfObjectName:
+			value = string(*obj)
+		default:
+			continue
+		}
+		xmpValue, ok := packet.Get(ip.Namespace, ip.Name)
+		if !ok {
+			v.add("metadata-consistency", num, "%s has no XMP equivalent", ip.Key)
+			continue
+		}
+		if !ip.IsDate() {
+			if value != xmpValue.String() {
+				v.add("metadata-consistency", num, "%s %q differs from XMP %q", ip.Key, value, xmpValue)
+			}
+			continue
+		}
+		date, err := model.NewPdfDate(value)
+		if err != nil {
+			v.add("metadata-consistency", num, "invalid %s %q", ip.Key, value)
+			continue
+		}
+		t, err := xmp.ParseDate(xmpValue.String())
+		if err != nil || !t.Equal(date.ToGoTime()) {
+			v.add("metadata-consistency", num, "%s %s differs from XMP %q", ip.Key,
+				date.ToGoTime().Format(time.RFC3339), xmpValue)
+		}
+	}
+}
+
+// checkOutputIntents checks the PDF/A output intents of `catalog` and returns the number of color
+// components of their profile, 0 if there is none.
+func (v *validator) checkOutputIntents(catalog *core.PdfObjectDictionary, catalogNum int64) int {
+	intents, ok := core.GetArray(catalog.Get("OutputIntents"))
+	if !ok {
+		return 0
+	}
+	components := 0
+	var profile *core.PdfObjectStream
+	for _, obj := range intents.Elements() {
+		intent, ok := core.GetDict(obj)
+		if !ok {
+			continue
+		}
+		if s, _ := core.GetNameVal(intent.Get("S")); s != "GTS_PDFA1" {
+			continue
+		}
+		num := objectNumber(obj, catalogNum)
+		stream, ok := core.GetStream(intent.Get("DestOutputProfile"))
+		if !ok {
+			v.add("output-intent", num, "output intent has no DestOutputProfile")
+			continue
+		}
+		if profile != nil && profile != stream {
+			v.add("output-intent", num, "PDF/A output intents have different profiles")
+			continue
+		}
+		profile = stream
+		data, err := core.DecodeStream(stream)
+		if err != nil {
+			v.add("output-intent", objectNumber(intent.Get("DestOutputProfile"), num), "can't decode profile: %v", err)
+			continue
+		}
+		n, version, err := ProfileInfo(data)
+		if err != nil {
+			v.add("output-intent", objectNumber(intent.Get("DestOutputProfile"), num), "%v", err)
+			continue
+		}
+		if v.level == Level1B && version > 2 {
+			v.add("output-intent", objectNumber(intent.Get("DestOutputProfile"), num),
+				"PDF/A-1 requires a version 2 ICC profile, got version %d", version)
+		}
+		components = n
+	}
+	return components
+}
+
+// checkDict checks dictionary `d` (of `stream` for stream dictionaries), found in object `num`.
+func (v *validator) checkDict(num int64, d *core.PdfObjectDictionary, stream *core.PdfObjectStream) {
+	typ, _ := core.GetNameVal(d.Get("Type"))
+	subtype, _ := core.GetNameVal(d.Get("Subtype"))
+
+	if _, ok := core.GetNameVal(d.Get("S")); ok && (typ == "" || typ == "Action") {
+		if s, forbidden := forbiddenAction(v.level, d); forbidden {
+			v.add("action", num, "%s action is not permitted", s)
+		}
+	}
+	if d.Get("AA") != nil {
+		v.add("additional-actions", num, "additional actions (AA) are not permitted")
+	}
+	if gsMap, ok := core.GetDict(d.Get("ExtGState")); ok {
+		for _, name := range gsMap.Keys() {
+			if gs, ok := core.GetDict(gsMap.Get(name)); ok {
+				v.checkExtGState(objectNumber(gsMap.Get(name), num), gs)
+			}
+		}
+	}
+	if csMap, ok := core.GetDict(d.Get("ColorSpace")); ok {
+		for _, name := range csMap.Keys() {
+			v.checkColorSpace(objectNumber(csMap.Get(name), num), csMap.Get(name))
+		}
+	} else if cs := d.Get("ColorSpace"); cs != nil {
+		v.checkColorSpace(num, cs)
+	}
+	if group, ok := core.GetDict(d.Get("Group")); ok && v.level == Level1B {
+		if s, _ := core.GetNameVal(group.Get("S")); s == "Transparency" {
+			v.add("transparency", num, "transparency group")
+		}
+	}
+
+	switch {
+	case typ == "Catalog":
+		v.checkCatalog(num, d)
+	case typ == "Font":
+		if subtype != "Type0" && !isEmbedded(d) {
+			baseFont, _ := core.GetNameVal(d.Get("BaseFont"))
+			v.add("font-embedding", num, "font %s is not embedded", baseFont)
+		}
+	case typ == "Page":
+		v.checkContents(num, d.Get("Contents"))
+	case typ == "Filespec" || d.Get("EF") != nil:
+		v.checkFilespec(num, d)
+	case isAnnotation(d):
+		v.checkAnnotation(num, d)
+	case d.Get("Fields") != nil:
+		if need, _ := core.GetBoolVal(d.Get("NeedAppearances")); need {
+			v.add("need-appearances", num, "NeedAppearances is true")
+		}
+		if d.Get("XFA") != nil {
+			v.add("xfa", num, "XFA forms are not permitted")
+		}
+	}
+
+	if stream != nil {
+		v.checkStream(num, stream, typ, subtype)
+	}
+}
+
+// checkCatalog checks the document level entries of `catalog`.
+func (v *validator) checkCatalog(num int64, catalog *core.PdfObjectDictionary) {
+	if catalog.Get("OCProperties") != nil && v.level == Level1B {
+		v.add("optional-content", num, "optional content is not permitted in PDF/A-1")
+	}
+	if names, ok := core.GetDict(catalog.Get("Names")); ok {
+		if names.Get("JavaScript") != nil {
+			v.add("javascript", objectNumber(catalog.Get("Names"), num), "document JavaScript is not permitted")
+		}
+	}
+	if catalog.Get("Metadata") == nil {
+		return
+	}
+	if stream, ok := core.GetStream(catalog.Get("Metadata")); ok && v.level == Level1B {
+		if len(filterNames(stream.PdfObjectDictionary)) > 0 {
+			v.add("metadata", objectNumber(catalog.Get("Metadata"), num), "metadata stream is filtered")
+		}
+	}
+}
+
+// checkExtGState checks graphics state `gs`.
+func (v *validator) checkExtGState(num int64, gs *core.PdfObjectDictionary) {
+	if gs.Get("TR") != nil {
+		v.add("transfer-function", num, "transfer functions (TR) are not permitted")
+	}
+	if tr2 := gs.Get("TR2"); tr2 != nil {
+		if name, _ := core.GetNameVal(tr2); name != "Default" {
+			v.add("transfer-function", num, "transfer functions (TR2) are not permitted")
+		}
+	}
+	if v.level != Level1B {
+		return
+	}
+	if smask, _ := core.GetNameVal(gs.Get("SMask")); gs.Get("SMask") != nil && smask != "None" {
+		v.add("transparency", num, "soft mask in graphics state")
+	}
+	for _, key := range []core.PdfObjectName{"CA", "ca"} {
+		if alpha, err := core.GetNumberAsFloat(gs.Get(key)); err == nil && alpha != 1 {
+			v.add("transparency", num, "constant alpha %s is %g", key, alpha)
+		}
+	}
+	if bm, ok := core.GetNameVal(gs.Get("BM")); ok && bm != "Normal" && bm != "Compatible" {
+		v.add("transparency", num, "blend mode %s", bm)
+	}
+}
+
+// checkColorSpace records the device color spaces used by color space `cs`.
+func (v *validator) checkColorSpace(num int64, cs core.PdfObject) {
+	switch t := core.TraceToDirectObject(cs).(type) {
+	case *core.PdfObjectName:
+		v.useColor(string(*t), num)
+	case *core.PdfObjectArray:
+		family, _ := core.GetNameVal(t.Get(0))
+		switch family {
+		case "Indexed":
+			v.checkColorSpace(num, t.Get(1))
+		case "Separation", "DeviceN":
+			v.checkColorSpace(num, t.Get(2))
+		case "Pattern":
+			if t.Len() > 1 {
+				v.checkColorSpace(num, t.Get(1))
+			}
+		}
+	}
+}
+
+// checkContents records the device colors used by the content stream(s) `contents`.
+func (v *validator) checkContents(num int64, contents core.PdfObject) {
+	streams := []core.PdfObject{contents}
+	if arr, ok := core.GetArray(contents); ok {
+		streams = arr.Elements()
+	}
+	for _, obj := range streams {
+		if stream, ok := core.GetStream(obj); ok {
+			v.checkContentStream(objectNumber(obj, num), stream)
+		}
+	}
+}
+
+// checkContentStream records the device colors used by content stream `stream` and checks its
+// inline images.
+func (v *validator) checkContentStream(num int64, stream *core.PdfObjectStream) {
+	data, err := core.DecodeStream(stream)
+	if err != nil {
+		v.add("syntax", num, "can't decode content stream: %v", err)
+		return
+	}
+	ops, err := contentstream.NewContentStreamParser(string(data)).Parse()
+	if err != nil {
+		v.add("syntax", num, "can't parse content stream: %v", err)
+		return
+	}
+	for _, op := range *ops {
+		switch op.Operand {
+		case "rg", "RG":
+			v.useColor("DeviceRGB", num)
+		case "k", "K":
+			v.useColor("DeviceCMYK", num)
+		case "g", "G":
+			v.useColor("DeviceGray", num)
+		case "cs", "CS":
+			if len(op.Params) == 1 {
+				if name, ok := core.GetNameVal(op.Params[0]); ok {
+					v.useColor(name, num)
+				}
+			}
+		case "BI":
+			if len(op.Params) != 1 {
+				continue
+			}
+			img, ok := op.Params[0].(*contentstream.ContentStreamInlineImage)
+			if !ok {
+				continue
+			}
+			if name, ok := core.GetNameVal(img.ColorSpace); ok {
+				v.useColor(name, num)
+			}
+			filters := []core.PdfObject{img.Filter}
+			if arr, ok := core.GetArray(img.Filter); ok {
+				filters = arr.Elements()
+			}
+			for _, f := range filters {
+				if name, _ := core.GetNameVal(f); name == "LZW" || name == "LZWDecode" {
+					v.add("lzw", num, "inline image with LZW compression")
+				} else if (name == "JPX" || name == "JPXDecode") && v.level == Level1B {
+					v.add("jpx", num, "inline image with JPEG 2000 compression")
+				}
+			}
+			if interpolate, _ := core.GetBoolVal(img.Interpolate); interpolate {
+				v.add("interpolate", num, "inline image with Interpolate true")
+			}
+		}
+	}
+}
+
+// checkFilespec checks file specification `spec`.
+func (v *validator) checkFilespec(num int64, spec *core.PdfObjectDictionary) {
+	if spec.Get("EF") == nil {
+		return
+	}
+	switch v.level {
+	case Level1B:
+		v.add("embedded-files", num, "embedded files are not permitted in PDF/A-1")
+	case Level2B:
+		v.add("embedded-files", num, "embedded files must be PDF/A files, which is not verified")
+	case Level3B:
+		if spec.Get("AFRelationship") == nil {
+			v.add("associated-files", num, "embedded file has no AFRelationship")
+		}
+		if ef, ok := core.GetDict(spec.Get("EF")); ok {
+			if stream, ok := core.GetStream(ef.Get("F")); ok && stream.Get("Subtype") == nil {
+				v.add("associated-files", objectNumber(ef.Get("F"), num), "embedded file has no MIME type (Subtype)")
+			}
+		}
+	}
+}
+
+// checkAnnotation checks annotation `annot`.
+func (v *validator) checkAnnotation(num int64, annot *core.PdfObjectDictionary) {
+	subtype, _ := core.GetNameVal(annot.Get("Subtype"))
+	if forbiddenAnnotation(v.level, subtype) {
+		v.add("annotation-type", num, "%s annotations are not permitted", subtype)
+	}
+	if subtype == "Popup" {
+		return
+	}
+	flags, _ := core.GetIntVal(annot.Get("F"))
+	if flags&flagPrint == 0 || flags&(flagInvisible|flagHidden|flagNoView|flagToggleNoView) != 0 {
+		v.add("annotation-flags", num, "%s annotation is not printable and visible (F %d)", subtype, flags)
+	}
+	if v.level == Level1B {
+		if alpha, err := core.GetNumberAsFloat(annot.Get("CA")); err == nil && alpha != 1 {
+			v.add("transparency", num, "%s annotation with constant alpha %g", subtype, alpha)
+		}
+		return
+	}
+	if subtype == "Link" {
+		return
+	}
+	if rect, ok := core.GetArray(annot.Get("Rect")); ok {
+		if r, err := rect.ToFloat64Array(); err == nil && len(r) == 4 && (r[0] == r[2] || r[1] == r[3]) {
+			return
+		}
+	}
+	ap, ok := core.GetDict(annot.Get("AP"))
+	if !ok || ap.Get("N") == nil {
+		v.add("annotation-appearance", num, "%s annotation has no normal appearance", subtype)
+	}
+}
+
+// checkStream checks stream `stream` of type `typ` and subtype `subtype`.
+func (v *validator) checkStream(num int64, stream *core.PdfObjectStream, typ, subtype string) {
+	d := stream.PdfObjectDictionary
+	for _, key := range []core.PdfObjectName{"F", "FFilter", "FDecodeParms"} {
+		if d.Get(key) != nil {
+			v.add("external-stream", num, "stream with external data (%s)", key)
+		}
+	}
+	if hasFilter(d, "LZWDecode") {
+		v.add("lzw", num, "LZW compression is not permitted")
+	}
+	if typ == "Metadata" && v.level == Level1B && len(filterNames(d)) > 0 {
+		v.add("metadata", num, "metadata stream is filtered")
+	}
+
+	switch subtype {
+	case "Image":
+		if hasFilter(d, "JPXDecode") && v.level == Level1B {
+			v.add("jpx", num, "JPEG 2000 images are not permitted in PDF/A-1")
+		}
+		if interpolate, _ := core.GetBoolVal(d.Get("Interpolate")); interpolate {
+			v.add("interpolate", num, "image with Interpolate true")
+		}
+		if d.Get("Alternates") != nil {
+			v.add("alternate-images", num, "alternate images are not permitted")
+		}
+		if d.Get("OPI") != nil {
+			v.add("opi", num, "OPI is not permitted")
+		}
+		if v.level == Level1B {
+			if smask, _ := core.GetNameVal(d.Get("SMask")); d.Get("SMask") != nil && smask != "None" {
+				v.add("transparency", num, "image with soft mask")
+			}
+			if smaskInData, _ := core.GetIntVal(d.Get("SMaskInData")); smaskInData != 0 {
+				v.add("transparency", num, "image with soft mask in JPEG 2000 data")
+			}
+		}
+	case "Form":
+		if d.Get("OPI") != nil {
+			v.add("opi", num, "OPI is not permitted")
+		}
+		if d.Get("PS") != nil {
+			v.add("postscript", num, "form XObject with PostScript (PS)")
+		}
+		if subtype2, _ := core.GetNameVal(d.Get("Subtype2")); subtype2 == "PS" {
+			v.add("postscript", num, "PostScript form XObject (Subtype2 PS)")
+		}
+		v.checkContentStream(num, stream)
+	case "PS":
+		v.add("postscript", num, "PostScript XObjects are not permitted")
+	}
+}
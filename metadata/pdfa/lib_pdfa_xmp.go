@@ -0,0 +1,41 @@
+/*
+ * XMP metadata of PDF/A files: the packet written by Convert.
+ */
+
+package pdfa
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/metadata/xmp"
+)
+
+// docInfo is the document information written both to the Info dictionary and to the XMP metadata.
+type docInfo struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	Creator  string
+	Producer string
+	Trapped  string // True or False, empty if not set.
+	Created  time.Time
+	Modified time.Time
+}
+
+// xmpPacket returns an XMP packet identifying the file as PDF/A `level` with the properties of
+// the document information dictionary `info`.
+func xmpPacket(level Level, info *model.PdfInfo) ([]byte, error) {
+	p := xmp.New()
+	p.Set(xmp.NsPDFAID, "part", xmp.Text(strconv.Itoa(level.Part())))
+	p.Set(xmp.NsPDFAID, "conformance", xmp.Text(level.Conformance()))
+	p.Set(xmp.NsDC, "format", xmp.Text("application/pdf"))
+	p.FromInfo(info, true)
+	if modified, ok := p.Get(xmp.NsXMP, "ModifyDate"); ok {
+		p.Set(xmp.NsXMP, "MetadataDate", modified)
+	}
+	return p.Marshal()
+}
@@ -0,0 +1,665 @@
+/*
+ * Package xmp reads, edits and writes XMP metadata packets, such as the metadata stream of a PDF
+ * document.
+ *
+ * A Packet holds the top level properties of a packet, each identified by its namespace URI and
+ * name. Values are simple (text or URI), arrays (Bag, Seq, Alt, including language alternatives
+ * with xml:lang) or structures, and can be nested. Properties of any namespace can be set; prefixes
+ * of unknown namespaces are taken from the parsed packet, registered with RegisterNamespace or
+ * generated. PDF/A extension schemas, which describe custom namespaces to PDF/A validators, are
+ * read and written with Extensions and AddExtension.
+ *
+ * The RDF/XML parser covers the forms XMP writers use: properties as elements or as attributes of
+ * rdf:Description, rdf:resource, arrays of rdf:li items and structures as rdf:parseType="Resource",
+ * nested rdf:Description or attributes. Qualifiers other than xml:lang are dropped.
+ *
+ * The entries of the document information dictionary have XMP equivalents, see InfoProperties.
+ * FromInfo and ToInfo keep both in sync, and Read and SetDocumentMetadata read and write the
+ * metadata stream of a PDF document.
+ *
+ * Used by pdftool xmp, metadata/pdfa and the metadata examples.
+ */
+
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Namespaces of common schemas.
+const (
+	NsRDF           = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	NsXML           = "http://www.w3.org/XML/1998/namespace"
+	NsDC            = "http://purl.org/dc/elements/1.1/"
+	NsXMP           = "http://ns.adobe.com/xap/1.0/"
+	NsXMPMM         = "http://ns.adobe.com/xap/1.0/mm/"
+	NsXMPRights     = "http://ns.adobe.com/xap/1.0/rights/"
+	NsPDF           = "http://ns.adobe.com/pdf/1.3/"
+	NsPhotoshop     = "http://ns.adobe.com/photoshop/1.0/"
+	NsPDFAID        = "http://www.aiim.org/pdfa/ns/id/"
+	NsPDFAExtension = "http://www.aiim.org/pdfa/ns/extension/"
+	NsPDFASchema    = "http://www.aiim.org/pdfa/ns/schema#"
+	NsPDFAProperty  = "http://www.aiim.org/pdfa/ns/property#"
+)
+
+// knownPrefixes are the usual prefixes of the common namespaces.
+var knownPrefixes = map[string]string{
+	NsRDF:           "rdf",
+	NsXML:           "xml",
+	NsDC:            "dc",
+	NsXMP:           "xmp",
+	NsXMPMM:         "xmpMM",
+	NsXMPRights:     "xmpRights",
+	NsPDF:           "pdf",
+	NsPhotoshop:     "photoshop",
+	NsPDFAID:        "pdfaid",
+	NsPDFAExtension: "pdfaExtension",
+	NsPDFASchema:    "pdfaSchema",
+	NsPDFAProperty:  "pdfaProperty",
+}
+
+// Kind is the kind of an XMP value.
+type Kind int
+
+// Value kinds.
+const (
+	Simple Kind = iota
+	Bag         // Unordered array.
+	Seq         // Ordered array.
+	Alt         // Alternatives, e.g. language alternatives.
+	Struct
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Bag:
+		return "Bag"
+	case Seq:
+		return "Seq"
+	case Alt:
+		return "Alt"
+	case Struct:
+		return "Struct"
+	}
+	return "Simple"
+}
+
+// knownKinds are the kinds of the array properties of the common schemas. Other properties are
+// simple unless set otherwise.
+var knownKinds = map[string]Kind{
+	NsDC + " contributor":       Bag,
+	NsDC + " creator":           Seq,
+	NsDC + " date":              Seq,
+	NsDC + " description":       Alt,
+	NsDC + " language":          Bag,
+	NsDC + " publisher":         Bag,
+	NsDC + " relation":          Bag,
+	NsDC + " rights":            Alt,
+	NsDC + " subject":           Bag,
+	NsDC + " title":             Alt,
+	NsDC + " type":              Bag,
+	NsXMP + " Identifier":       Bag,
+	NsXMPRights + " Owner":      Bag,
+	NsXMPRights + " UsageTerms": Alt,
+}
+
+// KnownKind returns the kind of property `name` in namespace `ns` if it is an array of a common
+// schema, else Simple.
+func KnownKind(ns, name string) Kind {
+	return knownKinds[ns+" "+name]
+}
+
+// Value is an XMP value.
+type Value struct {
+	Kind   Kind
+	Text   string     // Text of simple values.
+	URI    bool       // Simple value is a URI (rdf:resource).
+	Lang   string     // Language (xml:lang), e.g. of the items of language alternatives.
+	Items  []Value    // Items of arrays.
+	Fields []Property // Fields of structures.
+}
+
+// Property is a named XMP value.
+type Property struct {
+	Namespace string
+	Name      string
+	Value     Value
+}
+
+// Text returns a simple value.
+func Text(s string) Value {
+	return Value{Text: s}
+}
+
+// NewBag returns an unordered array of simple values.
+func NewBag(items ...string) Value {
+	return newArray(Bag, items)
+}
+
+// NewSeq returns an ordered array of simple values.
+func NewSeq(items ...string) Value {
+	return newArray(Seq, items)
+}
+
+// LangAlt returns a language alternative with the default text `s`.
+func LangAlt(s string) Value {
+	return Value{Kind: Alt, Items: []Value{{Text: s, Lang: "x-default"}}}
+}
+
+// NewStruct returns a structure with `fields`.
+func NewStruct(fields ...Property) Value {
+	return Value{Kind: Struct, Fields: fields}
+}
+
+func newArray(kind Kind, items []string) Value {
+	v := Value{Kind: kind}
+	for _, item := range items {
+		v.Items = append(v.Items, Text(item))
+	}
+	return v
+}
+
+// String returns the text of simple values, the default item of alternatives and the items of
+// other arrays separated by "; ".
+func (v Value) String() string {
+	switch v.Kind {
+	case Simple:
+		return v.Text
+	case Alt:
+		if item, ok := v.LangItem("x-default"); ok {
+			return item.String()
+		}
+		if len(v.Items) > 0 {
+			return v.Items[0].String()
+		}
+		return ""
+	case Bag, Seq:
+		var items []string
+		for _, item := range v.Items {
+			items = append(items, item.String())
+		}
+		return strings.Join(items, "; ")
+	}
+	var fields []string
+	for _, f := range v.Fields {
+		fields = append(fields, f.Name+"="+f.Value.String())
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// LangItem returns the item of alternative `v` for language `lang`.
+func (v Value) LangItem(lang string) (Value, bool) {
+	for _, item := range v.Items {
+		if strings.EqualFold(item.Lang, lang) {
+			return item, true
+		}
+	}
+	return Value{}, false
+}
+
+// SetLang sets the item for language `lang` of language alternative `v` to `s`. The default item
+// (x-default) is kept first.
+func (v *Value) SetLang(lang, s string) {
+	v.Kind = Alt
+	for i := range v.Items {
+		if strings.EqualFold(v.Items[i].Lang, lang) {
+			v.Items[i].Text = s
+			return
+		}
+	}
+	item := Value{Text: s, Lang: lang}
+	if lang == "x-default" {
+		v.Items = append([]Value{item}, v.Items...)
+	} else {
+		v.Items = append(v.Items, item)
+	}
+}
+
+// Field returns field `name` in namespace `ns` of structure `v`.
+func (v Value) Field(ns, name string) (Value, bool) {
+	for _, f := range v.Fields {
+		if f.Namespace == ns && f.Name == name {
+			return f.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+// Packet is an XMP packet.
+type Packet struct {
+	props    []Property
+	prefixes map[string]string // Namespace -> prefix.
+}
+
+// New returns an empty packet.
+func New() *Packet {
+	return &Packet{prefixes: map[string]string{}}
+}
+
+// RegisterNamespace sets the prefix of namespace `ns` to `prefix`. A prefix can only be used for
+// one namespace.
+func (p *Packet) RegisterNamespace(prefix, ns string) error {
+	if prefix == "" || strings.ContainsAny(prefix, ": ") || ns == "" {
+		return fmt.Errorf("invalid namespace %s=%s", prefix, ns)
+	}
+	if other, ok := p.Namespace(prefix); ok && other != ns {
+		return fmt.Errorf("prefix %s is already used for %s", prefix, other)
+	}
+	p.prefixes[ns] = prefix
+	return nil
+}
+
+// Namespace returns the namespace of `prefix`.
+func (p *Packet) Namespace(prefix string) (string, bool) {
+	for ns, pre := range p.prefixes {
+		if pre == prefix {
+			return ns, true
+		}
+	}
+	for ns, pre := range knownPrefixes {
+		if pre == prefix {
+			if _, ok := p.prefixes[ns]; !ok {
+				return ns, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Prefix returns the prefix of namespace `ns`, or "" if it has none.
+func (p *Packet) Prefix(ns string) string {
+	if prefix, ok := p.prefixes[ns]; ok {
+		return prefix
+	}
+	return knownPrefixes[ns]
+}
+
+// ParseName splits a qualified property name such as "dc:title" into its namespace and name.
+func (p *Packet) ParseName(qname string) (ns, name string, err error) {
+	i := strings.IndexByte(qname, ':')
+	if i <= 0 || i == len(qname)-1 {
+		return "", "", fmt.Errorf("invalid property name %q: must be prefix:name", qname)
+	}
+	ns, ok := p.Namespace(qname[:i])
+	if !ok {
+		return "", "", fmt.Errorf("unknown namespace prefix %q", qname[:i])
+	}
+	return ns, qname[i+1:], nil
+}
+
+// Properties returns the top level properties.
+func (p *Packet) Properties() []Property {
+	return p.props
+}
+
+// Get returns the value of property `name` in namespace `ns`.
+func (p *Packet) Get(ns, name string) (Value, bool) {
+	for _, prop := range p.props {
+		if prop.Namespace == ns && prop.Name == name {
+			return prop.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+// Set sets property `name` in namespace `ns` to `v`.
+func (p *Packet) Set(ns, name string, v Value) {
+	for i, prop := range p.props {
+		if prop.Namespace == ns && prop.Name == name {
+			p.props[i].Value = v
+			return
+		}
+	}
+	p.props = append(p.props, Property{Namespace: ns, Name: name, Value: v})
+}
+
+// SetText sets property `name` in namespace `ns` to text `s`, as the default item of language
+// alternatives and as the only item of other arrays, for the known array properties.
+func (p *Packet) SetText(ns, name, s string) {
+	switch kind := KnownKind(ns, name); kind {
+	case Alt:
+		v, _ := p.Get(ns, name)
+		v.SetLang("x-default", s)
+		p.Set(ns, name, v)
+	case Bag, Seq:
+		p.Set(ns, name, newArray(kind, []string{s}))
+	default:
+		p.Set(ns, name, Text(s))
+	}
+}
+
+// Remove removes property `name` in namespace `ns`. Returns false if there is no such property.
+func (p *Packet) Remove(ns, name string) bool {
+	for i, prop := range p.props {
+		if prop.Namespace == ns && prop.Name == name {
+			p.props = append(p.props[:i], p.props[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the properties in a readable form to `w`.
+func (p *Packet) Print(w io.Writer) {
+	for _, prop := range p.props {
+		p.printValue(w, "", p.qname(prop.Namespace, prop.Name), prop.Value)
+	}
+}
+
+func (p *Packet) printValue(w io.Writer, indent, label string, v Value) {
+	lang := ""
+	if v.Lang != "" {
+		lang = "[" + v.Lang + "] "
+	}
+	switch v.Kind {
+	case Simple:
+		fmt.Fprintf(w, "%s%s: %s%s\n", indent, label, lang, v.Text)
+	case Struct:
+		fmt.Fprintf(w, "%s%s: %s(Struct)\n", indent, label, lang)
+		for _, f := range v.Fields {
+			p.printValue(w, indent+"    ", p.qname(f.Namespace, f.Name), f.Value)
+		}
+	default:
+		fmt.Fprintf(w, "%s%s: %s(%s)\n", indent, label, lang, v.Kind)
+		for _, item := range v.Items {
+			p.printValue(w, indent+"    ", "-", item)
+		}
+	}
+}
+
+// qname returns the qualified name of `name` in namespace `ns`.
+func (p *Packet) qname(ns, name string) string {
+	if prefix := p.Prefix(ns); prefix != "" {
+		return prefix + ":" + name
+	}
+	return "{" + ns + "}" + name
+}
+
+// node is an element of the parsed XML tree.
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*node
+	text     string
+}
+
+// attr returns the value of attribute `local` in namespace `ns`.
+func (n *node) attr(ns, local string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == ns && a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// is returns true if `n` is element `local` of namespace `ns`.
+func (n *node) is(ns, local string) bool {
+	return n.name.Space == ns && n.name.Local == local
+}
+
+// Parse parses the XMP packet `data`.
+func Parse(data []byte) (*Packet, error) {
+	p := New()
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	root := &node{}
+	stack := []*node{root}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name, attrs: t.Attr}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" && a.Value != NsRDF && a.Value != NsXML {
+					if _, ok := p.prefixes[a.Value]; !ok {
+						p.prefixes[a.Value] = a.Name.Local
+					}
+				}
+			}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			top.text += string(t)
+		}
+	}
+
+	rdf := findRDF(root)
+	if rdf == nil {
+		return nil, fmt.Errorf("no rdf:RDF element")
+	}
+	for _, desc := range rdf.children {
+		if !desc.is(NsRDF, "Description") {
+			continue
+		}
+		for _, prop := range parseFields(desc) {
+			p.Set(prop.Namespace, prop.Name, prop.Value)
+		}
+	}
+	return p, nil
+}
+
+// findRDF returns the rdf:RDF element under `n`.
+func findRDF(n *node) *node {
+	if n.is(NsRDF, "RDF") {
+		return n
+	}
+	for _, child := range n.children {
+		if rdf := findRDF(child); rdf != nil {
+			return rdf
+		}
+	}
+	return nil
+}
+
+// parseFields returns the properties given as attributes and child elements of `n`.
+func parseFields(n *node) []Property {
+	var props []Property
+	for _, a := range n.attrs {
+		if isPropertyAttr(a) {
+			props = append(props, Property{Namespace: a.Name.Space, Name: a.Name.Local, Value: Text(a.Value)})
+		}
+	}
+	for _, child := range n.children {
+		props = append(props, Property{Namespace: child.name.Space, Name: child.name.Local, Value: parseValue(child)})
+	}
+	return props
+}
+
+// isPropertyAttr returns true if attribute `a` is a property rather than RDF or XML syntax.
+func isPropertyAttr(a xml.Attr) bool {
+	return a.Name.Space != NsRDF && a.Name.Space != NsXML && a.Name.Space != "xmlns" && a.Name.Space != ""
+}
+
+// parseValue returns the value of property element `n`.
+func parseValue(n *node) Value {
+	lang, _ := n.attr(NsXML, "lang")
+	if uri, ok := n.attr(NsRDF, "resource"); ok {
+		return Value{Text: uri, URI: true, Lang: lang}
+	}
+	if parseType, _ := n.attr(NsRDF, "parseType"); parseType == "Resource" {
+		return Value{Kind: Struct, Fields: parseFields(n), Lang: lang}
+	}
+	if len(n.children) == 0 {
+		fields := parseFields(n)
+		if len(fields) > 0 {
+			return Value{Kind: Struct, Fields: fields, Lang: lang}
+		}
+		return Value{Text: n.text, Lang: lang}
+	}
+
+	child := n.children[0]
+	var kind Kind
+	switch {
+	case child.is(NsRDF, "Bag"):
+		kind = Bag
+	case child.is(NsRDF, "Seq"):
+		kind = Seq
+	case child.is(NsRDF, "Alt"):
+		kind = Alt
+	case child.is(NsRDF, "Description"):
+		return Value{Kind: Struct, Fields: parseFields(child), Lang: lang}
+	default:
+		return Value{Kind: Struct, Fields: parseFields(n), Lang: lang}
+	}
+	v := Value{Kind: kind, Lang: lang}
+	for _, li := range child.children {
+		if li.is(NsRDF, "li") {
+			v.Items = append(v.Items, parseValue(li))
+		}
+	}
+	return v
+}
+
+// Marshal returns the packet as serialized XMP, wrapped in xpacket processing instructions and
+// followed by padding so that it can be edited in place.
+func (p *Packet) Marshal() ([]byte, error) {
+	w := &writer{p: p, prefixes: map[string]string{}}
+	for ns, prefix := range p.prefixes {
+		w.prefixes[ns] = prefix
+	}
+
+	// A Description per namespace, in the order the namespaces first appear.
+	var order []string
+	byNamespace := map[string][]Property{}
+	for _, prop := range p.props {
+		if _, ok := byNamespace[prop.Namespace]; !ok {
+			order = append(order, prop.Namespace)
+		}
+		byNamespace[prop.Namespace] = append(byNamespace[prop.Namespace], prop)
+	}
+
+	var body bytes.Buffer
+	for _, ns := range order {
+		namespaces := map[string]bool{}
+		for _, prop := range byNamespace[ns] {
+			collectNamespaces(prop, namespaces)
+		}
+		var decls []string
+		for used := range namespaces {
+			decls = append(decls, fmt.Sprintf(" xmlns:%s=\"%s\"", w.prefix(used), escape(used)))
+		}
+		sort.Strings(decls)
+		body.WriteString("  <rdf:Description rdf:about=\"\"" + strings.Join(decls, "") + ">\n")
+		for _, prop := range byNamespace[ns] {
+			w.writeValue(&body, "   ", w.prefix(prop.Namespace)+":"+prop.Name, prop.Value)
+		}
+		body.WriteString("  </rdf:Description>\n")
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"" + NsRDF + "\">\n")
+	b.Write(body.Bytes())
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	for i := 0; i < 20; i++ {
+		b.WriteString(strings.Repeat(" ", 99) + "\n")
+	}
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return b.Bytes(), nil
+}
+
+// collectNamespaces adds the namespaces of `prop` and its fields to `namespaces`.
+func collectNamespaces(prop Property, namespaces map[string]bool) {
+	namespaces[prop.Namespace] = true
+	var visit func(v Value)
+	visit = func(v Value) {
+		for _, f := range v.Fields {
+			collectNamespaces(f, namespaces)
+		}
+		for _, item := range v.Items {
+			visit(item)
+		}
+	}
+	visit(prop.Value)
+}
+
+// writer serializes values.
+type writer struct {
+	p        *Packet
+	prefixes map[string]string
+}
+
+// prefix returns the prefix of namespace `ns`, generating one if it has none.
+func (w *writer) prefix(ns string) string {
+	if prefix, ok := w.prefixes[ns]; ok {
+		return prefix
+	}
+	if prefix, ok := knownPrefixes[ns]; ok {
+		return prefix
+	}
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("ns%d", i)
+		if !w.used(prefix) {
+			w.prefixes[ns] = prefix
+			return prefix
+		}
+	}
+}
+
+// used returns true if `prefix` is the prefix of a namespace.
+func (w *writer) used(prefix string) bool {
+	for _, p := range w.prefixes {
+		if p == prefix {
+			return true
+		}
+	}
+	for _, p := range knownPrefixes {
+		if p == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// writeValue writes element `qname` with value `v`.
+func (w *writer) writeValue(b *bytes.Buffer, indent, qname string, v Value) {
+	attrs := ""
+	if v.Lang != "" {
+		attrs = " xml:lang=\"" + escape(v.Lang) + "\""
+	}
+	switch v.Kind {
+	case Simple:
+		if v.URI {
+			fmt.Fprintf(b, "%s<%s%s rdf:resource=\"%s\"/>\n", indent, qname, attrs, escape(v.Text))
+			return
+		}
+		fmt.Fprintf(b, "%s<%s%s>%s</%s>\n", indent, qname, attrs, escape(v.Text), qname)
+	case Struct:
+		fmt.Fprintf(b, "%s<%s%s rdf:parseType=\"Resource\">\n", indent, qname, attrs)
+		for _, f := range v.Fields {
+			w.writeValue(b, indent+" ", w.prefix(f.Namespace)+":"+f.Name, f.Value)
+		}
+		fmt.Fprintf(b, "%s</%s>\n", indent, qname)
+	default:
+		fmt.Fprintf(b, "%s<%s%s>\n", indent, qname, attrs)
+		fmt.Fprintf(b, "%s <rdf:%s>\n", indent, v.Kind)
+		for _, item := range v.Items {
+			w.writeValue(b, indent+"  ", "rdf:li", item)
+		}
+		fmt.Fprintf(b, "%s </rdf:%s>\n", indent, v.Kind)
+		fmt.Fprintf(b, "%s</%s>\n", indent, qname)
+	}
+}
+
+// escape returns `s` escaped for XML text and attribute values.
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
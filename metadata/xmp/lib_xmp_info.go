@@ -0,0 +1,267 @@
+/*
+ * The document information dictionary and the metadata stream of PDF documents.
+ */
+
+package xmp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// InfoProperty is an entry of the document information dictionary and its XMP equivalent.
+type InfoProperty struct {
+	Key       string // Key in the information dictionary.
+	Namespace string
+	Name      string
+}
+
+// InfoProperties are the entries of the document information dictionary that have an XMP
+// equivalent.
+var InfoProperties = []InfoProperty{
+	{"Title", NsDC, "title"},
+	{"Author", NsDC, "creator"},
+	{"Subject", NsDC, "description"},
+	{"Keywords", NsPDF, "Keywords"},
+	{"Creator", NsXMP, "CreatorTool"},
+	{"Producer", NsPDF, "Producer"},
+	{"CreationDate", NsXMP, "CreateDate"},
+	{"ModDate", NsXMP, "ModifyDate"},
+	{"Trapped", NsPDF, "Trapped"},
+}
+
+// IsDate returns true if the entry is a date.
+func (ip InfoProperty) IsDate() bool {
+	return ip.Key == "CreationDate" || ip.Key == "ModDate"
+}
+
+// FormatDate formats `t` as an XMP date.
+func FormatDate(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05-07:00")
+}
+
+// ParseDate parses an XMP date, which may be truncated after any field.
+func ParseDate(s string) (time.Time, error) {
+	layouts := []string{
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02T15:04:05Z07:00",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04:05",
+		"2006-01-02",
+		"2006-01",
+		"2006",
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// InfoValue returns the value of entry `key` of `info` as it is written in XMP, or "" if it is not
+// set.
+func InfoValue(info *model.PdfInfo, key string) string {
+	text := func(s *core.PdfObjectString) string {
+		if s == nil {
+			return ""
+		}
+		return s.Decoded()
+	}
+	date := func(d *model.PdfDate) string {
+		if d == nil {
+			return ""
+		}
+		return FormatDate(d.ToGoTime())
+	}
+	switch key {
+	case "Title":
+		return text(info.Title)
+	case "Author":
+		return text(info.Author)
+	case "Subject":
+		return text(info.Subject)
+	case "Keywords":
+		return text(info.Keywords)
+	case "Creator":
+		return text(info.Creator)
+	case "Producer":
+		return text(info.Producer)
+	case "CreationDate":
+		return date(info.CreationDate)
+	case "ModDate":
+		return date(info.ModifiedDate)
+	case "Trapped":
+		if info.Trapped != nil {
+			return string(*info.Trapped)
+		}
+	}
+	return ""
+}
+
+// FromInfo sets the XMP equivalents of the entries of `info`. Properties that are already set are
+// only replaced if `overwrite` is true.
+func (p *Packet) FromInfo(info *model.PdfInfo, overwrite bool) {
+	for _, ip := range InfoProperties {
+		value := InfoValue(info, ip.Key)
+		if value == "" {
+			continue
+		}
+		if _, ok := p.Get(ip.Namespace, ip.Name); ok && !overwrite {
+			continue
+		}
+		p.SetText(ip.Namespace, ip.Name, value)
+	}
+}
+
+// ToInfo sets the entries of `info` to their XMP equivalents and clears the entries whose
+// equivalent is not set, so that `info` mirrors the packet.
+func (p *Packet) ToInfo(info *model.PdfInfo) error {
+	for _, ip := range InfoProperties {
+		value := ""
+		if v, ok := p.Get(ip.Namespace, ip.Name); ok {
+			value = v.String()
+		}
+		var date *model.PdfDate
+		if value != "" && ip.IsDate() {
+			t, err := ParseDate(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p.qname(ip.Namespace, ip.Name), err)
+			}
+			d, err := model.NewPdfDateFromTime(t)
+			if err != nil {
+				return err
+			}
+			date = &d
+		}
+		switch ip.Key {
+		case "Title":
+			info.Title = infoString(value)
+		case "Author":
+			info.Author = infoString(value)
+		case "Subject":
+			info.Subject = infoString(value)
+		case "Keywords":
+			info.Keywords = infoString(value)
+		case "Creator":
+			info.Creator = infoString(value)
+		case "Producer":
+			info.Producer = infoString(value)
+		case "CreationDate":
+			info.CreationDate = date
+		case "ModDate":
+			info.ModifiedDate = date
+		case "Trapped":
+			info.Trapped = nil
+			if value != "" {
+				info.Trapped = core.MakeName(value)
+			}
+		}
+	}
+	return nil
+}
+
+// infoString returns `s` as a text string of the information dictionary, nil if it is empty.
+// Strings that aren't ASCII are encoded as UTF-16.
+func infoString(s string) *core.PdfObjectString {
+	if s == "" {
+		return nil
+	}
+	for _, r := range s {
+		if r > 0x7e {
+			return core.MakeEncodedString(s, true)
+		}
+	}
+	return core.MakeString(s)
+}
+
+// SetModified sets the modification and metadata dates to `t`.
+func (p *Packet) SetModified(t time.Time) {
+	p.Set(NsXMP, "ModifyDate", Text(FormatDate(t)))
+	p.Set(NsXMP, "MetadataDate", Text(FormatDate(t)))
+}
+
+// Read returns the document metadata of `pdfReader`, or nil if it has none.
+func Read(pdfReader *model.PdfReader) (*Packet, error) {
+	trailer, err := pdfReader.GetTrailer()
+	if err != nil {
+		return nil, err
+	}
+	catalog, ok := core.GetDict(trailer.Get("Root"))
+	if !ok {
+		return nil, fmt.Errorf("missing catalog")
+	}
+	stream, ok := core.GetStream(catalog.Get("Metadata"))
+	if !ok {
+		return nil, nil
+	}
+	data, err := core.DecodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// SetDocumentMetadata makes `pdfWriter` write `p` as the document metadata. The catalog is reached
+// in an optimizer pass, as the writer has no setter for its Metadata entry. An optimizer that was
+// already set runs afterwards.
+func SetDocumentMetadata(pdfWriter *model.PdfWriter, p *Packet) error {
+	data, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	stream, err := core.MakeStream(data, nil)
+	if err != nil {
+		return err
+	}
+	stream.Set("Type", core.MakeName("Metadata"))
+	stream.Set("Subtype", core.MakeName("XML"))
+	pdfWriter.SetOptimizer(&metadataSetter{stream: stream, next: pdfWriter.GetOptimizer()})
+	return nil
+}
+
+// metadataSetter sets the Metadata entry of the catalog. It implements the model.Optimizer
+// interface.
+type metadataSetter struct {
+	stream *core.PdfObjectStream
+	next   model.Optimizer
+}
+
+// Optimize implements the model.Optimizer interface.
+func (m *metadataSetter) Optimize(objects []core.PdfObject) ([]core.PdfObject, error) {
+	found := false
+	for _, obj := range objects {
+		ind, ok := obj.(*core.PdfIndirectObject)
+		if !ok {
+			continue
+		}
+		catalog, ok := core.GetDict(ind.PdfObject)
+		if !ok {
+			continue
+		}
+		if name, ok := core.GetName(catalog.Get("Type")); ok && *name == "Catalog" {
+			if old, ok := core.GetStream(catalog.Get("Metadata")); ok {
+				for i, o := range objects {
+					if o == old {
+						objects = append(objects[:i], objects[i+1:]...)
+						break
+					}
+				}
+			}
+			catalog.Set("Metadata", m.stream)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("catalog not found")
+	}
+	objects = append(objects, m.stream)
+	if m.next != nil {
+		return m.next.Optimize(objects)
+	}
+	return objects, nil
+}
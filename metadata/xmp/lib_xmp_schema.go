@@ -0,0 +1,112 @@
+/*
+ * PDF/A extension schemas, which describe the properties of custom namespaces.
+ */
+
+package xmp
+
+import "fmt"
+
+// Schema is a PDF/A extension schema.
+type Schema struct {
+	Namespace   string           `json:"namespace"`
+	Prefix      string           `json:"prefix"`
+	Description string           `json:"description"`
+	Properties  []SchemaProperty `json:"properties"`
+}
+
+// SchemaProperty describes a property of an extension schema.
+type SchemaProperty struct {
+	Name string `json:"name"`
+	// ValueType is an XMP value type such as Text, Integer, Boolean, Date, URI, "bag Text",
+	// "seq Text" or "Lang Alt".
+	ValueType string `json:"value_type"`
+	// Category is "internal" for properties set by applications and "external" for properties
+	// set by users.
+	Category    string `json:"category"`
+	Description string `json:"description"`
+}
+
+// Extensions returns the extension schemas of the packet.
+func (p *Packet) Extensions() []Schema {
+	schemas, ok := p.Get(NsPDFAExtension, "schemas")
+	if !ok {
+		return nil
+	}
+	var result []Schema
+	for _, item := range schemas.Items {
+		s := Schema{
+			Namespace:   fieldText(item, NsPDFASchema, "namespaceURI"),
+			Prefix:      fieldText(item, NsPDFASchema, "prefix"),
+			Description: fieldText(item, NsPDFASchema, "schema"),
+		}
+		props, _ := item.Field(NsPDFASchema, "property")
+		for _, prop := range props.Items {
+			s.Properties = append(s.Properties, SchemaProperty{
+				Name:        fieldText(prop, NsPDFAProperty, "name"),
+				ValueType:   fieldText(prop, NsPDFAProperty, "valueType"),
+				Category:    fieldText(prop, NsPDFAProperty, "category"),
+				Description: fieldText(prop, NsPDFAProperty, "description"),
+			})
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// AddExtension adds extension schema `s` to the packet, replacing a schema of the same namespace,
+// and registers its prefix.
+func (p *Packet) AddExtension(s Schema) error {
+	if s.Namespace == "" || s.Prefix == "" {
+		return fmt.Errorf("extension schema needs a namespace and a prefix")
+	}
+	if err := p.RegisterNamespace(s.Prefix, s.Namespace); err != nil {
+		return err
+	}
+	props := Value{Kind: Seq}
+	for _, prop := range s.Properties {
+		if prop.Name == "" {
+			return fmt.Errorf("schema %s: property without name", s.Namespace)
+		}
+		if prop.ValueType == "" {
+			prop.ValueType = "Text"
+		}
+		if prop.Category == "" {
+			prop.Category = "external"
+		}
+		if prop.Category != "internal" && prop.Category != "external" {
+			return fmt.Errorf("schema %s: property %s: category must be internal or external",
+				s.Namespace, prop.Name)
+		}
+		props.Items = append(props.Items, NewStruct(
+			Property{NsPDFAProperty, "name", Text(prop.Name)},
+			Property{NsPDFAProperty, "valueType", Text(prop.ValueType)},
+			Property{NsPDFAProperty, "category", Text(prop.Category)},
+			Property{NsPDFAProperty, "description", Text(prop.Description)},
+		))
+	}
+	schema := NewStruct(
+		Property{NsPDFASchema, "schema", Text(s.Description)},
+		Property{NsPDFASchema, "namespaceURI", Text(s.Namespace)},
+		Property{NsPDFASchema, "prefix", Text(s.Prefix)},
+		Property{NsPDFASchema, "property", props},
+	)
+
+	schemas, _ := p.Get(NsPDFAExtension, "schemas")
+	schemas.Kind = Bag
+	for i, item := range schemas.Items {
+		if fieldText(item, NsPDFASchema, "namespaceURI") == s.Namespace {
+			schemas.Items[i] = schema
+			p.Set(NsPDFAExtension, "schemas", schemas)
+			return nil
+		}
+	}
+	schemas.Items = append(schemas.Items, schema)
+	p.Set(NsPDFAExtension, "schemas", schemas)
+	return nil
+}
+
+// fieldText returns the text of field `name` in namespace `ns` of structure `v`.
+func fieldText(v Value, ns, name string) string {
+	f, _ := v.Field(ns, name)
+	return f.String()
+}
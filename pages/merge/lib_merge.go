@@ -0,0 +1,394 @@
+/*
+ * Package merge merges PDF documents, including their form field data (AcroForms) and the
+ * resources of the forms.
+ *
+ * Used by pages/pdf_merge_advanced.go and the pdftool merge command.
+ */
+
+package merge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/common"
+	"github.com/unidoc/unipdf/v3/contentstream"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Documents merges the pages of the documents loaded by `readers` into a new PdfWriter, in order.
+// The interactive forms of the documents are merged as well with Forms.
+func Documents(readers ...*model.PdfReader) (*model.PdfWriter, error) {
+	pdfWriter := model.NewPdfWriter()
+
+	var forms *model.PdfAcroForm
+	for docIdx, pdfReader := range readers {
+		numPages, err := pdfReader.GetNumPages()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < numPages; i++ {
+			pageNum := i + 1
+
+			page, err := pdfReader.GetPage(pageNum)
+			if err != nil {
+				return nil, err
+			}
+
+			err = pdfWriter.AddPage(page)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Handle forms.
+		if pdfReader.AcroForm != nil {
+			if forms == nil {
+				forms = pdfReader.AcroForm
+			} else {
+				forms, err = Forms(forms, pdfReader.AcroForm, docIdx+1)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// Set the merged forms object.
+	if forms != nil {
+		err := pdfWriter.SetForms(forms)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &pdfWriter, nil
+}
+
+// ConflictError is returned by Resources when both resources define a resource of the same category
+// and name with different values. Neither resource would be right for the content of both sides,
+// so nothing is merged.
+type ConflictError struct {
+	// Names are the conflicting resources as "category/name", e.g. "Font/F1".
+	Names []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("resource name conflicts: %s", strings.Join(e.Names, ", "))
+}
+
+// Resources merges the resources of `r2` into `r` and returns `r`. Resources defined by both with the
+// same name must be equal: if any differ, `r` is left unchanged and a *ConflictError is returned.
+// The content using the resources of `r2` must then be renamed first, as Forms does for the default
+// resources of forms.
+func Resources(r, r2 *model.PdfPageResources) (*model.PdfPageResources, error) {
+	names, err := conflicts(r, r2)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		return nil, &ConflictError{Names: names}
+	}
+
+	// Merge Colorspace resources.
+	colorspaces, err := r.GetColorspaces()
+	if err != nil {
+		return nil, err
+	}
+	colorspaces2, err := r2.GetColorspaces()
+	if err != nil {
+		return nil, err
+	}
+	if colorspaces == nil {
+		r.SetColorSpace(colorspaces2)
+	} else if colorspaces2 != nil {
+		for _, key := range colorspaces2.Names {
+			// Ensure only present once in Names.
+			if _, has := colorspaces.Colorspaces[key]; !has {
+				colorspaces.Names = append(colorspaces.Names, key)
+			}
+			r.SetColorspaceByName(core.PdfObjectName(key), colorspaces2.Colorspaces[key])
+		}
+	}
+
+	// Merge the resource dictionaries.
+	categories2 := resourceDicts(r2)
+	for i, c := range resourceDicts(r) {
+		dict2, ok := core.GetDict(*categories2[i].obj)
+		if !ok {
+			continue
+		}
+		dict, ok := core.GetDict(*c.obj)
+		if !ok {
+			*c.obj = dict2
+			continue
+		}
+		for _, key := range dict2.Keys() {
+			dict.Set(key, dict2.Get(key))
+		}
+	}
+
+	// Merge the procedure sets, an array of names.
+	if procsets2, ok := core.GetArray(r2.ProcSet); ok {
+		procsets, ok := core.GetArray(r.ProcSet)
+		if !ok {
+			procsets = core.MakeArray()
+			r.ProcSet = procsets
+		}
+		has := map[string]bool{}
+		for _, obj := range procsets.Elements() {
+			has[obj.String()] = true
+		}
+		for _, obj := range procsets2.Elements() {
+			if !has[obj.String()] {
+				has[obj.String()] = true
+				procsets.Append(obj)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// resourceDict is a category of resources stored as a dictionary by name.
+type resourceDict struct {
+	name string
+	obj  *core.PdfObject
+}
+
+// resourceDicts returns the resource dictionaries of `r` other than the color spaces.
+func resourceDicts(r *model.PdfPageResources) []resourceDict {
+	return []resourceDict{
+		{"ExtGState", &r.ExtGState},
+		{"Pattern", &r.Pattern},
+		{"Shading", &r.Shading},
+		{"XObject", &r.XObject},
+		{"Font", &r.Font},
+		{"Properties", &r.Properties},
+	}
+}
+
+// conflicts returns the resources that `r` and `r2` both define with different values, as
+// "category/name".
+func conflicts(r, r2 *model.PdfPageResources) ([]string, error) {
+	var names []string
+	colorspaces, err := r.GetColorspaces()
+	if err != nil {
+		return nil, err
+	}
+	colorspaces2, err := r2.GetColorspaces()
+	if err != nil {
+		return nil, err
+	}
+	if colorspaces != nil && colorspaces2 != nil {
+		for _, key := range colorspaces2.Names {
+			cs, has := colorspaces.Colorspaces[key]
+			if has && !sameObject(cs.ToPdfObject(), colorspaces2.Colorspaces[key].ToPdfObject()) {
+				names = append(names, "ColorSpace/"+key)
+			}
+		}
+	}
+
+	categories2 := resourceDicts(r2)
+	for i, c := range resourceDicts(r) {
+		dict, ok := core.GetDict(*c.obj)
+		if !ok {
+			continue
+		}
+		dict2, ok := core.GetDict(*categories2[i].obj)
+		if !ok {
+			continue
+		}
+		for _, key := range dict2.Keys() {
+			if val := dict.Get(key); val != nil && !sameObject(val, dict2.Get(key)) {
+				names = append(names, c.name+"/"+string(key))
+			}
+		}
+	}
+	return names, nil
+}
+
+// sameObject returns true if `obj1` and `obj2` are the same object or have the same contents.
+func sameObject(obj1, obj2 core.PdfObject) bool {
+	if obj1 == obj2 || core.TraceToDirectObject(obj1) == core.TraceToDirectObject(obj2) {
+		return true
+	}
+	return core.EqualObjects(core.FlattenObject(obj1), core.FlattenObject(obj2))
+}
+
+// Forms merges the interactive form `form2` into `form` and returns `form`. The fields of `form2` are
+// placed under a new non-terminal field named "doc<docNum>" to avoid name clashes. Default resources
+// of `form2` named like different ones of `form` are renamed, in the default appearances of its
+// fields too.
+func Forms(form, form2 *model.PdfAcroForm, docNum int) (*model.PdfAcroForm, error) {
+	// Use whatever value comes first..
+	// TODO: Consider adding a more intelligent, preferential handling based on actual values.  If needed.
+
+	if form.NeedAppearances == nil {
+		form.NeedAppearances = form2.NeedAppearances
+	}
+
+	if form.SigFlags == nil {
+		form.SigFlags = form2.SigFlags
+	}
+
+	if form.CO == nil {
+		form.CO = form2.CO
+	}
+
+	if form.DR == nil {
+		form.DR = form2.DR
+	} else if form2.DR != nil {
+		if err := renameConflicts(form.DR, form2); err != nil {
+			return nil, err
+		}
+		dr, err := Resources(form.DR, form2.DR)
+		if err != nil {
+			return nil, err
+		}
+		form.DR = dr
+	}
+
+	if form.DA == nil {
+		form.DA = form2.DA
+	}
+
+	if form.Q == nil {
+		form.Q = form2.Q
+	}
+
+	if form.XFA == nil {
+		form.XFA = form2.XFA
+	} else {
+		if form2.XFA != nil {
+			// TODO: Handle merging XFA.
+			common.Log.Debug("TODO: Handle XFA merging - Currently just using first one that is encountered")
+		}
+	}
+
+	// Fields.
+	if form.Fields == nil {
+		form.Fields = form2.Fields
+	} else {
+		// Make a top-level field for the doc (non-terminal field).
+		docfield := model.NewPdfField()
+		docfield.T = core.MakeString(fmt.Sprintf("doc%d", docNum))
+		docfield.Kids = []*model.PdfField{}
+		if form2.Fields != nil {
+			for _, subfield := range *form2.Fields {
+				subfield.Parent = docfield // Update parent.
+				docfield.Kids = append(docfield.Kids, subfield)
+			}
+		}
+		*form.Fields = append(*form.Fields, docfield)
+	}
+
+	return form, nil
+}
+
+// renameConflicts renames the default resources of `form2` that `dr` defines with different values,
+// updating the fonts of the default appearances of `form2` and its fields.
+func renameConflicts(dr *model.PdfPageResources, form2 *model.PdfAcroForm) error {
+	names, err := conflicts(dr, form2.DR)
+	if err != nil || len(names) == 0 {
+		return err
+	}
+
+	fonts := map[string]string{}
+	for _, name := range names {
+		parts := strings.SplitN(name, "/", 2)
+		category, key := parts[0], parts[1]
+		newKey := key
+		for i := 2; ; i++ {
+			newKey = fmt.Sprintf("%s_%d", key, i)
+			if !hasResource(dr, category, newKey) && !hasResource(form2.DR, category, newKey) {
+				break
+			}
+		}
+
+		if category == "ColorSpace" {
+			colorspaces, err := form2.DR.GetColorspaces()
+			if err != nil {
+				return err
+			}
+			colorspaces.Colorspaces[newKey] = colorspaces.Colorspaces[key]
+			delete(colorspaces.Colorspaces, key)
+			for i, n := range colorspaces.Names {
+				if n == key {
+					colorspaces.Names[i] = newKey
+				}
+			}
+			form2.DR.SetColorSpace(colorspaces)
+			continue
+		}
+		for _, c := range resourceDicts(form2.DR) {
+			if c.name == category {
+				dict, _ := core.GetDict(*c.obj)
+				dict.Set(core.PdfObjectName(newKey), dict.Get(core.PdfObjectName(key)))
+				dict.Remove(core.PdfObjectName(key))
+			}
+		}
+		if category == "Font" {
+			fonts[key] = newKey
+		}
+	}
+	if len(fonts) == 0 {
+		return nil
+	}
+
+	// Default appearances name the fonts of the default resources.
+	if form2.DA != nil {
+		form2.DA = core.MakeString(renameFonts(form2.DA.String(), fonts))
+	}
+	for _, field := range form2.AllFields() {
+		if ctx, ok := field.GetContext().(*model.PdfFieldText); ok && ctx.DA != nil {
+			ctx.DA = core.MakeString(renameFonts(ctx.DA.String(), fonts))
+		}
+		objs := []core.PdfObject{field.GetContainingPdfObject()}
+		for _, w := range field.Annotations {
+			objs = append(objs, w.GetContainingPdfObject())
+		}
+		for _, obj := range objs {
+			if dict, ok := core.GetDict(obj); ok {
+				if da, ok := core.GetString(dict.Get("DA")); ok {
+					dict.Set("DA", core.MakeString(renameFonts(da.String(), fonts)))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasResource returns true if `r` has a resource of `category` named `name`.
+func hasResource(r *model.PdfPageResources, category, name string) bool {
+	if category == "ColorSpace" {
+		return r.HasColorspaceByName(core.PdfObjectName(name))
+	}
+	for _, c := range resourceDicts(r) {
+		if dict, ok := core.GetDict(*c.obj); ok && c.name == category && dict.Get(core.PdfObjectName(name)) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// renameFonts returns the default appearance `da` with the fonts renamed by `fonts`.
+func renameFonts(da string, fonts map[string]string) string {
+	ops, err := contentstream.NewContentStreamParser(da).Parse()
+	if err != nil {
+		return da
+	}
+	for _, op := range *ops {
+		if op.Operand != "Tf" || len(op.Params) != 2 {
+			continue
+		}
+		if name, ok := core.GetName(op.Params[0]); ok {
+			if newName, ok := fonts[name.String()]; ok {
+				op.Params[0] = core.MakeName(newName)
+			}
+		}
+	}
+	return strings.TrimSpace(ops.String())
+}
@@ -0,0 +1,151 @@
+package merge
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// fontDict returns a Type1 font dictionary of the standard font `baseFont`.
+func fontDict(baseFont string) *core.PdfObjectDictionary {
+	dict := core.MakeDict()
+	dict.Set("Type", core.MakeName("Font"))
+	dict.Set("Subtype", core.MakeName("Type1"))
+	dict.Set("BaseFont", core.MakeName(baseFont))
+	return dict
+}
+
+// fontResources returns resources with the fonts `fonts` by name.
+func fontResources(fonts map[string]core.PdfObject) *model.PdfPageResources {
+	r := model.NewPdfPageResources()
+	dict := core.MakeDict()
+	for name, font := range fonts {
+		dict.Set(core.PdfObjectName(name), font)
+	}
+	r.Font = dict
+	return r
+}
+
+// fontNames returns the sorted names of the fonts of `r`.
+func fontNames(r *model.PdfPageResources) []string {
+	dict, ok := core.GetDict(r.Font)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, key := range dict.Keys() {
+		names = append(names, string(key))
+	}
+	return names
+}
+
+func TestResources(t *testing.T) {
+	helvetica := fontDict("Helvetica")
+	tests := []struct {
+		name      string
+		r, r2     map[string]core.PdfObject
+		fonts     []string
+		conflicts []string
+	}{
+		{
+			name:  "disjoint",
+			r:     map[string]core.PdfObject{"F1": helvetica},
+			r2:    map[string]core.PdfObject{"F2": fontDict("Times-Roman")},
+			fonts: []string{"F1", "F2"},
+		},
+		{
+			name:  "same object",
+			r:     map[string]core.PdfObject{"F1": helvetica},
+			r2:    map[string]core.PdfObject{"F1": helvetica},
+			fonts: []string{"F1"},
+		},
+		{
+			name:  "equal objects",
+			r:     map[string]core.PdfObject{"F1": helvetica},
+			r2:    map[string]core.PdfObject{"F1": core.MakeIndirectObject(fontDict("Helvetica"))},
+			fonts: []string{"F1"},
+		},
+		{
+			name:      "conflict",
+			r:         map[string]core.PdfObject{"F1": helvetica},
+			r2:        map[string]core.PdfObject{"F1": fontDict("Times-Roman"), "F2": fontDict("Courier")},
+			fonts:     []string{"F1"},
+			conflicts: []string{"Font/F1"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := fontResources(tc.r)
+			_, err := Resources(r, fontResources(tc.r2))
+			var cerr *ConflictError
+			switch {
+			case tc.conflicts == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.conflicts != nil && !errors.As(err, &cerr):
+				t.Fatalf("expected a conflict error, got %v", err)
+			case cerr != nil && !reflect.DeepEqual(cerr.Names, tc.conflicts):
+				t.Errorf("got conflicts %q, want %q", cerr.Names, tc.conflicts)
+			}
+			if got := fontNames(r); !reflect.DeepEqual(got, tc.fonts) {
+				t.Errorf("got fonts %q, want %q", got, tc.fonts)
+			}
+		})
+	}
+}
+
+func TestResourcesProcSet(t *testing.T) {
+	r, r2 := model.NewPdfPageResources(), model.NewPdfPageResources()
+	r.ProcSet = core.MakeArray(core.MakeName("PDF"), core.MakeName("Text"))
+	r2.ProcSet = core.MakeArray(core.MakeName("PDF"), core.MakeName("ImageC"))
+	if _, err := Resources(r, r2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := r.ProcSet.String(), "[PDF, Text, ImageC]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestFormsRenamesConflicts(t *testing.T) {
+	form := model.NewPdfAcroForm()
+	form.DR = fontResources(map[string]core.PdfObject{"Helv": fontDict("Helvetica")})
+
+	form2 := model.NewPdfAcroForm()
+	form2.DR = fontResources(map[string]core.PdfObject{"Helv": fontDict("Times-Roman")})
+	form2.DA = core.MakeString("/Helv 0 Tf 0 g")
+	field := model.NewPdfField()
+	field.T = core.MakeString("name")
+	text := &model.PdfFieldText{PdfField: field, DA: core.MakeString("/Helv 12 Tf 0 g")}
+	field.SetContext(text)
+	*form2.Fields = append(*form2.Fields, field)
+
+	merged, err := Forms(form, form2, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := fontNames(merged.DR), []string{"Helv", "Helv_2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got fonts %q, want %q", got, want)
+	}
+	base, _ := merged.DR.GetFontByName("Helv_2")
+	if dict, ok := core.GetDict(base); !ok || dict.Get("BaseFont").String() != "Times-Roman" {
+		t.Errorf("got font Helv_2 %v, want Times-Roman", base)
+	}
+	tests := []struct {
+		name string
+		da   *core.PdfObjectString
+		want string
+	}{
+		{"form", form2.DA, "/Helv_2 0 Tf\n0 g"},
+		{"field", text.DA, "/Helv_2 12 Tf\n0 g"},
+	}
+	for _, tc := range tests {
+		if got := tc.da.String(); got != tc.want {
+			t.Errorf("%s DA: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+	if n := len(*merged.Fields); n != 1 {
+		t.Errorf("got %d top-level fields, want 1", n)
+	}
+}
@@ -0,0 +1,328 @@
+/*
+ * pdftool batch: Applies a document operation (optimize, grayscale, flatten, extract-text, render)
+ * to many PDF files concurrently, using the batch runner of testing/batch.
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/extractor"
+	"github.com/unidoc/unipdf/v3/model"
+	"github.com/unidoc/unipdf/v3/model/optimize"
+	"github.com/unidoc/unipdf/v3/render"
+
+	"github.com/unidoc/unidoc-examples/advanced/grayscale"
+	"github.com/unidoc/unidoc-examples/testing/batch"
+)
+
+var batchCmd = &command{
+	name:  "batch",
+	args:  "operation input...",
+	short: "Apply an operation to many PDF files concurrently.",
+	long: `
+Operations:
+  optimize      Optimize (compress) the files.
+  grayscale     Convert the files to grayscale.
+  flatten       Flatten form fields into the page content.
+  extract-text  Extract the text to .txt files.
+  render        Render the pages to PNG images, one directory per file.
+
+Inputs are directories, searched recursively for .pdf files, or glob patterns such as "in/*.pdf".
+The outputs are written to the -o directory, mirroring the input directory structure. Inputs
+that would have the same output, such as a/x.pdf and b/x.pdf matched by "*/x.pdf", are refused.
+
+With -manifest, every completed file is recorded in the manifest file as it finishes. Running the
+same command again skips the files recorded as successful with the same operation (and -dpi for
+render) and output path, so an interrupted run can be resumed.
+The -summary file is written as CSV if its name ends with .csv, as JSON otherwise.
+
+The command fails (exit code 1) if any file failed or timed out.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&batchOpts.output, "o", "", "Output directory (required)")
+		fs.StringVar(&batchOpts.password, "password", "", "Password for encrypted input files")
+		fs.IntVar(&batchOpts.workers, "workers", 0, "Number of files processed concurrently (default: number of CPUs)")
+		fs.DurationVar(&batchOpts.timeout, "timeout", 0, "Maximum processing time per file, e.g. 2m (default: no limit)")
+		fs.StringVar(&batchOpts.manifest, "manifest", "", "Manifest file for resuming interrupted runs")
+		fs.StringVar(&batchOpts.summary, "summary", "", "Write a summary of all results to this .json or .csv file")
+		fs.BoolVar(&batchOpts.quiet, "q", false, "Do not print a line per processed file")
+		fs.IntVar(&batchOpts.dpi, "dpi", 150, "Resolution of rendered pages (render)")
+	},
+	run: runBatch,
+}
+
+var batchOpts struct {
+	output   string
+	password string
+	workers  int
+	timeout  time.Duration
+	manifest string
+	summary  string
+	quiet    bool
+	dpi      int
+}
+
+// batchOperation is an operation supported by pdftool batch.
+type batchOperation struct {
+	ext string // Extension of the output path.
+	run batch.Func
+}
+
+var batchOperations = map[string]batchOperation{
+	"optimize":     {ext: ".pdf", run: batchOptimize},
+	"grayscale":    {ext: ".pdf", run: batchGrayscale},
+	"flatten":      {ext: ".pdf", run: batchFlatten},
+	"extract-text": {ext: ".txt", run: batchExtractText},
+	"render":       {ext: "", run: batchRender},
+}
+
+func runBatch(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 2)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(batchOpts.output); err != nil {
+		return err
+	}
+	op, ok := batchOperations[args[0]]
+	if !ok {
+		return usageErrorf("unknown operation %q", args[0])
+	}
+	if batchOpts.dpi <= 0 {
+		return usageErrorf("invalid resolution %d", batchOpts.dpi)
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	files, err := batch.Expand(args[1:])
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no PDF files found")
+	}
+
+	// Stop starting new files on Ctrl+C. The manifest allows resuming later.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			fmt.Fprintf(os.Stderr, "Interrupted, waiting for the files in progress\n")
+			cancel()
+		}
+	}()
+
+	operation := args[0]
+	if operation == "render" {
+		operation = fmt.Sprintf("render -dpi %d", batchOpts.dpi)
+	}
+	opts := batch.Options{
+		Workers:   batchOpts.workers,
+		Timeout:   batchOpts.timeout,
+		Manifest:  batchOpts.manifest,
+		Operation: operation,
+		OutputDir: batchOpts.output,
+		OutputExt: op.ext,
+	}
+	if !batchOpts.quiet {
+		opts.Progress = os.Stdout
+	}
+
+	results, err := batch.Run(ctx, files, op.run, opts)
+	if err != nil {
+		return err
+	}
+	if batchOpts.summary != "" {
+		if err := batch.WriteSummaryFile(batchOpts.summary, results); err != nil {
+			return err
+		}
+	}
+
+	s := batch.Summarize(results)
+	fmt.Printf("%d file(s): %d ok, %d skipped, %d failed, %d timed out\n", s.Total, s.OK, s.Skipped, s.Failed, s.Timeout)
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted after %d of %d file(s)", len(results), len(files))
+	}
+	if s.Failed+s.Timeout > 0 {
+		return fmt.Errorf("%d file(s) could not be processed", s.Failed+s.Timeout)
+	}
+	return nil
+}
+
+func batchOptimize(ctx context.Context, job batch.Job) (string, error) {
+	pdfReader, f, err := openReader(job.Path, batchOpts.password)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	pdfWriter, err := pdfReader.ToWriter(nil)
+	if err != nil {
+		return "", err
+	}
+	pdfWriter.SetOptimizer(optimize.New(optimize.Options{
+		CombineDuplicateDirectObjects:   true,
+		CombineIdenticalIndirectObjects: true,
+		CombineDuplicateStreams:         true,
+		CompressStreams:                 true,
+		UseObjectStreams:                true,
+		ImageQuality:                    80,
+		ImageUpperPPI:                   100,
+	}))
+	if err := pdfWriter.WriteToFile(job.Output); err != nil {
+		return "", err
+	}
+	return sizeChange(job.Path, job.Output)
+}
+
+func batchGrayscale(ctx context.Context, job batch.Job) (string, error) {
+	pdfReader, f, err := openReader(job.Path, batchOpts.password)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	pdfWriter, err := pdfReader.ToWriter(&model.ReaderToWriterOpts{
+		PageProcessCallback: func(pageNum int, page *model.PdfPage) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return grayscale.ConvertPage(page, nil)
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return "", pdfWriter.WriteToFile(job.Output)
+}
+
+func batchFlatten(ctx context.Context, job batch.Job) (string, error) {
+	pdfReader, f, err := openReader(job.Path, batchOpts.password)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if pdfReader.AcroForm != nil {
+		err = pdfReader.FlattenFields(false, annotator.FieldAppearance{OnlyIfMissing: true})
+		if err != nil {
+			return "", err
+		}
+	}
+	pdfWriter, err := pdfReader.ToWriter(&model.ReaderToWriterOpts{SkipAcroForm: true})
+	if err != nil {
+		return "", err
+	}
+	return "", pdfWriter.WriteToFile(job.Output)
+}
+
+func batchExtractText(ctx context.Context, job batch.Job) (string, error) {
+	pdfReader, f, err := openReader(job.Path, batchOpts.password)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for pageNum := 1; pageNum <= numPages; pageNum++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		page, err := pdfReader.GetPage(pageNum)
+		if err != nil {
+			return "", err
+		}
+		ex, err := extractor.New(page)
+		if err != nil {
+			return "", err
+		}
+		text, err := ex.ExtractText()
+		if err != nil {
+			return "", err
+		}
+		if pageNum > 1 {
+			sb.WriteString("\f")
+		}
+		sb.WriteString(text)
+	}
+
+	if err := ioutil.WriteFile(job.Output, []byte(sb.String()), 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d pages", numPages), nil
+}
+
+func batchRender(ctx context.Context, job batch.Job) (string, error) {
+	pdfReader, f, err := openReader(job.Path, batchOpts.password)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(job.Output, 0755); err != nil {
+		return "", err
+	}
+
+	device := render.NewImageDevice()
+	for pageNum := 1; pageNum <= numPages; pageNum++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		page, err := pdfReader.GetPage(pageNum)
+		if err != nil {
+			return "", err
+		}
+		width, _, err := page.Size()
+		if err != nil {
+			return "", err
+		}
+		device.OutputWidth = int(width / 72 * float64(batchOpts.dpi))
+
+		outputPath := filepath.Join(job.Output, fmt.Sprintf("page_%d.png", pageNum))
+		if err := device.RenderToPath(page, outputPath); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%d pages", numPages), nil
+}
+
+// sizeChange describes the size of `outputPath` relative to `inputPath`.
+func sizeChange(inputPath, outputPath string) (string, error) {
+	in, err := os.Stat(inputPath)
+	if err != nil {
+		return "", err
+	}
+	out, err := os.Stat(outputPath)
+	if err != nil {
+		return "", err
+	}
+	ratio := 0.0
+	if in.Size() > 0 {
+		ratio = 100 - float64(out.Size())/float64(in.Size())*100
+	}
+	return fmt.Sprintf("%d -> %d bytes (%.1f%% smaller)", in.Size(), out.Size(), ratio), nil
+}
@@ -0,0 +1,253 @@
+/*
+ * Shared plumbing for the pdftool subcommands: flag parsing, license loading,
+ * opening (encrypted) input documents and page range handling.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// command represents a single pdftool subcommand.
+type command struct {
+	name  string // Name used on the command line.
+	args  string // Synopsis of the positional arguments.
+	short string // One line description.
+	long  string // Optional longer description shown by `pdftool help <command>`.
+
+	// setFlags registers the command specific flags.
+	setFlags func(fs *flag.FlagSet)
+	// run executes the command with the positional arguments remaining after flag parsing.
+	run func(cmd *command, args []string) error
+
+	fs *flag.FlagSet
+}
+
+// errHelp is returned when the help for a command was requested via -h.
+var errHelp = errors.New("help requested")
+
+// errBadPassword is returned when an encrypted document could not be opened with the given password.
+var errBadPassword = errors.New("wrong password")
+
+// licenseError indicates that the license could not be loaded.
+type licenseError struct {
+	err error
+}
+
+func (e licenseError) Error() string {
+	return e.err.Error()
+}
+
+// usageError indicates invalid command line arguments.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// stringList is a flag value collecting the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// usageErrorf returns a usageError with a formatted message.
+func usageErrorf(format string, a ...interface{}) error {
+	return usageError{msg: fmt.Sprintf(format, a...)}
+}
+
+// flagSet returns the flag set of `cmd`, creating it on first use.
+func (cmd *command) flagSet() *flag.FlagSet {
+	if cmd.fs != nil {
+		return cmd.fs
+	}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	if cmd.setFlags != nil {
+		cmd.setFlags(fs)
+	}
+	cmd.fs = fs
+	return fs
+}
+
+// parse parses the flags in `args` and checks that at least `minArgs` positional arguments remain.
+func (cmd *command) parse(args []string, minArgs int) ([]string, error) {
+	fs := cmd.flagSet()
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			cmd.printUsage()
+			return nil, errHelp
+		}
+		return nil, usageError{msg: err.Error()}
+	}
+	if fs.NArg() < minArgs {
+		return nil, usageErrorf("%s requires at least %d argument(s)", cmd.name, minArgs)
+	}
+	return fs.Args(), nil
+}
+
+func (cmd *command) printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: pdftool %s [options] %s\n", cmd.name, cmd.args)
+	fmt.Fprintf(os.Stderr, "%s\n", cmd.short)
+	if cmd.long != "" {
+		fmt.Fprintf(os.Stderr, "\n%s\n", strings.TrimSpace(cmd.long))
+	}
+
+	fs := cmd.flagSet()
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fs.SetOutput(os.Stderr)
+		fs.PrintDefaults()
+		fs.SetOutput(ioutil.Discard)
+	}
+}
+
+// loadLicense loads the offline license key if UNIDOC_LICENSE_FILE is set, otherwise the metered
+// API key from UNIDOC_LICENSE_API_KEY. Commands call it once their arguments are checked, before
+// doing any work, so that help and usage errors don't need a license.
+func loadLicense() error {
+	if keyPath := os.Getenv(`UNIDOC_LICENSE_FILE`); keyPath != "" {
+		content, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			return licenseError{err}
+		}
+		if err := license.SetLicenseKey(string(content), os.Getenv(`UNIDOC_LICENSE_CUSTOMER`)); err != nil {
+			return licenseError{err}
+		}
+		return nil
+	}
+
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	if err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`)); err != nil {
+		return licenseError{err}
+	}
+	return nil
+}
+
+// openReader opens the PDF at `inputPath`, decrypting it with `password` if it is encrypted.
+// An empty password is tried as best effort if `password` fails. The caller is responsible for
+// closing the returned file.
+func openReader(inputPath, password string) (*model.PdfReader, *os.File, error) {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pdfReader, err := model.NewPdfReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if err := decryptReader(pdfReader, inputPath, password); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return pdfReader, f, nil
+}
+
+// decryptReader decrypts `pdfReader` of the PDF at `inputPath` with `password` if it is
+// encrypted. An empty password is tried as best effort if `password` fails.
+func decryptReader(pdfReader *model.PdfReader, inputPath, password string) error {
+	isEncrypted, err := pdfReader.IsEncrypted()
+	if err != nil {
+		return err
+	}
+	if !isEncrypted {
+		return nil
+	}
+
+	for _, pass := range []string{password, ""} {
+		auth, err := pdfReader.Decrypt([]byte(pass))
+		if err != nil {
+			return err
+		}
+		if auth {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", inputPath, errBadPassword)
+}
+
+// requireOutput returns a usage error if no output path was given with -o.
+func requireOutput(outputPath string) error {
+	if outputPath == "" {
+		return usageErrorf("output path is required (-o)")
+	}
+	return nil
+}
+
+// parsePageRanges parses a page selection such as "1-3,5,8-" for a document with `numPages` pages.
+// An empty selection returns all pages. Open ended ranges run until the last page. Pages are returned
+// in the order given, each page at most once.
+func parsePageRanges(spec string, numPages int) ([]int, error) {
+	if strings.TrimSpace(spec) == "" {
+		pages := make([]int, numPages)
+		for i := range pages {
+			pages[i] = i + 1
+		}
+		return pages, nil
+	}
+
+	seen := map[int]bool{}
+	var pages []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to := part, part
+		if idx := strings.Index(part, "-"); idx >= 0 {
+			from, to = part[:idx], part[idx+1:]
+		}
+
+		first := 1
+		if from != "" {
+			n, err := strconv.Atoi(strings.TrimSpace(from))
+			if err != nil {
+				return nil, usageErrorf("invalid page range %q", part)
+			}
+			first = n
+		}
+		last := numPages
+		if to != "" {
+			n, err := strconv.Atoi(strings.TrimSpace(to))
+			if err != nil {
+				return nil, usageErrorf("invalid page range %q", part)
+			}
+			last = n
+		}
+		if first < 1 || last > numPages || first > last {
+			return nil, usageErrorf("page range %q out of bounds (document has %d pages)", part, numPages)
+		}
+
+		for pageNum := first; pageNum <= last; pageNum++ {
+			if !seen[pageNum] {
+				seen[pageNum] = true
+				pages = append(pages, pageNum)
+			}
+		}
+	}
+	return pages, nil
+}
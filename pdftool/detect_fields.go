@@ -0,0 +1,96 @@
+/*
+ * pdftool detect-fields: Converts a flat PDF form into a fillable one by detecting its fill-in lines,
+ * boxes, check boxes and signature lines, using text/detect and forms/design.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/unidoc/unidoc-examples/forms/design"
+	"github.com/unidoc/unidoc-examples/text/detect"
+)
+
+var detectFieldsCmd = &command{
+	name:  "detect-fields",
+	args:  "input.pdf",
+	short: "Detect the fillable regions of a flat PDF form and add AcroForm fields for them.",
+	long: `
+Fill-in lines (runs of underscores or line paths), empty boxes, check box squares (rectangles,
+ballot box glyphs or "[ ]") and signature lines are detected on each page. Fields are named from
+their nearest labels, and labels ending with "*" make them required. Regions covered by existing
+fields are skipped.
+
+With -o, the PDF with the fields added is written. With -spec, the form spec of the detected
+fields is written, as JSON if the path ends with .json and as YAML otherwise, to be reviewed and
+added with form-design.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&detectFieldsOpts.output, "o", "", "Output PDF path")
+		fs.StringVar(&detectFieldsOpts.spec, "spec", "", "Output path of the form spec of the detected fields")
+		fs.StringVar(&detectFieldsOpts.password, "password", "", "Password for an encrypted input file")
+		fs.Float64Var(&detectFieldsOpts.minLine, "min-line", 0, "Minimum length of fill-in lines in points (default 36)")
+		fs.Float64Var(&detectFieldsOpts.labelDistance, "label-distance", 0,
+			"Maximum distance of labels from their fields in points (default 150)")
+	},
+	run: runDetectFields,
+}
+
+var detectFieldsOpts struct {
+	output        string
+	spec          string
+	password      string
+	minLine       float64
+	labelDistance float64
+}
+
+func runDetectFields(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if detectFieldsOpts.output == "" && detectFieldsOpts.spec == "" {
+		return usageErrorf("-o or -spec is required")
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], detectFieldsOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	spec, err := detect.Detect(pdfReader, detect.Options{
+		MinLineLength: detectFieldsOpts.minLine,
+		LabelDistance: detectFieldsOpts.labelDistance,
+	})
+	if err != nil {
+		return err
+	}
+	for _, field := range spec.Fields {
+		fmt.Printf("%-10s %-32s page %d %v\n", field.Type, field.Name, field.Page, field.Rect)
+	}
+	if detectFieldsOpts.spec != "" {
+		if err := spec.Save(detectFieldsOpts.spec); err != nil {
+			return err
+		}
+		fmt.Printf("Form spec written to %s\n", detectFieldsOpts.spec)
+	}
+	if detectFieldsOpts.output == "" {
+		return nil
+	}
+
+	pdfWriter, err := design.AddToReader(pdfReader, spec)
+	if err != nil {
+		return err
+	}
+	if err := pdfWriter.WriteToFile(detectFieldsOpts.output); err != nil {
+		return err
+	}
+	fmt.Printf("%d field(s) added, output written to %s\n", len(spec.Fields), detectFieldsOpts.output)
+	return nil
+}
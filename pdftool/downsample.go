@@ -0,0 +1,153 @@
+/*
+ * pdftool downsample: Resamples the images of a PDF file whose effective resolution, i.e. the
+ * resolution at the size they are drawn on the page, exceeds a target, using compress/downsample.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/unidoc/unidoc-examples/compress/downsample"
+)
+
+var downsampleCmd = &command{
+	name:  "downsample",
+	args:  "input.pdf",
+	short: "Resample images above a target effective resolution.",
+	long: `
+The effective resolution of an image is computed from the size it is drawn at on the page. Images
+drawn several times are resampled for their largest placement, so no placement falls below the
+target resolution. Soft masks and masks are resampled together with their images.
+
+JPEG and JBIG2 images are re-encoded with their original filter, all other images with Flate.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&downsampleOpts.output, "o", "", "Output PDF path (required)")
+		fs.StringVar(&downsampleOpts.password, "password", "", "Password for an encrypted input file")
+		fs.Float64Var(&downsampleOpts.dpi, "dpi", 150, "Target effective resolution")
+		fs.Float64Var(&downsampleOpts.threshold, "threshold", 1.1, "Only resample images above dpi*threshold")
+		fs.StringVar(&downsampleOpts.filter, "filter", "lanczos", "Resampling filter: bicubic or lanczos")
+		fs.IntVar(&downsampleOpts.quality, "quality", 85, "Quality of re-encoded JPEG images (1-100)")
+		fs.StringVar(&downsampleOpts.report, "report", "", "Write a JSON report of all images to this path")
+		fs.BoolVar(&downsampleOpts.verbose, "v", false, "Print a line per image")
+	},
+	run: runDownsample,
+}
+
+var downsampleOpts struct {
+	output    string
+	password  string
+	dpi       float64
+	threshold float64
+	filter    string
+	quality   int
+	report    string
+	verbose   bool
+}
+
+func runDownsample(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(downsampleOpts.output); err != nil {
+		return err
+	}
+	if downsampleOpts.dpi <= 0 {
+		return usageErrorf("invalid resolution %g", downsampleOpts.dpi)
+	}
+	if downsampleOpts.threshold < 1 {
+		return usageErrorf("invalid threshold %g: must be at least 1", downsampleOpts.threshold)
+	}
+	if downsampleOpts.quality < 1 || downsampleOpts.quality > 100 {
+		return usageErrorf("invalid quality %d", downsampleOpts.quality)
+	}
+	filter, err := downsample.ParseFilter(downsampleOpts.filter)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], downsampleOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	downsampler := downsample.New(downsample.Options{
+		DPI:       downsampleOpts.dpi,
+		Threshold: downsampleOpts.threshold,
+		Filter:    filter,
+		Quality:   downsampleOpts.quality,
+	})
+
+	// All placements must be known before any image is resampled.
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return err
+	}
+	for pageNum := 1; pageNum <= numPages; pageNum++ {
+		page, err := pdfReader.GetPage(pageNum)
+		if err != nil {
+			return err
+		}
+		if err := downsampler.AddPage(page, pageNum); err != nil {
+			return fmt.Errorf("page %d: %w", pageNum, err)
+		}
+	}
+	if err := downsampler.Apply(); err != nil {
+		return err
+	}
+
+	pdfWriter, err := pdfReader.ToWriter(nil)
+	if err != nil {
+		return err
+	}
+	if err := pdfWriter.WriteToFile(downsampleOpts.output); err != nil {
+		return err
+	}
+
+	images := downsampler.Images()
+	resampled, before, after := 0, 0, 0
+	for _, img := range images {
+		if img.Resampled {
+			resampled++
+		}
+		before += img.Before
+		after += img.After
+		if !downsampleOpts.verbose {
+			continue
+		}
+		fmt.Printf("%-12s pages %v  %dx%d at %.0fx%.0f dpi", img.Name, img.Pages, img.Width, img.Height,
+			img.DPIX, img.DPIY)
+		if img.Resampled {
+			fmt.Printf(" -> %dx%d, %d -> %d bytes", img.NewWidth, img.NewHeight, img.Before, img.After)
+		}
+		if img.Note != "" {
+			fmt.Printf("  (%s)", img.Note)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Resampled %d of %d image(s) to %g dpi: %d -> %d bytes of image data\n",
+		resampled, len(images), downsampleOpts.dpi, before, after)
+	if summary, err := sizeChange(args[0], downsampleOpts.output); err == nil {
+		fmt.Printf("File size: %s\n", summary)
+	}
+
+	if downsampleOpts.report != "" {
+		data, err := json.MarshalIndent(images, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(downsampleOpts.report, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
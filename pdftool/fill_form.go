@@ -0,0 +1,199 @@
+/*
+ * pdftool fill-form: Fills the form fields of a PDF file from typed JSON data using forms/fill,
+ * optionally flattening the result. Without -data, the fields and their values are listed as JSON
+ * instead.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/forms/fill"
+	"github.com/unidoc/unidoc-examples/forms/xfdf"
+)
+
+var fillFormCmd = &command{
+	name:  "fill-form",
+	args:  "input.pdf",
+	short: "Fill form fields from JSON, XFDF or FDF data or list them as JSON.",
+	long: `
+The JSON data is either the format produced when running without -data, i.e. a list of
+{"name": ..., "value": ...} objects, or an object of typed values by field name, e.g.
+{"Amount": 1234.5, "Date": "2024-03-01", "Agree": true, "Toppings": ["Cheese", "Ham"]}.
+Data files ending with .xfdf or .fdf are read as XFDF or FDF; the annotations of XFDF data are
+added to the pages.
+
+Values are checked against their fields: maximum length, comb and multiline flags, the number,
+percentage, date and special formats and ranges of the field scripts (AFNumber_Format,
+AFPercent_Format, AFDate_FormatEx, AFSpecial_Format, AFRange_Validate), the states of check boxes
+and radio buttons and the options of list and combo boxes. Rejected values are listed and leave
+their fields unchanged; with -strict nothing is written and the exit code is 1. Fields with
+AFSimple_Calculate calculations are recalculated unless -no-calculate is given.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&fillFormOpts.output, "o", "", "Output PDF path (required with -data)")
+		fs.StringVar(&fillFormOpts.password, "password", "", "Password for an encrypted input file")
+		fs.StringVar(&fillFormOpts.data, "data", "", "JSON, XFDF or FDF file with the field values")
+		fs.BoolVar(&fillFormOpts.flatten, "flatten", false, "Flatten the form fields after filling")
+		fs.BoolVar(&fillFormOpts.strict, "strict", false, "Fail without writing if a value is rejected or a required field is empty")
+		fs.BoolVar(&fillFormOpts.noCalculate, "no-calculate", false, "Don't recalculate the calculated fields")
+		fs.StringVar(&fillFormOpts.report, "report", "", "Write the JSON fill report to this path")
+	},
+	run: runFillForm,
+}
+
+var fillFormOpts struct {
+	output      string
+	password    string
+	data        string
+	flatten     bool
+	strict      bool
+	noCalculate bool
+	report      string
+}
+
+func runFillForm(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	// Without data, the fields are listed instead of filled.
+	if fillFormOpts.data != "" {
+		if err := requireOutput(fillFormOpts.output); err != nil {
+			return err
+		}
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], fillFormOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if pdfReader.AcroForm == nil {
+		return fmt.Errorf("%s has no form fields", args[0])
+	}
+
+	// No data specified: Export list of fields and values as JSON.
+	if fillFormOpts.data == "" {
+		data, err := json.MarshalIndent(listFieldValues(pdfReader.AcroForm), "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	values, annots, err := loadFormData(fillFormOpts.data)
+	if err != nil {
+		return err
+	}
+
+	// Populate the form data and generate the field appearances.
+	fieldAppearance := annotator.FieldAppearance{OnlyIfMissing: true, RegenerateTextFields: true}
+	report, err := fill.Fill(pdfReader.AcroForm, values, fill.Options{
+		Appearance:  fieldAppearance,
+		NoCalculate: fillFormOpts.noCalculate,
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range report.Rejected {
+		fmt.Printf("rejected %s = %q: %s\n", r.Field, r.Value, r.Reason)
+	}
+	for _, name := range report.Missing {
+		fmt.Printf("missing required field %s\n", name)
+	}
+	for _, w := range report.Warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+	if fillFormOpts.report != "" {
+		data, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fillFormOpts.report, data, 0644); err != nil {
+			return err
+		}
+	}
+	if fillFormOpts.strict && !report.OK() {
+		return fmt.Errorf("%d value(s) rejected, %d required field(s) missing", len(report.Rejected),
+			len(report.Missing))
+	}
+	if _, err := xfdf.AddAnnotations(pdfReader, annots); err != nil {
+		return err
+	}
+
+	if fillFormOpts.flatten {
+		err = pdfReader.FlattenFields(true, fieldAppearance)
+		if err != nil {
+			return err
+		}
+	}
+
+	pdfWriter, err := pdfReader.ToWriter(nil)
+	if err != nil {
+		return err
+	}
+
+	return pdfWriter.WriteToFile(fillFormOpts.output)
+}
+
+// loadFormData loads the field values of the form data file `path`, typed JSON or, by extension,
+// XFDF or FDF, and the annotations of XFDF files.
+func loadFormData(path string) (fill.Values, []*xfdf.Annotation, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xfdf", ".fdf":
+		doc, err := xfdf.Load(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return doc.Values(), doc.Annotations, nil
+	}
+	values, err := fill.LoadValues(path)
+	return values, nil, err
+}
+
+// fieldValue is a field name and value pair in the JSON format read by fjson.
+type fieldValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// listFieldValues returns the names and values of the terminal fields of `acroForm`. The fields are
+// read from the already decrypted form so that listing works for encrypted documents too.
+func listFieldValues(acroForm *model.PdfAcroForm) []fieldValue {
+	values := []fieldValue{}
+	for _, field := range acroForm.AllFields() {
+		if !field.IsTerminal() {
+			continue
+		}
+		name, err := field.FullName()
+		if err != nil {
+			continue
+		}
+
+		var value string
+		switch t := core.TraceToDirectObject(field.V).(type) {
+		case *core.PdfObjectString:
+			value = t.Decoded()
+		case *core.PdfObjectName:
+			value = t.String()
+		}
+		values = append(values, fieldValue{Name: name, Value: value})
+	}
+	return values
+}
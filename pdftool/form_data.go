@@ -0,0 +1,88 @@
+/*
+ * pdftool form-data: Exports the field values and annotations of a PDF as XFDF, FDF or JSON, or
+ * converts form data between these formats, using forms/xfdf.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/unidoc/unidoc-examples/forms/xfdf"
+)
+
+var formDataCmd = &command{
+	name:  "form-data",
+	args:  "input.pdf|input.xfdf|input.fdf|input.json",
+	short: "Export form data of a PDF or convert form data between XFDF, FDF and JSON.",
+	long: `
+The formats are chosen by the file extensions: .xfdf (or any other), .fdf, .json and, for the
+input, .pdf. JSON form data is the list of {"name": ..., "value": ...} objects of fjson and
+pdftool fill-form; objects of typed values by field name are read too.
+
+XFDF holds the field values and the annotations (comments, highlights, drawings), FDF and JSON
+the field values only. Exported from a PDF, the XFDF refers to the input file by name.
+
+The output can be filled into a PDF with pdftool fill-form -data.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&formDataOpts.output, "o", "", "Output .xfdf, .fdf or .json path (required)")
+		fs.StringVar(&formDataOpts.password, "password", "", "Password for an encrypted input PDF")
+		fs.BoolVar(&formDataOpts.noAnnots, "no-annots", false, "Leave out the annotations")
+	},
+	run: runFormData,
+}
+
+var formDataOpts struct {
+	output   string
+	password string
+	noAnnots bool
+}
+
+func runFormData(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(formDataOpts.output); err != nil {
+		return err
+	}
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	inputPath := args[0]
+
+	var doc *xfdf.Document
+	if strings.EqualFold(filepath.Ext(inputPath), ".pdf") {
+		pdfReader, f, err := openReader(inputPath, formDataOpts.password)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if doc, err = xfdf.Export(pdfReader); err != nil {
+			return err
+		}
+		doc.Href = filepath.Base(inputPath)
+	} else if doc, err = xfdf.Load(inputPath); err != nil {
+		return err
+	}
+	// Only XFDF holds annotations.
+	switch strings.ToLower(filepath.Ext(formDataOpts.output)) {
+	case ".fdf", ".json":
+		doc.Annotations = nil
+	}
+	if formDataOpts.noAnnots {
+		doc.Annotations = nil
+	}
+
+	if err := doc.Save(formDataOpts.output); err != nil {
+		return err
+	}
+	fmt.Printf("%d field(s), %d annotation(s) written to %s\n", len(doc.Fields), len(doc.Annotations),
+		formDataOpts.output)
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+ * pdftool form-design: Adds form fields described by a JSON or YAML form spec to a PDF or to blank
+ * pages, or exports the spec of the fields of a PDF, using forms/design.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/forms/design"
+)
+
+var formDesignCmd = &command{
+	name:  "form-design",
+	args:  "[input.pdf]",
+	short: "Add form fields from a JSON/YAML spec to a PDF or blank pages, or export the spec of a PDF.",
+	long: `
+The spec lists the fields with their page, rectangle, type (text, checkbox, radio, combo, list,
+button or signature), tooltip, tab order, required and read-only flags, default values, options,
+font, font size and colors; see forms/design for the format. Without input.pdf, the fields are
+added to blank pages of the spec's page_size (Letter by default).
+
+With -export, the spec of the fields of input.pdf is written to the -o path instead, as JSON if
+it ends with .json and as YAML otherwise. Exported specs can be edited and added to other
+documents, or to blank pages to rebuild the form.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&formDesignOpts.output, "o", "", "Output PDF path, or spec path with -export (required)")
+		fs.StringVar(&formDesignOpts.password, "password", "", "Password for an encrypted input file")
+		fs.StringVar(&formDesignOpts.spec, "spec", "", "JSON or YAML form spec to add")
+		fs.BoolVar(&formDesignOpts.export, "export", false, "Export the spec of the fields of input.pdf")
+	},
+	run: runFormDesign,
+}
+
+var formDesignOpts struct {
+	output   string
+	password string
+	spec     string
+	export   bool
+}
+
+func runFormDesign(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 0)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(formDesignOpts.output); err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return usageErrorf("form-design takes at most one input file")
+	}
+	if formDesignOpts.export {
+		if len(args) == 0 || formDesignOpts.spec != "" {
+			return usageErrorf("-export requires input.pdf and no -spec")
+		}
+		return exportFormSpec(args[0])
+	}
+	if formDesignOpts.spec == "" {
+		return usageErrorf("-spec or -export is required")
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	spec, err := design.LoadSpec(formDesignOpts.spec)
+	if err != nil {
+		return err
+	}
+	var pdfWriter *model.PdfWriter
+	if len(args) == 0 {
+		pdfWriter, err = design.NewDocument(spec)
+		if err != nil {
+			return err
+		}
+	} else {
+		pdfReader, f, err := openReader(args[0], formDesignOpts.password)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		pdfWriter, err = design.AddToReader(pdfReader, spec)
+		if err != nil {
+			return err
+		}
+	}
+	if err := pdfWriter.WriteToFile(formDesignOpts.output); err != nil {
+		return err
+	}
+	fmt.Printf("%d field(s) added, output written to %s\n", len(spec.Fields), formDesignOpts.output)
+	return nil
+}
+
+// exportFormSpec writes the form spec of the fields of the PDF `inputPath` to the output path.
+func exportFormSpec(inputPath string) error {
+	if err := loadLicense(); err != nil {
+		return err
+	}
+	pdfReader, f, err := openReader(inputPath, formDesignOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	spec, err := design.Export(pdfReader)
+	if err != nil {
+		return err
+	}
+	if err := spec.Save(formDesignOpts.output); err != nil {
+		return err
+	}
+	fmt.Printf("%d field(s) written to %s\n", len(spec.Fields), formDesignOpts.output)
+	return nil
+}
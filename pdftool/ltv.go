@@ -0,0 +1,148 @@
+/*
+ * pdftool ltv: LTV enables the signatures of a PDF file by adding their validation data to the
+ * DSS, downloaded by unipdf or, on machines without network access, from pre-fetched CRLs and
+ * OCSP responses using signatures/ltv/offline.
+ */
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/signatures/ltv/offline"
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+var ltvCmd = &command{
+	name:  "ltv",
+	args:  "input.pdf",
+	short: "Add the validation data of the signatures to the DSS.",
+	long: `
+The certificates, OCSP responses and CRLs of the signature chains are added to the DSS in an
+incremental update, globally and in a VRI entry per signature.
+
+Without -revocation-dir, missing certificates and the revocation data are downloaded from the
+URLs in the certificates. With -revocation-dir nothing is downloaded: the DER or PEM files of
+the directories (CRLs, OCSP responses and issuer certificates, told apart by their content) are
+matched to the certificates of the signatures and timestamps, and the certificates that still
+lack revocation information are listed. -require-complete makes that a failure (exit code 1).`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&ltvOpts.output, "o", "", "Output PDF path (required)")
+		fs.StringVar(&ltvOpts.password, "password", "", "Password for an encrypted input file")
+		fs.Var(&ltvOpts.revocationDirs, "revocation-dir", "Directory of pre-fetched CRLs and OCSP responses (repeatable)")
+		fs.Var(&ltvOpts.chain, "chain", "Extra certificate file or directory for building the chains (repeatable)")
+		fs.BoolVar(&ltvOpts.requireComplete, "require-complete", false, "Fail if a certificate lacks revocation information")
+		fs.StringVar(&ltvOpts.report, "report", "", "Write the JSON report of -revocation-dir to this path")
+	},
+	run: runLTV,
+}
+
+var ltvOpts struct {
+	output          string
+	password        string
+	revocationDirs  stringList
+	chain           stringList
+	requireComplete bool
+	report          string
+}
+
+func runLTV(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(ltvOpts.output); err != nil {
+		return err
+	}
+	if len(ltvOpts.revocationDirs) == 0 && (ltvOpts.report != "" || ltvOpts.requireComplete) {
+		return usageErrorf("-report and -require-complete need -revocation-dir")
+	}
+	var extraCerts []*x509.Certificate
+	if len(ltvOpts.chain) > 0 {
+		if extraCerts, err = verify.LoadCertificates(ltvOpts.chain...); err != nil {
+			return err
+		}
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], ltvOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	appender, err := model.NewPdfAppender(pdfReader)
+	if err != nil {
+		return err
+	}
+
+	if len(ltvOpts.revocationDirs) == 0 {
+		ltv, err := model.NewLTV(appender)
+		if err != nil {
+			return err
+		}
+		if err := ltv.EnableAll(extraCerts); err != nil {
+			return err
+		}
+		return appender.WriteToFile(ltvOpts.output)
+	}
+
+	store, err := offline.Load(ltvOpts.revocationDirs...)
+	if err != nil {
+		return err
+	}
+	for _, path := range store.Skipped {
+		fmt.Printf("skipped %s: not a certificate, CRL or OCSP response\n", path)
+	}
+	report, err := offline.Enable(appender, store, extraCerts)
+	if err != nil {
+		return err
+	}
+	for _, sr := range report.Signatures {
+		fmt.Printf("%s: VRI %s\n", sr.Field, sr.VRIKey)
+		for _, c := range sr.Certificates {
+			var sources []string
+			sources = append(sources, c.OCSP...)
+			sources = append(sources, c.CRL...)
+			switch {
+			case c.Missing != "":
+				fmt.Printf("  %-9s %s: MISSING (%s)\n", c.Role, c.Subject, c.Missing)
+			case c.Role == offline.RoleRoot:
+				fmt.Printf("  %-9s %s\n", c.Role, c.Subject)
+			default:
+				fmt.Printf("  %-9s %s: %s (%s)\n", c.Role, c.Subject, c.Status, strings.Join(sources, ", "))
+			}
+		}
+	}
+
+	if ltvOpts.report != "" {
+		data, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(ltvOpts.report, data, 0644); err != nil {
+			return err
+		}
+	}
+	if err := appender.WriteToFile(ltvOpts.output); err != nil {
+		return err
+	}
+
+	if len(report.Missing) > 0 {
+		fmt.Printf("%d certificate(s) lack revocation information\n", len(report.Missing))
+		if ltvOpts.requireComplete {
+			return fmt.Errorf("revocation information incomplete")
+		}
+	}
+	return nil
+}
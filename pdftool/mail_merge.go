@@ -0,0 +1,141 @@
+/*
+ * pdftool mail-merge: Fills a PDF form template once per record of a CSV or JSON dataset, writing
+ * one PDF per record or a single concatenated PDF, using forms/mailmerge.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/unidoc/unidoc-examples/forms/mailmerge"
+)
+
+var mailMergeCmd = &command{
+	name:  "mail-merge",
+	args:  "template.pdf records.csv|records.json",
+	short: "Fill a form template once per record of a dataset.",
+	long: `
+The records are read from a CSV file with the field names in the header row, or from a JSON
+array of objects of values by field name. The values are typed and validated as by pdftool
+fill-form; values of names that are not fields are ignored but can be used in the patterns.
+
+With -o, every record is written to its own file in the output directory, named by the -name
+pattern. With -concat, the filled documents are concatenated into one PDF with an outline entry
+per record, titled by the -title pattern. Patterns replace {name} by the value of the record for
+name and {#} by the record number, e.g. -name "{Region}/invoice-{Customer}-{#}.pdf".
+
+The template is read once and the records are filled concurrently. The command fails (exit code
+1) if any record failed; with -strict, records with rejected values or missing required fields
+fail and are not written.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&mailMergeOpts.output, "o", "", "Output directory for one PDF per record")
+		fs.StringVar(&mailMergeOpts.concat, "concat", "", "Output PDF concatenating all records (instead of -o)")
+		fs.StringVar(&mailMergeOpts.name, "name", "{#}.pdf", "Output file name pattern (-o)")
+		fs.StringVar(&mailMergeOpts.title, "title", "{#}", "Outline title pattern (-concat)")
+		fs.StringVar(&mailMergeOpts.password, "password", "", "Password for an encrypted template")
+		fs.BoolVar(&mailMergeOpts.flatten, "flatten", false, "Flatten the form fields after filling")
+		fs.BoolVar(&mailMergeOpts.strict, "strict", false, "Fail records with rejected values or empty required fields")
+		fs.BoolVar(&mailMergeOpts.noCalculate, "no-calculate", false, "Don't recalculate the calculated fields")
+		fs.IntVar(&mailMergeOpts.workers, "workers", 0, "Number of records filled concurrently (default number of CPUs)")
+		fs.StringVar(&mailMergeOpts.report, "report", "", "Write the JSON results of all records to this path")
+		fs.BoolVar(&mailMergeOpts.quiet, "q", false, "Do not print a line per record")
+	},
+	run: runMailMerge,
+}
+
+var mailMergeOpts struct {
+	output      string
+	concat      string
+	name        string
+	title       string
+	password    string
+	flatten     bool
+	strict      bool
+	noCalculate bool
+	workers     int
+	report      string
+	quiet       bool
+}
+
+func runMailMerge(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 2)
+	if err != nil {
+		return err
+	}
+	if (mailMergeOpts.output == "") == (mailMergeOpts.concat == "") {
+		return usageErrorf("either an output directory (-o) or an output file (-concat) is required")
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	tmpl, err := mailmerge.LoadTemplate(args[0], mailMergeOpts.password)
+	if err != nil {
+		return err
+	}
+	records, err := mailmerge.LoadRecords(args[1])
+	if err != nil {
+		return err
+	}
+
+	opts := mailmerge.Options{
+		Flatten:     mailMergeOpts.flatten,
+		NoCalculate: mailMergeOpts.noCalculate,
+		Strict:      mailMergeOpts.strict,
+		Workers:     mailMergeOpts.workers,
+		Progress: func(done, total int, res *mailmerge.Result) {
+			if mailMergeOpts.quiet && res.OK() {
+				return
+			}
+			fmt.Printf("[%d/%d] record %d", done, total, res.Record)
+			if res.Output != "" {
+				fmt.Printf(" %s", res.Output)
+			}
+			if !res.OK() {
+				fmt.Printf(": %s", res.Error)
+			} else if n := len(res.Report.Rejected); n > 0 {
+				fmt.Printf(" (%d value(s) rejected)", n)
+			}
+			fmt.Println()
+		},
+	}
+
+	var results []*mailmerge.Result
+	if mailMergeOpts.concat != "" {
+		results, err = mailmerge.Concatenate(tmpl, records, mailMergeOpts.concat, mailMergeOpts.title, opts)
+	} else {
+		results, err = mailmerge.Files(tmpl, records, mailMergeOpts.output, mailMergeOpts.name, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	if mailMergeOpts.report != "" {
+		data, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(mailMergeOpts.report, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, res := range results {
+		if !res.OK() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d record(s) failed", failed, len(results))
+	}
+	if !mailMergeOpts.quiet {
+		fmt.Printf("%d record(s) filled\n", len(results))
+	}
+	return nil
+}
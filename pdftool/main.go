@@ -0,0 +1,142 @@
+/*
+ * pdftool: A single command line tool bundling the most common document operations of the examples
+ * (merge, split, rotate, protect, unlock, sign, prepare-sign, sign-status, extract-text, fill-form,
+ * form-data, mail-merge, form-design, detect-fields, redact, batch, recompress, downsample, pdfa,
+ * xmp, verify, verify-timestamps, ltv, sign-inventory) behind one stable interface.
+ *
+ * All subcommands share the same conventions:
+ *  - Options are given as flags before the positional arguments, e.g. -o output.pdf.
+ *  - Encrypted inputs are opened with -password (an empty password is tried as a fallback).
+ *  - The license is loaded from UNIDOC_LICENSE_API_KEY (metered) or, if set, from the offline
+ *    key file in UNIDOC_LICENSE_FILE together with UNIDOC_LICENSE_CUSTOMER, once the arguments
+ *    are checked: help and usage errors don't need a license.
+ *  - Exit codes: 0 success, 1 processing failure, 2 invalid usage, 3 wrong password, 4 license error.
+ *
+ * Build as: go build -o bin/pdftool ./pdftool
+ * Run as: pdftool <command> [options] <arguments>
+ *         pdftool help <command>
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Exit codes returned by pdftool. Scripts can rely on these to distinguish between failure types.
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitBadPassword = 3
+	exitLicense     = 4
+)
+
+// commands lists all available subcommands in the order shown in the usage text.
+var commands = []*command{
+	mergeCmd,
+	splitCmd,
+	rotateCmd,
+	protectCmd,
+	unlockCmd,
+	signCmd,
+	prepareSignCmd,
+	signStatusCmd,
+	extractTextCmd,
+	fillFormCmd,
+	formDataCmd,
+	mailMergeCmd,
+	formDesignCmd,
+	detectFieldsCmd,
+	redactCmd,
+	batchCmd,
+	recompressCmd,
+	downsampleCmd,
+	pdfaCmd,
+	xmpCmd,
+	verifyCmd,
+	verifyTimestampsCmd,
+	ltvCmd,
+	signInventoryCmd,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the subcommand specified by `args` and returns the process exit code.
+func run(args []string) int {
+	if len(args) < 1 {
+		printUsage()
+		return exitUsage
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		if len(args) > 1 {
+			if cmd := findCommand(args[1]); cmd != nil {
+				cmd.printUsage()
+				return exitOK
+			}
+		}
+		printUsage()
+		return exitOK
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printUsage()
+		return exitUsage
+	}
+
+	err := cmd.run(cmd, args[1:])
+	return exitCode(cmd, err)
+}
+
+// exitCode maps the error returned by `cmd` to an exit code, printing the error if needed.
+func exitCode(cmd *command, err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var uerr usageError
+	var lerr licenseError
+	switch {
+	case errors.As(err, &uerr):
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", uerr)
+		cmd.printUsage()
+		return exitUsage
+	case errors.Is(err, errHelp):
+		return exitOK
+	case errors.As(err, &lerr):
+		fmt.Fprintf(os.Stderr, "License error: %v\n", lerr)
+		return exitLicense
+	case errors.Is(err, errBadPassword):
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitBadPassword
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return exitFailure
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: pdftool <command> [options] <arguments>\n\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'pdftool help <command>' for the options of a command.\n")
+}
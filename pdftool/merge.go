@@ -0,0 +1,62 @@
+/*
+ * pdftool merge: Merges the pages of multiple PDF files into a single output file, including
+ * their form fields (AcroForms).
+ */
+
+package main
+
+import (
+	"flag"
+
+	"github.com/unidoc/unidoc-examples/pages/merge"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+var mergeCmd = &command{
+	name:  "merge",
+	args:  "input1.pdf input2.pdf ...",
+	short: "Merge the pages of the input files into one PDF.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&mergeOpts.output, "o", "", "Output PDF path (required)")
+		fs.StringVar(&mergeOpts.password, "password", "", "Password for encrypted input files")
+	},
+	run: runMerge,
+}
+
+var mergeOpts struct {
+	output   string
+	password string
+}
+
+func runMerge(cmd *command, args []string) error {
+	inputPaths, err := cmd.parse(args, 2)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(mergeOpts.output); err != nil {
+		return err
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	var readers []*model.PdfReader
+	for _, inputPath := range inputPaths {
+		pdfReader, f, err := openReader(inputPath, mergeOpts.password)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		readers = append(readers, pdfReader)
+	}
+
+	// Merge the pages and the form fields (AcroForms) of all documents.
+	pdfWriter, err := merge.Documents(readers...)
+	if err != nil {
+		return err
+	}
+
+	return pdfWriter.WriteToFile(mergeOpts.output)
+}
@@ -0,0 +1,163 @@
+/*
+ * pdftool pdfa: Converts a PDF file to PDF/A-1b, PDF/A-2b or PDF/A-3b, or validates a PDF/A file,
+ * using metadata/pdfa.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/metadata/pdfa"
+)
+
+var pdfaCmd = &command{
+	name:  "pdfa",
+	args:  "input.pdf",
+	short: "Convert to PDF/A-1b, 2b or 3b, or validate a PDF/A file.",
+	long: `
+The conversion embeds substitutes for fonts that are not embedded (TrueType fonts of the same name
+from the -fonts directories, else the Go fonts), adds an output intent (sRGB unless -icc is given)
+and XMP metadata matching the document information, and removes JavaScript, forbidden actions and
+annotations, encryption, LZW compression and, for PDF/A-1b, transparency and optional content.
+Embedded files are kept as associated files for PDF/A-3b only. The output is validated afterwards.
+
+With -validate the input is only validated, against -level or else the level its metadata claims.
+Each violation is reported with the number of the object it was found in.
+
+The exit code is 1 if violations remain.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&pdfaOpts.output, "o", "", "Output PDF path (required unless -validate)")
+		fs.StringVar(&pdfaOpts.password, "password", "", "Password for an encrypted input file")
+		fs.StringVar(&pdfaOpts.level, "level", "", "PDF/A level: 1b, 2b or 3b (default 1b, or the claimed level with -validate)")
+		fs.BoolVar(&pdfaOpts.validate, "validate", false, "Only validate the input")
+		fs.StringVar(&pdfaOpts.icc, "icc", "", "ICC profile of the output intent (default built-in sRGB)")
+		fs.StringVar(&pdfaOpts.condition, "condition", "", "Output condition identifier of the -icc profile")
+		fs.Var(&pdfaOpts.fontDirs, "fonts", "Directory with TrueType substitutes for fonts that are not embedded (repeatable)")
+		fs.StringVar(&pdfaOpts.report, "report", "", "Write a JSON report of the changes and violations to this path")
+	},
+	run: runPdfa,
+}
+
+var pdfaOpts struct {
+	output    string
+	password  string
+	level     string
+	validate  bool
+	icc       string
+	condition string
+	fontDirs  stringList
+	report    string
+}
+
+// pdfaReport is the JSON report of pdftool pdfa.
+type pdfaReport struct {
+	Conversion *pdfa.Report     `json:"conversion,omitempty"`
+	Level      pdfa.Level       `json:"level"`
+	Violations []pdfa.Violation `json:"violations"`
+}
+
+func runPdfa(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	var level pdfa.Level
+	if pdfaOpts.level != "" {
+		if level, err = pdfa.ParseLevel(pdfaOpts.level); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+	if !pdfaOpts.validate {
+		if err := requireOutput(pdfaOpts.output); err != nil {
+			return err
+		}
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], pdfaOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	report := pdfaReport{}
+	if pdfaOpts.validate {
+		if level == "" {
+			if level, err = pdfa.Claimed(pdfReader); err != nil {
+				return err
+			}
+		}
+	} else {
+		if level == "" {
+			level = pdfa.Level1B
+		}
+		opts := pdfa.Options{
+			Level:           level,
+			OutputCondition: pdfaOpts.condition,
+			FontDirs:        pdfaOpts.fontDirs,
+		}
+		if pdfaOpts.icc != "" {
+			if opts.ICCProfile, err = ioutil.ReadFile(pdfaOpts.icc); err != nil {
+				return err
+			}
+		}
+		var buf bytes.Buffer
+		if report.Conversion, err = pdfa.Convert(pdfReader, &buf, opts); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(pdfaOpts.output, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		for _, change := range report.Conversion.Changes {
+			fmt.Printf("Changed: %s\n", change)
+		}
+		for _, problem := range report.Conversion.Problems {
+			fmt.Printf("Unresolved: %s\n", problem)
+		}
+
+		// Validate what was written.
+		if pdfReader, err = model.NewPdfReader(bytes.NewReader(buf.Bytes())); err != nil {
+			return err
+		}
+	}
+
+	if report.Violations, err = pdfa.Validate(pdfReader, level); err != nil {
+		return err
+	}
+	if level == "" {
+		level = pdfa.Level1B
+	}
+	report.Level = level
+	for _, v := range report.Violations {
+		fmt.Println(v)
+	}
+
+	if pdfaOpts.report != "" {
+		if report.Violations == nil {
+			report.Violations = []pdfa.Violation{}
+		}
+		data, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(pdfaOpts.report, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Violations) > 0 {
+		return fmt.Errorf("%d %s violation(s)", len(report.Violations), level)
+	}
+	fmt.Printf("No %s violations found\n", level)
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+ * pdftool prepare-sign: Adds named, unsigned signature fields for several signers from a JSON list
+ * of fields, using signatures/multisign. The fields are signed later, one at a time, with
+ * pdftool sign -field.
+ */
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/signatures/certify"
+	"github.com/unidoc/unidoc-examples/signatures/multisign"
+)
+
+var prepareSignCmd = &command{
+	name:  "prepare-sign",
+	args:  "input.pdf",
+	short: "Add empty signature fields for several signers.",
+	long: `
+The -fields JSON file lists the fields to add, in signing order:
+
+  [{"name": "Seller", "page": 1, "rect": [50, 50, 250, 110], "signer": "Seller (ACME Corp.)"},
+   {"name": "Buyer", "page": 1, "rect": [300, 50, 500, 110], "signer": "Buyer"}]
+
+rect is given as [llx, lly, urx, ury] in points, signer optionally describes who is to sign.
+The fields are added in an incremental update, so existing signatures are preserved. Sign them
+with pdftool sign -field NAME, in order with -in-order, and list them with pdftool sign-status.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&prepareSignOpts.output, "o", "", "Output PDF path (required)")
+		fs.StringVar(&prepareSignOpts.password, "password", "", "Password for an encrypted input file")
+		fs.StringVar(&prepareSignOpts.fields, "fields", "", "JSON file with the signature fields (required)")
+	},
+	run: runPrepareSign,
+}
+
+var prepareSignOpts struct {
+	output   string
+	password string
+	fields   string
+}
+
+func runPrepareSign(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(prepareSignOpts.output); err != nil {
+		return err
+	}
+	if prepareSignOpts.fields == "" {
+		return usageErrorf("fields file is required (-fields)")
+	}
+	fields, err := multisign.LoadFields(prepareSignOpts.fields)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return usageErrorf("%s lists no fields", prepareSignOpts.fields)
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	original, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	pdfReader, err := model.NewPdfReader(bytes.NewReader(original))
+	if err != nil {
+		return err
+	}
+	if err := decryptReader(pdfReader, args[0], prepareSignOpts.password); err != nil {
+		return err
+	}
+	appender, err := model.NewPdfAppender(pdfReader)
+	if err != nil {
+		return err
+	}
+	if err := multisign.Prepare(appender, fields); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := appender.Write(&buf); err != nil {
+		return err
+	}
+	if err := certify.Check(original, buf.Bytes(), prepareSignOpts.password); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(prepareSignOpts.output, buf.Bytes(), 0644)
+}
@@ -0,0 +1,132 @@
+/*
+ * pdftool protect: Encrypts a PDF file with a user and owner password and a set of permissions.
+ */
+
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/core/security"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+var protectCmd = &command{
+	name:  "protect",
+	args:  "input.pdf",
+	short: "Encrypt a PDF with a user and owner password.",
+	long: `
+The permissions granted to users opening the document with the user password are given as a
+comma separated list with -allow. Available permissions:
+  print, print-hq, modify, annotate, fill-forms, rotate, extract, accessibility, all, none`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&protectOpts.output, "o", "", "Output PDF path (required)")
+		fs.StringVar(&protectOpts.password, "password", "", "Password for an encrypted input file")
+		fs.StringVar(&protectOpts.userPassword, "user-password", "", "Password required to open the document")
+		fs.StringVar(&protectOpts.ownerPassword, "owner-password", "", "Password granting full access (required)")
+		fs.StringVar(&protectOpts.allow, "allow", "all", "Permissions granted with the user password")
+		fs.StringVar(&protectOpts.algorithm, "algorithm", "aes256", "Encryption algorithm (rc4, aes128, aes256)")
+	},
+	run: runProtect,
+}
+
+var protectOpts struct {
+	output        string
+	password      string
+	userPassword  string
+	ownerPassword string
+	allow         string
+	algorithm     string
+}
+
+// permissionNames maps the names accepted by -allow to the permission flags.
+var permissionNames = map[string]security.Permissions{
+	"print":         security.PermPrinting,
+	"print-hq":      security.PermFullPrintQuality,
+	"modify":        security.PermModify,
+	"annotate":      security.PermAnnotate,
+	"fill-forms":    security.PermFillForms,
+	"rotate":        security.PermRotateInsert,
+	"extract":       security.PermExtractGraphics,
+	"accessibility": security.PermDisabilityExtract,
+}
+
+// encryptionAlgorithms maps the names accepted by -algorithm to the encryption algorithms.
+var encryptionAlgorithms = map[string]model.EncryptionAlgorithm{
+	"rc4":    model.RC4_128bit,
+	"aes128": model.AES_128bit,
+	"aes256": model.AES_256bit,
+}
+
+func runProtect(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(protectOpts.output); err != nil {
+		return err
+	}
+	if protectOpts.ownerPassword == "" {
+		return usageErrorf("owner password is required (-owner-password)")
+	}
+
+	permissions, err := parsePermissions(protectOpts.allow)
+	if err != nil {
+		return err
+	}
+	algorithm, ok := encryptionAlgorithms[strings.ToLower(protectOpts.algorithm)]
+	if !ok {
+		return usageErrorf("unknown encryption algorithm %q", protectOpts.algorithm)
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], protectOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pdfWriter, err := pdfReader.ToWriter(nil)
+	if err != nil {
+		return err
+	}
+
+	encryptOptions := &model.EncryptOptions{
+		Permissions: permissions,
+		Algorithm:   algorithm,
+	}
+	err = pdfWriter.Encrypt([]byte(protectOpts.userPassword), []byte(protectOpts.ownerPassword), encryptOptions)
+	if err != nil {
+		return err
+	}
+
+	return pdfWriter.WriteToFile(protectOpts.output)
+}
+
+// parsePermissions converts a comma separated list of permission names to a permission bitmask.
+func parsePermissions(list string) (security.Permissions, error) {
+	var permissions security.Permissions
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "", "none":
+			continue
+		case "all":
+			for _, perm := range permissionNames {
+				permissions |= perm
+			}
+			continue
+		}
+
+		perm, ok := permissionNames[name]
+		if !ok {
+			return 0, usageErrorf("unknown permission %q", name)
+		}
+		permissions |= perm
+	}
+	return permissions, nil
+}
@@ -0,0 +1,139 @@
+/*
+ * pdftool recompress: Re-encodes each image of a PDF file with the format best suited to its content
+ * (JBIG2 for bilevel scans, JPEG for photos and grayscale images, Flate for line art), using the
+ * policy engine of compress/recompress.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/compress/recompress"
+)
+
+var recompressCmd = &command{
+	name:  "recompress",
+	args:  "input.pdf",
+	short: "Re-encode each image with the format best suited to its content.",
+	long: `
+Each image is classified as bilevel (e.g. scanned text), grayscale, lineart (few colors or flat
+areas) or photo. The policy maps the classes to formats: jbig2 (bilevel only), jpeg, flate, jpx or
+keep. The default policy is
+  bilevel=jbig2,grayscale=jpeg,lineart=flate,photo=jpeg
+and -policy overrides single entries, e.g. -policy photo=keep,lineart=jpeg.
+
+JPX encoding needs an external JPEG 2000 encoder and falls back to JPEG in pdftool. See
+compress/pdf_recompress_images_cgo.go for JPX support.
+
+Masks and soft masks are kept. An image is only replaced if the new encoding is smaller.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&recompressOpts.output, "o", "", "Output PDF path (required)")
+		fs.StringVar(&recompressOpts.password, "password", "", "Password for an encrypted input file")
+		fs.StringVar(&recompressOpts.policy, "policy", "", "Policy overrides as class=format pairs, e.g. photo=jpeg,lineart=keep")
+		fs.IntVar(&recompressOpts.quality, "quality", 75, "Quality of JPEG encoding (1-100)")
+		fs.IntVar(&recompressOpts.minPixels, "min-pixels", 1024, "Keep images with fewer pixels")
+		fs.StringVar(&recompressOpts.report, "report", "", "Write a JSON report of all images to this path")
+		fs.BoolVar(&recompressOpts.verbose, "v", false, "Print a line per image")
+	},
+	run: runRecompress,
+}
+
+var recompressOpts struct {
+	output    string
+	password  string
+	policy    string
+	quality   int
+	minPixels int
+	report    string
+	verbose   bool
+}
+
+func runRecompress(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(recompressOpts.output); err != nil {
+		return err
+	}
+	policy, err := recompress.ParsePolicy(recompressOpts.policy)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	if recompressOpts.quality < 1 || recompressOpts.quality > 100 {
+		return usageErrorf("invalid quality %d", recompressOpts.quality)
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], recompressOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	recompressor := recompress.New(recompress.Options{
+		Policy:    policy,
+		Quality:   recompressOpts.quality,
+		MinPixels: recompressOpts.minPixels,
+	})
+	pdfWriter, err := pdfReader.ToWriter(&model.ReaderToWriterOpts{
+		PageProcessCallback: func(pageNum int, page *model.PdfPage) error {
+			if err := recompressor.ProcessPage(page, pageNum); err != nil {
+				return fmt.Errorf("page %d: %w", pageNum, err)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := pdfWriter.WriteToFile(recompressOpts.output); err != nil {
+		return err
+	}
+
+	results := recompressor.Results()
+	if recompressOpts.verbose {
+		for _, res := range results {
+			fmt.Printf("%-12s pages %v  %4dx%-4d %-9s %-11s -> %-11s %9d -> %9d bytes",
+				res.Name, res.Pages, res.Stats.Width, res.Stats.Height, res.Class,
+				res.FilterBefore, res.FilterAfter, res.Before, res.After)
+			if res.Note != "" {
+				fmt.Printf("  (%s)", res.Note)
+			}
+			fmt.Println()
+		}
+	}
+
+	replaced := 0
+	for _, res := range results {
+		if res.Format != recompress.FormatKeep {
+			replaced++
+		}
+	}
+	before, after := recompress.Totals(results)
+	fmt.Printf("Recompressed %d of %d image(s): %d -> %d bytes of image data\n",
+		replaced, len(results), before, after)
+	if summary, err := sizeChange(args[0], recompressOpts.output); err == nil {
+		fmt.Printf("File size: %s\n", summary)
+	}
+
+	if recompressOpts.report != "" {
+		data, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(recompressOpts.report, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+/*
+ * pdftool redact: Removes content under rectangular regions or matching regular expressions from a
+ * PDF file. The glyphs, image pixels and vector paths under the redacted areas are removed from the
+ * content streams, not just covered, and the result is verified by re-extracting the text.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/security/redact"
+)
+
+var redactCmd = &command{
+	name:  "redact",
+	args:  "input.pdf",
+	short: "Remove content under regions or matching terms from a PDF.",
+	long: `
+Regions are given as "llx,lly,urx,ury" in points, optionally prefixed with a page number as in
+"2:llx,lly,urx,ury". Regions without a page apply to all pages. Terms are regular expressions
+(RE2 syntax) matched against the page text. Both options can be repeated.
+
+Text matching the terms is also removed from annotations and the document information. Form fields
+are flattened, XMP metadata, bookmarks and page thumbnails are not carried over to the output.
+
+After writing, the text of the output is extracted again and the command fails if any text matching
+the terms or inside the regions remains.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&redactOpts.output, "o", "", "Output PDF path (required)")
+		fs.StringVar(&redactOpts.password, "password", "", "Password for an encrypted input file")
+		fs.Var(&redactOpts.regions, "region", "Region to redact, [page:]llx,lly,urx,ury (repeatable)")
+		fs.Var(&redactOpts.terms, "term", "Regular expression of text to redact (repeatable)")
+		fs.BoolVar(&redactOpts.ignoreCase, "i", false, "Match terms case-insensitively")
+		fs.StringVar(&redactOpts.fill, "fill", "#000000", "Color of the overlay boxes and redacted image pixels")
+		fs.StringVar(&redactOpts.label, "label", "", "Text drawn into the overlay boxes, e.g. REDACTED")
+		fs.StringVar(&redactOpts.labelColor, "label-color", "#ffffff", "Color of the label")
+		fs.BoolVar(&redactOpts.noOverlay, "no-overlay", false, "Do not draw overlay boxes")
+		fs.BoolVar(&redactOpts.noVerify, "no-verify", false, "Skip the verification of the output")
+		fs.StringVar(&redactOpts.report, "report", "", "Write a JSON report of the redactions to this path")
+	},
+	run: runRedact,
+}
+
+var redactOpts struct {
+	output     string
+	password   string
+	regions    stringList
+	terms      stringList
+	ignoreCase bool
+	fill       string
+	label      string
+	labelColor string
+	noOverlay  bool
+	noVerify   bool
+	report     string
+}
+
+// redactReport is the JSON report written with -report.
+type redactReport struct {
+	Pages      []*redact.PageReport `json:"pages"`
+	InfoFields int                  `json:"info_fields"`
+	Leaks      []redact.Leak        `json:"leaks"`
+}
+
+func runRedact(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(redactOpts.output); err != nil {
+		return err
+	}
+
+	opts := redact.Options{
+		Label:     redactOpts.label,
+		NoOverlay: redactOpts.noOverlay,
+	}
+	for _, s := range redactOpts.regions {
+		region, err := parseRegion(s)
+		if err != nil {
+			return err
+		}
+		opts.Regions = append(opts.Regions, region)
+	}
+	for _, term := range redactOpts.terms {
+		if redactOpts.ignoreCase {
+			term = "(?i)" + term
+		}
+		re, err := regexp.Compile(term)
+		if err != nil {
+			return usageErrorf("invalid term %q: %v", term, err)
+		}
+		opts.Terms = append(opts.Terms, re)
+	}
+	if len(opts.Regions) == 0 && len(opts.Terms) == 0 {
+		return usageErrorf("nothing to redact: specify -region or -term")
+	}
+	if opts.FillColor, err = parseColor(redactOpts.fill); err != nil {
+		return err
+	}
+	if opts.LabelColor, err = parseColor(redactOpts.labelColor); err != nil {
+		return err
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], redactOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Form field values become page content, so they are redacted like any other text.
+	if pdfReader.AcroForm != nil {
+		if err := pdfReader.FlattenFields(false, nil); err != nil {
+			return err
+		}
+	}
+
+	redactor := redact.New(opts)
+	report := redactReport{}
+
+	pdfWriter := model.NewPdfWriter()
+	info, err := pdfReader.GetPdfInfo()
+	if err == nil {
+		report.InfoFields = redactor.ScrubInfo(info)
+		pdfWriter.SetDocInfo(info)
+	}
+
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return err
+	}
+	numAreas := 0
+	for pageNum := 1; pageNum <= numPages; pageNum++ {
+		page, err := pdfReader.GetPage(pageNum)
+		if err != nil {
+			return err
+		}
+
+		pageReport, err := redactor.RedactPage(page, pageNum)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", pageNum, err)
+		}
+		report.Pages = append(report.Pages, pageReport)
+		numAreas += len(pageReport.Areas)
+
+		if err := pdfWriter.AddPage(page); err != nil {
+			return err
+		}
+	}
+
+	if err := pdfWriter.WriteToFile(redactOpts.output); err != nil {
+		return err
+	}
+	fmt.Printf("Redacted %d area(s) on %d page(s)\n", numAreas, numPages)
+
+	if !redactOpts.noVerify {
+		report.Leaks, err = verifyRedaction(redactor, redactOpts.output)
+		if err != nil {
+			return err
+		}
+	}
+
+	if redactOpts.report != "" {
+		data, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(redactOpts.report, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Leaks) > 0 {
+		for _, leak := range report.Leaks {
+			what := fmt.Sprintf("%q", leak.Text)
+			if leak.XObject != "" {
+				what = fmt.Sprintf("%s /%s", leak.Text, leak.XObject)
+			}
+			fmt.Printf("Page %d: %s remains at %.2f,%.2f,%.2f,%.2f\n",
+				leak.Page, what, leak.BBox[0], leak.BBox[1], leak.BBox[2], leak.BBox[3])
+		}
+		return fmt.Errorf("verification failed: %d redacted item(s) still present in %s",
+			len(report.Leaks), redactOpts.output)
+	}
+	return nil
+}
+
+// verifyRedaction extracts the text and checks the images and forms of the redacted file
+// `outputPath` and returns what remains of the redacted content.
+func verifyRedaction(redactor *redact.Redactor, outputPath string) ([]redact.Leak, error) {
+	pdfReader, f, err := openReader(outputPath, "")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return redactor.VerifyPages(pdfReader.PageList)
+}
+
+// parseRegion parses a region given as "[page:]llx,lly,urx,ury".
+func parseRegion(s string) (redact.Region, error) {
+	var region redact.Region
+	if idx := strings.Index(s, ":"); idx >= 0 {
+		page, err := strconv.Atoi(strings.TrimSpace(s[:idx]))
+		if err != nil || page < 1 {
+			return region, usageErrorf("invalid page in region %q", s)
+		}
+		region.Page = page
+		s = s[idx+1:]
+	}
+
+	rect, err := parseRect(s)
+	if err != nil {
+		return region, err
+	}
+	if rect == nil {
+		return region, usageErrorf("empty region")
+	}
+	region.Rect = model.PdfRectangle{Llx: rect[0], Lly: rect[1], Urx: rect[2], Ury: rect[3]}
+	return region, nil
+}
+
+// parseColor parses a color given as "#rrggbb" into RGB components in the range 0..1.
+func parseColor(s string) ([3]float64, error) {
+	var c [3]float64
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 {
+		return c, usageErrorf("invalid color %q: expected #rrggbb", s)
+	}
+	for i := range c {
+		v, err := strconv.ParseUint(hex[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return c, usageErrorf("invalid color %q: expected #rrggbb", s)
+		}
+		c[i] = float64(v) / 255
+	}
+	return c, nil
+}
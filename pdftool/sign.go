@@ -0,0 +1,420 @@
+/*
+ * pdftool sign: Digitally signs a PDF file with the private key and certificate of a PKCS#12
+ * (.p12/.pfx) file or of a remote signing service (signatures/remote). The signature is added
+ * via an incremental update so existing content and signatures are preserved. Certification
+ * (DocMDP) and field locking (FieldMDP) use signatures/certify, PAdES baseline signatures
+ * signatures/pades, and the fields placed by pdftool prepare-sign are signed in place with
+ * signatures/multisign. Appearance templates are rendered by signatures/appearance.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+	"github.com/unidoc/unipdf/v3/model/sighandler"
+
+	"github.com/unidoc/unidoc-examples/signatures/appearance"
+	"github.com/unidoc/unidoc-examples/signatures/certify"
+	"github.com/unidoc/unidoc-examples/signatures/multisign"
+	"github.com/unidoc/unidoc-examples/signatures/pades"
+	"github.com/unidoc/unidoc-examples/signatures/remote"
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+var signCmd = &command{
+	name:  "sign",
+	args:  "input.pdf",
+	short: "Digitally sign a PDF with a PKCS#12 certificate or a remote signing service.",
+	long: `
+The signing key and certificate are read from the -p12 file, or held by the signing service at
+the -remote URL, which only receives the digests to sign, as key -remote-key. The bearer token of
+the service, if any, is read from the PDFTOOL_REMOTE_TOKEN environment variable.
+
+The signature appearance is placed on -page within -rect, given as "llx,lly,urx,ury" in points.
+Use an empty -rect for an invisible signature. If the document has an unsigned signature field
+named -field, e.g. placed by pdftool prepare-sign, that field is signed in place and -page and
+-rect are ignored. With -in-order the signature fields before it must be signed already.
+
+-appearance designs the appearance with a YAML or JSON template (signatures/appearance): its text
+lines with placeholders such as {{signer.CN}} and {{date}}, font, colors, border, background and
+handwritten signature images. The rectangle of the template, if it sets one, replaces -rect.
+
+With -certify the signature is a certification signature, which must be the first signature of
+the document, permitting 1 (no-changes) no changes, 2 (form-filling) form filling and signing, or
+3 (annotations) also annotations afterwards. -lock and -lock-all lock form fields once the
+signature field is signed.
+
+With -level the signature is a PAdES baseline signature (ETSI.CAdES.detached):
+  B-B    signature only
+  B-T    with a signature timestamp of the -tsa timestamp authority
+  B-LT   followed by a revision adding the certificates, OCSP responses and CRLs of the
+         signature and its timestamp to the DSS
+  B-LTA  followed by a revision with a document timestamp
+-ocsp-url and -crl-url replace the OCSP responders and CRL distribution points named in the
+certificates.
+
+-chain adds issuer certificates to the signature (and to the validation data of B-LT and B-LTA).
+
+RSA and ECDSA (P-256, P-384, P-521) keys are supported. -pss signs with RSASSA-PSS instead of
+RSA PKCS #1 v1.5 and -hash selects the digest algorithm (SHA-256 by default).
+
+Signing is refused if the signatures of the input don't permit the update, e.g. a document
+certified with no changes allowed, or a signature field that is locked.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&signOpts.output, "o", "", "Output PDF path (required)")
+		fs.StringVar(&signOpts.password, "password", "", "Password for an encrypted input file")
+		fs.StringVar(&signOpts.p12Path, "p12", "", "PKCS#12 file with the signing key and certificate (required)")
+		fs.StringVar(&signOpts.p12Password, "p12-password", "", "Password of the PKCS#12 file")
+		fs.StringVar(&signOpts.remote, "remote", "", "Base URL of a remote signing service (instead of -p12)")
+		fs.StringVar(&signOpts.remoteKey, "remote-key", "", "Key ID at the remote signing service")
+		fs.StringVar(&signOpts.field, "field", "Signature", "Name of the signature field")
+		fs.StringVar(&signOpts.name, "name", "", "Signer name (default: certificate common name)")
+		fs.StringVar(&signOpts.reason, "reason", "", "Reason for signing")
+		fs.StringVar(&signOpts.location, "location", "", "Location of signing")
+		fs.IntVar(&signOpts.page, "page", 1, "Page to place the signature on")
+		fs.StringVar(&signOpts.rect, "rect", "10,25,210,85", "Signature appearance rectangle (llx,lly,urx,ury)")
+		fs.StringVar(&signOpts.appearance, "appearance", "", "YAML or JSON signature appearance template")
+		fs.BoolVar(&signOpts.inOrder, "in-order", false, "Require the signature fields before -field to be signed")
+		fs.StringVar(&signOpts.certify, "certify", "", "Certify with DocMDP permission 1, 2 or 3 (or no-changes, form-filling, annotations)")
+		fs.Var(&signOpts.lock, "lock", "Lock this form field once signed (repeatable)")
+		fs.BoolVar(&signOpts.lockAll, "lock-all", false, "Lock all form fields once signed")
+		fs.StringVar(&signOpts.level, "level", "", "PAdES baseline level: B-B, B-T, B-LT or B-LTA")
+		fs.StringVar(&signOpts.tsa, "tsa", "", "URL of the RFC 3161 timestamp authority (required from B-T)")
+		fs.StringVar(&signOpts.ocspURL, "ocsp-url", "", "Send OCSP requests to this URL instead of the responders of the certificates")
+		fs.StringVar(&signOpts.crlURL, "crl-url", "", "Fetch CRLs from this URL instead of the distribution points of the certificates")
+		fs.Var(&signOpts.chain, "chain", "PEM or DER file, or directory, of issuer certificates (repeatable)")
+		fs.StringVar(&signOpts.hash, "hash", "", "Digest algorithm: SHA-256, SHA-384 or SHA-512 (default SHA-256)")
+		fs.BoolVar(&signOpts.pss, "pss", false, "Sign with RSASSA-PSS (RSA keys)")
+	},
+	run: runSign,
+}
+
+var signOpts struct {
+	output      string
+	password    string
+	p12Path     string
+	p12Password string
+	remote      string
+	remoteKey   string
+	field       string
+	name        string
+	reason      string
+	location    string
+	page        int
+	rect        string
+	appearance  string
+	inOrder     bool
+	certify     string
+	lock        stringList
+	lockAll     bool
+	level       string
+	tsa         string
+	ocspURL     string
+	crlURL      string
+	chain       stringList
+	hash        string
+	pss         bool
+}
+
+func runSign(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(signOpts.output); err != nil {
+		return err
+	}
+	switch {
+	case signOpts.p12Path == "" && signOpts.remote == "":
+		return usageErrorf("PKCS#12 file (-p12) or remote signing service (-remote) is required")
+	case signOpts.p12Path != "" && signOpts.remote != "":
+		return usageErrorf("-p12 and -remote are mutually exclusive")
+	case signOpts.remote != "" && signOpts.remoteKey == "":
+		return usageErrorf("-remote requires a key ID (-remote-key)")
+	}
+	rect, err := parseRect(signOpts.rect)
+	if err != nil {
+		return err
+	}
+	var template *appearance.Template
+	if signOpts.appearance != "" {
+		if template, err = appearance.Load(signOpts.appearance); err != nil {
+			return err
+		}
+	}
+	var permission certify.Permission
+	if signOpts.certify != "" {
+		if permission, err = certify.ParsePermission(signOpts.certify); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+	if signOpts.lockAll && len(signOpts.lock) > 0 {
+		return usageErrorf("-lock and -lock-all are mutually exclusive")
+	}
+	var padesOpts pades.Options
+	if signOpts.hash != "" {
+		if padesOpts.Hash, err = pades.ParseHash(signOpts.hash); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+	padesOpts.PSS = signOpts.pss
+	if signOpts.level != "" {
+		if padesOpts.Level, err = pades.ParseLevel(signOpts.level); err != nil {
+			return usageErrorf("%v", err)
+		}
+		if padesOpts.Level >= pades.BT && signOpts.tsa == "" {
+			return usageErrorf("level %s requires a timestamp authority (-tsa)", padesOpts.Level)
+		}
+		padesOpts.TSAURL = signOpts.tsa
+		padesOpts.OCSPURL = signOpts.ocspURL
+		padesOpts.CRLURL = signOpts.crlURL
+	} else if signOpts.tsa != "" || signOpts.ocspURL != "" || signOpts.crlURL != "" {
+		return usageErrorf("-tsa, -ocsp-url and -crl-url require -level")
+	}
+	var chain []*x509.Certificate
+	if len(signOpts.chain) > 0 {
+		if chain, err = verify.LoadCertificates(signOpts.chain...); err != nil {
+			return err
+		}
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	key, cert, issuers, err := loadSigner()
+	if err != nil {
+		return err
+	}
+	chain = append(issuers, chain...)
+
+	original, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	input := original
+	if permission != 0 {
+		// Certification needs a Perms dictionary in the catalog of the input.
+		if input, err = certify.Prepare(original); err != nil {
+			return err
+		}
+	}
+	pdfReader, err := model.NewPdfReader(bytes.NewReader(input))
+	if err != nil {
+		return err
+	}
+	if err := decryptReader(pdfReader, args[0], signOpts.password); err != nil {
+		return err
+	}
+
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return err
+	}
+	if signOpts.page < 1 || signOpts.page > numPages {
+		return usageErrorf("page %d out of bounds (document has %d pages)", signOpts.page, numPages)
+	}
+
+	appender, err := model.NewPdfAppender(pdfReader)
+	if err != nil {
+		return err
+	}
+	existing, _, err := multisign.Find(appender.Reader, signOpts.field)
+	if err != nil {
+		return err
+	}
+	if existing != nil && signOpts.inOrder {
+		if err := multisign.CheckOrder(appender.Reader, signOpts.field); err != nil {
+			return err
+		}
+	}
+
+	// The handler of unipdf is used for the RSA PKCS #1 v1.5 signatures it supports.
+	var handler model.SignatureHandler
+	rsaKey, isRSA := key.(*rsa.PrivateKey)
+	switch {
+	case padesOpts.Level != 0:
+		handler, err = pades.NewHandler(key, cert, chain, padesOpts)
+	case isRSA && !padesOpts.PSS && signOpts.hash == "" && len(chain) == 0:
+		handler, err = sighandler.NewAdobePKCS7Detached(rsaKey, cert)
+	default:
+		handler, err = pades.NewPKCS7Detached(key, cert, chain, padesOpts)
+	}
+	if err != nil {
+		return err
+	}
+
+	signerName := signOpts.name
+	if signerName == "" {
+		signerName = cert.Subject.CommonName
+	}
+	now := time.Now()
+
+	signature := model.NewPdfSignature(handler)
+	signature.SetName(signerName)
+	signature.SetDate(now, "")
+	if signOpts.reason != "" {
+		signature.SetReason(signOpts.reason)
+	}
+	if signOpts.location != "" {
+		signature.SetLocation(signOpts.location)
+	}
+	if err := signature.Initialize(); err != nil {
+		return err
+	}
+	if permission != 0 {
+		if err := certify.Certify(appender, signature, permission); err != nil {
+			return err
+		}
+	}
+
+	lines := []*annotator.SignatureLine{
+		annotator.NewSignatureLine("Signed by", signerName),
+		annotator.NewSignatureLine("Date", now.Format("2006.01.02 15:04:05 -07:00")),
+	}
+	if signOpts.reason != "" {
+		lines = append(lines, annotator.NewSignatureLine("Reason", signOpts.reason))
+	}
+	if signOpts.location != "" {
+		lines = append(lines, annotator.NewSignatureLine("Location", signOpts.location))
+	}
+
+	opts := annotator.NewSignatureFieldOpts()
+	opts.FontSize = 8
+	opts.Rect = rect
+	if template != nil {
+		lines, opts, err = template.Render(appearance.Values{
+			Signer:   cert,
+			Time:     now,
+			Name:     signerName,
+			Reason:   signOpts.reason,
+			Location: signOpts.location,
+			Field:    signOpts.field,
+		})
+		if err != nil {
+			return err
+		}
+		if opts.Rect == nil {
+			opts.Rect = rect
+		}
+	}
+	if opts.Rect == nil && existing == nil {
+		opts.Rect = []float64{0, 0, 0, 0}
+		lines = nil
+	}
+
+	var field *model.PdfFieldSignature
+	if existing != nil {
+		field, err = multisign.SignField(appender, signOpts.field, signature, lines, opts)
+	} else {
+		field, err = annotator.NewSignatureField(signature, lines, opts)
+	}
+	if err != nil {
+		return err
+	}
+	field.T = core.MakeString(signOpts.field)
+	switch {
+	case signOpts.lockAll:
+		err = certify.LockFields(field, verify.FieldLock{Action: "All"})
+	case len(signOpts.lock) > 0:
+		err = certify.LockFields(field, verify.FieldLock{Action: "Include", Fields: signOpts.lock})
+	}
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		if err = appender.Sign(signOpts.page, field); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := appender.Write(&buf); err != nil {
+		return err
+	}
+	if err := certify.Check(original, buf.Bytes(), signOpts.password); err != nil {
+		return err
+	}
+	output := buf.Bytes()
+	if padesOpts.Level != 0 {
+		// The validation data and document timestamp revisions of B-LT and B-LTA.
+		if output, err = pades.Extend(output, chain, padesOpts); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(signOpts.output, output, 0644)
+}
+
+// loadSigner returns the signing key, its certificate and the issuer certificates given by the
+// service of -remote, or the key and certificate of the -p12 file.
+func loadSigner() (crypto.Signer, *x509.Certificate, []*x509.Certificate, error) {
+	if signOpts.remote != "" {
+		signer, err := remote.NewSigner(remote.Config{
+			URL:   signOpts.remote,
+			KeyID: signOpts.remoteKey,
+			Token: os.Getenv(`PDFTOOL_REMOTE_TOKEN`),
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return signer, signer.Certificate(), signer.Chain()[1:], nil
+	}
+
+	// Get private key and X509 certificate from the P12 file.
+	pfxData, err := ioutil.ReadFile(signOpts.p12Path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	priv, cert, err := pkcs12.Decode(pfxData, signOpts.p12Password)
+	if err != nil {
+		if err == pkcs12.ErrIncorrectPassword {
+			return nil, nil, nil, fmt.Errorf("%s: %w", signOpts.p12Path, errBadPassword)
+		}
+		return nil, nil, nil, err
+	}
+	key, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+	return key, cert, nil, nil
+}
+
+// parseRect parses a rectangle given as "llx,lly,urx,ury". An empty string returns nil.
+func parseRect(s string) ([]float64, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, usageErrorf("invalid rectangle %q: expected llx,lly,urx,ury", s)
+	}
+
+	rect := make([]float64, 4)
+	for i, part := range parts {
+		val, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, usageErrorf("invalid rectangle %q: %v", s, errors.Unwrap(err))
+		}
+		rect[i] = val
+	}
+	return rect, nil
+}
@@ -0,0 +1,100 @@
+/*
+ * pdftool sign-status: Lists the signature fields of a PDF file, signed or not, with their signers,
+ * using signatures/multisign.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/unidoc/unidoc-examples/signatures/multisign"
+)
+
+var signStatusCmd = &command{
+	name:  "sign-status",
+	args:  "input.pdf",
+	short: "List the signed and unsigned signature fields and their signers.",
+	long: `
+Each signature field is listed in form order with its page, the signer it is meant for and, once
+signed, the name of the signer, the signing time and the reason. -json prints the list as JSON.
+The signatures are not validated, see pdftool verify.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&signStatusOpts.password, "password", "", "Password for an encrypted input file")
+		fs.BoolVar(&signStatusOpts.json, "json", false, "Print the fields as JSON")
+	},
+	run: runSignStatus,
+}
+
+var signStatusOpts struct {
+	password string
+	json     bool
+}
+
+func runSignStatus(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], signStatusOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	statuses := multisign.Status(pdfReader)
+	if signStatusOpts.json {
+		if statuses == nil {
+			statuses = []*multisign.FieldStatus{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(statuses)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Printf("%s has no signature fields\n", args[0])
+		return nil
+	}
+	signed := 0
+	for _, s := range statuses {
+		var parts []string
+		if s.Page > 0 {
+			parts = append(parts, fmt.Sprintf("page %d", s.Page))
+		}
+		if s.Signer != "" {
+			parts = append(parts, "for "+s.Signer)
+		}
+		state := "unsigned"
+		if s.Signed {
+			signed++
+			state = "signed"
+		}
+		if len(parts) > 0 {
+			state += " (" + strings.Join(parts, ", ") + ")"
+		}
+		fmt.Printf("%s: %s\n", s.Name, state)
+		if !s.Signed {
+			continue
+		}
+		if s.SignedBy != "" {
+			fmt.Printf("  Signed by: %s\n", s.SignedBy)
+		}
+		if s.SigningTime != nil {
+			fmt.Printf("  Time: %s\n", s.SigningTime.Format("2006-01-02 15:04:05 -07:00"))
+		}
+		if s.Reason != "" {
+			fmt.Printf("  Reason: %s\n", s.Reason)
+		}
+	}
+	fmt.Printf("%d of %d signature fields signed\n", signed, len(statuses))
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+ * pdftool unlock: Decrypts a PDF file and writes it out without encryption.
+ */
+
+package main
+
+import (
+	"flag"
+)
+
+var unlockCmd = &command{
+	name:  "unlock",
+	args:  "input.pdf",
+	short: "Remove the encryption from a PDF.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&unlockOpts.output, "o", "", "Output PDF path (required)")
+		fs.StringVar(&unlockOpts.password, "password", "", "User or owner password of the input file")
+	},
+	run: runUnlock,
+}
+
+var unlockOpts struct {
+	output   string
+	password string
+}
+
+func runUnlock(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := requireOutput(unlockOpts.output); err != nil {
+		return err
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], unlockOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The writer generated from a decrypted reader does not carry over the encryption.
+	pdfWriter, err := pdfReader.ToWriter(nil)
+	if err != nil {
+		return err
+	}
+
+	return pdfWriter.WriteToFile(unlockOpts.output)
+}
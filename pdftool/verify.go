@@ -0,0 +1,159 @@
+/*
+ * pdftool verify: Validates the signatures of a PDF file (chains, offline revocation and changes
+ * made after signing) and writes a JSON report, using signatures/verify.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+var verifyCmd = &command{
+	name:  "verify",
+	args:  "input.pdf",
+	short: "Validate the signatures and report changes made after signing.",
+	long: `
+Each signature is checked for the integrity of the signed data, the signature value and the
+signature timestamp. The signer's chain is built from the certificates of the signature and the
+DSS up to a trust anchor of -trust (PEM or DER files, or directories of them) or of the system
+with -system-roots, at the time of the signature timestamp if its authority chains to the same
+trust anchors, or else now. With -trust-signing-time, signatures without trusted timestamp are
+validated at the signing time claimed by the signer instead, which isn't authenticated and is
+reported as a warning.
+Revocation is checked offline against the CRLs and OCSP responses embedded in the DSS and the
+signatures. Data issued more than a day after the validation time, or expired before it, leaves
+the status unknown unless it shows the certificate revoked.
+
+Every object changed by a later incremental update is classified (validation data, metadata,
+signature, form filling, annotation, page content, other) and judged against the DocMDP
+permission of the certification signature and the FieldMDP locks.
+
+A signature is valid, invalid (modified, bad signature, revoked or disallowed changes) or
+indeterminate (no trusted chain, or unknown revocation status with -require-revocation).
+The exit code is 1 unless all signatures are valid.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&verifyOpts.password, "password", "", "Password for an encrypted input file")
+		fs.Var(&verifyOpts.trust, "trust", "Trusted root certificate file or directory (repeatable)")
+		fs.BoolVar(&verifyOpts.systemRoots, "system-roots", false, "Also trust the system root certificates")
+		fs.BoolVar(&verifyOpts.requireRevocation, "require-revocation", false, "Treat unknown revocation status as indeterminate")
+		fs.StringVar(&verifyOpts.time, "time", "", "Validate the certificates at this RFC 3339 time instead of the timestamp time or now")
+		fs.BoolVar(&verifyOpts.trustSigningTime, "trust-signing-time", false,
+			"Validate signatures without timestamp at the unauthenticated signing time claimed by the signer")
+		fs.StringVar(&verifyOpts.report, "report", "", "Write the JSON report to this path")
+	},
+	run: runVerify,
+}
+
+var verifyOpts struct {
+	password          string
+	trust             stringList
+	systemRoots       bool
+	requireRevocation bool
+	time              string
+	trustSigningTime  bool
+	report            string
+}
+
+func runVerify(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	opts := verify.Options{
+		SystemRoots:       verifyOpts.systemRoots,
+		RequireRevocation: verifyOpts.requireRevocation,
+		TrustSigningTime:  verifyOpts.trustSigningTime,
+		Password:          verifyOpts.password,
+	}
+	if verifyOpts.time != "" {
+		if opts.Time, err = time.Parse(time.RFC3339, verifyOpts.time); err != nil {
+			return usageErrorf("invalid -time %q: %v", verifyOpts.time, err)
+		}
+	}
+	if len(verifyOpts.trust) > 0 {
+		if opts.Roots, err = verify.LoadCertificates(verifyOpts.trust...); err != nil {
+			return err
+		}
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	// Check the password first for the exit code.
+	_, f, err := openReader(args[0], verifyOpts.password)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	report, err := verify.VerifyFile(args[0], opts)
+	if err != nil {
+		return err
+	}
+	printVerifyReport(report)
+
+	if verifyOpts.report != "" {
+		if report.Signatures == nil {
+			report.Signatures = []*verify.SignatureReport{}
+		}
+		data, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(verifyOpts.report, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Signatures) == 0 {
+		return fmt.Errorf("%s has no signatures", args[0])
+	}
+	if !report.Valid {
+		return fmt.Errorf("not all signatures are valid")
+	}
+	return nil
+}
+
+// printVerifyReport prints a summary of `report`.
+func printVerifyReport(report *verify.Report) {
+	for _, sr := range report.Signatures {
+		fmt.Printf("%s: %s (%s, %s, revision %d of %d)\n", sr.Field, sr.Status, sr.Type, sr.SubFilter,
+			sr.Revision, report.Revisions)
+		if sr.Signer != nil {
+			fmt.Printf("  Signer: %s\n", sr.Signer.Subject)
+		}
+		if sr.SigningTime != nil {
+			fmt.Printf("  Signing time: %s\n", sr.SigningTime.Format(time.RFC3339))
+		}
+		if sr.Timestamp != nil {
+			fmt.Printf("  Timestamp: %s (valid: %t)\n", sr.Timestamp.Time.Format(time.RFC3339), sr.Timestamp.Valid)
+		}
+		if sr.DocMDP != 0 {
+			fmt.Printf("  Certification: DocMDP P=%d\n", sr.DocMDP)
+		}
+		for _, r := range sr.Revocation {
+			fmt.Printf("  Revocation: %s %s %s\n", r.Subject, r.Status, r.Source)
+		}
+		for _, c := range sr.Changes {
+			allowed := "allowed"
+			if !c.Allowed {
+				allowed = "not allowed: " + c.Reason
+			}
+			fmt.Printf("  Changed object %d: %s, %s\n", c.Object, c.Kind, allowed)
+		}
+		for _, e := range sr.Errors {
+			fmt.Printf("  Error: %s\n", e)
+		}
+		for _, w := range sr.Warnings {
+			fmt.Printf("  Warning: %s\n", w)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * pdftool verify-timestamps: Validates the RFC 3161 timestamps of a PDF file (document and
+ * signature timestamps) against local trust anchors and writes a JSON audit report, using
+ * signatures/verify.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+var verifyTimestampsCmd = &command{
+	name:  "verify-timestamps",
+	args:  "input.pdf",
+	short: "Validate the RFC 3161 timestamps against local trust anchors.",
+	long: `
+Each document timestamp and signature timestamp is checked for:
+  token            the token parses as a timestamp token
+  message-imprint  the imprint is the digest of the timestamped data
+  signature        the signature of the timestamp authority (TSA) verifies
+  ess-cert-id      the ESS signing certificate attribute identifies the TSA certificate
+  tsa-certificate  the TSA certificate has the critical time stamping extended key usage only
+  tsa-chain        the TSA certificate chains to a -trust anchor at genTime
+  gen-time         genTime is not before the signing time claimed by the signature, allowing
+                   the accuracy of the token and -tolerance, nor later than -max-delay after it
+  nonce            the nonce is -nonce (hex), if given
+  policy           the TSA policy is one of -policy, if given
+
+A timestamp is valid if no check fails, indeterminate if only the chain can't be built (or no
+-trust is given) and invalid otherwise. The exit code is 1 unless all timestamps are valid.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&verifyTimestampsOpts.password, "password", "", "Password for an encrypted input file")
+		fs.Var(&verifyTimestampsOpts.trust, "trust", "Trusted root certificate file or directory of the TSAs (repeatable)")
+		fs.BoolVar(&verifyTimestampsOpts.systemRoots, "system-roots", false, "Also trust the system root certificates")
+		fs.Var(&verifyTimestampsOpts.policies, "policy", "Accepted TSA policy OID (repeatable)")
+		fs.StringVar(&verifyTimestampsOpts.nonce, "nonce", "", "Expected nonce of the timestamp request in hex")
+		fs.DurationVar(&verifyTimestampsOpts.tolerance, "tolerance", 0, "Allowed clock difference between signer and TSA, e.g. 2m")
+		fs.DurationVar(&verifyTimestampsOpts.maxDelay, "max-delay", 0, "Longest accepted time from signing to genTime, e.g. 24h")
+		fs.StringVar(&verifyTimestampsOpts.report, "report", "", "Write the JSON report to this path")
+	},
+	run: runVerifyTimestamps,
+}
+
+var verifyTimestampsOpts struct {
+	password    string
+	trust       stringList
+	systemRoots bool
+	policies    stringList
+	nonce       string
+	tolerance   time.Duration
+	maxDelay    time.Duration
+	report      string
+}
+
+func runVerifyTimestamps(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	opts := verify.TimestampOptions{
+		SystemRoots: verifyTimestampsOpts.systemRoots,
+		Policies:    verifyTimestampsOpts.policies,
+		Tolerance:   verifyTimestampsOpts.tolerance,
+		MaxDelay:    verifyTimestampsOpts.maxDelay,
+		Password:    verifyTimestampsOpts.password,
+	}
+	if verifyTimestampsOpts.nonce != "" {
+		nonce, ok := new(big.Int).SetString(verifyTimestampsOpts.nonce, 16)
+		if !ok {
+			return usageErrorf("invalid -nonce %q: must be hexadecimal", verifyTimestampsOpts.nonce)
+		}
+		opts.Nonce = nonce
+	}
+	if len(verifyTimestampsOpts.trust) > 0 {
+		if opts.Roots, err = verify.LoadCertificates(verifyTimestampsOpts.trust...); err != nil {
+			return err
+		}
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	// Check the password first for the exit code.
+	_, f, err := openReader(args[0], verifyTimestampsOpts.password)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	validations, err := verify.ValidateTimestamps(data, opts)
+	if err != nil {
+		return err
+	}
+	valid := len(validations) > 0
+	for _, tv := range validations {
+		fmt.Printf("%s: %s %s timestamp, genTime %s\n", tv.Field, tv.Status, tv.Kind,
+			tv.GenTime.Format(time.RFC3339))
+		if tv.Signer != nil {
+			fmt.Printf("  TSA: %s\n", tv.Signer.Subject)
+		}
+		for _, c := range tv.Checks {
+			fmt.Printf("  %-16s %-7s %s\n", c.Name, c.Result, c.Detail)
+		}
+		if tv.Status != verify.Valid {
+			valid = false
+		}
+	}
+
+	if verifyTimestampsOpts.report != "" {
+		if validations == nil {
+			validations = []*verify.TimestampValidation{}
+		}
+		data, err := json.MarshalIndent(validations, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(verifyTimestampsOpts.report, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if len(validations) == 0 {
+		return fmt.Errorf("%s has no timestamps", args[0])
+	}
+	if !valid {
+		return fmt.Errorf("not all timestamps are valid")
+	}
+	return nil
+}
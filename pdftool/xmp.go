@@ -0,0 +1,244 @@
+/*
+ * pdftool xmp: Prints or edits the XMP metadata of a PDF file, keeping the document information
+ * dictionary in sync, using metadata/xmp.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/metadata/xmp"
+)
+
+var xmpCmd = &command{
+	name:  "xmp",
+	args:  "input.pdf",
+	short: "Print or edit the XMP metadata.",
+	long: `
+Without edits the metadata is printed, nested values indented below their property, or as XML with
+-xml. Properties are named prefix:name, e.g. dc:title. Custom namespaces are declared with
+-ns prefix=uri or by the extension schemas of -schema, a JSON array of
+{"namespace", "prefix", "description", "properties": [{"name", "value_type", "category",
+"description"}]} objects, which are written as PDF/A extension schemas.
+
+-set sets a text value; the array properties of the Dublin Core schema (e.g. dc:creator,
+dc:subject) get it as their only item, language alternatives (e.g. dc:title) as default item.
+-bag and -seq set arrays of the ";" separated items, -alt sets the item of a language alternative
+for the language appended with @, e.g. -alt dc:title@de=Titel.
+
+Edits keep the document information dictionary in sync: entries missing in the metadata are
+copied to it first and the dictionary is rewritten from the edited metadata, so removing dc:title
+also removes Title. The modification dates are set to now.`,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&xmpOpts.output, "o", "", "Output PDF path (required for edits)")
+		fs.StringVar(&xmpOpts.password, "password", "", "Password for an encrypted input file")
+		fs.BoolVar(&xmpOpts.xml, "xml", false, "Print the metadata as XML")
+		fs.Var(&xmpOpts.namespaces, "ns", "Declare a namespace, prefix=uri (repeatable)")
+		fs.StringVar(&xmpOpts.schema, "schema", "", "JSON file with extension schemas to add")
+		fs.Var(&xmpOpts.set, "set", "Set a property, prefix:name=value (repeatable)")
+		fs.Var(&xmpOpts.bag, "bag", "Set an unordered array, prefix:name=item;item (repeatable)")
+		fs.Var(&xmpOpts.seq, "seq", "Set an ordered array, prefix:name=item;item (repeatable)")
+		fs.Var(&xmpOpts.alt, "alt", "Set a language alternative, prefix:name@lang=value (repeatable)")
+		fs.Var(&xmpOpts.remove, "remove", "Remove a property, prefix:name (repeatable)")
+	},
+	run: runXmp,
+}
+
+var xmpOpts struct {
+	output     string
+	password   string
+	xml        bool
+	namespaces stringList
+	schema     string
+	set        stringList
+	bag        stringList
+	seq        stringList
+	alt        stringList
+	remove     stringList
+}
+
+func runXmp(cmd *command, args []string) error {
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	edit := len(xmpOpts.namespaces)+len(xmpOpts.set)+len(xmpOpts.bag)+len(xmpOpts.seq)+
+		len(xmpOpts.alt)+len(xmpOpts.remove) > 0 || xmpOpts.schema != ""
+	if edit {
+		if err := requireOutput(xmpOpts.output); err != nil {
+			return err
+		}
+	}
+
+	if err := loadLicense(); err != nil {
+		return err
+	}
+
+	pdfReader, f, err := openReader(args[0], xmpOpts.password)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	packet, err := xmp.Read(pdfReader)
+	if err != nil {
+		return err
+	}
+	if !edit {
+		if packet == nil {
+			fmt.Println("No XMP metadata")
+			return nil
+		}
+		return printPacket(packet)
+	}
+	if packet == nil {
+		packet = xmp.New()
+	}
+
+	info, err := pdfReader.GetPdfInfo()
+	if err != nil {
+		info = &model.PdfInfo{} // No document information dictionary.
+	}
+	packet.FromInfo(info, false)
+	if err := editPacket(packet); err != nil {
+		return err
+	}
+	packet.SetModified(time.Now())
+	if err := packet.ToInfo(info); err != nil {
+		return err
+	}
+
+	pdfWriter, err := pdfReader.ToWriter(&model.ReaderToWriterOpts{SkipInfo: true})
+	if err != nil {
+		return err
+	}
+	pdfWriter.SetDocInfo(info)
+	if err := xmp.SetDocumentMetadata(pdfWriter, packet); err != nil {
+		return err
+	}
+	return pdfWriter.WriteToFile(xmpOpts.output)
+}
+
+// printPacket prints `packet` as XML with -xml, else as a property list.
+func printPacket(packet *xmp.Packet) error {
+	if !xmpOpts.xml {
+		packet.Print(os.Stdout)
+		return nil
+	}
+	data, err := packet.Marshal()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// editPacket applies the edits of the command line to `packet`.
+func editPacket(packet *xmp.Packet) error {
+	for _, decl := range xmpOpts.namespaces {
+		prefix, uri, err := splitAssignment(decl)
+		if err != nil {
+			return err
+		}
+		if err := packet.RegisterNamespace(prefix, uri); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+	if xmpOpts.schema != "" {
+		data, err := ioutil.ReadFile(xmpOpts.schema)
+		if err != nil {
+			return err
+		}
+		var schemas []xmp.Schema
+		if err := json.Unmarshal(data, &schemas); err != nil {
+			return fmt.Errorf("%s: %w", xmpOpts.schema, err)
+		}
+		for _, s := range schemas {
+			if err := packet.AddExtension(s); err != nil {
+				return fmt.Errorf("%s: %w", xmpOpts.schema, err)
+			}
+		}
+	}
+
+	type setter func(ns, name, value string)
+	edits := []struct {
+		values stringList
+		set    setter
+	}{
+		{xmpOpts.set, packet.SetText},
+		{xmpOpts.bag, func(ns, name, value string) { packet.Set(ns, name, xmp.NewBag(splitItems(value)...)) }},
+		{xmpOpts.seq, func(ns, name, value string) { packet.Set(ns, name, xmp.NewSeq(splitItems(value)...)) }},
+	}
+	for _, e := range edits {
+		for _, assignment := range e.values {
+			qname, value, err := splitAssignment(assignment)
+			if err != nil {
+				return err
+			}
+			ns, name, err := packet.ParseName(qname)
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+			e.set(ns, name, value)
+		}
+	}
+	for _, assignment := range xmpOpts.alt {
+		qname, value, err := splitAssignment(assignment)
+		if err != nil {
+			return err
+		}
+		lang := "x-default"
+		if i := strings.LastIndexByte(qname, '@'); i >= 0 {
+			qname, lang = qname[:i], qname[i+1:]
+		}
+		ns, name, err := packet.ParseName(qname)
+		if err != nil {
+			return usageErrorf("%v", err)
+		}
+		v, _ := packet.Get(ns, name)
+		if v.Kind != xmp.Alt {
+			v = xmp.Value{Kind: xmp.Alt}
+		}
+		v.SetLang(lang, value)
+		packet.Set(ns, name, v)
+	}
+	for _, qname := range xmpOpts.remove {
+		ns, name, err := packet.ParseName(qname)
+		if err != nil {
+			return usageErrorf("%v", err)
+		}
+		if !packet.Remove(ns, name) {
+			return fmt.Errorf("property %s not found", qname)
+		}
+	}
+	return nil
+}
+
+// splitAssignment splits "key=value".
+func splitAssignment(s string) (key, value string, err error) {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return "", "", usageErrorf("invalid assignment %q: must be key=value", s)
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// splitItems splits the ";" separated array items of `value`.
+func splitItems(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
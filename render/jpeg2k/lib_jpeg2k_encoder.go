@@ -225,3 +225,50 @@ func (enc *CustomJPXEncoder) DecodeStream(streamObj *core.PdfObjectStream) ([]by
 func (enc *CustomJPXEncoder) EncodeBytes(data []byte) ([]byte, error) {
 	return data, errors.New("Custom encode bytes not yet implemented")
 }
+
+// EncodeImage encodes `img` as JPEG 2000 (JP2) with `quality` (1-100). The image must have 8 bits per
+// component and 1 (gray), 3 (RGB) or 4 (CMYK) color components.
+// It can be used as the JPX encoder of the compress/recompress package.
+func EncodeImage(img *model.Image, quality int) ([]byte, error) {
+	if img.BitsPerComponent != 8 {
+		return nil, fmt.Errorf("Unsupported image bit depth: %v", img.BitsPerComponent)
+	}
+
+	var pixelMap string
+	var cs imagick.ColorspaceType
+	switch img.ColorComponents {
+	case 1:
+		pixelMap, cs = "I", imagick.COLORSPACE_GRAY
+	case 3:
+		pixelMap, cs = "RGB", imagick.COLORSPACE_SRGB
+	case 4:
+		pixelMap, cs = "CMYK", imagick.COLORSPACE_CMYK
+	default:
+		return nil, fmt.Errorf("Unsupported number of color components: %v", img.ColorComponents)
+	}
+
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	err := mw.ConstituteImage(uint(img.Width), uint(img.Height), pixelMap, imagick.PIXEL_CHAR, img.Data)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the number of components in the JPX data equal to the one of the PDF color space.
+	if err := mw.SetImageColorspace(cs); err != nil {
+		return nil, err
+	}
+	if err := mw.SetImageDepth(8); err != nil {
+		return nil, err
+	}
+	if err := mw.SetImageCompressionQuality(uint(quality)); err != nil {
+		return nil, err
+	}
+	if err := mw.SetImageFormat("JP2"); err != nil {
+		return nil, err
+	}
+	return mw.GetImageBlob(), nil
+}
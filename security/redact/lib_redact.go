@@ -0,0 +1,1172 @@
+/*
+ * Package redact removes content from PDF pages under rectangular regions or wherever text matches
+ * one of a set of regular expressions. Unlike drawing a black box over the content, the glyphs,
+ * image pixels and vector paths under the redacted areas are removed from the content streams
+ * (including form XObjects), annotations in the areas are deleted and matching text is scrubbed from
+ * the remaining annotations and the document information dictionary. Overlay boxes are drawn over
+ * the redacted areas afterwards.
+ *
+ * The removal works as follows:
+ *  - Glyphs are erased if at least a quarter of their bounding box is inside a redacted area. The
+ *    position of the remaining text does not change.
+ *  - Images are decoded, the pixels under the areas are painted with the fill color and the image is
+ *    stored as a new Flate encoded image. The soft mask of the image is made opaque under the areas
+ *    likewise, as its alpha values show the shapes too. Images covered completely, stencil masks
+ *    and inline images touching an area are removed altogether.
+ *  - Redacted pages and forms get their own XObject resources, from which the originals of redacted
+ *    images and forms are dropped, so they aren't written unless other pages still show them.
+ *  - Vector paths touching an area are not painted, unless the path encloses the area completely
+ *    (page backgrounds, frames), in which case it does not reveal anything about the area.
+ *
+ * Used by pdftool redact.
+ */
+
+package redact
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/common"
+	"github.com/unidoc/unipdf/v3/contentstream"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/extractor"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/text/glyphs"
+)
+
+// maxFormDepth limits the nesting of form XObjects processed, protecting against cycles.
+const maxFormDepth = 10
+
+// Region is a rectangular area to redact.
+type Region struct {
+	Page int                // Page number the region applies to. 0 for all pages.
+	Rect model.PdfRectangle // Area in the default user space of the page.
+}
+
+// Options specifies what to redact and how the redacted areas look.
+type Options struct {
+	// Regions are redacted unconditionally.
+	Regions []Region
+	// Terms are redacted wherever the page text matches, including text in form XObjects.
+	// Matching text is also removed from annotations and the document information.
+	Terms []*regexp.Regexp
+
+	// FillColor is the RGB color (components 0..1) of the overlay boxes and of redacted image pixels.
+	FillColor [3]float64
+	// Label is drawn centered into overlay boxes that are large enough, e.g. "REDACTED".
+	Label string
+	// LabelColor is the RGB color of Label.
+	LabelColor [3]float64
+	// NoOverlay disables drawing overlay boxes. The content is removed regardless.
+	NoOverlay bool
+}
+
+// Redactor redacts pages according to its options.
+type Redactor struct {
+	opts Options
+}
+
+// PageReport summarizes the redaction of a page.
+type PageReport struct {
+	Page        int          `json:"page"`
+	Areas       [][4]float64 `json:"areas"` // llx, lly, urx, ury of the redacted areas.
+	Glyphs      int          `json:"glyphs"`
+	Images      int          `json:"images"`
+	Paths       int          `json:"paths"`
+	Annotations int          `json:"annotations"`
+}
+
+// Leak is content found by Verify that should have been redacted.
+type Leak struct {
+	Page int        `json:"page"`
+	Text string     `json:"text"`
+	BBox [4]float64 `json:"bbox"`
+	// XObject is the name of the image or form holding the content, if not the page text.
+	XObject string `json:"xobject,omitempty"`
+}
+
+// New returns a Redactor with options `opts`.
+func New(opts Options) *Redactor {
+	return &Redactor{opts: opts}
+}
+
+// RedactPage redacts page `page` with page number `pageNum`.
+// Form fields should be flattened beforehand (model.PdfReader.FlattenFields) so their values are
+// part of the page content.
+func (r *Redactor) RedactPage(page *model.PdfPage, pageNum int) (*PageReport, error) {
+	report := &PageReport{Page: pageNum}
+
+	contents, err := page.GetAllContentStreams()
+	if err != nil {
+		return nil, err
+	}
+
+	areas := r.regions(pageNum)
+	termAreas, err := r.termAreas(contents, page.Resources, glyphs.IdentityMatrix(), 0)
+	if err != nil {
+		return nil, err
+	}
+	areas = append(areas, termAreas...)
+
+	if len(areas) > 0 {
+		page.Resources = ownXObjects(page.Resources)
+		redacted, _, err := r.redactContent(contents, page.Resources, glyphs.IdentityMatrix(), areas, report, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := pruneXObjects(redacted, page.Resources); err != nil {
+			return nil, err
+		}
+		content := "q\n" + string(redacted) + "\nQ\n"
+		if !r.opts.NoOverlay {
+			overlay, err := r.overlay(page, areas)
+			if err != nil {
+				return nil, err
+			}
+			content += overlay
+		}
+		if err := page.SetContentStreams([]string{content}, core.NewFlateEncoder()); err != nil {
+			return nil, err
+		}
+
+		// Thumbnails and private application data show the original content.
+		page.Thumb = nil
+		page.PieceInfo = nil
+	}
+	for _, a := range areas {
+		report.Areas = append(report.Areas, [4]float64{a.Llx, a.Lly, a.Urx, a.Ury})
+	}
+
+	n, err := r.redactAnnotations(page, areas)
+	if err != nil {
+		return nil, err
+	}
+	report.Annotations = n
+	return report, nil
+}
+
+// ScrubInfo removes text matching the terms from the string entries of `info`. It returns the number
+// of entries changed.
+func (r *Redactor) ScrubInfo(info *model.PdfInfo) int {
+	if info == nil {
+		return 0
+	}
+
+	changed := 0
+	for _, field := range []**core.PdfObjectString{&info.Title, &info.Author, &info.Subject, &info.Keywords, &info.Creator, &info.Producer} {
+		if *field == nil {
+			continue
+		}
+		if s, ok := r.scrub((*field).Decoded()); ok {
+			*field = core.MakeEncodedString(s, true)
+			changed++
+		}
+	}
+	for _, key := range info.CustomKeys() {
+		value := info.GetCustomInfo(key)
+		if value == nil {
+			continue
+		}
+		if s, ok := r.scrub(value.Decoded()); ok {
+			if err := info.AddCustomInfo(key, s); err != nil {
+				common.Log.Debug("Unable to set %s: %v", key, err)
+			}
+			changed++
+		}
+	}
+	return changed
+}
+
+// VerifyPages verifies the redacted `pages`, numbered from 1, with Verify. Images and forms in the
+// resources of the pages and forms that no content shows are leaks too, as they are still in the
+// file.
+func (r *Redactor) VerifyPages(pages []*model.PdfPage) ([]Leak, error) {
+	var leaks []Leak
+	shown := &xobjectUse{}
+	for i, page := range pages {
+		pageLeaks, err := r.verify(page, i+1, shown)
+		if err != nil {
+			return nil, err
+		}
+		leaks = append(leaks, pageLeaks...)
+	}
+
+	// Resources shared by several pages or forms are only checked once all of them are.
+	for _, dict := range shown.dicts {
+		for _, name := range dict.Keys() {
+			if shown.names[dict][name] {
+				continue
+			}
+			leaks = append(leaks, Leak{Page: shown.pages[dict], Text: "unused XObject", XObject: name.String()})
+		}
+	}
+	return leaks, nil
+}
+
+// xobjectUse records the XObjects shown from the XObject dictionaries of resources.
+type xobjectUse struct {
+	dicts []*core.PdfObjectDictionary
+	names map[*core.PdfObjectDictionary]map[core.PdfObjectName]bool
+	pages map[*core.PdfObjectDictionary]int // The first page reaching each dictionary.
+}
+
+// add records the dictionary of `resources`, reached from page `pageNum`, and returns the names
+// shown from it.
+func (u *xobjectUse) add(resources *model.PdfPageResources, pageNum int) map[core.PdfObjectName]bool {
+	dict, ok := core.GetDict(resources.XObject)
+	if !ok {
+		return map[core.PdfObjectName]bool{}
+	}
+	if u.names == nil {
+		u.names = map[*core.PdfObjectDictionary]map[core.PdfObjectName]bool{}
+		u.pages = map[*core.PdfObjectDictionary]int{}
+	}
+	if _, ok := u.names[dict]; !ok {
+		u.dicts = append(u.dicts, dict)
+		u.names[dict] = map[core.PdfObjectName]bool{}
+		u.pages[dict] = pageNum
+	}
+	return u.names[dict]
+}
+
+// Verify extracts the text of `page` (page number `pageNum`) and returns the text that still
+// matches one of the terms or lies inside one of the regions. The images shown under the regions,
+// also by forms, must have the fill color there. Use VerifyPages to find redacted originals left in
+// the resources as well.
+func (r *Redactor) Verify(page *model.PdfPage, pageNum int) ([]Leak, error) {
+	return r.verify(page, pageNum, &xobjectUse{})
+}
+
+// verify is Verify recording the XObjects shown in `shown`.
+func (r *Redactor) verify(page *model.PdfPage, pageNum int, shown *xobjectUse) ([]Leak, error) {
+	ex, err := extractor.New(page)
+	if err != nil {
+		return nil, err
+	}
+	pageText, _, _, err := ex.ExtractPageText()
+	if err != nil {
+		return nil, err
+	}
+	text := pageText.Text()
+	marks := pageText.Marks()
+
+	var leaks []Leak
+	for _, re := range r.opts.Terms {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			leak := Leak{Page: pageNum, Text: text[loc[0]:loc[1]]}
+			if spanMarks, err := marks.RangeOffset(loc[0], loc[1]); err == nil {
+				if bbox, ok := spanMarks.BBox(); ok {
+					leak.BBox = [4]float64{bbox.Llx, bbox.Lly, bbox.Urx, bbox.Ury}
+				}
+			}
+			leaks = append(leaks, leak)
+		}
+	}
+
+	regions := r.regions(pageNum)
+	for _, mark := range marks.Elements() {
+		if strings.TrimSpace(mark.Text) == "" {
+			continue
+		}
+		cx, cy := (mark.BBox.Llx+mark.BBox.Urx)/2, (mark.BBox.Lly+mark.BBox.Ury)/2
+		for _, region := range regions {
+			if cx > region.Llx && cx < region.Urx && cy > region.Lly && cy < region.Ury {
+				leaks = append(leaks, Leak{
+					Page: pageNum,
+					Text: mark.Text,
+					BBox: [4]float64{mark.BBox.Llx, mark.BBox.Lly, mark.BBox.Urx, mark.BBox.Ury},
+				})
+				break
+			}
+		}
+	}
+
+	contents, err := page.GetAllContentStreams()
+	if err != nil {
+		return nil, err
+	}
+	xobjLeaks, err := r.verifyXObjects(contents, page.Resources, glyphs.IdentityMatrix(), regions, pageNum, shown, 0)
+	if err != nil {
+		return nil, err
+	}
+	return append(leaks, xobjLeaks...), nil
+}
+
+// verifyXObjects returns the leaks of the images shown by the content stream `contents` with
+// `resources`, including those of the forms it shows, recording the XObjects shown in `shown`.
+// `m` maps the content stream space to page space.
+func (r *Redactor) verifyXObjects(contents string, resources *model.PdfPageResources, m glyphs.Matrix,
+	regions []model.PdfRectangle, pageNum int, shown *xobjectUse, depth int) ([]Leak, error) {
+	if depth >= maxFormDepth || resources == nil {
+		return nil, nil
+	}
+	ops, err := contentstream.NewContentStreamParser(contents).Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var leaks []Leak
+	names := shown.add(resources, pageNum)
+	processor := contentstream.NewContentStreamProcessor(*ops)
+	processor.AddHandler(contentstream.HandlerConditionEnumOperand, "Do",
+		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
+			if len(op.Params) != 1 {
+				return nil
+			}
+			name, ok := core.GetName(op.Params[0])
+			if !ok {
+				return nil
+			}
+			names[*name] = true
+			ctm := glyphs.CTM(gs).Mult(m)
+
+			switch _, xtype := resources.GetXObjectByName(*name); xtype {
+			case model.XObjectTypeImage:
+				if !intersectsAny(ctm.BBox(0, 0, 1, 1), regions) {
+					return nil
+				}
+				ximg, err := resources.GetXObjectImageByName(*name)
+				if err != nil {
+					return err
+				}
+				area, err := r.unredactedArea(ximg, ctm, regions)
+				if err != nil {
+					return err
+				}
+				if area != nil {
+					leaks = append(leaks, Leak{
+						Page:    pageNum,
+						Text:    "image pixels",
+						BBox:    [4]float64{area.Llx, area.Lly, area.Urx, area.Ury},
+						XObject: name.String(),
+					})
+				}
+				if area, err = unmaskedArea(ximg, ctm, regions); err != nil {
+					return err
+				}
+				if area != nil {
+					leaks = append(leaks, Leak{
+						Page:    pageNum,
+						Text:    "soft mask pixels",
+						BBox:    [4]float64{area.Llx, area.Lly, area.Urx, area.Ury},
+						XObject: name.String(),
+					})
+				}
+			case model.XObjectTypeForm:
+				form, err := resources.GetXObjectFormByName(*name)
+				if err != nil {
+					return err
+				}
+				formContents, err := form.GetContentStream()
+				if err != nil {
+					return err
+				}
+				formLeaks, err := r.verifyXObjects(string(formContents), formResources(form, resources),
+					formMatrix(form).Mult(ctm), regions, pageNum, shown, depth+1)
+				if err != nil {
+					return err
+				}
+				leaks = append(leaks, formLeaks...)
+			}
+			return nil
+		})
+	if err := processor.Process(resources); err != nil {
+		return nil, err
+	}
+
+	return leaks, nil
+}
+
+// regions returns the regions that apply to page `pageNum`.
+func (r *Redactor) regions(pageNum int) []model.PdfRectangle {
+	var rects []model.PdfRectangle
+	for _, region := range r.opts.Regions {
+		if region.Page == 0 || region.Page == pageNum {
+			rects = append(rects, normalize(region.Rect))
+		}
+	}
+	return rects
+}
+
+// scrub removes the text matching the terms from `s`. It returns false if nothing matched.
+func (r *Redactor) scrub(s string) (string, bool) {
+	changed := false
+	for _, re := range r.opts.Terms {
+		if re.MatchString(s) {
+			s = re.ReplaceAllString(s, "")
+			changed = true
+		}
+	}
+	return s, changed
+}
+
+// termAreas returns the areas of the text matching the terms in content stream `contents` and the
+// forms it invokes. `m` maps the content stream space to page space.
+func (r *Redactor) termAreas(contents string, resources *model.PdfPageResources, m glyphs.Matrix,
+	depth int) ([]model.PdfRectangle, error) {
+	if len(r.opts.Terms) == 0 {
+		return nil, nil
+	}
+
+	c, err := glyphs.ParseWithMatrix(contents, resources, m)
+	if err != nil {
+		return nil, err
+	}
+
+	text, index := glyphs.Layout(c.Glyphs)
+	var areas []model.PdfRectangle
+	for _, re := range r.opts.Terms {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			// One area per line of the match.
+			var area *model.PdfRectangle
+			for k := loc[0]; k < loc[1]; k++ {
+				i := index[k]
+				if i < 0 {
+					if text[k] == '\n' && area != nil {
+						areas = append(areas, *area)
+						area = nil
+					}
+					continue
+				}
+				bbox := c.Glyphs[i].BBox
+				if area == nil {
+					area = &bbox
+					continue
+				}
+				*area = union(*area, bbox)
+			}
+			if area != nil {
+				areas = append(areas, *area)
+			}
+		}
+	}
+
+	err = forEachForm(c.Ops, resources, m, depth, func(form *model.XObjectForm, formContents []byte, fm glyphs.Matrix) error {
+		formAreas, err := r.termAreas(string(formContents), formResources(form, resources), fm, depth+1)
+		areas = append(areas, formAreas...)
+		return err
+	})
+	return areas, err
+}
+
+// redactContent removes the content of `contents` under `areas` and returns the resulting content
+// stream. `m` maps the content stream space to page space. New images and forms replacing
+// redacted ones are added to `resources`. It returns false if nothing was changed.
+func (r *Redactor) redactContent(contents string, resources *model.PdfPageResources, m glyphs.Matrix,
+	areas []model.PdfRectangle, report *PageReport, depth int) ([]byte, bool, error) {
+	// Text.
+	c, err := glyphs.ParseWithMatrix(contents, resources, m)
+	if err != nil {
+		return nil, false, err
+	}
+	for i, g := range c.Glyphs {
+		for _, area := range areas {
+			if overlap(g.BBox, area) >= 0.25 {
+				c.Erase(i)
+				report.Glyphs++
+				break
+			}
+		}
+	}
+	changed := c.Modified()
+
+	// Paths, images and forms.
+	ops, err := contentstream.NewContentStreamParser(string(c.Bytes())).Parse()
+	if err != nil {
+		return nil, false, err
+	}
+
+	var path *model.PdfRectangle
+	addPoints := func(ctm glyphs.Matrix, coords ...float64) {
+		for k := 0; k+1 < len(coords); k += 2 {
+			x, y := ctm.Transform(coords[k], coords[k+1])
+			p := model.PdfRectangle{Llx: x, Lly: y, Urx: x, Ury: y}
+			if path == nil {
+				path = &p
+				continue
+			}
+			*path = union(*path, p)
+		}
+	}
+
+	processor := contentstream.NewContentStreamProcessor(*ops)
+	processor.AddHandler(contentstream.HandlerConditionEnumAllOperands, "",
+		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
+			ctm := glyphs.CTM(gs).Mult(m)
+			floats, _ := core.GetNumbersAsFloat(op.Params)
+
+			switch op.Operand {
+			case "m", "l", "c", "v", "y":
+				addPoints(ctm, floats...)
+			case "re":
+				if len(floats) == 4 {
+					x, y, w, h := floats[0], floats[1], floats[2], floats[3]
+					addPoints(ctm, x, y, x+w, y, x+w, y+h, x, y+h)
+				}
+			case "S", "s", "f", "F", "f*", "B", "B*", "b", "b*":
+				if path != nil && revealsArea(*path, areas) {
+					// End the path without painting it, clipping set up by a preceding W is kept.
+					op.Operand = "n"
+					op.Params = nil
+					report.Paths++
+					changed = true
+				}
+				path = nil
+			case "n":
+				path = nil
+			case "BI":
+				if intersectsAny(ctm.BBox(0, 0, 1, 1), areas) {
+					op.Operand = "n"
+					op.Params = nil
+					report.Images++
+					changed = true
+				}
+			case "Do":
+				ok, err := r.redactXObject(op, resources, ctm, areas, report, depth)
+				if err != nil {
+					return err
+				}
+				changed = changed || ok
+			}
+			return nil
+		})
+	if err := processor.Process(resources); err != nil {
+		return nil, false, err
+	}
+	return ops.Bytes(), changed, nil
+}
+
+// redactXObject redacts the image or form invoked by Do operation `op` where `ctm` maps the
+// XObject space to page space. The operation is changed to refer to the redacted copy, or to a no-op
+// if nothing is left. Returns true if `op` was changed. The original stays in `resources` as other
+// invocations may show it elsewhere: pruneXObjects drops it once the content is redacted.
+func (r *Redactor) redactXObject(op *contentstream.ContentStreamOperation, resources *model.PdfPageResources,
+	ctm glyphs.Matrix, areas []model.PdfRectangle, report *PageReport, depth int) (bool, error) {
+	if len(op.Params) != 1 || resources == nil {
+		return false, nil
+	}
+	name, ok := core.GetName(op.Params[0])
+	if !ok {
+		return false, nil
+	}
+
+	_, xtype := resources.GetXObjectByName(*name)
+	switch xtype {
+	case model.XObjectTypeImage:
+		if !intersectsAny(ctm.BBox(0, 0, 1, 1), areas) {
+			return false, nil
+		}
+		ximg, err := resources.GetXObjectImageByName(*name)
+		if err != nil {
+			return false, err
+		}
+		report.Images++
+
+		redacted, err := r.redactImage(ximg, ctm, areas)
+		if err != nil {
+			return false, err
+		}
+		if redacted == nil {
+			op.Operand = "n"
+			op.Params = nil
+			return true, nil
+		}
+		newName := resources.GenerateXObjectName()
+		if err := resources.SetXObjectImageByName(newName, redacted); err != nil {
+			return false, err
+		}
+		op.Params = []core.PdfObject{core.MakeName(string(newName))}
+		return true, nil
+
+	case model.XObjectTypeForm:
+		if depth >= maxFormDepth {
+			common.Log.Debug("Form XObjects nested too deeply - skip %s", *name)
+			return false, nil
+		}
+		form, err := resources.GetXObjectFormByName(*name)
+		if err != nil {
+			return false, err
+		}
+		formContents, err := form.GetContentStream()
+		if err != nil {
+			return false, err
+		}
+		fm := formMatrix(form).Mult(ctm)
+		formRes := ownXObjects(formResources(form, resources))
+		redacted, changed, err := r.redactContent(string(formContents), formRes, fm, areas, report, depth+1)
+		if err != nil || !changed {
+			return false, err
+		}
+		if err := pruneXObjects(redacted, formRes); err != nil {
+			return false, err
+		}
+
+		// The form may be used elsewhere, so store the redacted content as a copy.
+		copied := model.NewXObjectForm()
+		copied.FormType = form.FormType
+		copied.BBox = form.BBox
+		copied.Matrix = form.Matrix
+		copied.Resources = formRes
+		copied.Group = form.Group
+		copied.OC = form.OC
+		if err := copied.SetContentStream(redacted, core.NewFlateEncoder()); err != nil {
+			return false, err
+		}
+		newName := resources.GenerateXObjectName()
+		if err := resources.SetXObjectFormByName(newName, copied); err != nil {
+			return false, err
+		}
+		op.Params = []core.PdfObject{core.MakeName(string(newName))}
+		return true, nil
+	}
+	return false, nil
+}
+
+// redactImage returns a copy of `ximg` with the pixels under `areas` painted with the fill color.
+// `ctm` maps the unit square of the image to page space. Returns nil if the whole image is covered
+// or the image cannot be redacted partially.
+func (r *Redactor) redactImage(ximg *model.XObjectImage, ctm glyphs.Matrix, areas []model.PdfRectangle) (*model.XObjectImage, error) {
+	if isMask, ok := core.GetBoolVal(ximg.ImageMask); ok && isMask {
+		return nil, nil
+	}
+	inv, ok := ctm.Inverse()
+	if !ok || ximg.ColorSpace == nil {
+		return nil, nil
+	}
+
+	img, err := ximg.ToImage()
+	if err != nil {
+		return nil, err
+	}
+	rgbImg, err := ximg.ColorSpace.ImageToRGB(*img)
+	if err != nil {
+		return nil, err
+	}
+	goimg, err := rgbImg.ToGoImage()
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := goimg.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, goimg, bounds.Min, draw.Src)
+
+	fill := image.NewUniform(r.fillColor())
+	for _, rect := range imageRects(inv, bounds, areas) {
+		if rect.Eq(bounds) {
+			return nil, nil
+		}
+		draw.Draw(dst, rect, fill, image.Point{}, draw.Src)
+	}
+
+	redacted, err := model.ImageHandling.NewImageFromGoImage(dst)
+	if err != nil {
+		return nil, err
+	}
+	newImg, err := model.NewXObjectImageFromImage(redacted, model.NewPdfColorspaceDeviceRGB(), core.NewFlateEncoder())
+	if err != nil {
+		return nil, err
+	}
+	if newImg.SMask, err = redactSoftMask(ximg, inv, areas); err != nil {
+		return nil, err
+	}
+	newImg.Interpolate = ximg.Interpolate
+	newImg.OC = ximg.OC
+	return newImg, nil
+}
+
+// unredactedArea returns the page area of the first pixel of `ximg` under `areas` that doesn't
+// have the fill color, or nil if there is none. `ctm` maps the unit square of the image to page
+// space. Stencil masks are only drawn with the fill color.
+func (r *Redactor) unredactedArea(ximg *model.XObjectImage, ctm glyphs.Matrix, areas []model.PdfRectangle) (*model.PdfRectangle, error) {
+	if isMask, ok := core.GetBoolVal(ximg.ImageMask); ok && isMask {
+		return nil, nil
+	}
+	inv, ok := ctm.Inverse()
+	if !ok || ximg.ColorSpace == nil {
+		return nil, nil
+	}
+	img, err := ximg.ToImage()
+	if err != nil {
+		return nil, err
+	}
+	rgbImg, err := ximg.ColorSpace.ImageToRGB(*img)
+	if err != nil {
+		return nil, err
+	}
+	goimg, err := rgbImg.ToGoImage()
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := goimg.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	fill := r.fillColor()
+	for _, rect := range imageRects(inv, bounds, areas) {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				cr, cg, cb, _ := goimg.At(x, y).RGBA()
+				if near(cr, fill.R) && near(cg, fill.G) && near(cb, fill.B) {
+					continue
+				}
+				// The pixel back in page space.
+				ux, uy := float64(x-bounds.Min.X)/w, 1-float64(y-bounds.Min.Y)/h
+				area := ctm.BBox(ux, uy-1/h, ux+1/w, uy)
+				return &area, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// softMask returns the soft mask of `ximg`, its samples as a Go image and the sample value of its
+// opaque pixels, or a nil mask if `ximg` has no soft mask.
+func softMask(ximg *model.XObjectImage) (*model.XObjectImage, image.Image, uint8, error) {
+	stream, ok := core.GetStream(ximg.SMask)
+	if !ok {
+		return nil, nil, 0, nil
+	}
+	mask, err := model.NewXObjectImageFromStream(stream)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	img, err := mask.ToImage()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	goimg, err := img.ToGoImage()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	// The Decode array [1 0] inverts the samples.
+	opaque := uint8(255)
+	if decode, ok := core.GetArray(mask.Decode); ok && decode.Len() == 2 {
+		if d, err := decode.ToFloat64Array(); err == nil && d[0] > d[1] {
+			opaque = 0
+		}
+	}
+	return mask, goimg, opaque, nil
+}
+
+// redactSoftMask returns a copy of the soft mask of `ximg` that is opaque under `areas`, or nil if
+// `ximg` has no soft mask. `inv` maps page space to the unit square of the image.
+func redactSoftMask(ximg *model.XObjectImage, inv glyphs.Matrix, areas []model.PdfRectangle) (core.PdfObject, error) {
+	mask, goimg, opaque, err := softMask(ximg)
+	if err != nil || mask == nil {
+		return nil, err
+	}
+	bounds := goimg.Bounds()
+	dst := image.NewGray(bounds)
+	draw.Draw(dst, bounds, goimg, bounds.Min, draw.Src)
+	fill := image.NewUniform(color.Gray{Y: opaque})
+	for _, rect := range imageRects(inv, bounds, areas) {
+		draw.Draw(dst, rect, fill, image.Point{}, draw.Src)
+	}
+
+	redacted := &model.Image{
+		Width:            int64(bounds.Dx()),
+		Height:           int64(bounds.Dy()),
+		BitsPerComponent: 8,
+		ColorComponents:  1,
+		Data:             dst.Pix,
+	}
+	newMask, err := model.NewXObjectImageFromImage(redacted, model.NewPdfColorspaceDeviceGray(), core.NewFlateEncoder())
+	if err != nil {
+		return nil, err
+	}
+	newMask.Decode = mask.Decode
+	newMask.Matte = mask.Matte
+	newMask.Interpolate = mask.Interpolate
+	return newMask.ToPdfObject(), nil
+}
+
+// unmaskedArea returns the page area of the first pixel of the soft mask of `ximg` under `areas`
+// that isn't opaque, or nil if there is none or `ximg` has no soft mask. `ctm` maps the unit square
+// of the image to page space.
+func unmaskedArea(ximg *model.XObjectImage, ctm glyphs.Matrix, areas []model.PdfRectangle) (*model.PdfRectangle, error) {
+	inv, ok := ctm.Inverse()
+	if !ok {
+		return nil, nil
+	}
+	mask, goimg, opaque, err := softMask(ximg)
+	if err != nil || mask == nil {
+		return nil, err
+	}
+	bounds := goimg.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	for _, rect := range imageRects(inv, bounds, areas) {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if color.GrayModel.Convert(goimg.At(x, y)).(color.Gray).Y == opaque {
+					continue
+				}
+				ux, uy := float64(x-bounds.Min.X)/w, 1-float64(y-bounds.Min.Y)/h
+				area := ctm.BBox(ux, uy-1/h, ux+1/w, uy)
+				return &area, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// imageRects returns the pixel rectangles of the image with `bounds` under `areas`. `inv` maps page
+// space to the unit square of the image, where y runs upwards.
+func imageRects(inv glyphs.Matrix, bounds image.Rectangle, areas []model.PdfRectangle) []image.Rectangle {
+	var rects []image.Rectangle
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	for _, area := range areas {
+		unit := inv.BBox(area.Llx, area.Lly, area.Urx, area.Ury)
+		rect := image.Rect(
+			int(math.Floor(unit.Llx*w)), int(math.Floor((1-unit.Ury)*h)),
+			int(math.Ceil(unit.Urx*w)), int(math.Ceil((1-unit.Lly)*h)),
+		).Add(bounds.Min).Intersect(bounds)
+		if !rect.Empty() {
+			rects = append(rects, rect)
+		}
+	}
+	return rects
+}
+
+// fillColor returns the fill color of redacted pixels.
+func (r *Redactor) fillColor() color.RGBA {
+	return color.RGBA{
+		R: uint8(r.opts.FillColor[0]*255 + 0.5),
+		G: uint8(r.opts.FillColor[1]*255 + 0.5),
+		B: uint8(r.opts.FillColor[2]*255 + 0.5),
+		A: 255,
+	}
+}
+
+// near returns true if the 16 bit color component `c` is the 8 bit component `c8`, allowing for
+// rounding by color conversions.
+func near(c uint32, c8 uint8) bool {
+	return math.Abs(float64(c>>8)-float64(c8)) <= 2
+}
+
+// ownXObjects returns a copy of `resources` with its own XObject dictionary, so that XObjects can
+// be replaced and dropped without affecting the other pages and forms sharing `resources`.
+func ownXObjects(resources *model.PdfPageResources) *model.PdfPageResources {
+	if resources == nil {
+		return nil
+	}
+	dict, ok := core.GetDict(resources.ToPdfObject())
+	if !ok {
+		return resources
+	}
+	copied := core.MakeDict()
+	for _, key := range dict.Keys() {
+		copied.Set(key, dict.Get(key))
+	}
+	xobjects := core.MakeDict()
+	if orig, ok := core.GetDict(dict.Get("XObject")); ok {
+		for _, key := range orig.Keys() {
+			xobjects.Set(key, orig.Get(key))
+		}
+	}
+	copied.Set("XObject", xobjects)
+
+	owned, err := model.NewPdfPageResourcesFromDict(copied)
+	if err != nil {
+		common.Log.Debug("Unable to copy resources: %v", err)
+		return resources
+	}
+	return owned
+}
+
+// pruneXObjects removes the XObjects that the content stream `contents` doesn't invoke from
+// `resources`, such as the originals of redacted images and forms.
+func pruneXObjects(contents []byte, resources *model.PdfPageResources) error {
+	if resources == nil {
+		return nil
+	}
+	dict, ok := core.GetDict(resources.XObject)
+	if !ok {
+		return nil
+	}
+	ops, err := contentstream.NewContentStreamParser(string(contents)).Parse()
+	if err != nil {
+		return err
+	}
+	used := map[core.PdfObjectName]bool{}
+	for _, op := range *ops {
+		if op.Operand == "Do" && len(op.Params) == 1 {
+			if name, ok := core.GetName(op.Params[0]); ok {
+				used[*name] = true
+			}
+		}
+	}
+	for _, key := range dict.Keys() {
+		if !used[key] {
+			dict.Remove(key)
+		}
+	}
+	return nil
+}
+
+// redactAnnotations removes the annotations of `page` overlapping `areas` and scrubs the text
+// matching the terms from the others. It returns the number of annotations removed or changed.
+func (r *Redactor) redactAnnotations(page *model.PdfPage, areas []model.PdfRectangle) (int, error) {
+	annotations, err := page.GetAnnotations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var kept []*model.PdfAnnotation
+	for _, annot := range annotations {
+		if arr, ok := core.GetArray(annot.Rect); ok {
+			if rect, err := model.NewPdfRectangle(*arr); err == nil && intersectsAny(*rect, areas) {
+				count++
+				continue
+			}
+		}
+
+		changed := r.scrubObject(&annot.Contents)
+		if markup := markupOf(annot); markup != nil {
+			for _, obj := range []*core.PdfObject{&markup.T, &markup.Subj, &markup.RC} {
+				changed = r.scrubObject(obj) || changed
+			}
+		}
+		if changed {
+			// The appearance shows the original text. Viewers regenerate it from the scrubbed text.
+			annot.AP = nil
+			count++
+		}
+		kept = append(kept, annot)
+	}
+
+	if count > 0 {
+		page.SetAnnotations(kept)
+	}
+	return count, nil
+}
+
+// scrubObject removes text matching the terms from string object `*obj`. Returns true if it changed.
+func (r *Redactor) scrubObject(obj *core.PdfObject) bool {
+	str, ok := core.GetString(*obj)
+	if !ok {
+		return false
+	}
+	s, changed := r.scrub(str.Decoded())
+	if changed {
+		*obj = core.MakeEncodedString(s, true)
+	}
+	return changed
+}
+
+// markupOf returns the markup fields of `annot`, or nil if it is not a markup annotation.
+func markupOf(annot *model.PdfAnnotation) *model.PdfAnnotationMarkup {
+	switch t := annot.GetContext().(type) {
+	case *model.PdfAnnotationText:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationFreeText:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationHighlight:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationUnderline:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationSquiggly:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationStrikeOut:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationSquare:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationCircle:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationLine:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationPolygon:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationPolyLine:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationInk:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationStamp:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationCaret:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationFileAttachment:
+		return t.PdfAnnotationMarkup
+	case *model.PdfAnnotationRedact:
+		return t.PdfAnnotationMarkup
+	}
+	return nil
+}
+
+// overlay returns the content stream drawing the overlay boxes over `areas`. A font resource for
+// the label is added to `page` if needed.
+func (r *Redactor) overlay(page *model.PdfPage, areas []model.PdfRectangle) (string, error) {
+	var sb strings.Builder
+	fc := r.opts.FillColor
+	fmt.Fprintf(&sb, "q\n%.4f %.4f %.4f rg\n", fc[0], fc[1], fc[2])
+	for _, a := range areas {
+		fmt.Fprintf(&sb, "%.4f %.4f %.4f %.4f re f\n", a.Llx, a.Lly, a.Urx-a.Llx, a.Ury-a.Lly)
+	}
+
+	if r.opts.Label != "" {
+		font := model.NewStandard14FontMustCompile(model.HelveticaName)
+		fontName := core.PdfObjectName("RedactF1")
+		for k := 2; page.HasFontByName(fontName); k++ {
+			fontName = core.PdfObjectName(fmt.Sprintf("RedactF%d", k))
+		}
+		if err := page.AddFont(fontName, font.ToPdfObject()); err != nil {
+			return "", err
+		}
+
+		code, _ := font.StringToCharcodeBytes(r.opts.Label)
+		width := 0.0
+		for _, charcode := range font.BytesToCharcodes(code) {
+			if metrics, ok := font.GetCharMetrics(charcode); ok {
+				width += metrics.Wx / 1000
+			}
+		}
+
+		lc := r.opts.LabelColor
+		for _, a := range areas {
+			size := math.Min(10, 0.7*(a.Ury-a.Lly))
+			if size < 4 || width*size > a.Urx-a.Llx {
+				continue
+			}
+			x := a.Llx + (a.Urx-a.Llx-width*size)/2
+			y := a.Lly + (a.Ury-a.Lly-0.7*size)/2
+			fmt.Fprintf(&sb, "BT /%s %.2f Tf %.4f %.4f %.4f rg %.4f %.4f Td %s Tj ET\n",
+				fontName, size, lc[0], lc[1], lc[2], x, y, core.MakeStringFromBytes(code).WriteString())
+		}
+	}
+	sb.WriteString("Q\n")
+	return sb.String(), nil
+}
+
+// forEachForm calls `fn` for the forms invoked in `ops` with their content and the matrix mapping
+// their space to page space. `m` maps the space of `ops` to page space.
+func forEachForm(ops contentstream.ContentStreamOperations, resources *model.PdfPageResources, m glyphs.Matrix,
+	depth int, fn func(form *model.XObjectForm, contents []byte, fm glyphs.Matrix) error) error {
+	if depth >= maxFormDepth || resources == nil {
+		return nil
+	}
+
+	processor := contentstream.NewContentStreamProcessor(ops)
+	processor.AddHandler(contentstream.HandlerConditionEnumOperand, "Do",
+		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
+			if len(op.Params) != 1 {
+				return nil
+			}
+			name, ok := core.GetName(op.Params[0])
+			if !ok {
+				return nil
+			}
+			if _, xtype := resources.GetXObjectByName(*name); xtype != model.XObjectTypeForm {
+				return nil
+			}
+			form, err := resources.GetXObjectFormByName(*name)
+			if err != nil {
+				return err
+			}
+			contents, err := form.GetContentStream()
+			if err != nil {
+				return err
+			}
+			return fn(form, contents, formMatrix(form).Mult(glyphs.CTM(gs).Mult(m)))
+		})
+	return processor.Process(resources)
+}
+
+// formMatrix returns the /Matrix of `form`.
+func formMatrix(form *model.XObjectForm) glyphs.Matrix {
+	if arr, ok := core.GetArray(form.Matrix); ok {
+		if vals, err := arr.ToFloat64Array(); err == nil && len(vals) == 6 {
+			return glyphs.Matrix{vals[0], vals[1], vals[2], vals[3], vals[4], vals[5]}
+		}
+	}
+	return glyphs.IdentityMatrix()
+}
+
+// formResources returns the resources of `form`, falling back to the resources of the invoking
+// content stream as older PDFs rely on.
+func formResources(form *model.XObjectForm, parent *model.PdfPageResources) *model.PdfPageResources {
+	if form.Resources != nil {
+		return form.Resources
+	}
+	return parent
+}
+
+// revealsArea returns true if painting a path with bounding box `path` shows anything of `areas`,
+// i.e. it overlaps one of them without enclosing it.
+func revealsArea(path model.PdfRectangle, areas []model.PdfRectangle) bool {
+	for _, a := range areas {
+		if !intersects(path, a) {
+			continue
+		}
+		encloses := path.Llx <= a.Llx && path.Lly <= a.Lly && path.Urx >= a.Urx && path.Ury >= a.Ury
+		if !encloses {
+			return true
+		}
+	}
+	return false
+}
+
+func intersectsAny(r model.PdfRectangle, areas []model.PdfRectangle) bool {
+	for _, a := range areas {
+		if intersects(r, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// intersects returns true if `a` and `b` overlap. Rectangles only sharing an edge do not overlap,
+// but a horizontal or vertical line crossing the other rectangle does.
+func intersects(a, b model.PdfRectangle) bool {
+	ox := math.Min(a.Urx, b.Urx) - math.Max(a.Llx, b.Llx)
+	oy := math.Min(a.Ury, b.Ury) - math.Max(a.Lly, b.Lly)
+	switch {
+	case ox < 0 || oy < 0:
+		return false
+	case ox > 0 && oy > 0:
+		return true
+	case ox > 0:
+		return a.Lly == a.Ury || b.Lly == b.Ury
+	case oy > 0:
+		return a.Llx == a.Urx || b.Llx == b.Urx
+	}
+	return false
+}
+
+// overlap returns the fraction of the area of `a` covered by `b`.
+func overlap(a, b model.PdfRectangle) float64 {
+	w := math.Min(a.Urx, b.Urx) - math.Max(a.Llx, b.Llx)
+	h := math.Min(a.Ury, b.Ury) - math.Max(a.Lly, b.Lly)
+	area := (a.Urx - a.Llx) * (a.Ury - a.Lly)
+	if w <= 0 || h <= 0 || area <= 0 {
+		return 0
+	}
+	return w * h / area
+}
+
+// normalize returns `r` with the lower left corner first.
+func normalize(r model.PdfRectangle) model.PdfRectangle {
+	return model.PdfRectangle{
+		Llx: math.Min(r.Llx, r.Urx),
+		Lly: math.Min(r.Lly, r.Ury),
+		Urx: math.Max(r.Llx, r.Urx),
+		Ury: math.Max(r.Lly, r.Ury),
+	}
+}
+
+// union returns the smallest rectangle containing `a` and `b`.
+func union(a, b model.PdfRectangle) model.PdfRectangle {
+	return model.PdfRectangle{
+		Llx: math.Min(a.Llx, b.Llx),
+		Lly: math.Min(a.Lly, b.Lly),
+		Urx: math.Max(a.Urx, b.Urx),
+		Ury: math.Max(a.Ury, b.Ury),
+	}
+}
@@ -0,0 +1,170 @@
+package redact
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/text/glyphs"
+)
+
+// imagePage returns a page showing the image Im1 of `resources` over 0,0,100,100.
+func imagePage(t *testing.T, resources *model.PdfPageResources) *model.PdfPage {
+	page := model.NewPdfPage()
+	page.MediaBox = &model.PdfRectangle{Urx: 200, Ury: 200}
+	page.Resources = resources
+	if err := page.SetContentStreams([]string{"q 100 0 0 100 0 0 cm /Im1 Do Q"}, core.NewRawEncoder()); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+// xobjectNames returns the names of the XObjects of `resources`.
+func xobjectNames(resources *model.PdfPageResources) []string {
+	dict, _ := core.GetDict(resources.XObject)
+	var names []string
+	for _, key := range dict.Keys() {
+		names = append(names, string(key))
+	}
+	return names
+}
+
+// opaqueImage returns a black image without alpha channel.
+func opaqueImage(t *testing.T) *model.Image {
+	goimg := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	draw.Draw(goimg, goimg.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	img, err := model.ImageHandling.NewImageFromGoImage(goimg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestRedactPageDropsOriginals(t *testing.T) {
+	ximg, err := model.NewXObjectImageFromImage(opaqueImage(t), model.NewPdfColorspaceDeviceRGB(), core.NewFlateEncoder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := model.NewPdfPageResources()
+	if err := shared.SetXObjectImageByName("Im1", ximg); err != nil {
+		t.Fatal(err)
+	}
+	page1, page2 := imagePage(t, shared), imagePage(t, shared)
+
+	region := model.PdfRectangle{Llx: 10, Lly: 10, Urx: 50, Ury: 50}
+	r := New(Options{FillColor: [3]float64{1, 0, 0}, Regions: []Region{{Page: 1, Rect: region}}})
+	regions := r.regions(1)
+	leaks, err := r.verifyXObjects("q 100 0 0 100 0 0 cm /Im1 Do Q", shared, glyphs.IdentityMatrix(), regions, 1, &xobjectUse{}, 0)
+	if err != nil || len(leaks) != 1 || leaks[0].XObject != "Im1" {
+		t.Fatalf("got leaks %+v (%v) before redaction, want the pixels of Im1", leaks, err)
+	}
+
+	report, err := r.RedactPage(page1, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Images != 1 {
+		t.Errorf("got %d images redacted, want 1", report.Images)
+	}
+	tests := []struct {
+		name string
+		page *model.PdfPage
+		want []string
+	}{
+		{"redacted page", page1, []string{"XObj1"}},
+		{"other page", page2, []string{"Im1"}},
+	}
+	shown := &xobjectUse{}
+	for i, tc := range tests {
+		if got := xobjectNames(tc.page.Resources); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got XObjects %q, want %q", tc.name, got, tc.want)
+		}
+		contents, err := tc.page.GetAllContentStreams()
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaks, err := r.verifyXObjects(contents, tc.page.Resources, glyphs.IdentityMatrix(), r.regions(i+1), i+1, shown, 0)
+		if err != nil || len(leaks) > 0 {
+			t.Errorf("%s: got leaks %+v (%v), want none", tc.name, leaks, err)
+		}
+	}
+	for _, dict := range shown.dicts {
+		for _, name := range dict.Keys() {
+			if !shown.names[dict][name] {
+				t.Errorf("XObject %s is not shown", name)
+			}
+		}
+	}
+}
+
+func TestRedactPageSoftMask(t *testing.T) {
+	ximg, err := model.NewXObjectImageFromImage(opaqueImage(t), model.NewPdfColorspaceDeviceRGB(), core.NewFlateEncoder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The shape of the soft mask is a square inside the redacted area, the rest is transparent.
+	alpha := make([]byte, 20*20)
+	for y := 12; y < 16; y++ {
+		for x := 4; x < 8; x++ {
+			alpha[y*20+x] = 200
+		}
+	}
+	mask, err := model.NewXObjectImageFromImage(&model.Image{Width: 20, Height: 20, BitsPerComponent: 8,
+		ColorComponents: 1, Data: alpha}, model.NewPdfColorspaceDeviceGray(), core.NewFlateEncoder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ximg.SMask = mask.ToPdfObject()
+	resources := model.NewPdfPageResources()
+	if err := resources.SetXObjectImageByName("Im1", ximg); err != nil {
+		t.Fatal(err)
+	}
+	page := imagePage(t, resources)
+
+	region := model.PdfRectangle{Llx: 10, Lly: 10, Urx: 50, Ury: 50}
+	r := New(Options{Regions: []Region{{Page: 1, Rect: region}}})
+	leaks, err := r.verifyXObjects("q 100 0 0 100 0 0 cm /Im1 Do Q", resources, glyphs.IdentityMatrix(), r.regions(1), 1, &xobjectUse{}, 0)
+	if err != nil || len(leaks) != 1 || leaks[0].Text != "soft mask pixels" {
+		t.Fatalf("got leaks %+v (%v) before redaction, want the soft mask pixels", leaks, err)
+	}
+
+	if _, err := r.RedactPage(page, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	contents, err := page.GetAllContentStreams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaks, err = r.verifyXObjects(contents, page.Resources, glyphs.IdentityMatrix(), r.regions(1), 1, &xobjectUse{}, 0)
+	if err != nil || len(leaks) > 0 {
+		t.Fatalf("got leaks %+v (%v) after redaction, want none", leaks, err)
+	}
+
+	redacted, err := page.Resources.GetXObjectImageByName("XObj1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, samples, _, err := softMask(redacted)
+	if err != nil || samples == nil {
+		t.Fatalf("got no soft mask (%v)", err)
+	}
+	// The area covers pixels 2,10 to 9,17.
+	tests := []struct {
+		x, y int
+		want uint8
+	}{
+		{0, 0, 0},
+		{5, 14, 255},
+		{3, 17, 255},
+	}
+	for _, tc := range tests {
+		if got := color.GrayModel.Convert(samples.At(tc.x, tc.y)).(color.Gray).Y; got != tc.want {
+			t.Errorf("soft mask at %d,%d: got %d, want %d", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
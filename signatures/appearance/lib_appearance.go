@@ -0,0 +1,392 @@
+/*
+ * Package appearance creates signature appearances from declarative templates, so that their look
+ * can be changed without recompiling. A template, in YAML or JSON, sets the text lines with
+ * placeholders, the font, the colors, the border, a background image and a handwritten signature
+ * image with its position relative to the text, e.g.
+ *
+ *   rect: [10, 25, 260, 95]
+ *   font: Helvetica            # standard 14 font name or TrueType file
+ *   font_size: 8
+ *   text_color: "#1a237e"
+ *   fill_color: "#f5f5f5"
+ *   border_size: 1
+ *   border_color: "#9e9e9e"
+ *   background: logo.png       # drawn behind the appearance
+ *   signature_image: handwritten.png
+ *   image_position: left       # left, right, top or bottom of the text
+ *   date_format: "2006-01-02 15:04 MST"
+ *   lines:
+ *     - {label: Signed by, text: "{{signer.CN}}"}
+ *     - {label: Organization, text: "{{signer.O}}"}
+ *     - {label: Date, text: "{{date}}"}
+ *     - {label: Reason, text: "{{reason}}"}
+ *
+ * Files are relative to the directory of the template. Lines whose text is empty after the
+ * placeholders are replaced are left out. The placeholders are:
+ *  - {{signer.CN}}, {{signer.O}}, {{signer.OU}}, {{signer.C}}, {{signer.L}}, {{signer.ST}},
+ *    {{signer.email}}, {{signer.serial}}: the subject of the signing certificate;
+ *  - {{issuer.CN}}, {{issuer.O}}: the issuer of the signing certificate;
+ *  - {{date}}: the signing time in the date_format of the template (Go layout);
+ *  - {{name}}, {{reason}}, {{location}}, {{contact}}, {{field}}: the signature entries;
+ *  - any key of Values.Extra.
+ *
+ * Used by pdftool sign and signatures/pdf_sign_appearance_template.go.
+ */
+
+package appearance
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Decoders of the template images.
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// DefaultDateFormat is the layout of {{date}} if the template sets none.
+const DefaultDateFormat = "2006.01.02 15:04:05 -07:00"
+
+// Line is a text line of a template.
+type Line struct {
+	// Label is shown before the text, followed by a colon.
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
+	Text  string `json:"text" yaml:"text"`
+}
+
+// Template is a signature appearance template.
+type Template struct {
+	// Rect is the rectangle of the appearance as [llx, lly, urx, ury], if the template sets it.
+	Rect  []float64 `json:"rect,omitempty" yaml:"rect,omitempty"`
+	Lines []Line    `json:"lines,omitempty" yaml:"lines,omitempty"`
+
+	// Font is the name of a standard 14 font or the path of a TrueType font file.
+	Font       string  `json:"font,omitempty" yaml:"font,omitempty"`
+	FontSize   float64 `json:"font_size,omitempty" yaml:"font_size,omitempty"`
+	LineHeight float64 `json:"line_height,omitempty" yaml:"line_height,omitempty"`
+	// AutoSize scales the text to fit the rectangle.
+	AutoSize bool `json:"auto_size,omitempty" yaml:"auto_size,omitempty"`
+
+	// Colors are given as #rrggbb or #rgb.
+	TextColor   string  `json:"text_color,omitempty" yaml:"text_color,omitempty"`
+	FillColor   string  `json:"fill_color,omitempty" yaml:"fill_color,omitempty"`
+	BorderColor string  `json:"border_color,omitempty" yaml:"border_color,omitempty"`
+	BorderSize  float64 `json:"border_size,omitempty" yaml:"border_size,omitempty"`
+
+	// Background is a PNG or JPEG image drawn behind the appearance.
+	Background string `json:"background,omitempty" yaml:"background,omitempty"`
+	// SignatureImage is a PNG or JPEG image, e.g. of a handwritten signature.
+	SignatureImage string `json:"signature_image,omitempty" yaml:"signature_image,omitempty"`
+	// ImagePosition is the position of the signature image relative to the text: left (default),
+	// right, top or bottom.
+	ImagePosition string `json:"image_position,omitempty" yaml:"image_position,omitempty"`
+
+	// DateFormat is the Go time layout of {{date}}, DefaultDateFormat if empty.
+	DateFormat string `json:"date_format,omitempty" yaml:"date_format,omitempty"`
+
+	dir string // Directory of the template file.
+}
+
+// Values are the values of the placeholders.
+type Values struct {
+	// Signer is the signing certificate.
+	Signer      *x509.Certificate
+	Time        time.Time
+	Name        string
+	Reason      string
+	Location    string
+	ContactInfo string
+	Field       string
+	// Extra are additional placeholders by name.
+	Extra map[string]string
+}
+
+var imagePositions = map[string]annotator.SignatureImagePosition{
+	"left":   annotator.SignatureImageLeft,
+	"right":  annotator.SignatureImageRight,
+	"top":    annotator.SignatureImageTop,
+	"bottom": annotator.SignatureImageBottom,
+}
+
+// Load reads the YAML or JSON template file at `path` and checks it.
+func Load(path string) (*Template, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is a subset of YAML, so both are read by the YAML decoder.
+	var t Template
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t.dir = filepath.Dir(path)
+	if err := t.check(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// check returns an error if `t` is not valid.
+func (t *Template) check() error {
+	if t.Rect != nil && len(t.Rect) != 4 {
+		return fmt.Errorf("rect must be [llx, lly, urx, ury]")
+	}
+	for _, c := range []string{t.TextColor, t.FillColor, t.BorderColor} {
+		if _, err := parseColor(c); err != nil {
+			return err
+		}
+	}
+	if t.ImagePosition != "" {
+		if _, ok := imagePositions[strings.ToLower(t.ImagePosition)]; !ok {
+			return fmt.Errorf("invalid image_position %q: must be left, right, top or bottom", t.ImagePosition)
+		}
+	}
+	return nil
+}
+
+// Render returns the signature lines and the appearance options of `t` for `v`. The rectangle of
+// the options is the one of the template, nil if it sets none.
+func (t *Template) Render(v Values) ([]*annotator.SignatureLine, *annotator.SignatureFieldOpts, error) {
+	lines, err := t.SignatureLines(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts, err := t.Options()
+	if err != nil {
+		return nil, nil, err
+	}
+	return lines, opts, nil
+}
+
+// SignatureLines returns the signature lines of `t` with the placeholders replaced by `v`.
+func (t *Template) SignatureLines(v Values) ([]*annotator.SignatureLine, error) {
+	values := v.placeholders(t.DateFormat)
+	var lines []*annotator.SignatureLine
+	for _, line := range t.Lines {
+		label, err := expand(line.Label, values)
+		if err != nil {
+			return nil, err
+		}
+		text, err := expand(line.Text, values)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		lines = append(lines, annotator.NewSignatureLine(label, text))
+	}
+	return lines, nil
+}
+
+// Options returns the appearance options of `t`, with its font and images loaded.
+func (t *Template) Options() (*annotator.SignatureFieldOpts, error) {
+	opts := annotator.NewSignatureFieldOpts()
+	if t.Rect != nil {
+		opts.Rect = append([]float64(nil), t.Rect...)
+	}
+	opts.AutoSize = t.AutoSize
+	if t.FontSize > 0 {
+		opts.FontSize = t.FontSize
+	}
+	if t.LineHeight > 0 {
+		opts.LineHeight = t.LineHeight
+	}
+	if t.BorderSize > 0 {
+		opts.BorderSize = t.BorderSize
+	}
+
+	if t.Font != "" {
+		font, err := t.loadFont()
+		if err != nil {
+			return nil, err
+		}
+		opts.Font = font
+	}
+	colors := []struct {
+		value string
+		color *model.PdfColor
+	}{
+		{t.TextColor, &opts.TextColor},
+		{t.FillColor, &opts.FillColor},
+		{t.BorderColor, &opts.BorderColor},
+	}
+	for _, c := range colors {
+		if c.value == "" {
+			continue
+		}
+		color, err := parseColor(c.value)
+		if err != nil {
+			return nil, err
+		}
+		*c.color = color
+	}
+
+	if t.Background != "" {
+		img, err := t.loadImage(t.Background)
+		if err != nil {
+			return nil, err
+		}
+		opts.WatermarkImage = img
+	}
+	if t.SignatureImage != "" {
+		img, err := t.loadImage(t.SignatureImage)
+		if err != nil {
+			return nil, err
+		}
+		opts.Image = img
+		opts.ImagePosition = imagePositions[strings.ToLower(t.ImagePosition)]
+	}
+	return opts, nil
+}
+
+// path returns the path of file `name` of the template.
+func (t *Template) path(name string) string {
+	if filepath.IsAbs(name) || t.dir == "" {
+		return name
+	}
+	return filepath.Join(t.dir, name)
+}
+
+// loadFont returns the font of the template.
+func (t *Template) loadFont() (*model.PdfFont, error) {
+	if font, err := model.NewStandard14Font(model.StdFontName(t.Font)); err == nil {
+		return font, nil
+	}
+	font, err := model.NewPdfFontFromTTFFile(t.path(t.Font))
+	if err != nil {
+		return nil, fmt.Errorf("font %q is neither a standard 14 font nor a TrueType file: %w", t.Font, err)
+	}
+	return font, nil
+}
+
+// loadImage decodes the image file `name` of the template.
+func (t *Template) loadImage(name string) (image.Image, error) {
+	f, err := os.Open(t.path(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return img, nil
+}
+
+// placeholder matches a placeholder and its name.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// builtin are the names of the placeholders of Values other than Extra.
+var builtin = []string{"signer.CN", "signer.O", "signer.OU", "signer.C", "signer.L", "signer.ST",
+	"signer.email", "signer.serial", "issuer.CN", "issuer.O", "date", "name", "reason",
+	"location", "contact", "field"}
+
+// known reports whether `name` is a built-in placeholder.
+func known(name string) bool {
+	for _, b := range builtin {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholders returns the values of the placeholders of `v`, with {{date}} in `dateFormat`.
+func (v Values) placeholders(dateFormat string) map[string]string {
+	if dateFormat == "" {
+		dateFormat = DefaultDateFormat
+	}
+	values := map[string]string{
+		"name":     v.Name,
+		"reason":   v.Reason,
+		"location": v.Location,
+		"contact":  v.ContactInfo,
+		"field":    v.Field,
+	}
+	if !v.Time.IsZero() {
+		values["date"] = v.Time.Format(dateFormat)
+	}
+	first := func(s []string) string {
+		if len(s) == 0 {
+			return ""
+		}
+		return s[0]
+	}
+	subject := func(prefix string, name pkix.Name) {
+		values[prefix+".CN"] = name.CommonName
+		values[prefix+".O"] = first(name.Organization)
+		values[prefix+".OU"] = first(name.OrganizationalUnit)
+		values[prefix+".C"] = first(name.Country)
+		values[prefix+".L"] = first(name.Locality)
+		values[prefix+".ST"] = first(name.Province)
+	}
+	if cert := v.Signer; cert != nil {
+		subject("signer", cert.Subject)
+		subject("issuer", cert.Issuer)
+		values["signer.email"] = first(cert.EmailAddresses)
+		values["signer.serial"] = strings.ToUpper(cert.SerialNumber.Text(16))
+		if values["signer.email"] == "" {
+			// The e-mail address in the subject (PKCS #9 emailAddress).
+			for _, atv := range cert.Subject.Names {
+				if atv.Type.String() == "1.2.840.113549.1.9.1" {
+					values["signer.email"] = fmt.Sprint(atv.Value)
+				}
+			}
+		}
+	}
+	for name, value := range v.Extra {
+		values[name] = value
+	}
+	return values
+}
+
+// expand replaces the placeholders of `s` by `values`. Unknown placeholders are an error.
+func expand(s string, values map[string]string) (string, error) {
+	var err error
+	out := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		name := placeholder.FindStringSubmatch(m)[1]
+		value, ok := values[name]
+		if !ok && !known(name) && err == nil {
+			err = fmt.Errorf("unknown placeholder %s", m)
+		}
+		return value
+	})
+	return out, err
+}
+
+// parseColor parses a color given as #rrggbb or #rgb. An empty string returns nil.
+func parseColor(s string) (model.PdfColor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return nil, fmt.Errorf("invalid color %q: must be #rrggbb or #rgb", s)
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q: must be #rrggbb or #rgb", s)
+	}
+	return model.NewPdfColorDeviceRGB(float64(rgb>>16&0xff)/255, float64(rgb>>8&0xff)/255,
+		float64(rgb&0xff)/255), nil
+}
@@ -0,0 +1,190 @@
+/*
+ * Package certify creates certification signatures, which apply a DocMDP transform with the
+ * changes permitted after signing (P=1: none, P=2: form filling and signing, P=3: also
+ * annotations), and locks form fields with FieldMDP transforms once a signature field is signed.
+ *
+ * A certification signature must be the first signature of a document and be referenced from the
+ * Perms dictionary of the catalog. The appender of unipdf writes a new catalog that copies the
+ * entries of the catalog of the input file, so the input is first prepared with Prepare, which
+ * appends an incremental update adding an empty, indirect Perms dictionary that Certify then
+ * fills in:
+ *
+ *   data, err = certify.Prepare(data)
+ *   reader, err := model.NewPdfReader(bytes.NewReader(data))
+ *   appender, err := model.NewPdfAppender(reader)
+ *   ... create the signature and its field ...
+ *   err = certify.Certify(appender, signature, certify.FormFilling)
+ *   err = certify.LockFields(field, verify.FieldLock{Action: "Include", Fields: []string{"Total"}})
+ *   err = appender.Sign(1, field)
+ *
+ * Check enforces the permissions: it returns an error if an incremental update makes changes that
+ * the DocMDP permission or the FieldMDP locks of the signatures of the original file don't allow.
+ *
+ * Used by pdftool sign and signatures/pdf_sign_certify.go.
+ */
+
+package certify
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+// Permission is the DocMDP access permission P of a certification signature.
+type Permission int
+
+// Permissions of certification signatures.
+const (
+	// NoChanges permits no changes.
+	NoChanges Permission = 1
+	// FormFilling permits filling in forms, instantiating page templates and signing.
+	FormFilling Permission = 2
+	// Annotations permits form filling and signing, and creating, deleting and modifying
+	// annotations.
+	Annotations Permission = 3
+)
+
+var permissionNames = map[Permission]string{
+	NoChanges:   "no-changes",
+	FormFilling: "form-filling",
+	Annotations: "annotations",
+}
+
+func (p Permission) String() string {
+	if name, ok := permissionNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Permission(%d)", int(p))
+}
+
+// ParsePermission parses a permission given as 1, 2 or 3 or as its name.
+func ParsePermission(s string) (Permission, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if _, ok := permissionNames[Permission(n)]; ok {
+			return Permission(n), nil
+		}
+	}
+	for p, name := range permissionNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid permission %q: must be 1 (no-changes), 2 (form-filling) or 3 (annotations)", s)
+}
+
+// Certify makes `sig` a certification signature with permission `p` of the document appended to
+// by `appender`, which must have no signatures yet and must have been prepared with Prepare.
+func Certify(appender *model.PdfAppender, sig *model.PdfSignature, p Permission) error {
+	if _, ok := permissionNames[p]; !ok {
+		return fmt.Errorf("invalid permission %d", int(p))
+	}
+	reader := appender.Reader
+	if reader.AcroForm != nil {
+		for _, field := range reader.AcroForm.AllFields() {
+			if sf, ok := field.GetContext().(*model.PdfFieldSignature); ok && sf.V != nil {
+				return errors.New("a certification signature must be the first signature of the document")
+			}
+		}
+	}
+
+	perms, err := permsObject(reader)
+	if err != nil {
+		return err
+	}
+	if perms == nil {
+		return errors.New("the catalog has no indirect Perms dictionary, prepare the document first")
+	}
+	dict, ok := core.GetDict(perms)
+	if !ok {
+		return errors.New("invalid Perms dictionary")
+	}
+	dict.Set("DocMDP", sig.GetContainingPdfObject())
+	appender.UpdateObject(perms)
+
+	params := core.MakeDict()
+	params.Set("Type", core.MakeName("TransformParams"))
+	params.Set("P", core.MakeInteger(int64(p)))
+	params.Set("V", core.MakeName("1.2"))
+	addReference(sig, "DocMDP", params)
+	return nil
+}
+
+// LockFields makes signature field `field` lock the form fields of `lock` when it is signed: the
+// field gets a lock dictionary and its signature a FieldMDP transform.
+func LockFields(field *model.PdfFieldSignature, lock verify.FieldLock) error {
+	switch lock.Action {
+	case "All":
+	case "Include", "Exclude":
+		if len(lock.Fields) == 0 {
+			return fmt.Errorf("lock action %s requires fields", lock.Action)
+		}
+	default:
+		return fmt.Errorf("invalid lock action %q: must be All, Include or Exclude", lock.Action)
+	}
+	if field.V == nil {
+		return errors.New("the signature field has no signature")
+	}
+
+	fields := core.MakeArray()
+	for _, name := range lock.Fields {
+		fields.Append(core.MakeString(name))
+	}
+	dict := core.MakeDict()
+	dict.Set("Type", core.MakeName("SigFieldLock"))
+	dict.Set("Action", core.MakeName(lock.Action))
+	if lock.Action != "All" {
+		dict.Set("Fields", fields)
+	}
+	field.Lock = core.MakeIndirectObject(dict)
+
+	params := core.MakeDict()
+	params.Set("Type", core.MakeName("TransformParams"))
+	params.Set("Action", core.MakeName(lock.Action))
+	if lock.Action != "All" {
+		params.Set("Fields", fields)
+	}
+	params.Set("V", core.MakeName("1.2"))
+	addReference(field.V, "FieldMDP", params)
+	return nil
+}
+
+// addReference adds a signature reference dictionary with transform `method` and its parameters
+// `params` to `sig`.
+func addReference(sig *model.PdfSignature, method string, params *core.PdfObjectDictionary) {
+	ref := core.MakeDict()
+	ref.Set("Type", core.MakeName("SigRef"))
+	ref.Set("TransformMethod", core.MakeName(method))
+	ref.Set("TransformParams", params)
+	if sig.Reference == nil {
+		sig.Reference = core.MakeArray()
+	}
+	sig.Reference.Append(ref)
+}
+
+// Check returns an error if the incremental updates appended to `original` in `updated` make
+// changes that the DocMDP permission or the FieldMDP locks of the signatures of `original` don't
+// allow.
+func Check(original, updated []byte, password string) error {
+	changes, err := verify.CheckUpdate(original, updated, password)
+	if err != nil {
+		return err
+	}
+	var disallowed []string
+	for _, c := range changes {
+		if !c.Allowed {
+			disallowed = append(disallowed, fmt.Sprintf("object %d (%s): %s", c.Object, c.Kind, c.Reason))
+		}
+	}
+	if len(disallowed) > 0 {
+		return fmt.Errorf("the update is not permitted by the signatures of the document: %s",
+			strings.Join(disallowed, "; "))
+	}
+	return nil
+}
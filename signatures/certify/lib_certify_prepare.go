@@ -0,0 +1,210 @@
+/*
+ * Preparation of documents for certification: an incremental update that adds an indirect Perms
+ * dictionary to the catalog, written with a cross-reference section of the same kind as the last
+ * one of the file.
+ */
+
+package certify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// trailerSkipKeys are the keys of the trailer, or of a cross-reference stream dictionary, that
+// are not copied to the trailer of the update.
+var trailerSkipKeys = map[core.PdfObjectName]bool{
+	"Size": true, "Prev": true, "XRefStm": true, "Type": true, "W": true, "Index": true,
+	"Filter": true, "DecodeParms": true, "Length": true,
+}
+
+// Prepare returns PDF file `data` with an incremental update that adds an empty indirect Perms
+// dictionary to the catalog (keeping the entries of a direct one), for Certify to fill in. Files
+// that have an indirect Perms dictionary already are returned unchanged. Encrypted files are not
+// supported.
+func Prepare(data []byte) ([]byte, error) {
+	reader, err := model.NewPdfReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := reader.IsEncrypted()
+	if err != nil {
+		return nil, err
+	}
+	if encrypted {
+		return nil, errors.New("certifying encrypted documents is not supported")
+	}
+	perms, err := permsObject(reader)
+	if err != nil {
+		return nil, err
+	}
+	if perms != nil {
+		return data, nil
+	}
+
+	trailer, err := reader.GetTrailer()
+	if err != nil {
+		return nil, err
+	}
+	root, catalog, err := catalogObject(reader)
+	if err != nil {
+		return nil, err
+	}
+	prev, xrefStream, err := lastXref(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Perms dictionary gets the first free object number.
+	size := int64(0)
+	if s, ok := core.GetIntVal(trailer.Get("Size")); ok {
+		size = int64(s)
+	}
+	for _, num := range reader.GetObjectNums() {
+		if int64(num) >= size {
+			size = int64(num) + 1
+		}
+	}
+	permsNum := size
+	permsDict := core.MakeDict()
+	if direct, ok := core.GetDict(catalog.Get("Perms")); ok {
+		for _, key := range direct.Keys() {
+			permsDict.Set(key, direct.Get(key))
+		}
+	}
+	newCatalog := core.MakeDict()
+	for _, key := range catalog.Keys() {
+		newCatalog.Set(key, catalog.Get(key))
+	}
+	newCatalog.Set("Perms", &core.PdfObjectReference{ObjectNumber: permsNum})
+
+	var b bytes.Buffer
+	b.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' && data[len(data)-1] != '\r' {
+		b.WriteByte('\n')
+	}
+	type entry struct{ num, gen, offset int64 }
+	entries := []entry{{root.ObjectNumber, root.GenerationNumber, int64(b.Len())}}
+	fmt.Fprintf(&b, "%d %d obj\n%s\nendobj\n", root.ObjectNumber, root.GenerationNumber, newCatalog.WriteString())
+	entries = append(entries, entry{permsNum, 0, int64(b.Len())})
+	fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", permsNum, permsDict.WriteString())
+
+	newTrailer := core.MakeDict()
+	for _, key := range trailer.Keys() {
+		if !trailerSkipKeys[key] {
+			newTrailer.Set(key, trailer.Get(key))
+		}
+	}
+	newTrailer.Set("Prev", core.MakeInteger(prev))
+
+	xrefOffset := int64(b.Len())
+	if !xrefStream {
+		newTrailer.Set("Size", core.MakeInteger(permsNum+1))
+		b.WriteString("xref\n")
+		for _, e := range entries {
+			fmt.Fprintf(&b, "%d 1\n%010d %05d n\r\n", e.num, e.offset, e.gen)
+		}
+		fmt.Fprintf(&b, "trailer\n%s\n", newTrailer.WriteString())
+	} else {
+		// Cross-reference stream with 1 byte types, 4 byte offsets and 2 byte generations.
+		xrefNum := permsNum + 1
+		entries = append(entries, entry{xrefNum, 0, xrefOffset})
+		index := core.MakeArray()
+		var stream bytes.Buffer
+		for _, e := range entries {
+			index.Append(core.MakeInteger(e.num), core.MakeInteger(1))
+			stream.WriteByte(1)
+			binary.Write(&stream, binary.BigEndian, uint32(e.offset))
+			binary.Write(&stream, binary.BigEndian, uint16(e.gen))
+		}
+		newTrailer.Set("Type", core.MakeName("XRef"))
+		newTrailer.Set("Size", core.MakeInteger(xrefNum+1))
+		newTrailer.Set("W", core.MakeArray(core.MakeInteger(1), core.MakeInteger(4), core.MakeInteger(2)))
+		newTrailer.Set("Index", index)
+		newTrailer.Set("Length", core.MakeInteger(int64(stream.Len())))
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nstream\n", xrefNum, newTrailer.WriteString())
+		b.Write(stream.Bytes())
+		b.WriteString("\nendstream\nendobj\n")
+	}
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return b.Bytes(), nil
+}
+
+// lastXref returns the offset of the last cross-reference section of PDF file `data` and whether
+// it is a cross-reference stream.
+func lastXref(data []byte) (int64, bool, error) {
+	i := bytes.LastIndex(data, []byte("startxref"))
+	if i < 0 {
+		return 0, false, errors.New("missing startxref")
+	}
+	fields := bytes.Fields(data[i+len("startxref"):])
+	if len(fields) == 0 {
+		return 0, false, errors.New("missing startxref offset")
+	}
+	offset, err := strconv.ParseInt(string(fields[0]), 10, 64)
+	if err != nil || offset < 0 || offset >= int64(len(data)) {
+		return 0, false, fmt.Errorf("invalid startxref offset %q", fields[0])
+	}
+	section := bytes.TrimLeft(data[offset:], " \t\r\n")
+	return offset, !bytes.HasPrefix(section, []byte("xref")), nil
+}
+
+// permsObject returns the indirect Perms dictionary of the catalog of the document read by
+// `reader`, nil if the catalog has none or a direct one.
+func permsObject(reader *model.PdfReader) (*core.PdfIndirectObject, error) {
+	_, catalog, err := catalogObject(reader)
+	if err != nil {
+		return nil, err
+	}
+	var num int64
+	switch t := catalog.Get("Perms").(type) {
+	case *core.PdfObjectReference:
+		num = t.ObjectNumber
+	case *core.PdfIndirectObject:
+		num = t.ObjectNumber
+	default:
+		return nil, nil
+	}
+	obj, err := reader.GetIndirectObjectByNumber(int(num))
+	if err != nil {
+		return nil, err
+	}
+	perms, ok := obj.(*core.PdfIndirectObject)
+	if !ok {
+		return nil, fmt.Errorf("invalid Perms object %d", num)
+	}
+	return perms, nil
+}
+
+// catalogObject returns the catalog of the document read by `reader` and its dictionary.
+func catalogObject(reader *model.PdfReader) (*core.PdfIndirectObject, *core.PdfObjectDictionary, error) {
+	trailer, err := reader.GetTrailer()
+	if err != nil {
+		return nil, nil, err
+	}
+	var root *core.PdfIndirectObject
+	switch t := trailer.Get("Root").(type) {
+	case *core.PdfIndirectObject:
+		root = t
+	case *core.PdfObjectReference:
+		obj, err := reader.GetIndirectObjectByNumber(int(t.ObjectNumber))
+		if err != nil {
+			return nil, nil, err
+		}
+		root, _ = obj.(*core.PdfIndirectObject)
+	}
+	if root == nil {
+		return nil, nil, errors.New("missing catalog")
+	}
+	catalog, ok := core.GetDict(root.PdfObject)
+	if !ok {
+		return nil, nil, errors.New("missing catalog")
+	}
+	return root, catalog, nil
+}
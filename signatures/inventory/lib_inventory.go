@@ -0,0 +1,438 @@
+/*
+ * Package inventory lists the signature fields and signers of a corpus of PDF files for bulk
+ * compliance audits. Every file is verified with package verify and each of its signatures becomes
+ * an entry: field, signer subject and issuer, algorithm, signing time, timestamp, LTV status,
+ * coverage of the whole document and validity. Unsigned files and files that can't be read get an
+ * entry of their own, so that the inventory accounts for the whole corpus.
+ *
+ *   inv, err := inventory.Scan(paths, inventory.Options{Verify: verify.Options{Roots: roots}})
+ *   err = inv.WriteCSV(os.Stdout)
+ *   inv.Summarize().Print(os.Stdout)
+ *
+ * The summary aggregates the entries by attribute (status, algorithm, issuer, LTV status, ...),
+ * counted by signature and by file, like analysis/pdf_summarize_images.go does for images.
+ *
+ * Used by pdftool sign-inventory and signatures/pdf_sign_inventory.go.
+ */
+
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+// Options configures the scan.
+type Options struct {
+	// Verify are the options of the verification of each file, e.g. the trust anchors.
+	Verify verify.Options
+	// Workers is the number of files verified concurrently, the number of CPUs if 0.
+	Workers int
+	// Progress, if set, is called after each file with the number of files done.
+	Progress func(done, total int, path string, err error)
+}
+
+// Entry statuses beyond the signature statuses of package verify.
+const (
+	StatusUnsigned = "unsigned" // The file has no signatures.
+	StatusError    = "error"    // The file can't be read.
+)
+
+// LTV statuses of a signature.
+const (
+	// LTVComplete means that the chain ends in a root certificate and the document holds the
+	// revocation status of every other certificate of it.
+	LTVComplete = "complete"
+	// LTVPartial means that the revocation status of some certificates is embedded.
+	LTVPartial = "partial"
+	// LTVNone means that no revocation status is embedded.
+	LTVNone = "none"
+)
+
+// Entry is a signature of a file of the inventory.
+type Entry struct {
+	File      string `json:"file"`
+	Field     string `json:"field,omitempty"`
+	Type      string `json:"type,omitempty"` // approval, certification or timestamp.
+	SubFilter string `json:"sub_filter,omitempty"`
+	Signer    string `json:"signer,omitempty"`
+	Issuer    string `json:"issuer,omitempty"`
+	// Algorithm is the digest and signature algorithm, e.g. SHA-256/RSA-2048.
+	Algorithm   string     `json:"algorithm,omitempty"`
+	SigningTime *time.Time `json:"signing_time,omitempty"`
+	// Timestamp is "signature" for a signature timestamp, "document" for a document timestamp,
+	// empty if there is none.
+	Timestamp      string `json:"timestamp,omitempty"`
+	LTV            string `json:"ltv,omitempty"`
+	CoversDocument bool   `json:"covers_document"`
+	// Status is the status of the signature (valid, invalid or indeterminate), unsigned or error.
+	Status string `json:"status"`
+	// Reason explains a status other than valid: the first error, or else warning, of the
+	// verification.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Inventory is the list of the signatures of a corpus.
+type Inventory struct {
+	Files   int      `json:"files"`
+	Entries []*Entry `json:"entries"`
+}
+
+// Scan verifies the PDF files `paths` and returns their inventory. Directories are searched
+// recursively for files with the extension .pdf. The entries are in the order of the files.
+func Scan(paths []string, opts Options) (*Inventory, error) {
+	files, err := expand(paths)
+	if err != nil {
+		return nil, err
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	results := make([][]*Entry, len(files))
+	jobs := make(chan int)
+	var mu sync.Mutex
+	done := 0
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				entries, err := fileEntries(files[i], opts.Verify)
+				results[i] = entries
+				if opts.Progress != nil {
+					mu.Lock()
+					done++
+					opts.Progress(done, len(files), files[i], err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	inv := &Inventory{Files: len(files), Entries: []*Entry{}}
+	for _, entries := range results {
+		inv.Entries = append(inv.Entries, entries...)
+	}
+	return inv, nil
+}
+
+// expand returns the files of `paths`, with the PDF files of the directories among them.
+func expand(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && strings.EqualFold(filepath.Ext(file), ".pdf") {
+				files = append(files, file)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// fileEntries returns the entries of the PDF file `path`, and the error of the verification.
+func fileEntries(path string, opts verify.Options) ([]*Entry, error) {
+	report, err := verify.VerifyFile(path, opts)
+	if err != nil {
+		return []*Entry{{File: path, Status: StatusError, Reason: err.Error()}}, err
+	}
+	if len(report.Signatures) == 0 {
+		return []*Entry{{File: path, Status: StatusUnsigned}}, nil
+	}
+	var entries []*Entry
+	for _, sr := range report.Signatures {
+		e := &Entry{
+			File:           path,
+			Field:          sr.Field,
+			Type:           sr.Type,
+			SubFilter:      sr.SubFilter,
+			Algorithm:      strings.Trim(sr.DigestAlgorithm+"/"+sr.Algorithm, "/"),
+			SigningTime:    sr.SigningTime,
+			LTV:            ltvStatus(sr),
+			CoversDocument: sr.CoversDocument,
+			Status:         sr.Status,
+		}
+		if sr.Signer != nil {
+			e.Signer, e.Issuer = sr.Signer.Subject, sr.Signer.Issuer
+		}
+		switch {
+		case sr.Type == "timestamp":
+			e.Timestamp = "document"
+		case sr.Timestamp != nil:
+			e.Timestamp = "signature"
+		}
+		if sr.Status != verify.Valid {
+			if len(sr.Errors) > 0 {
+				e.Reason = sr.Errors[0]
+			} else if len(sr.Warnings) > 0 {
+				e.Reason = sr.Warnings[0]
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// ltvStatus returns the LTV status of the signature of `sr`.
+func ltvStatus(sr *verify.SignatureReport) string {
+	known := 0
+	for _, r := range sr.Revocation {
+		if r.Status != verify.StatusUnknown {
+			known++
+		}
+	}
+	switch {
+	case known == 0:
+		return LTVNone
+	case known < len(sr.Revocation):
+		return LTVPartial
+	}
+	if root := sr.Chain[len(sr.Chain)-1]; root.Subject != root.Issuer {
+		return LTVPartial
+	}
+	return LTVComplete
+}
+
+// csvHeader is the header of the CSV inventory.
+var csvHeader = []string{
+	"File",
+	"Field",
+	"Type",
+	"SubFilter",
+	"Signer",
+	"Issuer",
+	"Algorithm",
+	"Signing time",
+	"Timestamp",
+	"LTV",
+	"Covers document",
+	"Status",
+	"Reason",
+}
+
+// asStrings returns the CSV row of `e`.
+func (e *Entry) asStrings() []string {
+	var signingTime, covers string
+	if e.SigningTime != nil {
+		signingTime = e.SigningTime.Format(time.RFC3339)
+	}
+	if e.Field != "" {
+		covers = strconv.FormatBool(e.CoversDocument)
+	}
+	return []string{
+		e.File,
+		e.Field,
+		e.Type,
+		e.SubFilter,
+		e.Signer,
+		e.Issuer,
+		e.Algorithm,
+		signingTime,
+		e.Timestamp,
+		e.LTV,
+		covers,
+		e.Status,
+		e.Reason,
+	}
+}
+
+// WriteCSV writes the entries of `inv` as CSV with a header row to `w`.
+func (inv *Inventory) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range inv.Entries {
+		if err := cw.Write(e.asStrings()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes `inv` with its summary as indented JSON to `w`.
+func (inv *Inventory) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(struct {
+		Summary *Summary `json:"summary"`
+		*Inventory
+	}{inv.Summarize(), inv}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Summary is the aggregate of an inventory.
+type Summary struct {
+	Files         int `json:"files"`
+	SignedFiles   int `json:"signed_files"`
+	UnsignedFiles int `json:"unsigned_files"`
+	ErrorFiles    int `json:"error_files"`
+	Signatures    int `json:"signatures"`
+	// ValidFiles is the number of signed files whose signatures are all valid.
+	ValidFiles int `json:"valid_files"`
+	// Attributes are the counts of the values of the attributes of the signatures.
+	Attributes []*Attribute `json:"attributes"`
+}
+
+// Attribute is the distribution of the values of an attribute of the signatures.
+type Attribute struct {
+	Name   string   `json:"name"`
+	Values []*Count `json:"values"`
+}
+
+// Count is the number of signatures with a value of an attribute, and of the files with at least
+// one of them.
+type Count struct {
+	Value      string `json:"value"`
+	Signatures int    `json:"signatures"`
+	Files      int    `json:"files"`
+}
+
+// summaryAttributes are the attributes of the summary and their values for an entry.
+var summaryAttributes = []struct {
+	name  string
+	value func(e *Entry) string
+}{
+	{"status", func(e *Entry) string { return e.Status }},
+	{"type", func(e *Entry) string { return e.Type }},
+	{"sub filter", func(e *Entry) string { return e.SubFilter }},
+	{"algorithm", func(e *Entry) string { return e.Algorithm }},
+	{"issuer", func(e *Entry) string { return e.Issuer }},
+	{"timestamp", func(e *Entry) string { return e.Timestamp }},
+	{"ltv", func(e *Entry) string { return e.LTV }},
+	{"covers document", func(e *Entry) string { return strconv.FormatBool(e.CoversDocument) }},
+}
+
+// Summarize returns the aggregate of `inv`.
+func (inv *Inventory) Summarize() *Summary {
+	s := &Summary{Files: inv.Files}
+	byFile := map[string][]*Entry{}
+	var files []string
+	for _, e := range inv.Entries {
+		if _, ok := byFile[e.File]; !ok {
+			files = append(files, e.File)
+		}
+		byFile[e.File] = append(byFile[e.File], e)
+	}
+	for _, file := range files {
+		entries := byFile[file]
+		switch entries[0].Status {
+		case StatusError:
+			s.ErrorFiles++
+			continue
+		case StatusUnsigned:
+			s.UnsignedFiles++
+			continue
+		}
+		s.SignedFiles++
+		s.Signatures += len(entries)
+		valid := true
+		for _, e := range entries {
+			if e.Status != verify.Valid {
+				valid = false
+			}
+		}
+		if valid {
+			s.ValidFiles++
+		}
+	}
+
+	for _, attr := range summaryAttributes {
+		counts := map[string]*Count{}
+		for _, file := range files {
+			seen := map[string]bool{}
+			for _, e := range byFile[file] {
+				if e.Status == StatusError || e.Status == StatusUnsigned {
+					continue
+				}
+				v := attr.value(e)
+				if v == "" {
+					v = "(none)"
+				}
+				c, ok := counts[v]
+				if !ok {
+					c = &Count{Value: v}
+					counts[v] = c
+				}
+				c.Signatures++
+				if !seen[v] {
+					seen[v] = true
+					c.Files++
+				}
+			}
+		}
+		a := &Attribute{Name: attr.name, Values: []*Count{}}
+		for _, c := range counts {
+			a.Values = append(a.Values, c)
+		}
+		sort.Slice(a.Values, func(i, j int) bool {
+			ci, cj := a.Values[i], a.Values[j]
+			if ci.Signatures != cj.Signatures {
+				return ci.Signatures > cj.Signatures
+			}
+			return ci.Value < cj.Value
+		})
+		s.Attributes = append(s.Attributes, a)
+	}
+	return s
+}
+
+// Print writes `s` as text to `w`.
+func (s *Summary) Print(w io.Writer) {
+	fmt.Fprintln(w, "=================================================")
+	fmt.Fprintf(w, "Totals: %d of %d files are signed, %d signatures\n", s.SignedFiles, s.Files, s.Signatures)
+	fmt.Fprintf(w, "\tunsigned\t%s\n", percentage(s.UnsignedFiles, s.Files))
+	fmt.Fprintf(w, "\tunreadable\t%s\n", percentage(s.ErrorFiles, s.Files))
+	fmt.Fprintf(w, "\tall valid\t%s\n", percentage(s.ValidFiles, s.SignedFiles))
+	for _, a := range s.Attributes {
+		fmt.Fprintln(w, "-----------------------------------------")
+		fmt.Fprintf(w, "%s: %d values\n", a.Name, len(a.Values))
+		for _, c := range a.Values {
+			fmt.Fprintf(w, "\t%-40s\t%s signatures\t%s files\n", c.Value,
+				percentage(c.Signatures, s.Signatures), percentage(c.Files, s.SignedFiles))
+		}
+	}
+}
+
+// percentage returns `n` as a percentage of `total`.
+func percentage(n, total int) string {
+	perc := 0.0
+	if total > 0 {
+		perc = 100.0 * float64(n) / float64(total)
+	}
+	return fmt.Sprintf("%6d of %d (%4.1f%%)", n, total, perc)
+}
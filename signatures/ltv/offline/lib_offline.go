@@ -0,0 +1,453 @@
+/*
+ * Package offline LTV enables the signatures of PDF files from pre-fetched validation data, for
+ * signing servers without network access. model.LTV requests the OCSP responses and CRLs of the
+ * certificates from their responders and distribution points; here they are read from a
+ * directory of DER (or PEM) files downloaded beforehand, together with any issuer certificates:
+ *
+ *   store, err := offline.Load("revocation/")
+ *   report, err := offline.Enable(appender, store, extraCerts)
+ *   for _, cert := range report.Missing { ... no revocation information for cert ... }
+ *
+ * The files are told apart by their content, so their names don't matter. For every signature,
+ * and for its signature timestamp, the certificate chain is built from the certificates of the
+ * signature, the store and the extra certificates, and each certificate is matched to the OCSP
+ * responses for it (the newest is used) and to the CRLs of its issuer (the newest of each issuer).
+ * The chain and the matched data are added to the DSS, globally and in the VRI entry of the
+ * signature, with the certificates embedded in the OCSP responses. The report lists, per
+ * signature, the certificates with the files that cover them and those that still lack
+ * revocation information.
+ *
+ * Used by pdftool ltv and signatures/ltv/pdf_ltv_enable_offline.go.
+ */
+
+package offline
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+// Store is a set of pre-fetched certificates, CRLs and OCSP responses.
+type Store struct {
+	Certs []*x509.Certificate
+	// Skipped are the files that are neither certificates nor CRLs nor OCSP responses.
+	Skipped []string
+	crls    []*crlFile
+	ocsps   []*ocspFile
+}
+
+// crlFile is a CRL of a Store.
+type crlFile struct {
+	path string
+	der  []byte
+	crl  *pkix.CertificateList
+}
+
+// ocspFile is an OCSP response of a Store.
+type ocspFile struct {
+	path string
+	der  []byte
+	// certs are the certificates embedded in the response, e.g. of a delegated responder.
+	certs []*x509.Certificate
+}
+
+// Load reads the certificates, CRLs and OCSP responses of the files and directories `paths`.
+// Directories are read recursively.
+func Load(paths ...string) (*Store, error) {
+	s := &Store{}
+	for _, path := range paths {
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			s.add(file, data)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// add adds the file `path` with content `data` to `s`.
+func (s *Store) add(path string, data []byte) {
+	ders := [][]byte{data}
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		ders = nil
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			ders = append(ders, block.Bytes)
+		}
+	}
+
+	known := false
+	for _, der := range ders {
+		if certs, err := x509.ParseCertificates(der); err == nil && len(certs) > 0 {
+			s.Certs = append(s.Certs, certs...)
+			known = true
+		} else if crl, err := x509.ParseDERCRL(der); err == nil {
+			s.crls = append(s.crls, &crlFile{path: path, der: der, crl: crl})
+			known = true
+		} else if resp, err := ocsp.ParseResponse(der, nil); err == nil || isMultiResponse(err) {
+			f := &ocspFile{path: path, der: der}
+			if resp != nil && resp.Certificate != nil {
+				f.certs = append(f.certs, resp.Certificate)
+			}
+			s.ocsps = append(s.ocsps, f)
+			known = true
+		}
+	}
+	if !known {
+		s.Skipped = append(s.Skipped, path)
+	}
+}
+
+// isMultiResponse returns true if `err` is the error of ocsp.ParseResponse for a valid response
+// with several certificate statuses.
+func isMultiResponse(err error) bool {
+	_, ok := err.(ocsp.ParseError)
+	return ok && strings.Contains(err.Error(), "bad number of responses")
+}
+
+// Report is the result of Enable.
+type Report struct {
+	Signatures []*SignatureReport `json:"signatures"`
+	// Missing are the certificates of all signatures that still lack revocation information.
+	Missing []*Certificate `json:"missing"`
+}
+
+// SignatureReport lists the certificates of a signature with their revocation information.
+type SignatureReport struct {
+	Field string `json:"field"`
+	// VRIKey is the key of the VRI entry of the signature.
+	VRIKey       string         `json:"vri_key"`
+	Certificates []*Certificate `json:"certificates"`
+	// Missing is the number of certificates without revocation information.
+	Missing int `json:"missing"`
+}
+
+// Certificate roles.
+const (
+	RoleSigner    = "signer"
+	RoleTimestamp = "timestamp" // Timestamp authority of the signature timestamp.
+	RoleIssuer    = "issuer"
+	RoleRoot      = "root"
+)
+
+// Certificate is a certificate of a signature and the files of the revocation information that
+// cover it.
+type Certificate struct {
+	Subject string `json:"subject"`
+	Issuer  string `json:"issuer"`
+	Serial  string `json:"serial"`
+	Role    string `json:"role"`
+	// Status is the revocation status given by the newest OCSP response or CRL: good, revoked or
+	// unknown.
+	Status string   `json:"status"`
+	OCSP   []string `json:"ocsp,omitempty"`
+	CRL    []string `json:"crl,omitempty"`
+	// Missing tells why the revocation information is missing, empty if it isn't.
+	Missing string `json:"missing,omitempty"`
+}
+
+// Enable adds the validation data of the signatures of the document appended to by `appender`
+// from `store` to its DSS, with a VRI entry per signature. `extraCerts` are additional
+// certificates for building the chains. The report lists the certificates without revocation
+// information, which is not an error.
+func Enable(appender *model.PdfAppender, store *Store, extraCerts []*x509.Certificate) (*Report, error) {
+	reader := appender.Reader
+	dss := reader.DSS
+	if dss == nil {
+		dss = model.NewDSS()
+	}
+	if dss.VRI == nil {
+		dss.VRI = map[string]*model.VRI{}
+	}
+	streams := newStreamSet(dss)
+
+	report := &Report{Missing: []*Certificate{}}
+	missing := map[string]bool{}
+	for _, sf := range signatureFields(reader) {
+		sig := sf.V
+		contents := sig.Contents.Bytes()
+		h := sha1.Sum(contents)
+		sr := &SignatureReport{
+			Field:  sf.PartialName(),
+			VRIKey: strings.ToUpper(hex.EncodeToString(h[:])),
+		}
+
+		// The chains of the signer and of the timestamp authority.
+		var signers []*x509.Certificate
+		var roles []string
+		pool := append(append([]*x509.Certificate(nil), store.Certs...), extraCerts...)
+		if sc, err := verify.ParseSignatureCertificates(contents); err == nil {
+			signers, roles = append(signers, sc.Signer), append(roles, RoleSigner)
+			pool = append(pool, sc.Certs...)
+			if sc.TimestampSigner != nil {
+				signers, roles = append(signers, sc.TimestampSigner), append(roles, RoleTimestamp)
+				pool = append(pool, sc.TimestampCerts...)
+			}
+		} else if certs, err := sig.GetCerts(); err == nil && len(certs) > 0 {
+			// adbe.x509.rsa_sha1: the Cert entry starts with the signer's certificate.
+			signers, roles = append(signers, certs[0]), append(roles, RoleSigner)
+			pool = append(pool, certs...)
+		} else {
+			return nil, fmt.Errorf("signature %q: no signer certificate", sr.Field)
+		}
+
+		vri := &model.VRI{}
+		seen := map[string]bool{}
+		for i, signer := range signers {
+			chain := issuerChain(signer, pool)
+			for j, cert := range chain {
+				fp := fingerprint(cert.Raw)
+				if seen[fp] {
+					continue
+				}
+				seen[fp] = true
+				vri.Cert = appendStream(vri.Cert, streams.add(&dss.Certs, cert.Raw))
+
+				c := describe(cert, roles[i])
+				if j > 0 {
+					c.Role = RoleIssuer
+				}
+				var issuer *x509.Certificate
+				if j+1 < len(chain) {
+					issuer = chain[j+1]
+				}
+				switch {
+				case isSelfSigned(cert):
+					c.Role = RoleRoot
+					c.Status = "" // Trust anchors are not revoked.
+				case issuer == nil:
+					c.Missing = "issuer certificate not found"
+				default:
+					resp, crls := store.match(cert, issuer)
+					if resp != nil {
+						vri.OCSP = appendStream(vri.OCSP, streams.add(&dss.OCSPs, resp.der))
+						for _, rc := range resp.certs {
+							vri.Cert = appendStream(vri.Cert, streams.add(&dss.Certs, rc.Raw))
+						}
+						c.OCSP = append(c.OCSP, resp.path)
+						if r, err := ocsp.ParseResponseForCert(resp.der, cert, issuer); err == nil {
+							c.Status = ocspStatus(r.Status)
+						}
+					}
+					for _, crl := range crls {
+						vri.CRL = appendStream(vri.CRL, streams.add(&dss.CRLs, crl.der))
+						c.CRL = append(c.CRL, crl.path)
+						if resp == nil {
+							c.Status = crlStatus(crl.crl, cert)
+						}
+					}
+					if resp == nil && len(crls) == 0 {
+						c.Missing = "no OCSP response or CRL"
+					}
+				}
+				if c.Missing != "" {
+					sr.Missing++
+					if key := c.Issuer + "/" + c.Serial; !missing[key] {
+						missing[key] = true
+						report.Missing = append(report.Missing, c)
+					}
+				}
+				sr.Certificates = append(sr.Certificates, c)
+			}
+		}
+		dss.VRI[sr.VRIKey] = vri
+		report.Signatures = append(report.Signatures, sr)
+	}
+	if len(report.Signatures) == 0 {
+		return report, fmt.Errorf("no signatures")
+	}
+	appender.SetDSS(dss)
+	return report, nil
+}
+
+// match returns the newest OCSP response for `cert`, issued by `issuer`, and the newest CRL of
+// `issuer` of each distinct CRL scope.
+func (s *Store) match(cert, issuer *x509.Certificate) (*ocspFile, []*crlFile) {
+	var resp *ocspFile
+	var produced time.Time
+	for _, f := range s.ocsps {
+		r, err := ocsp.ParseResponseForCert(f.der, cert, issuer)
+		if err != nil || r.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			continue
+		}
+		if resp == nil || r.ProducedAt.After(produced) {
+			resp, produced = f, r.ProducedAt
+		}
+	}
+
+	var crl *crlFile
+	for _, f := range s.crls {
+		name, err := asn1.Marshal(f.crl.TBSCertList.Issuer)
+		if err != nil || !bytes.Equal(name, cert.RawIssuer) || issuer.CheckCRLSignature(f.crl) != nil {
+			continue
+		}
+		if crl == nil || f.crl.TBSCertList.ThisUpdate.After(crl.crl.TBSCertList.ThisUpdate) {
+			crl = f
+		}
+	}
+	if crl == nil {
+		return resp, nil
+	}
+	return resp, []*crlFile{crl}
+}
+
+// Revocation statuses of the report.
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+	StatusUnknown = "unknown"
+)
+
+// ocspStatus returns the report status of OCSP status `status`.
+func ocspStatus(status int) string {
+	switch status {
+	case ocsp.Good:
+		return StatusGood
+	case ocsp.Revoked:
+		return StatusRevoked
+	}
+	return StatusUnknown
+}
+
+// crlStatus returns the status of `cert` according to `crl`.
+func crlStatus(crl *pkix.CertificateList, cert *x509.Certificate) string {
+	for _, entry := range crl.TBSCertList.RevokedCertificates {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return StatusRevoked
+		}
+	}
+	return StatusGood
+}
+
+// describe returns the report certificate of `cert` with role `role`.
+func describe(cert *x509.Certificate, role string) *Certificate {
+	return &Certificate{
+		Subject: cert.Subject.String(),
+		Issuer:  cert.Issuer.String(),
+		Serial:  cert.SerialNumber.Text(16),
+		Role:    role,
+		Status:  StatusUnknown,
+	}
+}
+
+// signatureFields returns the signed signature fields of the document read by `reader`, sorted
+// by name for a stable report.
+func signatureFields(reader *model.PdfReader) []*model.PdfFieldSignature {
+	if reader.AcroForm == nil {
+		return nil
+	}
+	var fields []*model.PdfFieldSignature
+	for _, field := range reader.AcroForm.AllFields() {
+		if sf, ok := field.GetContext().(*model.PdfFieldSignature); ok && sf.V != nil && sf.V.Contents != nil {
+			fields = append(fields, sf)
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].PartialName() < fields[j].PartialName() })
+	return fields
+}
+
+// issuerChain returns the chain of `cert` built by issuer names and signatures from `pool`. It
+// ends with a self-signed certificate, or with the last certificate whose issuer was found.
+func issuerChain(cert *x509.Certificate, pool []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{cert}
+	for len(chain) <= len(pool) && !isSelfSigned(cert) {
+		var issuer *x509.Certificate
+		for _, candidate := range pool {
+			if bytes.Equal(candidate.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		cert = issuer
+	}
+	return chain
+}
+
+// isSelfSigned returns true if `cert` is a self-signed certificate.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// fingerprint returns the SHA-256 fingerprint of `der`.
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// streamSet creates the DSS streams, reusing those of the DSS with the same content.
+type streamSet map[string]*core.PdfObjectStream
+
+// newStreamSet returns the stream set of the streams of `dss`.
+func newStreamSet(dss *model.DSS) streamSet {
+	set := streamSet{}
+	for _, list := range [][]*core.PdfObjectStream{dss.Certs, dss.OCSPs, dss.CRLs} {
+		for _, stream := range list {
+			if der, err := core.DecodeStream(stream); err == nil {
+				set[fingerprint(der)] = stream
+			}
+		}
+	}
+	return set
+}
+
+// add returns the stream of `der`, which it appends to `list` if it is new.
+func (set streamSet) add(list *[]*core.PdfObjectStream, der []byte) *core.PdfObjectStream {
+	fp := fingerprint(der)
+	if stream, ok := set[fp]; ok {
+		return stream
+	}
+	stream, err := core.MakeStream(der, core.NewFlateEncoder())
+	if err != nil {
+		stream, _ = core.MakeStream(der, nil)
+	}
+	set[fp] = stream
+	*list = append(*list, stream)
+	return stream
+}
+
+// appendStream appends `stream` to `list` unless it contains it already.
+func appendStream(list []*core.PdfObjectStream, stream *core.PdfObjectStream) []*core.PdfObjectStream {
+	for _, s := range list {
+		if s == stream {
+			return list
+		}
+	}
+	return append(list, stream)
+}
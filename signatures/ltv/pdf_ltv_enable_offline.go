@@ -0,0 +1,103 @@
+/*
+ * This example showcases how to LTV enable the signatures in a signed PDF file without network
+ * access, from CRLs and OCSP responses downloaded beforehand. The validation data is added to
+ * the DSS in a second revision of the document, with a VRI entry per signature, and the
+ * certificates that still lack revocation information are reported.
+ *
+ * $ ./pdf_ltv_enable_offline <INPUT_PDF_PATH> <OUTPUT_PDF_PATH> <REVOCATION_DIR> [<EXTRA_CERTS.pem>]
+ *
+ * REVOCATION_DIR holds DER or PEM files: CRLs, OCSP responses and issuer certificates.
+ */
+
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/signatures/ltv/offline"
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+const usagef = "Usage: %s INPUT_PDF_PATH OUTPUT_PDF_PATH REVOCATION_DIR [EXTRA_CERTS]\n"
+
+func main() {
+	args := os.Args
+	if len(args) < 4 {
+		fmt.Printf(usagef, os.Args[0])
+		return
+	}
+	inputPath := args[1]
+	outputPath := args[2]
+	revocationDir := args[3]
+
+	// Load the extra certificates.
+	var extraCerts []*x509.Certificate
+	if len(args) > 4 {
+		certs, err := verify.LoadCertificates(args[4:]...)
+		if err != nil {
+			log.Fatalf("Fail: %v\n", err)
+		}
+		extraCerts = certs
+	}
+
+	// Load the pre-fetched revocation data.
+	store, err := offline.Load(revocationDir)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create reader.
+	file, err := os.Open(inputPath)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	defer file.Close()
+
+	reader, err := model.NewPdfReader(file)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create appender.
+	appender, err := model.NewPdfAppender(reader)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// LTV enable the signed file from the local data.
+	report, err := offline.Enable(appender, store, extraCerts)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Write output PDF file.
+	err = appender.WriteToFile(outputPath)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	for _, sr := range report.Signatures {
+		fmt.Printf("Signature %s (VRI %s): %d certificates, %d without revocation information\n",
+			sr.Field, sr.VRIKey, len(sr.Certificates), sr.Missing)
+	}
+	for _, c := range report.Missing {
+		fmt.Printf("Missing revocation information: %s (%s)\n", c.Subject, c.Missing)
+	}
+
+	log.Printf("PDF file successfully LTV enabled. Output path: %s\n", outputPath)
+}
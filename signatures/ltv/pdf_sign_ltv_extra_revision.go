@@ -10,6 +10,7 @@ package main
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -27,6 +28,8 @@ import (
 	"github.com/unidoc/unipdf/v3/core"
 	"github.com/unidoc/unipdf/v3/model"
 	"github.com/unidoc/unipdf/v3/model/sighandler"
+
+	"github.com/unidoc/unidoc-examples/signatures/pades"
 )
 
 func init() {
@@ -86,7 +89,7 @@ func main() {
 	}
 
 	// Sign and write file to buffer.
-	signedBytes, err := signFile(inputPath, priv.(*rsa.PrivateKey), cert)
+	signedBytes, err := signFile(inputPath, priv, cert)
 	if err != nil {
 		log.Fatal("Fail: %v\n", err)
 	}
@@ -100,7 +103,7 @@ func main() {
 	log.Printf("PDF file successfully signed. Output path: %s\n", outputPath)
 }
 
-func signFile(inputPath string, priv *rsa.PrivateKey, cert *x509.Certificate) ([]byte, error) {
+func signFile(inputPath string, priv interface{}, cert *x509.Certificate) ([]byte, error) {
 	// Create reader.
 	file, err := os.Open(inputPath)
 	if err != nil {
@@ -119,8 +122,17 @@ func signFile(inputPath string, priv *rsa.PrivateKey, cert *x509.Certificate) ([
 		return nil, err
 	}
 
-	// Create signature handler.
-	handler, err := sighandler.NewAdobePKCS7Detached(priv, cert)
+	// Create signature handler. The handler of unipdf supports RSA keys, the one of package pades
+	// ECDSA keys too.
+	var handler model.SignatureHandler
+	switch key := priv.(type) {
+	case *rsa.PrivateKey:
+		handler, err = sighandler.NewAdobePKCS7Detached(key, cert)
+	case crypto.Signer:
+		handler, err = pades.NewPKCS7Detached(key, cert, nil, pades.Options{})
+	default:
+		err = fmt.Errorf("unsupported private key type %T", priv)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,321 @@
+/*
+ * Package multisign implements a workflow for documents signed by several parties: the named,
+ * unsigned signature fields of all signers are placed first, from a JSON list of fields, and each
+ * field is then signed in its own incremental update, which preserves the earlier signatures.
+ *
+ *   fields, err := multisign.LoadFields("fields.json")
+ *   err = multisign.Prepare(appender, fields)
+ *   ... write the appender; later, for each signer ...
+ *   field, err := multisign.SignField(appender, "Buyer", signature, lines, opts)
+ *
+ * The fields JSON is a list of fields with a name, a 1-based page, a rectangle in points and an
+ * optional description of the signer, which is stored as the user name (TU) of the field:
+ *
+ *   [{"name": "Seller", "page": 1, "rect": [50, 50, 250, 110], "signer": "Seller (ACME Corp.)"},
+ *    {"name": "Buyer", "page": 1, "rect": [300, 50, 500, 110], "signer": "Buyer"}]
+ *
+ * Status lists the signature fields of a document, signed or not, with their signers.
+ *
+ * Used by pdftool prepare-sign, sign and sign-status and by signatures/pdf_sign_multiple.go.
+ */
+
+package multisign
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Field is an unsigned signature field to place.
+type Field struct {
+	Name string `json:"name"`
+	// Page is the 1-based page number of the field.
+	Page int `json:"page"`
+	// Rect is the rectangle of the field as [llx, lly, urx, ury] in points.
+	Rect []float64 `json:"rect"`
+	// Signer, if set, describes who is to sign the field.
+	Signer string `json:"signer,omitempty"`
+}
+
+// LoadFields reads the fields JSON file at `path`.
+func LoadFields(path string) ([]Field, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fields []Field
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fields, nil
+}
+
+// Prepare adds the unsigned signature fields `fields` to the document appended to by `appender`.
+// The field names must be new.
+func Prepare(appender *model.PdfAppender, fields []Field) error {
+	reader := appender.Reader
+	acroForm := reader.AcroForm
+	if acroForm == nil {
+		acroForm = model.NewPdfAcroForm()
+	}
+	used := map[string]bool{}
+	for _, field := range acroForm.AllFields() {
+		used[field.PartialName()] = true
+	}
+
+	all := []*model.PdfField{}
+	if acroForm.Fields != nil {
+		all = append(all, *acroForm.Fields...)
+	}
+	for _, f := range fields {
+		switch {
+		case f.Name == "":
+			return errors.New("signature field without name")
+		case used[f.Name]:
+			return fmt.Errorf("field %q exists already", f.Name)
+		case f.Page < 1 || f.Page > len(reader.PageList):
+			return fmt.Errorf("field %q: page %d out of bounds (document has %d pages)", f.Name,
+				f.Page, len(reader.PageList))
+		case len(f.Rect) != 4:
+			return fmt.Errorf("field %q: rect must be [llx, lly, urx, ury]", f.Name)
+		}
+		used[f.Name] = true
+
+		page := reader.PageList[f.Page-1]
+		field := model.NewPdfFieldSignature(nil)
+		field.T = core.MakeString(f.Name)
+		if f.Signer != "" {
+			field.TU = core.MakeString(f.Signer)
+		}
+		field.Rect = core.MakeArrayFromFloats(f.Rect)
+		field.F = core.MakeInteger(4) // Print.
+		field.P = page.ToPdfObject()
+		page.AddAnnotation(field.PdfAnnotationWidget.PdfAnnotation)
+		appender.UpdatePage(page)
+		all = append(all, field.PdfField)
+	}
+	acroForm.Fields = &all
+	reader.AcroForm = acroForm
+	appender.ReplaceAcroForm(acroForm)
+	return nil
+}
+
+// Find returns the signature field named `name` of the document read by `reader` and its page
+// number, or nil if the document has no field of that name.
+func Find(reader *model.PdfReader, name string) (*model.PdfFieldSignature, int, error) {
+	if reader.AcroForm != nil {
+		for _, field := range reader.AcroForm.AllFields() {
+			if field.PartialName() != name {
+				continue
+			}
+			sf, ok := field.GetContext().(*model.PdfFieldSignature)
+			if !ok {
+				return nil, 0, fmt.Errorf("field %q is not a signature field", name)
+			}
+			return sf, pageOf(reader, sf), nil
+		}
+	}
+	return nil, 0, nil
+}
+
+// CheckOrder returns an error if a signature field before the field named `name` in the form of
+// the document read by `reader` is unsigned, i.e. if the fields are not signed in order.
+func CheckOrder(reader *model.PdfReader, name string) error {
+	if reader.AcroForm == nil {
+		return nil
+	}
+	for _, field := range reader.AcroForm.AllFields() {
+		if field.PartialName() == name {
+			return nil
+		}
+		if sf, ok := field.GetContext().(*model.PdfFieldSignature); ok && sf.V == nil {
+			return fmt.Errorf("field %q must be signed before %q", field.PartialName(), name)
+		}
+	}
+	return nil
+}
+
+// SignField signs the unsigned signature field named `name` of the document appended to by
+// `appender` with `sig`, which must be initialized. The appearance is created with `lines` and
+// `opts` in the rectangle of the field. The field keeps its place in the form and on its page.
+func SignField(appender *model.PdfAppender, name string, sig *model.PdfSignature,
+	lines []*annotator.SignatureLine, opts *annotator.SignatureFieldOpts) (*model.PdfFieldSignature, error) {
+	reader := appender.Reader
+	field, _, err := Find(reader, name)
+	if err != nil {
+		return nil, err
+	}
+	if field == nil {
+		return nil, fmt.Errorf("no signature field %q", name)
+	}
+	if field.V != nil {
+		return nil, fmt.Errorf("field %q is signed already", name)
+	}
+	widget := widgetOf(field)
+	if widget == nil {
+		return nil, fmt.Errorf("field %q has no widget annotation", name)
+	}
+
+	// The appearance is generated for a new field and moved to the existing one.
+	rect, err := rectOf(widget)
+	if err != nil {
+		return nil, fmt.Errorf("field %q: %w", name, err)
+	}
+	fieldOpts := *opts
+	fieldOpts.Rect = []float64{rect.Llx, rect.Lly, rect.Urx, rect.Ury}
+	generated, err := annotator.NewSignatureField(sig, lines, &fieldOpts)
+	if err != nil {
+		return nil, err
+	}
+	widget.AP = generated.AP
+	field.V = sig
+
+	// A merged field and widget dictionary is written by the widget when the page is written.
+	// With the field as context, the widget writes the signature entries too, as for new fields.
+	if field.PdfAnnotationWidget == nil && widget.GetContainingPdfObject() == field.PdfField.GetContainingPdfObject() {
+		field.PdfAnnotationWidget = widget
+		widget.PdfAnnotation.SetContext(field)
+	}
+
+	reader.AcroForm.SigFlags = core.MakeInteger(3)
+	appender.ReplaceAcroForm(reader.AcroForm)
+	return field, nil
+}
+
+// FieldStatus is the status of a signature field.
+type FieldStatus struct {
+	Name string `json:"name"`
+	// Page is the 1-based page number of the field, 0 if it has no widget on a page.
+	Page   int       `json:"page,omitempty"`
+	Rect   []float64 `json:"rect,omitempty"`
+	Signer string    `json:"signer,omitempty"` // The user name (TU) of the field.
+	Signed bool      `json:"signed"`
+	// SignedBy is the Name of the signature, else the common name of the signer's certificate.
+	SignedBy    string     `json:"signed_by,omitempty"`
+	Certificate string     `json:"certificate,omitempty"` // Subject of the signer's certificate.
+	SigningTime *time.Time `json:"signing_time,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	Location    string     `json:"location,omitempty"`
+	SubFilter   string     `json:"sub_filter,omitempty"`
+}
+
+// Status returns the status of the signature fields of the document read by `reader`, in form
+// order.
+func Status(reader *model.PdfReader) []*FieldStatus {
+	if reader.AcroForm == nil {
+		return nil
+	}
+	var statuses []*FieldStatus
+	for _, field := range reader.AcroForm.AllFields() {
+		sf, ok := field.GetContext().(*model.PdfFieldSignature)
+		if !ok {
+			continue
+		}
+		status := &FieldStatus{Name: field.PartialName(), Page: pageOf(reader, sf)}
+		if field.TU != nil {
+			status.Signer = field.TU.Decoded()
+		}
+		if widget := widgetOf(sf); widget != nil {
+			if rect, err := rectOf(widget); err == nil {
+				status.Rect = []float64{rect.Llx, rect.Lly, rect.Urx, rect.Ury}
+			}
+		}
+		if sig := sf.V; sig != nil {
+			status.Signed = true
+			if sig.Name != nil {
+				status.SignedBy = sig.Name.Decoded()
+			}
+			if sig.M != nil {
+				if date, err := model.NewPdfDate(sig.M.Decoded()); err == nil {
+					t := date.ToGoTime()
+					status.SigningTime = &t
+				}
+			}
+			if sig.Reason != nil {
+				status.Reason = sig.Reason.Decoded()
+			}
+			if sig.Location != nil {
+				status.Location = sig.Location.Decoded()
+			}
+			if sig.SubFilter != nil {
+				status.SubFilter = sig.SubFilter.String()
+			}
+			if certs, err := sig.GetCerts(); err == nil {
+				if cert := leaf(certs); cert != nil {
+					status.Certificate = cert.Subject.String()
+					if status.SignedBy == "" {
+						status.SignedBy = cert.Subject.CommonName
+					}
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// widgetOf returns the widget annotation of signature field `field`.
+func widgetOf(field *model.PdfFieldSignature) *model.PdfAnnotationWidget {
+	if field.PdfAnnotationWidget != nil && field.PdfAnnotationWidget.Rect != nil {
+		return field.PdfAnnotationWidget
+	}
+	if len(field.Annotations) > 0 {
+		return field.Annotations[0]
+	}
+	return nil
+}
+
+// rectOf returns the rectangle of `widget`.
+func rectOf(widget *model.PdfAnnotationWidget) (*model.PdfRectangle, error) {
+	arr, ok := core.GetArray(widget.Rect)
+	if !ok {
+		return nil, errors.New("invalid widget rectangle")
+	}
+	return model.NewPdfRectangle(*arr)
+}
+
+// pageOf returns the number of the page with the widget of `field`, 0 if it is on no page.
+func pageOf(reader *model.PdfReader, field *model.PdfFieldSignature) int {
+	widget := widgetOf(field)
+	if widget == nil {
+		return 0
+	}
+	obj := widget.GetContainingPdfObject()
+	for i, page := range reader.PageList {
+		annots, err := page.GetAnnotations()
+		if err != nil {
+			continue
+		}
+		for _, annot := range annots {
+			if annot.GetContainingPdfObject() == obj {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// leaf returns the certificate of `certs` that issued none of the others.
+func leaf(certs []*x509.Certificate) *x509.Certificate {
+	for _, cert := range certs {
+		issuer := false
+		for _, other := range certs {
+			if other != cert && other.CheckSignatureFrom(cert) == nil {
+				issuer = true
+				break
+			}
+		}
+		if !issuer {
+			return cert
+		}
+	}
+	return nil
+}
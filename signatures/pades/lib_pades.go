@@ -0,0 +1,326 @@
+/*
+ * Package pades signs PDF files at the PAdES baseline levels (ETSI EN 319 142-1):
+ *  - B-B: an ETSI.CAdES.detached signature whose signed attributes include the signing
+ *    certificate (signing-certificate-v2);
+ *  - B-T: B-B with an RFC 3161 signature timestamp token in the unsigned attributes;
+ *  - B-LT: B-T followed by a revision that adds the certificates, OCSP responses and CRLs needed
+ *    to validate the signature and its timestamp to the DSS, with a VRI entry for the signature;
+ *  - B-LTA: B-LT followed by a revision with an ETSI.RFC3161 document timestamp.
+ *
+ * The signature revision is written by the caller with a handler of NewHandler, so that the
+ * signature field, its appearance and any certification are set up as for other signatures, and
+ * Extend appends the revisions of the higher levels:
+ *
+ *   handler, err := pades.NewHandler(key, cert, chain, opts)
+ *   signature := model.NewPdfSignature(handler)
+ *   ... initialize the signature, create its field, sign and write the appender to `signed` ...
+ *   data, err := pades.Extend(signed, chain, opts)
+ *
+ * Signing keys are any crypto.Signer with an RSA key, signing with RSA PKCS #1 v1.5 or, with
+ * Options.PSS, RSASSA-PSS, or an ECDSA key on P-256, P-384 or P-521. NewPKCS7Detached creates an
+ * adbe.pkcs7.detached handler with the same keys and digest algorithms for signatures that are not
+ * PAdES signatures.
+ *
+ * The timestamp authority is given by URL and all HTTP requests (timestamps, OCSP, CRLs and
+ * issuer certificates) use Options.HTTPClient. Options.OCSPURL and Options.CRLURL replace the
+ * OCSP responders and CRL distribution points named in the certificates, e.g. with local
+ * responders.
+ *
+ * Used by pdftool sign, signatures/pdf_sign_pades.go and the other signing examples.
+ */
+
+package pades
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Level is a PAdES baseline level.
+type Level int
+
+// PAdES baseline levels.
+const (
+	// BB is a basic signature.
+	BB Level = iota + 1
+	// BT adds a signature timestamp.
+	BT
+	// BLT adds the validation data of the signature to the DSS.
+	BLT
+	// BLTA adds a document timestamp that protects the validation data.
+	BLTA
+)
+
+var levelNames = map[Level]string{
+	BB:   "B-B",
+	BT:   "B-T",
+	BLT:  "B-LT",
+	BLTA: "B-LTA",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// ParseLevel parses a level given by name, e.g. B-LT. The case and the B- prefix are optional.
+func ParseLevel(s string) (Level, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	if !strings.HasPrefix(name, "B-") {
+		name = "B-" + name
+	}
+	for l, n := range levelNames {
+		if name == n {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid PAdES level %q: must be B-B, B-T, B-LT or B-LTA", s)
+}
+
+// ParseHash parses the name of a digest algorithm: SHA-1, SHA-256, SHA-384 or SHA-512. The case
+// and the dash are optional.
+func ParseHash(s string) (crypto.Hash, error) {
+	name := strings.Replace(strings.ToUpper(strings.TrimSpace(s)), "-", "", 1)
+	for hash := range digestOIDs {
+		if name == strings.Replace(hash.String(), "-", "", 1) {
+			return hash, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid digest algorithm %q: must be SHA-1, SHA-256, SHA-384 or SHA-512", s)
+}
+
+// Options configures the signing.
+type Options struct {
+	// Level is the target level, B-B if zero.
+	Level Level
+	// Hash is the digest algorithm, SHA-256 if zero.
+	Hash crypto.Hash
+	// PSS signs with RSASSA-PSS instead of RSA PKCS #1 v1.5. It requires an RSA key.
+	PSS bool
+	// TSAURL is the URL of the RFC 3161 timestamp authority, required from B-T on.
+	TSAURL string
+	// OCSPURL, if set, replaces the OCSP responders named in the certificates.
+	OCSPURL string
+	// CRLURL, if set, replaces the CRL distribution points named in the certificates.
+	CRLURL string
+	// HTTPClient makes the HTTP requests. By default a client with a 30 second timeout is used.
+	HTTPClient *http.Client
+}
+
+// level returns the target level of `opts`.
+func (opts Options) level() Level {
+	if opts.Level == 0 {
+		return BB
+	}
+	return opts.Level
+}
+
+// hash returns the digest algorithm of `opts`.
+func (opts Options) hash() crypto.Hash {
+	if opts.Hash == 0 {
+		return crypto.SHA256
+	}
+	return opts.Hash
+}
+
+// check returns an error if `opts` are not valid.
+func (opts Options) check() error {
+	if _, ok := levelNames[opts.level()]; !ok {
+		return fmt.Errorf("invalid level %d", int(opts.Level))
+	}
+	if _, err := digestOID(opts.hash()); err != nil {
+		return err
+	}
+	if opts.level() >= BT && opts.TSAURL == "" {
+		return fmt.Errorf("level %s requires a timestamp authority URL", opts.level())
+	}
+	for _, u := range []string{opts.TSAURL, opts.OCSPURL, opts.CRLURL} {
+		if u == "" {
+			continue
+		}
+		if _, err := url.Parse(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// client returns the HTTP client of `opts`, which sends all requests to `endpoint` if it is set.
+func (opts Options) client(endpoint string) *http.Client {
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if endpoint == "" {
+		return client
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return client
+	}
+	c := *client
+	c.Transport = &redirect{url: u, next: client.Transport}
+	return &c
+}
+
+// redirect is an HTTP transport that sends all requests to `url`.
+type redirect struct {
+	url  *url.URL
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *r.url
+	req = req.Clone(req.Context())
+	req.URL = &u
+	req.Host = u.Host
+	next := r.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// Extend appends the revisions that follow the signature revision at level `opts.Level` to the
+// PDF file `data`, whose last revision must add a signature of NewHandler: the DSS with the
+// validation data of the signatures of the document from B-LT on, and a document timestamp at
+// B-LTA. `chain` are the issuer certificates of the signer. At B-B and B-T `data` is returned
+// unchanged.
+func Extend(data []byte, chain []*x509.Certificate, opts Options) ([]byte, error) {
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+	if opts.level() < BLT {
+		return data, nil
+	}
+	data, err := addValidationData(data, chain, opts)
+	if err != nil {
+		return nil, fmt.Errorf("adding validation data: %w", err)
+	}
+	if opts.level() < BLTA {
+		return data, nil
+	}
+	if data, err = addDocumentTimestamp(data, opts); err != nil {
+		return nil, fmt.Errorf("adding document timestamp: %w", err)
+	}
+	return data, nil
+}
+
+// addValidationData appends a revision to PDF file `data` that adds the validation data of its
+// signatures and of their signature timestamps to the DSS. `chain` are extra certificates for
+// building the chains of the signers.
+func addValidationData(data []byte, chain []*x509.Certificate, opts Options) ([]byte, error) {
+	reader, err := model.NewPdfReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	appender, err := model.NewPdfAppender(reader)
+	if err != nil {
+		return nil, err
+	}
+	ltv, err := model.NewLTV(appender)
+	if err != nil {
+		return nil, err
+	}
+	ltv.CertClient.HTTPClient = opts.client("")
+	ltv.OCSPClient.HTTPClient = opts.client(opts.OCSPURL)
+	ltv.CRLClient.HTTPClient = opts.client(opts.CRLURL)
+
+	// The chains of the timestamp authorities are added to the global validation data.
+	for _, sig := range signatures(reader) {
+		if sig.Contents == nil {
+			continue
+		}
+		if certs := timestampCerts(sig.Contents.Bytes()); len(certs) > 0 {
+			if err := ltv.EnableChain(certs); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := ltv.EnableAll(chain); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := appender.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// addDocumentTimestamp appends a revision to PDF file `data` with a document timestamp of the
+// timestamp authority of `opts`.
+func addDocumentTimestamp(data []byte, opts Options) ([]byte, error) {
+	reader, err := model.NewPdfReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	appender, err := model.NewPdfAppender(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &docTimestamp{
+		tsa:  &tsaClient{url: opts.TSAURL, client: opts.client("")},
+		hash: opts.hash(),
+	}
+	signature := model.NewPdfSignature(handler)
+	if err := signature.Initialize(); err != nil {
+		return nil, err
+	}
+	field := model.NewPdfFieldSignature(signature)
+	field.T = core.MakeString(freeFieldName(reader, "DocumentTimestamp"))
+	field.Rect = core.MakeArray(core.MakeInteger(0), core.MakeInteger(0), core.MakeInteger(0),
+		core.MakeInteger(0))
+	if err := appender.Sign(1, field); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := appender.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// signatures returns the signatures of the document read by `reader`.
+func signatures(reader *model.PdfReader) []*model.PdfSignature {
+	if reader.AcroForm == nil {
+		return nil
+	}
+	var sigs []*model.PdfSignature
+	for _, field := range reader.AcroForm.AllFields() {
+		if sf, ok := field.GetContext().(*model.PdfFieldSignature); ok && sf.V != nil {
+			sigs = append(sigs, sf.V)
+		}
+	}
+	return sigs
+}
+
+// freeFieldName returns `name`, followed by a number if the document read by `reader` has a
+// field of that name already.
+func freeFieldName(reader *model.PdfReader, name string) string {
+	used := map[string]bool{}
+	if reader.AcroForm != nil {
+		for _, field := range reader.AcroForm.AllFields() {
+			used[field.PartialName()] = true
+		}
+	}
+	free := name
+	for i := 2; used[free]; i++ {
+		free = fmt.Sprintf("%s%d", name, i)
+	}
+	return free
+}
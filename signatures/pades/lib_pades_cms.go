@@ -0,0 +1,480 @@
+/*
+ * CAdES signature handler: detached CMS signed data whose signed attributes include the
+ * signing-certificate-v2 attribute and, from B-T on, whose signer has a signature timestamp token.
+ * The signature value is RSA PKCS #1 v1.5, RSASSA-PSS or ECDSA.
+ */
+
+package pades
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+// Object identifiers of CMS content types, attributes and algorithms.
+var (
+	oidData                     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttrContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidAttrTimestampToken       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidRSAEncryption            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSASSAPSS                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1                     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+)
+
+// ecdsaOIDs are the object identifiers of the ECDSA signature algorithms by digest algorithm.
+var ecdsaOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   {1, 2, 840, 10045, 4, 1},
+	crypto.SHA256: {1, 2, 840, 10045, 4, 3, 2},
+	crypto.SHA384: {1, 2, 840, 10045, 4, 3, 3},
+	crypto.SHA512: {1, 2, 840, 10045, 4, 3, 4},
+}
+
+// digestOIDs are the object identifiers of the supported digest algorithms.
+var digestOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   {1, 3, 14, 3, 2, 26},
+	crypto.SHA256: {2, 16, 840, 1, 101, 3, 4, 2, 1},
+	crypto.SHA384: {2, 16, 840, 1, 101, 3, 4, 2, 2},
+	crypto.SHA512: {2, 16, 840, 1, 101, 3, 4, 2, 3},
+}
+
+// digestOID returns the object identifier of digest algorithm `hash`.
+func digestOID(hash crypto.Hash) (asn1.ObjectIdentifier, error) {
+	oid, ok := digestOIDs[hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", hash)
+	}
+	return oid, nil
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+// signingCertificateV2 is the ESS signing-certificate-v2 attribute (RFC 5035). The hash algorithm
+// of the certificate IDs is SHA-256, the default, so it is omitted.
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+type essCertIDv2 struct {
+	CertHash     []byte
+	IssuerSerial issuerSerial
+}
+
+type issuerSerial struct {
+	Issuer asn1.RawValue // GeneralNames
+	Serial *big.Int
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type pssParameters struct {
+	Hash       pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF        pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+	SaltLength int                      `asn1:"explicit,tag:2"`
+}
+
+// handler is the ETSI.CAdES.detached (or adbe.pkcs7.detached) signature handler.
+type handler struct {
+	subFilter string
+	key       crypto.Signer
+	cert      *x509.Certificate
+	chain     []*x509.Certificate
+	hash      crypto.Hash
+	pss       bool
+	tsa       *tsaClient // nil below B-T.
+	size      int        // Size of the reserved signature contents.
+}
+
+// NewHandler returns an ETSI.CAdES.detached signature handler that signs with `key`, the RSA or
+// ECDSA private key of `cert`, and embeds `cert` and its issuer certificates `chain` in the
+// signatures. From B-T on the signatures get a signature timestamp of the timestamp authority of
+// `opts`.
+func NewHandler(key crypto.Signer, cert *x509.Certificate, chain []*x509.Certificate,
+	opts Options) (model.SignatureHandler, error) {
+	return newHandler("ETSI.CAdES.detached", key, cert, chain, opts)
+}
+
+// NewPKCS7Detached returns an adbe.pkcs7.detached signature handler that builds the signed data
+// of NewHandler. Unlike the handler of package sighandler, it supports ECDSA keys, RSASSA-PSS and
+// keys that are only available as a crypto.Signer.
+func NewPKCS7Detached(key crypto.Signer, cert *x509.Certificate, chain []*x509.Certificate,
+	opts Options) (model.SignatureHandler, error) {
+	return newHandler("adbe.pkcs7.detached", key, cert, chain, opts)
+}
+
+func newHandler(subFilter string, key crypto.Signer, cert *x509.Certificate,
+	chain []*x509.Certificate, opts Options) (*handler, error) {
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+	if key == nil || cert == nil {
+		return nil, errors.New("the signing key and certificate are required")
+	}
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return nil, fmt.Errorf("unsupported elliptic curve %s", pub.Curve.Params().Name)
+		}
+		if opts.PSS {
+			return nil, errors.New("RSASSA-PSS requires an RSA key")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+	h := &handler{subFilter: subFilter, key: key, cert: cert, chain: chain, hash: opts.hash(),
+		pss: opts.PSS}
+	if opts.level() >= BT {
+		h.tsa = &tsaClient{url: opts.TSAURL, client: opts.client("")}
+	}
+	return h, nil
+}
+
+// IsApplicable implements model.SignatureHandler.
+func (h *handler) IsApplicable(sig *model.PdfSignature) bool {
+	if sig == nil || sig.Filter == nil || sig.SubFilter == nil {
+		return false
+	}
+	return (*sig.Filter == "Adobe.PPKLite" || *sig.Filter == "Adobe.PPKMS") &&
+		string(*sig.SubFilter) == h.subFilter
+}
+
+// Validate implements model.SignatureHandler. The certificate chain of the signer is not
+// validated, see package verify.
+func (h *handler) Validate(sig *model.PdfSignature, digest model.Hasher) (model.SignatureValidationResult, error) {
+	result := model.SignatureValidationResult{IsSigned: sig.Contents != nil}
+	if sig.Name != nil {
+		result.Name = sig.Name.Decoded()
+	}
+	if sig.Reason != nil {
+		result.Reason = sig.Reason.Decoded()
+	}
+	if sig.Location != nil {
+		result.Location = sig.Location.Decoded()
+	}
+	if !result.IsSigned {
+		return result, nil
+	}
+	buf, ok := digest.(*bytes.Buffer)
+	if !ok {
+		return result, errors.New("unexpected digest type")
+	}
+	_, ts, err := verify.VerifyCMS(sig.Contents.Bytes(), buf.Bytes())
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result, nil
+	}
+	result.IsVerified = true
+	if ts != nil {
+		result.GeneralizedTime = ts.Time
+		result.Errors = append(result.Errors, ts.Errors...)
+	}
+	return result, nil
+}
+
+// InitSignature implements model.SignatureHandler. It reserves space for the signature contents.
+func (h *handler) InitSignature(sig *model.PdfSignature) error {
+	size := 4096
+	for _, cert := range append([]*x509.Certificate{h.cert}, h.chain...) {
+		size += len(cert.Raw)
+	}
+	if h.tsa != nil {
+		size += 8192 // Timestamp token with the certificates of the TSA.
+	}
+	handler := *h
+	handler.size = size
+	sig.Handler = &handler
+	sig.Filter = core.MakeName("Adobe.PPKLite")
+	sig.SubFilter = core.MakeName(h.subFilter)
+	sig.Contents = core.MakeHexString(string(make([]byte, size)))
+	return nil
+}
+
+// NewDigest implements model.SignatureHandler.
+func (h *handler) NewDigest(sig *model.PdfSignature) (model.Hasher, error) {
+	return bytes.NewBuffer(nil), nil
+}
+
+// Sign implements model.SignatureHandler.
+func (h *handler) Sign(sig *model.PdfSignature, digest model.Hasher) error {
+	buf, ok := digest.(*bytes.Buffer)
+	if !ok {
+		return errors.New("unexpected digest type")
+	}
+	data, err := h.signedData(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if len(data) > h.size {
+		return model.ErrSignNotEnoughSpace
+	}
+	contents := make([]byte, h.size)
+	copy(contents, data)
+	sig.Contents = core.MakeHexString(string(contents))
+	return nil
+}
+
+// signedData returns the DER encoded CMS signed data that signs `content`.
+func (h *handler) signedData(content []byte) ([]byte, error) {
+	oid, err := digestOID(h.hash)
+	if err != nil {
+		return nil, err
+	}
+	digestAlg := pkix.AlgorithmIdentifier{Algorithm: oid}
+	d := h.hash.New()
+	d.Write(content)
+
+	certHash := sha256.Sum256(h.cert.Raw)
+	generalNames, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4,
+		IsCompound: true, Bytes: h.cert.RawIssuer})
+	if err != nil {
+		return nil, err
+	}
+	signingCert := signingCertificateV2{Certs: []essCertIDv2{{
+		CertHash: certHash[:],
+		IssuerSerial: issuerSerial{
+			Issuer: asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: generalNames},
+			Serial: h.cert.SerialNumber,
+		},
+	}}}
+	attrs, err := marshalAttributes(
+		attributeValue{oidAttrContentType, oidData},
+		attributeValue{oidAttrMessageDigest, d.Sum(nil)},
+		attributeValue{oidAttrSigningCertificateV2, signingCert},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature is computed over the DER encoding of the signed attributes as a SET.
+	signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+	sigAlg, signerOpts, err := h.signatureAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	d = h.hash.New()
+	d.Write(signed)
+	signature, err := h.key.Sign(rand.Reader, d.Sum(nil), signerOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	si := signerInfo{
+		Version:            1,
+		SID:                issuerAndSerial{Issuer: asn1.RawValue{FullBytes: h.cert.RawIssuer}, Serial: h.cert.SerialNumber},
+		DigestAlgorithm:    digestAlg,
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+		SignatureAlgorithm: sigAlg,
+		Signature:          signature,
+	}
+	if h.tsa != nil {
+		token, err := h.tsa.token(signature, h.hash)
+		if err != nil {
+			return nil, fmt.Errorf("signature timestamp: %w", err)
+		}
+		unsigned, err := marshalAttributes(
+			attributeValue{oidAttrTimestampToken, asn1.RawValue{FullBytes: token}})
+		if err != nil {
+			return nil, err
+		}
+		si.UnsignedAttrs = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true,
+			Bytes: unsigned}
+	}
+
+	var certs []byte
+	for _, cert := range append([]*x509.Certificate{h.cert}, h.chain...) {
+		certs = append(certs, cert.Raw...)
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
+		EncapContentInfo: encapContentInfo{EContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      []signerInfo{si},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+// attributeValue is an attribute with a single value, to be marshaled.
+type attributeValue struct {
+	oid   asn1.ObjectIdentifier
+	value interface{}
+}
+
+// signatureAlgorithm returns the signature algorithm identifier of the signer info and the
+// options of the signing key.
+func (h *handler) signatureAlgorithm() (pkix.AlgorithmIdentifier, crypto.SignerOpts, error) {
+	switch h.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		oid, ok := ecdsaOIDs[h.hash]
+		if !ok {
+			return pkix.AlgorithmIdentifier{}, nil, fmt.Errorf("unsupported digest algorithm %s", h.hash)
+		}
+		return pkix.AlgorithmIdentifier{Algorithm: oid}, h.hash, nil
+	case *rsa.PublicKey:
+		if !h.pss {
+			return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+				h.hash, nil
+		}
+	default:
+		return pkix.AlgorithmIdentifier{}, nil, fmt.Errorf("unsupported key type %T", h.key.Public())
+	}
+
+	// RSASSA-PSS with MGF1 of the digest algorithm and a salt of the digest size.
+	oid, err := digestOID(h.hash)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	hashAlg := pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.NullRawValue}
+	mgfParams, err := asn1.Marshal(hashAlg)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	params, err := asn1.Marshal(pssParameters{
+		Hash:       hashAlg,
+		MGF:        pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgfParams}},
+		SaltLength: h.hash.Size(),
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidRSASSAPSS, Parameters: asn1.RawValue{FullBytes: params}},
+		&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h.hash}, nil
+}
+
+// marshalAttributes returns the DER encoded attributes `attrs` sorted as the elements of a SET OF,
+// without the SET header.
+func marshalAttributes(attrs ...attributeValue) ([]byte, error) {
+	var encoded [][]byte
+	for _, attr := range attrs {
+		v, err := asn1.Marshal(attr.value)
+		if err != nil {
+			return nil, err
+		}
+		der, err := asn1.Marshal(attribute{Type: attr.oid, Values: []asn1.RawValue{{FullBytes: v}}})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, der)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return bytes.Join(encoded, nil), nil
+}
+
+// timestampCerts returns the certificates of the signature timestamp tokens of CMS signed data
+// `contents`, nil if it has none or can't be parsed.
+func timestampCerts(contents []byte) []*x509.Certificate {
+	sd, err := parseSignedData(contents)
+	if err != nil {
+		return nil
+	}
+	var certs []*x509.Certificate
+	for _, si := range sd.SignerInfos {
+		rest := si.UnsignedAttrs.Bytes
+		for len(rest) > 0 {
+			var a attribute
+			if rest, err = asn1.Unmarshal(rest, &a); err != nil {
+				break
+			}
+			if !a.Type.Equal(oidAttrTimestampToken) || len(a.Values) == 0 {
+				continue
+			}
+			token, err := parseSignedData(a.Values[0].FullBytes)
+			if err != nil {
+				continue
+			}
+			if c, err := x509.ParseCertificates(token.Certificates.Bytes); err == nil {
+				certs = append(certs, c...)
+			}
+		}
+	}
+	return certs
+}
+
+// parseSignedData parses the DER encoded CMS content info `data`, which may be followed by
+// padding, and returns its signed data.
+func parseSignedData(data []byte) (*signedData, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(data, &ci); err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("content type %s is not signed data", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	return &sd, nil
+}
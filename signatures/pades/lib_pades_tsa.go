@@ -0,0 +1,189 @@
+/*
+ * RFC 3161 timestamps: the client of the timestamp authority and the ETSI.RFC3161 document
+ * timestamp handler.
+ */
+
+package pades
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional,default:false"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString asn1.RawValue  `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+// tsaClient requests timestamp tokens from a timestamp authority.
+type tsaClient struct {
+	url    string
+	client *http.Client
+}
+
+// token returns the DER encoded timestamp token of `data`, digested with `hash`, with the
+// certificates of the timestamp authority.
+func (c *tsaClient) token(data []byte, hash crypto.Hash) ([]byte, error) {
+	oid, err := digestOID(hash)
+	if err != nil {
+		return nil, err
+	}
+	d := hash.New()
+	d.Write(data)
+	imprint := messageImprint{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid},
+		HashedMessage: d.Sum(nil),
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := asn1.Marshal(timeStampReq{Version: 1, MessageImprint: imprint, Nonce: nonce, CertReq: true})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Post(c.url, "application/timestamp-query", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamp authority %s: %s", c.url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var tsr timeStampResp
+	if _, err := asn1.Unmarshal(body, &tsr); err != nil {
+		return nil, fmt.Errorf("invalid timestamp response: %w", err)
+	}
+	// Status 0 is granted, 1 granted with modifications.
+	if tsr.Status.Status > 1 || len(tsr.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("timestamp request rejected with status %d", tsr.Status.Status)
+	}
+	token := tsr.TimeStampToken.FullBytes
+
+	// Check that the token is the answer to the request.
+	sd, err := parseSignedData(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, errors.New("invalid timestamp token: the content is not a TSTInfo")
+	}
+	var content []byte
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &content); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %w", err)
+	}
+	info, err := verify.ParseTSTInfo(content)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, imprint.HashedMessage) {
+		return nil, errors.New("the timestamp token does not match the request")
+	}
+	// RFC 3161 requires the nonce of the request in the token.
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("the nonce of the timestamp token does not match the request")
+	}
+	return token, nil
+}
+
+// docTimestamp is the ETSI.RFC3161 document timestamp handler.
+type docTimestamp struct {
+	tsa  *tsaClient
+	hash crypto.Hash
+	size int // Size of the reserved signature contents.
+}
+
+// IsApplicable implements model.SignatureHandler.
+func (h *docTimestamp) IsApplicable(sig *model.PdfSignature) bool {
+	if sig == nil || sig.Filter == nil || sig.SubFilter == nil {
+		return false
+	}
+	return (*sig.Filter == "Adobe.PPKLite" || *sig.Filter == "Adobe.PPKMS") &&
+		*sig.SubFilter == "ETSI.RFC3161"
+}
+
+// Validate implements model.SignatureHandler. The certificate chain of the timestamp authority
+// is not validated, see package verify.
+func (h *docTimestamp) Validate(sig *model.PdfSignature, digest model.Hasher) (model.SignatureValidationResult, error) {
+	result := model.SignatureValidationResult{IsSigned: sig.Contents != nil}
+	if !result.IsSigned {
+		return result, nil
+	}
+	buf, ok := digest.(*bytes.Buffer)
+	if !ok {
+		return result, errors.New("unexpected digest type")
+	}
+	ts := verify.VerifyTimestamp(sig.Contents.Bytes(), buf.Bytes())
+	result.IsVerified = ts.Valid
+	result.GeneralizedTime = ts.Time
+	result.Errors = ts.Errors
+	return result, nil
+}
+
+// InitSignature implements model.SignatureHandler. It reserves space for the timestamp token.
+func (h *docTimestamp) InitSignature(sig *model.PdfSignature) error {
+	handler := *h
+	handler.size = 12288
+	sig.Handler = &handler
+	sig.Type = core.MakeName("DocTimeStamp")
+	sig.Filter = core.MakeName("Adobe.PPKLite")
+	sig.SubFilter = core.MakeName("ETSI.RFC3161")
+	sig.Contents = core.MakeHexString(string(make([]byte, handler.size)))
+	return nil
+}
+
+// NewDigest implements model.SignatureHandler.
+func (h *docTimestamp) NewDigest(sig *model.PdfSignature) (model.Hasher, error) {
+	return bytes.NewBuffer(nil), nil
+}
+
+// Sign implements model.SignatureHandler.
+func (h *docTimestamp) Sign(sig *model.PdfSignature, digest model.Hasher) error {
+	buf, ok := digest.(*bytes.Buffer)
+	if !ok {
+		return errors.New("unexpected digest type")
+	}
+	token, err := h.tsa.token(buf.Bytes(), h.hash)
+	if err != nil {
+		return err
+	}
+	if len(token) > h.size {
+		return model.ErrSignNotEnoughSpace
+	}
+	contents := make([]byte, h.size)
+	copy(contents, token)
+	sig.Contents = core.MakeHexString(string(contents))
+	return nil
+}
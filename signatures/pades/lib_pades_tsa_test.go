@@ -0,0 +1,129 @@
+package pades
+
+import (
+	"crypto"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+// testTSTInfo is a TSTInfo to marshal. Zero optional fields are left out.
+type testTSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time       `asn1:"generalized"`
+	Accuracy       verify.Accuracy `asn1:"optional"`
+	Nonce          *big.Int        `asn1:"optional"`
+}
+
+// testTSA returns a timestamp authority that answers with an unsigned token of the TSTInfo that
+// `info` makes of the request.
+func testTSA(t *testing.T, info func(req timeStampReq) testTSTInfo) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var req timeStampReq
+		if _, err := asn1.Unmarshal(body, &req); err != nil {
+			t.Fatal(err)
+		}
+		content, err := asn1.Marshal(info(req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		eContent, err := asn1.Marshal(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sd, err := asn1.Marshal(signedData{
+			Version: 3,
+			EncapContentInfo: encapContentInfo{
+				EContentType: oidTSTInfo,
+				EContent:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: eContent},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := asn1.Marshal(contentInfo{
+			ContentType: oidSignedData,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := asn1.Marshal(timeStampResp{TimeStampToken: asn1.RawValue{FullBytes: token}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(resp)
+	}))
+}
+
+func TestTSAToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		accuracy verify.Accuracy
+		nonce    func(req *big.Int) *big.Int
+		ok       bool
+	}{
+		{
+			name:     "accuracy and nonce",
+			accuracy: verify.Accuracy{Seconds: 1, Millis: 500},
+			nonce:    func(req *big.Int) *big.Int { return req },
+			ok:       true,
+		},
+		{
+			name:  "nonce only",
+			nonce: func(req *big.Int) *big.Int { return req },
+			ok:    true,
+		},
+		{
+			name:     "accuracy only",
+			accuracy: verify.Accuracy{Micros: 10},
+			nonce:    func(req *big.Int) *big.Int { return nil },
+		},
+		{
+			name:  "neither",
+			nonce: func(req *big.Int) *big.Int { return nil },
+		},
+		{
+			name:  "other nonce",
+			nonce: func(req *big.Int) *big.Int { return new(big.Int).Add(req, big.NewInt(1)) },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tsa := testTSA(t, func(req timeStampReq) testTSTInfo {
+				return testTSTInfo{
+					Version:        1,
+					Policy:         asn1.ObjectIdentifier{1, 2, 3},
+					MessageImprint: req.MessageImprint,
+					SerialNumber:   big.NewInt(1),
+					GenTime:        time.Now().UTC().Truncate(time.Second),
+					Accuracy:       test.accuracy,
+					Nonce:          test.nonce(req.Nonce),
+				}
+			})
+			defer tsa.Close()
+
+			c := &tsaClient{url: tsa.URL, client: tsa.Client()}
+			_, err := c.token([]byte("signature"), crypto.SHA256)
+			if test.ok && err != nil {
+				t.Fatalf("token failed: %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Fatal("token succeeded, expected an error")
+			}
+		})
+	}
+}
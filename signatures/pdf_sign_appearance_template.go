@@ -0,0 +1,146 @@
+/*
+ * This example showcases how to digitally sign a PDF file with a signature appearance designed
+ * by a YAML or JSON template, such as signature_appearance.yaml, so that the look of the
+ * signature can be changed without recompiling. The template sets the text lines with
+ * placeholders like {{signer.CN}} and {{date}}, the font, colors, border and images.
+ *
+ * $ ./pdf_sign_appearance_template <FILE.p12> <PASSWORD> <TEMPLATE> <INPUT_PDF_PATH> <OUTPUT_PDF_PATH>
+ */
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+	"github.com/unidoc/unipdf/v3/model/sighandler"
+
+	"github.com/unidoc/unidoc-examples/signatures/appearance"
+	"github.com/unidoc/unidoc-examples/signatures/pades"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+const usagef = "Usage: %s P12_FILE PASSWORD TEMPLATE INPUT_PDF_PATH OUTPUT_PDF_PATH\n"
+
+func main() {
+	args := os.Args
+	if len(args) < 6 {
+		fmt.Printf(usagef, os.Args[0])
+		return
+	}
+	p12Path := args[1]
+	password := args[2]
+	templatePath := args[3]
+	inputPath := args[4]
+	outputPath := args[5]
+
+	// Load the appearance template first, so that errors in it are reported before signing.
+	template, err := appearance.Load(templatePath)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Get private key and X509 certificate from the P12 file.
+	pfxData, err := ioutil.ReadFile(p12Path)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	priv, cert, err := pkcs12.Decode(pfxData, password)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create reader and appender.
+	file, err := os.Open(inputPath)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	defer file.Close()
+
+	reader, err := model.NewPdfReader(file)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	appender, err := model.NewPdfAppender(reader)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create signature handler.
+	var handler model.SignatureHandler
+	switch key := priv.(type) {
+	case *rsa.PrivateKey:
+		handler, err = sighandler.NewAdobePKCS7Detached(key, cert)
+	case crypto.Signer:
+		handler, err = pades.NewPKCS7Detached(key, cert, nil, pades.Options{})
+	default:
+		err = fmt.Errorf("unsupported private key type %T", priv)
+	}
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create signature.
+	now := time.Now()
+	signature := model.NewPdfSignature(handler)
+	signature.SetName(cert.Subject.CommonName)
+	signature.SetReason("Approval")
+	signature.SetLocation("Head office")
+	signature.SetDate(now, "")
+	if err := signature.Initialize(); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Render the template with the values of its placeholders.
+	lines, opts, err := template.Render(appearance.Values{
+		Signer:   cert,
+		Time:     now,
+		Name:     cert.Subject.CommonName,
+		Reason:   "Approval",
+		Location: "Head office",
+		Field:    "Signature",
+	})
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	if opts.Rect == nil {
+		// The template sets no rectangle.
+		opts.Rect = []float64{10, 25, 210, 85}
+	}
+
+	// Create signature field and appearance.
+	field, err := annotator.NewSignatureField(signature, lines, opts)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	field.T = core.MakeString("Signature")
+
+	if err = appender.Sign(1, field); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Write output PDF file.
+	if err = appender.WriteToFile(outputPath); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	log.Printf("PDF file successfully signed. Output path: %s\n", outputPath)
+}
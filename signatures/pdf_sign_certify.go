@@ -0,0 +1,188 @@
+/*
+ * This example showcases how to certify a PDF file with a DocMDP certification signature, which
+ * permits no changes (1), form filling and signing (2), or also annotations (3) afterwards, and
+ * how to lock form fields with FieldMDP once the signature field is signed. A generated
+ * private/public key pair is used. The signed output is checked against the permissions of the
+ * signatures the input already has.
+ *
+ * $ ./pdf_sign_certify <INPUT_PDF_PATH> <OUTPUT_PDF_PATH> <PERMISSION> [LOCKED_FIELD]...
+ */
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+	"github.com/unidoc/unipdf/v3/model/sighandler"
+
+	"github.com/unidoc/unidoc-examples/signatures/certify"
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+var now = time.Now()
+
+const usagef = "Usage: %s INPUT_PDF_PATH OUTPUT_PDF_PATH PERMISSION [LOCKED_FIELD]...\n"
+
+func main() {
+	args := os.Args
+	if len(args) < 4 {
+		fmt.Printf(usagef, os.Args[0])
+		return
+	}
+	inputPath := args[1]
+	outputPath := args[2]
+	lockedFields := args[4:]
+
+	permission, err := certify.ParsePermission(args[3])
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Generate key pair.
+	priv, cert, err := generateKeys()
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Add the Perms dictionary that references the certification signature to the catalog.
+	original, err := ioutil.ReadFile(inputPath)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	input, err := certify.Prepare(original)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create reader and appender.
+	reader, err := model.NewPdfReader(bytes.NewReader(input))
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	appender, err := model.NewPdfAppender(reader)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create signature handler.
+	handler, err := sighandler.NewAdobePKCS7Detached(priv, cert)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create the certification signature.
+	signature := model.NewPdfSignature(handler)
+	signature.SetName("Test Certified PDF")
+	signature.SetReason(fmt.Sprintf("Certified, permitted changes: %s", permission))
+	signature.SetDate(now, "")
+
+	if err := signature.Initialize(); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	if err := certify.Certify(appender, signature, permission); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create signature field and appearance.
+	opts := annotator.NewSignatureFieldOpts()
+	opts.FontSize = 10
+	opts.Rect = []float64{10, 25, 75, 60}
+
+	field, err := annotator.NewSignatureField(
+		signature,
+		[]*annotator.SignatureLine{
+			annotator.NewSignatureLine("Name", "John Doe"),
+			annotator.NewSignatureLine("Date", now.Format("2006.01.02")),
+			annotator.NewSignatureLine("Reason", "Certification"),
+		},
+		opts,
+	)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	field.T = core.MakeString("Certification")
+
+	// Lock the given form fields once the field is signed.
+	if len(lockedFields) > 0 {
+		lock := verify.FieldLock{Action: "Include", Fields: lockedFields}
+		if err := certify.LockFields(field, lock); err != nil {
+			log.Fatalf("Fail: %v\n", err)
+		}
+	}
+
+	if err = appender.Sign(1, field); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Write the output, if the signatures of the input permit it.
+	var buf bytes.Buffer
+	if err := appender.Write(&buf); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	if err := certify.Check(original, buf.Bytes(), ""); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	if err := ioutil.WriteFile(outputPath, buf.Bytes(), 0644); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	log.Printf("PDF file successfully certified. Output path: %s\n", outputPath)
+}
+
+func generateKeys() (*rsa.PrivateKey, *x509.Certificate, error) {
+	// Generate private key.
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Initialize X509 certificate template.
+	template := x509.Certificate{
+		SerialNumber: new(big.Int),
+		Subject: pkix.Name{
+			CommonName:   "any",
+			Organization: []string{"Test Company"},
+		},
+		NotBefore:          now.Add(-time.Hour).UTC(),
+		NotAfter:           now.Add(time.Hour * 24 * 365).UTC(),
+		PublicKeyAlgorithm: x509.RSA,
+		KeyUsage: x509.KeyUsageKeyEncipherment |
+			x509.KeyUsageDigitalSignature |
+			x509.KeyUsageDataEncipherment,
+	}
+
+	// Generate X509 certificate.
+	certData, err := x509.CreateCertificate(rand.Reader, &template, &template, priv.Public(), priv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(certData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return priv, cert, nil
+}
@@ -1,12 +1,16 @@
 /*
  * This example showcases how to digitally sign a PDF file using a generated
- * private/public key pair.
+ * private/public key pair. The key type is rsa (default), rsa-pss, ecdsa-p256
+ * or ecdsa-p384.
  *
- * $ ./pdf_sign_generate_keys <INPUT_PDF_PATH> <OUTPUT_PDF_PATH>
+ * $ ./pdf_sign_generate_keys <INPUT_PDF_PATH> <OUTPUT_PDF_PATH> [KEY_TYPE]
  */
 package main
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -22,6 +26,8 @@ import (
 	"github.com/unidoc/unipdf/v3/core"
 	"github.com/unidoc/unipdf/v3/model"
 	"github.com/unidoc/unipdf/v3/model/sighandler"
+
+	"github.com/unidoc/unidoc-examples/signatures/pades"
 )
 
 func init() {
@@ -35,7 +41,7 @@ func init() {
 
 var now = time.Now()
 
-const usagef = "Usage: %s INPUT_PDF_PATH OUTPUT_PDF_PATH\n"
+const usagef = "Usage: %s INPUT_PDF_PATH OUTPUT_PDF_PATH [rsa|rsa-pss|ecdsa-p256|ecdsa-p384]\n"
 
 func main() {
 	args := os.Args
@@ -45,9 +51,13 @@ func main() {
 	}
 	inputPath := args[1]
 	outputPath := args[2]
+	keyType := "rsa"
+	if len(args) > 3 {
+		keyType = args[3]
+	}
 
 	// Generate key pair.
-	priv, cert, err := generateKeys()
+	priv, cert, err := generateKeys(keyType)
 	if err != nil {
 		log.Fatal("Fail: %v\n", err)
 	}
@@ -70,8 +80,17 @@ func main() {
 		log.Fatal("Fail: %v\n", err)
 	}
 
-	// Create signature handler.
-	handler, err := sighandler.NewAdobePKCS7Detached(priv, cert)
+	// Create signature handler. RSA PKCS #1 v1.5 signatures are made by the handler of unipdf,
+	// RSASSA-PSS and ECDSA signatures by the one of package pades.
+	var handler model.SignatureHandler
+	switch keyType {
+	case "rsa":
+		handler, err = sighandler.NewAdobePKCS7Detached(priv.(*rsa.PrivateKey), cert)
+	case "ecdsa-p384":
+		handler, err = pades.NewPKCS7Detached(priv, cert, nil, pades.Options{Hash: crypto.SHA384})
+	default:
+		handler, err = pades.NewPKCS7Detached(priv, cert, nil, pades.Options{PSS: keyType == "rsa-pss"})
+	}
 	if err != nil {
 		log.Fatal("Fail: %v\n", err)
 	}
@@ -97,6 +116,7 @@ func main() {
 			annotator.NewSignatureLine("Name", "John Doe"),
 			annotator.NewSignatureLine("Date", "2019.16.04"),
 			annotator.NewSignatureLine("Reason", "External signature test"),
+			annotator.NewSignatureLine("Key", keyType),
 		},
 		opts,
 	)
@@ -115,9 +135,23 @@ func main() {
 	log.Printf("PDF file successfully signed. Output path: %s\n", outputPath)
 }
 
-func generateKeys() (*rsa.PrivateKey, *x509.Certificate, error) {
+func generateKeys(keyType string) (crypto.Signer, *x509.Certificate, error) {
 	// Generate private key.
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	var priv crypto.Signer
+	var err error
+	algorithm := x509.RSA
+	switch keyType {
+	case "rsa", "rsa-pss":
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ecdsa-p256":
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		algorithm = x509.ECDSA
+	case "ecdsa-p384":
+		priv, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		algorithm = x509.ECDSA
+	default:
+		err = fmt.Errorf("unsupported key type %q", keyType)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -131,10 +165,11 @@ func generateKeys() (*rsa.PrivateKey, *x509.Certificate, error) {
 		},
 		NotBefore:          now.Add(-time.Hour).UTC(),
 		NotAfter:           now.Add(time.Hour * 24 * 365).UTC(),
-		PublicKeyAlgorithm: x509.RSA,
-		KeyUsage: x509.KeyUsageKeyEncipherment |
-			x509.KeyUsageDigitalSignature |
-			x509.KeyUsageDataEncipherment,
+		PublicKeyAlgorithm: algorithm,
+		KeyUsage:           x509.KeyUsageDigitalSignature,
+	}
+	if algorithm == x509.RSA {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment
 	}
 
 	// Generate X509 certificate.
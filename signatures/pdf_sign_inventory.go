@@ -0,0 +1,89 @@
+/*
+ * This example showcases how to take the inventory of the signatures of a corpus of PDF files for
+ * compliance audits: for each signature field, the signer subject and issuer, algorithm, signing
+ * time, timestamp, LTV status, coverage of the whole document and validity. The inventory is
+ * written as CSV (and optionally JSON) and summarized by attribute, by signature and by file.
+ *
+ * $ ./pdf_sign_inventory [-o inventory.csv] [-json inventory.json] [-trust roots.pem] <INPUT_PDF_OR_DIR>...
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/unidoc/unipdf/v3/common/license"
+
+	"github.com/unidoc/unidoc-examples/signatures/inventory"
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+const usagef = "Usage: %s [-o CSV_PATH] [-json JSON_PATH] [-trust TRUSTED_CERT_PATH] INPUT_PDF_OR_DIR...\n"
+
+func main() {
+	var csvPath, jsonPath, trustPath string
+	flag.StringVar(&csvPath, "o", "inventory.csv", "CSV inventory file.")
+	flag.StringVar(&jsonPath, "json", "", "JSON inventory file with the summary.")
+	flag.StringVar(&trustPath, "trust", "", "Trusted root certificate file or directory.")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 1 {
+		fmt.Printf(usagef, os.Args[0])
+		flag.PrintDefaults()
+		return
+	}
+
+	// Load the trust anchors: PEM or DER certificate files, or directories of them.
+	opts := inventory.Options{
+		Progress: func(done, total int, path string, err error) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%4d of %d %q ERROR: %v\n", done, total, path, err)
+			}
+		},
+	}
+	if trustPath != "" {
+		roots, err := verify.LoadCertificates(trustPath)
+		if err != nil {
+			log.Fatalf("Fail: %v\n", err)
+		}
+		opts.Verify.Roots = roots
+	}
+
+	// Verify the files concurrently and collect their signatures.
+	inv, err := inventory.Scan(args, opts)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	f, err := os.Create(csvPath)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	defer f.Close()
+	if err := inv.WriteCSV(f); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	if jsonPath != "" {
+		jf, err := os.Create(jsonPath)
+		if err != nil {
+			log.Fatalf("Fail: %v\n", err)
+		}
+		defer jf.Close()
+		if err := inv.WriteJSON(jf); err != nil {
+			log.Fatalf("Fail: %v\n", err)
+		}
+	}
+	inv.Summarize().Print(os.Stdout)
+}
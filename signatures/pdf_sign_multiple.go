@@ -0,0 +1,181 @@
+/*
+ * This example showcases a workflow for several signers: the unsigned signature fields of all
+ * signers are placed first, from a JSON list of fields, and each field is then signed in order in
+ * its own incremental update, which preserves the earlier signatures. The signers use generated
+ * keys, with the signer of the field as common name.
+ *
+ * The fields JSON is a list such as:
+ *   [{"name": "Seller", "page": 1, "rect": [50, 50, 250, 110], "signer": "Seller"},
+ *    {"name": "Buyer", "page": 1, "rect": [300, 50, 500, 110], "signer": "Buyer"}]
+ *
+ * $ ./pdf_sign_multiple <FIELDS_JSON> <INPUT_PDF_PATH> <OUTPUT_PDF_PATH>
+ */
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/model"
+	"github.com/unidoc/unipdf/v3/model/sighandler"
+
+	"github.com/unidoc/unidoc-examples/signatures/multisign"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+const usagef = "Usage: %s FIELDS_JSON INPUT_PDF_PATH OUTPUT_PDF_PATH\n"
+
+func main() {
+	args := os.Args
+	if len(args) < 4 {
+		fmt.Printf(usagef, os.Args[0])
+		return
+	}
+	fieldsPath := args[1]
+	inputPath := args[2]
+	outputPath := args[3]
+
+	fields, err := multisign.LoadFields(fieldsPath)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	data, err := ioutil.ReadFile(inputPath)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Place the unsigned signature fields.
+	data, err = update(data, func(appender *model.PdfAppender) error {
+		return multisign.Prepare(appender, fields)
+	})
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Sign each field in order, in its own revision.
+	for _, f := range fields {
+		data, err = update(data, func(appender *model.PdfAppender) error {
+			return signField(appender, f)
+		})
+		if err != nil {
+			log.Fatalf("Fail: signing %s: %v\n", f.Name, err)
+		}
+	}
+
+	if err := ioutil.WriteFile(outputPath, data, 0644); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Print the status of the signature fields.
+	reader, err := model.NewPdfReader(bytes.NewReader(data))
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	for _, status := range multisign.Status(reader) {
+		fmt.Printf("%s: signed=%t by %s\n", status.Name, status.Signed, status.SignedBy)
+	}
+
+	log.Printf("PDF file successfully signed. Output path: %s\n", outputPath)
+}
+
+// update appends a revision to PDF file `data` with the changes made by `change`.
+func update(data []byte, change func(appender *model.PdfAppender) error) ([]byte, error) {
+	reader, err := model.NewPdfReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	appender, err := model.NewPdfAppender(reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := change(appender); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := appender.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// signField signs the prepared field `f` with a generated key of its signer.
+func signField(appender *model.PdfAppender, f multisign.Field) error {
+	if err := multisign.CheckOrder(appender.Reader, f.Name); err != nil {
+		return err
+	}
+	name := f.Signer
+	if name == "" {
+		name = f.Name
+	}
+	priv, cert, err := generateKeys(name)
+	if err != nil {
+		return err
+	}
+	handler, err := sighandler.NewAdobePKCS7Detached(priv, cert)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	signature := model.NewPdfSignature(handler)
+	signature.SetName(name)
+	signature.SetReason("Signed as " + f.Name)
+	signature.SetDate(now, "")
+	if err := signature.Initialize(); err != nil {
+		return err
+	}
+
+	opts := annotator.NewSignatureFieldOpts()
+	opts.FontSize = 8
+	lines := []*annotator.SignatureLine{
+		annotator.NewSignatureLine("Signed by", name),
+		annotator.NewSignatureLine("Date", now.Format("2006.01.02 15:04:05")),
+	}
+	_, err = multisign.SignField(appender, f.Name, signature, lines, opts)
+	return err
+}
+
+// generateKeys returns an RSA key and a self-signed certificate with common name `name`.
+func generateKeys(name string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"Test Company"}},
+		NotBefore:    now.Add(-time.Hour).UTC(),
+		NotAfter:     now.Add(time.Hour * 24 * 365).UTC(),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certData, err := x509.CreateCertificate(rand.Reader, &template, &template, priv.Public(), priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(certData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, cert, nil
+}
@@ -0,0 +1,147 @@
+/*
+ * This example showcases how to sign a PDF file at a PAdES baseline level (B-B, B-T, B-LT or
+ * B-LTA) using a PKCS12 (.p12/.pfx) file: an ETSI.CAdES.detached signature, with a signature
+ * timestamp from B-T on, followed by a revision with the validation data of the signature in the
+ * DSS from B-LT on and by a document timestamp at B-LTA.
+ *
+ * $ ./pdf_sign_pades <FILE.p12> <P12_PASS> <INPUT_PDF_PATH> <OUTPUT_PDF_PATH> <LEVEL> [TSA_URL]
+ */
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/signatures/pades"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+const usagef = "Usage: %s P12_FILE PASSWORD INPUT_PDF_PATH OUTPUT_PDF_PATH LEVEL [TSA_URL]\n"
+
+func main() {
+	args := os.Args
+	if len(args) < 6 {
+		fmt.Printf(usagef, os.Args[0])
+		return
+	}
+	p12Path := args[1]
+	password := args[2]
+	inputPath := args[3]
+	outputPath := args[4]
+
+	level, err := pades.ParseLevel(args[5])
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	opts := pades.Options{Level: level, TSAURL: "https://freetsa.org/tsr"}
+	if len(args) > 6 {
+		opts.TSAURL = args[6]
+	}
+
+	// Load private key and X509 certificate from the PKCS12 file.
+	pfxData, err := ioutil.ReadFile(p12Path)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	priv, cert, err := pkcs12.Decode(pfxData, password)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create reader and appender.
+	file, err := os.Open(inputPath)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	defer file.Close()
+
+	reader, err := model.NewPdfReader(file)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	appender, err := model.NewPdfAppender(reader)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create the CAdES signature handler, which adds the signature timestamp from B-T on.
+	key, ok := priv.(crypto.Signer)
+	if !ok {
+		log.Fatalf("Fail: unsupported private key type %T\n", priv)
+	}
+	handler, err := pades.NewHandler(key, cert, nil, opts)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create signature.
+	signature := model.NewPdfSignature(handler)
+	signature.SetName("Test PAdES Signature")
+	signature.SetReason(fmt.Sprintf("PAdES %s", level))
+	signature.SetDate(time.Now(), "")
+
+	if err := signature.Initialize(); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create signature field and appearance.
+	fieldOpts := annotator.NewSignatureFieldOpts()
+	fieldOpts.FontSize = 10
+	fieldOpts.Rect = []float64{10, 25, 75, 60}
+
+	field, err := annotator.NewSignatureField(
+		signature,
+		[]*annotator.SignatureLine{
+			annotator.NewSignatureLine("Name", cert.Subject.CommonName),
+			annotator.NewSignatureLine("Date", time.Now().Format("2006.01.02")),
+			annotator.NewSignatureLine("Level", level.String()),
+		},
+		fieldOpts,
+	)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	field.T = core.MakeString("PAdES Signature")
+
+	if err = appender.Sign(1, field); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Write the signature revision to a buffer.
+	var buf bytes.Buffer
+	if err = appender.Write(&buf); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Append the validation data (B-LT) and document timestamp (B-LTA) revisions.
+	signed, err := pades.Extend(buf.Bytes(), nil, opts)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	if err := ioutil.WriteFile(outputPath, signed, 0644); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	log.Printf("PDF file successfully signed at level %s. Output path: %s\n", level, outputPath)
+}
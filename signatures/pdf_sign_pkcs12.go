@@ -7,6 +7,7 @@
 package main
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"fmt"
 	"io/ioutil"
@@ -21,6 +22,8 @@ import (
 	"github.com/unidoc/unipdf/v3/core"
 	"github.com/unidoc/unipdf/v3/model"
 	"github.com/unidoc/unipdf/v3/model/sighandler"
+
+	"github.com/unidoc/unidoc-examples/signatures/pades"
 )
 
 func init() {
@@ -74,8 +77,17 @@ func main() {
 		log.Fatal("Fail: %v\n", err)
 	}
 
-	// Create signature handler.
-	handler, err := sighandler.NewAdobePKCS7Detached(priv.(*rsa.PrivateKey), cert)
+	// Create signature handler. The handler of unipdf supports RSA keys, the one of package pades
+	// ECDSA keys too.
+	var handler model.SignatureHandler
+	switch key := priv.(type) {
+	case *rsa.PrivateKey:
+		handler, err = sighandler.NewAdobePKCS7Detached(key, cert)
+	case crypto.Signer:
+		handler, err = pades.NewPKCS7Detached(key, cert, nil, pades.Options{})
+	default:
+		err = fmt.Errorf("unsupported private key type %T", priv)
+	}
 	if err != nil {
 		log.Fatal("Fail: %v\n", err)
 	}
@@ -0,0 +1,120 @@
+/*
+ * This example showcases how to sign a PDF file with a key held by a remote signing service, e.g.
+ * a cloud KMS or the mock of pdf_sign_remote_server.go. Only the digest of the signed attributes
+ * is sent to the service, which returns the signature and the certificate chain of the key. The
+ * bearer token of the service, if any, is read from REMOTE_SIGNER_TOKEN.
+ *
+ * $ ./pdf_sign_remote <SERVICE_URL> <KEY_ID> <INPUT_PDF_PATH> <OUTPUT_PDF_PATH>
+ */
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/annotator"
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/signatures/pades"
+	"github.com/unidoc/unidoc-examples/signatures/remote"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+const usagef = "Usage: %s SERVICE_URL KEY_ID INPUT_PDF_PATH OUTPUT_PDF_PATH\n"
+
+func main() {
+	args := os.Args
+	if len(args) < 5 {
+		fmt.Printf(usagef, os.Args[0])
+		return
+	}
+	serviceURL := args[1]
+	keyID := args[2]
+	inputPath := args[3]
+	outputPath := args[4]
+
+	// Connect to the signing service and fetch the certificate chain of the key.
+	signer, err := remote.NewSigner(remote.Config{
+		URL:   serviceURL,
+		KeyID: keyID,
+		Token: os.Getenv(`REMOTE_SIGNER_TOKEN`),
+	})
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	cert := signer.Certificate()
+
+	// Create reader and appender.
+	file, err := os.Open(inputPath)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	defer file.Close()
+
+	reader, err := model.NewPdfReader(file)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	appender, err := model.NewPdfAppender(reader)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create the signature handler, which signs with the remote key through its crypto.Signer.
+	handler, err := pades.NewPKCS7Detached(signer, cert, signer.Chain()[1:], pades.Options{})
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create signature.
+	signature := model.NewPdfSignature(handler)
+	signature.SetName(cert.Subject.CommonName)
+	signature.SetReason("Remote signature test")
+	signature.SetDate(time.Now(), "")
+
+	if err := signature.Initialize(); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Create signature field and appearance.
+	opts := annotator.NewSignatureFieldOpts()
+	opts.FontSize = 10
+	opts.Rect = []float64{10, 25, 75, 60}
+
+	field, err := annotator.NewSignatureField(
+		signature,
+		[]*annotator.SignatureLine{
+			annotator.NewSignatureLine("Name", cert.Subject.CommonName),
+			annotator.NewSignatureLine("Date", time.Now().Format("2006.01.02")),
+			annotator.NewSignatureLine("Key", keyID),
+		},
+		opts,
+	)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	field.T = core.MakeString("Remote signature")
+
+	if err = appender.Sign(1, field); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	// Write output PDF file.
+	if err = appender.WriteToFile(outputPath); err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	log.Printf("PDF file successfully signed. Output path: %s\n", outputPath)
+}
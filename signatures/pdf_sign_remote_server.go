@@ -0,0 +1,65 @@
+/*
+ * This example runs a local mock of a remote signing service with the key and certificate of a
+ * PKCS12 (.p12/.pfx) file, implementing the HTTP JSON protocol of package signatures/remote. The
+ * key never leaves the service: clients such as pdf_sign_remote.go only upload the digests to sign.
+ *
+ * $ ./pdf_sign_remote_server <FILE.p12> <P12_PASS> [ADDRESS] [KEY_ID]
+ */
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+
+	"golang.org/x/crypto/pkcs12"
+
+	"github.com/unidoc/unidoc-examples/signatures/remote"
+)
+
+const usagef = "Usage: %s P12_FILE PASSWORD [ADDRESS] [KEY_ID]\n"
+
+func main() {
+	args := os.Args
+	if len(args) < 3 {
+		fmt.Printf(usagef, os.Args[0])
+		return
+	}
+	p12Path := args[1]
+	password := args[2]
+	addr := "localhost:8089"
+	if len(args) > 3 {
+		addr = args[3]
+	}
+	keyID := "key1"
+	if len(args) > 4 {
+		keyID = args[4]
+	}
+
+	// Load private key and X509 certificate from the PKCS12 file.
+	pfxData, err := ioutil.ReadFile(p12Path)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	priv, cert, err := pkcs12.Decode(pfxData, password)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		log.Fatalf("Fail: unsupported private key type %T\n", priv)
+	}
+
+	// Serve the key. Requests must present the bearer token of REMOTE_SIGNER_TOKEN, if set.
+	server := &remote.Server{
+		Keys:   map[string]remote.Key{keyID: {Signer: signer, Chain: []*x509.Certificate{cert}}},
+		Token:  os.Getenv(`REMOTE_SIGNER_TOKEN`),
+		Logger: log.New(os.Stderr, "", log.LstdFlags),
+	}
+	log.Printf("Serving key %q of %s at http://%s/\n", keyID, cert.Subject.CommonName, addr)
+	log.Fatal(http.ListenAndServe(addr, server))
+}
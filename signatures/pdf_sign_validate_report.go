@@ -0,0 +1,65 @@
+/*
+ * This example showcases how to validate the digital signatures of a PDF file against a set of
+ * trusted root certificates and print a JSON report: the certificate chain and offline revocation
+ * status of each signer, and the changes made to the document after each signature, judged
+ * against its DocMDP and FieldMDP permissions.
+ *
+ * $ ./pdf_sign_validate_report <INPUT_PDF_PATH> [TRUSTED_CERT_PATH]...
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/unidoc/unipdf/v3/common/license"
+
+	"github.com/unidoc/unidoc-examples/signatures/verify"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+const usagef = "Usage: %s INPUT_PDF_PATH [TRUSTED_CERT_PATH]...\n"
+
+func main() {
+	args := os.Args
+	if len(args) < 2 {
+		fmt.Printf(usagef, os.Args[0])
+		return
+	}
+	inputPath := args[1]
+
+	// Load the trust anchors: PEM or DER certificate files, or directories of them.
+	var opts verify.Options
+	if len(args) > 2 {
+		roots, err := verify.LoadCertificates(args[2:]...)
+		if err != nil {
+			log.Fatalf("Fail: %v\n", err)
+		}
+		opts.Roots = roots
+	}
+
+	report, err := verify.VerifyFile(inputPath, opts)
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatalf("Fail: %v\n", err)
+	}
+	fmt.Println(string(data))
+
+	for _, sig := range report.Signatures {
+		fmt.Printf("%s: %s\n", sig.Field, sig.Status)
+	}
+}
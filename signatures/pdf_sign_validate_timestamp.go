@@ -1,19 +1,28 @@
 /*
- * This example showcases how to validate a digital signature containing timestamp with UniDoc.
+ * This example showcases how to validate the RFC 3161 timestamps of a PDF file, the document
+ * timestamps and the signature timestamps of its signatures, against local trust anchors. Beyond
+ * the signature of the token, the message imprint, the chain of the timestamp authority (TSA)
+ * certificate at genTime, the ESS signing certificate binding, the key usage of the TSA
+ * certificate and genTime against the signing time are checked. The structured result of every
+ * check is printed as JSON, e.g. for audit logs.
  *
- * $ ./pdf_sign_validate_timestamp <INPUT_PDF_PATH>
+ * $ ./pdf_sign_validate_timestamp <INPUT_PDF_PATH> [TSA_ROOT_CERTS...]
+ *
+ * The trusted roots are PEM or DER files, or directories of them. Without them the chains are
+ * not validated and the timestamps are at best indeterminate.
  */
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 
 	"github.com/unidoc/unipdf/v3/common/license"
-	"github.com/unidoc/unipdf/v3/core"
-	"github.com/unidoc/unipdf/v3/model"
-	"github.com/unidoc/unipdf/v3/model/sighandler"
+
+	"github.com/unidoc/unidoc-examples/signatures/verify"
 )
 
 func init() {
@@ -25,61 +34,46 @@ func init() {
 	}
 }
 
-const usagef = "Usage: %s INPUT_PDF_PATH\n"
+const usagef = "Usage: %s INPUT_PDF_PATH [TSA_ROOT_CERTS...]\n"
 
 func main() {
 	args := os.Args
-	if len(args) < 1 {
+	if len(args) < 2 {
 		fmt.Printf(usagef, os.Args[0])
 		return
 	}
 	inputPath := args[1]
 
-	// Create reader.
-	file, err := os.Open(inputPath)
-	if err != nil {
-		log.Fatal("Fail: %v\n", err)
+	var opts verify.TimestampOptions
+	if len(args) > 2 {
+		roots, err := verify.LoadCertificates(args[2:]...)
+		if err != nil {
+			log.Fatalf("Fail: %v\n", err)
+		}
+		opts.Roots = roots
 	}
-	defer file.Close()
 
-	reader, err := model.NewPdfReader(file)
+	data, err := ioutil.ReadFile(inputPath)
 	if err != nil {
-		log.Fatal("Fail: %v\n", err)
+		log.Fatalf("Fail: %v\n", err)
 	}
 
-	// Create signature handlers.
-	handler, err := sighandler.NewDocTimeStamp("", 0)
+	// Validate the document and signature timestamps.
+	validations, err := verify.ValidateTimestamps(data, opts)
 	if err != nil {
-		log.Fatal("Fail: %v\n", err)
+		log.Fatalf("Fail: %v\n", err)
 	}
-
-	handlers := []model.SignatureHandler{
-		handler,
+	if len(validations) == 0 {
+		log.Fatal("Fail: no timestamps found")
 	}
 
-	// Validate signatures.
-	res, err := reader.ValidateSignatures(handlers)
+	out, err := json.MarshalIndent(validations, "", "    ")
 	if err != nil {
-		log.Fatal("Fail: %v\n", err)
-	}
-	if len(res) == 0 {
-		log.Fatal("Fail: no signature fields found")
-	}
-
-	timestampRes := make(map[int]model.SignatureValidationResult)
-
-	for i, item := range res {
-		// find only timestamp signatures
-		if d, ok := core.GetDict(item.Fields[0].V); ok && d.Get("SubFilter").String() == "ETSI.RFC3161" {
-			timestampRes[i] = item
-		}
-	}
-
-	if len(timestampRes) == 0 {
-		log.Fatal("Fail: validation failed")
+		log.Fatalf("Fail: %v\n", err)
 	}
+	fmt.Println(string(out))
 
-	for i, item := range timestampRes {
-		fmt.Printf("--- Signature %d\n%s\n", i+1, item.String())
+	for _, tv := range validations {
+		fmt.Printf("--- %s timestamp of %s: %s\n", tv.Kind, tv.Field, tv.Status)
 	}
 }
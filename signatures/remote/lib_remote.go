@@ -0,0 +1,251 @@
+/*
+ * Package remote signs with keys held by a remote signing service, such as a cloud KMS or an
+ * in-house signing server, so that the private keys never leave the service. Signer implements
+ * crypto.Signer: only the digest to sign is uploaded and the service returns the signature. It
+ * can be used with any signature handler that accepts a crypto.Signer, e.g. of package pades:
+ *
+ *   signer, err := remote.NewSigner(remote.Config{URL: "https://signer.example.com", KeyID: "key1"})
+ *   chain := signer.Chain()
+ *   handler, err := pades.NewPKCS7Detached(signer, chain[0], chain[1:], pades.Options{})
+ *
+ * The HTTP JSON protocol of the service has two endpoints, relative to its base URL:
+ *
+ *   GET  keys/{id}       -> {"key_id": "key1", "certificates": ["<base64 DER>", ...]}
+ *   POST keys/{id}/sign  {"hash": "SHA-256", "digest": "<base64>", "pss": false, "salt_length": 0}
+ *                        -> {"signature": "<base64>"}
+ *
+ * The certificates are the certificate of the key followed by its issuers. "pss" requests an
+ * RSASSA-PSS signature with "salt_length" as in rsa.PSSOptions, otherwise RSA keys sign with
+ * PKCS #1 v1.5 and ECDSA keys return an ASN.1 signature. Errors are returned with a non-200 status
+ * and {"error": "<message>"}. Signer checks the returned signatures against the certificate of the
+ * key. Server implements the protocol for local keys, e.g. as a mock of a signing service.
+ *
+ * Used by pdftool sign, signatures/pdf_sign_remote.go and signatures/pdf_sign_remote_server.go.
+ */
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// KeyInfo is the response of the key endpoint.
+type KeyInfo struct {
+	KeyID string `json:"key_id"`
+	// Certificates are the DER encoded certificate of the key followed by its issuers.
+	Certificates [][]byte `json:"certificates"`
+}
+
+// SignRequest is the request of the sign endpoint.
+type SignRequest struct {
+	// Hash is the name of the digest algorithm, e.g. SHA-256.
+	Hash   string `json:"hash"`
+	Digest []byte `json:"digest"`
+	// PSS requests an RSASSA-PSS signature with a salt of SaltLength, see rsa.PSSOptions.
+	PSS        bool `json:"pss,omitempty"`
+	SaltLength int  `json:"salt_length,omitempty"`
+}
+
+// SignResponse is the response of the sign endpoint.
+type SignResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+// errorResponse is the body of the responses with an error status.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Config configures a Signer.
+type Config struct {
+	// URL is the base URL of the signing service.
+	URL string
+	// KeyID identifies the signing key.
+	KeyID string
+	// Token, if set, is sent as bearer token in the Authorization header.
+	Token string
+	// HTTPClient makes the HTTP requests. By default a client with a 30 second timeout is used.
+	HTTPClient *http.Client
+}
+
+// Signer is a crypto.Signer whose key is held by a remote signing service.
+type Signer struct {
+	config Config
+	base   *url.URL
+	client *http.Client
+	chain  []*x509.Certificate
+}
+
+// NewSigner returns a Signer for the key `config.KeyID` of the signing service at `config.URL`.
+// It fetches the certificate chain of the key.
+func NewSigner(config Config) (*Signer, error) {
+	return NewSignerContext(context.Background(), config)
+}
+
+// NewSignerContext is NewSigner with a context for fetching the certificate chain.
+func NewSignerContext(ctx context.Context, config Config) (*Signer, error) {
+	switch config.KeyID {
+	case "":
+		return nil, errors.New("remote signer: no key ID")
+	case ".", "..":
+		// Escaping keeps them as they are, and they would change the path.
+		return nil, fmt.Errorf("remote signer: invalid key ID %q", config.KeyID)
+	}
+	base, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer: %w", err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	s := &Signer{config: config, base: base, client: config.HTTPClient}
+	if s.client == nil {
+		s.client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	var info KeyInfo
+	if err := s.call(ctx, http.MethodGet, "", nil, &info); err != nil {
+		return nil, err
+	}
+	if len(info.Certificates) == 0 {
+		return nil, fmt.Errorf("remote signer: no certificate for key %q", config.KeyID)
+	}
+	for _, der := range info.Certificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("remote signer: %w", err)
+		}
+		s.chain = append(s.chain, cert)
+	}
+	return s, nil
+}
+
+// Certificate returns the certificate of the key.
+func (s *Signer) Certificate() *x509.Certificate {
+	return s.chain[0]
+}
+
+// Chain returns the certificate of the key followed by its issuers, as returned by the service.
+func (s *Signer) Chain() []*x509.Certificate {
+	return s.chain
+}
+
+// Public implements crypto.Signer. It returns the public key of the certificate.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.chain[0].PublicKey
+}
+
+// Sign implements crypto.Signer. It sends `digest` to the signing service and returns the
+// signature. `opts` is a crypto.Hash or, for RSASSA-PSS, an *rsa.PSSOptions.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if hash == 0 || !hash.Available() {
+		return nil, errors.New("remote signer: unsupported digest algorithm")
+	}
+	if len(digest) != hash.Size() {
+		return nil, fmt.Errorf("remote signer: digest length %d doesn't match %s", len(digest), hash)
+	}
+	req := SignRequest{Hash: hash.String(), Digest: digest}
+	if pss, ok := opts.(*rsa.PSSOptions); ok {
+		req.PSS = true
+		req.SaltLength = pss.SaltLength
+	}
+
+	var resp SignResponse
+	if err := s.call(context.Background(), http.MethodPost, "/sign", req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Signature) == 0 {
+		return nil, errors.New("remote signer: empty signature")
+	}
+	// A wrong key or a faulty service would otherwise only show when the signature is validated.
+	if err := verifySignature(s.Public(), digest, resp.Signature, hash, req.PSS); err != nil {
+		return nil, fmt.Errorf("remote signer: the signature of key %q doesn't match its certificate: %w",
+			s.config.KeyID, err)
+	}
+	return resp.Signature, nil
+}
+
+// verifySignature checks that `signature` is the signature of `digest`, of digest algorithm
+// `hash`, by public key `pub`. RSA signatures are RSASSA-PSS if `pss` is set.
+func verifySignature(pub crypto.PublicKey, digest, signature []byte, hash crypto.Hash, pss bool) error {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if pss {
+			return rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		var sig struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(signature, &sig); err != nil || len(rest) > 0 {
+			return errors.New("invalid ECDSA signature")
+		}
+		if !ecdsa.Verify(key, digest, sig.R, sig.S) {
+			return errors.New("ECDSA verification failure")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// call makes a request to the endpoint of the key with `suffix`, sending `in` and decoding the
+// response into `out`.
+func (s *Signer) call(ctx context.Context, method, suffix string, in, out interface{}) error {
+	// The key ID is a single path segment, whatever it contains.
+	ref, err := url.Parse("keys/" + url.PathEscape(s.config.KeyID) + suffix)
+	if err != nil {
+		return fmt.Errorf("remote signer: %w", err)
+	}
+	u := s.base.ResolveReference(ref)
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("remote signer: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != "" {
+			return fmt.Errorf("remote signer: %s: %s", resp.Status, e.Error)
+		}
+		return fmt.Errorf("remote signer: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("remote signer: invalid response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+ * Server: the signing service side of the protocol for keys held locally, used as a mock of a
+ * remote signing service.
+ */
+
+package remote
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Key is a signing key of a Server.
+type Key struct {
+	Signer crypto.Signer
+	// Chain is the certificate of the key followed by its issuers.
+	Chain []*x509.Certificate
+}
+
+// Server is an http.Handler that implements the signing service protocol for local keys.
+type Server struct {
+	// Keys are the keys of the service by key ID.
+	Keys map[string]Key
+	// Token, if set, is the bearer token that requests must present.
+	Token string
+	// Logger, if set, logs the signing requests.
+	Logger *log.Logger
+}
+
+// hashes are the digest algorithms the Server signs with.
+var hashes = []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := []byte(r.Header.Get("Authorization"))
+	if s.Token != "" && subtle.ConstantTimeCompare(auth, []byte("Bearer "+s.Token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	// Key IDs are escaped path segments.
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+	if !strings.HasPrefix(path, "keys/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	id := strings.TrimPrefix(path, "keys/")
+	sign := strings.HasSuffix(id, "/sign")
+	id, err := url.PathUnescape(strings.TrimSuffix(id, "/sign"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	key, ok := s.Keys[id]
+	if !ok || len(key.Chain) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown key %q", id))
+		return
+	}
+
+	switch {
+	case !sign && r.Method == http.MethodGet:
+		info := KeyInfo{KeyID: id}
+		for _, cert := range key.Chain {
+			info.Certificates = append(info.Certificates, cert.Raw)
+		}
+		writeJSON(w, info)
+	case sign && r.Method == http.MethodPost:
+		var req SignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		signature, err := s.sign(key, req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if s.Logger != nil {
+			s.Logger.Printf("signed %s digest with key %q (pss=%t)", req.Hash, id, req.PSS)
+		}
+		writeJSON(w, SignResponse{Signature: signature})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+	}
+}
+
+// sign signs the digest of `req` with `key`.
+func (s *Server) sign(key Key, req SignRequest) ([]byte, error) {
+	var hash crypto.Hash
+	for _, h := range hashes {
+		if strings.EqualFold(req.Hash, h.String()) {
+			hash = h
+		}
+	}
+	if hash == 0 {
+		return nil, fmt.Errorf("unsupported digest algorithm %q", req.Hash)
+	}
+	if len(req.Digest) != hash.Size() {
+		return nil, fmt.Errorf("digest length %d doesn't match %s", len(req.Digest), hash)
+	}
+	var opts crypto.SignerOpts = hash
+	if req.PSS {
+		if _, ok := key.Signer.Public().(*rsa.PublicKey); !ok {
+			return nil, errors.New("RSASSA-PSS requires an RSA key")
+		}
+		opts = &rsa.PSSOptions{SaltLength: req.SaltLength, Hash: hash}
+	}
+	return key.Signer.Sign(rand.Reader, req.Digest, opts)
+}
+
+// writeJSON writes `v` as JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response with `status` and `msg`.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: msg})
+}
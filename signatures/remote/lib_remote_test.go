@@ -0,0 +1,102 @@
+package remote
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testKey returns a key for `signer` with a self-signed certificate of the public key of `pub`.
+func testKey(t *testing.T, signer, pub crypto.Signer) Key {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub.Public(), pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Key{Signer: signer, Chain: []*x509.Certificate{cert}}
+}
+
+func TestSigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{
+		Token: "secret",
+		Keys: map[string]Key{
+			"rsa":       testKey(t, rsaKey, rsaKey),
+			"a/b?c#d%e": testKey(t, ecKey, ecKey),
+			"x/sign":    testKey(t, ecKey, ecKey),
+			// The service signs with another key than that of the certificate.
+			"wrong": testKey(t, otherKey, ecKey),
+		},
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	digest := sha256.Sum256([]byte("data"))
+
+	tests := []struct {
+		name   string
+		keyID  string
+		token  string
+		opts   crypto.SignerOpts
+		newErr bool
+		ok     bool
+	}{
+		{name: "RSA", keyID: "rsa", token: "secret", opts: crypto.SHA256, ok: true},
+		{name: "RSASSA-PSS", keyID: "rsa", token: "secret", opts: &rsa.PSSOptions{Hash: crypto.SHA256}, ok: true},
+		{name: "ECDSA with escaped key ID", keyID: "a/b?c#d%e", token: "secret", opts: crypto.SHA256, ok: true},
+		{name: "key ID with the sign suffix", keyID: "x/sign", token: "secret", opts: crypto.SHA256, ok: true},
+		{name: "signature of another key", keyID: "wrong", token: "secret", opts: crypto.SHA256},
+		{name: "wrong token", keyID: "rsa", token: "guess", newErr: true},
+		{name: "unknown key", keyID: "missing", token: "secret", newErr: true},
+		{name: "dot dot", keyID: "..", token: "secret", newErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewSigner(Config{URL: ts.URL, KeyID: test.keyID, Token: test.token})
+			if test.newErr {
+				if err == nil {
+					t.Fatal("NewSigner succeeded, expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = s.Sign(rand.Reader, digest[:], test.opts)
+			if test.ok && err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Fatal("Sign succeeded, expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,808 @@
+/*
+ * Package verify validates the digital signatures of PDF files and reports the results in a form
+ * that can be marshaled to JSON.
+ *
+ * For each signature it checks:
+ *  - that the byte range covers the file except for the signature value, and which revision it
+ *    ends;
+ *  - the digest and the signature value (adbe.pkcs7.detached, adbe.pkcs7.sha1, ETSI.CAdES.detached,
+ *    ETSI.RFC3161 document timestamps and adbe.x509.rsa_sha1; RSA PKCS#1 v1.5, RSASSA-PSS and ECDSA
+ *    keys) and the signature timestamp token if there is one;
+ *  - the certificate chain of the signer, built from the certificates of the signature and of the
+ *    DSS up to a trust anchor of the options, at the time of the signature timestamp if the
+ *    timestamp validates with ValidateTimestamp and the same trust anchors, else now;
+ *  - the revocation status of each certificate of the chain, offline, from the CRLs and OCSP
+ *    responses of the DSS (global and the VRI entry of the signature) and of the signature itself
+ *    (CMS CRLs and the adbe-revocationInfoArchival attribute). Only data current at the validation
+ *    time shows a certificate good: issued at most a day after it and not expired before it;
+ *  - the changes made by later incremental updates: every object of the final document that
+ *    differs from the signed revision is classified (validation data, signature, form filling,
+ *    annotation, page content, ...) and judged against the DocMDP permission of the
+ *    certification signature and the FieldMDP locks of the signatures.
+ *
+ * A signature is valid if all checks pass, invalid if the signed data or the signature don't
+ * verify, a certificate was revoked at signing time or a change is not allowed, and indeterminate
+ * if the chain can't be built to a trust anchor (or, with Options.RequireRevocation, the
+ * revocation status of a certificate is unknown).
+ *
+ * ValidateTimestamp and ValidateTimestamps validate RFC 3161 timestamp tokens fully, with the
+ * result of each check: message imprint, signature, ESS signing certificate binding, key usage and
+ * chain of the TSA certificate at genTime, genTime against the signing time, nonce and policy.
+ *
+ * Used by pdftool verify and verify-timestamps and by signatures/pdf_sign_validate_report.go and
+ * signatures/pdf_sign_validate_timestamp.go.
+ */
+
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Options configures the verification.
+type Options struct {
+	// Roots are the trust anchors.
+	Roots []*x509.Certificate
+	// SystemRoots adds the trust anchors of the system.
+	SystemRoots bool
+	// Intermediates are additional certificates for building chains.
+	Intermediates []*x509.Certificate
+	// Time is the time the certificates are validated at. By default the time of the signature
+	// timestamp if its authority validates with the trust anchors, else now.
+	Time time.Time
+	// TrustSigningTime validates the certificates of signatures without trusted timestamp at the
+	// signing time claimed by the signer instead of now. The claimed time isn't authenticated: a
+	// backdated signature with an expired or revoked certificate passes, so a warning is reported.
+	TrustSigningTime bool
+	// RequireRevocation makes signatures with a certificate of unknown revocation status
+	// indeterminate. By default it is only reported as a warning.
+	RequireRevocation bool
+	// Password decrypts encrypted files.
+	Password string
+}
+
+// Signature statuses.
+const (
+	Valid         = "valid"
+	Invalid       = "invalid"
+	Indeterminate = "indeterminate"
+)
+
+// Report is the result of the verification of the signatures of a file.
+type Report struct {
+	File      string `json:"file,omitempty"`
+	Size      int    `json:"size"`
+	Revisions int    `json:"revisions"`
+	// DocMDP is the permission P of the certification signature, 0 if the file is not certified.
+	DocMDP     int                `json:"docmdp,omitempty"`
+	Signatures []*SignatureReport `json:"signatures"`
+	// Valid is true if the file has signatures and all are valid.
+	Valid bool `json:"valid"`
+}
+
+// SignatureReport is the result of the verification of a signature.
+type SignatureReport struct {
+	Field       string     `json:"field"`
+	Type        string     `json:"type"` // approval, certification or timestamp.
+	SubFilter   string     `json:"sub_filter"`
+	Name        string     `json:"name,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	Location    string     `json:"location,omitempty"`
+	ContactInfo string     `json:"contact_info,omitempty"`
+	SigningTime *time.Time `json:"signing_time,omitempty"` // Claimed by the signer.
+	// Revision is the number of the revision the signature ends, counting from 1.
+	Revision int `json:"revision"`
+	// CoversDocument is true if the signature covers the whole file.
+	CoversDocument  bool           `json:"covers_document"`
+	DigestAlgorithm string         `json:"digest_algorithm,omitempty"`
+	Algorithm       string         `json:"algorithm,omitempty"` // Signature scheme and key size, e.g. RSA-2048.
+	DigestValid     bool           `json:"digest_valid"`
+	SignatureValid  bool           `json:"signature_valid"`
+	Timestamp       *Timestamp     `json:"timestamp,omitempty"`
+	Signer          *Certificate   `json:"signer,omitempty"`
+	Chain           []*Certificate `json:"chain,omitempty"`
+	Trusted         bool           `json:"trusted"`
+	ValidatedAt     time.Time      `json:"validated_at"`
+	Revocation      []*Revocation  `json:"revocation,omitempty"`
+	DocMDP          int            `json:"docmdp,omitempty"` // Permission P of a certification signature.
+	FieldMDP        *FieldLock     `json:"fieldmdp,omitempty"`
+	Changes         []*Change      `json:"changes,omitempty"` // Made after the signature.
+	Status          string         `json:"status"`
+	Errors          []string       `json:"errors,omitempty"`
+	Warnings        []string       `json:"warnings,omitempty"`
+}
+
+// Timestamp is the result of the verification of a timestamp token.
+type Timestamp struct {
+	Time   time.Time    `json:"time"`
+	Valid  bool         `json:"valid"`
+	Signer *Certificate `json:"signer,omitempty"`
+	Errors []string     `json:"errors,omitempty"`
+}
+
+func (sr *SignatureReport) errorf(format string, a ...interface{}) {
+	sr.Errors = append(sr.Errors, fmt.Sprintf(format, a...))
+}
+
+func (sr *SignatureReport) warnf(format string, a ...interface{}) {
+	sr.Warnings = append(sr.Warnings, fmt.Sprintf(format, a...))
+}
+
+// VerifyFile verifies the signatures of the PDF file at `path`.
+func VerifyFile(path string, opts Options) (*Report, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report, err := Verify(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	report.File = path
+	return report, nil
+}
+
+// Verify verifies the signatures of the PDF file `data`.
+func Verify(data []byte, opts Options) (*Report, error) {
+	reader, err := openRevision(data, opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	d, err := newDocument(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := trustPool(opts.Roots, opts.SystemRoots)
+	if err != nil {
+		return nil, err
+	}
+	store := d.readDSS()
+
+	// Signatures in the order they were applied.
+	sigs := append([]*sigField(nil), d.sigs...)
+	ends := map[*sigField]int64{}
+	for _, sf := range sigs {
+		ends[sf] = byteRangeEnd(sf.value)
+	}
+	sort.SliceStable(sigs, func(i, j int) bool { return ends[sigs[i]] < ends[sigs[j]] })
+
+	report := &Report{Size: len(data), Revisions: bytes.Count(data, []byte("%%EOF"))}
+	var locks []*FieldLock
+	revisions := map[int64]*model.PdfReader{}
+	for i, sf := range sigs {
+		sr := d.verifyField(data, sf, store, roots, opts)
+		if sr.DocMDP != 0 {
+			if i > 0 {
+				sr.warnf("certification signature is not the first signature")
+			}
+			if report.DocMDP == 0 {
+				report.DocMDP = sr.DocMDP
+			}
+		}
+		if sr.FieldMDP != nil {
+			locks = append(locks, sr.FieldMDP)
+		}
+
+		// Changes made after the signature.
+		end := ends[sf]
+		if end > 0 && !sr.CoversDocument {
+			prev, ok := revisions[end]
+			if !ok {
+				if prev, err = openRevision(data[:end], opts.Password); err != nil {
+					sr.warnf("signed revision can't be read, changes not checked: %v", err)
+				}
+				revisions[end] = prev
+			}
+			if prev != nil {
+				sr.Changes = d.changes(prev)
+			}
+		}
+		disallowed := 0
+		for _, c := range sr.Changes {
+			judge(c, report.DocMDP, locks)
+			if !c.Allowed {
+				disallowed++
+			}
+		}
+		if disallowed > 0 {
+			sr.errorf("%d change(s) after signing are not allowed", disallowed)
+		}
+
+		sr.Status = Valid
+		switch {
+		case len(sr.Errors) > 0:
+			sr.Status = Invalid
+		case !sr.Trusted:
+			sr.Status = Indeterminate
+		case opts.RequireRevocation && hasUnknownRevocation(sr):
+			sr.Status = Indeterminate
+		}
+		report.Signatures = append(report.Signatures, sr)
+	}
+
+	report.Valid = len(report.Signatures) > 0
+	for _, sr := range report.Signatures {
+		if sr.Status != Valid {
+			report.Valid = false
+		}
+	}
+	return report, nil
+}
+
+// trustPool returns the pool of the trust anchors `roots`, with the system roots if `system` is
+// set, nil if there are none.
+func trustPool(roots []*x509.Certificate, system bool) (*x509.CertPool, error) {
+	var pool *x509.CertPool
+	if system {
+		var err error
+		if pool, err = x509.SystemCertPool(); err != nil {
+			return nil, err
+		}
+	}
+	if len(roots) > 0 {
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, cert := range roots {
+			pool.AddCert(cert)
+		}
+	}
+	return pool, nil
+}
+
+// openRevision returns a reader of the PDF file `data`, decrypted with `password` if needed.
+func openRevision(data []byte, password string) (*model.PdfReader, error) {
+	reader, err := model.NewPdfReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := reader.IsEncrypted()
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		return reader, nil
+	}
+	// The empty password is tried as a fallback.
+	for _, pw := range []string{password, ""} {
+		ok, err := reader.Decrypt([]byte(pw))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return reader, nil
+		}
+	}
+	return nil, errors.New("wrong password")
+}
+
+// hasUnknownRevocation returns true if the revocation status of a certificate of `sr` is unknown.
+func hasUnknownRevocation(sr *SignatureReport) bool {
+	for _, r := range sr.Revocation {
+		if r.Status == StatusUnknown {
+			return true
+		}
+	}
+	return false
+}
+
+// byteRange returns the byte range of signature dictionary `sig`.
+func byteRange(sig *core.PdfObjectDictionary) []int64 {
+	arr, ok := core.GetArray(sig.Get("ByteRange"))
+	if !ok {
+		return nil
+	}
+	var br []int64
+	for _, elem := range arr.Elements() {
+		v, ok := core.GetIntVal(elem)
+		if !ok {
+			return nil
+		}
+		br = append(br, int64(v))
+	}
+	return br
+}
+
+// byteRangeEnd returns the end offset of the byte range of signature dictionary `sig`, 0 if it is
+// invalid.
+func byteRangeEnd(sig *core.PdfObjectDictionary) int64 {
+	br := byteRange(sig)
+	if len(br) != 4 {
+		return 0
+	}
+	return br[2] + br[3]
+}
+
+// signedBytes returns the bytes of `data` covered by byte range `br`, which must cover all but the
+// signature value.
+func signedBytes(data []byte, br []int64) ([]byte, error) {
+	if len(br) != 4 {
+		return nil, fmt.Errorf("byte range has %d entries, expected 4", len(br))
+	}
+	a, b, c, d := br[0], br[1], br[2], br[3]
+	size := int64(len(data))
+	if a != 0 || b <= 0 || c <= a+b || d < 0 || c+d > size {
+		return nil, fmt.Errorf("invalid byte range %v for a file of %d bytes", br, size)
+	}
+	if data[b] != '<' || data[c-1] != '>' {
+		return nil, fmt.Errorf("byte range %v does not exclude exactly the signature value", br)
+	}
+	signed := make([]byte, 0, b+d)
+	signed = append(signed, data[a:a+b]...)
+	return append(signed, data[c:c+d]...), nil
+}
+
+// verifyField verifies the signature of field `sf` of file `data`, with the validation data
+// `store` of the document and the trust anchors `roots`.
+func (d *document) verifyField(data []byte, sf *sigField, store *dssData, roots *x509.CertPool,
+	opts Options) *SignatureReport {
+	sig := sf.value
+	text := func(key core.PdfObjectName) string {
+		if s, ok := core.GetString(sig.Get(key)); ok {
+			return s.Decoded()
+		}
+		return ""
+	}
+	name := func(key core.PdfObjectName) string {
+		if n, ok := core.GetName(sig.Get(key)); ok {
+			return string(*n)
+		}
+		return ""
+	}
+	sr := &SignatureReport{
+		Field:       sf.name,
+		Type:        "approval",
+		SubFilter:   name("SubFilter"),
+		Name:        text("Name"),
+		Reason:      text("Reason"),
+		Location:    text("Location"),
+		ContactInfo: text("ContactInfo"),
+	}
+	if name("Type") == "DocTimeStamp" || sr.SubFilter == "ETSI.RFC3161" {
+		sr.Type = "timestamp"
+	}
+	if m := text("M"); m != "" {
+		if date, err := model.NewPdfDate(m); err == nil {
+			t := date.ToGoTime()
+			sr.SigningTime = &t
+		}
+	}
+	if sr.DocMDP, sr.FieldMDP = d.references(sig); sr.DocMDP != 0 {
+		sr.Type = "certification"
+	}
+	if sr.FieldMDP == nil && sf.lock != nil {
+		sr.FieldMDP = fieldLock(sf.lock)
+	}
+
+	br := byteRange(sig)
+	if end := byteRangeEnd(sig); end > 0 && end <= int64(len(data)) {
+		sr.Revision = bytes.Count(data[:end], []byte("%%EOF"))
+		sr.CoversDocument = len(bytes.TrimSpace(data[end:])) == 0
+	}
+	signed, err := signedBytes(data, br)
+	if err != nil {
+		sr.errorf("%v", err)
+		return sr
+	}
+	contents, ok := core.GetString(sig.Get("Contents"))
+	if !ok {
+		sr.errorf("missing signature value")
+		return sr
+	}
+	value := contents.Bytes()
+	h := sha1.Sum(value)
+	vriKey := strings.ToUpper(hex.EncodeToString(h[:]))
+
+	revocation := store.revocation(vriKey)
+	pool := append(store.certs(vriKey), opts.Intermediates...)
+	var signer *x509.Certificate
+	var timestamp time.Time // Of a timestamp of a trusted authority.
+	var timestampErr error  // Why the time of a timestamp isn't trusted.
+
+	switch sr.SubFilter {
+	case "adbe.x509.rsa_sha1":
+		signer, pool = verifyX509RSA(sr, sig, signed, value, pool)
+	case "ETSI.RFC3161":
+		token, info, err := parseTimestamp(value)
+		if err != nil {
+			sr.errorf("%v", err)
+			return sr
+		}
+		var digestErr, sigErr error
+		signer, digestErr, sigErr = token.verify(nil)
+		if digestErr == nil {
+			digestErr = info.checkImprint(signed)
+		}
+		sr.DigestValid, sr.SignatureValid = digestErr == nil, signer != nil && sigErr == nil
+		if hash, err := hashForOID(info.MessageImprint.HashAlgorithm.Algorithm); err == nil {
+			sr.DigestAlgorithm = hashName(hash)
+		}
+		reportCMSErrors(sr, signer, digestErr, sigErr)
+		if signer != nil {
+			sr.Algorithm = signatureAlgorithm(signer.PublicKey, token.signer.SignatureAlgorithm)
+		}
+		genTime := info.GenTime
+		sr.SigningTime = &genTime
+		pool = append(pool, token.certs...)
+		addCMSRevocation(sr, token, revocation)
+		timestamp, timestampErr = trustedTime(value, signed, pool, roots)
+	case "adbe.pkcs7.detached", "ETSI.CAdES.detached", "adbe.pkcs7.sha1":
+		c, err := parseCMS(value)
+		if err != nil {
+			sr.errorf("%v", err)
+			return sr
+		}
+		hash, err := c.digestAlgorithm()
+		if err == nil {
+			sr.DigestAlgorithm = hashName(hash)
+		}
+		var digestErr, sigErr error
+		if sr.SubFilter == "adbe.pkcs7.sha1" {
+			signer, digestErr, sigErr = c.verify(nil)
+			if sum := sha1.Sum(signed); digestErr == nil && !bytes.Equal(c.content, sum[:]) {
+				digestErr = errors.New("signed SHA-1 digest does not match the signed data")
+			}
+		} else {
+			signer, digestErr, sigErr = c.verify(signed)
+		}
+		sr.DigestValid, sr.SignatureValid = digestErr == nil, signer != nil && sigErr == nil
+		reportCMSErrors(sr, signer, digestErr, sigErr)
+		if signer != nil {
+			sr.Algorithm = signatureAlgorithm(signer.PublicKey, c.signer.SignatureAlgorithm)
+		}
+		if t, ok := c.signingTime(); ok {
+			sr.SigningTime = &t
+		}
+		pool = append(pool, c.certs...)
+		addCMSRevocation(sr, c, revocation)
+		if token := c.timestampToken(); token != nil {
+			sr.Timestamp = VerifyTimestamp(token, c.signer.Signature)
+			if sr.Timestamp.Valid {
+				timestamp, timestampErr = trustedTime(token, c.signer.Signature, pool, roots)
+			} else {
+				sr.warnf("signature timestamp is not valid")
+			}
+		}
+	default:
+		sr.errorf("unsupported signature sub filter %q", sr.SubFilter)
+		return sr
+	}
+	if signer == nil {
+		return sr
+	}
+	sr.Signer = describeCertificate(signer)
+
+	// The certificates are validated at the time of the timestamp of a trusted authority, else
+	// now: the signing time is only claimed by the signer.
+	sr.ValidatedAt = time.Now()
+	switch {
+	case !opts.Time.IsZero():
+		sr.ValidatedAt = opts.Time
+	case !timestamp.IsZero():
+		sr.ValidatedAt = timestamp
+	case sr.SigningTime != nil && opts.TrustSigningTime:
+		sr.ValidatedAt = *sr.SigningTime
+		sr.warnf("validated at the signing time claimed by the signer, which is not authenticated")
+	}
+	if timestampErr != nil {
+		sr.warnf("the time of the timestamp is not trusted: %v", timestampErr)
+	}
+
+	var chain []*x509.Certificate
+	if roots == nil {
+		sr.warnf("no trust anchors given, the chain is not validated")
+	} else if chain, err = buildChain(signer, pool, roots, sr.ValidatedAt); err != nil {
+		sr.warnf("certificate chain: %v", err)
+	} else {
+		sr.Trusted = true
+	}
+	if chain == nil {
+		chain = issuerChain(signer, append(pool, opts.Roots...))
+	}
+	for _, cert := range chain {
+		sr.Chain = append(sr.Chain, describeCertificate(cert))
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		status := revocation.check(chain[i], chain[i+1], sr.ValidatedAt)
+		sr.Revocation = append(sr.Revocation, status)
+		switch status.Status {
+		case StatusRevoked:
+			sr.errorf("certificate %s was revoked at %s", status.Subject, status.RevokedAt.Format(time.RFC3339))
+		case StatusUnknown:
+			if status.Detail != "" {
+				sr.warnf("revocation status of %s is unknown: %s", status.Subject, status.Detail)
+			} else {
+				sr.warnf("revocation status of %s is unknown", status.Subject)
+			}
+		default:
+			if status.RevokedAt != nil {
+				sr.warnf("certificate %s was revoked after signing, at %s", status.Subject,
+					status.RevokedAt.Format(time.RFC3339))
+			}
+		}
+	}
+	return sr
+}
+
+// trustedTime returns the genTime of the timestamp token `token` of `data` if it validates with
+// ValidateTimestamp and the trust anchors `roots`, completing the chain with `pool`. Otherwise a
+// backdating authority could make expired or revoked certificates pass, and the error says why the
+// token isn't trusted.
+func trustedTime(token, data []byte, pool []*x509.Certificate, roots *x509.CertPool) (time.Time, error) {
+	tv := &TimestampValidation{}
+	tv.validate(token, data, roots, TimestampOptions{Intermediates: pool})
+	tv.setStatus()
+	if tv.Status == Valid {
+		return tv.GenTime, nil
+	}
+	for _, c := range tv.Checks {
+		if c.Result == CheckFailed || c.Name == CheckTSAChain && c.Result != CheckPassed {
+			return time.Time{}, fmt.Errorf("timestamp %s: %s", c.Name, c.Detail)
+		}
+	}
+	return time.Time{}, fmt.Errorf("timestamp is %s", tv.Status)
+}
+
+// reportCMSErrors adds the errors of the verification of a CMS signature to `sr`.
+func reportCMSErrors(sr *SignatureReport, signer *x509.Certificate, digestErr, sigErr error) {
+	if digestErr != nil {
+		sr.errorf("the signed data was modified: %v", digestErr)
+	}
+	if sigErr != nil {
+		sr.errorf("signature: %v", sigErr)
+	}
+	if signer == nil && digestErr == nil && sigErr == nil {
+		sr.errorf("signer certificate not found")
+	}
+}
+
+// addCMSRevocation adds the CRLs and the revocation information attribute of `c` to `rd`.
+func addCMSRevocation(sr *SignatureReport, c *cms, rd *revocationData) {
+	for _, crl := range c.crls {
+		rd.crls = append(rd.crls, sourced{crl, "signature-crl"})
+	}
+	if raw, ok := findAttribute(c.attrs, oidAttrRevocationArchive); ok {
+		if err := rd.addArchive(raw); err != nil {
+			sr.warnf("%v", err)
+		}
+	}
+}
+
+// verifyX509RSA verifies an adbe.x509.rsa_sha1 signature: a PKCS#1 signature `value` of
+// `signed` by the first certificate of the Cert entry of `sig`. Returns the signer and `pool`
+// with the certificates of the entry.
+func verifyX509RSA(sr *SignatureReport, sig *core.PdfObjectDictionary, signed, value []byte,
+	pool []*x509.Certificate) (*x509.Certificate, []*x509.Certificate) {
+	var certs []*x509.Certificate
+	var entries []core.PdfObject
+	if arr, ok := core.GetArray(sig.Get("Cert")); ok {
+		entries = arr.Elements()
+	} else if sig.Get("Cert") != nil {
+		entries = []core.PdfObject{sig.Get("Cert")}
+	}
+	for _, entry := range entries {
+		s, ok := core.GetString(entry)
+		if !ok {
+			continue
+		}
+		cert, err := x509.ParseCertificate(s.Bytes())
+		if err != nil {
+			sr.errorf("invalid certificate: %v", err)
+			return nil, pool
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		sr.errorf("missing signer certificate")
+		return nil, pool
+	}
+	var signature []byte
+	if _, err := asn1.Unmarshal(value, &signature); err != nil {
+		sr.errorf("invalid signature value: %v", err)
+		return nil, pool
+	}
+
+	// The digest algorithm is only given inside the signature, try the possible ones.
+	alg := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}}
+	sr.DigestValid = true
+	for _, hash := range []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		if verifySignature(certs[0].PublicKey, hash, alg, signed, signature) == nil {
+			sr.SignatureValid, sr.DigestAlgorithm = true, hashName(hash)
+			sr.Algorithm = signatureAlgorithm(certs[0].PublicKey, alg)
+			break
+		}
+	}
+	if !sr.SignatureValid {
+		sr.errorf("the signature does not verify, the signed data may have been modified")
+	}
+	return certs[0], append(pool, certs...)
+}
+
+// VerifyTimestamp verifies the RFC 3161 timestamp token `token` of `data`.
+func VerifyTimestamp(token, data []byte) *Timestamp {
+	ts := &Timestamp{}
+	c, info, err := parseTimestamp(token)
+	if err != nil {
+		ts.Errors = append(ts.Errors, err.Error())
+		return ts
+	}
+	ts.Time = info.GenTime
+	signer, digestErr, sigErr := c.verify(nil)
+	for _, err := range []error{digestErr, sigErr, info.checkImprint(data)} {
+		if err != nil {
+			ts.Errors = append(ts.Errors, err.Error())
+		}
+	}
+	if signer != nil {
+		ts.Signer = describeCertificate(signer)
+	}
+	ts.Valid = signer != nil && len(ts.Errors) == 0
+	return ts
+}
+
+// VerifyCMS checks that the detached CMS signature `contents` signs `signed` and returns the
+// certificate of the signer, and the verification of its signature timestamp if it has one. It
+// doesn't validate the certificate.
+func VerifyCMS(contents, signed []byte) (*x509.Certificate, *Timestamp, error) {
+	c, err := parseCMS(contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, digestErr, sigErr := c.verify(signed)
+	if digestErr != nil {
+		return signer, nil, fmt.Errorf("the signed data was modified: %w", digestErr)
+	}
+	if sigErr != nil {
+		return signer, nil, fmt.Errorf("signature: %w", sigErr)
+	}
+	var ts *Timestamp
+	if token := c.timestampToken(); token != nil {
+		ts = VerifyTimestamp(token, c.signer.Signature)
+	}
+	return signer, ts, nil
+}
+
+// references returns the DocMDP permission P (0 if none) and the FieldMDP lock (nil if none) of
+// the transforms of the Reference entry of signature dictionary `sig`.
+func (d *document) references(sig *core.PdfObjectDictionary) (int, *FieldLock) {
+	refs, ok := core.GetArray(d.direct(sig.Get("Reference")))
+	if !ok {
+		return 0, nil
+	}
+	p := 0
+	var lock *FieldLock
+	for _, obj := range refs.Elements() {
+		ref, ok := core.GetDict(d.direct(obj))
+		if !ok {
+			continue
+		}
+		method, _ := core.GetName(ref.Get("TransformMethod"))
+		params, _ := core.GetDict(d.direct(ref.Get("TransformParams")))
+		if method == nil {
+			continue
+		}
+		switch *method {
+		case "DocMDP":
+			p = 2
+			if params != nil {
+				if v, ok := core.GetIntVal(params.Get("P")); ok && v >= 1 && v <= 3 {
+					p = v
+				}
+			}
+		case "FieldMDP":
+			if params != nil {
+				lock = fieldLock(params)
+			}
+		}
+	}
+	return p, lock
+}
+
+// fieldLock returns the lock of the FieldMDP transform parameters or field lock dictionary `d`.
+func fieldLock(d *core.PdfObjectDictionary) *FieldLock {
+	lock := &FieldLock{Action: "All"}
+	if action, ok := core.GetName(d.Get("Action")); ok {
+		lock.Action = string(*action)
+	}
+	if fields, ok := core.GetArray(d.Get("Fields")); ok {
+		for _, f := range fields.Elements() {
+			if s, ok := core.GetString(f); ok {
+				lock.Fields = append(lock.Fields, s.Decoded())
+			}
+		}
+	}
+	return lock
+}
+
+// dssData is the validation data of the document security store.
+type dssData struct {
+	global *vriData
+	vri    map[string]*vriData
+}
+
+// vriData is the validation data of the DSS or of one of its VRI entries.
+type vriData struct {
+	certs []*x509.Certificate
+	crls  [][]byte
+	ocsps [][]byte
+}
+
+// certs returns the certificates of the DSS and of the VRI entry `key`.
+func (dss *dssData) certs(key string) []*x509.Certificate {
+	certs := append([]*x509.Certificate(nil), dss.global.certs...)
+	if vri, ok := dss.vri[key]; ok {
+		certs = append(certs, vri.certs...)
+	}
+	return certs
+}
+
+// revocation returns the revocation data of the VRI entry `key` and the DSS.
+func (dss *dssData) revocation(key string) *revocationData {
+	rd := &revocationData{}
+	if vri, ok := dss.vri[key]; ok {
+		for _, crl := range vri.crls {
+			rd.crls = append(rd.crls, sourced{crl, "vri-crl"})
+		}
+		for _, resp := range vri.ocsps {
+			rd.ocsps = append(rd.ocsps, sourced{resp, "vri-ocsp"})
+		}
+	}
+	for _, crl := range dss.global.crls {
+		rd.crls = append(rd.crls, sourced{crl, "dss-crl"})
+	}
+	for _, resp := range dss.global.ocsps {
+		rd.ocsps = append(rd.ocsps, sourced{resp, "dss-ocsp"})
+	}
+	return rd
+}
+
+// readDSS reads the document security store of the document.
+func (d *document) readDSS() *dssData {
+	store := &dssData{global: &vriData{}, vri: map[string]*vriData{}}
+	dss := d.reader.DSS
+	if dss == nil {
+		return store
+	}
+	store.global = readValidationData(dss.Certs, dss.CRLs, dss.OCSPs)
+	for key, vri := range dss.VRI {
+		store.vri[strings.ToUpper(key)] = readValidationData(vri.Cert, vri.CRL, vri.OCSP)
+	}
+	return store
+}
+
+// readValidationData decodes the certificate, CRL and OCSP response streams of a DSS or VRI
+// dictionary.
+func readValidationData(certs, crls, ocsps []*core.PdfObjectStream) *vriData {
+	decode := func(streams []*core.PdfObjectStream) [][]byte {
+		var result [][]byte
+		for _, stream := range streams {
+			if b, err := core.DecodeStream(stream); err == nil {
+				result = append(result, b)
+			}
+		}
+		return result
+	}
+	data := &vriData{crls: decode(crls), ocsps: decode(ocsps)}
+	for _, der := range decode(certs) {
+		if cert, err := x509.ParseCertificate(der); err == nil {
+			data.certs = append(data.certs, cert)
+		}
+	}
+	return data
+}
@@ -0,0 +1,292 @@
+/*
+ * Certificate chains and offline revocation checking against the CRLs and OCSP responses embedded
+ * in the document (DSS, VRI) and in the signatures.
+ */
+
+package verify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Certificate describes a certificate of a report.
+type Certificate struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	Serial    string    `json:"serial"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	SHA256    string    `json:"sha256"`
+}
+
+// describeCertificate returns the description of `cert`.
+func describeCertificate(cert *x509.Certificate) *Certificate {
+	sum := sha256.Sum256(cert.Raw)
+	return &Certificate{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		Serial:    cert.SerialNumber.Text(16),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		SHA256:    hex.EncodeToString(sum[:]),
+	}
+}
+
+// Revocation statuses.
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+	StatusUnknown = "unknown"
+)
+
+// Revocation is the revocation status of a certificate of the chain.
+type Revocation struct {
+	Subject string `json:"subject"`
+	Status  string `json:"status"`
+	// Source of the status, e.g. "dss-ocsp", "vri-crl" or "signature-crl". Empty if unknown.
+	Source    string     `json:"source,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// ProducedAt is the time of the OCSP response or CRL that gave the status.
+	ProducedAt *time.Time `json:"produced_at,omitempty"`
+	// Detail says why the status is unknown despite revocation data for the certificate, e.g. a CRL
+	// that expired before the validation time.
+	Detail string `json:"detail,omitempty"`
+}
+
+// LoadCertificates loads the PEM or DER encoded certificates of the files and directories `paths`,
+// e.g. a trust store. PEM files can contain several certificates.
+func LoadCertificates(paths ...string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{path}
+		if info.IsDir() {
+			entries, err := ioutil.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			files = nil
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			parsed, err := parseCertificates(data)
+			if err != nil {
+				if info.IsDir() {
+					continue // Not a certificate file.
+				}
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			certs = append(certs, parsed...)
+		}
+	}
+	return certs, nil
+}
+
+// parseCertificates parses the PEM or DER encoded certificates `data`.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		return x509.ParseCertificates(data)
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return certs, nil
+}
+
+// buildChain returns the chain of `signer` up to a root of `roots`, using the certificates
+// `pool` as intermediates, valid at time `at`.
+func buildChain(signer *x509.Certificate, pool []*x509.Certificate, roots *x509.CertPool,
+	at time.Time) ([]*x509.Certificate, error) {
+	intermediates := x509.NewCertPool()
+	for _, cert := range pool {
+		intermediates.AddCert(cert)
+	}
+	chains, err := signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chains[0], nil
+}
+
+// issuerChain returns the chain of `signer` built by issuer names from `pool`, without checking
+// trust, for revocation checking when the chain does not verify.
+func issuerChain(signer *x509.Certificate, pool []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{signer}
+	for cert := signer; len(chain) <= len(pool); {
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			break
+		}
+		var issuer *x509.Certificate
+		for _, candidate := range pool {
+			if bytes.Equal(candidate.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		cert = issuer
+	}
+	return chain
+}
+
+// revocationData is the revocation information available for a signature.
+type revocationData struct {
+	crls  []sourced
+	ocsps []sourced
+}
+
+// sourced is a DER encoded CRL or OCSP response and where it was found.
+type sourced struct {
+	der    []byte
+	source string
+}
+
+// addArchive adds the CRLs and OCSP responses of the adbe-revocationInfoArchival attribute `raw`.
+func (rd *revocationData) addArchive(raw asn1.RawValue) error {
+	var archive revocationArchive
+	if _, err := asn1.Unmarshal(raw.FullBytes, &archive); err != nil {
+		return fmt.Errorf("invalid revocation information attribute: %w", err)
+	}
+	for _, crl := range archive.CRLs {
+		rd.crls = append(rd.crls, sourced{crl.FullBytes, "signature-crl"})
+	}
+	for _, resp := range archive.OCSPs {
+		rd.ocsps = append(rd.ocsps, sourced{resp.FullBytes, "signature-ocsp"})
+	}
+	return nil
+}
+
+// revocationGrace is how long after the validation time revocation data may be issued and still
+// give the status at that time, for the data collected right after signing.
+const revocationGrace = 24 * time.Hour
+
+// check returns the revocation status of `cert` issued by `issuer` at time `at`. A revocation at or
+// before `at` is final, whenever the data was issued. The certificate is good only by data current
+// at `at`, see current.
+func (rd *revocationData) check(cert, issuer *x509.Certificate, at time.Time) *Revocation {
+	status := &Revocation{Subject: cert.Subject.String(), Status: StatusUnknown}
+	var stale error // Why data that shows the certificate good isn't used.
+	for _, resp := range rd.ocsps {
+		r, err := ocsp.ParseResponseForCert(resp.der, cert, issuer)
+		if err != nil {
+			continue // Not a valid response for this certificate.
+		}
+		produced := r.ProducedAt
+		var revokedAt *time.Time
+		switch r.Status {
+		case ocsp.Good:
+		case ocsp.Revoked:
+			revoked := r.RevokedAt
+			revokedAt = &revoked
+			if !revoked.After(at) {
+				status.Status, status.Source, status.ProducedAt = StatusRevoked, resp.source, &produced
+				status.RevokedAt = revokedAt
+				return status
+			}
+		default:
+			continue
+		}
+		if err := current(r.ThisUpdate, r.NextUpdate, at); err != nil {
+			stale = fmt.Errorf("%s response %w", resp.source, err)
+			continue
+		}
+		status.Status, status.Source, status.ProducedAt = StatusGood, resp.source, &produced
+		status.RevokedAt = revokedAt
+	}
+	if status.Status != StatusUnknown {
+		return status
+	}
+
+	for _, c := range rd.crls {
+		crl, err := x509.ParseCRL(c.der)
+		if err != nil || issuer.CheckCRLSignature(crl) != nil {
+			continue // Not a CRL of the issuer.
+		}
+		produced := crl.TBSCertList.ThisUpdate
+		var revokedAt *time.Time
+		for _, entry := range crl.TBSCertList.RevokedCertificates {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+				continue
+			}
+			revoked := entry.RevocationTime
+			revokedAt = &revoked
+			if !revoked.After(at) {
+				status.Status, status.Source, status.ProducedAt = StatusRevoked, c.source, &produced
+				status.RevokedAt = revokedAt
+				return status
+			}
+		}
+		if err := current(crl.TBSCertList.ThisUpdate, crl.TBSCertList.NextUpdate, at); err != nil {
+			stale = fmt.Errorf("%s %w", c.source, err)
+			continue
+		}
+		status.Status, status.Source, status.ProducedAt = StatusGood, c.source, &produced
+		status.RevokedAt = revokedAt
+	}
+	if status.Status == StatusUnknown && stale != nil {
+		status.Detail = stale.Error()
+	}
+	return status
+}
+
+// current returns an error if revocation data issued at `thisUpdate` with the next update at
+// `nextUpdate` (zero if not given) doesn't give the status at `at`: it must not be issued more than
+// revocationGrace after `at` nor expire before it.
+func current(thisUpdate, nextUpdate, at time.Time) error {
+	switch {
+	case thisUpdate.After(at.Add(revocationGrace)):
+		return fmt.Errorf("issued at %s, after the validation time %s", thisUpdate.Format(time.RFC3339),
+			at.Format(time.RFC3339))
+	case !nextUpdate.IsZero() && nextUpdate.Before(at):
+		return fmt.Errorf("expired at %s, before the validation time %s", nextUpdate.Format(time.RFC3339),
+			at.Format(time.RFC3339))
+	}
+	return nil
+}
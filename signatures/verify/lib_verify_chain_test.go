@@ -0,0 +1,154 @@
+package verify
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRevocationCheck(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	at := now.Add(-30 * 24 * time.Hour)
+	ca, caKey := testCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-365 * 24 * time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, nil, nil)
+	cert, _ := testCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    now.Add(-365 * 24 * time.Hour),
+		NotAfter:     now.Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, ca, caKey)
+
+	// crl returns a CRL issued at `thisUpdate` until `nextUpdate`, revoking the certificate at
+	// `revoked` unless it is zero.
+	crl := func(thisUpdate, nextUpdate, revoked time.Time) sourced {
+		var entries []pkix.RevokedCertificate
+		if !revoked.IsZero() {
+			entries = append(entries, pkix.RevokedCertificate{SerialNumber: cert.SerialNumber,
+				RevocationTime: revoked})
+		}
+		der, err := ca.CreateCRL(rand.Reader, caKey, entries, thisUpdate, nextUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sourced{der, "dss-crl"}
+	}
+	// response returns an OCSP response with status `s` issued at `thisUpdate` until `nextUpdate`.
+	response := func(s int, thisUpdate, nextUpdate, revoked time.Time) sourced {
+		der, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       s,
+			SerialNumber: cert.SerialNumber,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   nextUpdate,
+			RevokedAt:    revoked,
+		}, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sourced{der, "dss-ocsp"}
+	}
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		crls    []sourced
+		ocsps   []sourced
+		status  string
+		revoked bool // RevokedAt is set.
+		detail  bool // Detail is set.
+	}{
+		{
+			name:   "no data",
+			status: StatusUnknown,
+		},
+		{
+			name:   "current CRL",
+			crls:   []sourced{crl(at.Add(-day), at.Add(day), time.Time{})},
+			status: StatusGood,
+		},
+		{
+			name:   "CRL issued within the grace period",
+			crls:   []sourced{crl(at.Add(time.Hour), at.Add(7*day), time.Time{})},
+			status: StatusGood,
+		},
+		{
+			name:   "stale CRL",
+			crls:   []sourced{crl(at.Add(-365*day+2*day), at.Add(-300*day), time.Time{})},
+			status: StatusUnknown,
+			detail: true,
+		},
+		{
+			name:   "future CRL",
+			crls:   []sourced{crl(now.Add(-day), now.Add(day), time.Time{})},
+			status: StatusUnknown,
+			detail: true,
+		},
+		{
+			name:   "stale and current CRL",
+			crls:   []sourced{crl(at.Add(-200*day), at.Add(-190*day), time.Time{}), crl(at.Add(-day), at.Add(day), time.Time{})},
+			status: StatusGood,
+		},
+		{
+			name:    "future CRL revoking before the validation time",
+			crls:    []sourced{crl(now.Add(-day), now.Add(day), at.Add(-day))},
+			status:  StatusRevoked,
+			revoked: true,
+		},
+		{
+			name:    "current CRL revoking after the validation time",
+			crls:    []sourced{crl(at.Add(time.Hour), at.Add(day), at.Add(time.Minute))},
+			status:  StatusGood,
+			revoked: true,
+		},
+		{
+			name:   "current OCSP response",
+			ocsps:  []sourced{response(ocsp.Good, at.Add(-time.Hour), at.Add(day), time.Time{})},
+			status: StatusGood,
+		},
+		{
+			name:   "expired OCSP response",
+			ocsps:  []sourced{response(ocsp.Good, at.Add(-10*day), at.Add(-9*day), time.Time{})},
+			status: StatusUnknown,
+			detail: true,
+		},
+		{
+			name:   "future OCSP response",
+			ocsps:  []sourced{response(ocsp.Good, now.Add(-time.Hour), time.Time{}, time.Time{})},
+			status: StatusUnknown,
+			detail: true,
+		},
+		{
+			name:    "future OCSP response revoking before the validation time",
+			ocsps:   []sourced{response(ocsp.Revoked, now.Add(-time.Hour), time.Time{}, at.Add(-time.Hour))},
+			status:  StatusRevoked,
+			revoked: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rd := &revocationData{crls: test.crls, ocsps: test.ocsps}
+			status := rd.check(cert, ca, at)
+			if status.Status != test.status {
+				t.Fatalf("status %s (%s), expected %s", status.Status, status.Detail, test.status)
+			}
+			if (status.RevokedAt != nil) != test.revoked {
+				t.Errorf("revoked at %v", status.RevokedAt)
+			}
+			if (status.Detail != "") != test.detail {
+				t.Errorf("detail %q", status.Detail)
+			}
+		})
+	}
+}
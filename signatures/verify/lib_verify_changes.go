@@ -0,0 +1,698 @@
+/*
+ * Detection and classification of the changes made to a document after a signature, by comparing
+ * the objects of the signed revision with those of the final document.
+ */
+
+package verify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Kinds of changes, from the least to the most restricted.
+const (
+	// KindValidationData: DSS validation data and document timestamps.
+	KindValidationData = "validation-data"
+	// KindUnused: objects no longer or not yet referenced by the document.
+	KindUnused = "unused"
+	// KindMetadata: the document information dictionary and XMP metadata.
+	KindMetadata = "metadata"
+	// KindSignature: new signatures and signature fields.
+	KindSignature = "signature"
+	// KindFormFill: form field values and their appearances.
+	KindFormFill = "form-fill"
+	// KindAnnotation: annotations other than form fields.
+	KindAnnotation = "annotation"
+	// KindPageContent: page contents, resources and the page tree.
+	KindPageContent = "page-content"
+	// KindOther: any other change, e.g. to the catalog or to an earlier signature.
+	KindOther = "other"
+)
+
+// kindRank orders the kinds of changes by how restricted they are.
+var kindRank = map[string]int{
+	KindValidationData: 0,
+	KindUnused:         1,
+	KindMetadata:       2,
+	KindSignature:      3,
+	KindFormFill:       4,
+	KindAnnotation:     5,
+	KindPageContent:    6,
+	KindOther:          7,
+}
+
+// Change is an object changed or added after a signature.
+type Change struct {
+	Object  int64  `json:"object"`
+	Added   bool   `json:"added,omitempty"`
+	Kind    string `json:"kind"`
+	Page    int    `json:"page,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"` // Why the change is not allowed.
+}
+
+// FieldLock is a FieldMDP transform or a signature field lock: the form fields that may not be
+// changed after the signature.
+type FieldLock struct {
+	Action string   `json:"action"` // All, Include or Exclude.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Locks returns true if `lock` locks field `name`. Locking a field locks its descendants.
+func (lock *FieldLock) Locks(name string) bool {
+	listed := false
+	for _, f := range lock.Fields {
+		if name == f || strings.HasPrefix(name, f+".") {
+			listed = true
+			break
+		}
+	}
+	switch lock.Action {
+	case "All":
+		return true
+	case "Include":
+		return listed
+	case "Exclude":
+		return !listed
+	}
+	return false
+}
+
+// label is the kind of change of an object of the final document, with its page and field.
+type label struct {
+	kind  string
+	page  int
+	field string
+}
+
+// document indexes the objects of the final revision of the verified file.
+type document struct {
+	reader  *model.PdfReader
+	labels  map[int64]label
+	reached map[int64]bool // Objects reachable from the catalog.
+	pages   map[int64]int  // Page object numbers to page numbers.
+	sigs    []*sigField    // Signature fields.
+	sigDict map[int64]bool // Object numbers of signature dictionaries.
+	catalog int64
+	form    int64 // Object number of the AcroForm dictionary, 0 if direct.
+	fields  int64 // Object number of the Fields array, 0 if direct.
+}
+
+// sigField is a signature field.
+type sigField struct {
+	name  string
+	value *core.PdfObjectDictionary
+	num   int64 // Object number of the signature dictionary.
+	lock  *core.PdfObjectDictionary
+}
+
+// skipKeys are the keys that point back up the object tree, which the traversals don't follow.
+var skipKeys = map[core.PdfObjectName]bool{
+	"Parent": true, "P": true, "Pg": true, "Data": true, "Dest": true, "Prev": true, "Last": true,
+	"First": true, "Next": true,
+}
+
+// newDocument indexes the final revision read by `reader`.
+func newDocument(reader *model.PdfReader) (*document, error) {
+	d := &document{
+		reader:  reader,
+		labels:  map[int64]label{},
+		reached: map[int64]bool{},
+		pages:   map[int64]int{},
+		sigDict: map[int64]bool{},
+	}
+	trailer, err := reader.GetTrailer()
+	if err != nil {
+		return nil, err
+	}
+	var catalogObj core.PdfObject
+	d.catalog, catalogObj = d.resolve(trailer.Get("Root"))
+	catalog, ok := core.GetDict(catalogObj)
+	if !ok {
+		return nil, fmt.Errorf("missing catalog")
+	}
+	d.walk(trailer, func(num int64) bool {
+		if d.reached[num] {
+			return false
+		}
+		d.reached[num] = true
+		return true
+	})
+
+	d.mark(trailer.Get("Info"), label{kind: KindMetadata})
+	d.mark(catalog.Get("Metadata"), label{kind: KindMetadata})
+	d.mark(catalog.Get("DSS"), label{kind: KindValidationData})
+	if dss := reader.DSS; dss != nil {
+		// The reader takes the streams out of the DSS dictionary.
+		streams := append(append(append([]*core.PdfObjectStream(nil), dss.Certs...), dss.CRLs...), dss.OCSPs...)
+		for _, vri := range dss.VRI {
+			streams = append(append(append(streams, vri.Cert...), vri.CRL...), vri.OCSP...)
+		}
+		for _, stream := range streams {
+			d.mark(stream, label{kind: KindValidationData})
+		}
+	}
+	d.mark(catalog.Get("Perms"), label{kind: KindSignature})
+
+	var formObj core.PdfObject
+	d.form, formObj = d.resolve(catalog.Get("AcroForm"))
+	if form, ok := core.GetDict(formObj); ok {
+		d.mark(form.Get("DR"), label{kind: KindFormFill})
+		var fieldsObj core.PdfObject
+		d.fields, fieldsObj = d.resolve(form.Get("Fields"))
+		if fields, ok := core.GetArray(fieldsObj); ok {
+			for _, field := range fields.Elements() {
+				d.indexField(field, "", "")
+			}
+		}
+	}
+
+	pageNum := 0
+	d.indexPages(catalog.Get("Pages"), &pageNum)
+	return d, nil
+}
+
+// resolve returns the object number of `obj`, 0 for direct objects, and its direct object.
+func (d *document) resolve(obj core.PdfObject) (int64, core.PdfObject) {
+	switch t := obj.(type) {
+	case *core.PdfObjectReference:
+		o, err := d.reader.GetIndirectObjectByNumber(int(t.ObjectNumber))
+		if err != nil {
+			return t.ObjectNumber, nil
+		}
+		_, direct := d.resolve(o)
+		return t.ObjectNumber, direct
+	case *core.PdfIndirectObject:
+		return t.ObjectNumber, t.PdfObject
+	case *core.PdfObjectStream:
+		return t.ObjectNumber, t
+	}
+	return 0, obj
+}
+
+// object returns the direct object of object `num`.
+func (d *document) object(num int64) core.PdfObject {
+	obj, err := d.reader.GetIndirectObjectByNumber(int(num))
+	if err != nil {
+		return nil
+	}
+	return d.direct(obj)
+}
+
+// direct returns the direct object of `obj`.
+func (d *document) direct(obj core.PdfObject) core.PdfObject {
+	_, direct := d.resolve(obj)
+	return direct
+}
+
+// walk calls `visit` with the number of each indirect object reachable from `obj`, not following
+// the skipKeys. The objects `visit` returns false for are not followed.
+func (d *document) walk(obj core.PdfObject, visit func(num int64) bool) {
+	num, direct := d.resolve(obj)
+	if num != 0 && !visit(num) {
+		return
+	}
+	switch t := direct.(type) {
+	case *core.PdfObjectDictionary:
+		for _, key := range t.Keys() {
+			if !skipKeys[key] {
+				d.walk(t.Get(key), visit)
+			}
+		}
+	case *core.PdfObjectStream:
+		d.walk(t.PdfObjectDictionary, visit)
+	case *core.PdfObjectArray:
+		for _, elem := range t.Elements() {
+			d.walk(elem, visit)
+		}
+	}
+}
+
+// mark labels the objects reachable from `obj` with `l`, unless they already have a more
+// restricted label.
+func (d *document) mark(obj core.PdfObject, l label) {
+	seen := map[int64]bool{}
+	d.walk(obj, func(num int64) bool {
+		if seen[num] {
+			return false
+		}
+		seen[num] = true
+		if old, ok := d.labels[num]; !ok || kindRank[l.kind] > kindRank[old.kind] {
+			d.labels[num] = l
+		}
+		return true
+	})
+}
+
+// indexField labels form field `obj` with the full name of its parent `parent` and the inherited
+// field type `ft`, and records signature fields.
+func (d *document) indexField(obj core.PdfObject, parent, ft string) {
+	num, direct := d.resolve(obj)
+	field, ok := core.GetDict(direct)
+	if !ok {
+		return
+	}
+	name := parent
+	if t, ok := core.GetString(field.Get("T")); ok {
+		if name != "" {
+			name += "."
+		}
+		name += t.Decoded()
+	}
+	if t, ok := core.GetName(field.Get("FT")); ok {
+		ft = string(*t)
+	}
+
+	kind := KindFormFill
+	if ft == "Sig" {
+		kind = KindSignature
+		if v, ok := core.GetDict(d.direct(field.Get("V"))); ok {
+			sigNum, _ := d.resolve(field.Get("V"))
+			d.sigDict[sigNum] = true
+			lock, _ := core.GetDict(d.direct(field.Get("Lock")))
+			d.sigs = append(d.sigs, &sigField{name: name, value: v, num: sigNum, lock: lock})
+			if t, ok := core.GetName(v.Get("Type")); ok && *t == "DocTimeStamp" {
+				kind = KindValidationData
+			}
+		}
+	}
+	if kids, ok := core.GetArray(d.direct(field.Get("Kids"))); ok {
+		for _, kid := range kids.Elements() {
+			kidDict, ok := core.GetDict(d.direct(kid))
+			if !ok {
+				continue
+			}
+			if kidDict.Get("T") != nil || kidDict.Get("FT") != nil {
+				d.indexField(kid, name, ft)
+			} else {
+				d.mark(kid, label{kind: kind, field: name})
+			}
+		}
+	}
+	// Label the field dictionary itself, without its kids, which are labeled above.
+	if num != 0 {
+		if old, ok := d.labels[num]; !ok || kindRank[kind] > kindRank[old.kind] {
+			d.labels[num] = label{kind: kind, field: name}
+		}
+	}
+	for _, key := range field.Keys() {
+		if key != "Kids" && !skipKeys[key] {
+			d.mark(field.Get(key), label{kind: kind, field: name})
+		}
+	}
+}
+
+// indexPages numbers the pages of page tree node `obj` and labels their contents and annotations.
+func (d *document) indexPages(obj core.PdfObject, pageNum *int) {
+	num, direct := d.resolve(obj)
+	node, ok := core.GetDict(direct)
+	if !ok {
+		return
+	}
+	if t, ok := core.GetName(node.Get("Type")); ok && *t == "Pages" {
+		d.labels[num] = label{kind: KindPageContent}
+		d.mark(node.Get("Resources"), label{kind: KindPageContent})
+		if kids, ok := core.GetArray(d.direct(node.Get("Kids"))); ok {
+			for _, kid := range kids.Elements() {
+				d.indexPages(kid, pageNum)
+			}
+		}
+		return
+	}
+
+	*pageNum++
+	d.pages[num] = *pageNum
+	d.labels[num] = label{kind: KindPageContent, page: *pageNum}
+	for _, key := range node.Keys() {
+		if key != "Annots" && !skipKeys[key] {
+			d.mark(node.Get(key), label{kind: KindPageContent, page: *pageNum})
+		}
+	}
+	annotsNum, annotsObj := d.resolve(node.Get("Annots"))
+	if annotsNum != 0 {
+		d.labels[annotsNum] = label{kind: KindAnnotation, page: *pageNum}
+	}
+	annots, _ := core.GetArray(annotsObj)
+	if annots == nil {
+		return
+	}
+	for _, annot := range annots.Elements() {
+		annotNum, annotObj := d.resolve(annot)
+		dict, ok := core.GetDict(annotObj)
+		if !ok {
+			continue
+		}
+		if t, ok := core.GetName(dict.Get("Subtype")); ok && *t == "Widget" {
+			// Labeled with the field, only the page is added.
+			if l, ok := d.labels[annotNum]; ok {
+				l.page = *pageNum
+				d.labels[annotNum] = l
+			}
+			continue
+		}
+		d.mark(annot, label{kind: KindAnnotation, page: *pageNum})
+	}
+}
+
+// fingerprint returns a canonical form of object `num` of `reader`, comparable between revisions,
+// and false if there is no such object.
+func fingerprint(reader *model.PdfReader, num int64) (string, bool) {
+	obj, err := reader.GetIndirectObjectByNumber(int(num))
+	if err != nil || obj == nil {
+		return "", false
+	}
+	var b bytes.Buffer
+	switch t := obj.(type) {
+	case *core.PdfIndirectObject:
+		canonical(&b, t.PdfObject)
+	case *core.PdfObjectStream:
+		canonical(&b, t.PdfObjectDictionary)
+		sum := sha256.Sum256(t.Stream)
+		b.Write(sum[:])
+	default:
+		canonical(&b, obj)
+	}
+	return b.String(), true
+}
+
+// canonical writes `obj` with sorted dictionary keys and indirect objects as references.
+func canonical(b *bytes.Buffer, obj core.PdfObject) {
+	switch t := obj.(type) {
+	case nil:
+		b.WriteString("null")
+	case *core.PdfObjectReference:
+		fmt.Fprintf(b, "%d R", t.ObjectNumber)
+	case *core.PdfIndirectObject:
+		fmt.Fprintf(b, "%d R", t.ObjectNumber)
+	case *core.PdfObjectStream:
+		fmt.Fprintf(b, "%d R", t.ObjectNumber)
+	case *core.PdfObjectDictionary:
+		keys := t.Keys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		b.WriteString("<<")
+		for _, key := range keys {
+			b.WriteString("/" + string(key) + " ")
+			canonical(b, t.Get(key))
+			b.WriteString(" ")
+		}
+		b.WriteString(">>")
+	case *core.PdfObjectArray:
+		b.WriteString("[")
+		for _, elem := range t.Elements() {
+			canonical(b, elem)
+			b.WriteString(" ")
+		}
+		b.WriteString("]")
+	default:
+		b.WriteString(obj.WriteString())
+	}
+}
+
+// changes returns the objects of the final document `d` that differ from those of the earlier
+// revision `prev`, labeled with their kind.
+func (d *document) changes(prev *model.PdfReader) []*Change {
+	var changes []*Change
+	for _, n := range d.reader.GetObjectNums() {
+		num := int64(n)
+		current, ok := fingerprint(d.reader, num)
+		if !ok {
+			continue
+		}
+		old, existed := fingerprint(prev, num)
+		if existed && old == current {
+			continue
+		}
+		c := &Change{Object: num, Added: !existed}
+		l, labeled := d.labels[num]
+		switch {
+		case existed && d.sigDict[num]:
+			c.Kind = KindOther // An earlier signature was changed.
+		case num == d.catalog:
+			c.Kind = d.catalogChange(prev)
+		case num == d.form || num == d.fields:
+			c.Kind = d.formChange(prev)
+		case labeled && d.pages[num] != 0 && existed:
+			c.Kind, c.Page = d.pageChange(prev, num), l.page
+		case labeled:
+			c.Kind, c.Page, c.Field = l.kind, l.page, l.field
+		case d.reached[num]:
+			c.Kind = KindOther
+		default:
+			c.Kind = KindUnused
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// pageChange returns the kind of change of page `num`: the page content unless only its
+// annotations changed.
+func (d *document) pageChange(prev *model.PdfReader, num int64) string {
+	current, _ := core.GetDict(d.object(num))
+	p := &document{reader: prev}
+	old, _ := core.GetDict(p.object(num))
+	if current == nil || old == nil {
+		return KindPageContent
+	}
+	var a, b bytes.Buffer
+	canonical(&a, withoutKey(current, "Annots"))
+	canonical(&b, withoutKey(old, "Annots"))
+	if a.String() != b.String() {
+		return KindPageContent
+	}
+
+	// Only the annotations changed: the kind of the added annotations.
+	previous := map[int64]bool{}
+	if annots, ok := core.GetArray(p.direct(old.Get("Annots"))); ok {
+		for _, annot := range annots.Elements() {
+			n, _ := p.resolve(annot)
+			previous[n] = true
+		}
+	}
+	kind := KindAnnotation
+	added := false
+	if annots, ok := core.GetArray(d.direct(current.Get("Annots"))); ok {
+		for _, annot := range annots.Elements() {
+			n, _ := d.resolve(annot)
+			if previous[n] {
+				continue
+			}
+			l, ok := d.labels[n]
+			if !ok {
+				continue
+			}
+			if !added || kindRank[l.kind] > kindRank[kind] {
+				kind = l.kind
+			}
+			added = true
+		}
+	}
+	return kind
+}
+
+// catalogChange returns the kind of change of the catalog, by the entries that changed.
+func (d *document) catalogChange(prev *model.PdfReader) string {
+	p := &document{reader: prev}
+	current, _ := core.GetDict(d.object(d.catalog))
+	old, _ := core.GetDict(p.object(d.catalog))
+	if current == nil || old == nil {
+		return KindOther
+	}
+	entryKinds := map[core.PdfObjectName]string{
+		"DSS":      KindValidationData,
+		"Metadata": KindMetadata,
+		"Perms":    KindSignature,
+		"AcroForm": KindSignature,
+	}
+	kind := KindValidationData
+	keys := append(current.Keys(), old.Keys()...)
+	for _, key := range keys {
+		var a, b bytes.Buffer
+		canonical(&a, current.Get(key))
+		canonical(&b, old.Get(key))
+		if a.String() == b.String() {
+			continue
+		}
+		k, ok := entryKinds[key]
+		if !ok {
+			return KindOther
+		}
+		if key == "AcroForm" && old.Get(key) != nil {
+			k = d.formChange(prev) // A direct form dictionary.
+		}
+		if kindRank[k] > kindRank[kind] {
+			kind = k
+		}
+	}
+	return kind
+}
+
+// formChange returns the kind of change of the AcroForm dictionary or its Fields array: the kind
+// of the fields added or removed, and form filling if other entries changed.
+func (d *document) formChange(prev *model.PdfReader) string {
+	p := &document{reader: prev}
+	fieldNums := func(doc *document) (map[int64]bool, *core.PdfObjectDictionary) {
+		nums := map[int64]bool{}
+		catalog, _ := core.GetDict(doc.object(d.catalog))
+		if catalog == nil {
+			return nums, nil
+		}
+		form, _ := core.GetDict(doc.direct(catalog.Get("AcroForm")))
+		if form == nil {
+			return nums, nil
+		}
+		if fields, ok := core.GetArray(doc.direct(form.Get("Fields"))); ok {
+			for _, field := range fields.Elements() {
+				n, _ := doc.resolve(field)
+				nums[n] = true
+			}
+		}
+		return nums, form
+	}
+	current, currentForm := fieldNums(d)
+	old, oldForm := fieldNums(p)
+
+	kind := KindSignature
+	for n := range current {
+		if l, ok := d.labels[n]; ok && !old[n] && kindRank[l.kind] > kindRank[kind] {
+			kind = l.kind
+		}
+	}
+	for n := range old {
+		if !current[n] {
+			kind = KindFormFill
+		}
+	}
+	if currentForm != nil && oldForm != nil {
+		for _, key := range append(currentForm.Keys(), oldForm.Keys()...) {
+			if key == "Fields" || key == "SigFlags" {
+				continue
+			}
+			var a, b bytes.Buffer
+			canonical(&a, currentForm.Get(key))
+			canonical(&b, oldForm.Get(key))
+			if a.String() != b.String() && kindRank[KindFormFill] > kindRank[kind] {
+				kind = KindFormFill
+			}
+		}
+	}
+	return kind
+}
+
+// withoutKey returns a copy of `dict` without `key`.
+func withoutKey(dict *core.PdfObjectDictionary, key core.PdfObjectName) *core.PdfObjectDictionary {
+	c := core.MakeDict()
+	for _, k := range dict.Keys() {
+		if k != key {
+			c.Set(k, dict.Get(k))
+		}
+	}
+	return c
+}
+
+// judge decides whether `c` is allowed with DocMDP permission `p` (0 if the document is not
+// certified) and the field locks `locks`. Changes to the page content and other changes are never
+// allowed, annotations are allowed unless P is 1 or 2, new signatures and form filling unless P
+// is 1. Validation data, metadata and unused objects are always allowed.
+func judge(c *Change, p int, locks []*FieldLock) {
+	c.Allowed = true
+	switch c.Kind {
+	case KindSignature:
+		if p == 1 {
+			c.Allowed, c.Reason = false, "DocMDP P=1 allows no signatures"
+		}
+	case KindFormFill:
+		if p == 1 {
+			c.Allowed, c.Reason = false, "DocMDP P=1 allows no form filling"
+			return
+		}
+		for _, lock := range locks {
+			if c.Field != "" && lock.Locks(c.Field) {
+				c.Allowed, c.Reason = false, fmt.Sprintf("field %s is locked", c.Field)
+				return
+			}
+		}
+	case KindAnnotation:
+		if p == 1 || p == 2 {
+			c.Allowed, c.Reason = false, fmt.Sprintf("DocMDP P=%d allows no annotation changes", p)
+		}
+	case KindPageContent:
+		c.Allowed, c.Reason = false, "page content changed after signing"
+	case KindOther:
+		c.Allowed, c.Reason = false, "document structure changed after signing"
+	}
+}
+
+// Permissions returns the DocMDP permission P of the certification signature of the document read
+// by `reader` (0 if it is not certified) and the FieldMDP locks of its signatures.
+func Permissions(reader *model.PdfReader) (int, []*FieldLock, error) {
+	d, err := newDocument(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	p, locks := d.permissions()
+	return p, locks, nil
+}
+
+// permissions returns the DocMDP permission and the FieldMDP locks of the signatures of `d`.
+func (d *document) permissions() (int, []*FieldLock) {
+	p := 0
+	var locks []*FieldLock
+	for _, sf := range d.sigs {
+		docMDP, lock := d.references(sf.value)
+		if docMDP != 0 && p == 0 {
+			p = docMDP
+		}
+		if lock == nil && sf.lock != nil {
+			lock = fieldLock(sf.lock)
+		}
+		if lock != nil {
+			locks = append(locks, lock)
+		}
+	}
+	return p, locks
+}
+
+// CheckUpdate returns the changes that the incremental updates appended to `original` in
+// `updated` make, judged against the DocMDP permission and the FieldMDP locks of the signatures of
+// `original`. Signers use it to refuse updates that would invalidate earlier signatures.
+func CheckUpdate(original, updated []byte, password string) ([]*Change, error) {
+	if !bytes.HasPrefix(updated, original) {
+		return nil, errors.New("not an incremental update of the original file")
+	}
+	prev, err := openRevision(original, password)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := openRevision(updated, password)
+	if err != nil {
+		return nil, err
+	}
+	before, err := newDocument(prev)
+	if err != nil {
+		return nil, err
+	}
+	d, err := newDocument(reader)
+	if err != nil {
+		return nil, err
+	}
+	p, locks := before.permissions()
+	changes := d.changes(prev)
+	for _, c := range changes {
+		if len(before.sigs) == 0 {
+			c.Allowed = true // Nothing is signed yet.
+			continue
+		}
+		judge(c, p, locks)
+	}
+	return changes, nil
+}
@@ -0,0 +1,523 @@
+/*
+ * CMS (PKCS#7) signed data: parsing and verification of the signatures of signer infos and of
+ * RFC 3161 timestamp tokens.
+ */
+
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	// Register the hash functions of the digest algorithms.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// Object identifiers of CMS content types, attributes and algorithms.
+var (
+	oidSignedData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttrContentType       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidAttrTimestampToken    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidAttrRevocationArchive = asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8}
+	oidRSASSAPSS             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+)
+
+// hashes maps the object identifiers of digest algorithms, and of the signature algorithms that
+// some signers put in their place, to hash functions.
+var hashes = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, crypto.SHA1},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 4}, crypto.SHA224},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, crypto.SHA1},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, crypto.SHA256},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, crypto.SHA384},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, crypto.SHA512},
+}
+
+// hashForOID returns the hash function of digest algorithm `oid`.
+func hashForOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for _, h := range hashes {
+		if h.oid.Equal(oid) {
+			return h.hash, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %s", oid)
+}
+
+// hashName returns the name of `hash`.
+func hashName(hash crypto.Hash) string {
+	switch hash {
+	case crypto.SHA1:
+		return "SHA-1"
+	case crypto.SHA224:
+		return "SHA-224"
+	case crypto.SHA256:
+		return "SHA-256"
+	case crypto.SHA384:
+		return "SHA-384"
+	case crypto.SHA512:
+		return "SHA-512"
+	}
+	return hash.String()
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type pssParameters struct {
+	Hash pkix.AlgorithmIdentifier `asn1:"explicit,optional,tag:0"`
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// revocationArchive is the Adobe revocation information attribute (adbe-revocationInfoArchival).
+type revocationArchive struct {
+	CRLs  []asn1.RawValue `asn1:"explicit,optional,tag:0"`
+	OCSPs []asn1.RawValue `asn1:"explicit,optional,tag:1"`
+	Other []asn1.RawValue `asn1:"explicit,optional,tag:2"`
+}
+
+// TSTInfo is the content of an RFC 3161 timestamp token.
+type TSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint MessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       Accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"explicit,optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// MessageImprint is the digest of the data of a timestamp token.
+type MessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// Accuracy is the accuracy of the genTime of a timestamp token. It is typed as a raw value would
+// match any element, e.g. the nonce of tokens without accuracy.
+type Accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// Duration returns the accuracy as a duration, 0 if it is not given.
+func (a Accuracy) Duration() time.Duration {
+	return time.Duration(a.Seconds)*time.Second + time.Duration(a.Millis)*time.Millisecond +
+		time.Duration(a.Micros)*time.Microsecond
+}
+
+// ParseTSTInfo parses the DER encoded TSTInfo `data`, the content of a timestamp token.
+func ParseTSTInfo(data []byte) (*TSTInfo, error) {
+	var info TSTInfo
+	if _, err := asn1.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid TSTInfo: %w", err)
+	}
+	return &info, nil
+}
+
+// cms is a parsed CMS signed data structure.
+type cms struct {
+	sd       signedData
+	content  []byte // Encapsulated content, nil if detached.
+	certs    []*x509.Certificate
+	crls     [][]byte
+	signer   *signerInfo
+	attrs    []attribute // Signed attributes of the signer.
+	unsigned []attribute
+}
+
+// parseCMS parses the DER encoded CMS content info `data`, which may be followed by padding, with
+// a single signer.
+func parseCMS(data []byte) (*cms, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(data, &ci); err != nil {
+		return nil, fmt.Errorf("invalid CMS content info: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("CMS content type %s is not signed data", ci.ContentType)
+	}
+	// Explicitly tagged raw values keep the tag, the tagged element is their content.
+	c := &cms{}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &c.sd); err != nil {
+		return nil, fmt.Errorf("invalid CMS signed data: %w", err)
+	}
+	if len(c.sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("CMS signed data has %d signers, expected 1", len(c.sd.SignerInfos))
+	}
+	c.signer = &c.sd.SignerInfos[0]
+
+	if eContent := c.sd.EncapContentInfo.EContent; len(eContent.Bytes) > 0 {
+		var raw asn1.RawValue
+		_, err := asn1.Unmarshal(eContent.Bytes, &raw)
+		var content []byte
+		if err == nil {
+			content, err = octets(raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CMS content: %w", err)
+		}
+		c.content = content
+	}
+	for rest := c.sd.Certificates.Bytes; len(rest) > 0; {
+		var raw asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &raw); err != nil {
+			return nil, fmt.Errorf("invalid CMS certificates: %w", err)
+		}
+		if raw.Class != asn1.ClassUniversal {
+			continue // Attribute or other certificate types.
+		}
+		cert, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CMS certificate: %w", err)
+		}
+		c.certs = append(c.certs, cert)
+	}
+	for rest := c.sd.CRLs.Bytes; len(rest) > 0; {
+		var raw asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &raw); err != nil {
+			return nil, fmt.Errorf("invalid CMS CRLs: %w", err)
+		}
+		if raw.Class == asn1.ClassUniversal {
+			c.crls = append(c.crls, raw.FullBytes)
+		}
+	}
+
+	var err error
+	if c.attrs, err = parseAttributes(c.signer.SignedAttrs); err != nil {
+		return nil, fmt.Errorf("invalid signed attributes: %w", err)
+	}
+	if c.unsigned, err = parseAttributes(c.signer.UnsignedAttrs); err != nil {
+		return nil, fmt.Errorf("invalid unsigned attributes: %w", err)
+	}
+	return c, nil
+}
+
+// octets returns the content of the OCTET STRING `raw`, which may be constructed.
+func octets(raw asn1.RawValue) ([]byte, error) {
+	if !raw.IsCompound {
+		var b []byte
+		_, err := asn1.Unmarshal(raw.FullBytes, &b)
+		return b, err
+	}
+	var content []byte
+	for rest := raw.Bytes; len(rest) > 0; {
+		var part asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &part); err != nil {
+			return nil, err
+		}
+		b, err := octets(part)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, b...)
+	}
+	return content, nil
+}
+
+// parseAttributes parses the implicitly tagged attribute set `raw`.
+func parseAttributes(raw asn1.RawValue) ([]attribute, error) {
+	if len(raw.FullBytes) == 0 {
+		return nil, nil
+	}
+	var attrs []attribute
+	_, err := asn1.UnmarshalWithParams(asSet(raw.FullBytes), &attrs, "set")
+	return attrs, err
+}
+
+// asSet returns the implicitly tagged attribute set `der` with the SET tag, as it is signed.
+func asSet(der []byte) []byte {
+	set := append([]byte(nil), der...)
+	set[0] = 0x31
+	return set
+}
+
+// findAttribute returns the first value of attribute `oid` in `attrs`.
+func findAttribute(attrs []attribute, oid asn1.ObjectIdentifier) (asn1.RawValue, bool) {
+	for _, a := range attrs {
+		if a.Type.Equal(oid) && len(a.Values) > 0 {
+			return a.Values[0], true
+		}
+	}
+	return asn1.RawValue{}, false
+}
+
+// signerCert returns the certificate of the signer.
+func (c *cms) signerCert() (*x509.Certificate, error) {
+	sid := c.signer.SID
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, cert := range c.certs {
+			if bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+		return nil, errors.New("no certificate for the signer's subject key identifier")
+	}
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil, fmt.Errorf("invalid signer identifier: %w", err)
+	}
+	for _, cert := range c.certs {
+		if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.Serial) == 0 {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("no certificate for the signer's issuer and serial number")
+}
+
+// digestAlgorithm returns the hash function of the signer's digest algorithm.
+func (c *cms) digestAlgorithm() (crypto.Hash, error) {
+	return hashForOID(c.signer.DigestAlgorithm.Algorithm)
+}
+
+// signingTime returns the signing time attribute, which is claimed by the signer.
+func (c *cms) signingTime() (time.Time, bool) {
+	raw, ok := findAttribute(c.attrs, oidAttrSigningTime)
+	if !ok {
+		return time.Time{}, false
+	}
+	var t time.Time
+	if _, err := asn1.Unmarshal(raw.FullBytes, &t); err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// verify checks that the signer signed `content` (the encapsulated content when `content` is
+// nil) and returns the signer's certificate. The digest error, if any, is returned separately
+// from the signature error, as a wrong digest means that the signed data was changed.
+func (c *cms) verify(content []byte) (cert *x509.Certificate, digestErr, sigErr error) {
+	if content == nil {
+		content = c.content
+	}
+	hash, err := c.digestAlgorithm()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cert, err = c.signerCert(); err != nil {
+		return nil, nil, err
+	}
+
+	h := hash.New()
+	h.Write(content)
+	digest := h.Sum(nil)
+	signed := content
+	if len(c.attrs) > 0 {
+		raw, ok := findAttribute(c.attrs, oidAttrMessageDigest)
+		if !ok {
+			return cert, errors.New("missing message digest attribute"), nil
+		}
+		var md []byte
+		if _, err := asn1.Unmarshal(raw.FullBytes, &md); err != nil {
+			return cert, fmt.Errorf("invalid message digest attribute: %w", err), nil
+		}
+		if !bytes.Equal(md, digest) {
+			return cert, errors.New("message digest does not match the signed data"), nil
+		}
+		if raw, ok := findAttribute(c.attrs, oidAttrContentType); ok {
+			var ct asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(raw.FullBytes, &ct); err != nil || !ct.Equal(c.sd.EncapContentInfo.EContentType) {
+				return cert, nil, errors.New("content type attribute does not match the content")
+			}
+		}
+		signed = asSet(c.signer.SignedAttrs.FullBytes)
+	}
+	return cert, nil, verifySignature(cert.PublicKey, hash, c.signer.SignatureAlgorithm, signed,
+		c.signer.Signature)
+}
+
+// verifySignature checks `signature` of `signed` with public key `pub`. `hash` is the digest
+// algorithm, RSASSA-PSS parameters may override it.
+func verifySignature(pub crypto.PublicKey, hash crypto.Hash, alg pkix.AlgorithmIdentifier, signed,
+	signature []byte) error {
+	pss := alg.Algorithm.Equal(oidRSASSAPSS)
+	if pss {
+		var params pssParameters
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return fmt.Errorf("invalid RSASSA-PSS parameters: %w", err)
+		}
+		hash = crypto.SHA1 // Default of the parameters.
+		if len(params.Hash.Algorithm) > 0 {
+			h, err := hashForOID(params.Hash.Algorithm)
+			if err != nil {
+				return err
+			}
+			hash = h
+		}
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if pss {
+			return rsa.VerifyPSS(key, hash, digest, signature,
+				&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: hash})
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		var sig ecdsaSignature
+		if _, err := asn1.Unmarshal(signature, &sig); err != nil {
+			return fmt.Errorf("invalid ECDSA signature: %w", err)
+		}
+		if !ecdsa.Verify(key, digest, sig.R, sig.S) {
+			return errors.New("ECDSA verification failure")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// signatureAlgorithm returns the name of the signature scheme of signature algorithm `alg` with
+// public key `pub` and the size of the key, e.g. RSA-2048 or ECDSA-P-256.
+func signatureAlgorithm(pub crypto.PublicKey, alg pkix.AlgorithmIdentifier) string {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if alg.Algorithm.Equal(oidRSASSAPSS) {
+			return fmt.Sprintf("RSASSA-PSS-%d", key.N.BitLen())
+		}
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + key.Curve.Params().Name
+	}
+	return fmt.Sprintf("%T", pub)
+}
+
+// timestampToken returns the signature timestamp token of the signer, nil if there is none.
+func (c *cms) timestampToken() []byte {
+	raw, ok := findAttribute(c.unsigned, oidAttrTimestampToken)
+	if !ok {
+		return nil
+	}
+	return raw.FullBytes
+}
+
+// parseTimestamp parses the RFC 3161 timestamp token `data` and returns it with its TSTInfo.
+func parseTimestamp(data []byte) (*cms, *TSTInfo, error) {
+	token, err := parseCMS(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !token.sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, nil, fmt.Errorf("timestamp token content type %s is not TSTInfo",
+			token.sd.EncapContentInfo.EContentType)
+	}
+	info, err := ParseTSTInfo(token.content)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, info, nil
+}
+
+// checkImprint checks that the message imprint of `info` is the digest of `data`.
+func (info *TSTInfo) checkImprint(data []byte) error {
+	hash, err := hashForOID(info.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), info.MessageImprint.HashedMessage) {
+		return errors.New("timestamp message imprint does not match")
+	}
+	return nil
+}
+
+// SignatureCertificates are the certificates of a CMS signature.
+type SignatureCertificates struct {
+	// Signer is the certificate of the signer.
+	Signer *x509.Certificate
+	// Certs are the certificates embedded in the signature.
+	Certs []*x509.Certificate
+	// TimestampSigner is the certificate of the timestamp authority of the signature timestamp,
+	// nil if there is none.
+	TimestampSigner *x509.Certificate
+	// TimestampCerts are the certificates embedded in the signature timestamp token.
+	TimestampCerts []*x509.Certificate
+}
+
+// ParseSignatureCertificates returns the certificates of the CMS signature `contents`, e.g. the
+// Contents of a signature dictionary, and of its signature timestamp token. It doesn't verify
+// them.
+func ParseSignatureCertificates(contents []byte) (*SignatureCertificates, error) {
+	c, err := parseCMS(contents)
+	if err != nil {
+		return nil, err
+	}
+	sc := &SignatureCertificates{Certs: c.certs}
+	if sc.Signer, err = c.signerCert(); err != nil {
+		return nil, err
+	}
+	if token := c.timestampToken(); token != nil {
+		if tc, err := parseCMS(token); err == nil {
+			sc.TimestampCerts = tc.certs
+			sc.TimestampSigner, _ = tc.signerCert()
+		}
+	}
+	return sc, nil
+}
@@ -0,0 +1,49 @@
+package verify
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestTrustedTime(t *testing.T) {
+	now := time.Now()
+	genTime := now.Add(-24 * time.Hour)
+	tsa, key, root := testTSA(t, now.Add(-48*time.Hour), now.Add(time.Hour))
+	_, _, otherRoot := testTSA(t, now.Add(-48*time.Hour), now.Add(time.Hour))
+	data := []byte("signature value")
+	token := testToken(t, testTSTInfo(data, genTime), tsa, key)
+
+	tests := []struct {
+		name  string
+		roots []*x509.Certificate
+		data  []byte
+		ok    bool
+	}{
+		{"trusted", []*x509.Certificate{root}, data, true},
+		{"no trust anchors", nil, data, false},
+		{"other trust anchor", []*x509.Certificate{otherRoot}, data, false},
+		{"other data", []*x509.Certificate{root}, []byte("other"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roots, err := trustPool(test.roots, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at, err := trustedTime(token, test.data, nil, roots)
+			if test.ok {
+				if err != nil {
+					t.Fatalf("not trusted: %v", err)
+				}
+				if !at.Equal(genTime.Truncate(time.Second)) {
+					t.Errorf("time %s, expected %s", at, genTime)
+				}
+				return
+			}
+			if err == nil || !at.IsZero() {
+				t.Errorf("trusted at %s, expected an error", at)
+			}
+		})
+	}
+}
@@ -0,0 +1,470 @@
+/*
+ * Full validation of RFC 3161 timestamp tokens against local trust anchors, with one check per
+ * requirement so that the result can be logged for audits.
+ */
+
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Object identifiers of the ESS signing certificate attributes and of the time stamping key
+// purpose.
+var (
+	oidAttrSigningCertificate   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidAttrSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidExtKeyUsage              = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// TimestampOptions configures the validation of timestamp tokens.
+type TimestampOptions struct {
+	// Roots are the trust anchors of the timestamp authorities.
+	Roots []*x509.Certificate
+	// SystemRoots adds the trust anchors of the system.
+	SystemRoots bool
+	// Intermediates are additional certificates for building the chains of the authorities.
+	Intermediates []*x509.Certificate
+	// SigningTime is the time claimed by the signer of the timestamped data, which genTime must not
+	// precede. ValidateTimestamps takes it from the signatures.
+	SigningTime time.Time
+	// Tolerance is the allowed clock difference between the signer and the timestamp authority,
+	// in addition to the accuracy of the token.
+	Tolerance time.Duration
+	// MaxDelay, if set, is the longest accepted time from the signing time to genTime.
+	MaxDelay time.Duration
+	// Nonce, if set, is the nonce of the timestamp request, which the token must repeat.
+	Nonce *big.Int
+	// Policies, if set, are the accepted TSA policy object identifiers, e.g. "1.2.3.4.1".
+	Policies []string
+	// Password decrypts encrypted files.
+	Password string
+}
+
+// Timestamp check names, in the order of the checks.
+const (
+	CheckToken          = "token"
+	CheckMessageImprint = "message-imprint"
+	CheckSignature      = "signature"
+	CheckESSCertID      = "ess-cert-id"
+	CheckTSACertificate = "tsa-certificate"
+	CheckTSAChain       = "tsa-chain"
+	CheckGenTime        = "gen-time"
+	CheckNonce          = "nonce"
+	CheckPolicy         = "policy"
+)
+
+// Timestamp check results.
+const (
+	CheckPassed  = "passed"
+	CheckFailed  = "failed"
+	CheckSkipped = "skipped"
+)
+
+// TimestampCheck is the result of a check of a timestamp token.
+type TimestampCheck struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// TimestampValidation is the result of the validation of a timestamp token. The status is valid
+// if all checks pass or are skipped except tsa-chain, indeterminate if only tsa-chain fails or is
+// skipped (no trust anchors), and invalid otherwise.
+type TimestampValidation struct {
+	// Field is the signature field of a timestamp of a document.
+	Field string `json:"field,omitempty"`
+	// Kind is "document" for a document timestamp (ETSI.RFC3161) and "signature" for the
+	// signature timestamp of a CMS signature.
+	Kind   string `json:"kind,omitempty"`
+	Status string `json:"status"`
+
+	GenTime time.Time `json:"gen_time"`
+	// Accuracy of genTime, e.g. "1s".
+	Accuracy      string     `json:"accuracy,omitempty"`
+	Policy        string     `json:"policy,omitempty"`
+	SerialNumber  string     `json:"serial_number,omitempty"`
+	Nonce         string     `json:"nonce,omitempty"`
+	HashAlgorithm string     `json:"hash_algorithm,omitempty"` // Of the message imprint.
+	SigningTime   *time.Time `json:"signing_time,omitempty"`   // Claimed by the signer.
+
+	Signer *Certificate      `json:"signer,omitempty"` // Certificate of the timestamp authority.
+	Chain  []*Certificate    `json:"chain,omitempty"`
+	Checks []*TimestampCheck `json:"checks"`
+}
+
+func (tv *TimestampValidation) check(name, result, format string, a ...interface{}) {
+	tv.Checks = append(tv.Checks, &TimestampCheck{Name: name, Result: result, Detail: fmt.Sprintf(format, a...)})
+}
+
+// Check returns the check `name` of `tv`, nil if it wasn't made.
+func (tv *TimestampValidation) Check(name string) *TimestampCheck {
+	for _, c := range tv.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// ValidateTimestamp validates the RFC 3161 timestamp token `token` of `data`, the timestamped
+// data: the message imprint, the signature of the token and its ESS signing certificate binding,
+// the certificate of the timestamp authority and its chain to a trust anchor of `opts` at genTime,
+// genTime against the signing time, and the nonce and policy if `opts` sets them.
+func ValidateTimestamp(token, data []byte, opts TimestampOptions) *TimestampValidation {
+	tv := &TimestampValidation{}
+	if !opts.SigningTime.IsZero() {
+		t := opts.SigningTime
+		tv.SigningTime = &t
+	}
+	roots, err := trustPool(opts.Roots, opts.SystemRoots)
+	if err != nil {
+		tv.check(CheckTSAChain, CheckFailed, "%v", err)
+	}
+	tv.validate(token, data, roots, opts)
+	tv.setStatus()
+	return tv
+}
+
+// validate makes the checks of ValidateTimestamp with the trust anchors `roots`.
+func (tv *TimestampValidation) validate(token, data []byte, roots *x509.CertPool, opts TimestampOptions) {
+	c, info, err := parseTimestamp(token)
+	if err != nil {
+		tv.check(CheckToken, CheckFailed, "%v", err)
+		return
+	}
+	tv.check(CheckToken, CheckPassed, "TSTInfo version %d", info.Version)
+	tv.GenTime = info.GenTime
+	tv.Policy = info.Policy.String()
+	tv.SerialNumber = info.SerialNumber.Text(16)
+	if info.Nonce != nil {
+		tv.Nonce = info.Nonce.Text(16)
+	}
+	accuracy := info.Accuracy.Duration()
+	if accuracy > 0 {
+		tv.Accuracy = accuracy.String()
+	}
+
+	if hash, err := hashForOID(info.MessageImprint.HashAlgorithm.Algorithm); err == nil {
+		tv.HashAlgorithm = hashName(hash)
+	}
+	if err := info.checkImprint(data); err != nil {
+		tv.check(CheckMessageImprint, CheckFailed, "%v", err)
+	} else {
+		tv.check(CheckMessageImprint, CheckPassed, "%s digest of the timestamped data", tv.HashAlgorithm)
+	}
+
+	signer, digestErr, sigErr := c.verify(nil)
+	switch {
+	case signer == nil:
+		tv.check(CheckSignature, CheckFailed, "%v", sigErr)
+		return
+	case digestErr != nil:
+		tv.check(CheckSignature, CheckFailed, "%v", digestErr)
+	case sigErr != nil:
+		tv.check(CheckSignature, CheckFailed, "%v", sigErr)
+	default:
+		tv.check(CheckSignature, CheckPassed, "signed by %s", signer.Subject)
+	}
+	tv.Signer = describeCertificate(signer)
+
+	if err := c.checkSigningCertificate(signer); err != nil {
+		tv.check(CheckESSCertID, CheckFailed, "%v", err)
+	} else {
+		tv.check(CheckESSCertID, CheckPassed, "the signing certificate attribute identifies the TSA certificate")
+	}
+
+	if err := checkTSACertificate(signer); err != nil {
+		tv.check(CheckTSACertificate, CheckFailed, "%v", err)
+	} else {
+		tv.check(CheckTSACertificate, CheckPassed, "critical extended key usage time stamping")
+	}
+
+	pool := append(append([]*x509.Certificate(nil), c.certs...), opts.Intermediates...)
+	var chain []*x509.Certificate
+	switch {
+	case tv.Check(CheckTSAChain) != nil:
+		// The trust anchors couldn't be loaded.
+	case roots == nil:
+		tv.check(CheckTSAChain, CheckSkipped, "no trust anchors given")
+	default:
+		if chain, err = buildChain(signer, pool, roots, info.GenTime); err != nil {
+			tv.check(CheckTSAChain, CheckFailed, "%v", err)
+		} else {
+			tv.check(CheckTSAChain, CheckPassed, "chain of %d certificates to %s at genTime", len(chain),
+				chain[len(chain)-1].Subject)
+		}
+	}
+	if chain == nil {
+		chain = issuerChain(signer, append(pool, opts.Roots...))
+	}
+	for _, cert := range chain {
+		tv.Chain = append(tv.Chain, describeCertificate(cert))
+	}
+
+	tv.checkGenTime(info.GenTime, accuracy, opts)
+
+	switch {
+	case opts.Nonce == nil:
+		tv.check(CheckNonce, CheckSkipped, "no nonce expected")
+	case info.Nonce == nil:
+		tv.check(CheckNonce, CheckFailed, "the token has no nonce")
+	case info.Nonce.Cmp(opts.Nonce) != 0:
+		tv.check(CheckNonce, CheckFailed, "nonce %s does not match the request nonce %s", tv.Nonce,
+			opts.Nonce.Text(16))
+	default:
+		tv.check(CheckNonce, CheckPassed, "nonce %s", tv.Nonce)
+	}
+
+	switch {
+	case len(opts.Policies) == 0:
+		tv.check(CheckPolicy, CheckSkipped, "no policies given, the token has policy %s", tv.Policy)
+	case !containsString(opts.Policies, tv.Policy):
+		tv.check(CheckPolicy, CheckFailed, "policy %s is not accepted", tv.Policy)
+	default:
+		tv.check(CheckPolicy, CheckPassed, "policy %s", tv.Policy)
+	}
+}
+
+// checkGenTime checks genTime `genTime`, of accuracy `accuracy`, against the signing time and the
+// current time.
+func (tv *TimestampValidation) checkGenTime(genTime time.Time, accuracy time.Duration, opts TimestampOptions) {
+	margin := accuracy + opts.Tolerance
+	if genTime.Add(-margin).After(time.Now()) {
+		tv.check(CheckGenTime, CheckFailed, "genTime %s is in the future", genTime.Format(time.RFC3339))
+		return
+	}
+	if tv.SigningTime == nil {
+		tv.check(CheckGenTime, CheckSkipped, "no signing time")
+		return
+	}
+	delay := genTime.Sub(*tv.SigningTime)
+	switch {
+	case delay+margin < 0:
+		tv.check(CheckGenTime, CheckFailed, "genTime %s precedes the signing time %s by %s",
+			genTime.Format(time.RFC3339), tv.SigningTime.Format(time.RFC3339), -delay)
+	case opts.MaxDelay > 0 && delay-margin > opts.MaxDelay:
+		tv.check(CheckGenTime, CheckFailed, "genTime %s is %s after the signing time, more than %s",
+			genTime.Format(time.RFC3339), delay, opts.MaxDelay)
+	default:
+		tv.check(CheckGenTime, CheckPassed, "genTime %s is %s after the signing time",
+			genTime.Format(time.RFC3339), delay)
+	}
+}
+
+// setStatus sets the status of `tv` from its checks.
+func (tv *TimestampValidation) setStatus() {
+	tv.Status = Valid
+	for _, c := range tv.Checks {
+		switch {
+		case c.Name == CheckTSAChain && c.Result != CheckPassed:
+			if tv.Status == Valid {
+				tv.Status = Indeterminate
+			}
+		case c.Result == CheckFailed:
+			tv.Status = Invalid
+		}
+	}
+}
+
+// checkSigningCertificate checks that the ESS signing certificate attribute (RFC 2634 or, v2, RFC
+// 5035) of the signer of `c` identifies `cert`. The first certificate ID is that of the signer.
+func (c *cms) checkSigningCertificate(cert *x509.Certificate) error {
+	hash, name := crypto.SHA1, "signing certificate"
+	raw, ok := findAttribute(c.attrs, oidAttrSigningCertificate)
+	if v2, ok2 := findAttribute(c.attrs, oidAttrSigningCertificateV2); ok2 {
+		raw, ok = v2, true
+		hash, name = crypto.SHA256, "signing certificate v2" // Default hash algorithm of v2.
+	}
+	if !ok {
+		return errors.New("missing ESS signing certificate attribute")
+	}
+	var sc struct {
+		Certs    []asn1.RawValue
+		Policies asn1.RawValue `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(raw.FullBytes, &sc); err != nil || len(sc.Certs) == 0 {
+		return fmt.Errorf("invalid %s attribute", name)
+	}
+
+	// ESSCertID: certHash, issuerSerial OPTIONAL. ESSCertIDv2: hashAlgorithm DEFAULT SHA-256,
+	// certHash, issuerSerial OPTIONAL.
+	rest := sc.Certs[0].Bytes
+	var elem asn1.RawValue
+	var err error
+	if rest, err = asn1.Unmarshal(rest, &elem); err != nil {
+		return fmt.Errorf("invalid %s attribute: %w", name, err)
+	}
+	if elem.Tag == asn1.TagSequence {
+		var alg struct{ Algorithm asn1.ObjectIdentifier }
+		if _, err := asn1.Unmarshal(elem.FullBytes, &alg); err != nil {
+			return fmt.Errorf("invalid %s hash algorithm: %w", name, err)
+		}
+		if hash, err = hashForOID(alg.Algorithm); err != nil {
+			return err
+		}
+		if rest, err = asn1.Unmarshal(rest, &elem); err != nil {
+			return fmt.Errorf("invalid %s attribute: %w", name, err)
+		}
+	}
+	if elem.Tag != asn1.TagOctetString {
+		return fmt.Errorf("invalid %s attribute: no certificate hash", name)
+	}
+	h := hash.New()
+	h.Write(cert.Raw)
+	if !bytes.Equal(h.Sum(nil), elem.Bytes) {
+		return fmt.Errorf("%s hash does not match the TSA certificate", hashName(hash))
+	}
+
+	if len(rest) == 0 {
+		return nil
+	}
+	var is struct {
+		Issuer asn1.RawValue // GeneralNames.
+		Serial *big.Int
+	}
+	if _, err := asn1.Unmarshal(rest, &is); err != nil {
+		return fmt.Errorf("invalid %s issuer serial: %w", name, err)
+	}
+	if is.Serial.Cmp(cert.SerialNumber) != 0 {
+		return fmt.Errorf("%s serial number does not match the TSA certificate", name)
+	}
+	for names := is.Issuer.Bytes; len(names) > 0; {
+		var gn asn1.RawValue
+		if names, err = asn1.Unmarshal(names, &gn); err != nil {
+			return fmt.Errorf("invalid %s issuer: %w", name, err)
+		}
+		// directoryName [4] Name.
+		if gn.Class == asn1.ClassContextSpecific && gn.Tag == 4 && !bytes.Equal(gn.Bytes, cert.RawIssuer) {
+			return fmt.Errorf("%s issuer does not match the TSA certificate", name)
+		}
+	}
+	return nil
+}
+
+// checkTSACertificate checks that `cert` may sign timestamps: RFC 3161 requires a critical
+// extended key usage extension with time stamping as the only key purpose.
+func checkTSACertificate(cert *x509.Certificate) error {
+	critical := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtKeyUsage) {
+			critical = ext.Critical
+		}
+	}
+	timeStamping := false
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageTimeStamping {
+			timeStamping = true
+		}
+	}
+	switch {
+	case !timeStamping:
+		return errors.New("the TSA certificate has no time stamping extended key usage")
+	case len(cert.ExtKeyUsage)+len(cert.UnknownExtKeyUsage) > 1:
+		return errors.New("the TSA certificate has other extended key usages than time stamping")
+	case !critical:
+		return errors.New("the extended key usage extension of the TSA certificate is not critical")
+	}
+	return nil
+}
+
+// ValidateTimestamps validates the timestamps of the PDF file `data` with ValidateTimestamp, in
+// the order the signatures were applied: the document timestamps and the signature timestamps of
+// the CMS signatures. The certificates of the DSS complete the chains and the signing time of a
+// signature timestamp is the one claimed by its signature, unless `opts` sets one.
+func ValidateTimestamps(data []byte, opts TimestampOptions) ([]*TimestampValidation, error) {
+	reader, err := openRevision(data, opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	d, err := newDocument(reader)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := trustPool(opts.Roots, opts.SystemRoots)
+	if err != nil {
+		return nil, err
+	}
+	store := d.readDSS()
+
+	sigs := append([]*sigField(nil), d.sigs...)
+	sort.SliceStable(sigs, func(i, j int) bool { return byteRangeEnd(sigs[i].value) < byteRangeEnd(sigs[j].value) })
+
+	var validations []*TimestampValidation
+	for _, sf := range sigs {
+		contents, ok := core.GetString(sf.value.Get("Contents"))
+		if !ok {
+			continue
+		}
+		value := contents.Bytes()
+		h := sha1.Sum(value)
+		vriKey := strings.ToUpper(hex.EncodeToString(h[:]))
+		fieldOpts := opts
+		fieldOpts.Intermediates = append(store.certs(vriKey), opts.Intermediates...)
+
+		var token, timestamped []byte
+		var kind string
+		subFilter, _ := core.GetName(sf.value.Get("SubFilter"))
+		switch {
+		case subFilter == nil:
+			continue
+		case *subFilter == "ETSI.RFC3161":
+			if timestamped, err = signedBytes(data, byteRange(sf.value)); err != nil {
+				continue
+			}
+			token, kind = value, "document"
+		default:
+			c, err := parseCMS(value)
+			if err != nil {
+				continue
+			}
+			if token = c.timestampToken(); token == nil {
+				continue
+			}
+			timestamped, kind = c.signer.Signature, "signature"
+			if fieldOpts.SigningTime.IsZero() {
+				if t, ok := c.signingTime(); ok {
+					fieldOpts.SigningTime = t
+				} else if m, ok := core.GetString(sf.value.Get("M")); ok {
+					if date, err := model.NewPdfDate(m.Decoded()); err == nil {
+						fieldOpts.SigningTime = date.ToGoTime()
+					}
+				}
+			}
+		}
+
+		tv := &TimestampValidation{Field: sf.name, Kind: kind}
+		if !fieldOpts.SigningTime.IsZero() {
+			t := fieldOpts.SigningTime
+			tv.SigningTime = &t
+		}
+		tv.validate(token, timestamped, roots, fieldOpts)
+		tv.setStatus()
+		validations = append(validations, tv)
+	}
+	return validations, nil
+}
+
+// containsString returns true if `list` contains `s`.
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,252 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var (
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidTimeStamping    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+)
+
+// testCertificate returns a certificate for `template` and its key, issued by `parent` with
+// `parentKey`, or self-signed if `parent` is nil.
+func testCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate,
+	parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// testTSA returns the certificate and key of a timestamp authority issued by a new root, and the
+// root, valid from `notBefore` to `notAfter`.
+func testTSA(t *testing.T, notBefore, notAfter time.Time) (tsa *x509.Certificate,
+	key crypto.Signer, root *x509.Certificate) {
+	root, rootKey := testCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, nil, nil)
+	eku, err := asn1.Marshal([]asn1.ObjectIdentifier{oidTimeStamping})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsa, key = testCertificate(t, &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: "Test TSA"},
+		NotBefore:       notBefore,
+		NotAfter:        notAfter,
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: oidExtKeyUsage, Critical: true, Value: eku}},
+	}, root, rootKey)
+	return tsa, key, root
+}
+
+// testToken returns a timestamp token of `info` signed by `cert` with `key`.
+func testToken(t *testing.T, info TSTInfo, cert *x509.Certificate, key crypto.Signer) []byte {
+	content, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(content)
+	certHash := sha256.Sum256(cert.Raw)
+	signingCert, err := asn1.Marshal(struct {
+		Certs []struct{ CertHash []byte }
+	}{Certs: []struct{ CertHash []byte }{{CertHash: certHash[:]}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attrs []byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidAttrContentType, oidTSTInfo},
+		{oidAttrMessageDigest, digest[:]},
+		{oidAttrSigningCertificateV2, asn1.RawValue{FullBytes: signingCert}},
+	} {
+		value, err := asn1.Marshal(a.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := asn1.Marshal(attribute{Type: a.oid, Values: []asn1.RawValue{{FullBytes: value}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		attrs = append(attrs, der...)
+	}
+	signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(signed)
+	signature, err := key.Sign(rand.Reader, h[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer},
+		Serial: cert.SerialNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eContent, err := asn1.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapContentInfo{
+			EContentType: oidTSTInfo,
+			EContent:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: eContent},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// testTSTInfo returns the TSTInfo of a timestamp of `data` at `genTime`.
+func testTSTInfo(data []byte, genTime time.Time) TSTInfo {
+	digest := sha256.Sum256(data)
+	return TSTInfo{
+		Version: 1,
+		Policy:  asn1.ObjectIdentifier{1, 2, 3},
+		MessageImprint: MessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			HashedMessage: digest[:],
+		},
+		SerialNumber: big.NewInt(1),
+		GenTime:      genTime.UTC().Truncate(time.Second),
+	}
+}
+
+func TestParseTSTInfo(t *testing.T) {
+	nonce := big.NewInt(12345)
+	tests := []struct {
+		name     string
+		accuracy Accuracy
+		nonce    *big.Int
+		duration time.Duration
+	}{
+		{"accuracy and nonce", Accuracy{Seconds: 2, Millis: 5, Micros: 7}, nonce, 2005007 * time.Microsecond},
+		{"nonce only", Accuracy{}, nonce, 0},
+		{"accuracy only", Accuracy{Millis: 250}, nil, 250 * time.Millisecond},
+		{"neither", Accuracy{}, nil, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := testTSTInfo([]byte("data"), time.Now())
+			info.Accuracy = test.accuracy
+			info.Nonce = test.nonce
+			data, err := asn1.Marshal(info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParseTSTInfo(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Accuracy != test.accuracy {
+				t.Errorf("accuracy %+v, expected %+v", parsed.Accuracy, test.accuracy)
+			}
+			if d := parsed.Accuracy.Duration(); d != test.duration {
+				t.Errorf("accuracy duration %s, expected %s", d, test.duration)
+			}
+			if (parsed.Nonce == nil) != (test.nonce == nil) ||
+				parsed.Nonce != nil && parsed.Nonce.Cmp(test.nonce) != 0 {
+				t.Errorf("nonce %v, expected %v", parsed.Nonce, test.nonce)
+			}
+		})
+	}
+}
+
+func TestValidateTimestampNonce(t *testing.T) {
+	now := time.Now()
+	tsa, key, root := testTSA(t, now.Add(-time.Hour), now.Add(time.Hour))
+	data := []byte("signature value")
+	nonce := big.NewInt(0x1234)
+	tests := []struct {
+		name     string
+		accuracy Accuracy
+		nonce    *big.Int
+		result   string
+		shown    string
+	}{
+		{"accuracy and nonce", Accuracy{Seconds: 1}, nonce, CheckPassed, "1s"},
+		{"nonce only", Accuracy{}, nonce, CheckPassed, ""},
+		{"neither", Accuracy{}, nil, CheckFailed, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := testTSTInfo(data, now)
+			info.Accuracy = test.accuracy
+			info.Nonce = test.nonce
+			token := testToken(t, info, tsa, key)
+
+			tv := ValidateTimestamp(token, data, TimestampOptions{
+				Roots:       []*x509.Certificate{root},
+				SigningTime: now.Add(-time.Minute),
+				Nonce:       nonce,
+			})
+			check := tv.Check(CheckNonce)
+			if check == nil || check.Result != test.result {
+				t.Fatalf("nonce check %+v, expected %s", check, test.result)
+			}
+			if tv.Accuracy != test.shown {
+				t.Errorf("accuracy %q, expected %q", tv.Accuracy, test.shown)
+			}
+			for _, c := range tv.Checks {
+				if c.Name != CheckNonce && c.Result != CheckPassed && c.Result != CheckSkipped {
+					t.Errorf("check %s %s: %s", c.Name, c.Result, c.Detail)
+				}
+			}
+		})
+	}
+}
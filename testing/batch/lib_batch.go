@@ -0,0 +1,452 @@
+/*
+ * Package batch processes many PDF files concurrently. Inputs are given as glob patterns or
+ * directories, the files are processed by a bounded pool of workers with an optional timeout per
+ * file, and the results are appended to a manifest as they complete so an interrupted run can be
+ * resumed without redoing the files finished with the same operation and output path. A summary of successes, failures and timings can be
+ * written as JSON or CSV.
+ *
+ * Generalizes the sequential file handling of the benchmarks in this directory.
+ * Used by pdftool batch.
+ */
+
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result status values.
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusTimeout = "timeout"
+	StatusSkipped = "skipped" // Already completed in a previous run according to the manifest.
+)
+
+// ErrTimeout is returned for files that were not processed within Options.Timeout.
+var ErrTimeout = errors.New("timeout")
+
+// File is an input file.
+type File struct {
+	Path string // Path of the file.
+	Rel  string // Path relative to the directory or glob it was found in. Used to name outputs.
+}
+
+// Job is the processing of a single file.
+type Job struct {
+	File
+	Output string // Output path derived from Options.OutputDir and Options.OutputExt.
+}
+
+// Func processes `job`. It returns an optional short description of the result, e.g. sizes.
+// Long running functions should stop when `ctx` is done.
+type Func func(ctx context.Context, job Job) (string, error)
+
+// Options controls a batch run.
+type Options struct {
+	// Workers is the number of files processed concurrently. Defaults to the number of CPUs.
+	Workers int
+	// Timeout is the maximum processing time per file. 0 for no limit. The processing of a file
+	// that timed out is abandoned and its result ignored, but the Func keeps running until it
+	// returns unless it stops when its context is done. At most Workers abandoned calls run at a
+	// time: further files wait for one of them to return.
+	Timeout time.Duration
+	// Manifest is the path of the manifest file. Files recorded as successfully processed in an
+	// existing manifest, with the same Operation to the same output path, are skipped. Empty for no
+	// manifest.
+	Manifest string
+	// Operation identifies what the Func does, including options that change its outputs, e.g.
+	// "render -dpi 150". It is recorded in the manifest.
+	Operation string
+	// OutputDir is the directory outputs are written to, mirroring the relative paths of the inputs.
+	OutputDir string
+	// OutputExt replaces the extension of the input file name in the output path. An empty
+	// OutputExt results in output paths without extension, e.g. directories for rendered pages.
+	OutputExt string
+	// Progress receives a line per processed file if not nil.
+	Progress io.Writer
+}
+
+// Result is the outcome of processing a file.
+type Result struct {
+	Input     string  `json:"input"`
+	Operation string  `json:"operation,omitempty"`
+	Output    string  `json:"output,omitempty"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	Detail    string  `json:"detail,omitempty"`
+	Duration  float64 `json:"duration_ms"`
+}
+
+// Expand returns the PDF files matching `patterns`. A pattern is either a directory, which is
+// searched recursively for files with extension .pdf, or a glob pattern. Each file is returned once,
+// sorted by path. Files with the same relative path, such as a/x.pdf and b/x.pdf matched by
+// "*/x.pdf", would have the same output: an error is returned for them.
+func Expand(patterns []string) ([]File, error) {
+	seen := map[string]bool{}
+	used := map[string]string{}
+	var files []File
+	add := func(path, rel string) error {
+		if seen[absPath(path)] {
+			return nil
+		}
+		seen[absPath(path)] = true
+		// Outputs replace the extension, and file systems may ignore case.
+		key := strings.ToLower(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		if prev, ok := used[key]; ok {
+			return fmt.Errorf("%s and %s have the same output name %s: process them separately", prev, path, rel)
+		}
+		used[key] = path
+		files = append(files, File{Path: path, Rel: rel})
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+			root := pattern
+			err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.Mode().IsRegular() || !strings.EqualFold(filepath.Ext(path), ".pdf") {
+					return nil
+				}
+				rel, err := filepath.Rel(root, path)
+				if err != nil {
+					return err
+				}
+				return add(path, rel)
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", pattern)
+		}
+		for _, path := range matches {
+			if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			if err := add(path, filepath.Base(path)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// Run processes `files` with `fn` and returns the results in the order of `files`. Files that were
+// not started because `ctx` was cancelled are missing from the results; the run can be resumed with
+// the same manifest. The error is only non-nil if the manifest could not be read or written.
+func Run(ctx context.Context, files []File, fn Func, opts Options) ([]Result, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	done := map[string]Result{}
+	var manifest *os.File
+	if opts.Manifest != "" {
+		var err error
+		done, err = ReadManifest(opts.Manifest)
+		if err != nil {
+			return nil, err
+		}
+		manifest, err = os.OpenFile(opts.Manifest, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		defer manifest.Close()
+	}
+
+	results := make([]*Result, len(files))
+	var (
+		mu          sync.Mutex
+		manifestErr error
+		completed   int
+	)
+	record := func(i int, res Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = &res
+		completed++
+		if opts.Progress != nil {
+			fmt.Fprintf(opts.Progress, "[%d/%d] %-7s %s (%.0f ms)", completed, len(files), res.Status, res.Input, res.Duration)
+			if res.Error != "" {
+				fmt.Fprintf(opts.Progress, ": %s", res.Error)
+			}
+			fmt.Fprintln(opts.Progress)
+		}
+		if manifest == nil || res.Status == StatusSkipped || manifestErr != nil {
+			return
+		}
+		data, err := json.Marshal(res)
+		if err == nil {
+			_, err = manifest.Write(append(data, '\n'))
+		}
+		if err == nil {
+			err = manifest.Sync()
+		}
+		manifestErr = err
+	}
+
+	jobs := make(chan int)
+	abandoned := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				record(i, process(ctx, files[i], fn, opts, abandoned))
+			}
+		}()
+	}
+
+feed:
+	for i, file := range files {
+		key := manifestKey(file.Path, opts.Operation, outputPath(file, opts))
+		if prev, ok := done[key]; ok && prev.Status == StatusOK {
+			prev.Status = StatusSkipped
+			prev.Duration = 0
+			record(i, prev)
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var out []Result
+	for _, res := range results {
+		if res != nil {
+			out = append(out, *res)
+		}
+	}
+	return out, manifestErr
+}
+
+// process runs `fn` for `file`, enforcing the timeout. An abandoned call of `fn` holds a slot of
+// `abandoned` until it returns, waiting for one if all are taken.
+func process(ctx context.Context, file File, fn Func, opts Options, abandoned chan struct{}) Result {
+	job := Job{File: file, Output: outputPath(file, opts)}
+	res := Result{Input: file.Path, Operation: opts.Operation, Output: job.Output}
+	start := time.Now()
+
+	if job.Output != "" {
+		if err := os.MkdirAll(filepath.Dir(job.Output), 0755); err != nil {
+			res.Status = StatusFailed
+			res.Error = err.Error()
+			return res
+		}
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		detail string
+		err    error
+	}
+	ch := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				ch <- outcome{err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+		detail, err := fn(ctx, job)
+		ch <- outcome{detail: detail, err: err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-ch:
+	case <-ctx.Done():
+		abandoned <- struct{}{}
+		go func() {
+			<-ch
+			<-abandoned
+		}()
+		o.err = ctx.Err()
+		if errors.Is(o.err, context.DeadlineExceeded) {
+			o.err = ErrTimeout
+		}
+	}
+
+	res.Duration = float64(time.Since(start)) / float64(time.Millisecond)
+	res.Detail = o.detail
+	switch {
+	case o.err == nil:
+		res.Status = StatusOK
+	case errors.Is(o.err, ErrTimeout):
+		res.Status = StatusTimeout
+		res.Error = o.err.Error()
+	default:
+		res.Status = StatusFailed
+		res.Error = o.err.Error()
+	}
+	return res
+}
+
+// outputPath returns the output path of `file`.
+func outputPath(file File, opts Options) string {
+	if opts.OutputDir == "" {
+		return ""
+	}
+	rel := strings.TrimSuffix(file.Rel, filepath.Ext(file.Rel)) + opts.OutputExt
+	return filepath.Join(opts.OutputDir, rel)
+}
+
+// ReadManifest reads the manifest at `path` and returns the last result per input file, operation
+// and output path, keyed by the absolute input path, the operation and the absolute output path
+// joined by newlines. A missing manifest is not an error.
+func ReadManifest(path string) (map[string]Result, error) {
+	done := map[string]Result{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var res Result
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			// An interrupted write leaves a partial last line.
+			continue
+		}
+		done[manifestKey(res.Input, res.Operation, res.Output)] = res
+	}
+	return done, scanner.Err()
+}
+
+// manifestKey returns the key of the result of processing input `input` with `operation` to
+// `output` in the manifest.
+func manifestKey(input, operation, output string) string {
+	if output != "" {
+		output = absPath(output)
+	}
+	return absPath(input) + "\n" + operation + "\n" + output
+}
+
+// absPath returns the absolute path of `path`, or `path` if it can't be determined.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Summary counts the results by status.
+type Summary struct {
+	Total    int     `json:"total"`
+	OK       int     `json:"ok"`
+	Failed   int     `json:"failed"`
+	Timeout  int     `json:"timeout"`
+	Skipped  int     `json:"skipped"`
+	Duration float64 `json:"duration_ms"` // Sum of the processing times.
+}
+
+// Summarize returns the summary of `results`.
+func Summarize(results []Result) Summary {
+	s := Summary{Total: len(results)}
+	for _, res := range results {
+		switch res.Status {
+		case StatusOK:
+			s.OK++
+		case StatusFailed:
+			s.Failed++
+		case StatusTimeout:
+			s.Timeout++
+		case StatusSkipped:
+			s.Skipped++
+		}
+		s.Duration += res.Duration
+	}
+	return s
+}
+
+// WriteJSON writes the summary and `results` as a JSON document to `w`.
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(struct {
+		Summary Summary  `json:"summary"`
+		Results []Result `json:"results"`
+	}{Summarize(results), results})
+}
+
+// WriteCSV writes `results` as CSV with a header row to `w`.
+func WriteCSV(w io.Writer, results []Result) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"input", "output", "status", "error", "detail", "duration_ms"}); err != nil {
+		return err
+	}
+	for _, res := range results {
+		record := []string{
+			res.Input, res.Output, res.Status, res.Error, res.Detail,
+			strconv.FormatFloat(res.Duration, 'f', 1, 64),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteSummaryFile writes `results` to `path` as CSV if it has extension .csv, as JSON otherwise.
+func WriteSummaryFile(path string, results []Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = WriteCSV(f, results)
+	} else {
+		err = WriteJSON(f, results)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,215 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tempFiles creates the empty files `names` in a new temporary directory and returns it. The caller
+// removes it.
+func tempFiles(t *testing.T, names ...string) string {
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExpand(t *testing.T) {
+	dir := tempFiles(t, "a/x.pdf", "a/y.PDF", "a/notes.txt", "b/x.pdf", "c/X.pdf", "c/x.txt")
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name     string
+		patterns []string
+		rels     []string // Relative paths of the files.
+		conflict bool
+	}{
+		{
+			name:     "directory",
+			patterns: []string{filepath.Join(dir, "a")},
+			rels:     []string{"x.pdf", "y.PDF"},
+		},
+		{
+			name:     "same files twice",
+			patterns: []string{filepath.Join(dir, "a"), filepath.Join(dir, "a", "*.pdf")},
+			rels:     []string{"x.pdf", "y.PDF"},
+		},
+		{
+			name:     "directories",
+			patterns: []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")},
+			conflict: true,
+		},
+		{
+			name:     "glob",
+			patterns: []string{filepath.Join(dir, "*", "x.pdf")},
+			conflict: true,
+		},
+		{
+			name:     "case",
+			patterns: []string{filepath.Join(dir, "a", "x.pdf"), filepath.Join(dir, "c", "X.pdf")},
+			conflict: true,
+		},
+		{
+			name:     "parent directory",
+			patterns: []string{dir},
+			rels: []string{filepath.Join("a", "x.pdf"), filepath.Join("a", "y.PDF"),
+				filepath.Join("b", "x.pdf"), filepath.Join("c", "X.pdf")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := Expand(test.patterns)
+			if test.conflict {
+				if err == nil || !strings.Contains(err.Error(), "same output name") {
+					t.Fatalf("got %v (%v), want an output name conflict", files, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rels []string
+			for _, f := range files {
+				rels = append(rels, f.Rel)
+			}
+			if !reflect.DeepEqual(rels, test.rels) {
+				t.Errorf("got %q, want %q", rels, test.rels)
+			}
+		})
+	}
+}
+
+func TestRunManifest(t *testing.T) {
+	dir := tempFiles(t, "in/1.pdf", "in/2.pdf", "in/3.pdf")
+	defer os.RemoveAll(dir)
+	files, err := Expand([]string{filepath.Join(dir, "in")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(dir, "manifest.jsonl")
+
+	var mu sync.Mutex
+	var processed []string
+	fn := func(ctx context.Context, job Job) (string, error) {
+		mu.Lock()
+		processed = append(processed, filepath.Base(job.Output))
+		mu.Unlock()
+		if job.Rel == "2.pdf" && !strings.Contains(job.Output, "retry") {
+			return "", errors.New("broken")
+		}
+		return "", nil
+	}
+
+	tests := []struct {
+		name      string
+		operation string
+		outputDir string
+		processed int
+		skipped   int
+	}{
+		{"first run", "optimize", "out", 3, 0},
+		{"same run", "optimize", "out", 1, 2},
+		{"other operation", "grayscale", "out", 3, 0},
+		{"other output directory", "optimize", "retry", 3, 0},
+		{"all done", "optimize", "retry", 0, 3},
+	}
+	for _, test := range tests {
+		processed = nil
+		opts := Options{
+			Workers:   2,
+			Manifest:  manifest,
+			Operation: test.operation,
+			OutputDir: filepath.Join(dir, test.outputDir),
+			OutputExt: ".pdf",
+		}
+		results, err := Run(context.Background(), files, fn, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		s := Summarize(results)
+		if len(processed) != test.processed || s.Skipped != test.skipped || s.Total != len(files) {
+			t.Errorf("%s: got %d processed (%q) and %d skipped, want %d and %d", test.name, len(processed),
+				processed, s.Skipped, test.processed, test.skipped)
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	files := make([]File, 6)
+	for i := range files {
+		files[i] = File{Path: filepath.Join("in", string(rune('a'+i))+".pdf")}
+	}
+
+	// The calls ignore their context and return when released.
+	release := make(chan struct{})
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	fn := func(ctx context.Context, job Job) (string, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "", nil
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		close(release)
+	}()
+
+	const workers = 2
+	results, err := Run(context.Background(), files, fn, Options{Workers: workers, Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Summarize(results)
+	if s.Timeout == 0 || s.Timeout+s.OK != len(files) {
+		t.Errorf("got %+v, want timeouts", s)
+	}
+	for _, res := range results {
+		if res.Status == StatusTimeout && res.Error != ErrTimeout.Error() {
+			t.Errorf("%s: got error %q, want %q", res.Input, res.Error, ErrTimeout)
+		}
+	}
+	// Each worker runs a call and holds an abandoned one at most.
+	mu.Lock()
+	defer mu.Unlock()
+	if maxRunning > 2*workers {
+		t.Errorf("got %d calls running at a time, want at most %d", maxRunning, 2*workers)
+	}
+}
+
+func TestRunPanic(t *testing.T) {
+	fn := func(ctx context.Context, job Job) (string, error) {
+		panic("boom")
+	}
+	results, err := Run(context.Background(), []File{{Path: "in.pdf"}}, fn, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusFailed || results[0].Error != "panic: boom" {
+		t.Errorf("got %+v, want a failure", results)
+	}
+}
@@ -29,7 +29,6 @@ package main
 
 import (
 	"bytes"
-	"errors"
 	"flag"
 	"fmt"
 	"image"
@@ -48,12 +47,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/unidoc/unidoc-examples/advanced/grayscale"
 	"github.com/unidoc/unipdf/v3/common"
 	"github.com/unidoc/unipdf/v3/common/license"
-	"github.com/unidoc/unipdf/v3/contentstream"
-	"github.com/unidoc/unipdf/v3/core"
 	"github.com/unidoc/unipdf/v3/model"
-	"github.com/unidoc/unipdf/v3/ps"
 )
 
 func init() {
@@ -314,9 +311,9 @@ func transformPdfFile(inputPath, outputPath string) (int, error) {
 		page := pdfReader.PageList[i]
 		common.Log.Debug("^^^^page %d", pageNum)
 
-		desc := fmt.Sprintf("%s:page%d", filepath.Base(inputPath), pageNum)
-		err = convertPageToGrayscale(page, desc)
+		err = grayscale.ConvertPage(page, &grayscale.Options{SkipGrayFilters: ignoreGrayFilters})
 		if err != nil {
+			common.Log.Error("ConvertPage failed. %s:page%d err=%v", filepath.Base(inputPath), pageNum, err)
 			return numPages, err
 		}
 
@@ -337,686 +334,6 @@ func transformPdfFile(inputPath, outputPath string) (int, error) {
 	return numPages, nil
 }
 
-// =================================================================================================
-// Page transform code goes here
-// =================================================================================================
-
-// convertPageToGrayscale replaces color objects on the page with grayscale ones. It also references
-// XObject Images and Forms to convert those to grayscale.
-func convertPageToGrayscale(page *model.PdfPage, desc string) error {
-	// For each page, we go through the resources and look for the images.
-	contents, err := page.GetAllContentStreams()
-	if err != nil {
-		common.Log.Error("GetAllContentStreams failed. err=%v", err)
-		return err
-	}
-
-	grayContent, err := transformContentStreamToGrayscale(contents, page.Resources)
-	if err != nil {
-		common.Log.Error("transformContentStreamToGrayscale failed. err=%v", err)
-		return err
-	}
-	page.SetContentStreams([]string{string(grayContent)}, core.NewFlateEncoder())
-
-	return nil
-}
-
-// isPatternCS returns true if `colorspace` represents a Pattern colorspace.
-func isPatternCS(cs model.PdfColorspace) bool {
-	_, isPattern := cs.(*model.PdfColorspaceSpecialPattern)
-	return isPattern
-}
-
-// transformContentStreamToGrayscale `contents` converted to grayscale.
-func transformContentStreamToGrayscale(contents string, resources *model.PdfPageResources) ([]byte, error) {
-	cstreamParser := contentstream.NewContentStreamParser(contents)
-	operations, err := cstreamParser.Parse()
-	if err != nil {
-		return nil, err
-	}
-	processedOperations := &contentstream.ContentStreamOperations{}
-
-	transformedPatterns := map[core.PdfObjectName]bool{} // List of already transformed patterns. Avoid multiple conversions.
-	transformedShadings := map[core.PdfObjectName]bool{} // List of already transformed shadings. Avoid multiple conversions.
-
-	// Make a map of pattern colorspaces. Once processed, changes UnderlyingCS to DeviceGray.
-	patternColorspaces := map[*model.PdfColorspaceSpecialPattern]bool{}
-	defer func() {
-		// At the very end, set the UnderlyingCS to DeviceGray.
-		// TODO: Needs to be global?  I.e. do this at the very end of the execution.
-		for patternCS, _ := range patternColorspaces {
-			patternCS.UnderlyingCS = model.NewPdfColorspaceDeviceGray()
-		}
-	}()
-
-	// The content stream processor keeps track of the graphics state and we can make our own handlers to process
-	// certain commands using the AddHandler method. In this case, we hook up to color related operands, and for image
-	// and form handling.
-	processor := contentstream.NewContentStreamProcessor(*operations)
-	// Add handlers for colorspace related functionality.
-	processor.AddHandler(contentstream.HandlerConditionEnumAllOperands, "",
-		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
-			operand := op.Operand
-			switch operand {
-			case "CS": // Set colorspace operands (stroking).
-				if isPatternCS(gs.ColorspaceStroking) {
-					// If referring to a pattern colorspace with an external definition, need to update the definition.
-					// If has an underlying colorspace, then go and change it to DeviceGray.
-					// Needs to be specified externally in the colorspace resources.
-
-					csname := op.Params[0].(*core.PdfObjectName)
-					if *csname != "Pattern" {
-						// Update if referring to an external colorspace in resources.
-						cs, ok := resources.GetColorspaceByName(*csname)
-						if !ok {
-							common.Log.Debug("Undefined colorspace for pattern (%s)", csname)
-							return errors.New("Colorspace not defined")
-						}
-
-						patternCS, ok := cs.(*model.PdfColorspaceSpecialPattern)
-						if !ok {
-							return errors.New("Type error")
-						}
-
-						// Mark for processing.
-						patternColorspaces[patternCS] = true
-						resources.SetColorspaceByName(*csname, patternCS)
-					}
-					*processedOperations = append(*processedOperations, op)
-					return nil
-				}
-
-				op := contentstream.ContentStreamOperation{}
-				op.Operand = operand
-				op.Params = []core.PdfObject{core.MakeName("DeviceGray")}
-				*processedOperations = append(*processedOperations, &op)
-				return nil
-			case "cs": // Set colorspace operands (non-stroking).
-				if isPatternCS(gs.ColorspaceNonStroking) {
-					// If referring to a pattern colorspace with an external definition, need to update the definition.
-					// If has an underlying colorspace, then go and change it to DeviceGray.
-					// Needs to be specified externally in the colorspace resources.
-
-					csname := op.Params[0].(*core.PdfObjectName)
-					if *csname != "Pattern" {
-						// Update if referring to an external colorspace in resources.
-						cs, ok := resources.GetColorspaceByName(*csname)
-						if !ok {
-							common.Log.Debug("Undefined colorspace for pattern (%s)", csname)
-							return errors.New("Colorspace not defined")
-						}
-
-						patternCS, ok := cs.(*model.PdfColorspaceSpecialPattern)
-						if !ok {
-							return errors.New("Type error")
-						}
-
-						// Mark for processing.
-						patternColorspaces[patternCS] = true
-						resources.SetColorspaceByName(*csname, patternCS)
-					}
-					*processedOperations = append(*processedOperations, op)
-					return nil
-				}
-
-				op := contentstream.ContentStreamOperation{}
-				op.Operand = operand
-				op.Params = []core.PdfObject{core.MakeName("DeviceGray")}
-				*processedOperations = append(*processedOperations, &op)
-				return nil
-
-			case "SC", "SCN": // Set stroking color.  Includes pattern colors.
-				if isPatternCS(gs.ColorspaceStroking) {
-					op := contentstream.ContentStreamOperation{}
-					op.Operand = operand
-					op.Params = []core.PdfObject{}
-
-					patternColor, ok := gs.ColorStroking.(*model.PdfColorPattern)
-					if !ok {
-						return errors.New("Invalid stroking color type")
-					}
-
-					if patternColor.Color != nil {
-						color, err := gs.ColorspaceStroking.ColorToRGB(patternColor.Color)
-						if err != nil {
-							common.Log.Error("err=%v", err)
-							return err
-						}
-						rgbColor := color.(*model.PdfColorDeviceRGB)
-						grayColor := rgbColor.ToGray()
-
-						op.Params = append(op.Params, core.MakeFloat(grayColor.Val()))
-					}
-
-					if _, has := transformedPatterns[patternColor.PatternName]; has {
-						// Already processed, need not change anything, except underlying color if used.
-						op.Params = append(op.Params, &patternColor.PatternName)
-						*processedOperations = append(*processedOperations, &op)
-						return nil
-					}
-					transformedPatterns[patternColor.PatternName] = true
-
-					// Look up the pattern name and convert it.
-					pattern, found := resources.GetPatternByName(patternColor.PatternName)
-					if !found {
-						return errors.New("Undefined pattern name")
-					}
-
-					grayPattern, err := convertPatternToGray(pattern)
-					if err != nil {
-						common.Log.Debug("Unable to convert pattern to grayscale: %v", err)
-						return err
-					}
-					resources.SetPatternByName(patternColor.PatternName, grayPattern.ToPdfObject())
-
-					op.Params = append(op.Params, &patternColor.PatternName)
-					*processedOperations = append(*processedOperations, &op)
-				} else {
-					color, err := gs.ColorspaceStroking.ColorToRGB(gs.ColorStroking)
-					if err != nil {
-						common.Log.Error("Error with ColorToRGB: %v", err)
-						return err
-					}
-					rgbColor := color.(*model.PdfColorDeviceRGB)
-					grayColor := rgbColor.ToGray()
-
-					op := contentstream.ContentStreamOperation{}
-					op.Operand = operand
-					op.Params = []core.PdfObject{core.MakeFloat(grayColor.Val())}
-					*processedOperations = append(*processedOperations, &op)
-				}
-
-				return nil
-			case "sc", "scn": // Set nonstroking color.
-				if isPatternCS(gs.ColorspaceNonStroking) {
-					op := contentstream.ContentStreamOperation{}
-					op.Operand = operand
-					op.Params = []core.PdfObject{}
-					patternColor, ok := gs.ColorNonStroking.(*model.PdfColorPattern)
-					if !ok {
-						return errors.New("Invalid stroking color type")
-					}
-
-					if patternColor.Color != nil {
-						color, err := gs.ColorspaceNonStroking.ColorToRGB(patternColor) //.Color)
-						if err != nil {
-							common.Log.Error("err=%v", err)
-							return err
-						}
-						rgbColor := color.(*model.PdfColorDeviceRGB)
-						grayColor := rgbColor.ToGray()
-
-						op.Params = append(op.Params, core.MakeFloat(grayColor.Val()))
-					}
-
-					if _, has := transformedPatterns[patternColor.PatternName]; has {
-						// Already processed, need not change anything, except underlying color if used.
-						op.Params = append(op.Params, &patternColor.PatternName)
-						*processedOperations = append(*processedOperations, &op)
-						return nil
-					}
-					transformedPatterns[patternColor.PatternName] = true
-
-					// Look up the pattern name and convert it.
-					pattern, found := resources.GetPatternByName(patternColor.PatternName)
-					if !found {
-						return errors.New("Undefined pattern name")
-					}
-
-					grayPattern, err := convertPatternToGray(pattern)
-					if err != nil {
-						common.Log.Debug("Unable to convert pattern to grayscale: %v", err)
-						return err
-					}
-					resources.SetPatternByName(patternColor.PatternName, grayPattern.ToPdfObject())
-					op.Params = append(op.Params, &patternColor.PatternName)
-					*processedOperations = append(*processedOperations, &op)
-				} else {
-					color, err := gs.ColorspaceNonStroking.ColorToRGB(gs.ColorNonStroking)
-					if err != nil {
-						common.Log.Error("err=%v", err)
-						return err
-					}
-					rgbColor := color.(*model.PdfColorDeviceRGB)
-					grayColor := rgbColor.ToGray()
-
-					op := contentstream.ContentStreamOperation{}
-					op.Operand = operand
-					op.Params = []core.PdfObject{core.MakeFloat(grayColor.Val())}
-
-					*processedOperations = append(*processedOperations, &op)
-				}
-				return nil
-			case "RG", "K": // Set RGB or CMYK stroking color.
-				color, err := gs.ColorspaceStroking.ColorToRGB(gs.ColorStroking)
-				if err != nil {
-					common.Log.Error("err=%v", err)
-					return err
-				}
-				rgbColor := color.(*model.PdfColorDeviceRGB)
-				grayColor := rgbColor.ToGray()
-
-				op := contentstream.ContentStreamOperation{}
-				op.Operand = "G"
-				op.Params = []core.PdfObject{core.MakeFloat(grayColor.Val())}
-
-				*processedOperations = append(*processedOperations, &op)
-				return nil
-			case "rg", "k": // Set RGB or CMYK as nonstroking color.
-				color, err := gs.ColorspaceNonStroking.ColorToRGB(gs.ColorNonStroking)
-				if err != nil {
-					common.Log.Error("err=%v", err)
-					return err
-				}
-				rgbColor := color.(*model.PdfColorDeviceRGB)
-				grayColor := rgbColor.ToGray()
-
-				op := contentstream.ContentStreamOperation{}
-				op.Operand = "g"
-				op.Params = []core.PdfObject{core.MakeFloat(grayColor.Val())}
-
-				*processedOperations = append(*processedOperations, &op)
-				return nil
-			case "sh": // Paints the shape and color defined by shading dict.
-				if len(op.Params) != 1 {
-					return errors.New("Params to sh operator should be 1")
-				}
-				shname, ok := op.Params[0].(*core.PdfObjectName)
-				if !ok {
-					return errors.New("sh parameter should be a name")
-				}
-				if _, has := transformedShadings[*shname]; has {
-					// Already processed, no need to do anything.
-					*processedOperations = append(*processedOperations, op)
-					return nil
-				}
-				transformedShadings[*shname] = true
-
-				shading, found := resources.GetShadingByName(*shname)
-				if !found {
-					common.Log.Error("Shading not defined in resources. shname=%#q", string(*shname))
-					return errors.New("Shading not defined in resources")
-				}
-
-				grayShading, err := convertShadingToGray(shading)
-				if err != nil {
-					return err
-				}
-
-				resources.SetShadingByName(*shname, grayShading.GetContext().ToPdfObject())
-			}
-			*processedOperations = append(*processedOperations, op)
-
-			return nil
-		})
-	// Add handler for image related handling.  Note that inline images are completely stored with a ContentStreamInlineImage
-	// object as the parameter for BI.
-	processor.AddHandler(contentstream.HandlerConditionEnumOperand, "BI",
-		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
-			if len(op.Params) != 1 {
-				err := errors.New("invalid number of parameters")
-				common.Log.Error("BI error. err=%v")
-				return err
-			}
-			// Inline image.
-			iimg, ok := op.Params[0].(*contentstream.ContentStreamInlineImage)
-			if !ok {
-				common.Log.Error("Invalid handling for inline image")
-				return errors.New("Invalid inline image parameter")
-			}
-
-			cs, err := iimg.GetColorSpace(resources)
-			if err != nil {
-				common.Log.Error("Error getting color space for inline image: %v", err)
-				return err
-			}
-
-			if cs.GetNumComponents() == 1 {
-				return nil
-			}
-
-			encoder, err := iimg.GetEncoder()
-			if err != nil {
-				common.Log.Error("Error getting encoder for inline image: %v", err)
-				return err
-			}
-
-			if ignoreGrayFilters {
-				switch encoder.GetFilterName() {
-				// TODO: Add JPEG2000 encoding/decoding. Until then we assume JPEG200 images are color
-				//case "JPXDecode":
-				//	return nil
-				// These filters are only used with grayscale images
-				case "CCITTDecode", "CCITTFaxDecode", "JBIG2Decode":
-					return nil
-				}
-			}
-
-			img, err := iimg.ToImage(resources)
-			if err != nil {
-				common.Log.Error("Error converting inline image to image: %v", err)
-				return err
-			}
-			rgbImg, err := cs.ImageToRGB(*img)
-			if err != nil {
-				common.Log.Error("Error converting image to rgb: %v", err)
-				return err
-			}
-			rgbColorSpace := model.NewPdfColorspaceDeviceRGB()
-			grayImage, err := rgbColorSpace.ImageToGray(rgbImg)
-			if err != nil {
-				common.Log.Error("Error converting img to gray: %v", err)
-				return err
-			}
-
-			// Update the XObject image.
-			// Use same encoder as input data.  Make sure for DCT filter it is updated to 1 color component.
-
-			if dctEncoder, is := encoder.(*core.DCTEncoder); is {
-				dctEncoder.ColorComponents = 1
-			}
-
-			grayInlineImg, err := contentstream.NewInlineImageFromImage(grayImage, encoder)
-			if err != nil {
-				if err == core.ErrUnsupportedEncodingParameters {
-					// Unsupported encoding parameters, revert to a basic flate encoder without predictor.
-					encoder = core.NewFlateEncoder()
-				}
-				// Try again, fail on error.
-				grayInlineImg, err = contentstream.NewInlineImageFromImage(grayImage, encoder)
-				if err != nil {
-					common.Log.Error("Error making a new inline image object: %v", err)
-					return err
-				}
-			}
-
-			// Replace inline image data with the gray image.
-			pOp := contentstream.ContentStreamOperation{}
-			pOp.Operand = "BI"
-			pOp.Params = []core.PdfObject{grayInlineImg}
-			*processedOperations = append(*processedOperations, &pOp)
-
-			return nil
-		})
-
-	// Handler for XObject Image and Forms.
-	processedXObjects := map[string]bool{} // Keep track of processed XObjects to avoid repetition.
-
-	processor.AddHandler(contentstream.HandlerConditionEnumOperand, "Do",
-		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
-			if len(op.Params) < 1 {
-				common.Log.Error("Invalid number of params for Do object")
-				return errors.New("Range check")
-			}
-
-			// XObject.
-			name := op.Params[0].(*core.PdfObjectName)
-			common.Log.Debug("Name=%#v=%#q", name, string(*name))
-
-			// Only process each one once.
-			_, has := processedXObjects[string(*name)]
-			if has {
-				return nil
-			}
-			processedXObjects[string(*name)] = true
-
-			_, xtype := resources.GetXObjectByName(*name)
-			common.Log.Debug("xtype=%+v model.XObjectTypeImage=%v", xtype, model.XObjectTypeImage)
-
-			if xtype == model.XObjectTypeImage {
-
-				ximg, err := resources.GetXObjectImageByName(*name)
-				if err != nil {
-					common.Log.Error("Error w/GetXObjectImageByName : %v", err)
-					return err
-				}
-
-				if ignoreGrayFilters {
-					switch ximg.Filter.GetFilterName() {
-					// TODO: Add JPEG2000 encoding/decoding. Until then we assume JPEG200 images are color
-					//case "JPXDecode":
-					//	return nil
-					// These filters are only used with grayscale images
-					case "CCITTDecode", "CCITTFaxDecode", "JBIG2Decode":
-						return nil
-					}
-				}
-
-				// Hacky workaround for Szegedy_Going_Deeper_With_2015_CVPR_paper.pdf that has a colored image
-				// that is completely masked
-				if ximg.Filter.GetFilterName() == "RunLengthDecode" && ximg.SMask != nil {
-					return nil
-				}
-
-				img, err := ximg.ToImage()
-				if err != nil {
-					common.Log.Error("Error w/ToImage: %v", err)
-					return err
-				}
-
-				rgbImg, err := ximg.ColorSpace.ImageToRGB(*img)
-				if err != nil {
-					common.Log.Error("Error ImageToRGB: %v", err)
-					return err
-				}
-
-				rgbColorSpace := model.NewPdfColorspaceDeviceRGB()
-				grayImage, err := rgbColorSpace.ImageToGray(rgbImg)
-				if err != nil {
-					common.Log.Error("Error ImageToGray: %v", err)
-					return err
-				}
-
-				// Update the XObject image.
-				// Use same encoder as input data.  Make sure for DCT filter it is updated to 1 color component.
-				encoder := ximg.Filter
-				if dctEncoder, is := encoder.(*core.DCTEncoder); is {
-					dctEncoder.ColorComponents = 1
-				}
-
-				ximgGray, err := model.NewXObjectImageFromImage(&grayImage, nil, encoder)
-				if err != nil {
-					if err == core.ErrUnsupportedEncodingParameters {
-						// Unsupported encoding parameters, revert to a basic flate encoder without predictor.
-						encoder = core.NewFlateEncoder()
-					}
-
-					// Try again, fail if error.
-					ximgGray, err = model.NewXObjectImageFromImage(&grayImage, nil, encoder)
-					if err != nil {
-						common.Log.Error("Error creating image: %v", err)
-						return err
-					}
-				}
-
-				// Update the entry.
-				err = resources.SetXObjectImageByName(*name, ximgGray)
-				if err != nil {
-					common.Log.Error("Failed setting x object: %v (%s)", err, string(*name))
-					return err
-				}
-			} else if xtype == model.XObjectTypeForm {
-				common.Log.Debug(" XObject Form: %s", *name)
-
-				// Go through the XObject Form content stream.
-				xform, err := resources.GetXObjectFormByName(*name)
-				if err != nil {
-					common.Log.Error("err=%v", err)
-					return err
-				}
-
-				formContent, err := xform.GetContentStream()
-				if err != nil {
-					common.Log.Error("err=%v")
-					return err
-				}
-
-				// Process the content stream in the Form object too:
-				// XXX/TODO/Consider: Use either form resources (priority) and fall back to page resources alternatively if not found.
-				// Have not come into cases where needed yet.
-				formResources := xform.Resources
-				if formResources == nil {
-					formResources = resources
-				}
-
-				// Process the content stream in the Form object too:
-				grayContent, err := transformContentStreamToGrayscale(string(formContent), formResources)
-				if err != nil {
-					common.Log.Error("err=%v", err)
-					return err
-				}
-
-				xform.SetContentStream(grayContent, nil)
-
-				// Update the resource entry.
-				resources.SetXObjectFormByName(*name, xform)
-			}
-
-			return nil
-		})
-
-	err = processor.Process(resources)
-	if err != nil {
-		common.Log.Error("processor.Process returned: err=%v", err)
-		return nil, err
-	}
-
-	return processedOperations.Bytes(), nil
-}
-
-// convertPatternToGray converts `pattern` to grayscale (tiling or shading pattern).
-func convertPatternToGray(pattern *model.PdfPattern) (*model.PdfPattern, error) {
-	// Case 1: Colored tiling patterns.  Need to process the content stream and replace.
-	if pattern.IsTiling() {
-		tilingPattern := pattern.GetAsTilingPattern()
-
-		if tilingPattern.IsColored() {
-			// A colored tiling pattern can use color operators in its stream, need to process the stream.
-
-			content, err := tilingPattern.GetContentStream()
-			if err != nil {
-				return nil, err
-			}
-
-			grayContents, err := transformContentStreamToGrayscale(string(content), tilingPattern.Resources)
-			if err != nil {
-				return nil, err
-			}
-
-			tilingPattern.SetContentStream(grayContents, nil)
-
-			// Update in-memory pdf objects.
-			_ = tilingPattern.ToPdfObject()
-		}
-	} else if pattern.IsShading() {
-		// Case 2: Shading patterns.  Need to create a new colorspace that can map from N=3,4 colorspaces to grayscale.
-		shadingPattern := pattern.GetAsShadingPattern()
-
-		grayShading, err := convertShadingToGray(shadingPattern.Shading)
-		if err != nil {
-			return nil, err
-		}
-		shadingPattern.Shading = grayShading
-
-		// Update in-memory pdf objects.
-		_ = shadingPattern.ToPdfObject()
-	}
-
-	return pattern, nil
-}
-
-// convertShadingToGray converts `shading` to grayscale.
-// This one is slightly involved as a shading defines a color as function of position, i.e. color(x,y) = F(x,y).
-// Since the function can be challenging to change, we define new DeviceN colorspace with a color conversion
-// function.
-func convertShadingToGray(shading *model.PdfShading) (*model.PdfShading, error) {
-	cs := shading.ColorSpace
-
-	if cs.GetNumComponents() == 1 {
-		// Already grayscale, should be fine. No action taken.
-
-		// Make sure is device gray.
-		shading.ColorSpace = model.NewPdfColorspaceDeviceGray()
-
-		return shading, nil
-	} else if cs.GetNumComponents() == 3 {
-		// Create a new DeviceN colorspace that converts R,G,B -> Grayscale
-		// Use: gray := 0.3*R + 0.59G + 0.11B
-		// PS program: { 0.11 mul exch 0.59 mul add exch 0.3 mul add }.
-		transformFunc := &model.PdfFunctionType4{}
-		transformFunc.Domain = []float64{0, 1, 0, 1, 0, 1}
-		transformFunc.Range = []float64{0, 1}
-		rgbToGrayPsProgram := ps.NewPSProgram()
-		rgbToGrayPsProgram.Append(ps.MakeReal(0.11))
-		rgbToGrayPsProgram.Append(ps.MakeOperand("mul"))
-		rgbToGrayPsProgram.Append(ps.MakeOperand("exch"))
-		rgbToGrayPsProgram.Append(ps.MakeReal(0.59))
-		rgbToGrayPsProgram.Append(ps.MakeOperand("mul"))
-		rgbToGrayPsProgram.Append(ps.MakeOperand("add"))
-		rgbToGrayPsProgram.Append(ps.MakeOperand("exch"))
-		rgbToGrayPsProgram.Append(ps.MakeReal(0.3))
-		rgbToGrayPsProgram.Append(ps.MakeOperand("mul"))
-		rgbToGrayPsProgram.Append(ps.MakeOperand("add"))
-		transformFunc.Program = rgbToGrayPsProgram
-
-		// Define the DeviceN colorspace that performs the R,G,B -> Gray conversion for us.
-		transformcs := model.NewPdfColorspaceDeviceN()
-		transformcs.AlternateSpace = model.NewPdfColorspaceDeviceGray()
-		transformcs.ColorantNames = core.MakeArray(core.MakeName("R"), core.MakeName("G"), core.MakeName("B"))
-		transformcs.TintTransform = transformFunc
-
-		// Replace the old colorspace with the new.
-		shading.ColorSpace = transformcs
-
-		return shading, nil
-	} else if cs.GetNumComponents() == 4 {
-		// Create a new DeviceN colorspace that converts C,M,Y,K -> Grayscale.
-		// Use: gray = 1.0 - min(1.0, 0.3*C + 0.59*M + 0.11*Y + K)  ; where BG(k) = k simply.
-		// PS program: {exch 0.11 mul add exch 0.59 mul add exch 0.3 mul add dup 1.0 ge { pop 1.0 } if}
-		transformFunc := &model.PdfFunctionType4{}
-		transformFunc.Domain = []float64{0, 1, 0, 1, 0, 1, 0, 1}
-		transformFunc.Range = []float64{0, 1}
-
-		cmykToGrayPsProgram := ps.NewPSProgram()
-		cmykToGrayPsProgram.Append(ps.MakeOperand("exch"))
-		cmykToGrayPsProgram.Append(ps.MakeReal(0.11))
-		cmykToGrayPsProgram.Append(ps.MakeOperand("mul"))
-		cmykToGrayPsProgram.Append(ps.MakeOperand("add"))
-		cmykToGrayPsProgram.Append(ps.MakeOperand("exch"))
-		cmykToGrayPsProgram.Append(ps.MakeReal(0.59))
-		cmykToGrayPsProgram.Append(ps.MakeOperand("mul"))
-		cmykToGrayPsProgram.Append(ps.MakeOperand("add"))
-		cmykToGrayPsProgram.Append(ps.MakeOperand("exch"))
-		cmykToGrayPsProgram.Append(ps.MakeReal(0.30))
-		cmykToGrayPsProgram.Append(ps.MakeOperand("mul"))
-		cmykToGrayPsProgram.Append(ps.MakeOperand("add"))
-		cmykToGrayPsProgram.Append(ps.MakeOperand("dup"))
-		cmykToGrayPsProgram.Append(ps.MakeReal(1.0))
-		cmykToGrayPsProgram.Append(ps.MakeOperand("ge"))
-		// Add sub procedure.
-		subProc := ps.NewPSProgram()
-		subProc.Append(ps.MakeOperand("pop"))
-		subProc.Append(ps.MakeReal(1.0))
-		cmykToGrayPsProgram.Append(subProc)
-		cmykToGrayPsProgram.Append(ps.MakeOperand("if"))
-		transformFunc.Program = cmykToGrayPsProgram
-
-		// Define the DeviceN colorspace that performs the R,G,B -> Gray conversion for us.
-		transformcs := model.NewPdfColorspaceDeviceN()
-		transformcs.AlternateSpace = model.NewPdfColorspaceDeviceGray()
-		transformcs.ColorantNames = core.MakeArray(core.MakeName("C"), core.MakeName("M"), core.MakeName("Y"), core.MakeName("K"))
-		transformcs.TintTransform = transformFunc
-
-		// Replace the old colorspace with the new.
-		shading.ColorSpace = transformcs
-
-		return shading, nil
-	} else {
-		common.Log.Debug("Cannot convert to shading pattern grayscale, color space N = %d", cs.GetNumComponents())
-		return nil, errors.New("Unsupported pattern colorspace for grayscale conversion")
-	}
-}
-
 // modifyPath returns `inputPath` with its directory replaced by `outputDir`
 func modifyPath(inputPath, outputDir string) string {
 	_, name := filepath.Split(inputPath)
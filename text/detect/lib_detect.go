@@ -0,0 +1,691 @@
+/*
+ * Package detect finds the fillable regions of flat PDF forms, i.e. forms printed on the page
+ * without AcroForm fields, so they can be converted into fillable forms:
+ *  - fill-in lines drawn as runs of underscores ("Name: __________") or as horizontal line paths;
+ *  - boxed regions drawn as rectangles with no text inside, multi-line if tall enough;
+ *  - check box squares drawn as small square rectangles, as ballot box glyphs (☐, □) or typed as
+ *    "[ ]";
+ *  - signature lines and boxes, recognized by their "Signature" or "Sign" labels.
+ *
+ * Each region is named from its nearest label: the text to its left on the same line, or else the
+ * text above or below it (the text to the right first for check boxes). Labels ending with "*" make
+ * the field required.
+ *
+ *   spec, err := detect.Detect(pdfReader, detect.Options{}) // Form spec of forms/design.
+ *   pdfWriter, err := design.AddToReader(pdfReader, spec)   // The PDF with real AcroForm fields.
+ *
+ * Only the page content streams are searched, not the form XObjects they draw. Regions covered by
+ * fields the document already has are skipped.
+ *
+ * Used by pdftool detect-fields, text/pdf_detect_form_fields.go and text/pdf_detect_signature.go.
+ */
+
+package detect
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/unidoc/unipdf/v3/contentstream"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/forms/design"
+	"github.com/unidoc/unidoc-examples/text/glyphs"
+)
+
+// Region kinds.
+const (
+	KindLine      = "line"
+	KindBox       = "box"
+	KindCheckbox  = "checkbox"
+	KindSignature = "signature"
+)
+
+// Options are the detection options. Zero values select the defaults.
+type Options struct {
+	// MinLineLength is the minimum length of fill-in lines in points, 36 (half an inch) by default.
+	MinLineLength float64
+	// FieldHeight is the height of the fields placed on lines drawn as paths, 14 by default.
+	// Fields on underscores are as high as the underscores' text.
+	FieldHeight float64
+	// LabelDistance is the maximum distance of labels from their regions in points, 150 by
+	// default.
+	LabelDistance float64
+}
+
+// Region is a fillable region of a page.
+type Region struct {
+	// Kind is line, box, checkbox or signature.
+	Kind string
+	// Page is the number of the page, starting at 1.
+	Page int
+	// Rect is the rectangle of the field for the region.
+	Rect model.PdfRectangle
+	// Label is the text labelling the region, "" if none was found.
+	Label string
+	// Required is true if the label is marked with "*".
+	Required bool
+	// Multiline is true for boxes high enough for several lines of text.
+	Multiline bool
+}
+
+// withDefaults returns `o` with the defaults of the options that aren't set.
+func (o Options) withDefaults() Options {
+	if o.MinLineLength <= 0 {
+		o.MinLineLength = 36
+	}
+	if o.FieldHeight <= 0 {
+		o.FieldHeight = 14
+	}
+	if o.LabelDistance <= 0 {
+		o.LabelDistance = 150
+	}
+	return o
+}
+
+// Detect returns the form spec of the fillable regions of the document loaded by `pdfReader`, with
+// unique field names that the document's form doesn't use yet.
+func Detect(pdfReader *model.PdfReader, opts Options) (*design.Spec, error) {
+	var regions []*Region
+	for i, page := range pdfReader.PageList {
+		pageRegions, err := DetectPage(page, i+1, opts)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", i+1, err)
+		}
+		regions = append(regions, pageRegions...)
+	}
+
+	var used []string
+	if form := pdfReader.AcroForm; form != nil {
+		for _, f := range form.AllFields() {
+			name, err := f.FullName()
+			if err != nil {
+				return nil, err
+			}
+			used = append(used, name)
+		}
+	}
+	spec := ToSpec(regions, used)
+	if len(pdfReader.PageList) > 0 {
+		if box, err := pdfReader.PageList[0].GetMediaBox(); err == nil {
+			spec.PageSize = []float64{box.Width(), box.Height()}
+		}
+	}
+	spec.Pages = len(pdfReader.PageList)
+	return spec, nil
+}
+
+// DetectPage returns the fillable regions of `page`, the page number `pageNum`, in reading order.
+func DetectPage(page *model.PdfPage, pageNum int, opts Options) ([]*Region, error) {
+	opts = opts.withDefaults()
+	contents, err := page.GetAllContentStreams()
+	if err != nil {
+		return nil, err
+	}
+	content, err := glyphs.Parse(contents, page.Resources)
+	if err != nil {
+		return nil, err
+	}
+	shapes, err := pageShapes(contents, page.Resources)
+	if err != nil {
+		return nil, err
+	}
+	runs := textRuns(content.Glyphs)
+
+	var pageArea float64
+	if box, err := page.GetMediaBox(); err == nil {
+		pageArea = box.Width() * box.Height()
+	}
+	d := &detector{opts: opts, runs: runs}
+	d.addBoxes(shapes.rects, pageArea)
+	d.addLines(shapes.lines)
+	d.addTextRegions()
+	d.removeWidgets(page)
+	d.label()
+
+	sortReadingOrder(d.regions)
+	for _, r := range d.regions {
+		r.Page = pageNum
+	}
+	return d.regions, nil
+}
+
+// detector finds the regions of a page.
+type detector struct {
+	opts    Options
+	runs    []*run
+	regions []*Region
+}
+
+// run is a run of glyphs on a line: label text, underscores or a ballot box.
+type run struct {
+	text       string
+	bbox       model.PdfRectangle
+	underscore bool
+	ballot     bool
+}
+
+// ballotBoxes are the glyphs drawn as check box squares.
+var ballotBoxes = map[string]bool{"☐": true, "□": true, "❏": true, "❑": true}
+
+// textRuns returns the runs of `all` in content stream order. Runs are split where the text leaves
+// the line, jumps by more than half the font size or changes between underscores and other text.
+func textRuns(all []glyphs.Glyph) []*run {
+	var runs []*run
+	var cur *run
+	var prev model.PdfRectangle
+	for i := 0; i < len(all); i++ {
+		g := all[i]
+		if g.Text == "" {
+			continue
+		}
+		underscore := strings.Trim(g.Text, "_") == ""
+		ballot := ballotBoxes[g.Text]
+		if j := closingBracket(all, i); j > i {
+			// A check box typed as "[ ]".
+			for _, b := range all[i+1 : j+1] {
+				g.BBox = union(g.BBox, b.BBox)
+			}
+			g.Text, ballot, i = "[ ]", true, j
+		}
+		height := g.BBox.Ury - g.BBox.Lly
+		split := cur == nil || ballot || cur.ballot || underscore != cur.underscore ||
+			!sameLine(prev, g.BBox) || g.BBox.Llx-prev.Urx > 0.5*height || prev.Urx-g.BBox.Llx > 0.5*height
+		if split {
+			cur = &run{bbox: g.BBox, underscore: underscore, ballot: ballot}
+			runs = append(runs, cur)
+		} else {
+			cur.bbox = union(cur.bbox, g.BBox)
+		}
+		cur.text += g.Text
+		prev = g.BBox
+	}
+
+	// Label runs are trimmed, blank ones dropped.
+	var out []*run
+	for _, r := range runs {
+		if !r.underscore {
+			r.text = strings.TrimSpace(r.text)
+			if r.text == "" {
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// closingBracket returns the index of the "]" closing the "[" of `all` at `i` with only spaces in
+// between, as in "[ ]", or -1 if there is none.
+func closingBracket(all []glyphs.Glyph, i int) int {
+	if all[i].Text != "[" {
+		return -1
+	}
+	for j := i + 1; j < len(all) && j <= i+3; j++ {
+		switch all[j].Text {
+		case "]":
+			if j > i+1 {
+				return j
+			}
+			return -1
+		case " ", "\u00a0":
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// addBoxes adds the check boxes and boxed regions among `rects`. Boxes with text or other boxes
+// inside are frames or table cells with content, not fillable regions, as are boxes larger than a
+// quarter of `pageArea`.
+func (d *detector) addBoxes(rects []model.PdfRectangle, pageArea float64) {
+	rects = dedupe(rects)
+	for i, r := range rects {
+		w, h := r.Urx-r.Llx, r.Ury-r.Lly
+		if w < 4 || h < 4 {
+			continue
+		}
+		if w <= 24 && h <= 24 && w >= 5 && h >= 5 && w/h >= 0.75 && w/h <= 1.33 {
+			d.regions = append(d.regions, &Region{Kind: KindCheckbox, Rect: r})
+			continue
+		}
+		if w < 20 || h < 8 || pageArea > 0 && w*h > pageArea/4 {
+			continue
+		}
+		if d.containsText(r) {
+			continue
+		}
+		frame := false
+		for j, o := range rects {
+			if j != i && contains(r, o) && (o.Urx-o.Llx)*(o.Ury-o.Lly) < w*h {
+				frame = true
+				break
+			}
+		}
+		if !frame {
+			d.regions = append(d.regions, &Region{Kind: KindBox, Rect: r, Multiline: h >= 2.5*d.opts.FieldHeight})
+		}
+	}
+}
+
+// addLines adds fields on the horizontal `lines` that are long enough and aren't edges of boxes.
+func (d *detector) addLines(lines []model.PdfRectangle) {
+	lines = dedupe(lines)
+	for _, l := range lines {
+		if l.Urx-l.Llx < d.opts.MinLineLength {
+			continue
+		}
+		y := (l.Lly + l.Ury) / 2
+		edge := false
+		for _, r := range d.regions {
+			if (math.Abs(y-r.Rect.Lly) < 2 || math.Abs(y-r.Rect.Ury) < 2) && l.Llx >= r.Rect.Llx-2 &&
+				l.Urx <= r.Rect.Urx+2 {
+				edge = true
+				break
+			}
+		}
+		if edge {
+			continue
+		}
+		rect := model.PdfRectangle{Llx: l.Llx, Lly: l.Ury, Urx: l.Urx, Ury: l.Ury + d.opts.FieldHeight}
+		if d.containsText(rect) {
+			// Lines under text are underlines or table rules.
+			continue
+		}
+		d.regions = append(d.regions, &Region{Kind: KindLine, Rect: rect})
+	}
+}
+
+// addTextRegions adds the regions drawn with text: underscores and ballot boxes. Underscores on a
+// line already found as a path are skipped.
+func (d *detector) addTextRegions() {
+	for _, r := range d.runs {
+		switch {
+		case r.ballot:
+			// The square is about as wide as the glyph, centered vertically.
+			side := r.bbox.Urx - r.bbox.Llx
+			cy := (r.bbox.Lly + r.bbox.Ury) / 2
+			rect := model.PdfRectangle{Llx: r.bbox.Llx, Lly: cy - side/2, Urx: r.bbox.Urx, Ury: cy + side/2}
+			d.regions = append(d.regions, &Region{Kind: KindCheckbox, Rect: rect})
+		case r.underscore && len(r.text) >= 3 && r.bbox.Urx-r.bbox.Llx >= d.opts.MinLineLength/2:
+			height := math.Max(r.bbox.Ury-r.bbox.Lly, 12)
+			rect := model.PdfRectangle{Llx: r.bbox.Llx, Lly: r.bbox.Lly, Urx: r.bbox.Urx, Ury: r.bbox.Lly + height}
+			duplicate := false
+			for _, o := range d.regions {
+				if o.Kind == KindLine && overlap(o.Rect, rect) > 0.5 {
+					duplicate = true
+					break
+				}
+			}
+			if !duplicate {
+				d.regions = append(d.regions, &Region{Kind: KindLine, Rect: rect})
+			}
+		}
+	}
+}
+
+// removeWidgets removes the regions covered by the widgets of `page`.
+func (d *detector) removeWidgets(page *model.PdfPage) {
+	annots, err := page.GetAnnotations()
+	if err != nil {
+		return
+	}
+	var widgets []model.PdfRectangle
+	for _, a := range annots {
+		if _, ok := a.GetContext().(*model.PdfAnnotationWidget); !ok {
+			continue
+		}
+		if arr, ok := core.GetArray(a.Rect); ok {
+			if rect, err := model.NewPdfRectangle(*arr); err == nil {
+				widgets = append(widgets, normalized(*rect))
+			}
+		}
+	}
+	kept := d.regions[:0]
+	for _, r := range d.regions {
+		covered := false
+		for _, w := range widgets {
+			if overlap(r.Rect, w) > 0.5 {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, r)
+		}
+	}
+	d.regions = kept
+}
+
+// signatureLabel matches the labels of signature regions.
+var signatureLabel = regexp.MustCompile(`(?i)\bsign(ature|ed)?\b`)
+
+// label sets the labels of the regions and turns the lines and boxes labelled as signatures into
+// signature regions.
+func (d *detector) label() {
+	for _, r := range d.regions {
+		var label *run
+		switch r.Kind {
+		case KindCheckbox:
+			label = d.nearest(r.Rect, right)
+			if label == nil {
+				label = d.nearest(r.Rect, left)
+			}
+		case KindLine:
+			for _, side := range []side{left, below, above} {
+				if label = d.nearest(r.Rect, side); label != nil {
+					break
+				}
+			}
+		default:
+			for _, side := range []side{left, above, below} {
+				if label = d.nearest(r.Rect, side); label != nil {
+					break
+				}
+			}
+		}
+		if label == nil {
+			continue
+		}
+		text := strings.TrimSpace(label.text)
+		text = strings.TrimRight(text, ": ")
+		if strings.HasSuffix(text, "*") {
+			r.Required = true
+			text = strings.TrimRight(text, "*: ")
+		}
+		text = strings.TrimLeft(text, "* ")
+		r.Label = text
+		if r.Kind != KindCheckbox && signatureLabel.MatchString(text) && r.Rect.Urx-r.Rect.Llx >= 72 {
+			r.Kind = KindSignature
+		}
+	}
+}
+
+// side is where a label is relative to its region.
+type side int
+
+const (
+	left side = iota
+	right
+	above
+	below
+)
+
+// nearest returns the label run nearest to `rect` on `s`, or nil if there is none within the label
+// distance.
+func (d *detector) nearest(rect model.PdfRectangle, s side) *run {
+	var best *run
+	bestDist := math.Inf(1)
+	height := rect.Ury - rect.Lly
+	for _, r := range d.runs {
+		if r.underscore || r.ballot {
+			continue
+		}
+		var dist float64
+		switch s {
+		case left:
+			if !sameLine(r.bbox, rect) && !sameLine(rect, r.bbox) || r.bbox.Urx > rect.Llx+2 {
+				continue
+			}
+			dist = rect.Llx - r.bbox.Urx
+		case right:
+			if !sameLine(r.bbox, rect) && !sameLine(rect, r.bbox) || r.bbox.Llx < rect.Urx-2 {
+				continue
+			}
+			dist = r.bbox.Llx - rect.Urx
+		case above, below:
+			if r.bbox.Urx < rect.Llx || r.bbox.Llx > rect.Urx {
+				continue
+			}
+			if s == above {
+				dist = r.bbox.Lly - rect.Ury
+			} else {
+				dist = rect.Lly - r.bbox.Ury
+			}
+			// Labels above and below are close to the region.
+			if dist < -2 || dist > math.Max(height, 16) {
+				continue
+			}
+		}
+		if dist < -2 || dist > d.opts.LabelDistance {
+			continue
+		}
+		if dist < bestDist {
+			best, bestDist = r, dist
+		}
+	}
+	return best
+}
+
+// containsText returns true if the center of a label run is inside `rect`.
+func (d *detector) containsText(rect model.PdfRectangle) bool {
+	for _, r := range d.runs {
+		if r.underscore {
+			continue
+		}
+		x, y := (r.bbox.Llx+r.bbox.Urx)/2, (r.bbox.Lly+r.bbox.Ury)/2
+		if x > rect.Llx && x < rect.Urx && y > rect.Lly && y < rect.Ury {
+			return true
+		}
+	}
+	return false
+}
+
+// ToSpec returns the form spec of `regions`: text fields for lines and boxes, check boxes and
+// signature fields, named from their labels and unique among themselves and `used`.
+func ToSpec(regions []*Region, used []string) *design.Spec {
+	names := map[string]bool{}
+	for _, name := range used {
+		names[name] = true
+	}
+	spec := &design.Spec{Fields: []*design.Field{}}
+	for _, r := range regions {
+		f := &design.Field{
+			Page:     r.Page,
+			Rect:     []float64{round(r.Rect.Llx), round(r.Rect.Lly), round(r.Rect.Urx), round(r.Rect.Ury)},
+			Tooltip:  r.Label,
+			Required: r.Required,
+		}
+		switch r.Kind {
+		case KindCheckbox:
+			f.Type = design.TypeCheckbox
+		case KindSignature:
+			f.Type = design.TypeSignature
+		default:
+			f.Type = design.TypeText
+			f.Multiline = r.Multiline
+		}
+
+		base := fieldName(r.Label)
+		if base == "" {
+			base = f.Type
+		}
+		name := base
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		names[name] = true
+		f.Name = name
+		spec.Fields = append(spec.Fields, f)
+	}
+	return spec
+}
+
+// fieldName returns a field name made of the words of `label`, e.g. "first_name" for "First
+// Name". Long labels are cut to their first words.
+func fieldName(label string) string {
+	words := strings.FieldsFunc(strings.ToLower(label), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	name := ""
+	for _, w := range words {
+		if name != "" && len(name)+len(w) >= 32 {
+			break
+		}
+		if name != "" {
+			name += "_"
+		}
+		name += w
+	}
+	return name
+}
+
+// sortReadingOrder sorts `regions` from the top of the page down and from left to right within
+// rows.
+func sortReadingOrder(regions []*Region) {
+	sort.SliceStable(regions, func(i, j int) bool {
+		a, b := regions[i].Rect, regions[j].Rect
+		if math.Abs(a.Ury-b.Ury) > 4 {
+			return a.Ury > b.Ury
+		}
+		return a.Llx < b.Llx
+	})
+}
+
+// shapes are the painted rectangles and horizontal lines of a content stream in page coordinates.
+type shapes struct {
+	rects []model.PdfRectangle
+	// lines are the bounding boxes of horizontal lines, thin filled rectangles included.
+	lines []model.PdfRectangle
+}
+
+// pageShapes returns the shapes painted by the content stream `contents`.
+func pageShapes(contents string, resources *model.PdfPageResources) (*shapes, error) {
+	ops, err := contentstream.NewContentStreamParser(contents).Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &shapes{}
+	var rects, segments []model.PdfRectangle
+	var cx, cy, sx, sy float64 // Current point and start of the subpath.
+	processor := contentstream.NewContentStreamProcessor(*ops)
+	processor.AddHandler(contentstream.HandlerConditionEnumAllOperands, "",
+		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, _ *model.PdfPageResources) error {
+			ctm := glyphs.CTM(gs)
+			floats, _ := core.GetNumbersAsFloat(op.Params)
+			switch op.Operand {
+			case "m":
+				if len(floats) == 2 {
+					cx, cy = ctm.Transform(floats[0], floats[1])
+					sx, sy = cx, cy
+				}
+			case "l":
+				if len(floats) == 2 {
+					x, y := ctm.Transform(floats[0], floats[1])
+					segments = append(segments, segment(cx, cy, x, y))
+					cx, cy = x, y
+				}
+			case "h":
+				segments = append(segments, segment(cx, cy, sx, sy))
+				cx, cy = sx, sy
+			case "c", "v", "y":
+				if len(floats) >= 2 {
+					cx, cy = ctm.Transform(floats[len(floats)-2], floats[len(floats)-1])
+				}
+			case "re":
+				if len(floats) == 4 {
+					x, y, w, h := floats[0], floats[1], floats[2], floats[3]
+					rects = append(rects, ctm.BBox(math.Min(x, x+w), math.Min(y, y+h), math.Max(x, x+w), math.Max(y, y+h)))
+					cx, cy = ctm.Transform(x, y)
+					sx, sy = cx, cy
+				}
+			case "S", "s", "B", "B*", "b", "b*", "f", "F", "f*":
+				for _, seg := range segments {
+					if seg.Ury-seg.Lly < 1 {
+						s.lines = append(s.lines, seg)
+					}
+				}
+				for _, r := range rects {
+					if r.Ury-r.Lly <= 2.5 {
+						s.lines = append(s.lines, r)
+					} else {
+						s.rects = append(s.rects, r)
+					}
+				}
+				rects, segments = nil, nil
+			case "n":
+				rects, segments = nil, nil
+			}
+			return nil
+		})
+	if err := processor.Process(resources); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// segment returns the bounding box of the segment from (x1, y1) to (x2, y2).
+func segment(x1, y1, x2, y2 float64) model.PdfRectangle {
+	return model.PdfRectangle{Llx: math.Min(x1, x2), Lly: math.Min(y1, y2), Urx: math.Max(x1, x2), Ury: math.Max(y1, y2)}
+}
+
+// dedupe returns `rects` without the rectangles equal to an earlier one within a point, as drawn
+// by double borders or a fill and a stroke of the same path.
+func dedupe(rects []model.PdfRectangle) []model.PdfRectangle {
+	var out []model.PdfRectangle
+	for _, r := range rects {
+		duplicate := false
+		for _, o := range out {
+			if math.Abs(r.Llx-o.Llx) < 1 && math.Abs(r.Lly-o.Lly) < 1 && math.Abs(r.Urx-o.Urx) < 1 &&
+				math.Abs(r.Ury-o.Ury) < 1 {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// sameLine returns true if `a` and `b` overlap vertically by at least half of the height of `b`.
+func sameLine(a, b model.PdfRectangle) bool {
+	return math.Min(a.Ury, b.Ury)-math.Max(a.Lly, b.Lly) >= 0.5*(b.Ury-b.Lly)
+}
+
+// contains returns true if `r` contains `o`.
+func contains(r, o model.PdfRectangle) bool {
+	return o.Llx >= r.Llx-0.5 && o.Lly >= r.Lly-0.5 && o.Urx <= r.Urx+0.5 && o.Ury <= r.Ury+0.5
+}
+
+// overlap returns the area of the intersection of `a` and `b` relative to the smaller of them.
+func overlap(a, b model.PdfRectangle) float64 {
+	w := math.Min(a.Urx, b.Urx) - math.Max(a.Llx, b.Llx)
+	h := math.Min(a.Ury, b.Ury) - math.Max(a.Lly, b.Lly)
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	smaller := math.Min((a.Urx-a.Llx)*(a.Ury-a.Lly), (b.Urx-b.Llx)*(b.Ury-b.Lly))
+	if smaller <= 0 {
+		return 0
+	}
+	return w * h / smaller
+}
+
+// union returns the smallest rectangle containing `a` and `b`.
+func union(a, b model.PdfRectangle) model.PdfRectangle {
+	return model.PdfRectangle{
+		Llx: math.Min(a.Llx, b.Llx),
+		Lly: math.Min(a.Lly, b.Lly),
+		Urx: math.Max(a.Urx, b.Urx),
+		Ury: math.Max(a.Ury, b.Ury),
+	}
+}
+
+// normalized returns `r` with its lower left corner first.
+func normalized(r model.PdfRectangle) model.PdfRectangle {
+	return segment(r.Llx, r.Lly, r.Urx, r.Ury)
+}
+
+// round returns `v` rounded to 2 decimals.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,670 @@
+/*
+ * Package glyphs maps the text showing operators of a content stream to individual glyphs with
+ * their Unicode text, font and approximate position on the page, and rewrites the content stream
+ * after glyphs have been replaced or erased.
+ *
+ * Unlike the extractor, which only returns the text marks of a page, the glyphs returned here keep
+ * a reference to the string operand they came from so they can be edited in place, regardless of
+ * how the text was split over TJ array elements or text showing operators and of the font
+ * encoding (simple fonts as well as composite fonts such as Identity-H).
+ *
+ * Used by text/replace and the search and replace example text/pdf_search_replace.go.
+ */
+
+package glyphs
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/unidoc/unipdf/v3/common"
+	"github.com/unidoc/unipdf/v3/contentstream"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Glyph is a single glyph shown by a text showing operator (Tj, TJ, ' or ").
+type Glyph struct {
+	Text       string             // Unicode text of the glyph. Empty if the font has no mapping for it.
+	Code       []byte             // Character code of the glyph in the encoding of Font.
+	Font       *model.PdfFont     // Font the glyph is shown with.
+	FontName   core.PdfObjectName // Resource name of Font.
+	FontSize   float64            // Font size set by Tf.
+	BBox       model.PdfRectangle // Approximate bounding box in page coordinates.
+	TextObject int                // Index of the BT/ET text object the glyph belongs to.
+
+	op      int     // Index of the text showing operation in Content.Ops.
+	str     int     // Index of the string in the TJ array. 0 for Tj, ' and ".
+	start   int     // Start of Code in the string operand.
+	end     int     // End of Code in the string operand.
+	advance float64 // Horizontal displacement of the glyph in unscaled text space units.
+}
+
+// Content is a parsed content stream with the glyphs it shows.
+type Content struct {
+	Ops    contentstream.ContentStreamOperations
+	Glyphs []Glyph
+
+	codes  map[int][]byte // Replacement codes by glyph index.
+	erased map[int]bool   // Glyphs erased with Erase.
+}
+
+// Parse parses `contents` and locates the glyphs of all text showing operators. `resources` are
+// the resources the content stream refers to (page or form XObject resources).
+// Text shown by form XObjects invoked from `contents` is not included; parse the content stream of
+// the form with its own resources instead.
+func Parse(contents string, resources *model.PdfPageResources) (*Content, error) {
+	return ParseWithMatrix(contents, resources, IdentityMatrix())
+}
+
+// ParseWithMatrix is like Parse but with the initial transformation matrix [a b c d e f] given by
+// `m`, e.g. the form matrix combined with the CTM at the point the form is invoked.
+func ParseWithMatrix(contents string, resources *model.PdfPageResources, m Matrix) (*Content, error) {
+	ops, err := contentstream.NewContentStreamParser(contents).Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Content{
+		Ops:    *ops,
+		codes:  map[int][]byte{},
+		erased: map[int]bool{},
+	}
+
+	opIndex := map[*contentstream.ContentStreamOperation]int{}
+	for i, op := range c.Ops {
+		opIndex[op] = i
+	}
+
+	w := newWalker(c, resources, m)
+	processor := contentstream.NewContentStreamProcessor(c.Ops)
+	processor.AddHandler(contentstream.HandlerConditionEnumAllOperands, "",
+		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
+			w.process(opIndex[op], op, CTM(gs).Mult(w.base))
+			return nil
+		})
+	if err := processor.Process(resources); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Text returns the concatenated text of `glyphs`.
+func Text(glyphs []Glyph) string {
+	var sb strings.Builder
+	for _, g := range glyphs {
+		sb.WriteString(g.Text)
+	}
+	return sb.String()
+}
+
+// Layout returns the text of `glyphs` in content stream order with a space inserted between glyphs
+// that are visibly apart and a newline between lines, together with the index of the glyph each
+// byte of the text belongs to (-1 for inserted separators).
+func Layout(all []Glyph) (string, []int) {
+	var sb strings.Builder
+	var index []int
+	add := func(s string, i int) {
+		sb.WriteString(s)
+		for k := 0; k < len(s); k++ {
+			index = append(index, i)
+		}
+	}
+
+	for i, g := range all {
+		if i > 0 && g.Text != "" {
+			prev := all[i-1]
+			switch {
+			case !sameLine(prev.BBox, g.BBox):
+				add("\n", -1)
+			case g.BBox.Llx-prev.BBox.Urx > 0.2*g.FontSize && !endsWithSpace(sb.String()) && !unicode.IsSpace(firstRune(g.Text)):
+				add(" ", -1)
+			}
+		}
+		add(g.Text, i)
+	}
+	return sb.String(), index
+}
+
+// sameLine returns true if `a` and `b` overlap vertically by at least half of the lower one.
+func sameLine(a, b model.PdfRectangle) bool {
+	overlap := math.Min(a.Ury, b.Ury) - math.Max(a.Lly, b.Lly)
+	height := math.Min(a.Ury-a.Lly, b.Ury-b.Lly)
+	return overlap >= 0.5*height
+}
+
+func endsWithSpace(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return s == "" || unicode.IsSpace(r)
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+// SetCode replaces the character code of glyph `i` with `code`, which must be encoded for the font
+// of the glyph. `code` may contain several character codes or none at all. Glyphs following in the
+// same string move according to the width of the new code.
+func (c *Content) SetCode(i int, code []byte) {
+	delete(c.erased, i)
+	c.codes[i] = code
+}
+
+// Erase removes glyph `i` while keeping the following glyphs at their positions. The text showing
+// operator is rewritten as a TJ operator with a displacement in place of the glyph if needed.
+func (c *Content) Erase(i int) {
+	delete(c.codes, i)
+	c.erased[i] = true
+}
+
+// Modified returns true if any glyph has been replaced or erased.
+func (c *Content) Modified() bool {
+	return len(c.codes) > 0 || len(c.erased) > 0
+}
+
+// Bytes returns the content stream with all glyph replacements and erasures applied.
+func (c *Content) Bytes() []byte {
+	if !c.Modified() {
+		return c.Ops.Bytes()
+	}
+
+	// Glyph indices by operation, in order of appearance.
+	byOp := map[int][]int{}
+	for i, g := range c.Glyphs {
+		if _, ok := c.codes[i]; ok || c.erased[i] {
+			byOp[g.op] = nil
+		}
+	}
+	for i, g := range c.Glyphs {
+		if _, ok := byOp[g.op]; ok {
+			byOp[g.op] = append(byOp[g.op], i)
+		}
+	}
+
+	var out contentstream.ContentStreamOperations
+	for i, op := range c.Ops {
+		glyphs, ok := byOp[i]
+		if !ok {
+			out = append(out, op)
+			continue
+		}
+		out = append(out, c.rewrite(op, glyphs)...)
+	}
+	return out.Bytes()
+}
+
+// rewrite returns the operations replacing text showing operation `op` containing the glyphs
+// `glyphs`.
+func (c *Content) rewrite(op *contentstream.ContentStreamOperation, glyphs []int) []*contentstream.ContentStreamOperation {
+	var strIndex int
+	switch op.Operand {
+	case "Tj", "'":
+		strIndex = 0
+	case `"`:
+		strIndex = 2
+	case "TJ":
+		arr, ok := core.GetArray(op.Params[0])
+		if !ok {
+			return []*contentstream.ContentStreamOperation{op}
+		}
+		var elements []core.PdfObject
+		for j, obj := range arr.Elements() {
+			str, ok := core.GetString(obj)
+			if !ok {
+				elements = append(elements, obj)
+				continue
+			}
+			elements = append(elements, c.rewriteString(str, glyphsOfString(c.Glyphs, glyphs, j))...)
+		}
+		return []*contentstream.ContentStreamOperation{
+			{Operand: "TJ", Params: []core.PdfObject{core.MakeArray(elements...)}},
+		}
+	}
+
+	str, ok := core.GetString(op.Params[strIndex])
+	if !ok {
+		return []*contentstream.ContentStreamOperation{op}
+	}
+	elements := c.rewriteString(str, glyphs)
+	if len(elements) == 1 {
+		params := append([]core.PdfObject{}, op.Params...)
+		params[strIndex] = elements[0]
+		return []*contentstream.ContentStreamOperation{{Operand: op.Operand, Params: params}}
+	}
+
+	// Erased glyphs need displacements, which requires a TJ operator.
+	var ops []*contentstream.ContentStreamOperation
+	switch op.Operand {
+	case `"`:
+		ops = append(ops,
+			&contentstream.ContentStreamOperation{Operand: "Tw", Params: op.Params[0:1]},
+			&contentstream.ContentStreamOperation{Operand: "Tc", Params: op.Params[1:2]},
+			&contentstream.ContentStreamOperation{Operand: "T*"})
+	case "'":
+		ops = append(ops, &contentstream.ContentStreamOperation{Operand: "T*"})
+	}
+	return append(ops, &contentstream.ContentStreamOperation{
+		Operand: "TJ",
+		Params:  []core.PdfObject{core.MakeArray(elements...)},
+	})
+}
+
+// rewriteString returns the TJ elements replacing string operand `str` containing `glyphs`.
+func (c *Content) rewriteString(str *core.PdfObjectString, glyphs []int) []core.PdfObject {
+	data := str.Bytes()
+	hex := strings.HasPrefix(str.WriteString(), "<")
+	makeString := func(b []byte) core.PdfObject {
+		if hex {
+			return core.MakeHexString(string(b))
+		}
+		return core.MakeStringFromBytes(b)
+	}
+
+	var elements []core.PdfObject
+	var buf []byte
+	var displacement float64 // Displacement of consecutive erased glyphs in thousandths of text space.
+	flush := func() {
+		if len(buf) > 0 {
+			elements = append(elements, makeString(buf))
+			buf = nil
+		}
+		if displacement != 0 {
+			elements = append(elements, core.MakeFloat(math.Round(displacement*1000)/1000))
+			displacement = 0
+		}
+	}
+
+	addBytes := func(b []byte) {
+		if len(b) == 0 {
+			return
+		}
+		if displacement != 0 {
+			flush()
+		}
+		buf = append(buf, b...)
+	}
+
+	pos := 0
+	for _, i := range glyphs {
+		g := c.Glyphs[i]
+		addBytes(data[pos:g.start])
+		pos = g.end
+		switch code, ok := c.codes[i]; {
+		case ok:
+			addBytes(code)
+		case !c.erased[i]:
+			addBytes(data[g.start:g.end])
+		case g.FontSize != 0:
+			if len(buf) > 0 {
+				flush()
+			}
+			displacement -= g.advance / g.FontSize * 1000
+		}
+	}
+	addBytes(data[pos:])
+	flush()
+	if len(elements) == 0 {
+		elements = append(elements, makeString(nil))
+	}
+	return elements
+}
+
+// glyphsOfString returns the subset of `glyphs` located in TJ array element `str`.
+func glyphsOfString(all []Glyph, glyphs []int, str int) []int {
+	var res []int
+	for _, i := range glyphs {
+		if all[i].str == str {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// textState is the part of the text state that is saved and restored with the graphics state.
+type textState struct {
+	font     *model.PdfFont
+	fontName core.PdfObjectName
+	fontSize float64
+	tc       float64 // Character spacing.
+	tw       float64 // Word spacing.
+	th       float64 // Horizontal scaling.
+	tl       float64 // Leading.
+	rise     float64
+}
+
+// walker tracks the text state while processing a content stream and collects the glyphs.
+type walker struct {
+	c         *Content
+	resources *model.PdfPageResources
+	base      Matrix
+	fonts     map[core.PdfObjectName]*model.PdfFont
+
+	ts         textState
+	stack      []textState
+	tm, tlm    Matrix
+	textObject int
+}
+
+func newWalker(c *Content, resources *model.PdfPageResources, base Matrix) *walker {
+	return &walker{
+		c:          c,
+		resources:  resources,
+		base:       base,
+		fonts:      map[core.PdfObjectName]*model.PdfFont{},
+		ts:         textState{th: 1},
+		tm:         IdentityMatrix(),
+		tlm:        IdentityMatrix(),
+		textObject: -1,
+	}
+}
+
+// process updates the text state for operation `op` at index `opIdx` and records the glyphs shown.
+func (w *walker) process(opIdx int, op *contentstream.ContentStreamOperation, ctm Matrix) {
+	floats, _ := core.GetNumbersAsFloat(op.Params)
+
+	switch op.Operand {
+	case "q":
+		w.stack = append(w.stack, w.ts)
+	case "Q":
+		if n := len(w.stack); n > 0 {
+			w.ts = w.stack[n-1]
+			w.stack = w.stack[:n-1]
+		}
+	case "BT":
+		w.tm = IdentityMatrix()
+		w.tlm = IdentityMatrix()
+		w.textObject++
+	case "Tf":
+		if len(op.Params) != 2 {
+			common.Log.Debug("Invalid: Tf with invalid set of parameters - skip")
+			return
+		}
+		name, _ := core.GetName(op.Params[0])
+		size, err := core.GetNumberAsFloat(op.Params[1])
+		if name == nil || err != nil {
+			common.Log.Debug("Invalid: Tf with invalid parameters - skip")
+			return
+		}
+		w.ts.font = w.loadFont(*name)
+		w.ts.fontName = *name
+		w.ts.fontSize = size
+	case "Tc":
+		if len(floats) == 1 {
+			w.ts.tc = floats[0]
+		}
+	case "Tw":
+		if len(floats) == 1 {
+			w.ts.tw = floats[0]
+		}
+	case "Tz":
+		if len(floats) == 1 {
+			w.ts.th = floats[0] / 100
+		}
+	case "TL":
+		if len(floats) == 1 {
+			w.ts.tl = floats[0]
+		}
+	case "Ts":
+		if len(floats) == 1 {
+			w.ts.rise = floats[0]
+		}
+	case "Td", "TD":
+		if len(floats) != 2 {
+			common.Log.Debug("Invalid: %s with invalid set of parameters - skip", op.Operand)
+			return
+		}
+		if op.Operand == "TD" {
+			w.ts.tl = -floats[1]
+		}
+		w.moveLine(floats[0], floats[1])
+	case "Tm":
+		if len(floats) != 6 {
+			common.Log.Debug("Invalid: Tm with invalid set of parameters - skip")
+			return
+		}
+		w.tlm = Matrix{floats[0], floats[1], floats[2], floats[3], floats[4], floats[5]}
+		w.tm = w.tlm
+	case "T*":
+		w.moveLine(0, -w.ts.tl)
+	case "Tj":
+		if len(op.Params) != 1 {
+			common.Log.Debug("Invalid: Tj with invalid set of parameters - skip")
+			return
+		}
+		w.show(opIdx, 0, op.Params[0], ctm)
+	case "'":
+		if len(op.Params) != 1 {
+			common.Log.Debug("Invalid: ' with invalid set of parameters - skip")
+			return
+		}
+		w.moveLine(0, -w.ts.tl)
+		w.show(opIdx, 0, op.Params[0], ctm)
+	case `"`:
+		if len(op.Params) != 3 {
+			common.Log.Debug("Invalid: \" with invalid set of parameters - skip")
+			return
+		}
+		floats, err := core.GetNumbersAsFloat(op.Params[:2])
+		if err != nil {
+			common.Log.Debug("Invalid: \" with invalid parameters - skip")
+			return
+		}
+		w.ts.tw, w.ts.tc = floats[0], floats[1]
+		w.moveLine(0, -w.ts.tl)
+		w.show(opIdx, 0, op.Params[2], ctm)
+	case "TJ":
+		if len(op.Params) != 1 {
+			common.Log.Debug("Invalid: TJ with invalid set of parameters - skip")
+			return
+		}
+		arr, ok := core.GetArray(op.Params[0])
+		if !ok {
+			return
+		}
+		for j, obj := range arr.Elements() {
+			if _, isStr := core.GetString(obj); isStr {
+				w.show(opIdx, j, obj, ctm)
+				continue
+			}
+			if adj, err := core.GetNumberAsFloat(obj); err == nil {
+				w.translate(-adj / 1000 * w.ts.fontSize * w.ts.th)
+			}
+		}
+	}
+}
+
+// moveLine starts a new line offset by (tx, ty) from the start of the current line.
+func (w *walker) moveLine(tx, ty float64) {
+	w.tlm = Matrix{1, 0, 0, 1, tx, ty}.Mult(w.tlm)
+	w.tm = w.tlm
+}
+
+// translate moves the text position horizontally by `tx` text space units.
+func (w *walker) translate(tx float64) {
+	w.tm = Matrix{1, 0, 0, 1, tx, 0}.Mult(w.tm)
+}
+
+// show records the glyphs of string operand `obj` (element `str` of a TJ array) of operation `opIdx`.
+func (w *walker) show(opIdx, str int, obj core.PdfObject, ctm Matrix) {
+	s, ok := core.GetString(obj)
+	if !ok {
+		return
+	}
+	data := s.Bytes()
+	font := w.ts.font
+	if font == nil || len(data) == 0 {
+		common.Log.Debug("No font for text showing operator - skip")
+		return
+	}
+
+	ascent, descent := fontExtent(font)
+	codes := font.BytesToCharcodes(data)
+	texts, _, _ := font.CharcodesToStrings(codes)
+
+	// Byte length of each character code. Codes of varying lengths are not split.
+	codeLen := 0
+	switch {
+	case len(codes) == len(data):
+		codeLen = 1
+	case len(codes)*2 == len(data):
+		codeLen = 2
+	}
+
+	ts := w.ts
+	pos := 0
+	for k, code := range codes {
+		start, end := pos, pos+codeLen
+		if codeLen == 0 {
+			start, end = 0, len(data)
+		}
+		pos = end
+
+		w0 := 0.5
+		if metrics, ok := font.GetCharMetrics(code); ok {
+			w0 = metrics.Wx / 1000
+		}
+
+		trm := Matrix{ts.fontSize * ts.th, 0, 0, ts.fontSize, 0, ts.rise}.Mult(w.tm).Mult(ctm)
+		g := Glyph{
+			Code:       data[start:end],
+			Font:       font,
+			FontName:   ts.fontName,
+			FontSize:   ts.fontSize,
+			BBox:       trm.BBox(0, descent, w0, ascent),
+			TextObject: w.textObject,
+			op:         opIdx,
+			str:        str,
+			start:      start,
+			end:        end,
+		}
+		if k < len(texts) {
+			g.Text = texts[k]
+		}
+
+		advance := w0*ts.fontSize + ts.tc
+		if end-start == 1 && data[start] == ' ' {
+			advance += ts.tw
+		}
+		g.advance = advance
+		w.translate(advance * ts.th)
+
+		if codeLen == 0 {
+			// Keep the whole string as a single glyph so it can still be edited as a unit.
+			if len(w.c.Glyphs) > 0 && k > 0 {
+				last := &w.c.Glyphs[len(w.c.Glyphs)-1]
+				last.Text += g.Text
+				last.advance += g.advance
+				last.BBox = union(last.BBox, g.BBox)
+				continue
+			}
+		}
+		w.c.Glyphs = append(w.c.Glyphs, g)
+	}
+}
+
+// loadFont returns the font named `name` in the resources, or nil if it cannot be loaded.
+func (w *walker) loadFont(name core.PdfObjectName) *model.PdfFont {
+	if font, ok := w.fonts[name]; ok {
+		return font
+	}
+	var font *model.PdfFont
+	if w.resources != nil {
+		if obj, ok := w.resources.GetFontByName(name); ok {
+			var err error
+			font, err = model.NewPdfFontFromPdfObject(obj)
+			if err != nil {
+				common.Log.Debug("Unable to load font %s: %v", name, err)
+				font = nil
+			}
+		}
+	}
+	w.fonts[name] = font
+	return font
+}
+
+// fontExtent returns the ascent and descent of `font` in glyph space units, with defaults if the
+// font descriptor does not specify them.
+func fontExtent(font *model.PdfFont) (float64, float64) {
+	ascent, descent := 0.8, -0.2
+	fd := font.FontDescriptor()
+	if fd == nil {
+		return ascent, descent
+	}
+	if v, err := core.GetNumberAsFloat(fd.Ascent); err == nil && v > 0 {
+		ascent = v / 1000
+	}
+	if v, err := core.GetNumberAsFloat(fd.Descent); err == nil && v < 0 {
+		descent = v / 1000
+	}
+	return ascent, descent
+}
+
+// Matrix is a transformation matrix [a b c d e f].
+type Matrix [6]float64
+
+// IdentityMatrix returns the identity matrix.
+func IdentityMatrix() Matrix {
+	return Matrix{1, 0, 0, 1, 0, 0}
+}
+
+// CTM returns the current transformation matrix of `gs`.
+func CTM(gs contentstream.GraphicsState) Matrix {
+	return Matrix{gs.CTM[0], gs.CTM[1], gs.CTM[3], gs.CTM[4], gs.CTM[6], gs.CTM[7]}
+}
+
+// Mult returns m × n, i.e. `m` applied first, then `n`.
+func (m Matrix) Mult(n Matrix) Matrix {
+	return Matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// Inverse returns the inverse of `m`. It returns false if `m` is not invertible.
+func (m Matrix) Inverse() (Matrix, bool) {
+	det := m[0]*m[3] - m[1]*m[2]
+	if math.Abs(det) < 1e-10 {
+		return Matrix{}, false
+	}
+	return Matrix{
+		m[3] / det,
+		-m[1] / det,
+		-m[2] / det,
+		m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det,
+		(m[1]*m[4] - m[0]*m[5]) / det,
+	}, true
+}
+
+// Transform returns point (x, y) transformed by `m`.
+func (m Matrix) Transform(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// BBox returns the bounding box of rectangle (llx, lly, urx, ury) transformed by `m`.
+func (m Matrix) BBox(llx, lly, urx, ury float64) model.PdfRectangle {
+	r := model.PdfRectangle{Llx: math.Inf(1), Lly: math.Inf(1), Urx: math.Inf(-1), Ury: math.Inf(-1)}
+	for _, p := range [][2]float64{{llx, lly}, {urx, lly}, {urx, ury}, {llx, ury}} {
+		x, y := m.Transform(p[0], p[1])
+		r.Llx, r.Lly = math.Min(r.Llx, x), math.Min(r.Lly, y)
+		r.Urx, r.Ury = math.Max(r.Urx, x), math.Max(r.Ury, y)
+	}
+	return r
+}
+
+// union returns the smallest rectangle containing `a` and `b`.
+func union(a, b model.PdfRectangle) model.PdfRectangle {
+	return model.PdfRectangle{
+		Llx: math.Min(a.Llx, b.Llx),
+		Lly: math.Min(a.Lly, b.Lly),
+		Urx: math.Max(a.Urx, b.Urx),
+		Ury: math.Max(a.Ury, b.Ury),
+	}
+}
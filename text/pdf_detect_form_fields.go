@@ -0,0 +1,81 @@
+/*
+ * Convert a flat PDF form into a fillable one: the fill-in lines, boxes, check boxes and signature
+ * lines printed on its pages are detected, named from their labels and replaced by AcroForm fields.
+ * The form spec of the detected fields is optionally written too, as JSON if its name ends with
+ * .json and as YAML otherwise, to be reviewed and added with forms/pdf_form_design.go.
+ *
+ * Run as: go run pdf_detect_form_fields.go input.pdf output.pdf [spec.yaml]
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/forms/design"
+	"github.com/unidoc/unidoc-examples/text/detect"
+)
+
+func init() {
+	// Make sure to load your metered License API key prior to using the library.
+	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	err := license.SetMeteredKey(os.Getenv(`UNIDOC_LICENSE_API_KEY`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Printf("Convert a flat PDF form into a fillable AcroForm\n")
+		fmt.Printf("Usage: go run pdf_detect_form_fields.go input.pdf output.pdf [spec.yaml]\n")
+		os.Exit(1)
+	}
+	inputPath := os.Args[1]
+	outputPath := os.Args[2]
+	specPath := ""
+	if len(os.Args) > 3 {
+		specPath = os.Args[3]
+	}
+
+	err := detectFormFields(inputPath, outputPath, specPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Success, output written to %s\n", outputPath)
+}
+
+// detectFormFields adds fields for the fillable regions of the PDF `inputPath` and writes the
+// result to `outputPath`, and the form spec of the fields to `specPath` if it isn't empty.
+func detectFormFields(inputPath, outputPath, specPath string) error {
+	pdfReader, f, err := model.NewPdfReaderFromFile(inputPath, nil)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	spec, err := detect.Detect(pdfReader, detect.Options{})
+	if err != nil {
+		return err
+	}
+	for _, field := range spec.Fields {
+		fmt.Printf("%s field %s on page %d at %v\n", field.Type, field.Name, field.Page, field.Rect)
+	}
+	if specPath != "" {
+		if err := spec.Save(specPath); err != nil {
+			return err
+		}
+	}
+
+	pdfWriter, err := design.AddToReader(pdfReader, spec)
+	if err != nil {
+		return err
+	}
+	return pdfWriter.WriteToFile(outputPath)
+}
@@ -1,6 +1,8 @@
 /*
- * Basic example for text searching: Retrieving position of a signature line in PDF where the signature line is given by
- * "__________________" text. And positioned with a Tm operation above.
+ * Basic example for form field detection: Retrieving the positions of the signature lines and boxes
+ * in a PDF, i.e. the "__________________" lines, line paths and boxes labelled "Signature" or
+ * "Sign here", using text/detect. On pages without such a labelled region any "________________"
+ * text is reported as signature line, at the position of the Tm operation before it.
  *
  * Run as: go run pdf_detect_signature.go input.pdf
  */
@@ -17,6 +19,8 @@ import (
 	"github.com/unidoc/unipdf/v3/contentstream"
 	"github.com/unidoc/unipdf/v3/core"
 	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/text/detect"
 )
 
 func init() {
@@ -50,79 +54,84 @@ func detectSignatureInput(inputPath string) error {
 	}
 	defer f.Close()
 
-	numPages, err := pdfReader.GetNumPages()
-	if err != nil {
-		return err
-	}
-
-	for i := 0; i < numPages; i++ {
+	found := false
+	for i, page := range pdfReader.PageList {
 		pageNum := i + 1
 
-		page, err := pdfReader.GetPage(pageNum)
+		regions, err := detect.DetectPage(page, pageNum, detect.Options{})
 		if err != nil {
 			return err
 		}
-
-		if pageNum == 1 {
-			found, x, y, err := locateSignatureLine(page)
-			if err != nil {
-				return err
-			}
-			// Happens if did not find the "___.." line or if there was no Tm position marker before.
-			if !found || (x == 0 && y == 0) {
-				return errors.New("Unable to find the signature line")
+		labelled := false
+		for _, r := range regions {
+			if r.Kind != detect.KindSignature {
+				continue
 			}
-
-			fmt.Printf("Position: x: %f, y: %f\n", x, y)
+			labelled = true
+			fmt.Printf("Page %d: %q\n", pageNum, r.Label)
+			fmt.Printf("Position: x: %f, y: %f\n", r.Rect.Llx, r.Rect.Lly)
+		}
+		found = found || labelled
+		if labelled {
+			continue
 		}
 
+		// Fall back to unlabelled "____" lines.
+		lines, err := locateSignatureLines(page)
+		if err != nil {
+			return err
+		}
+		for _, l := range lines {
+			found = true
+			fmt.Printf("Page %d: Tj: %s\n", pageNum, l.text)
+			fmt.Printf("Position: x: %f, y: %f\n", l.x, l.y)
+		}
 	}
 
+	if !found {
+		return errors.New("Unable to find the signature line")
+	}
 	return nil
 }
 
-func locateSignatureLine(page *model.PdfPage) (bool, float64, float64, error) {
-	found := false
-	x := float64(0)
-	y := float64(0)
+// signatureLine is a "____" text shown by a Tj operation.
+type signatureLine struct {
+	text string
+	x, y float64
+}
 
+// locateSignatureLines returns the "____" texts of `page` at the position of the last Tm operation
+// before them. Texts without a Tm position marker before them are skipped.
+func locateSignatureLines(page *model.PdfPage) ([]signatureLine, error) {
 	pageContentStr, err := page.GetAllContentStreams()
 	if err != nil {
-		return found, x, y, err
+		return nil, err
 	}
 
 	cstreamParser := contentstream.NewContentStreamParser(pageContentStr)
-	if err != nil {
-		return found, x, y, err
-	}
-
 	operations, err := cstreamParser.Parse()
 	if err != nil {
-		return found, x, y, err
+		return nil, err
 	}
 
+	var lines []signatureLine
+	x, y := float64(0), float64(0)
 	for _, op := range *operations {
 		switch {
 		case op.Operand == "Tm" && len(op.Params) == 6:
 			if val, has := core.GetFloatVal(op.Params[4]); has {
 				x = val
 			}
-
 			if val, has := core.GetFloatVal(op.Params[5]); has {
 				y = val
 			}
 
 		case op.Operand == "Tj" && len(op.Params) == 1:
 			str, isStr := core.GetStringVal(op.Params[0])
-			if isStr {
-				if strings.Contains(str, "________________") {
-					fmt.Printf("Tj: %s\n", str)
-					found = true
-					break
-				}
+			if isStr && strings.Contains(str, "________________") && (x != 0 || y != 0) {
+				lines = append(lines, signatureLine{text: str, x: x, y: y})
 			}
 		}
 	}
-
-	return found, x, y, nil
+	return lines, nil
 }
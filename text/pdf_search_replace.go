@@ -1,21 +1,36 @@
 /*
- * pdf_search_replace.go - Basic example of find and replace with UniDoc.
- * Replaces <text> with <replace text> in the output PDF.
+ * pdf_search_replace.go - Example of find and replace with UniDoc.
+ * Replaces <text> with <replace text> in the output PDF and reports the number and locations of the
+ * replacements per page.
  *
- * Syntax: go run pdf_search_replace.go <input.pdf> <output.pdf> <text> <replace text>
+ * Matching is done on the decoded page text, so text split over several TJ array elements or text
+ * showing operators is found as well. The replacement is encoded with the font of the matched text
+ * (including composite fonts such as Identity-H). Matches that the font cannot encode are reported
+ * as skipped. The search and replace is implemented in the reusable replace package
+ * (replace/lib_replace.go).
+ *
+ * Syntax: go run pdf_search_replace.go [options] <input.pdf> <output.pdf> <text> <replace text>
+ * Options:
+ *  -regex        <text> is a regular expression, <replace text> may refer to submatches as $1.
+ *  -i            Case-insensitive matching.
+ *  -w            Whole words only.
+ *  -report file  Write the matches as JSON to file.
+ *  -verify       Re-extract the text of the output and count the remaining matches.
+ *
+ * Example: go run pdf_search_replace.go -i -w input.pdf output.pdf "acme corp" "Example Inc"
  */
 
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"strings"
 
-	"github.com/unidoc/unipdf/v3/common"
+	"github.com/unidoc/unidoc-examples/text/replace"
 	"github.com/unidoc/unipdf/v3/common/license"
-	"github.com/unidoc/unipdf/v3/contentstream"
-	"github.com/unidoc/unipdf/v3/core"
 	"github.com/unidoc/unipdf/v3/model"
 	"github.com/unidoc/unipdf/v3/model/optimize"
 )
@@ -30,56 +45,116 @@ func init() {
 }
 
 func main() {
-	if len(os.Args) < 5 {
-		fmt.Printf("Usage: go run pdf_search_replace.go <input.pdf> <output.pdf> <text> <replace text>\n")
+	var (
+		opts       replace.Options
+		reportPath string
+		verify     bool
+	)
+	flag.BoolVar(&opts.Regexp, "regex", false, "Treat <text> as a regular expression")
+	flag.BoolVar(&opts.IgnoreCase, "i", false, "Case-insensitive matching")
+	flag.BoolVar(&opts.WholeWord, "w", false, "Match whole words only")
+	flag.StringVar(&reportPath, "report", "", "Write the matches as JSON to this file")
+	flag.BoolVar(&verify, "verify", false, "Count the matches remaining in the extracted text of the output")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 4 {
+		fmt.Printf("Usage: go run pdf_search_replace.go [options] <input.pdf> <output.pdf> <text> <replace text>\n")
 		os.Exit(0)
 	}
 
-	inputPath := os.Args[1]
-	outputPath := os.Args[2]
-	searchText := os.Args[3]
-	replaceText := os.Args[4]
+	inputPath := args[0]
+	outputPath := args[1]
+	searchText := args[2]
+	replaceText := args[3]
+
+	r, err := replace.New(searchText, replaceText, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	err := searchReplace(inputPath, outputPath, searchText, replaceText)
+	matches, err := searchReplace(inputPath, outputPath, r, verify)
 	if err != nil {
 		panic(err)
 	}
+
+	if reportPath != "" {
+		data, err := json.MarshalIndent(matches, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		if err := ioutil.WriteFile(reportPath, data, 0644); err != nil {
+			panic(err)
+		}
+	}
 	fmt.Printf("Successfully created %s\n", outputPath)
 }
 
-func searchReplace(inputPath, outputPath, searchText, replaceText string) error {
+// searchReplace replaces the matches of `r` in all pages of `inputPath`, writes the result to
+// `outputPath` and returns the matches found. A summary per page is printed.
+func searchReplace(inputPath, outputPath string, r *replace.Replacer, verify bool) ([]replace.Match, error) {
 	pdfWriter := model.NewPdfWriter()
 	pdfReader, f, err := model.NewPdfReaderFromFile(inputPath, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
 
 	numPages, err := pdfReader.GetNumPages()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var matches []replace.Match
 	for n := 1; n <= numPages; n++ {
 		page, err := pdfReader.GetPage(n)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		err = searchReplacePageText(page, searchText, replaceText)
+		pageMatches, err := r.ReplacePage(page, n)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		matches = append(matches, pageMatches...)
+
+		if len(pageMatches) > 0 {
+			replaced := 0
+			for _, m := range pageMatches {
+				if m.Skipped == "" {
+					replaced++
+				}
+			}
+			fmt.Printf("Page %d: %d replacement(s), %d skipped\n", n, replaced, len(pageMatches)-replaced)
+			for _, m := range pageMatches {
+				status := "replaced"
+				if m.Skipped != "" {
+					status = "skipped: " + m.Skipped
+				}
+				fmt.Printf("  %q -> %q at (%.2f, %.2f, %.2f, %.2f) [%s] %s\n",
+					m.Text, m.Replacement, m.BBox[0], m.BBox[1], m.BBox[2], m.BBox[3], m.Font, status)
+			}
+		}
+
+		if verify {
+			remaining, err := r.Count(page)
+			if err != nil {
+				return nil, err
+			}
+			if remaining > 0 {
+				fmt.Printf("Page %d: %d match(es) remaining in the extracted text\n", n, remaining)
+			}
 		}
 
 		err = pdfWriter.AddPage(page)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	fw, err := os.Create(outputPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer fw.Close()
 
@@ -91,70 +166,5 @@ func searchReplace(inputPath, outputPath, searchText, replaceText string) error
 	}
 	pdfWriter.SetOptimizer(optimize.New(opt))
 
-	return pdfWriter.Write(fw)
-}
-
-func searchReplacePageText(page *model.PdfPage, searchText, replaceText string) error {
-	contents, err := page.GetAllContentStreams()
-	if err != nil {
-		return err
-	}
-
-	csParser := contentstream.NewContentStreamParser(contents)
-	ops, err := csParser.Parse()
-	if err != nil {
-		return err
-	}
-
-	replaceFunc := func(objptr *core.PdfObject) {
-		strobj, ok := core.GetString(*objptr)
-		if !ok {
-			common.Log.Debug("Invalid parameter, skipping")
-			return
-		}
-
-		if strings.Contains(strobj.String(), searchText) {
-			s := strings.Replace(strobj.String(), searchText, replaceText, -1)
-			*strobj = *core.MakeString(s)
-		}
-	}
-
-	processor := contentstream.NewContentStreamProcessor(*ops)
-	processor.AddHandler(contentstream.HandlerConditionEnumAllOperands, "",
-		func(op *contentstream.ContentStreamOperation, gs contentstream.GraphicsState, resources *model.PdfPageResources) error {
-			switch op.Operand {
-			case `Tj`, `'`:
-				if len(op.Params) != 1 {
-					common.Log.Debug("Invalid: Tj/' with invalid set of parameters - skip")
-					return nil
-				}
-				replaceFunc(&op.Params[0])
-			case `"`:
-				if len(op.Params) != 3 {
-					common.Log.Debug("Invalid: \" with invalid set of parameters - skip")
-					return nil
-				}
-				replaceFunc(&op.Params[3])
-			case `TJ`:
-				if len(op.Params) != 1 {
-					common.Log.Debug("Invalid: TJ with invalid set of parameters - skip")
-					return nil
-				}
-				arr, _ := core.GetArray(op.Params[0])
-				for i := range arr.Elements() {
-					obj := arr.Get(i)
-					replaceFunc(&obj)
-					arr.Set(i, obj)
-				}
-			}
-
-			return nil
-		})
-
-	err = processor.Process(page.Resources)
-	if err != nil {
-		return err
-	}
-
-	return page.SetContentStreams([]string{ops.String()}, core.NewFlateEncoder())
+	return matches, pdfWriter.Write(fw)
 }
@@ -0,0 +1,222 @@
+/*
+ * Package replace implements search and replace of text in PDF pages. Matches are found in the
+ * decoded text of the page, so text split over several TJ array elements or text showing operators
+ * is matched as well. Patterns can be literal strings or regular expressions, optionally matched
+ * case-insensitively and on whole words only. Replacements are encoded with the font of the matched
+ * text, including composite (e.g. Identity-H) fonts.
+ *
+ * Used by text/pdf_search_replace.go.
+ */
+
+package replace
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/extractor"
+	"github.com/unidoc/unipdf/v3/model"
+
+	"github.com/unidoc/unidoc-examples/text/glyphs"
+)
+
+// Options controls how the search pattern is matched.
+type Options struct {
+	// Regexp treats the pattern as a regular expression (RE2 syntax). The replacement may refer to
+	// submatches as $1 or ${name}. Otherwise both are taken literally.
+	Regexp bool
+	// IgnoreCase matches case-insensitively.
+	IgnoreCase bool
+	// WholeWord only accepts matches that are not preceded or followed by a letter, digit or '_'.
+	WholeWord bool
+}
+
+// Replacer replaces matches of a pattern in PDF pages.
+type Replacer struct {
+	re          *regexp.Regexp
+	replacement string
+	opts        Options
+}
+
+// Match describes a single match on a page.
+type Match struct {
+	Page        int        `json:"page"`
+	Text        string     `json:"text"`
+	Replacement string     `json:"replacement"`
+	BBox        [4]float64 `json:"bbox"` // llx, lly, urx, ury in page coordinates.
+	Font        string     `json:"font"`
+	// Skipped is the reason the match was not replaced. Empty if it was.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// New returns a Replacer replacing `pattern` with `replacement`.
+func New(pattern, replacement string, opts Options) (*Replacer, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty search pattern")
+	}
+	if !opts.Regexp {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &Replacer{re: re, replacement: replacement, opts: opts}, nil
+}
+
+// ReplacePage replaces all matches in the content streams of `page`, which is page number `pageNum`
+// of the document. It returns all matches found, including those that could not be replaced, e.g.
+// because the font of the matched text cannot encode the replacement.
+// Text in form XObjects and annotations is not changed.
+func (r *Replacer) ReplacePage(page *model.PdfPage, pageNum int) ([]Match, error) {
+	contents, err := page.GetAllContentStreams()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := glyphs.Parse(contents, page.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := r.replace(c, pageNum)
+	if !c.Modified() {
+		return matches, nil
+	}
+	err = page.SetContentStreams([]string{string(c.Bytes())}, core.NewFlateEncoder())
+	return matches, err
+}
+
+// Count returns the number of matches in the text extracted from `page`. It can be used to verify
+// the result of ReplacePage, as the extracted text is independent of the content stream layout.
+func (r *Replacer) Count(page *model.PdfPage) (int, error) {
+	ex, err := extractor.New(page)
+	if err != nil {
+		return 0, err
+	}
+	pageText, _, _, err := ex.ExtractPageText()
+	if err != nil {
+		return 0, err
+	}
+	return len(r.find(pageText.Text())), nil
+}
+
+// replace replaces the matches in `c` and returns them.
+func (r *Replacer) replace(c *glyphs.Content, pageNum int) []Match {
+	text, index := glyphs.Layout(c.Glyphs)
+
+	var matches []Match
+	for _, loc := range r.find(text) {
+		start, end := loc[0], loc[1]
+
+		var matched []int
+		for _, i := range index[start:end] {
+			if i >= 0 && (len(matched) == 0 || matched[len(matched)-1] != i) {
+				matched = append(matched, i)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		first := c.Glyphs[matched[0]]
+		m := Match{
+			Page:        pageNum,
+			Text:        text[start:end],
+			Replacement: r.replacement,
+			BBox:        bbox(c.Glyphs, matched),
+			Font:        string(first.FontName),
+		}
+		if r.opts.Regexp {
+			m.Replacement = string(r.re.ExpandString(nil, r.replacement, text, loc))
+		}
+		if first.Font != nil {
+			m.Font = fmt.Sprintf("%s (%s)", first.FontName, first.Font.BaseFont())
+		}
+
+		code, err := encode(first.Font, m.Replacement)
+		if err != nil {
+			m.Skipped = err.Error()
+			matches = append(matches, m)
+			continue
+		}
+
+		// The replacement goes into the first glyph, the other matched glyphs are removed.
+		c.SetCode(matched[0], code)
+		for _, i := range matched[1:] {
+			c.SetCode(i, nil)
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// find returns the locations of all matches in `text`.
+func (r *Replacer) find(text string) [][]int {
+	var locs [][]int
+	for _, loc := range r.re.FindAllStringSubmatchIndex(text, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		if r.opts.WholeWord && !isWordBoundary(text, loc[0], loc[1]) {
+			continue
+		}
+		locs = append(locs, loc)
+	}
+	return locs
+}
+
+// isWordBoundary returns true if text[start:end] is not adjacent to word characters.
+func isWordBoundary(text string, start, end int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWordRune(before) {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWordRune(after) {
+		return false
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// encode returns `s` encoded with `font`. An error is returned if `font` cannot represent `s`.
+func encode(font *model.PdfFont, s string) ([]byte, error) {
+	if font == nil {
+		return nil, fmt.Errorf("font not available")
+	}
+	code, misses := font.StringToCharcodeBytes(s)
+	if misses > 0 {
+		return nil, fmt.Errorf("font %s cannot encode %q", font.BaseFont(), s)
+	}
+
+	// Round trip to catch encodings that silently map to other characters, e.g. subsetted CID fonts
+	// without the needed glyphs.
+	if decoded, _, _ := font.CharcodeBytesToUnicode(code); decoded != s {
+		return nil, fmt.Errorf("font %s cannot encode %q", font.BaseFont(), s)
+	}
+	for _, charcode := range font.BytesToCharcodes(code) {
+		if _, ok := font.GetCharMetrics(charcode); !ok {
+			return nil, fmt.Errorf("font %s has no glyph for all characters of %q", font.BaseFont(), s)
+		}
+	}
+	return code, nil
+}
+
+// bbox returns the union of the bounding boxes of the glyphs `indices` in `all`.
+func bbox(all []glyphs.Glyph, indices []int) [4]float64 {
+	b := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, i := range indices {
+		r := all[i].BBox
+		b = [4]float64{math.Min(b[0], r.Llx), math.Min(b[1], r.Lly), math.Max(b[2], r.Urx), math.Max(b[3], r.Ury)}
+	}
+	return b
+}
@@ -0,0 +1,379 @@
+/*
+ * Package segment groups the text marks of a PDF page into words, lines and columns, which allows
+ * extracting tabular data, e.g. as CSV.
+ *
+ * Used by text/pdf_to_csv.go.
+ */
+
+package segment
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/unidoc/unipdf/v3/common"
+	"github.com/unidoc/unipdf/v3/extractor"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// Word represents a word that has been segmented in PDF text.
+type Word struct {
+	ma *extractor.TextMarkArray
+}
+
+// Elements returns the text marks of the word.
+func (w Word) Elements() []extractor.TextMark {
+	if w.ma == nil {
+		return nil
+	}
+	return w.ma.Elements()
+}
+
+// BBox returns the bounding box of the word. The returned bool is false if the word has no marks
+// with a valid bounding box.
+func (w Word) BBox() (model.PdfRectangle, bool) {
+	if w.ma == nil {
+		return model.PdfRectangle{}, false
+	}
+	return w.ma.BBox()
+}
+
+// String returns the text of the word.
+func (w Word) String() string {
+	if w.ma == nil {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	for _, m := range w.Elements() {
+		buf.WriteString(m.Text)
+	}
+	return buf.String()
+}
+
+// Table is the result of segmenting the text marks of a page.
+type Table struct {
+	// Words are all words of the page.
+	Words []Word
+	// Lines are the words of the page grouped into lines, top to bottom, and each line left to right.
+	Lines [][]Word
+	// Columns are the bounding boxes of the table columns, left to right.
+	Columns []model.PdfRectangle
+	// Cells are the texts of the table cells, one row per line and one cell per column.
+	Cells [][]string
+}
+
+// Segment groups `textMarks` from a single page into words, lines and columns. The columns are
+// identified from lines with more than one word only, such that running text does not affect the
+// columns of a table.
+func Segment(textMarks *extractor.TextMarkArray) Table {
+	words := Words(textMarks)
+	lines := Lines(words)
+
+	// Filter out words in lines with only 1 column.
+	var tableWords []Word
+	for _, line := range lines {
+		if len(line) <= 1 {
+			continue
+		}
+		tableWords = append(tableWords, line...)
+	}
+
+	columns := Columns(tableWords)
+
+	return Table{
+		Words:   words,
+		Lines:   lines,
+		Columns: columns,
+		Cells:   TableData(lines, columns),
+	}
+}
+
+// CSV returns the cells of the table in CSV format.
+func (t Table) CSV() (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	err := w.WriteAll(t.Cells)
+	if err != nil {
+		return "", err
+	}
+	w.Flush()
+	return buf.String(), nil
+}
+
+// WordBBoxes returns the bounding boxes of the words in the table.
+func (t Table) WordBBoxes() []model.PdfRectangle {
+	var bboxes []model.PdfRectangle
+	for _, word := range t.Words {
+		wbbox, ok := word.BBox()
+		if !ok {
+			continue
+		}
+		bboxes = append(bboxes, wbbox)
+	}
+	return bboxes
+}
+
+// LineBBoxes returns the bounding boxes of the lines in the table.
+func (t Table) LineBBoxes() []model.PdfRectangle {
+	var bboxes []model.PdfRectangle
+	for _, line := range t.Lines {
+		var lineRect model.PdfRectangle
+		for i, word := range line {
+			wbbox, ok := word.BBox()
+			if !ok {
+				continue
+			}
+			if i == 0 {
+				lineRect = wbbox
+			} else {
+				lineRect = RectUnion(lineRect, wbbox)
+			}
+		}
+		bboxes = append(bboxes, lineRect)
+	}
+	return bboxes
+}
+
+// Words groups the closest text marks in `textMarks` that are overlapping into words.
+func Words(textMarks *extractor.TextMarkArray) []Word {
+	var words []Word
+	word := Word{ma: &extractor.TextMarkArray{}}
+	var lastMark extractor.TextMark
+	isFirst := true
+	for i, mark := range textMarks.Elements() {
+		if mark.Text == "" {
+			continue
+		}
+
+		common.Log.Trace("Mark %d - '%s' (% X)", i, mark.Text, mark.Text)
+		if isFirst {
+			word = Word{ma: &extractor.TextMarkArray{}}
+			word.ma.Append(mark)
+			lastMark = mark
+			isFirst = false
+			continue
+		}
+		overlap := overlaps(mark.BBox, lastMark.BBox)
+		common.Log.Trace(" - overlaps: %f", overlap)
+		if overlap > 0.1 {
+			if len(strings.TrimSpace(word.String())) > 0 {
+				common.Log.Trace("Appending word: '%s' (%d chars) (%d elements)", word.String(), len(word.String()), len(word.Elements()))
+				words = append(words, word)
+			}
+			word = Word{ma: &extractor.TextMarkArray{}}
+		}
+		word.ma.Append(mark)
+		lastMark = mark
+	}
+	if len(strings.TrimSpace(word.String())) > 0 {
+		common.Log.Trace("Appending word: '%s' (%d chars) (%d elements)", word.String(), len(word.String()), len(word.Elements()))
+		words = append(words, word)
+	}
+	return words
+}
+
+// Lines segments `words` into lines. The lines are sorted top to bottom and the words of each line
+// left to right.
+func Lines(words []Word) [][]Word {
+	var lines [][]Word
+
+	for _, word := range words {
+		wbbox, ok := word.BBox()
+		if !ok {
+			continue
+		}
+
+		match := false
+		for i, line := range lines {
+			firstWord := line[0]
+			firstBBox, ok := firstWord.BBox()
+			if !ok {
+				continue
+			}
+
+			overlap := lineOverlap(wbbox, firstBBox)
+			common.Log.Trace("'%s'/'%s' overlap: %v [%+v/%+v]", word.String(), firstWord.String(), overlap, wbbox, firstBBox)
+			if overlap < 0 {
+				lines[i] = append(lines[i], word)
+				match = true
+				break
+			}
+		}
+		if !match {
+			lines = append(lines, []Word{word})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		bboxi, _ := lines[i][0].BBox()
+		bboxj, _ := lines[j][0].BBox()
+		return bboxi.Lly >= bboxj.Lly
+	})
+	for li := range lines {
+		sort.SliceStable(lines[li], func(i, j int) bool {
+			bboxi, _ := lines[li][i].BBox()
+			bboxj, _ := lines[li][j].BBox()
+			return bboxi.Llx < bboxj.Llx
+		})
+	}
+	return lines
+}
+
+// Columns identifies the columns formed by `words` and returns their bounding boxes, left to right.
+// Overlapping columns are combined.
+func Columns(words []Word) []model.PdfRectangle {
+	var columns [][]Word
+	for _, word := range words {
+		wbbox, ok := word.BBox()
+		if !ok {
+			continue
+		}
+
+		match := false
+		bestOverlap := 1.0
+		bestColumn := 0
+		for i, column := range columns {
+			firstWord := column[0]
+			firstBBox, ok := firstWord.BBox()
+			if !ok {
+				continue
+			}
+
+			overlap := ColumnOverlap(wbbox, firstBBox)
+			common.Log.Trace("column: '%s'/'%s' overlap: %v [%+v/%+v]", word.String(), firstWord.String(), overlap, wbbox, firstBBox)
+			if overlap < 0.0 {
+				if overlap < bestOverlap {
+					bestOverlap = overlap
+					bestColumn = i
+				}
+				match = true
+			}
+		}
+		if match {
+			columns[bestColumn] = append(columns[bestColumn], word)
+		} else {
+			columns = append(columns, []Word{word})
+		}
+	}
+	sort.SliceStable(columns, func(i, j int) bool {
+		bboxi, _ := columns[i][0].BBox()
+		bboxj, _ := columns[j][0].BBox()
+		return bboxi.Llx < bboxj.Llx
+	})
+
+	var colGroups []model.PdfRectangle
+	for li, column := range columns {
+		var colRect model.PdfRectangle
+		for i, word := range column {
+			wbbox, ok := word.BBox()
+			if !ok {
+				continue
+			}
+
+			if i == 0 {
+				colRect = wbbox
+			} else {
+				colRect = RectUnion(colRect, wbbox)
+			}
+		}
+		common.Log.Trace("Column %d: Bbox: %+v", li+1, colRect)
+		colGroups = append(colGroups, colRect)
+	}
+
+	// Filter by combining overlapping columns.
+	var filtered []model.PdfRectangle
+	for i := 0; i < len(colGroups); {
+		colgroup := colGroups[i]
+		j := i + 1
+		for ; j < len(colGroups); j++ {
+			overlap := ColumnOverlap(colgroup, colGroups[j])
+			common.Log.Trace("COLUMN overlap %d/%d: %v (%+v/%+v)", i+1, j+1, overlap, colgroup, colGroups[j])
+			if overlap > 0.0 {
+				break
+			}
+			colgroup = RectUnion(colgroup, colGroups[j])
+		}
+		i = j
+		filtered = append(filtered, colgroup)
+	}
+	return filtered
+}
+
+// TableData converts the `lines` of words into table cell strings by accounting for the distribution
+// of the lines into the columns specified by `columnBBoxes`.
+func TableData(lines [][]Word, columnBBoxes []model.PdfRectangle) [][]string {
+	tabledata := [][]string{}
+	if len(columnBBoxes) == 0 {
+		return tabledata
+	}
+
+	for _, line := range lines {
+		linedata := make([]string, len(columnBBoxes))
+		for _, word := range line {
+			wordBBox, ok := word.BBox()
+			if !ok {
+				continue
+			}
+
+			bestColumn := 0
+			bestOverlap := 1.0
+			for icol, colBBox := range columnBBoxes {
+				overlap := ColumnOverlap(wordBBox, colBBox)
+				if overlap < bestOverlap {
+					bestOverlap = overlap
+					bestColumn = icol
+				}
+			}
+			linedata[bestColumn] += word.String()
+		}
+		tabledata = append(tabledata, linedata)
+	}
+	return tabledata
+}
+
+// RectUnion returns the smallest rectangle containing both `b1` and `b2`.
+func RectUnion(b1, b2 model.PdfRectangle) model.PdfRectangle {
+	return model.PdfRectangle{
+		Llx: math.Min(b1.Llx, b2.Llx),
+		Lly: math.Min(b1.Lly, b2.Lly),
+		Urx: math.Max(b1.Urx, b2.Urx),
+		Ury: math.Max(b1.Ury, b2.Ury),
+	}
+}
+
+func bboxArea(bbox model.PdfRectangle) float64 {
+	return math.Abs(bbox.Urx-bbox.Llx) * math.Abs(bbox.Ury-bbox.Lly)
+}
+
+// Measure of the difference between areas of `bbox1` and `bbox2` individually
+// and that of the union of the two.
+func overlaps(bbox1, bbox2 model.PdfRectangle) float64 {
+	union := RectUnion(bbox1, bbox2)
+	a := bboxArea(union)
+	b := bboxArea(bbox1) + bboxArea(bbox2)
+	diff := (a - b) / (a + b)
+	return diff
+}
+
+// Measure of the vertical overlap of `bbox1` and `bbox2`, when the difference is 0
+// then they are exactly on top of each other, and there is overlap when < 0.
+func lineOverlap(bbox1, bbox2 model.PdfRectangle) float64 {
+	union := RectUnion(bbox1, bbox2)
+	a := math.Abs(union.Ury - union.Lly)
+	b := math.Abs(bbox1.Ury-bbox1.Lly) + math.Abs(bbox2.Ury-bbox2.Lly)
+	diff := (a - b) / (a + b)
+	return diff
+}
+
+// ColumnOverlap is a measure of the horizontal overlap of `bbox1` and `bbox2`. When the difference
+// is 0 they are exactly next to each other, and there is overlap when < 0.
+func ColumnOverlap(bbox1, bbox2 model.PdfRectangle) float64 {
+	union := RectUnion(bbox1, bbox2)
+	a := math.Abs(union.Urx - union.Llx)
+	b := math.Abs(bbox1.Urx-bbox1.Llx) + math.Abs(bbox2.Urx-bbox2.Llx)
+	diff := (a - b) / (a + b)
+	return diff
+}
@@ -0,0 +1,144 @@
+package segment
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/unidoc/unipdf/v3/extractor"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// word is a word placed at a position of a page.
+type word struct {
+	text string
+	x, y float64
+}
+
+// textMarks returns the text marks of `words`, one 6 by 10 point mark per character.
+func textMarks(words ...word) *extractor.TextMarkArray {
+	marks := &extractor.TextMarkArray{}
+	for _, w := range words {
+		for i, r := range w.text {
+			x := w.x + 6*float64(i)
+			marks.Append(extractor.TextMark{
+				Text: string(r),
+				BBox: model.PdfRectangle{Llx: x, Lly: w.y, Urx: x + 6, Ury: w.y + 10},
+			})
+		}
+	}
+	return marks
+}
+
+func TestSegment(t *testing.T) {
+	tests := []struct {
+		name    string
+		words   []word
+		cells   [][]string
+		csv     string
+		columns int
+	}{
+		{
+			name:    "empty",
+			cells:   [][]string{},
+			csv:     "",
+			columns: 0,
+		},
+		{
+			name:    "single line",
+			words:   []word{{"Name", 0, 100}, {"Age", 100, 100}},
+			cells:   [][]string{{"Name", "Age"}},
+			csv:     "Name,Age\n",
+			columns: 2,
+		},
+		{
+			name:    "rows",
+			words:   []word{{"Bob", 0, 80}, {"42", 100, 80}, {"Name", 0, 100}, {"Age", 100, 100}},
+			cells:   [][]string{{"Name", "Age"}, {"Bob", "42"}},
+			csv:     "Name,Age\nBob,42\n",
+			columns: 2,
+		},
+		{
+			name:    "running text above table",
+			words:   []word{{"Title", 0, 120}, {"Name", 0, 100}, {"Age", 100, 100}},
+			cells:   [][]string{{"Title", ""}, {"Name", "Age"}},
+			csv:     "Title,\nName,Age\n",
+			columns: 2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			table := Segment(textMarks(tc.words...))
+			if len(table.Words) != len(tc.words) {
+				t.Errorf("got %d words, want %d", len(table.Words), len(tc.words))
+			}
+			if len(table.Columns) != tc.columns {
+				t.Errorf("got %d columns, want %d", len(table.Columns), tc.columns)
+			}
+			if !reflect.DeepEqual(table.Cells, tc.cells) {
+				t.Errorf("got cells %q, want %q", table.Cells, tc.cells)
+			}
+			csv, err := table.CSV()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if csv != tc.csv {
+				t.Errorf("got CSV %q, want %q", csv, tc.csv)
+			}
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	words := Words(textMarks(word{"b", 50, 100}, word{"c", 0, 50}, word{"a", 0, 100}))
+	var got [][]string
+	for _, line := range Lines(words) {
+		var texts []string
+		for _, w := range line {
+			texts = append(texts, w.String())
+		}
+		got = append(got, texts)
+	}
+	want := [][]string{{"a", "b"}, {"c"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got lines %q, want %q", got, want)
+	}
+}
+
+func TestColumnOverlap(t *testing.T) {
+	tests := []struct {
+		name   string
+		b1, b2 model.PdfRectangle
+		sign   int
+	}{
+		{"apart", model.PdfRectangle{Urx: 10, Ury: 10}, model.PdfRectangle{Llx: 20, Urx: 30, Ury: 10}, 1},
+		{"adjacent", model.PdfRectangle{Urx: 10, Ury: 10}, model.PdfRectangle{Llx: 10, Urx: 20, Ury: 10}, 0},
+		{"overlapping", model.PdfRectangle{Urx: 10, Ury: 10}, model.PdfRectangle{Llx: 5, Urx: 15, Ury: 10}, -1},
+		{"other line", model.PdfRectangle{Urx: 10, Ury: 10}, model.PdfRectangle{Lly: 50, Urx: 10, Ury: 60}, -1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ColumnOverlap(tc.b1, tc.b2)
+			if sign(got) != tc.sign {
+				t.Errorf("got %v, want sign %d", got, tc.sign)
+			}
+		})
+	}
+}
+
+func TestRectUnion(t *testing.T) {
+	got := RectUnion(model.PdfRectangle{Llx: 0, Lly: 5, Urx: 10, Ury: 15}, model.PdfRectangle{Llx: -5, Lly: 10, Urx: 5, Ury: 20})
+	want := model.PdfRectangle{Llx: -5, Lly: 5, Urx: 10, Ury: 20}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func sign(v float64) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}